@@ -0,0 +1,248 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// diffURL validates the spec and returns the diff without applying it.
+	diffURL = apiURL + "/admin/diff"
+)
+
+type (
+	// applyFile is a spec file to apply.
+	applyFile struct {
+		path string
+		buff []byte
+		name string
+	}
+
+	// specDiff is the part of the diff response used by apply.
+	specDiff struct {
+		Exists bool `yaml:"exists"`
+	}
+)
+
+func applyObjectsCmd() *cobra.Command {
+	var (
+		specFile         string
+		validateAllFirst bool
+		parallel         int
+	)
+	cmd := &cobra.Command{
+		Use:   "apply",
+		Short: "Create or update objects from a yaml file or the yaml files in a directory",
+		Example: "egctl object apply -f specs/\n" +
+			"egctl object apply -f specs/ --validate-all-first --parallel 4",
+		Run: func(cmd *cobra.Command, args []string) {
+			if specFile == "" {
+				ExitWithErrorf("%s failed: file is required", cmd.Short)
+			}
+			if parallel < 1 {
+				ExitWithErrorf("%s failed: parallel must be positive", cmd.Short)
+			}
+
+			files, err := readApplyFiles(specFile)
+			if err != nil {
+				ExitWithErrorf("%s failed: %v", cmd.Short, err)
+			}
+
+			if validateAllFirst {
+				errs := runApplyFiles(files, len(files), validateApplyFile)
+				if len(errs) > 0 {
+					exitWithApplyErrors("validate", errs, len(files))
+				}
+			}
+
+			errs := runApplyFiles(files, parallel, applyApplyFile)
+			if len(errs) > 0 {
+				exitWithApplyErrors("apply", errs, len(files))
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&specFile, "file", "f", "", "A yaml file or a directory of yaml files specifying the objects.")
+	cmd.Flags().BoolVar(&validateAllFirst, "validate-all-first", false,
+		"Validate all files by the server in parallel, and apply none of them if any is invalid.")
+	cmd.Flags().IntVar(&parallel, "parallel", 1, "The number of files applied concurrently.")
+
+	return cmd
+}
+
+// readApplyFiles reads the file, or the .yaml and .yml files in the directory by name.
+func readApplyFiles(path string) ([]*applyFile, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := []string{path}
+	if info.IsDir() {
+		entries, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+
+		paths = nil
+		for _, entry := range entries {
+			ext := filepath.Ext(entry.Name())
+			if entry.IsDir() || (ext != ".yaml" && ext != ".yml") {
+				continue
+			}
+			paths = append(paths, filepath.Join(path, entry.Name()))
+		}
+		sort.Strings(paths)
+	}
+
+	files := make([]*applyFile, 0, len(paths))
+	for _, p := range paths {
+		buff, err := ioutil.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+
+		var spec struct {
+			Name string `yaml:"name"`
+		}
+		err = yaml.Unmarshal(buff, &spec)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid spec: %v", p, err)
+		}
+
+		files = append(files, &applyFile{path: p, buff: buff, name: spec.Name})
+	}
+
+	return files, nil
+}
+
+// runApplyFiles runs fn on the files with at most parallel goroutines,
+// it returns the errors in the order of the files.
+func runApplyFiles(files []*applyFile, parallel int, fn func(*applyFile) error) []error {
+	results := make([]error, len(files))
+	sem := make(chan struct{}, parallel)
+	wg := &sync.WaitGroup{}
+	for i, file := range files {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, file *applyFile) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[i] = fn(file)
+		}(i, file)
+	}
+	wg.Wait()
+
+	errs := []error{}
+	for _, err := range results {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+func exitWithApplyErrors(phase string, errs []error, total int) {
+	msgs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+
+	ExitWithErrorf("%s failed for %d/%d files:\n%s", phase, len(errs), total, strings.Join(msgs, "\n"))
+}
+
+func validateApplyFile(file *applyFile) error {
+	_, err := doApplyRequest(http.MethodPost, makeURL(diffURL), file.buff)
+	if err != nil {
+		return fmt.Errorf("%s: %v", file.path, err)
+	}
+
+	return nil
+}
+
+// applyApplyFile updates the object if it exists, or creates it.
+func applyApplyFile(file *applyFile) error {
+	body, err := doApplyRequest(http.MethodPost, makeURL(diffURL), file.buff)
+	if err != nil {
+		return fmt.Errorf("%s: %v", file.path, err)
+	}
+
+	diff := &specDiff{}
+	err = yaml.Unmarshal(body, diff)
+	if err != nil {
+		return fmt.Errorf("%s: unmarshal diff failed: %v", file.path, err)
+	}
+
+	if diff.Exists {
+		_, err = doApplyRequest(http.MethodPut, makeURL(objectURL, file.name), file.buff)
+	} else {
+		_, err = doApplyRequest(http.MethodPost, makeURL(objectsURL), file.buff)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", file.path, err)
+	}
+
+	fmt.Printf("%s: %s applied\n", file.path, file.name)
+	return nil
+}
+
+// doApplyRequest is handleRequest returning the error instead of exiting.
+func doApplyRequest(httpMethod string, url string, reqBody []byte) ([]byte, error) {
+	req, err := http.NewRequest(httpMethod, url, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if !successfulStatusCode(resp.StatusCode) {
+		msg := string(body)
+		apiErr := &APIErr{}
+		err = yaml.Unmarshal(body, apiErr)
+		if err == nil {
+			msg = apiErr.Message
+		}
+		return nil, fmt.Errorf("%d: %s", resp.StatusCode, strings.TrimSpace(msg))
+	}
+
+	return body, nil
+}
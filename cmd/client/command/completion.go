@@ -0,0 +1,478 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// annotationObjectArgs marks the commands whose arguments are
+	// object names, which are completed from the admin API.
+	annotationObjectArgs = "egctl_object_args"
+)
+
+var (
+	specFileExtensions = []string{"yaml", "yml"}
+	outputFormats      = []string{"yaml", "json"}
+)
+
+// CompletionCmd defines completion command.
+func CompletionCmd(rootCmd *cobra.Command) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "completion",
+		Short: "Output shell completion code for the specified shell",
+		Example: `  # Load the completion of bash in the current shell.
+  source <(egctl completion bash)
+
+  # Load the completion of fish in the current shell.
+  egctl completion fish | source`,
+	}
+
+	gen := func(shell string, fn func(w io.Writer) error) *cobra.Command {
+		return &cobra.Command{
+			Use:   shell,
+			Short: fmt.Sprintf("Output shell completion code for %s", shell),
+			Args:  cobra.NoArgs,
+			Run: func(cmd *cobra.Command, args []string) {
+				prepareCompletion(rootCmd)
+				err := fn(os.Stdout)
+				if err != nil {
+					ExitWithErrorf("%s failed: %v", cmd.Short, err)
+				}
+			},
+		}
+	}
+
+	cmd.AddCommand(gen("bash", rootCmd.GenBashCompletion))
+	cmd.AddCommand(gen("zsh", func(w io.Writer) error { return genZshCompletion(rootCmd, w) }))
+	cmd.AddCommand(gen("fish", func(w io.Writer) error { return genFishCompletion(rootCmd, w) }))
+	cmd.AddCommand(gen("powershell", func(w io.Writer) error { return genPowerShellCompletion(rootCmd, w) }))
+	cmd.AddCommand(completionObjectsCmd())
+
+	return cmd
+}
+
+// completionObjectsCmd lists the object names for the completion scripts.
+func completionObjectsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:    "objects",
+		Short:  "List object names for completion",
+		Hidden: true,
+		Args:   cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			resp, err := http.Get(makeURL(objectsURL))
+			if err != nil {
+				os.Exit(1)
+			}
+			defer resp.Body.Close()
+
+			body, err := ioutil.ReadAll(resp.Body)
+			if err != nil || !successfulStatusCode(resp.StatusCode) {
+				os.Exit(1)
+			}
+
+			var specs []struct {
+				Name string `yaml:"name"`
+			}
+			if yaml.Unmarshal(body, &specs) != nil {
+				os.Exit(1)
+			}
+			for _, spec := range specs {
+				fmt.Println(spec.Name)
+			}
+		},
+	}
+}
+
+// prepareCompletion annotates the flags for the completion.
+func prepareCompletion(rootCmd *cobra.Command) {
+	var objectCommands []string
+	walkCommands(rootCmd, func(path []string, cmd *cobra.Command) {
+		if cmd.Annotations[annotationObjectArgs] != "" {
+			objectCommands = append(objectCommands,
+				strings.Join(append([]string{rootCmd.Name()}, path...), "_"))
+		}
+	})
+	rootCmd.BashCompletionFunction = fmt.Sprintf(bashCompletionFunction,
+		strings.Join(objectCommands, " | "))
+	cobra.MarkFlagCustom(rootCmd.PersistentFlags(), "output", "__egctl_output_formats")
+
+	walkCommands(rootCmd, func(path []string, cmd *cobra.Command) {
+		if cmd.Flags().Lookup("file") != nil {
+			cobra.MarkFlagFilename(cmd.Flags(), "file", specFileExtensions...)
+		}
+	})
+}
+
+// walkCommands visits the available commands,
+// path is the names of the command and its ancestors except the root.
+func walkCommands(cmd *cobra.Command, fn func(path []string, cmd *cobra.Command)) {
+	var walk func(path []string, cmd *cobra.Command)
+	walk = func(path []string, cmd *cobra.Command) {
+		fn(path, cmd)
+		for _, c := range cmd.Commands() {
+			if !c.IsAvailableCommand() || c.Name() == "help" {
+				continue
+			}
+			walk(append(path[:len(path):len(path)], c.Name()), c)
+		}
+	}
+	walk(nil, cmd)
+}
+
+const bashCompletionFunction = `
+__egctl_server_flag()
+{
+    local i
+    for ((i = 1; i < ${#words[@]}; i++)); do
+        case "${words[i]}" in
+            --server)
+                echo "--server=${words[i+1]}"
+                ;;
+            --server=*)
+                echo "${words[i]}"
+                ;;
+        esac
+    done
+}
+
+__egctl_objects()
+{
+    local objects
+    if objects=$(egctl completion objects $(__egctl_server_flag) 2>/dev/null); then
+        COMPREPLY=( $(compgen -W "${objects}" -- "$cur") )
+    fi
+}
+
+__egctl_output_formats()
+{
+    COMPREPLY=( $(compgen -W "yaml json" -- "$cur") )
+}
+
+__custom_func()
+{
+    case ${last_command} in
+        %s)
+            __egctl_objects
+            return
+            ;;
+    esac
+}
+`
+
+// genZshCompletion reuses the bash completion, as the built-in one of
+// zsh completes the subcommands only.
+func genZshCompletion(rootCmd *cobra.Command, w io.Writer) error {
+	buff := &bytes.Buffer{}
+	err := rootCmd.GenBashCompletion(buff)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "#compdef %s\n\n", rootCmd.Name())
+	fmt.Fprintln(w, "autoload -U +X bashcompinit && bashcompinit")
+	_, err = buff.WriteTo(w)
+	return err
+}
+
+// completionTree is the commands and flags of the tree, keyed by the paths.
+type completionTree struct {
+	root *cobra.Command
+	// paths are sorted.
+	paths       []string
+	commands    map[string]*cobra.Command
+	objectPaths []string
+	// valueFlags take values, such as --server and -o.
+	valueFlags []string
+}
+
+func newCompletionTree(rootCmd *cobra.Command) *completionTree {
+	t := &completionTree{root: rootCmd, commands: map[string]*cobra.Command{}}
+
+	flags := map[string]bool{}
+	walkCommands(rootCmd, func(path []string, cmd *cobra.Command) {
+		key := strings.Join(path, " ")
+		t.paths = append(t.paths, key)
+		t.commands[key] = cmd
+		if cmd.Annotations[annotationObjectArgs] != "" {
+			t.objectPaths = append(t.objectPaths, key)
+		}
+
+		cmd.LocalFlags().VisitAll(func(f *pflag.Flag) {
+			if f.Value.Type() == "bool" {
+				return
+			}
+			flags["--"+f.Name] = true
+			if f.Shorthand != "" {
+				flags["-"+f.Shorthand] = true
+			}
+		})
+	})
+
+	for f := range flags {
+		t.valueFlags = append(t.valueFlags, f)
+	}
+	sort.Strings(t.paths)
+	sort.Strings(t.objectPaths)
+	sort.Strings(t.valueFlags)
+
+	return t
+}
+
+func (t *completionTree) subcommands(path string) []*cobra.Command {
+	var subcommands []*cobra.Command
+	for _, c := range t.commands[path].Commands() {
+		if c.IsAvailableCommand() && c.Name() != "help" {
+			subcommands = append(subcommands, c)
+		}
+	}
+	return subcommands
+}
+
+func (t *completionTree) localFlags(path string, fn func(f *pflag.Flag)) {
+	cmd := t.commands[path]
+	flags := cmd.LocalFlags()
+	if cmd == t.root {
+		flags = cmd.PersistentFlags()
+	}
+	flags.VisitAll(fn)
+}
+
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+func genFishCompletion(rootCmd *cobra.Command, w io.Writer) error {
+	t := newCompletionTree(rootCmd)
+	buff := &bytes.Buffer{}
+	name := rootCmd.Name()
+
+	fmt.Fprintf(buff, "# fish completion for %s\n\n", name)
+
+	fmt.Fprintf(buff, "function __%s_subcommands\n    switch \"$argv\"\n", name)
+	for _, path := range t.paths {
+		var names []string
+		for _, c := range t.subcommands(path) {
+			names = append(names, c.Name())
+		}
+		if len(names) > 0 {
+			fmt.Fprintf(buff, "        case %s\n            echo %s\n", fishQuote(path), strings.Join(names, " "))
+		}
+	}
+	fmt.Fprint(buff, "    end\nend\n\n")
+
+	fmt.Fprintf(buff, `# __%[1]s_path prints the subcommands typed, flags and arguments are skipped.
+function __%[1]s_path
+    set -l words (commandline -opc)
+    set -e words[1]
+    set -l path
+    set -l skip 0
+    for w in $words
+        if test $skip -eq 1
+            set skip 0
+            continue
+        end
+        switch $w
+            case %[2]s
+                set skip 1
+            case '-*'
+            case '*'
+                if contains -- $w (string split ' ' (__%[1]s_subcommands $path))
+                    set path $path $w
+                end
+        end
+    end
+    echo "$path"
+end
+
+function __%[1]s_path_is
+    set -l path (__%[1]s_path)
+    test "$path" = "$argv"
+end
+
+function __%[1]s_objects
+    set -l server
+    set -l words (commandline -opc)
+    for i in (seq (count $words))
+        switch $words[$i]
+            case --server
+                set server --server=$words[(math $i + 1)]
+            case '--server=*'
+                set server $words[$i]
+        end
+    end
+    %[1]s completion objects $server 2>/dev/null
+end
+
+complete -c %[1]s -f
+`, name, strings.Join(t.valueFlags, " "))
+
+	for _, path := range t.paths {
+		cond := fmt.Sprintf("__%s_path_is %s", name, path)
+		for _, c := range t.subcommands(path) {
+			fmt.Fprintf(buff, "complete -c %s -n %s -a %s -d %s\n",
+				name, fishQuote(cond), c.Name(), fishQuote(c.Short))
+		}
+
+		t.localFlags(path, func(f *pflag.Flag) {
+			line := fmt.Sprintf("complete -c %s", name)
+			if t.commands[path] != t.root {
+				line += " -n " + fishQuote(cond)
+			}
+			if f.Shorthand != "" {
+				line += " -s " + f.Shorthand
+			}
+			line += " -l " + f.Name
+			switch {
+			case f.Name == "file":
+				line += " -r -F"
+			case f.Name == "output":
+				line += " -x -a " + fishQuote(strings.Join(outputFormats, " "))
+			case f.Value.Type() != "bool":
+				line += " -x"
+			}
+			fmt.Fprintln(buff, line+" -d "+fishQuote(f.Usage))
+		})
+	}
+
+	for _, path := range t.objectPaths {
+		fmt.Fprintf(buff, "complete -c %s -n %s -a '(__%s_objects)'\n",
+			name, fishQuote("__"+name+"_path_is "+path), name)
+	}
+
+	_, err := buff.WriteTo(w)
+	return err
+}
+
+func powerShellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+func powerShellArray(items []string) string {
+	quoted := make([]string, len(items))
+	for i, item := range items {
+		quoted[i] = powerShellQuote(item)
+	}
+	return "@(" + strings.Join(quoted, ", ") + ")"
+}
+
+func genPowerShellCompletion(rootCmd *cobra.Command, w io.Writer) error {
+	t := newCompletionTree(rootCmd)
+	buff := &bytes.Buffer{}
+	name := rootCmd.Name()
+
+	fmt.Fprintf(buff, "# powershell completion for %s\n\n", name)
+	fmt.Fprintf(buff, "Register-ArgumentCompleter -Native -CommandName %s -ScriptBlock {\n", name)
+	fmt.Fprintln(buff, "    param($wordToComplete, $commandAst, $cursorPosition)")
+	fmt.Fprintln(buff)
+
+	fmt.Fprintln(buff, "    $subcommands = @{")
+	for _, path := range t.paths {
+		var names []string
+		for _, c := range t.subcommands(path) {
+			names = append(names, c.Name())
+		}
+		fmt.Fprintf(buff, "        %s = %s\n", powerShellQuote(path), powerShellArray(names))
+	}
+	fmt.Fprintln(buff, "    }")
+
+	fmt.Fprintln(buff, "    $flags = @{")
+	var rootFlags []string
+	t.localFlags("", func(f *pflag.Flag) {
+		rootFlags = append(rootFlags, "--"+f.Name)
+	})
+	for _, path := range t.paths {
+		flags := append([]string{}, rootFlags...)
+		if path != "" {
+			t.localFlags(path, func(f *pflag.Flag) {
+				flags = append(flags, "--"+f.Name)
+			})
+		}
+		fmt.Fprintf(buff, "        %s = %s\n", powerShellQuote(path), powerShellArray(flags))
+	}
+	fmt.Fprintln(buff, "    }")
+
+	fmt.Fprintf(buff, "    $valueFlags = %s\n", powerShellArray(t.valueFlags))
+	fmt.Fprintf(buff, "    $objectPaths = %s\n", powerShellArray(t.objectPaths))
+	fmt.Fprintf(buff, "    $outputFormats = %s\n\n", powerShellArray(outputFormats))
+
+	fmt.Fprintf(buff, `    $words = @($commandAst.CommandElements |
+        Where-Object { $_.Extent.EndOffset -le $cursorPosition } |
+        ForEach-Object { $_.ToString() })
+    if ($wordToComplete -ne '' -and $words.Count -gt 1) {
+        $words = $words[0..($words.Count - 2)]
+    }
+
+    $path = @()
+    $server = @()
+    for ($i = 1; $i -lt $words.Count; $i++) {
+        $w = $words[$i]
+        if ($w -eq '--server' -and $i + 1 -lt $words.Count) {
+            $server = @("--server=$($words[$i + 1])")
+        } elseif ($w -like '--server=*') {
+            $server = @($w)
+        }
+        if ($valueFlags -contains $w) {
+            $i++
+            continue
+        }
+        if ($w.StartsWith('-')) {
+            continue
+        }
+        if ($subcommands[$path -join ' '] -contains $w) {
+            $path += $w
+        }
+    }
+    $key = $path -join ' '
+    $prev = if ($words.Count -gt 1) { $words[-1] } else { '' }
+
+    $candidates = @()
+    if ($prev -eq '-f' -or $prev -eq '--file') {
+        # NOTE: PowerShell completes the paths if nothing is returned.
+        return
+    } elseif ($prev -eq '-o' -or $prev -eq '--output') {
+        $candidates = $outputFormats
+    } elseif ($wordToComplete.StartsWith('-')) {
+        $candidates = $flags[$key]
+    } elseif ($subcommands[$key].Count -gt 0) {
+        $candidates = $subcommands[$key]
+    } elseif ($objectPaths -contains $key) {
+        $candidates = @(& %s completion objects @server 2>$null)
+    }
+
+    $candidates | Where-Object { $_ -like "$wordToComplete*" } | ForEach-Object {
+        [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+    }
+}
+`, name)
+
+	_, err := buff.WriteTo(w)
+	return err
+}
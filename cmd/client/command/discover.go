@@ -0,0 +1,604 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	discoverTimeout = 10 * time.Second
+	// maxDiscoveryDocSize bounds the discovery documents read.
+	maxDiscoveryDocSize = 10 * 1024 * 1024
+
+	discoverOpenAPIYAML        = "/openapi.yaml"
+	discoverSwaggerJSON        = "/swagger.json"
+	discoverActuatorMappings   = "/actuator/mappings"
+	discoverOptionsAsterisk    = "OPTIONS *"
+	discoverRateLimiterName    = "rate-limiter"
+	discoverCircuitBreakerName = "circuit-breaker"
+	discoverProxyName          = "proxy"
+)
+
+var (
+	discoverHTTPMethods = []string{
+		http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions, http.MethodTrace,
+	}
+
+	// actuatorPredicate matches the predicates of Spring Boot 2, such as
+	// {GET [/pets/{id}], produces [application/json]}.
+	actuatorPredicate = regexp.MustCompile(`^\{(?:([A-Z, ]+) )?\[([^\]]*)\]`)
+	// actuatorLegacyPredicate matches the predicates of Spring Boot 1, such as
+	// {[/pets/{id}],methods=[GET]}.
+	actuatorLegacyPredicate = regexp.MustCompile(`^\{\[([^\]]*)\](?:,methods=\[([^\]]*)\])?`)
+
+	invalidObjectNameChars = regexp.MustCompile(`[^A-Za-z0-9\-_.~]+`)
+)
+
+type (
+	// discoveredEndpoint is an endpoint of the target service.
+	discoveredEndpoint struct {
+		path string
+		// methods is empty if all methods are matched.
+		methods []string
+		// review explains why the endpoint needs manual review,
+		// it's empty if the endpoint is completely discovered.
+		review string
+	}
+
+	discoverer struct {
+		target *url.URL
+		client *http.Client
+
+		// allowed is the methods allowed by OPTIONS *.
+		allowed   []string
+		sources   []string
+		endpoints map[string]*discoveredEndpoint
+	}
+
+	openAPIDoc struct {
+		// BasePath is the base path of Swagger 2.0.
+		BasePath string `yaml:"basePath" json:"basePath"`
+		// Servers are the servers of OpenAPI 3.
+		Servers []struct {
+			URL string `yaml:"url" json:"url"`
+		} `yaml:"servers" json:"servers"`
+		Paths map[string]map[string]interface{} `yaml:"paths" json:"paths"`
+	}
+
+	actuatorMapping struct {
+		Predicate string `json:"predicate"`
+		Details   *struct {
+			RequestMappingConditions *struct {
+				Methods  []string `json:"methods"`
+				Patterns []string `json:"patterns"`
+			} `json:"requestMappingConditions"`
+		} `json:"details"`
+	}
+
+	actuatorDoc struct {
+		Contexts map[string]struct {
+			Mappings struct {
+				DispatcherServlets map[string][]*actuatorMapping `json:"dispatcherServlets"`
+				DispatcherHandlers map[string][]*actuatorMapping `json:"dispatcherHandlers"`
+			} `json:"mappings"`
+		} `json:"contexts"`
+	}
+)
+
+// DiscoverCmd defines discover command.
+func DiscoverCmd() *cobra.Command {
+	var target string
+	cmd := &cobra.Command{
+		Use:   "discover",
+		Short: "Discover the endpoints of a service and generate a pipeline spec",
+		Long: "Discover the endpoints of a service by OPTIONS *, " + discoverOpenAPIYAML + ", " +
+			discoverSwaggerJSON + " and " + discoverActuatorMappings + ",\n" +
+			"and generate a pipeline spec rate limiting and circuit breaking them.\n" +
+			"The spec is written to the file of --output, or stdout if it's not set.",
+		Example: "egctl discover --target http://myservice:8080 --output pipeline.yaml",
+		// NOTE: The output flag is the file to write the spec,
+		// so the check of the output format is skipped.
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+		Run: func(cmd *cobra.Command, args []string) {
+			if target == "" {
+				ExitWithErrorf("%s failed: target is required", cmd.Short)
+			}
+
+			d, err := newDiscoverer(target)
+			if err != nil {
+				ExitWithErrorf("%s failed: %v", cmd.Short, err)
+			}
+			d.discover()
+			if len(d.endpoints) == 0 {
+				ExitWithErrorf("%s failed: no endpoint is discovered from %s", cmd.Short, target)
+			}
+
+			spec := d.pipelineSpec()
+			if !cmd.Flags().Changed("output") {
+				fmt.Printf("%s", spec)
+				return
+			}
+
+			output := CommandlineGlobalFlags.OutputFormat
+			err = ioutil.WriteFile(output, spec, 0644)
+			if err != nil {
+				ExitWithErrorf("%s failed: %v", cmd.Short, err)
+			}
+			fmt.Printf("%d endpoints discovered from %s, %d need manual review, written to %s\n",
+				len(d.endpoints), strings.Join(d.sources, ", "), d.reviewCount(), output)
+		},
+	}
+
+	cmd.Flags().StringVar(&target, "target", "", "The base URL of the service, such as http://myservice:8080.")
+
+	return cmd
+}
+
+func newDiscoverer(target string) (*discoverer, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported scheme of target %s", target)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("host of target %s is required", target)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+
+	return &discoverer{
+		target:    u,
+		client:    &http.Client{Timeout: discoverTimeout},
+		endpoints: map[string]*discoveredEndpoint{},
+	}, nil
+}
+
+func (d *discoverer) discover() {
+	d.discoverAllowedMethods()
+
+	if body, ok := d.fetch(discoverOpenAPIYAML); ok {
+		d.parseOpenAPI(discoverOpenAPIYAML, body)
+	}
+	if body, ok := d.fetch(discoverSwaggerJSON); ok {
+		d.parseOpenAPI(discoverSwaggerJSON, body)
+	}
+	if body, ok := d.fetch(discoverActuatorMappings); ok {
+		d.parseActuatorMappings(discoverActuatorMappings, body)
+	}
+}
+
+// discoverAllowedMethods sends OPTIONS * to get the methods allowed by the server.
+func (d *discoverer) discoverAllowedMethods() {
+	req, err := http.NewRequest(http.MethodOptions, d.target.String(), nil)
+	if err != nil {
+		return
+	}
+	req.URL = &url.URL{Scheme: d.target.Scheme, Host: d.target.Host, Opaque: "*"}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", discoverOptionsAsterisk, err)
+		return
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxDiscoveryDocSize))
+
+	for _, value := range resp.Header.Values("Allow") {
+		for _, method := range strings.Split(value, ",") {
+			method = strings.ToUpper(strings.TrimSpace(method))
+			if isHTTPMethod(method) && !contains(d.allowed, method) {
+				d.allowed = append(d.allowed, method)
+			}
+		}
+	}
+	if len(d.allowed) > 0 {
+		sortMethods(d.allowed)
+		d.sources = append(d.sources, discoverOptionsAsterisk)
+	}
+}
+
+func (d *discoverer) fetch(path string) ([]byte, bool) {
+	resp, err := d.client.Get(d.target.String() + path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		return nil, false
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, false
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxDiscoveryDocSize))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		return nil, false
+	}
+	return body, true
+}
+
+func (d *discoverer) parseOpenAPI(source string, body []byte) {
+	doc := &openAPIDoc{}
+	if err := json.Unmarshal(body, doc); err != nil {
+		doc = &openAPIDoc{}
+		if err := yaml.Unmarshal(body, doc); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: invalid document: %v\n", source, err)
+			return
+		}
+	}
+	if len(doc.Paths) == 0 {
+		return
+	}
+
+	basePath := doc.BasePath
+	if len(doc.Servers) > 0 {
+		if u, err := url.Parse(doc.Servers[0].URL); err == nil {
+			basePath = u.Path
+		}
+	}
+	basePath = strings.TrimSuffix(basePath, "/")
+
+	d.sources = append(d.sources, source)
+	for path, item := range doc.Paths {
+		var methods []string
+		for key := range item {
+			if method := strings.ToUpper(key); isHTTPMethod(method) {
+				methods = append(methods, method)
+			}
+		}
+
+		review := ""
+		if len(methods) == 0 {
+			review = "no operation is defined in " + source
+		}
+		d.addEndpoint(basePath+path, methods, review)
+	}
+}
+
+func (d *discoverer) parseActuatorMappings(source string, body []byte) {
+	doc := &actuatorDoc{}
+	if err := json.Unmarshal(body, doc); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: invalid document: %v\n", source, err)
+		return
+	}
+
+	var mappings []*actuatorMapping
+	for _, c := range doc.Contexts {
+		for _, ms := range c.Mappings.DispatcherServlets {
+			mappings = append(mappings, ms...)
+		}
+		for _, ms := range c.Mappings.DispatcherHandlers {
+			mappings = append(mappings, ms...)
+		}
+	}
+
+	if len(doc.Contexts) == 0 {
+		// NOTE: Spring Boot 1 uses the predicates as the keys.
+		legacy := map[string]json.RawMessage{}
+		if err := json.Unmarshal(body, &legacy); err == nil {
+			for predicate := range legacy {
+				mappings = append(mappings, &actuatorMapping{Predicate: predicate})
+			}
+		}
+	}
+
+	count := len(d.endpoints)
+	for _, m := range mappings {
+		if m.Details != nil && m.Details.RequestMappingConditions != nil {
+			conditions := m.Details.RequestMappingConditions
+			for _, pattern := range conditions.Patterns {
+				d.addEndpoint(pattern, conditions.Methods, "")
+			}
+			continue
+		}
+
+		patterns, methods, ok := parseActuatorPredicate(m.Predicate)
+		if !ok {
+			continue
+		}
+		for _, pattern := range patterns {
+			d.addEndpoint(pattern, methods, "parsed from the predicate "+m.Predicate)
+		}
+	}
+
+	if len(mappings) > 0 || len(d.endpoints) > count {
+		d.sources = append(d.sources, source)
+	}
+}
+
+func parseActuatorPredicate(predicate string) (patterns, methods []string, ok bool) {
+	var rawPatterns, rawMethods string
+	if m := actuatorLegacyPredicate.FindStringSubmatch(predicate); m != nil {
+		rawPatterns, rawMethods = m[1], m[2]
+	} else if m := actuatorPredicate.FindStringSubmatch(predicate); m != nil {
+		rawMethods, rawPatterns = m[1], m[2]
+	} else {
+		return nil, nil, false
+	}
+
+	for _, p := range strings.Split(rawPatterns, ",") {
+		if p = strings.TrimSpace(p); strings.HasPrefix(p, "/") {
+			patterns = append(patterns, p)
+		}
+	}
+	for _, m := range strings.Split(rawMethods, ",") {
+		if m = strings.TrimSpace(m); isHTTPMethod(m) {
+			methods = append(methods, m)
+		}
+	}
+
+	return patterns, methods, len(patterns) > 0
+}
+
+// addEndpoint adds the endpoint, the methods are merged if it exists.
+func (d *discoverer) addEndpoint(path string, methods []string, review string) {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	e, exists := d.endpoints[path]
+	if !exists {
+		e = &discoveredEndpoint{path: path, methods: methods, review: review}
+		d.endpoints[path] = e
+		return
+	}
+
+	if len(e.methods) == 0 || len(methods) == 0 {
+		e.methods = nil
+	} else {
+		for _, method := range methods {
+			if !contains(e.methods, method) {
+				e.methods = append(e.methods, method)
+			}
+		}
+	}
+	if review == "" {
+		e.review = ""
+	}
+}
+
+func (d *discoverer) reviewCount() int {
+	count := 0
+	for _, e := range d.endpoints {
+		if e.review != "" || len(e.methods) == 0 && len(d.allowed) > 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// sortedEndpoints returns the endpoints with exact paths first, and the
+// longer templates before the shorter ones, as the URL rules match in order.
+func (d *discoverer) sortedEndpoints() []*discoveredEndpoint {
+	endpoints := make([]*discoveredEndpoint, 0, len(d.endpoints))
+	for _, e := range d.endpoints {
+		endpoints = append(endpoints, e)
+	}
+
+	sort.Slice(endpoints, func(i, j int) bool {
+		ri, rj := pathRegexp(endpoints[i].path) != "", pathRegexp(endpoints[j].path) != ""
+		if ri != rj {
+			return !ri
+		}
+		if ri && len(endpoints[i].path) != len(endpoints[j].path) {
+			return len(endpoints[i].path) > len(endpoints[j].path)
+		}
+		return endpoints[i].path < endpoints[j].path
+	})
+
+	return endpoints
+}
+
+// pathRegexp converts the path template to a regular expression,
+// it returns empty string if the path is not a template.
+// The templates of OpenAPI ({id}) and Spring ({id:\d+}, {*path}, * and **)
+// are supported.
+func pathRegexp(path string) string {
+	if !strings.ContainsAny(path, "{*") {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(path); {
+		switch {
+		case path[i] == '{':
+			depth, end := 0, -1
+			for j := i; j < len(path) && end < 0; j++ {
+				switch path[j] {
+				case '{':
+					depth++
+				case '}':
+					depth--
+					if depth == 0 {
+						end = j
+					}
+				}
+			}
+			if end < 0 {
+				sb.WriteString(regexp.QuoteMeta(path[i:]))
+				i = len(path)
+				continue
+			}
+
+			variable := path[i+1 : end]
+			switch {
+			case strings.HasPrefix(variable, "*"):
+				sb.WriteString(".*")
+			case strings.Contains(variable, ":"):
+				sb.WriteString("(?:" + variable[strings.Index(variable, ":")+1:] + ")")
+			default:
+				sb.WriteString("[^/]+")
+			}
+			i = end + 1
+		case strings.HasPrefix(path[i:], "**"):
+			sb.WriteString(".*")
+			i += 2
+		case path[i] == '*':
+			sb.WriteString("[^/]*")
+			i++
+		default:
+			sb.WriteString(regexp.QuoteMeta(path[i : i+1]))
+			i++
+		}
+	}
+	sb.WriteString("$")
+
+	return sb.String()
+}
+
+func (d *discoverer) pipelineName() string {
+	name := invalidObjectNameChars.ReplaceAllString(d.target.Hostname(), "-")
+	return strings.Trim(name, "-") + "-pipeline"
+}
+
+// pipelineSpec generates the spec of the pipeline, with the stub filters
+// rate limiting and circuit breaking the discovered endpoints.
+func (d *discoverer) pipelineSpec() []byte {
+	var sb strings.Builder
+	urls := d.urlRules()
+
+	fmt.Fprintf(&sb, "# Generated by egctl discover from %s.\n", d.target)
+	fmt.Fprintf(&sb, "# Sources: %s.\n", strings.Join(d.sources, ", "))
+	sb.WriteString("# The policies are defaults, tune them before creating the pipeline.\n")
+	fmt.Fprintf(&sb, "name: %s\n", d.pipelineName())
+	sb.WriteString("kind: HTTPPipeline\n")
+	sb.WriteString("flow:\n")
+	fmt.Fprintf(&sb, "  - filter: %s\n", discoverRateLimiterName)
+	sb.WriteString("    jumpIf: { rateLimited: END }\n")
+	fmt.Fprintf(&sb, "  - filter: %s\n", discoverCircuitBreakerName)
+	sb.WriteString("    jumpIf: { shortCircuited: END }\n")
+	fmt.Fprintf(&sb, "  - filter: %s\n", discoverProxyName)
+	sb.WriteString("filters:\n")
+
+	fmt.Fprintf(&sb, "  - name: %s\n", discoverRateLimiterName)
+	sb.WriteString("    kind: RateLimiter\n")
+	sb.WriteString("    policies:\n")
+	sb.WriteString("    - name: default\n")
+	sb.WriteString("      timeoutDuration: 100ms\n")
+	sb.WriteString("      limitRefreshPeriod: 10ms\n")
+	sb.WriteString("      limitForPeriod: 50\n")
+	sb.WriteString("    defaultPolicyRef: default\n")
+	sb.WriteString("    urls:\n")
+	sb.WriteString(urls)
+
+	fmt.Fprintf(&sb, "  - name: %s\n", discoverCircuitBreakerName)
+	sb.WriteString("    kind: CircuitBreaker\n")
+	sb.WriteString("    policies:\n")
+	sb.WriteString("    - name: default\n")
+	sb.WriteString("      slidingWindowType: COUNT_BASED\n")
+	sb.WriteString("      failureRateThreshold: 50\n")
+	sb.WriteString("      slidingWindowSize: 100\n")
+	sb.WriteString("      failureStatusCodes: [500, 503, 504]\n")
+	sb.WriteString("    defaultPolicyRef: default\n")
+	sb.WriteString("    urls:\n")
+	sb.WriteString(urls)
+
+	fmt.Fprintf(&sb, "  - name: %s\n", discoverProxyName)
+	sb.WriteString("    kind: Proxy\n")
+	sb.WriteString("    mainPool:\n")
+	sb.WriteString("      servers:\n")
+	fmt.Fprintf(&sb, "      - url: %s://%s\n", d.target.Scheme, d.target.Host)
+	sb.WriteString("      loadBalance:\n")
+	sb.WriteString("        policy: roundRobin\n")
+
+	return []byte(sb.String())
+}
+
+func (d *discoverer) urlRules() string {
+	var sb strings.Builder
+	for _, e := range d.sortedEndpoints() {
+		methods, review := e.methods, e.review
+		if len(methods) == 0 && len(d.allowed) > 0 {
+			// NOTE: All methods may be matched on purpose, but the
+			// server doesn't allow them all.
+			methods = d.allowed
+			if review == "" {
+				review = "methods are not restricted"
+			}
+			review += ", the ones allowed by OPTIONS * are used"
+		}
+
+		if review != "" {
+			fmt.Fprintf(&sb, "    # Needs manual review: %s.\n", strings.ReplaceAll(review, "\n", " "))
+		}
+		if len(methods) > 0 {
+			methods = append([]string(nil), methods...)
+			sortMethods(methods)
+			fmt.Fprintf(&sb, "    - methods: [%s]\n", strings.Join(methods, ", "))
+			sb.WriteString("      url:\n")
+		} else {
+			sb.WriteString("    - url:\n")
+		}
+		if re := pathRegexp(e.path); re != "" {
+			fmt.Fprintf(&sb, "        regex: %s\n", yamlQuote(re))
+		} else {
+			fmt.Fprintf(&sb, "        exact: %s\n", yamlQuote(e.path))
+		}
+		sb.WriteString("      policyRef: default\n")
+	}
+	return sb.String()
+}
+
+func yamlQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func isHTTPMethod(method string) bool {
+	return contains(discoverHTTPMethods, method)
+}
+
+// sortMethods sorts the methods in the order of discoverHTTPMethods.
+func sortMethods(methods []string) {
+	index := func(method string) int {
+		for i, m := range discoverHTTPMethods {
+			if m == method {
+				return i
+			}
+		}
+		return len(discoverHTTPMethods)
+	}
+	sort.Slice(methods, func(i, j int) bool {
+		return index(methods[i]) < index(methods[j])
+	})
+}
+
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -37,6 +37,7 @@ func ObjectCmd() *cobra.Command {
 	cmd.AddCommand(getObjectCmd())
 	cmd.AddCommand(createObjectCmd())
 	cmd.AddCommand(updateObjectCmd())
+	cmd.AddCommand(applyObjectsCmd())
 	cmd.AddCommand(deleteObjectCmd())
 	cmd.AddCommand(statusObjectCmd())
 
@@ -89,9 +90,10 @@ func updateObjectCmd() *cobra.Command {
 
 func deleteObjectCmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:     "delete",
-		Short:   "Delete an object",
-		Example: "egctl object delete <object_name>",
+		Use:         "delete",
+		Short:       "Delete an object",
+		Example:     "egctl object delete <object_name>",
+		Annotations: map[string]string{annotationObjectArgs: "true"},
 		Args: func(cmd *cobra.Command, args []string) error {
 			if len(args) != 1 {
 				return errors.New("requires one object name to be deleted")
@@ -110,9 +112,10 @@ func deleteObjectCmd() *cobra.Command {
 
 func getObjectCmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:     "get",
-		Short:   "Get an object",
-		Example: "egctl object get <object_name>",
+		Use:         "get",
+		Short:       "Get an object",
+		Example:     "egctl object get <object_name>",
+		Annotations: map[string]string{annotationObjectArgs: "true"},
 		Args: func(cmd *cobra.Command, args []string) error {
 			if len(args) != 1 {
 				return errors.New("requires one object name to be retrieved")
@@ -157,9 +160,10 @@ func statusObjectCmd() *cobra.Command {
 
 func getStatusObjectCmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:     "get",
-		Short:   "Get status of an object",
-		Example: "egctl object status get <object_name>",
+		Use:         "get",
+		Short:       "Get status of an object",
+		Example:     "egctl object status get <object_name>",
+		Annotations: map[string]string{annotationObjectArgs: "true"},
 		Args: func(cmd *cobra.Command, args []string) error {
 			if len(args) != 1 {
 				return errors.New("requires one object name to be retrieved")
@@ -0,0 +1,338 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// PluginPrefix is the prefix of the executable names of egctl plugins.
+	PluginPrefix = "egctl-"
+
+	// PluginAPIAddrEnv is the environment variable passing the address
+	// of the Easegress endpoint to plugins.
+	PluginAPIAddrEnv = "EGCTL_API_ADDR"
+)
+
+type pluginInfo struct {
+	Name string `yaml:"name"`
+	Path string `yaml:"path"`
+	// Shadowed means it's hidden by the one with the same name
+	// found earlier, or by a built-in command.
+	Shadowed bool `yaml:"shadowed,omitempty"`
+}
+
+var pluginLong = `Plugins are executables named egctl-<name> found in $PATH or in the plugin
+directory(~/.egctl/plugins), which extend egctl with the command <name>.
+
+Conventions of plugins:
+  - Built-in commands always take precedence over plugins.
+  - The dashes in the executable name nest the command, so egctl-foo-bar is
+    invoked by "egctl foo bar", the longest matching name wins.
+  - The arguments after the plugin name are passed to the plugin untouched,
+    including the global flags, so they should be put after the plugin name.
+  - The address of the Easegress endpoint(from --server) is passed in the
+    environment variable ` + PluginAPIAddrEnv + `.
+  - The plugin writes to stdout/stderr directly, and its exit code is the
+    exit code of egctl.`
+
+// PluginCmd defines plugin command.
+func PluginCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "plugin",
+		Short: "Manage egctl plugins",
+		Long:  pluginLong,
+	}
+
+	cmd.AddCommand(listPluginCmd())
+	cmd.AddCommand(installPluginCmd())
+	return cmd
+}
+
+func listPluginCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List installed egctl plugins",
+		Run: func(cmd *cobra.Command, args []string) {
+			plugins := listPlugins(cmd.Root())
+			if len(plugins) == 0 {
+				return
+			}
+
+			buff, err := yaml.Marshal(plugins)
+			if err != nil {
+				ExitWithErrorf("%s failed: %v", cmd.Short, err)
+			}
+			printBody(buff)
+		},
+	}
+
+	return cmd
+}
+
+func installPluginCmd() *cobra.Command {
+	var name, dir string
+
+	cmd := &cobra.Command{
+		Use:     "install <url>",
+		Short:   "Download and install an egctl plugin",
+		Example: "egctl plugin install https://example.com/egctl-foo",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("requires one url of the plugin binary")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			if dir == "" {
+				dir = defaultPluginDir()
+			}
+
+			pluginPath, err := installPlugin(args[0], name, dir)
+			if err != nil {
+				ExitWithErrorf("%s failed: %v", cmd.Short, err)
+			}
+			fmt.Printf("plugin installed to %s\n", pluginPath)
+		},
+	}
+
+	cmd.Flags().StringVar(&name, "name", "",
+		"The plugin name, default to the one in the url without the prefix "+PluginPrefix)
+	cmd.Flags().StringVar(&dir, "dir", "", "The directory to install to, default to ~/.egctl/plugins")
+
+	return cmd
+}
+
+func defaultPluginDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".egctl", "plugins")
+}
+
+// pluginDirs returns the directories to find plugins in order.
+func pluginDirs() []string {
+	dirs := filepath.SplitList(os.Getenv("PATH"))
+	if dir := defaultPluginDir(); dir != "" {
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+func isExecutable(fi os.FileInfo) bool {
+	if !fi.Mode().IsRegular() {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(filepath.Ext(fi.Name()), ".exe")
+	}
+	return fi.Mode().Perm()&0111 != 0
+}
+
+func pluginName(fileName string) string {
+	if runtime.GOOS == "windows" {
+		fileName = strings.TrimSuffix(fileName, filepath.Ext(fileName))
+	}
+	return strings.TrimPrefix(fileName, PluginPrefix)
+}
+
+func listPlugins(rootCmd *cobra.Command) []*pluginInfo {
+	plugins := []*pluginInfo{}
+	seen := map[string]bool{}
+	for _, dir := range pluginDirs() {
+		if dir == "" {
+			dir = "."
+		}
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+
+		for _, fi := range files {
+			if !strings.HasPrefix(fi.Name(), PluginPrefix) || !isExecutable(fi) {
+				continue
+			}
+
+			name := pluginName(fi.Name())
+			_, _, err := rootCmd.Find(strings.Split(name, "-"))
+			plugins = append(plugins, &pluginInfo{
+				Name:     name,
+				Path:     filepath.Join(dir, fi.Name()),
+				Shadowed: seen[name] || err == nil,
+			})
+			seen[name] = true
+		}
+	}
+
+	return plugins
+}
+
+func lookupPlugin(name string) (string, bool) {
+	for _, dir := range pluginDirs() {
+		if dir == "" {
+			dir = "."
+		}
+		for _, fileName := range []string{PluginPrefix + name, PluginPrefix + name + ".exe"} {
+			fullPath := filepath.Join(dir, fileName)
+			fi, err := os.Stat(fullPath)
+			if err == nil && isExecutable(fi) {
+				return fullPath, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+func installPlugin(rawURL, name, dir string) (string, error) {
+	if dir == "" {
+		return "", fmt.Errorf("no plugin directory")
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid url %s: %v", rawURL, err)
+	}
+	if name == "" {
+		base := path.Base(u.Path)
+		if !strings.HasPrefix(base, PluginPrefix) {
+			return "", fmt.Errorf("%s is not named %s<name>, please specify --name", base, PluginPrefix)
+		}
+		name = pluginName(base)
+	}
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("invalid plugin name %q", name)
+	}
+	fileName := PluginPrefix + name
+	if runtime.GOOS == "windows" {
+		fileName += ".exe"
+	}
+
+	resp, err := http.Get(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("download %s failed: %v", rawURL, err)
+	}
+	defer resp.Body.Close()
+	if !successfulStatusCode(resp.StatusCode) {
+		return "", fmt.Errorf("download %s failed: status code %d", rawURL, resp.StatusCode)
+	}
+
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return "", err
+	}
+
+	// NOTE: Write to a temporary file and rename it, so the running
+	// plugin with the same name is never seen partially written.
+	f, err := ioutil.TempFile(dir, "."+fileName+"-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = io.Copy(f, resp.Body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("download %s failed: %v", rawURL, err)
+	}
+
+	err = os.Chmod(f.Name(), 0755)
+	if err != nil {
+		return "", err
+	}
+
+	pluginPath := filepath.Join(dir, fileName)
+	err = os.Rename(f.Name(), pluginPath)
+	if err != nil {
+		return "", err
+	}
+
+	return pluginPath, nil
+}
+
+// RunPluginIfNeeded runs the plugin and exits if args don't invoke
+// any built-in command but a plugin, or it returns without doing anything.
+func RunPluginIfNeeded(rootCmd *cobra.Command, args []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return
+	}
+
+	rootCmd.InitDefaultHelpCmd()
+	if _, _, err := rootCmd.Find(args); err == nil {
+		return
+	}
+
+	names := []string{}
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			break
+		}
+		names = append(names, arg)
+	}
+
+	// NOTE: The longest matching name wins, such as egctl-foo-bar
+	// over egctl-foo for "egctl foo bar".
+	for i := len(names); i > 0; i-- {
+		pluginPath, exists := lookupPlugin(strings.Join(names[:i], "-"))
+		if exists {
+			runPlugin(rootCmd, pluginPath, args[i:])
+		}
+	}
+}
+
+func runPlugin(rootCmd *cobra.Command, pluginPath string, args []string) {
+	// NOTE: Pick up --server in the plugin arguments,
+	// while leaving the unknown flags to the plugin.
+	flags := pflag.NewFlagSet(rootCmd.Name(), pflag.ContinueOnError)
+	flags.ParseErrorsWhitelist.UnknownFlags = true
+	flags.SetOutput(ioutil.Discard)
+	flags.AddFlagSet(rootCmd.PersistentFlags())
+	flags.Parse(args)
+
+	cmd := exec.Command(pluginPath, args...)
+	cmd.Env = append(os.Environ(), PluginAPIAddrEnv+"="+CommandlineGlobalFlags.Server)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	err := cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		os.Exit(exitErr.ExitCode())
+	}
+	if err != nil {
+		ExitWithErrorf("run plugin %s failed: %v", pluginPath, err)
+	}
+	os.Exit(0)
+}
@@ -69,6 +69,15 @@ var exampleUsage = `  # List APIs.
 
   # Get object status
   egctl object status get <object_name>
+
+  # List installed plugins.
+  egctl plugin list
+
+  # Install a plugin.
+  egctl plugin install <url>
+
+  # Discover the endpoints of a service and generate a pipeline spec.
+  egctl discover --target http://myservice:8080 --output pipeline.yaml
 `
 
 func main() {
@@ -87,29 +96,15 @@ func main() {
 		},
 	}
 
-	completionCmd := &cobra.Command{
-		Use:   "completion bash|zsh",
-		Short: "Output shell completion code for the specified shell (bash or zsh)",
-		Run: func(cmd *cobra.Command, args []string) {
-			switch args[0] {
-			case "bash":
-				rootCmd.GenBashCompletion(os.Stdout)
-			case "zsh":
-				rootCmd.GenZshCompletion(os.Stdout)
-			default:
-				command.ExitWithErrorf("unsupported shell %s, expecting bash or zsh", args[0])
-			}
-		},
-		Args: cobra.ExactArgs(1),
-	}
-
 	rootCmd.AddCommand(
 		command.APICmd(),
 		command.HealthCmd(),
 		command.ObjectCmd(),
 		command.MemberCmd(),
 		command.MeshCmd(),
-		completionCmd,
+		command.PluginCmd(),
+		command.DiscoverCmd(),
+		command.CompletionCmd(rootCmd),
 	)
 
 	rootCmd.PersistentFlags().StringVar(&command.CommandlineGlobalFlags.Server,
@@ -117,6 +112,8 @@ func main() {
 	rootCmd.PersistentFlags().StringVarP(&command.CommandlineGlobalFlags.OutputFormat,
 		"output", "o", "yaml", "Output format(json, yaml)")
 
+	command.RunPluginIfNeeded(rootCmd, os.Args[1:])
+
 	err := rootCmd.Execute()
 	if err != nil {
 		command.ExitWithError(err)
@@ -112,6 +112,10 @@ func main() {
 	}()
 	logger.Infof("%s signal received, closing easegress", sig)
 
+	// NOTE: The objects such as KubernetesPodLifecycle drain the
+	// traffic before closing, another signal stops waiting.
+	super.Drain()
+
 	wg := &sync.WaitGroup{}
 	wg.Add(4)
 	apiServer.Close(wg)
@@ -0,0 +1,65 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+const (
+	// AdminPrefix is the prefix of administrative APIs.
+	AdminPrefix = "/admin"
+)
+
+func (s *Server) setupAdminAPIs() {
+	adminAPIs := []*APIEntry{
+		{
+			Path:   AdminPrefix + "/diff",
+			Method: "POST",
+			// NOTE: It changes nothing.
+			Idempotent: boolPointer(true),
+			Handler:    s.diffObject,
+		},
+		{
+			Path:    AdminPrefix + "/graph",
+			Method:  "GET",
+			Handler: s.getGraph,
+		},
+		{
+			Path:    MaintenancePath,
+			Method:  "GET",
+			Handler: s.getMaintenance,
+		},
+		{
+			Path:    MaintenancePath,
+			Method:  "PUT",
+			Signed:  true,
+			Handler: s.setMaintenance,
+		},
+		{
+			Path:    MaintenancePath,
+			Method:  "DELETE",
+			Signed:  true,
+			Handler: s.deleteMaintenance,
+		},
+		{
+			Path:    AdminPrefix + "/reconnect",
+			Method:  "POST",
+			Signed:  true,
+			Handler: s.debugAuth(s.reconnect),
+		},
+	}
+
+	s.RegisterAPIs(adminAPIs)
+}
@@ -23,15 +23,18 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
+	"sort"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/megaease/easegress/pkg/cluster"
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/option"
+	"github.com/megaease/easegress/pkg/supervisor"
 
 	"github.com/kataras/iris"
-	yaml "gopkg.in/yaml.v2"
 )
 
 func aboutText() string {
@@ -48,6 +51,13 @@ const (
 
 	// ConfigVersionKey is the key of header for config version.
 	ConfigVersionKey = "X-Config-Version"
+
+	// APICountHeader is the key of header for the count of listed APIs.
+	APICountHeader = "X-Easegress-API-Count"
+
+	// listAPIsTimeout bounds marshaling the listing if the request
+	// has no deadline.
+	listAPIsTimeout = 5 * time.Second
 )
 
 type (
@@ -57,16 +67,82 @@ type (
 		cluster   cluster.Cluster
 		apisMutex sync.RWMutex
 		apis      []*APIEntry
+		// apisMarshaler marshals the listing, it's marshalYAML if nil.
+		apisMarshaler func(in interface{}) ([]byte, error)
+		// pipelineGetter gets the running pipeline, it looks up
+		// the global supervisor if nil.
+		pipelineGetter func(name string) (supervisor.Object, bool)
 
 		mutex      cluster.Mutex
 		mutexMutex sync.Mutex
+
+		debugToken string
+
+		startTime time.Time
+		// restartCount is nil if it failed to persist the count.
+		restartCount *uint64
+
+		// signingSecret verifies the signatures of signed APIs,
+		// they are not verified if it's empty.
+		signingSecret    []byte
+		signingTolerance time.Duration
+
+		// streams are the slots of streaming connections, nil means unlimited.
+		streams chan struct{}
+
+		// degraded is accessed atomically, 1 means in degraded mode.
+		degraded      int32
+		degradedCache sync.Map
+
+		latencies latencyHistograms
+
+		// maintenance holds *MaintenanceSpec, nil means it's off.
+		maintenance atomic.Value
+
+		// middlewares are the names of middlewares in execution order.
+		middlewares []string
+
+		// baseCtx is the parent of all request contexts,
+		// it's cancelled on closing.
+		baseCtx    context.Context
+		cancelBase context.CancelFunc
 	}
 
 	// APIEntry is the entry of API.
 	APIEntry struct {
-		Path    string       `yaml:"path"`
-		Method  string       `yaml:"method"`
-		Handler iris.Handler `yaml:"-"`
+		Path   string `yaml:"path"`
+		Method string `yaml:"method"`
+		// Signed requires the requests to be signed by HMAC, see Sign.
+		Signed bool `yaml:"signed,omitempty"`
+		// Idempotent tells clients whether it's safe to retry the API,
+		// it's set by the method if nil, see idempotentMethods.
+		Idempotent *bool `yaml:"idempotent"`
+		// CacheControl is the Cache-Control header of the responses,
+		// it's no-store for the APIs of unsafe methods if empty.
+		CacheControl string       `yaml:"cacheControl,omitempty"`
+		Handler      iris.Handler `yaml:"-"`
+	}
+)
+
+var (
+	// idempotentMethods are the methods of idempotent APIs by default,
+	// the APIs of POST, PATCH and CONNECT are not idempotent by default.
+	idempotentMethods = map[string]bool{
+		"GET":     true,
+		"HEAD":    true,
+		"PUT":     true,
+		"DELETE":  true,
+		"OPTIONS": true,
+		"TRACE":   true,
+	}
+
+	// safeMethods are the methods not modifying resources,
+	// the APIs of the others are not cached by default.
+	safeMethods = map[string]bool{
+		"GET":     true,
+		"HEAD":    true,
+		"OPTIONS": true,
+		"TRACE":   true,
 	}
 )
 
@@ -80,8 +156,23 @@ func MustNewServer(opt *option.Options, cluster cluster.Cluster) *Server {
 	app := iris.New()
 
 	s := &Server{
-		app:     app,
-		cluster: cluster,
+		app:        app,
+		cluster:    cluster,
+		debugToken: opt.APIDebugToken,
+
+		signingSecret: []byte(opt.APISigningSecret),
+		streams:       newStreamSlots(opt.APIMaxStreams),
+	}
+	// NOTE: It has been validated in options.
+	s.signingTolerance, _ = time.ParseDuration(opt.APISigningTolerance)
+	s.baseCtx, s.cancelBase = context.WithCancel(context.Background())
+
+	s.startTime = time.Now()
+	restartCount, err := countRestart(opt.AbsHomeDir)
+	if err != nil {
+		logger.Errorf("count restart failed: %v", err)
+	} else {
+		s.restartCount = &restartCount
 	}
 
 	// NOTE: Fix trailing slash problem.
@@ -96,13 +187,11 @@ func MustNewServer(opt *option.Options, cluster cluster.Cluster) *Server {
 		next(w, r)
 	})
 
-	app.Use(newConfigVersionAttacher(s))
-	app.Use(newRecoverer())
-	app.Use(newAPILogger())
+	s.setupMiddlewares()
 
 	app.Logger().SetOutput(ioutil.Discard)
 
-	_, err := s.getMutex()
+	_, err = s.getMutex()
 	if err != nil {
 		logger.Errorf("get cluster mutex %s failed: %v", lockKey, err)
 	}
@@ -112,7 +201,7 @@ func MustNewServer(opt *option.Options, cluster cluster.Cluster) *Server {
 	go func() {
 		logger.Infof("api server running in %s", opt.APIAddr)
 
-		err := app.Run(iris.Addr(opt.APIAddr))
+		err := app.Run(iris.Addr(opt.APIAddr, s.withBaseContext()))
 		if err == iris.ErrServerClosed {
 			return
 		}
@@ -127,13 +216,32 @@ func MustNewServer(opt *option.Options, cluster cluster.Cluster) *Server {
 	return s
 }
 
+// setupMiddlewares sets up the middlewares in execution order:
+// the config version is attached before anything is written, the
+// recoverer covers the rest, the logger and the latency recorder see
+// every rejection of the guards, then the requests are checked.
+func (s *Server) setupMiddlewares() {
+	s.use("configVersionAttacher", newConfigVersionAttacher(s))
+	s.use("recoverer", newRecoverer())
+	s.use("apiLogger", newAPILogger())
+	s.use("latencyRecorder", newLatencyRecorder(s))
+	s.use("maintenanceGuard", newMaintenanceGuard(s))
+	s.use("pathParamsLimiter", newPathParamsLimiter())
+}
+
 func (s *Server) setupAPIs() {
 	s.setupListAPIs()
+	s.setupCapabilityAPIs()
 	s.setupMemberAPIs()
 	s.setupObjectAPIs()
+	s.setupBundleAPIs()
 	s.setupMetadaAPIs()
 	s.setupHealthAPIs()
 	s.setupAboutAPIs()
+	s.setupDebugAPIs()
+	s.setupLogAPIs()
+	s.setupAdminAPIs()
+	s.setupPipelineAPIs()
 }
 
 func (s *Server) setupListAPIs() {
@@ -158,25 +266,40 @@ func (s *Server) RegisterAPIs(apis []*APIEntry) {
 
 	for _, api := range apis {
 		api.Path = APIPrefix + api.Path
+		if api.Idempotent == nil {
+			api.Idempotent = boolPointer(idempotentMethods[api.Method])
+		}
+		if api.CacheControl == "" && !safeMethods[api.Method] {
+			api.CacheControl = "no-store"
+		}
+
+		handler := api.Handler
+		if api.Signed {
+			handler = s.signatureAuth(handler)
+		}
+		if api.CacheControl != "" {
+			handler = cacheControl(api.CacheControl, handler)
+		}
+
 		switch api.Method {
 		case "GET":
-			s.app.Get(api.Path, api.Handler)
+			s.app.Get(api.Path, handler)
 		case "HEAD":
-			s.app.Head(api.Path, api.Handler)
+			s.app.Head(api.Path, handler)
 		case "PUT":
-			s.app.Put(api.Path, api.Handler)
+			s.app.Put(api.Path, handler)
 		case "POST":
-			s.app.Post(api.Path, api.Handler)
+			s.app.Post(api.Path, handler)
 		case "PATCH":
-			s.app.Patch(api.Path, api.Handler)
+			s.app.Patch(api.Path, handler)
 		case "DELETE":
-			s.app.Delete(api.Path, api.Handler)
+			s.app.Delete(api.Path, handler)
 		case "CONNECT":
-			s.app.Connect(api.Path, api.Handler)
+			s.app.Connect(api.Path, handler)
 		case "OPTIONS":
-			s.app.Options(api.Path, api.Handler)
+			s.app.Options(api.Path, handler)
 		case "TRACE":
-			s.app.Trace(api.Path, api.Handler)
+			s.app.Trace(api.Path, handler)
 		}
 
 	}
@@ -184,6 +307,19 @@ func (s *Server) RegisterAPIs(apis []*APIEntry) {
 	s.app.RefreshRouter()
 }
 
+// cacheControl sets the Cache-Control header before the handler,
+// so the header is in the responses of errors too.
+func cacheControl(value string, handler iris.Handler) iris.Handler {
+	return func(ctx iris.Context) {
+		ctx.Header("Cache-Control", value)
+		handler(ctx)
+	}
+}
+
+func boolPointer(b bool) *bool {
+	return &b
+}
+
 func (s *Server) setupHealthAPIs() {
 	healthAPIs := []*APIEntry{
 		{
@@ -213,22 +349,99 @@ func (s *Server) setupAboutAPIs() {
 }
 
 func (s *Server) listAPIs(ctx iris.Context) {
+	r := ReadPagination(ctx)
+	if r == nil {
+		return
+	}
+
+	// NOTE: Marshal the snapshot outside the lock,
+	// so a slow marshaling never blocks the registration.
 	s.apisMutex.RLock()
-	defer s.apisMutex.RUnlock()
+	apis := make([]APIEntry, 0, len(s.apis))
+	for _, api := range s.apis {
+		apis = append(apis, *api)
+	}
+	s.apisMutex.RUnlock()
+
+	ctx.Header(APICountHeader, strconv.Itoa(len(apis)))
+
+	// NOTE: The APIs are listed in the order of registration, and
+	// the paginated ones are ordered by path and method instead.
+	var listing interface{} = apis
+	if r.Paginated() {
+		sort.Slice(apis, func(i, j int) bool {
+			return apiName(&apis[i]) < apiName(&apis[j])
+		})
+		names := make([]string, 0, len(apis))
+		for i := range apis {
+			names = append(names, apiName(&apis[i]))
+		}
+		listing = NewPage(r, names, func(start, end int) interface{} {
+			return apis[start:end]
+		}, nil)
+	}
 
-	buff, err := yaml.Marshal(s.apis)
-	if err != nil {
-		panic(fmt.Errorf("marshal %#v to yaml failed: %v", s.apis, err))
+	// NOTE: The empty listing is written directly, since [] is
+	// valid in both YAML and JSON whatever the marshaler emits.
+	if len(apis) == 0 && !r.Paginated() {
+		ctx.Header("Content-Type", "text/vnd.yaml")
+		ctx.WriteString("[]\n")
+		return
+	}
+
+	reqCtx := RequestContext(ctx)
+	if _, exists := reqCtx.Deadline(); !exists {
+		var cancel context.CancelFunc
+		reqCtx, cancel = context.WithTimeout(reqCtx, listAPIsTimeout)
+		defer cancel()
 	}
 
-	ctx.Header("Content-Type", "text/vnd.yaml")
-	ctx.Write(buff)
+	type marshalResult struct {
+		buff []byte
+		err  error
+	}
+	// NOTE: Buffered, so the marshaling goroutine never leaks.
+	resultChan := make(chan marshalResult, 1)
+	go func() {
+		buff, err := s.marshalAPIs(listing)
+		resultChan <- marshalResult{buff: buff, err: err}
+	}()
+
+	select {
+	case <-reqCtx.Done():
+		HandleAPIError(ctx, http.StatusServiceUnavailable,
+			fmt.Errorf("marshal apis aborted: %v", reqCtx.Err()))
+	case result := <-resultChan:
+		if result.err != nil {
+			HandleAPIError(ctx, http.StatusInternalServerError,
+				fmt.Errorf("marshal apis to yaml failed: %v", result.err))
+			return
+		}
+
+		ctx.Header("Content-Type", "text/vnd.yaml")
+		ctx.Write(result.buff)
+	}
+}
+
+func (s *Server) marshalAPIs(listing interface{}) ([]byte, error) {
+	if s.apisMarshaler != nil {
+		return s.apisMarshaler(listing)
+	}
+	return marshalYAML(listing)
+}
+
+// apiName is the name of the API in the cursor of the paginated listing.
+func apiName(api *APIEntry) string {
+	return api.Path + " " + api.Method
 }
 
 // Close closes Server.
 func (s *Server) Close(wg *sync.WaitGroup) {
 	defer wg.Done()
 
+	// NOTE: Unblock the handlers waiting on request contexts,
+	// otherwise Shutdown waits for them forever.
+	s.cancelBase()
 	s.app.Shutdown(context.Background())
 }
 
@@ -0,0 +1,301 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	stdcontext "context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+
+	"github.com/kataras/iris"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestListAPIs(t *testing.T) {
+	s := &Server{apis: []*APIEntry{{Path: APIPrefix + "/healthz", Method: "GET"}}}
+	app := newTestApp(t, func(app *iris.Application) {
+		app.Get("/apis", s.listAPIs)
+	})
+
+	w := serveTestRequest(app, httptest.NewRequest(http.MethodGet, "/apis", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("want %d, got %d", http.StatusOK, w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "path: /apis/v1/healthz") {
+		t.Errorf("unexpected listing %s", w.Body.String())
+	}
+	if count := w.Header().Get(APICountHeader); count != "1" {
+		t.Errorf("want %s 1, got %q", APICountHeader, count)
+	}
+}
+
+func TestListAPIsPagination(t *testing.T) {
+	s := &Server{apis: []*APIEntry{
+		{Path: APIPrefix + "/objects", Method: "POST"},
+		{Path: APIPrefix + "/objects", Method: "GET"},
+		{Path: APIPrefix + "/healthz", Method: "GET"},
+	}}
+	app := newTestApp(t, func(app *iris.Application) {
+		app.Get("/apis", s.listAPIs)
+	})
+
+	list := func(query string) (paths []string, cursor string) {
+		w := serveTestRequest(app, httptest.NewRequest(http.MethodGet, "/apis?"+query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: want %d, got %d", query, http.StatusOK, w.Code)
+		}
+		page := struct {
+			Items      []APIEntry `yaml:"items"`
+			NextCursor string     `yaml:"nextCursor"`
+		}{}
+		if err := yaml.Unmarshal(w.Body.Bytes(), &page); err != nil {
+			t.Fatalf("unmarshal %s failed: %v", w.Body.String(), err)
+		}
+		for _, api := range page.Items {
+			paths = append(paths, strings.TrimPrefix(api.Path, APIPrefix)+" "+api.Method)
+		}
+		return paths, page.NextCursor
+	}
+
+	paths, cursor := list("limit=2")
+	if strings.Join(paths, ",") != "/healthz GET,/objects GET" || cursor == "" {
+		t.Fatalf("unexpected first page %v, cursor %q", paths, cursor)
+	}
+	paths, cursor = list("limit=2&cursor=" + cursor)
+	if strings.Join(paths, ",") != "/objects POST" || cursor != "" {
+		t.Fatalf("unexpected last page %v, cursor %q", paths, cursor)
+	}
+
+	w := serveTestRequest(app, httptest.NewRequest(http.MethodGet, "/apis?limit=0", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("want %d for invalid limit, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestListAPIsEmpty(t *testing.T) {
+	s := &Server{
+		// NOTE: The marshaler isn't called for the empty listing.
+		apisMarshaler: func(in interface{}) ([]byte, error) {
+			return nil, fmt.Errorf("unexpected marshaling")
+		},
+	}
+	app := newTestApp(t, func(app *iris.Application) {
+		app.Get("/apis", s.listAPIs)
+	})
+
+	w := serveTestRequest(app, httptest.NewRequest(http.MethodGet, "/apis", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("want %d, got %d", http.StatusOK, w.Code)
+	}
+	if w.Body.String() != "[]\n" {
+		t.Errorf("want empty listing, got %q", w.Body.String())
+	}
+	if count := w.Header().Get(APICountHeader); count != "0" {
+		t.Errorf("want %s 0, got %q", APICountHeader, count)
+	}
+
+	var listing []APIEntry
+	if err := yaml.Unmarshal(w.Body.Bytes(), &listing); err != nil || len(listing) != 0 {
+		t.Errorf("want empty yaml listing, got %v: %v", listing, err)
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &listing); err != nil || len(listing) != 0 {
+		t.Errorf("want empty json listing, got %v: %v", listing, err)
+	}
+}
+
+func TestListAPIsIdempotent(t *testing.T) {
+	s := &Server{app: iris.New()}
+	handler := func(iris.Context) {}
+	s.RegisterAPIs([]*APIEntry{
+		{Path: "/get", Method: "GET", Handler: handler},
+		{Path: "/head", Method: "HEAD", Handler: handler},
+		{Path: "/put", Method: "PUT", Handler: handler},
+		{Path: "/delete", Method: "DELETE", Handler: handler},
+		{Path: "/post", Method: "POST", Handler: handler},
+		{Path: "/patch", Method: "PATCH", Handler: handler},
+		{Path: "/post-idempotent", Method: "POST", Idempotent: boolPointer(true), Handler: handler},
+		{Path: "/put-not-idempotent", Method: "PUT", Idempotent: boolPointer(false), Handler: handler},
+	})
+	app := newTestApp(t, func(app *iris.Application) {
+		app.Get("/apis", s.listAPIs)
+	})
+
+	w := serveTestRequest(app, httptest.NewRequest(http.MethodGet, "/apis", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("want %d, got %d", http.StatusOK, w.Code)
+	}
+
+	listing := []struct {
+		Path       string `yaml:"path"`
+		Idempotent *bool  `yaml:"idempotent"`
+	}{}
+	err := yaml.Unmarshal(w.Body.Bytes(), &listing)
+	if err != nil {
+		t.Fatalf("unmarshal listing failed: %v", err)
+	}
+
+	want := map[string]bool{
+		"/get":                true,
+		"/head":               true,
+		"/put":                true,
+		"/delete":             true,
+		"/post":               false,
+		"/patch":              false,
+		"/post-idempotent":    true,
+		"/put-not-idempotent": false,
+	}
+	if len(listing) != len(want) {
+		t.Fatalf("want %d apis, got %d", len(want), len(listing))
+	}
+	for _, api := range listing {
+		path := strings.TrimPrefix(api.Path, APIPrefix)
+		if api.Idempotent == nil || *api.Idempotent != want[path] {
+			t.Errorf("%s: want idempotent %v, got %v", path, want[path], api.Idempotent)
+		}
+	}
+}
+
+func TestRegisterAPIsCacheControl(t *testing.T) {
+	handler := func(iris.Context) {}
+	app := newTestApp(t, func(app *iris.Application) {
+		s := &Server{app: app}
+		s.RegisterAPIs([]*APIEntry{
+			{Path: "/status", Method: "GET", Handler: handler},
+			{Path: "/about", Method: "GET", CacheControl: "max-age=60", Handler: handler},
+			{Path: "/objects", Method: "POST", Handler: handler},
+			{Path: "/objects", Method: "DELETE", CacheControl: "no-cache", Handler: handler},
+		})
+	})
+
+	for _, c := range []struct {
+		method string
+		path   string
+		want   string
+	}{
+		{http.MethodGet, "/status", ""},
+		{http.MethodGet, "/about", "max-age=60"},
+		{http.MethodPost, "/objects", "no-store"},
+		{http.MethodDelete, "/objects", "no-cache"},
+	} {
+		w := serveTestRequest(app, httptest.NewRequest(c.method, APIPrefix+c.path, nil))
+		if got := w.Header().Get("Cache-Control"); got != c.want {
+			t.Errorf("%s %s: want Cache-Control %q, got %q", c.method, c.path, c.want, got)
+		}
+	}
+}
+
+func TestListAPIsSlowMarshal(t *testing.T) {
+	entered, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+
+	s := &Server{
+		apis: []*APIEntry{{Path: APIPrefix + "/healthz", Method: "GET"}},
+		apisMarshaler: func(in interface{}) ([]byte, error) {
+			close(entered)
+			<-release
+			return yaml.Marshal(in)
+		},
+	}
+	app := newTestApp(t, func(app *iris.Application) {
+		app.Get("/apis", s.listAPIs)
+	})
+
+	ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), 200*time.Millisecond)
+	defer cancel()
+	r := httptest.NewRequest(http.MethodGet, "/apis", nil).WithContext(ctx)
+
+	startTime := time.Now()
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		done <- serveTestRequest(app, r)
+	}()
+
+	<-entered
+	locked := make(chan struct{})
+	go func() {
+		s.apisMutex.Lock()
+		s.apisMutex.Unlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatalf("lock not released while marshaling")
+	}
+
+	select {
+	case w := <-done:
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("want %d, got %d", http.StatusServiceUnavailable, w.Code)
+		}
+		if elapsed := time.Since(startTime); elapsed > time.Second {
+			t.Errorf("want aborted at the deadline, took %v", elapsed)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("deadline not honored")
+	}
+}
+
+func TestListAPIsMarshalFailure(t *testing.T) {
+	s := &Server{
+		apis: []*APIEntry{{Path: APIPrefix + "/healthz", Method: "GET"}},
+		apisMarshaler: func(in interface{}) ([]byte, error) {
+			return nil, fmt.Errorf("injected marshal failure")
+		},
+	}
+	app := newTestApp(t, func(app *iris.Application) {
+		app.Use(newRecoverer())
+		app.Get("/apis", s.listAPIs)
+	})
+
+	w := serveTestRequest(app, httptest.NewRequest(http.MethodGet, "/apis", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("want %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+
+	apiErr := &APIErr{}
+	err := yaml.Unmarshal(w.Body.Bytes(), apiErr)
+	if err != nil {
+		t.Fatalf("unmarshal %s failed: %v", w.Body.String(), err)
+	}
+	if apiErr.Code != http.StatusInternalServerError ||
+		!strings.Contains(apiErr.Message, "injected marshal failure") {
+		t.Errorf("unexpected error %+v", apiErr)
+	}
+	if strings.Contains(apiErr.Message, "/healthz") {
+		t.Errorf("want no dump of apis in error, got %s", apiErr.Message)
+	}
+
+	logger.Sync()
+	buff, err := ioutil.ReadFile(filepath.Join(testLogDir, "stdout.log"))
+	if err != nil {
+		t.Fatalf("read log failed: %v", err)
+	}
+	if strings.Contains(string(buff), "injected marshal failure") {
+		t.Errorf("want no stack dump logged")
+	}
+}
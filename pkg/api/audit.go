@@ -0,0 +1,56 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kataras/iris"
+	yaml "gopkg.in/yaml.v2"
+)
+
+type (
+	// AuditMeta is the metadata of the admin request which changes an object,
+	// it's stored in the cluster along with the object for auditing.
+	AuditMeta struct {
+		RemoteAddr string `yaml:"remoteAddr"`
+		Method     string `yaml:"method"`
+		Path       string `yaml:"path"`
+		Time       string `yaml:"time"`
+	}
+)
+
+func newAuditMeta(ctx iris.Context) *AuditMeta {
+	return &AuditMeta{
+		RemoteAddr: ctx.RemoteAddr(),
+		Method:     ctx.Method(),
+		Path:       ctx.Path(),
+		Time:       time.Now().Format(time.RFC3339),
+	}
+}
+
+// YAML returns the yaml of AuditMeta.
+func (meta *AuditMeta) YAML() string {
+	buff, err := yaml.Marshal(meta)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", meta, err))
+	}
+
+	return string(buff)
+}
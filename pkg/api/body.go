@@ -0,0 +1,108 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"strings"
+	"sync"
+
+	"github.com/kataras/iris"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// BodyDecoder decodes the request body into a YAML document.
+type BodyDecoder func(body []byte) ([]byte, error)
+
+var (
+	bodyDecodersMutex sync.RWMutex
+	// bodyDecoders is keyed by the media type without parameters.
+	bodyDecoders = map[string]BodyDecoder{}
+)
+
+func init() {
+	for _, contentType := range []string{
+		"text/vnd.yaml", "text/yaml", "text/x-yaml",
+		"application/yaml", "application/x-yaml",
+	} {
+		RegisterBodyDecoder(contentType, decodeYAMLBody)
+	}
+	RegisterBodyDecoder("application/json", decodeJSONBody)
+}
+
+// RegisterBodyDecoder registers the decoder of the content type,
+// it replaces the registered one of the same content type.
+func RegisterBodyDecoder(contentType string, decoder BodyDecoder) {
+	bodyDecodersMutex.Lock()
+	defer bodyDecodersMutex.Unlock()
+
+	bodyDecoders[strings.ToLower(contentType)] = decoder
+}
+
+func getBodyDecoder(contentType string) BodyDecoder {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(contentType))
+	}
+
+	bodyDecodersMutex.RLock()
+	defer bodyDecodersMutex.RUnlock()
+
+	return bodyDecoders[mediaType]
+}
+
+// DecodeBody reads the request body and decodes it into a YAML document
+// by the decoder of its content type. The body is taken as YAML if no
+// decoder is registered for the content type, since clients like curl
+// send YAML as application/x-www-form-urlencoded by default.
+func DecodeBody(ctx iris.Context) ([]byte, error) {
+	body, err := ioutil.ReadAll(ctx.Request().Body)
+	if err != nil {
+		return nil, fmt.Errorf("read body failed: %v", err)
+	}
+
+	decoder := getBodyDecoder(ctx.GetHeader("Content-Type"))
+	if decoder == nil {
+		decoder = decodeYAMLBody
+	}
+
+	return decoder(body)
+}
+
+func decodeYAMLBody(body []byte) ([]byte, error) {
+	return body, nil
+}
+
+func decodeJSONBody(body []byte) ([]byte, error) {
+	var i interface{}
+	err := json.Unmarshal(body, &i)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal %s to json failed: %v", body, err)
+	}
+
+	buff, err := yaml.Marshal(i)
+	if err != nil {
+		return nil, fmt.Errorf("marshal %#v to yaml failed: %v", i, err)
+	}
+
+	return buff, nil
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kataras/iris"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// decodeKVBody decodes the lines of key=value.
+func decodeKVBody(body []byte) ([]byte, error) {
+	m := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(body)), "\n") {
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid line %s", line)
+		}
+		m[kv[0]] = kv[1]
+	}
+	return yaml.Marshal(m)
+}
+
+func TestDecodeBody(t *testing.T) {
+	RegisterBodyDecoder("application/x-easegress-kv", decodeKVBody)
+	defer func() {
+		bodyDecodersMutex.Lock()
+		delete(bodyDecoders, "application/x-easegress-kv")
+		bodyDecodersMutex.Unlock()
+	}()
+
+	app := newTestApp(t, func(app *iris.Application) {
+		app.Post("/", func(ctx iris.Context) {
+			body, err := DecodeBody(ctx)
+			if err != nil {
+				HandleAPIError(ctx, http.StatusBadRequest, err)
+				return
+			}
+			level := &LogLevel{}
+			err = yaml.Unmarshal(body, level)
+			if err != nil {
+				HandleAPIError(ctx, http.StatusBadRequest, err)
+				return
+			}
+			ctx.WriteString(level.Level)
+		})
+	})
+
+	for _, c := range []struct {
+		contentType string
+		body        string
+		code        int
+		level       string
+	}{
+		{"application/x-easegress-kv", "level=debug\n", http.StatusOK, "debug"},
+		{"Application/X-Easegress-KV; charset=utf-8", "level=info", http.StatusOK, "info"},
+		{"application/x-easegress-kv", "level: debug", http.StatusBadRequest, ""},
+		{"application/json", `{"level": "warn"}`, http.StatusOK, "warn"},
+		{"application/json", "level: warn", http.StatusBadRequest, ""},
+		{"text/vnd.yaml", "level: error", http.StatusOK, "error"},
+		{"application/x-www-form-urlencoded", "level: error", http.StatusOK, "error"},
+		{"", "level: error", http.StatusOK, "error"},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(c.body))
+		if c.contentType != "" {
+			r.Header.Set("Content-Type", c.contentType)
+		}
+		w := serveTestRequest(app, r)
+		if w.Code != c.code {
+			t.Errorf("%s: want %d, got %d: %s", c.contentType, c.code, w.Code, w.Body)
+			continue
+		}
+		if c.code == http.StatusOK && w.Body.String() != c.level {
+			t.Errorf("%s: want level %s, got %s", c.contentType, c.level, w.Body)
+		}
+	}
+}
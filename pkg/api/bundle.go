@@ -0,0 +1,321 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/supervisor"
+
+	"github.com/kataras/iris"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// BundlePrefix is the prefix of applying multi-document YAML streams.
+	BundlePrefix = "/bundles"
+
+	// BundleBestEffortPath is the path of applying every object in the
+	// stream independently, which responds the result of each one.
+	BundleBestEffortPath = BundlePrefix + "/best-effort"
+
+	bundleActionCreated = "created"
+	bundleActionUpdated = "updated"
+	bundleActionFailed  = "failed"
+)
+
+type (
+	// BundleResult is the result of applying an object in the bundle.
+	BundleResult struct {
+		Name   string `yaml:"name"`
+		Kind   string `yaml:"kind"`
+		Action string `yaml:"action"`
+
+		// The fields below are only for applying in best effort.
+		Document int    `yaml:"document,omitempty"`
+		Code     int    `yaml:"code,omitempty"`
+		Error    string `yaml:"error,omitempty"`
+	}
+
+	// yamlDocumentReader splits a multi-document YAML stream by ---,
+	// so that every document is handled before reading the next one.
+	yamlDocumentReader struct {
+		r     *bufio.Reader
+		index int
+		eof   bool
+		// pending is the content following the last ---,
+		// which belongs to the next document.
+		pending string
+	}
+)
+
+func (s *Server) setupBundleAPIs() {
+	bundleAPIs := []*APIEntry{
+		{
+			Path:   BundlePrefix,
+			Method: "POST",
+			Signed: true,
+			// NOTE: It creates or updates the objects to the same specs.
+			Idempotent: boolPointer(true),
+			Handler:    s.applyBundle,
+		},
+		{
+			Path:       BundleBestEffortPath,
+			Method:     "POST",
+			Signed:     true,
+			Idempotent: boolPointer(true),
+			Handler:    s.applyBundleBestEffort,
+		},
+	}
+
+	s.RegisterAPIs(bundleAPIs)
+}
+
+func newYAMLDocumentReader(r io.Reader) *yamlDocumentReader {
+	return &yamlDocumentReader{r: bufio.NewReader(r)}
+}
+
+// splitDocumentMarker reports whether the line starts or ends a document,
+// and returns the content following the marker in the same line.
+// NOTE: The content of block scalars is indented, so markers
+// at the beginning of the line are always markers.
+func splitDocumentMarker(line string) (bool, string) {
+	for _, marker := range []string{"---", "..."} {
+		if !strings.HasPrefix(line, marker) {
+			continue
+		}
+		rest := line[len(marker):]
+		if rest == "" || strings.ContainsRune(" \t\r\n", rune(rest[0])) {
+			return true, strings.TrimLeft(rest, " \t")
+		}
+	}
+
+	return false, ""
+}
+
+// isEmptyDocument reports whether the document has only blanks and comments.
+func isEmptyDocument(doc string) bool {
+	for _, line := range strings.Split(doc, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			return false
+		}
+	}
+
+	return true
+}
+
+// next returns the next non-empty document and its index starting from 1,
+// it returns io.EOF after the last one.
+func (dr *yamlDocumentReader) next() (string, int, error) {
+	for !dr.eof {
+		var doc strings.Builder
+		doc.WriteString(dr.pending)
+		dr.pending = ""
+		for {
+			line, err := dr.r.ReadString('\n')
+			if err == io.EOF {
+				dr.eof = true
+			} else if err != nil {
+				return "", dr.index + 1, err
+			}
+
+			if isMarker, rest := splitDocumentMarker(line); isMarker {
+				dr.pending = rest
+				break
+			}
+			doc.WriteString(line)
+			if dr.eof {
+				break
+			}
+		}
+
+		if !isEmptyDocument(doc.String()) {
+			dr.index++
+			return doc.String(), dr.index, nil
+		}
+	}
+
+	return "", dr.index, io.EOF
+}
+
+// applyBundle creates or updates all objects in the multi-document stream.
+// The documents are validated one by one while reading, it aborts at the
+// first invalid one, and none of the objects is applied in that case.
+func (s *Server) applyBundle(ctx iris.Context) {
+	dr := newYAMLDocumentReader(ctx.Request().Body)
+
+	specs := []*supervisor.Spec{}
+	indexes := map[string]int{}
+	for {
+		doc, index, err := dr.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			HandleAPIError(ctx, iris.StatusBadRequest,
+				fmt.Errorf("read document %d failed: %v", index, err))
+			return
+		}
+
+		spec, err := supervisor.NewSpec(doc)
+		if err != nil {
+			HandleAPIError(ctx, iris.StatusBadRequest,
+				fmt.Errorf("document %d: %v", index, err))
+			return
+		}
+
+		if prevIndex, exists := indexes[spec.Name()]; exists {
+			HandleAPIError(ctx, iris.StatusBadRequest,
+				fmt.Errorf("document %d: name %s duplicated with document %d",
+					index, spec.Name(), prevIndex))
+			return
+		}
+		indexes[spec.Name()] = index
+		specs = append(specs, spec)
+	}
+
+	if len(specs) == 0 {
+		HandleAPIError(ctx, iris.StatusBadRequest, fmt.Errorf("no document"))
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	results := make([]*BundleResult, 0, len(specs))
+	for _, spec := range specs {
+		result := &BundleResult{
+			Name:   spec.Name(),
+			Kind:   spec.Kind(),
+			Action: bundleActionCreated,
+		}
+
+		existedSpec := s._getObject(spec.Name())
+		if existedSpec != nil {
+			if existedSpec.Kind() != spec.Kind() {
+				HandleAPIError(ctx, iris.StatusBadRequest,
+					fmt.Errorf("document %d: different kinds: %s, %s",
+						indexes[spec.Name()], existedSpec.Kind(), spec.Kind()))
+				return
+			}
+			result.Action = bundleActionUpdated
+		}
+
+		results = append(results, result)
+	}
+
+	s._putObjects(specs, newAuditMeta(ctx))
+	s.upgradeConfigVersion(ctx)
+
+	buff, err := yaml.Marshal(results)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", results, err))
+	}
+
+	ctx.Header("Content-Type", "text/vnd.yaml")
+	ctx.Write(buff)
+}
+
+// applyBundleBestEffort applies every object in the multi-document stream
+// independently, the invalid ones are reported without affecting others.
+// It responds 207 with the result of each document like WebDAV Multi-Status,
+// and stops at the first document failed to read.
+func (s *Server) applyBundleBestEffort(ctx iris.Context) {
+	dr := newYAMLDocumentReader(ctx.Request().Body)
+
+	results := []*BundleResult{}
+	specs := map[int]*supervisor.Spec{}
+	indexes := map[string]int{}
+	fail := func(result *BundleResult, code int, err error) {
+		result.Action, result.Code, result.Error = bundleActionFailed, code, err.Error()
+	}
+
+	for {
+		doc, index, err := dr.next()
+		if err == io.EOF {
+			break
+		}
+		result := &BundleResult{Document: index}
+		results = append(results, result)
+		if err != nil {
+			fail(result, iris.StatusBadRequest, fmt.Errorf("read document failed: %v", err))
+			break
+		}
+
+		spec, err := supervisor.NewSpec(doc)
+		if err != nil {
+			fail(result, iris.StatusBadRequest, err)
+			continue
+		}
+		result.Name, result.Kind = spec.Name(), spec.Kind()
+
+		if prevIndex, exists := indexes[spec.Name()]; exists {
+			fail(result, iris.StatusConflict,
+				fmt.Errorf("name %s duplicated with document %d", spec.Name(), prevIndex))
+			continue
+		}
+		indexes[spec.Name()] = index
+		specs[index] = spec
+	}
+
+	if len(results) == 0 {
+		HandleAPIError(ctx, iris.StatusBadRequest, fmt.Errorf("no document"))
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	meta := newAuditMeta(ctx)
+	applied := false
+	for _, result := range results {
+		spec, exists := specs[result.Document]
+		if !exists {
+			continue
+		}
+
+		result.Action, result.Code = bundleActionCreated, iris.StatusCreated
+		existedSpec := s._getObject(spec.Name())
+		if existedSpec != nil {
+			if existedSpec.Kind() != spec.Kind() {
+				fail(result, iris.StatusBadRequest,
+					fmt.Errorf("different kinds: %s, %s", existedSpec.Kind(), spec.Kind()))
+				continue
+			}
+			result.Action, result.Code = bundleActionUpdated, iris.StatusOK
+		}
+
+		s._putObject(spec, meta)
+		applied = true
+	}
+	if applied {
+		s.upgradeConfigVersion(ctx)
+	}
+
+	buff, err := yaml.Marshal(results)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", results, err))
+	}
+
+	ctx.StatusCode(iris.StatusMultiStatus)
+	ctx.Header("Content-Type", "text/vnd.yaml")
+	ctx.Write(buff)
+}
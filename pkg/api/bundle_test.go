@@ -0,0 +1,196 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package api
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kataras/iris"
+	yaml "gopkg.in/yaml.v2"
+)
+
+type unreadableReader struct {
+	t *testing.T
+}
+
+func (r *unreadableReader) Read(p []byte) (int, error) {
+	r.t.Errorf("read beyond the invalid document")
+	return 0, io.EOF
+}
+
+func TestYAMLDocumentReader(t *testing.T) {
+	stream := `# leading comment
+---
+name: a
+text: |
+  --- indented, not a marker
+---
+# only comments
+--- name: b
+...
+---
+
+name: c`
+
+	dr := newYAMLDocumentReader(strings.NewReader(stream))
+	names := []string{}
+	for {
+		doc, index, err := dr.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read document %d failed: %v", index, err)
+		}
+		if index != len(names)+1 {
+			t.Errorf("want index %d, got %d", len(names)+1, index)
+		}
+		names = append(names, strings.SplitN(strings.TrimSpace(doc), "\n", 2)[0])
+	}
+
+	if got := strings.Join(names, ","); got != "name: a,name: b,name: c" {
+		t.Errorf("want documents a, b, c, got %s", got)
+	}
+}
+
+func TestApplyBundleAbortsAtInvalidDocument(t *testing.T) {
+	s := &Server{cluster: &fakeCluster{kvs: map[string]string{}}}
+	app := newTestApp(t, func(app *iris.Application) {
+		app.Post("/bundles", s.applyBundle)
+	})
+
+	docs := []string{}
+	for i := 1; i <= 2; i++ {
+		docs = append(docs, fmt.Sprintf("name: demo-%d\nkind: DiffTestObject\nport: %d\n", i, 10080+i))
+	}
+	// NOTE: Port is required.
+	docs = append(docs, "name: demo-3\nkind: DiffTestObject\n")
+
+	body := io.MultiReader(
+		strings.NewReader(strings.Join(docs, "---\n")+"---\n"),
+		&unreadableReader{t: t},
+	)
+	r := httptest.NewRequest(http.MethodPost, "/bundles", ioutil.NopCloser(body))
+	w := serveTestRequest(app, r)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("want %d, got %d: %s", http.StatusBadRequest, w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "document 3:") {
+		t.Errorf("want error naming document 3, got %s", w.Body.String())
+	}
+}
+
+func TestApplyBundleInOneTransaction(t *testing.T) {
+	fc := &fakeCluster{kvs: map[string]string{}}
+	s := &Server{cluster: fc}
+	app := newTestApp(t, func(app *iris.Application) {
+		app.Use(newRecoverer())
+		app.Post("/bundles", s.applyBundle)
+	})
+
+	post := func(names ...string) *httptest.ResponseRecorder {
+		docs := []string{}
+		for i, name := range names {
+			docs = append(docs, fmt.Sprintf("name: %s\nkind: DiffTestObject\nport: %d\n", name, 10080+i))
+		}
+		r := httptest.NewRequest(http.MethodPost, "/bundles", strings.NewReader(strings.Join(docs, "---\n")))
+		return serveTestRequest(app, r)
+	}
+
+	w := post("demo-1", "demo-2", "demo-3")
+	if w.Code != http.StatusOK {
+		t.Fatalf("want %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if fc.transactions != 1 {
+		t.Errorf("want 1 transaction, got %d", fc.transactions)
+	}
+	for _, name := range []string{"demo-1", "demo-2", "demo-3"} {
+		if s._getObject(name) == nil {
+			t.Errorf("want %s applied", name)
+		}
+	}
+
+	fc.transactionErr = fmt.Errorf("cluster unavailable")
+	w = post("demo-4", "demo-5")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("want %d, got %d: %s", http.StatusServiceUnavailable, w.Code, w.Body.String())
+	}
+	if s._getObject("demo-4") != nil || s._getObject("demo-5") != nil {
+		t.Errorf("want none of the objects applied")
+	}
+}
+
+func TestApplyBundleBestEffort(t *testing.T) {
+	s := &Server{cluster: &fakeCluster{kvs: map[string]string{}}}
+	app := newTestApp(t, func(app *iris.Application) {
+		app.Post("/bundles/best-effort", s.applyBundleBestEffort)
+	})
+
+	docs := []string{
+		"name: demo-1\nkind: DiffTestObject\nport: 10081\n",
+		// NOTE: Port is required.
+		"name: demo-2\nkind: DiffTestObject\n",
+		"name: demo-3\nkind: DiffTestObject\nport: 10083\n",
+	}
+	r := httptest.NewRequest(http.MethodPost, "/bundles/best-effort",
+		strings.NewReader(strings.Join(docs, "---\n")))
+	w := serveTestRequest(app, r)
+
+	if w.Code != http.StatusMultiStatus {
+		t.Fatalf("want %d, got %d: %s", http.StatusMultiStatus, w.Code, w.Body.String())
+	}
+
+	results := []*BundleResult{}
+	err := yaml.Unmarshal(w.Body.Bytes(), &results)
+	if err != nil {
+		t.Fatalf("unmarshal %s failed: %v", w.Body.String(), err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("want 3 results, got %s", w.Body.String())
+	}
+
+	for i, want := range []struct {
+		action string
+		code   int
+	}{
+		{bundleActionCreated, http.StatusCreated},
+		{bundleActionFailed, http.StatusBadRequest},
+		{bundleActionCreated, http.StatusCreated},
+	} {
+		result := results[i]
+		if result.Document != i+1 || result.Action != want.action || result.Code != want.code {
+			t.Errorf("document %d: want %s %d, got %+v", i+1, want.action, want.code, result)
+		}
+	}
+	if results[1].Error == "" {
+		t.Errorf("want error of the invalid document")
+	}
+
+	if s._getObject("demo-1") == nil || s._getObject("demo-3") == nil {
+		t.Errorf("want valid objects applied")
+	}
+	if s._getObject("demo-2") != nil {
+		t.Errorf("want invalid object not applied")
+	}
+}
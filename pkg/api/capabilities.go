@@ -0,0 +1,94 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+
+	"github.com/kataras/iris"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// CapabilitiesPath is the path of capabilities API.
+	CapabilitiesPath = "/capabilities"
+)
+
+type (
+	// Capabilities is the response of capabilities API, it's the
+	// optional features enabled by the options of the server,
+	// so clients could adapt to them before using.
+	Capabilities struct {
+		// TLS and CORS are always false because the admin API
+		// serves neither of them for now, they are reported so
+		// clients don't have to probe them.
+		TLS  bool `yaml:"tls"`
+		CORS bool `yaml:"cors"`
+
+		// DebugAPIs is true if api-debug-token is set.
+		DebugAPIs bool `yaml:"debugAPIs"`
+		// SignedAPIs is true if api-signing-secret is set,
+		// the signed APIs reject the unsigned requests then.
+		SignedAPIs bool `yaml:"signedAPIs"`
+
+		Streaming Streaming `yaml:"streaming"`
+	}
+
+	// Streaming is the capability of streaming APIs such as log tails.
+	Streaming struct {
+		Enabled bool `yaml:"enabled"`
+		// MaxStreams is the max number of concurrent streams,
+		// 0 means unlimited.
+		MaxStreams int `yaml:"maxStreams"`
+	}
+)
+
+func (s *Server) setupCapabilityAPIs() {
+	capabilityAPIs := []*APIEntry{
+		{
+			Path:    CapabilitiesPath,
+			Method:  "GET",
+			Handler: s.getCapabilities,
+		},
+	}
+
+	s.RegisterAPIs(capabilityAPIs)
+}
+
+// Capabilities returns the enabled optional features of the server.
+func (s *Server) Capabilities() *Capabilities {
+	return &Capabilities{
+		DebugAPIs:  s.debugToken != "",
+		SignedAPIs: len(s.signingSecret) != 0,
+		Streaming: Streaming{
+			Enabled:    true,
+			MaxStreams: cap(s.streams),
+		},
+	}
+}
+
+func (s *Server) getCapabilities(ctx iris.Context) {
+	capabilities := s.Capabilities()
+	buff, err := yaml.Marshal(capabilities)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", capabilities, err))
+	}
+
+	ctx.Header("Content-Type", "text/vnd.yaml")
+	ctx.Write(buff)
+}
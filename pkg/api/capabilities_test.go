@@ -0,0 +1,67 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kataras/iris"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestGetCapabilities(t *testing.T) {
+	getCapabilities := func(s *Server) *Capabilities {
+		app := newTestApp(t, func(app *iris.Application) {
+			app.Get(CapabilitiesPath, s.getCapabilities)
+		})
+
+		w := serveTestRequest(app, httptest.NewRequest(http.MethodGet, CapabilitiesPath, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("want %d, got %d", http.StatusOK, w.Code)
+		}
+
+		capabilities := &Capabilities{}
+		err := yaml.Unmarshal(w.Body.Bytes(), capabilities)
+		if err != nil {
+			t.Fatalf("unmarshal %s failed: %v", w.Body.String(), err)
+		}
+		return capabilities
+	}
+
+	got := getCapabilities(&Server{})
+	want := Capabilities{Streaming: Streaming{Enabled: true}}
+	if *got != want {
+		t.Errorf("want %+v, got %+v", want, *got)
+	}
+
+	got = getCapabilities(&Server{
+		debugToken:    "secret",
+		signingSecret: []byte("secret"),
+		streams:       newStreamSlots(8),
+	})
+	want = Capabilities{
+		DebugAPIs:  true,
+		SignedAPIs: true,
+		Streaming:  Streaming{Enabled: true, MaxStreams: 8},
+	}
+	if *got != want {
+		t.Errorf("want %+v, got %+v", want, *got)
+	}
+}
@@ -21,7 +21,9 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/supervisor"
 
 	yaml "gopkg.in/yaml.v2"
@@ -101,19 +103,73 @@ func (s *Server) _listObjects() []*supervisor.Spec {
 	return specs
 }
 
-func (s *Server) _putObject(spec *supervisor.Spec) {
-	err := s.cluster.Put(s.cluster.Layout().ConfigObjectKey(spec.Name()),
-		spec.YAMLConfig())
+func (s *Server) _putObject(spec *supervisor.Spec, meta *AuditMeta) {
+	value, metaValue := spec.YAMLConfig(), meta.YAML()
+	err := s.cluster.PutAndDelete(map[string]*string{
+		s.cluster.Layout().ConfigObjectKey(spec.Name()): &value,
+		s.cluster.Layout().AuditObjectKey(spec.Name()):  &metaValue,
+	})
 	if err != nil {
 		ClusterPanic(err)
 	}
 }
 
-func (s *Server) _deleteObject(name string) {
-	err := s.cluster.Delete(s.cluster.Layout().ConfigObjectKey(name))
+// _putObjects puts all objects with their audit metadata in one
+// transaction, so either all or none of them is applied.
+func (s *Server) _putObjects(specs []*supervisor.Spec, meta *AuditMeta) {
+	metaValue := meta.YAML()
+	kvs := make(map[string]*string, 2*len(specs))
+	for _, spec := range specs {
+		value := spec.YAMLConfig()
+		kvs[s.cluster.Layout().ConfigObjectKey(spec.Name())] = &value
+		kvs[s.cluster.Layout().AuditObjectKey(spec.Name())] = &metaValue
+	}
+
+	err := s.cluster.PutAndDelete(kvs)
+	if err != nil {
+		ClusterPanic(err)
+	}
+}
+
+func (s *Server) _deleteObject(name string, meta *AuditMeta) {
+	// NOTE: Put the audit metadata in the same transaction to tell
+	// watchers who deleted the object, then remove it since nothing
+	// reads it afterwards. The caller holds the lock, so it can't
+	// remove the metadata of a recreated object.
+	metaValue := meta.YAML()
+	auditKey := s.cluster.Layout().AuditObjectKey(name)
+	err := s.cluster.PutAndDelete(map[string]*string{
+		s.cluster.Layout().ConfigObjectKey(name): nil,
+		auditKey:                                 &metaValue,
+	})
 	if err != nil {
 		ClusterPanic(err)
 	}
+
+	err = s.cluster.Delete(auditKey)
+	if err != nil {
+		logger.Warnf("delete audit metadata %s failed: %v", auditKey, err)
+	}
+}
+
+// _getObjectTime returns the time in the audit metadata of the object,
+// which is the time it was last written, as no creation time is kept.
+// It returns the zero time if the metadata is absent or invalid.
+func (s *Server) _getObjectTime(name string) time.Time {
+	value, err := s.cluster.Get(s.cluster.Layout().AuditObjectKey(name))
+	if err != nil {
+		ClusterPanic(err)
+	}
+	if value == nil {
+		return time.Time{}
+	}
+
+	meta := &AuditMeta{}
+	if err := yaml.Unmarshal([]byte(*value), meta); err != nil {
+		return time.Time{}
+	}
+	t, _ := time.Parse(time.RFC3339, meta.Time)
+	return t
 }
 
 func (s *Server) _getStatusObject(name string) map[string]string {
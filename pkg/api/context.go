@@ -0,0 +1,54 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	stdcontext "context"
+	"net"
+
+	"github.com/kataras/iris"
+	"github.com/kataras/iris/core/host"
+)
+
+// RequestContext returns the context of the request, it's cancelled once
+// the client disconnects or the server closes. Handlers blocking on
+// anything should watch it instead of creating a new context.
+// NOTE: Middlewares must keep the request context when replacing the
+// request, so that the cancellation propagates to the handlers.
+func RequestContext(ctx iris.Context) stdcontext.Context {
+	return ctx.Request().Context()
+}
+
+// withBaseContext derives contexts of all requests from the server's,
+// since http.Server.Shutdown doesn't cancel the in-flight requests.
+func (s *Server) withBaseContext() host.Configurator {
+	return func(su *host.Supervisor) {
+		su.Server.BaseContext = func(net.Listener) stdcontext.Context {
+			return s.baseCtx
+		}
+	}
+}
+
+// done returns the channel closed on closing the server,
+// the background goroutines should exit on it.
+func (s *Server) done() <-chan struct{} {
+	if s.baseCtx == nil {
+		return nil
+	}
+	return s.baseCtx.Done()
+}
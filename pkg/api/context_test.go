@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	stdcontext "context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kataras/iris"
+)
+
+// newDisconnectableRequest returns a request whose context is cancelled
+// by calling disconnect, just like net/http does for the client disconnect.
+func newDisconnectableRequest(method, target string, body io.Reader) (r *http.Request, disconnect func()) {
+	r = httptest.NewRequest(method, target, body)
+	ctx, cancel := stdcontext.WithCancel(r.Context())
+	return r.WithContext(ctx), cancel
+}
+
+// newBlockingApp returns the app with all middlewares, whose handler
+// blocks until the request context is done, then closes unblocked.
+func newBlockingApp(t *testing.T, s *Server, unblocked chan struct{}) *iris.Application {
+	return newTestApp(t, func(app *iris.Application) {
+		s.app = app
+		s.setupMiddlewares()
+		app.Get("/objects", s.degradable(func(ctx iris.Context) {
+			<-RequestContext(ctx).Done()
+			close(unblocked)
+		}))
+	})
+}
+
+func waitUnblocked(t *testing.T, unblocked chan struct{}) {
+	select {
+	case <-unblocked:
+	case <-time.After(3 * time.Second):
+		t.Fatalf("handler not unblocked after client disconnected")
+	}
+}
+
+func TestRequestContextCancelled(t *testing.T) {
+	unblocked := make(chan struct{})
+	s := &Server{cluster: &fakeCluster{kvs: map[string]string{}}}
+	app := newBlockingApp(t, s, unblocked)
+
+	r, disconnect := newDisconnectableRequest(http.MethodGet, "/objects", nil)
+	go serveTestRequest(app, r)
+
+	disconnect()
+	waitUnblocked(t, unblocked)
+}
+
+func TestRequestContextCancelledByRealDisconnect(t *testing.T) {
+	unblocked := make(chan struct{})
+	s := &Server{cluster: &fakeCluster{kvs: map[string]string{}}}
+	app := newBlockingApp(t, s, unblocked)
+
+	server := httptest.NewServer(app)
+	defer server.Close()
+
+	ctx, disconnect := stdcontext.WithCancel(stdcontext.Background())
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/objects", nil)
+	if err != nil {
+		t.Fatalf("new request failed: %v", err)
+	}
+	go func() {
+		resp, err := http.DefaultClient.Do(r)
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	// NOTE: Wait for the request arriving at the handler.
+	time.Sleep(100 * time.Millisecond)
+	disconnect()
+	waitUnblocked(t, unblocked)
+}
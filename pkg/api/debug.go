@@ -0,0 +1,137 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/logger"
+
+	"github.com/kataras/iris"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// DebugPrefix is the prefix of debug APIs.
+	DebugPrefix = "/debug"
+)
+
+type (
+	// LogLevel is the request and response of log level API.
+	LogLevel struct {
+		Level string `yaml:"level"`
+	}
+)
+
+func (s *Server) setupDebugAPIs() {
+	debugAPIs := []*APIEntry{
+		{
+			Path:    DebugPrefix + "/loglevel",
+			Method:  "PUT",
+			Signed:  true,
+			Handler: s.debugAuth(s.setLogLevel),
+		},
+		{
+			Path:    DebugPrefix + "/latency",
+			Method:  "GET",
+			Handler: s.debugAuth(s.getLatency),
+		},
+		{
+			Path:    DebugPrefix + "/middleware",
+			Method:  "GET",
+			Handler: s.debugAuth(s.getMiddlewareChain),
+		},
+		{
+			Path:    DebugPrefix + "/uptime",
+			Method:  "GET",
+			Handler: s.debugAuth(s.getUptime),
+		},
+		{
+			Path:    DebugPrefix + "/gc",
+			Method:  "POST",
+			Signed:  true,
+			Handler: s.debugAuth(s.runGC),
+		},
+		{
+			Path:    DebugPrefix + "/freeos",
+			Method:  "POST",
+			Signed:  true,
+			Handler: s.debugAuth(s.freeOSMemory),
+		},
+		{
+			Path:    DebugPrefix + "/memstats",
+			Method:  "GET",
+			Handler: s.debugAuth(s.getMemStats),
+		},
+	}
+
+	s.RegisterAPIs(debugAPIs)
+}
+
+// debugAuth wraps the handler of debug APIs to check the bearer token,
+// all debug APIs are disabled if there is no token configured.
+func (s *Server) debugAuth(handler iris.Handler) iris.Handler {
+	return func(ctx iris.Context) {
+		if s.debugToken == "" {
+			HandleAPIError(ctx, http.StatusForbidden, fmt.Errorf("debug apis are disabled"))
+			return
+		}
+
+		token := strings.TrimPrefix(ctx.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.debugToken)) != 1 {
+			HandleAPIError(ctx, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+			return
+		}
+
+		handler(ctx)
+	}
+}
+
+func (s *Server) setLogLevel(ctx iris.Context) {
+	body, err := DecodeBody(ctx)
+	if err != nil {
+		HandleAPIError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	logLevel := &LogLevel{}
+	err = yaml.Unmarshal(body, logLevel)
+	if err != nil {
+		HandleAPIError(ctx, http.StatusBadRequest, fmt.Errorf("unmarshal %s to yaml failed: %v", body, err))
+		return
+	}
+
+	err = logger.SetLevel(logLevel.Level)
+	if err != nil {
+		HandleAPIError(ctx, http.StatusBadRequest, err)
+		return
+	}
+	logger.Warnf("log level changed to %s", logger.Level())
+
+	logLevel.Level = logger.Level()
+	buff, err := yaml.Marshal(logLevel)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", logLevel, err))
+	}
+
+	ctx.Header("Content-Type", "text/vnd.yaml")
+	ctx.Write(buff)
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/logger"
+
+	"github.com/kataras/iris"
+)
+
+func TestSetLogLevel(t *testing.T) {
+	oldLevel := logger.Level()
+	defer logger.SetLevel(oldLevel)
+
+	s := &Server{debugToken: "secret"}
+	app := newTestApp(t, func(app *iris.Application) {
+		app.Put("/debug/loglevel", s.debugAuth(s.setLogLevel))
+	})
+
+	putLevel := func(token, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPut, "/debug/loglevel", strings.NewReader(body))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		return serveTestRequest(app, r)
+	}
+
+	if w := putLevel("", "level: debug"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("no token: want %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if w := putLevel("secret", "level: verbose"); w.Code != http.StatusBadRequest {
+		t.Fatalf("bad level: want %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	if w := putLevel("secret", "level: info"); w.Code != http.StatusOK {
+		t.Fatalf("want %d, got %d", http.StatusOK, w.Code)
+	}
+	logger.Debugf("debug log before changing level")
+
+	w := putLevel("secret", "level: debug")
+	if w.Code != http.StatusOK {
+		t.Fatalf("want %d, got %d", http.StatusOK, w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "level: debug") {
+		t.Errorf("want new level debug, got %s", w.Body.String())
+	}
+	logger.Debugf("debug log after changing level")
+	logger.Sync()
+
+	buff, err := ioutil.ReadFile(filepath.Join(testLogDir, "stdout.log"))
+	if err != nil {
+		t.Fatalf("read log failed: %v", err)
+	}
+	if strings.Contains(string(buff), "debug log before changing level") {
+		t.Errorf("debug log emitted in info level")
+	}
+	if !strings.Contains(string(buff), "debug log after changing level") {
+		t.Errorf("debug log not emitted in debug level")
+	}
+}
+
+func TestDebugAPIsDisabled(t *testing.T) {
+	s := &Server{}
+	app := newTestApp(t, func(app *iris.Application) {
+		app.Put("/debug/loglevel", s.debugAuth(s.setLogLevel))
+	})
+
+	r := httptest.NewRequest(http.MethodPut, "/debug/loglevel", strings.NewReader("level: debug"))
+	r.Header.Set("Authorization", "Bearer ")
+	w := serveTestRequest(app, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("want %d, got %d", http.StatusForbidden, w.Code)
+	}
+}
@@ -0,0 +1,149 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+
+	"github.com/kataras/iris"
+)
+
+const (
+	// DegradedHeader is the key of header for responses served in degraded mode.
+	DegradedHeader = "X-Easegress-Degraded"
+
+	degradedProbeInterval = 5 * time.Second
+)
+
+type degradedResponse struct {
+	contentType string
+	body        []byte
+}
+
+// SetDegraded sets degraded mode of the api server. In degraded mode,
+// the designated read APIs serve the latest cached responses with
+// the degraded header, instead of reading from the cluster.
+func (s *Server) SetDegraded(degraded bool) {
+	if degraded {
+		atomic.StoreInt32(&s.degraded, 1)
+	} else {
+		atomic.StoreInt32(&s.degraded, 0)
+	}
+}
+
+// Degraded returns whether the api server is in degraded mode.
+func (s *Server) Degraded() bool {
+	return atomic.LoadInt32(&s.degraded) == 1
+}
+
+// enterDegraded enters degraded mode because of the cluster fault,
+// and leaves it once the cluster is reachable again.
+func (s *Server) enterDegraded(err error) {
+	if !atomic.CompareAndSwapInt32(&s.degraded, 0, 1) {
+		return
+	}
+
+	logger.Warnf("api server enters degraded mode: %v", err)
+
+	go func() {
+		for {
+			select {
+			case <-s.done():
+				return
+			case <-time.After(degradedProbeInterval):
+			}
+			if !s.Degraded() {
+				return
+			}
+
+			_, err := s.cluster.Get(s.cluster.Layout().ConfigVersion())
+			if err == nil {
+				s.SetDegraded(false)
+				logger.Infof("api server leaves degraded mode")
+				return
+			}
+		}
+	}()
+}
+
+// degradable wraps a read handler to cache its latest successful response,
+// which is served in degraded mode.
+func (s *Server) degradable(handler iris.Handler) iris.Handler {
+	return func(ctx iris.Context) {
+		key := ctx.Path()
+
+		if !s.Degraded() && s.handleAndCache(ctx, key, handler) {
+			return
+		}
+
+		s.serveDegraded(ctx, key)
+	}
+}
+
+func (s *Server) handleAndCache(ctx iris.Context, key string, handler iris.Handler) (handled bool) {
+	defer func() {
+		if err := recover(); err != nil {
+			ce, ok := err.(clusterErr)
+			if !ok {
+				panic(err)
+			}
+			s.enterDegraded(ce)
+			// NOTE: Drop what the handler has partly written,
+			// the degraded response replaces it as a whole.
+			if recorder, ok := ctx.IsRecording(); ok {
+				recorder.Reset()
+			}
+			handled = false
+		}
+	}()
+
+	ctx.Record()
+	handler(ctx)
+
+	recorder, ok := ctx.IsRecording()
+	if ok && ctx.GetStatusCode() == http.StatusOK {
+		s.degradedCache.Store(key, &degradedResponse{
+			contentType: recorder.Header().Get("Content-Type"),
+			body:        append([]byte(nil), recorder.Body()...),
+		})
+	}
+
+	return true
+}
+
+func (s *Server) serveDegraded(ctx iris.Context, key string) {
+	ctx.Header(DegradedHeader, "true")
+
+	value, ok := s.degradedCache.Load(key)
+	if !ok {
+		HandleAPIError(ctx, http.StatusServiceUnavailable,
+			fmt.Errorf("degraded mode: no cached data for %s", key))
+		return
+	}
+
+	resp := value.(*degradedResponse)
+	if resp.contentType != "" {
+		ctx.Header("Content-Type", resp.contentType)
+	}
+	ctx.Write(resp.body)
+}
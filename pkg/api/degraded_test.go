@@ -0,0 +1,122 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kataras/iris"
+)
+
+func TestDegradedMode(t *testing.T) {
+	s := &Server{}
+	version := "v1"
+	app := newTestApp(t, func(app *iris.Application) {
+		app.Get("/objects", s.degradable(func(ctx iris.Context) {
+			ctx.Header("Content-Type", "text/vnd.yaml")
+			ctx.WriteString(version)
+		}))
+	})
+
+	get := func() *httptest.ResponseRecorder {
+		return serveTestRequest(app, httptest.NewRequest(http.MethodGet, "/objects", nil))
+	}
+
+	w := get()
+	if w.Code != http.StatusOK || w.Body.String() != "v1" {
+		t.Fatalf("normal mode: want 200 v1, got %d %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get(DegradedHeader) != "" {
+		t.Errorf("normal mode: unexpected header %s", DegradedHeader)
+	}
+
+	version = "v2"
+	s.SetDegraded(true)
+	w = get()
+	if w.Code != http.StatusOK || w.Body.String() != "v1" {
+		t.Errorf("degraded mode: want cached 200 v1, got %d %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get(DegradedHeader) != "true" {
+		t.Errorf("degraded mode: want header %s: true", DegradedHeader)
+	}
+	if w.Header().Get("Content-Type") != "text/vnd.yaml" {
+		t.Errorf("degraded mode: want cached content type, got %s", w.Header().Get("Content-Type"))
+	}
+
+	s.SetDegraded(false)
+	w = get()
+	if w.Code != http.StatusOK || w.Body.String() != "v2" {
+		t.Errorf("normal mode: want 200 v2, got %d %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get(DegradedHeader) != "" {
+		t.Errorf("normal mode: unexpected header %s", DegradedHeader)
+	}
+}
+
+func TestDegradedModeWithoutCache(t *testing.T) {
+	s := &Server{}
+	s.SetDegraded(true)
+	app := newTestApp(t, func(app *iris.Application) {
+		app.Get("/objects", s.degradable(func(ctx iris.Context) {
+			t.Errorf("handler called in degraded mode")
+		}))
+	})
+
+	w := serveTestRequest(app, httptest.NewRequest(http.MethodGet, "/objects", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("want %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+	if w.Header().Get(DegradedHeader) != "true" {
+		t.Errorf("want header %s: true", DegradedHeader)
+	}
+}
+
+func TestDegradedModeDropsPartialResponse(t *testing.T) {
+	baseCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s := &Server{baseCtx: baseCtx}
+	fail := false
+	app := newTestApp(t, func(app *iris.Application) {
+		app.Get("/objects", s.degradable(func(ctx iris.Context) {
+			ctx.Header("Content-Type", "text/vnd.yaml")
+			ctx.WriteString("partial")
+			if fail {
+				ClusterPanic(fmt.Errorf("cluster unavailable"))
+			}
+			ctx.WriteString(" done")
+		}))
+	})
+
+	w := serveTestRequest(app, httptest.NewRequest(http.MethodGet, "/objects", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "partial done" {
+		t.Fatalf("normal mode: want 200 partial done, got %d %s", w.Code, w.Body.String())
+	}
+
+	fail = true
+	w = serveTestRequest(app, httptest.NewRequest(http.MethodGet, "/objects", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "partial done" {
+		t.Errorf("degraded mode: want cached 200 partial done, got %d %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get(DegradedHeader) != "true" {
+		t.Errorf("degraded mode: want header %s: true", DegradedHeader)
+	}
+}
@@ -0,0 +1,173 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/megaease/easegress/pkg/supervisor"
+
+	"github.com/kataras/iris"
+	yaml "gopkg.in/yaml.v2"
+)
+
+type (
+	// SpecDiff is the diff between the current spec and the proposed one.
+	SpecDiff struct {
+		Name string `yaml:"name"`
+		// Exists is false if there is no current spec,
+		// then all fields of the proposed one are added.
+		Exists  bool         `yaml:"exists"`
+		Added   []*FieldDiff `yaml:"added"`
+		Removed []*FieldDiff `yaml:"removed"`
+		Changed []*FieldDiff `yaml:"changed"`
+	}
+
+	// FieldDiff is the diff of one field, the path is like `filters[0].name`.
+	// NOTE: Old and New are never omitted, since a change to or from
+	// a zero value such as false is still a change.
+	FieldDiff struct {
+		Path string      `yaml:"path"`
+		Old  interface{} `yaml:"old"`
+		New  interface{} `yaml:"new"`
+	}
+)
+
+// diffObject returns the diff between the current spec and the
+// proposed one in the body, without applying it.
+func (s *Server) diffObject(ctx iris.Context) {
+	spec, err := s.readObjectSpec(ctx)
+	if err != nil {
+		HandleAPIError(ctx, iris.StatusBadRequest, err)
+		return
+	}
+
+	// No need to lock.
+
+	diff := newSpecDiff(s._getObject(spec.Name()), spec)
+
+	buff, err := yaml.Marshal(diff)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", diff, err))
+	}
+
+	ctx.Header("Content-Type", "text/vnd.yaml")
+	ctx.Write(buff)
+}
+
+func newSpecDiff(current, proposed *supervisor.Spec) *SpecDiff {
+	diff := &SpecDiff{
+		Name:    proposed.Name(),
+		Exists:  current != nil,
+		Added:   []*FieldDiff{},
+		Removed: []*FieldDiff{},
+		Changed: []*FieldDiff{},
+	}
+
+	// NOTE: Diff against the empty map to list fields one by one.
+	old := map[interface{}]interface{}{}
+	if current != nil {
+		old = effectiveSpec(current)
+	}
+	diff.walk("", old, effectiveSpec(proposed))
+
+	return diff
+}
+
+// effectiveSpec returns the spec with the default values filled.
+func effectiveSpec(spec *supervisor.Spec) map[interface{}]interface{} {
+	buff, err := yaml.Marshal(spec.ObjectSpec())
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", spec.ObjectSpec(), err))
+	}
+
+	m := map[interface{}]interface{}{}
+	err = yaml.Unmarshal(buff, &m)
+	if err != nil {
+		panic(fmt.Errorf("unmarshal %s to yaml failed: %v", buff, err))
+	}
+
+	m["name"], m["kind"] = spec.Name(), spec.Kind()
+
+	return m
+}
+
+func (d *SpecDiff) walk(path string, old, new interface{}) {
+	switch {
+	case old == nil && new == nil:
+		return
+	case old == nil:
+		d.Added = append(d.Added, &FieldDiff{Path: path, New: new})
+		return
+	case new == nil:
+		d.Removed = append(d.Removed, &FieldDiff{Path: path, Old: old})
+		return
+	}
+
+	oldMap, oldIsMap := old.(map[interface{}]interface{})
+	newMap, newIsMap := new.(map[interface{}]interface{})
+	if oldIsMap && newIsMap {
+		keys := []string{}
+		values := map[string][2]interface{}{}
+		for k, v := range oldMap {
+			key := fmt.Sprintf("%v", k)
+			keys = append(keys, key)
+			values[key] = [2]interface{}{v, nil}
+		}
+		for k, v := range newMap {
+			key := fmt.Sprintf("%v", k)
+			pair, exists := values[key]
+			if !exists {
+				keys = append(keys, key)
+			}
+			values[key] = [2]interface{}{pair[0], v}
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			subPath := key
+			if path != "" {
+				subPath = path + "." + key
+			}
+			d.walk(subPath, values[key][0], values[key][1])
+		}
+		return
+	}
+
+	oldSlice, oldIsSlice := old.([]interface{})
+	newSlice, newIsSlice := new.([]interface{})
+	if oldIsSlice && newIsSlice {
+		for i := 0; i < len(oldSlice) || i < len(newSlice); i++ {
+			var o, n interface{}
+			if i < len(oldSlice) {
+				o = oldSlice[i]
+			}
+			if i < len(newSlice) {
+				n = newSlice[i]
+			}
+			d.walk(fmt.Sprintf("%s[%d]", path, i), o, n)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(old, new) {
+		d.Changed = append(d.Changed, &FieldDiff{Path: path, Old: old, New: new})
+	}
+}
@@ -0,0 +1,233 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/supervisor"
+
+	"github.com/kataras/iris"
+	yaml "gopkg.in/yaml.v2"
+)
+
+type (
+	diffTestObject struct{}
+
+	diffTestSpec struct {
+		Port    int      `yaml:"port" jsonschema:"required"`
+		Hosts   []string `yaml:"hosts" jsonschema:"omitempty"`
+		Timeout string   `yaml:"timeout" jsonschema:"omitempty"`
+		Cert    string   `yaml:"cert,omitempty" jsonschema:"omitempty"`
+	}
+
+	// fakeCluster only supports Layout, Get, GetPrefix, Put, PutAndDelete,
+	// Delete and Mutex.
+	fakeCluster struct {
+		cluster.Cluster
+		kvs   map[string]string
+		mutex fakeMutex
+		// transactions is the count of PutAndDelete,
+		// which fails with transactionErr if it's not nil.
+		transactions   int
+		transactionErr error
+	}
+
+	fakeMutex struct {
+		m sync.Mutex
+	}
+)
+
+func init() {
+	supervisor.Register(&diffTestObject{})
+}
+
+func (o *diffTestObject) Category() supervisor.ObjectCategory {
+	return supervisor.CategoryBusinessController
+}
+func (o *diffTestObject) Kind() string { return "DiffTestObject" }
+func (o *diffTestObject) DefaultSpec() interface{} {
+	return &diffTestSpec{Timeout: "30s"}
+}
+func (o *diffTestObject) Init(superSpec *supervisor.Spec, super *supervisor.Supervisor) {}
+func (o *diffTestObject) Inherit(superSpec *supervisor.Spec,
+	previousGeneration supervisor.Object, super *supervisor.Supervisor) {
+}
+func (o *diffTestObject) Status() *supervisor.Status { return &supervisor.Status{} }
+func (o *diffTestObject) Close()                     {}
+
+func (c *fakeCluster) Layout() *cluster.Layout {
+	return &cluster.Layout{}
+}
+
+func (c *fakeCluster) Get(key string) (*string, error) {
+	value, exists := c.kvs[key]
+	if !exists {
+		return nil, nil
+	}
+	return &value, nil
+}
+
+func (c *fakeCluster) GetPrefix(prefix string) (map[string]string, error) {
+	kvs := map[string]string{}
+	for key, value := range c.kvs {
+		if strings.HasPrefix(key, prefix) {
+			kvs[key] = value
+		}
+	}
+	return kvs, nil
+}
+
+func (c *fakeCluster) Put(key, value string) error {
+	c.kvs[key] = value
+	return nil
+}
+
+func (c *fakeCluster) PutAndDelete(kvs map[string]*string) error {
+	c.transactions++
+	if c.transactionErr != nil {
+		return c.transactionErr
+	}
+	for key, value := range kvs {
+		if value == nil {
+			delete(c.kvs, key)
+			continue
+		}
+		c.kvs[key] = *value
+	}
+	return nil
+}
+
+func (c *fakeCluster) Delete(key string) error {
+	delete(c.kvs, key)
+	return nil
+}
+
+func (c *fakeCluster) Mutex(name string) (cluster.Mutex, error) {
+	return &c.mutex, nil
+}
+
+func (m *fakeMutex) Lock() error {
+	m.m.Lock()
+	return nil
+}
+
+func (m *fakeMutex) Unlock() error {
+	m.m.Unlock()
+	return nil
+}
+
+func TestDiffObject(t *testing.T) {
+	fc := &fakeCluster{kvs: map[string]string{}}
+	fc.kvs[fc.Layout().ConfigObjectKey("demo")] = `
+name: demo
+kind: DiffTestObject
+port: 10080
+hosts: [a.com, b.com]
+cert: secret
+`
+	s := &Server{cluster: fc}
+	app := newTestApp(t, func(app *iris.Application) {
+		app.Post("/admin/diff", s.diffObject)
+	})
+
+	diff := func(body string) *SpecDiff {
+		r := httptest.NewRequest(http.MethodPost, "/admin/diff", strings.NewReader(body))
+		w := serveTestRequest(app, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("want %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		d := &SpecDiff{}
+		err := yaml.Unmarshal(w.Body.Bytes(), d)
+		if err != nil {
+			t.Fatalf("unmarshal %s failed: %v", w.Body.String(), err)
+		}
+		return d
+	}
+
+	paths := func(fields []*FieldDiff) string {
+		ps := []string{}
+		for _, f := range fields {
+			ps = append(ps, f.Path)
+		}
+		return strings.Join(ps, ",")
+	}
+
+	d := diff(`
+name: demo
+kind: DiffTestObject
+port: 10081
+hosts: [a.com, c.com, d.com]
+timeout: 30s
+`)
+	if !d.Exists {
+		t.Errorf("want existing spec")
+	}
+	if got := paths(d.Changed); got != "hosts[1],port" {
+		t.Errorf("changed: want hosts[1],port, got %s", got)
+	}
+	if got := paths(d.Added); got != "hosts[2]" {
+		t.Errorf("added: want hosts[2], got %s", got)
+	}
+	if got := paths(d.Removed); got != "cert" {
+		t.Errorf("removed: want cert, got %s", got)
+	}
+	if d.Changed[1].Old != 10080 || d.Changed[1].New != 10081 {
+		t.Errorf("port: want 10080 -> 10081, got %v -> %v", d.Changed[1].Old, d.Changed[1].New)
+	}
+
+	d = diff(`
+name: new-demo
+kind: DiffTestObject
+port: 10080
+`)
+	if d.Exists {
+		t.Errorf("want non-existing spec")
+	}
+	if got := paths(d.Added); got != "hosts,kind,name,port,timeout" {
+		t.Errorf("added: want hosts,kind,name,port,timeout, got %s", got)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/admin/diff", strings.NewReader("kind: Unknown"))
+	if w := serveTestRequest(app, r); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid spec: want %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestFieldDiffZeroValue(t *testing.T) {
+	buff, err := yaml.Marshal(&FieldDiff{Path: "enabled", Old: true, New: false})
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	if !strings.Contains(string(buff), "new: false") {
+		t.Errorf("want new: false, got %s", buff)
+	}
+
+	buff, err = yaml.Marshal(&FieldDiff{Path: "port", Old: 0, New: 80})
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	if !strings.Contains(string(buff), "old: 0") {
+		t.Errorf("want old: 0, got %s", buff)
+	}
+}
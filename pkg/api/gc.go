@@ -0,0 +1,136 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/kataras/iris"
+)
+
+type (
+	// GCStats is the readable subset of runtime.MemStats,
+	// the sizes are in bytes with the readable ones alongside.
+	GCStats struct {
+		HeapAlloc         uint64 `json:"heapAlloc"`
+		HeapAllocReadable string `json:"heapAllocReadable"`
+		HeapInuse         uint64 `json:"heapInuse"`
+		HeapIdle          uint64 `json:"heapIdle"`
+		HeapReleased      uint64 `json:"heapReleased"`
+		HeapObjects       uint64 `json:"heapObjects"`
+		Sys               uint64 `json:"sys"`
+		SysReadable       string `json:"sysReadable"`
+		NextGC            uint64 `json:"nextGC"`
+
+		NumGC         uint32  `json:"numGC"`
+		NumForcedGC   uint32  `json:"numForcedGC"`
+		LastGC        string  `json:"lastGC,omitempty"`
+		LastPause     string  `json:"lastPause"`
+		PauseTotal    string  `json:"pauseTotal"`
+		GCCPUFraction float64 `json:"gcCPUFraction"`
+	}
+
+	// GCResult is the response of the APIs releasing memory.
+	GCResult struct {
+		Duration string   `json:"duration"`
+		Before   *GCStats `json:"before"`
+		After    *GCStats `json:"after"`
+	}
+)
+
+func readableBytes(b uint64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+
+	div, exp := uint64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
+
+func readGCStats() *GCStats {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	stats := &GCStats{
+		HeapAlloc:         m.HeapAlloc,
+		HeapAllocReadable: readableBytes(m.HeapAlloc),
+		HeapInuse:         m.HeapInuse,
+		HeapIdle:          m.HeapIdle,
+		HeapReleased:      m.HeapReleased,
+		HeapObjects:       m.HeapObjects,
+		Sys:               m.Sys,
+		SysReadable:       readableBytes(m.Sys),
+		NextGC:            m.NextGC,
+
+		NumGC:         m.NumGC,
+		NumForcedGC:   m.NumForcedGC,
+		PauseTotal:    time.Duration(m.PauseTotalNs).String(),
+		LastPause:     time.Duration(m.PauseNs[(m.NumGC+255)%256]).String(),
+		GCCPUFraction: m.GCCPUFraction,
+	}
+	if m.LastGC != 0 {
+		stats.LastGC = time.Unix(0, int64(m.LastGC)).Format(time.RFC3339Nano)
+	}
+
+	return stats
+}
+
+func writeJSON(ctx iris.Context, v interface{}) {
+	buff, err := json.Marshal(v)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to json failed: %v", v, err))
+	}
+
+	ctx.Header("Content-Type", "application/json")
+	ctx.Write(buff)
+}
+
+// releaseMemory runs release synchronously between reading the stats.
+func releaseMemory(ctx iris.Context, release func()) {
+	before := readGCStats()
+	startTime := time.Now()
+	release()
+	result := &GCResult{
+		Duration: time.Since(startTime).String(),
+		Before:   before,
+		After:    readGCStats(),
+	}
+
+	writeJSON(ctx, result)
+}
+
+func (s *Server) runGC(ctx iris.Context) {
+	releaseMemory(ctx, runtime.GC)
+}
+
+func (s *Server) freeOSMemory(ctx iris.Context) {
+	releaseMemory(ctx, debug.FreeOSMemory)
+}
+
+func (s *Server) getMemStats(ctx iris.Context) {
+	writeJSON(ctx, readGCStats())
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kataras/iris"
+)
+
+func TestGCAPIs(t *testing.T) {
+	s := &Server{debugToken: "secret"}
+	app := newTestApp(t, func(app *iris.Application) {
+		app.Post(DebugPrefix+"/gc", s.debugAuth(s.runGC))
+		app.Post(DebugPrefix+"/freeos", s.debugAuth(s.freeOSMemory))
+		app.Get(DebugPrefix+"/memstats", s.debugAuth(s.getMemStats))
+	})
+
+	request := func(method, path, token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		return serveTestRequest(app, r)
+	}
+
+	if w := request(http.MethodPost, DebugPrefix+"/gc", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("no token: want %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	for _, path := range []string{DebugPrefix + "/gc", DebugPrefix + "/freeos"} {
+		w := request(http.MethodPost, path, "secret")
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: want %d, got %d", path, http.StatusOK, w.Code)
+		}
+
+		result := &GCResult{}
+		if err := json.Unmarshal(w.Body.Bytes(), result); err != nil {
+			t.Fatalf("%s: unmarshal %s failed: %v", path, w.Body.String(), err)
+		}
+		if result.Before == nil || result.After == nil || result.After.NumGC <= result.Before.NumGC {
+			t.Errorf("%s: want a gc run between the stats, got %s", path, w.Body.String())
+		}
+	}
+
+	w := request(http.MethodGet, DebugPrefix+"/memstats", "secret")
+	stats := &GCStats{}
+	if err := json.Unmarshal(w.Body.Bytes(), stats); err != nil || stats.HeapAlloc == 0 || stats.LastGC == "" {
+		t.Errorf("want mem stats, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestReadableBytes(t *testing.T) {
+	for _, c := range []struct {
+		bytes uint64
+		want  string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{5 << 20, "5.0 MiB"},
+		{3 << 30, "3.0 GiB"},
+	} {
+		if got := readableBytes(c.bytes); got != c.want {
+			t.Errorf("%d: want %s, got %s", c.bytes, c.want, got)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+
+	"github.com/kataras/iris"
+)
+
+const (
+	graphFormatDOT     = "dot"
+	graphFormatJSON    = "json"
+	graphFormatMermaid = "mermaid"
+
+	graphNodeObject = "object"
+	graphNodeFilter = "filter"
+)
+
+type (
+	// Graph is the dependency graph of the objects, the filters of the
+	// pipelines are nodes too.
+	Graph struct {
+		Nodes []*GraphNode `json:"nodes"`
+		Edges []*GraphEdge `json:"edges"`
+	}
+
+	// GraphNode is an object or a filter, the id of a filter is
+	// like `pipeline/filter`.
+	GraphNode struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+		Kind string `json:"kind"`
+		Type string `json:"type"`
+	}
+
+	// GraphEdge is a reference from a node to another, the label is the
+	// path of the referencing field like `rules[0].paths[0].backend`.
+	GraphEdge struct {
+		From  string `json:"from"`
+		To    string `json:"to"`
+		Label string `json:"label"`
+	}
+)
+
+func (s *Server) getGraph(ctx iris.Context) {
+	format := ctx.URLParamDefault("format", graphFormatDOT)
+
+	// No need to lock.
+
+	graph := newGraph(s._listObjects())
+
+	switch format {
+	case graphFormatJSON:
+		writeJSON(ctx, graph)
+	case graphFormatDOT:
+		ctx.Header("Content-Type", "text/vnd.graphviz")
+		ctx.Write(graph.DOT())
+	case graphFormatMermaid:
+		ctx.Header("Content-Type", "text/plain")
+		ctx.Write(graph.Mermaid())
+	default:
+		HandleAPIError(ctx, iris.StatusBadRequest,
+			fmt.Errorf("unsupported format %s, want dot, json or mermaid", format))
+	}
+}
+
+// newGraph builds the graph by introspecting the specs: any string field
+// whose value is the name of another object is a reference to it, and a
+// pipeline uses its filters, whose fields are introspected the same way.
+func newGraph(specs []*supervisor.Spec) *Graph {
+	sort.Slice(specs, func(i, j int) bool { return specs[i].Name() < specs[j].Name() })
+
+	g := &Graph{Nodes: []*GraphNode{}, Edges: []*GraphEdge{}}
+	names := map[string]bool{}
+	for _, spec := range specs {
+		names[spec.Name()] = true
+	}
+
+	for _, spec := range specs {
+		name := spec.Name()
+		g.Nodes = append(g.Nodes, &GraphNode{
+			ID:   name,
+			Name: name,
+			Kind: spec.Kind(),
+			Type: graphNodeObject,
+		})
+
+		m := effectiveSpec(spec)
+		delete(m, "name")
+		delete(m, "kind")
+
+		if spec.Kind() == httppipeline.Kind {
+			filters, _ := m["filters"].([]interface{})
+			// NOTE: The flow refers to the filters by their names.
+			delete(m, "filters")
+			delete(m, "flow")
+
+			for _, f := range filters {
+				filter, ok := f.(map[interface{}]interface{})
+				if !ok {
+					continue
+				}
+				filterName, _ := filter["name"].(string)
+				filterKind, _ := filter["kind"].(string)
+				id := name + "/" + filterName
+				g.Nodes = append(g.Nodes, &GraphNode{
+					ID:   id,
+					Name: filterName,
+					Kind: filterKind,
+					Type: graphNodeFilter,
+				})
+				g.Edges = append(g.Edges, &GraphEdge{From: name, To: id, Label: "filter"})
+
+				delete(filter, "name")
+				delete(filter, "kind")
+				g.walk(id, name, "", filter, names)
+			}
+		}
+
+		g.walk(name, name, "", m, names)
+	}
+
+	return g
+}
+
+// walk adds the references in the value at the path of the node,
+// self is the name of the object owning the node.
+func (g *Graph) walk(node, self, path string, value interface{}, names map[string]bool) {
+	switch v := value.(type) {
+	case string:
+		if v != self && names[v] {
+			g.Edges = append(g.Edges, &GraphEdge{From: node, To: v, Label: path})
+		}
+	case map[interface{}]interface{}:
+		keys := make([]string, 0, len(v))
+		values := map[string]interface{}{}
+		for k, sub := range v {
+			key := fmt.Sprintf("%v", k)
+			keys = append(keys, key)
+			values[key] = sub
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			subPath := key
+			if path != "" {
+				subPath = path + "." + key
+			}
+			g.walk(node, self, subPath, values[key], names)
+		}
+	case []interface{}:
+		for i, sub := range v {
+			g.walk(node, self, fmt.Sprintf("%s[%d]", path, i), sub, names)
+		}
+	}
+}
+
+// DOT returns the graph in the Graphviz DOT language.
+func (g *Graph) DOT() []byte {
+	var buff bytes.Buffer
+	buff.WriteString("digraph easegress {\n")
+	buff.WriteString("  rankdir=LR;\n")
+	for _, n := range g.Nodes {
+		shape := "box"
+		if n.Type == graphNodeFilter {
+			shape = "ellipse"
+		}
+		fmt.Fprintf(&buff, "  %s [label=%s, shape=%s];\n",
+			strconv.Quote(n.ID), strconv.Quote(n.Name+"\n"+n.Kind), shape)
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&buff, "  %s -> %s [label=%s];\n",
+			strconv.Quote(e.From), strconv.Quote(e.To), strconv.Quote(e.Label))
+	}
+	buff.WriteString("}\n")
+	return buff.Bytes()
+}
+
+// Mermaid returns the graph in the Mermaid flowchart syntax, the nodes
+// are numbered since the names may contain characters Mermaid rejects.
+func (g *Graph) Mermaid() []byte {
+	ids := map[string]string{}
+	for i, n := range g.Nodes {
+		ids[n.ID] = "n" + strconv.Itoa(i)
+	}
+
+	escape := strings.NewReplacer(`"`, "#quot;", "|", "#124;").Replace
+
+	var buff bytes.Buffer
+	buff.WriteString("graph LR\n")
+	for _, n := range g.Nodes {
+		left, right := "[", "]"
+		if n.Type == graphNodeFilter {
+			left, right = "(", ")"
+		}
+		fmt.Fprintf(&buff, "  %s%s\"%s<br/>%s\"%s\n",
+			ids[n.ID], left, escape(n.Name), escape(n.Kind), right)
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&buff, "  %s -->|\"%s\"| %s\n", ids[e.From], escape(e.Label), ids[e.To])
+	}
+	return buff.Bytes()
+}
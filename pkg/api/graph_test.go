@@ -0,0 +1,112 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+func newGraphTestSpecs(t *testing.T) []*supervisor.Spec {
+	yamls := []string{`
+name: server
+kind: DiffTestObject
+port: 80
+hosts: [pipeline, server, example.com]
+`, `
+name: registry
+kind: DiffTestObject
+port: 2379
+`, `
+name: pipeline
+kind: HTTPPipeline
+flow:
+- filter: proxy
+filters:
+- name: proxy
+  kind: Proxy
+  mainPool:
+    serviceRegistry: registry
+    serviceName: "pipeline"
+    loadBalance:
+      policy: roundRobin
+`}
+
+	specs := []*supervisor.Spec{}
+	for _, y := range yamls {
+		spec, err := supervisor.NewSpec(y)
+		if err != nil {
+			t.Fatalf("new spec failed: %v", err)
+		}
+		specs = append(specs, spec)
+	}
+	return specs
+}
+
+func TestNewGraph(t *testing.T) {
+	g := newGraph(newGraphTestSpecs(t))
+
+	nodes := []string{}
+	for _, n := range g.Nodes {
+		nodes = append(nodes, n.ID+":"+n.Kind+":"+n.Type)
+	}
+	want := "pipeline:HTTPPipeline:object pipeline/proxy:Proxy:filter " +
+		"registry:DiffTestObject:object server:DiffTestObject:object"
+	if got := strings.Join(nodes, " "); got != want {
+		t.Errorf("want nodes %s, got %s", want, got)
+	}
+
+	edges := []string{}
+	for _, e := range g.Edges {
+		edges = append(edges, e.From+"->"+e.To+":"+e.Label)
+	}
+	want = "pipeline->pipeline/proxy:filter " +
+		"pipeline/proxy->registry:mainPool.serviceRegistry " +
+		"server->pipeline:hosts[0]"
+	if got := strings.Join(edges, " "); got != want {
+		t.Errorf("want edges %s, got %s", want, got)
+	}
+}
+
+func TestGraphFormats(t *testing.T) {
+	g := newGraph(newGraphTestSpecs(t))
+
+	dot := string(g.DOT())
+	for _, s := range []string{
+		"digraph easegress {",
+		`"pipeline/proxy" [label="proxy\nProxy", shape=ellipse];`,
+		`"server" -> "pipeline" [label="hosts[0]"];`,
+	} {
+		if !strings.Contains(dot, s) {
+			t.Errorf("want %s in dot:\n%s", s, dot)
+		}
+	}
+
+	mermaid := string(g.Mermaid())
+	for _, s := range []string{
+		"graph LR\n",
+		`n1("proxy<br/>Proxy")`,
+		`n3 -->|"hosts[0]"| n0`,
+	} {
+		if !strings.Contains(mermaid, s) {
+			t.Errorf("want %s in mermaid:\n%s", s, mermaid)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kataras/iris"
+	"github.com/kataras/iris/context"
+)
+
+// latencyBucketBounds are the upper bounds in millisecond of the latency
+// histogram buckets, the last bucket is unbounded.
+var latencyBucketBounds = []float64{1, 2, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+type (
+	// latencyHistograms accumulates the latency histograms per route,
+	// the zero value is ready to use.
+	latencyHistograms struct {
+		// routes is map[string]*latencyHistogram keyed by
+		// the method and the path template of the route.
+		routes sync.Map
+	}
+
+	latencyHistogram struct {
+		// counts has one more unbounded bucket than latencyBucketBounds.
+		counts []uint64
+		sumNs  uint64
+	}
+
+	// RouteLatency is the latency histogram of one route.
+	RouteLatency struct {
+		Route string `json:"route"`
+		// Bounds are the upper bounds in millisecond of the buckets,
+		// the last bucket in Counts is unbounded.
+		Bounds []float64 `json:"bounds"`
+		Counts []uint64  `json:"counts"`
+		Count  uint64    `json:"count"`
+		SumMs  float64   `json:"sumMs"`
+	}
+)
+
+func (lh *latencyHistograms) observe(route string, d time.Duration) {
+	value, exists := lh.routes.Load(route)
+	if !exists {
+		value, _ = lh.routes.LoadOrStore(route, &latencyHistogram{
+			counts: make([]uint64, len(latencyBucketBounds)+1),
+		})
+	}
+	h := value.(*latencyHistogram)
+
+	ms := float64(d) / float64(time.Millisecond)
+	i := sort.SearchFloat64s(latencyBucketBounds, ms)
+	atomic.AddUint64(&h.counts[i], 1)
+	atomic.AddUint64(&h.sumNs, uint64(d))
+}
+
+func (lh *latencyHistograms) snapshot() []*RouteLatency {
+	result := []*RouteLatency{}
+	lh.routes.Range(func(key, value interface{}) bool {
+		h := value.(*latencyHistogram)
+		rl := &RouteLatency{
+			Route:  key.(string),
+			Bounds: latencyBucketBounds,
+			Counts: make([]uint64, len(h.counts)),
+			SumMs:  float64(atomic.LoadUint64(&h.sumNs)) / float64(time.Millisecond),
+		}
+		for i := range h.counts {
+			rl.Counts[i] = atomic.LoadUint64(&h.counts[i])
+			rl.Count += rl.Counts[i]
+		}
+		result = append(result, rl)
+		return true
+	})
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Route < result[j].Route
+	})
+
+	return result
+}
+
+// newLatencyRecorder records the latency of requests by route,
+// the requests not matching any route are not recorded.
+func newLatencyRecorder(s *Server) func(context.Context) {
+	return func(ctx context.Context) {
+		startTime := time.Now()
+		ctx.Next()
+
+		route := ctx.GetCurrentRoute()
+		if route == nil {
+			return
+		}
+		s.latencies.observe(route.Method()+" "+route.Path(), time.Since(startTime))
+	}
+}
+
+func (s *Server) getLatency(ctx iris.Context) {
+	buff, err := json.Marshal(s.latencies.snapshot())
+	if err != nil {
+		panic(fmt.Errorf("marshal latency histograms to json failed: %v", err))
+	}
+
+	ctx.Header("Content-Type", "application/json")
+	ctx.Write(buff)
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/kataras/iris"
+)
+
+func TestLatencyHistograms(t *testing.T) {
+	s := &Server{debugToken: "secret"}
+	app := newTestApp(t, func(app *iris.Application) {
+		app.Use(newLatencyRecorder(s))
+		app.Get("/fast", func(ctx iris.Context) {})
+		app.Get("/slow", func(ctx iris.Context) {
+			time.Sleep(30 * time.Millisecond)
+		})
+		app.Get("/debug/latency", s.debugAuth(s.getLatency))
+	})
+
+	for i := 0; i < 3; i++ {
+		serveTestRequest(app, httptest.NewRequest(http.MethodGet, "/fast", nil))
+	}
+	for i := 0; i < 2; i++ {
+		serveTestRequest(app, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/debug/latency", nil)
+	if w := serveTestRequest(app, r); w.Code != http.StatusUnauthorized {
+		t.Fatalf("no token: want %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/debug/latency", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	w := serveTestRequest(app, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("want %d, got %d", http.StatusOK, w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("want content type application/json, got %s", ct)
+	}
+
+	routes := []*RouteLatency{}
+	err := json.Unmarshal(w.Body.Bytes(), &routes)
+	if err != nil {
+		t.Fatalf("unmarshal %s failed: %v", w.Body.String(), err)
+	}
+	latencies := map[string]*RouteLatency{}
+	for _, rl := range routes {
+		latencies[rl.Route] = rl
+	}
+
+	// bucketOf returns the bucket index of the latency in millisecond.
+	bucketOf := func(ms float64) int {
+		return sort.SearchFloat64s(latencyBucketBounds, ms)
+	}
+
+	fast := latencies["GET /fast"]
+	if fast == nil {
+		t.Fatalf("no histogram of GET /fast in %s", w.Body.String())
+	}
+	if fast.Count != 3 {
+		t.Fatalf("GET /fast: want count 3, got %d", fast.Count)
+	}
+	if len(fast.Counts) != len(fast.Bounds)+1 {
+		t.Fatalf("want %d buckets, got %d", len(fast.Bounds)+1, len(fast.Counts))
+	}
+	for i := bucketOf(30); i < len(fast.Counts); i++ {
+		if fast.Counts[i] != 0 {
+			t.Fatalf("GET /fast: want no requests slower than 30ms, got %v", fast.Counts)
+		}
+	}
+
+	slow := latencies["GET /slow"]
+	if slow == nil {
+		t.Fatalf("no histogram of GET /slow in %s", w.Body.String())
+	}
+	if slow.Count != 2 {
+		t.Fatalf("GET /slow: want count 2, got %d", slow.Count)
+	}
+	for i := 0; i < bucketOf(30); i++ {
+		if slow.Counts[i] != 0 {
+			t.Fatalf("GET /slow: want no requests faster than 30ms, got %v", slow.Counts)
+		}
+	}
+	if slow.SumMs < 60 {
+		t.Fatalf("GET /slow: want sum at least 60ms, got %v", slow.SumMs)
+	}
+}
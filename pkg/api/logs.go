@@ -0,0 +1,160 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/logger"
+
+	"github.com/kataras/iris"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// LogsPath is the path of the log tail API.
+	LogsPath = "/logs"
+
+	// defaultLogsTail is the number of the latest records sent first.
+	defaultLogsTail = 100
+
+	// logsBufferSize is the number of records buffered for a slow client,
+	// the oldest unsent ones are dropped once it's full.
+	logsBufferSize = 1024
+)
+
+func (s *Server) setupLogAPIs() {
+	logAPIs := []*APIEntry{
+		{
+			Path:         LogsPath,
+			Method:       "GET",
+			CacheControl: "no-cache",
+			Handler:      s.debugAuth(s.tailLogs),
+		},
+	}
+
+	s.RegisterAPIs(logAPIs)
+}
+
+// tailLogs sends the latest records of the default logger, then streams
+// the new ones until the client goes away, unless follow is false.
+// The records are selected by level, object (or its alias pipeline) and
+// the free text q, it's SSE if the client accepts text/event-stream,
+// otherwise chunked plain text.
+func (s *Server) tailLogs(ctx iris.Context) {
+	object := ctx.URLParam("object")
+	if object == "" {
+		object = ctx.URLParam("pipeline")
+	}
+	filter, err := logger.NewLogFilter(ctx.URLParam("level"), object, ctx.URLParam("q"))
+	if err != nil {
+		HandleAPIError(ctx, http.StatusBadRequest, fmt.Errorf("invalid level: %v", err))
+		return
+	}
+
+	tail := defaultLogsTail
+	if v := ctx.URLParam("tail"); v != "" {
+		tail, err = strconv.Atoi(v)
+		if err != nil || tail < 0 {
+			HandleAPIError(ctx, http.StatusBadRequest, fmt.Errorf("invalid tail: %s", v))
+			return
+		}
+	}
+
+	follow := true
+	if v := ctx.URLParam("follow"); v != "" {
+		follow, err = strconv.ParseBool(v)
+		if err != nil {
+			HandleAPIError(ctx, http.StatusBadRequest, fmt.Errorf("invalid follow: %s", v))
+			return
+		}
+	}
+
+	if !follow {
+		records := logger.TailLogs(filter, tail)
+		buff, err := yaml.Marshal(records)
+		if err != nil {
+			panic(fmt.Errorf("marshal %#v to yaml failed: %v", records, err))
+		}
+
+		ctx.Header("Content-Type", "text/vnd.yaml")
+		ctx.Write(buff)
+		return
+	}
+
+	flusher, ok := ctx.ResponseWriter().Flusher()
+	if !ok {
+		HandleAPIError(ctx, http.StatusInternalServerError, fmt.Errorf("streaming unsupported"))
+		return
+	}
+
+	release := s.acquireStream(ctx)
+	if release == nil {
+		return
+	}
+	defer release()
+
+	backlog, subscription := logger.SubscribeLogs(filter, tail, logsBufferSize)
+	defer subscription.Close()
+
+	sse := strings.Contains(ctx.GetHeader("Accept"), "text/event-stream")
+	if sse {
+		ctx.Header("Content-Type", "text/event-stream")
+	} else {
+		ctx.Header("Content-Type", "text/plain; charset=utf-8")
+	}
+
+	writeLine := func(line string) error {
+		if sse {
+			line = "data: " + strings.ReplaceAll(line, "\n", "\ndata: ") + "\n"
+		}
+		_, err := ctx.WriteString(line + "\n")
+		return err
+	}
+
+	for _, record := range backlog {
+		if writeLine(record.String()) != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	var dropped uint64
+	done := ctx.Request().Context().Done()
+	for {
+		select {
+		case <-done:
+			return
+		case record := <-subscription.Records():
+			if d := subscription.Dropped(); d > dropped {
+				msg := fmt.Sprintf("%d records dropped for reading too slowly", d-dropped)
+				if writeLine(msg) != nil {
+					return
+				}
+				dropped = d
+			}
+			if writeLine(record.String()) != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
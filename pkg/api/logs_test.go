@@ -0,0 +1,159 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+
+	"github.com/kataras/iris"
+)
+
+func TestTailLogs(t *testing.T) {
+	s := &Server{debugToken: "secret"}
+	app := newTestApp(t, func(app *iris.Application) {
+		app.Get(LogsPath, s.debugAuth(s.tailLogs))
+	})
+
+	newRequest := func(query string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, LogsPath+"?"+query, nil)
+		r.Header.Set("Authorization", "Bearer secret")
+		return r
+	}
+
+	logger.Warnf("pipeline tail-logs-demo: upstream timeout")
+	logger.Warnf("pipeline tail-logs-other: upstream timeout")
+
+	w := serveTestRequest(app, newRequest("follow=false&pipeline=tail-logs-demo&level=warn"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("want %d, got %d", http.StatusOK, w.Code)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, "tail-logs-demo") || strings.Contains(body, "tail-logs-other") {
+		t.Fatalf("unexpected records: %s", body)
+	}
+
+	for _, query := range []string{"level=verbose", "tail=-1", "follow=maybe"} {
+		w := serveTestRequest(app, newRequest(query))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: want %d, got %d", query, http.StatusBadRequest, w.Code)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := newRequest("q=tail-logs-stream&tail=10").WithContext(ctx)
+	r.Header.Set("Accept", "text/event-stream")
+	w = httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		app.ServeHTTP(w, r)
+		close(done)
+	}()
+
+	logger.Warnf("tail-logs-stream record")
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("streaming not stopped after the client went away")
+	}
+
+	if got := w.Header().Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("want content type text/event-stream, got %s", got)
+	}
+	if !strings.Contains(w.Body.String(), "data: ") ||
+		!strings.Contains(w.Body.String(), "tail-logs-stream record") {
+		t.Errorf("record not streamed: %s", w.Body.String())
+	}
+}
+
+func TestTailLogsMaxStreams(t *testing.T) {
+	s := &Server{debugToken: "secret", streams: newStreamSlots(2)}
+	app := newTestApp(t, func(app *iris.Application) {
+		app.Get(LogsPath, s.debugAuth(s.tailLogs))
+	})
+
+	type stream struct {
+		w      *httptest.ResponseRecorder
+		cancel context.CancelFunc
+		done   chan struct{}
+	}
+	openStream := func() *stream {
+		ctx, cancel := context.WithCancel(context.Background())
+		r := httptest.NewRequest(http.MethodGet, LogsPath+"?q=max-streams&tail=0", nil).WithContext(ctx)
+		r.Header.Set("Authorization", "Bearer secret")
+		st := &stream{w: httptest.NewRecorder(), cancel: cancel, done: make(chan struct{})}
+		go func() {
+			app.ServeHTTP(st.w, r)
+			close(st.done)
+		}()
+		return st
+	}
+	closeStream := func(st *stream) {
+		st.cancel()
+		select {
+		case <-st.done:
+		case <-time.After(time.Second):
+			t.Fatalf("streaming not stopped after the client went away")
+		}
+	}
+	waitStreams := func(n int) {
+		deadline := time.Now().Add(time.Second)
+		for len(s.streams) != n {
+			if time.Now().After(deadline) {
+				t.Fatalf("want %d streams, got %d", n, len(s.streams))
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	streams := []*stream{openStream(), openStream()}
+	waitStreams(2)
+
+	excess := openStream()
+	select {
+	case <-excess.done:
+	case <-time.After(time.Second):
+		t.Fatalf("want excess stream rejected, got it streaming")
+	}
+	if excess.w.Code != http.StatusServiceUnavailable {
+		t.Errorf("want %d, got %d", http.StatusServiceUnavailable, excess.w.Code)
+	}
+
+	// NOTE: The existing streams continue.
+	logger.Warnf("max-streams record")
+	time.Sleep(100 * time.Millisecond)
+	for _, st := range streams {
+		closeStream(st)
+		if st.w.Code != http.StatusOK || !strings.Contains(st.w.Body.String(), "max-streams record") {
+			t.Errorf("want record streamed, got %d: %s", st.w.Code, st.w.Body.String())
+		}
+	}
+
+	waitStreams(0)
+	st := openStream()
+	waitStreams(1)
+	closeStream(st)
+}
@@ -0,0 +1,175 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/logger"
+
+	"github.com/kataras/iris"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// MaintenancePath is the path to turn on/off maintenance mode.
+	MaintenancePath = AdminPrefix + "/maintenance"
+
+	defaultMaintenanceMessage = "the api server is in maintenance mode, changes are rejected"
+)
+
+type (
+	// MaintenanceSpec describes the response to the mutating requests
+	// in maintenance mode.
+	MaintenanceSpec struct {
+		// StatusCode is 503 by default.
+		StatusCode int    `yaml:"statusCode"`
+		Message    string `yaml:"message"`
+		Contact    string `yaml:"contact,omitempty"`
+		StatusPage string `yaml:"statusPage,omitempty"`
+
+		// Body replaces the whole default body if not empty,
+		// ContentType is text/plain by default for it.
+		Body        string `yaml:"body,omitempty"`
+		ContentType string `yaml:"contentType,omitempty"`
+	}
+
+	// MaintenanceErr is the default body of the rejected requests.
+	MaintenanceErr struct {
+		Code       int    `yaml:"code"`
+		Message    string `yaml:"message"`
+		Contact    string `yaml:"contact,omitempty"`
+		StatusPage string `yaml:"statusPage,omitempty"`
+	}
+)
+
+// Validate validates MaintenanceSpec.
+func (spec *MaintenanceSpec) Validate() error {
+	if spec.StatusCode < 400 || spec.StatusCode > 599 {
+		return fmt.Errorf("invalid status code %d: must be 4xx or 5xx", spec.StatusCode)
+	}
+
+	return nil
+}
+
+// SetMaintenance turns on maintenance mode with the spec, or turns it
+// off if spec is nil. In maintenance mode, the api server is read-only,
+// all mutating requests are rejected with the response of the spec.
+func (s *Server) SetMaintenance(spec *MaintenanceSpec) {
+	s.maintenance.Store(spec)
+}
+
+// Maintenance returns the spec of maintenance mode, nil means it's off.
+func (s *Server) Maintenance() *MaintenanceSpec {
+	spec, _ := s.maintenance.Load().(*MaintenanceSpec)
+	return spec
+}
+
+func isMutatingMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	default:
+		return true
+	}
+}
+
+func newMaintenanceGuard(s *Server) func(iris.Context) {
+	return func(ctx iris.Context) {
+		spec := s.Maintenance()
+		// NOTE: Maintenance mode itself is still changeable.
+		if spec == nil || !isMutatingMethod(ctx.Method()) ||
+			strings.TrimSuffix(ctx.Path(), "/") == APIPrefix+MaintenancePath {
+			ctx.Next()
+			return
+		}
+
+		ctx.StatusCode(spec.StatusCode)
+		if spec.Body != "" {
+			contentType := spec.ContentType
+			if contentType == "" {
+				contentType = "text/plain"
+			}
+			ctx.Header("Content-Type", contentType)
+			ctx.WriteString(spec.Body)
+			return
+		}
+
+		body := &MaintenanceErr{
+			Code:       spec.StatusCode,
+			Message:    spec.Message,
+			Contact:    spec.Contact,
+			StatusPage: spec.StatusPage,
+		}
+		buff, err := yaml.Marshal(body)
+		if err != nil {
+			panic(fmt.Errorf("marshal %#v to yaml failed: %v", body, err))
+		}
+		ctx.Header("Content-Type", "text/vnd.yaml")
+		ctx.Write(buff)
+	}
+}
+
+func (s *Server) getMaintenance(ctx iris.Context) {
+	spec := s.Maintenance()
+	if spec == nil {
+		HandleAPIError(ctx, iris.StatusNotFound, fmt.Errorf("maintenance mode is off"))
+		return
+	}
+
+	buff, err := yaml.Marshal(spec)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", spec, err))
+	}
+
+	ctx.Header("Content-Type", "text/vnd.yaml")
+	ctx.Write(buff)
+}
+
+func (s *Server) setMaintenance(ctx iris.Context) {
+	body, err := DecodeBody(ctx)
+	if err != nil {
+		HandleAPIError(ctx, iris.StatusBadRequest, err)
+		return
+	}
+
+	spec := &MaintenanceSpec{
+		StatusCode: http.StatusServiceUnavailable,
+		Message:    defaultMaintenanceMessage,
+	}
+	err = yaml.Unmarshal(body, spec)
+	if err != nil {
+		HandleAPIError(ctx, iris.StatusBadRequest, fmt.Errorf("unmarshal %s to yaml failed: %v", body, err))
+		return
+	}
+	err = spec.Validate()
+	if err != nil {
+		HandleAPIError(ctx, iris.StatusBadRequest, err)
+		return
+	}
+
+	s.SetMaintenance(spec)
+	logger.Infof("api server enters maintenance mode by %s", ctx.RemoteAddr())
+}
+
+func (s *Server) deleteMaintenance(ctx iris.Context) {
+	s.SetMaintenance(nil)
+	logger.Infof("api server leaves maintenance mode by %s", ctx.RemoteAddr())
+}
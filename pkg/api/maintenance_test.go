@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kataras/iris"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+	s := &Server{}
+	app := newTestApp(t, func(app *iris.Application) {
+		app.Use(newMaintenanceGuard(s))
+		app.Get(APIPrefix+ObjectPrefix, func(ctx iris.Context) {})
+		app.Post(APIPrefix+ObjectPrefix, func(ctx iris.Context) {
+			ctx.StatusCode(http.StatusCreated)
+		})
+		app.Put(APIPrefix+MaintenancePath, s.setMaintenance)
+		app.Delete(APIPrefix+MaintenancePath, s.deleteMaintenance)
+	})
+
+	post := func() *httptest.ResponseRecorder {
+		return serveTestRequest(app, httptest.NewRequest(http.MethodPost, APIPrefix+ObjectPrefix, nil))
+	}
+
+	if w := post(); w.Code != http.StatusCreated {
+		t.Fatalf("normal mode: want %d, got %d", http.StatusCreated, w.Code)
+	}
+
+	w := serveTestRequest(app, httptest.NewRequest(http.MethodPut, APIPrefix+MaintenancePath,
+		strings.NewReader("statusCode: 423\nmessage: upgrading etcd\ncontact: ops@example.com\nstatusPage: https://status.example.com\n")))
+	if w.Code != http.StatusOK {
+		t.Fatalf("set maintenance: want %d, got %d %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	w = post()
+	if w.Code != http.StatusLocked {
+		t.Fatalf("maintenance mode: want %d, got %d", http.StatusLocked, w.Code)
+	}
+	body := &MaintenanceErr{}
+	err := yaml.Unmarshal(w.Body.Bytes(), body)
+	if err != nil {
+		t.Fatalf("unmarshal %s failed: %v", w.Body.String(), err)
+	}
+	want := MaintenanceErr{
+		Code:       http.StatusLocked,
+		Message:    "upgrading etcd",
+		Contact:    "ops@example.com",
+		StatusPage: "https://status.example.com",
+	}
+	if *body != want {
+		t.Errorf("maintenance mode: want body %+v, got %+v", want, *body)
+	}
+
+	w = serveTestRequest(app, httptest.NewRequest(http.MethodGet, APIPrefix+ObjectPrefix, nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("maintenance mode: want read request %d, got %d", http.StatusOK, w.Code)
+	}
+
+	s.SetMaintenance(&MaintenanceSpec{
+		StatusCode:  http.StatusServiceUnavailable,
+		Body:        "<h1>Back soon</h1>",
+		ContentType: "text/html",
+	})
+	w = post()
+	if w.Code != http.StatusServiceUnavailable || w.Body.String() != "<h1>Back soon</h1>" {
+		t.Errorf("custom body: want 503 <h1>Back soon</h1>, got %d %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Content-Type") != "text/html" {
+		t.Errorf("custom body: want content type text/html, got %s", w.Header().Get("Content-Type"))
+	}
+
+	w = serveTestRequest(app, httptest.NewRequest(http.MethodDelete, APIPrefix+MaintenancePath, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("delete maintenance: want %d, got %d", http.StatusOK, w.Code)
+	}
+	if w := post(); w.Code != http.StatusCreated {
+		t.Errorf("normal mode: want %d, got %d", http.StatusCreated, w.Code)
+	}
+}
+
+func TestMaintenanceSpecValidate(t *testing.T) {
+	spec := &MaintenanceSpec{StatusCode: http.StatusOK}
+	if spec.Validate() == nil {
+		t.Errorf("want error for status code %d", spec.StatusCode)
+	}
+}
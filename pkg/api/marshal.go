@@ -0,0 +1,157 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// maxMarshalDepth is far beyond the nesting of any spec or status.
+	maxMarshalDepth = 128
+	maxMarshalNodes = 1 << 20
+)
+
+type (
+	// marshalGuard walks the value before marshaling, yaml.Marshal
+	// overflows the stack on the deeply nested or cyclic values,
+	// which crashes the whole process instead of a panic.
+	marshalGuard struct {
+		nodes int
+		// visiting records the references on the path to the current value.
+		visiting map[marshalRef]struct{}
+	}
+
+	marshalRef struct {
+		t reflect.Type
+		p uintptr
+	}
+)
+
+// marshalYAML marshals the value to yaml, it returns an error
+// if the value is nested too deep, too large or cyclic.
+func marshalYAML(v interface{}) ([]byte, error) {
+	err := checkMarshalLimits(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return yaml.Marshal(v)
+}
+
+func checkMarshalLimits(v interface{}) error {
+	g := &marshalGuard{visiting: make(map[marshalRef]struct{})}
+	return g.walk(reflect.ValueOf(v), 0)
+}
+
+// enter records the reference, it returns false if it's on the path already.
+func (g *marshalGuard) enter(v reflect.Value) (marshalRef, bool) {
+	ref := marshalRef{t: v.Type(), p: v.Pointer()}
+	if _, exists := g.visiting[ref]; exists {
+		return ref, false
+	}
+	g.visiting[ref] = struct{}{}
+	return ref, true
+}
+
+func (g *marshalGuard) walk(v reflect.Value, depth int) error {
+	if !v.IsValid() {
+		return nil
+	}
+
+	if depth > maxMarshalDepth {
+		return fmt.Errorf("nesting exceeds max depth %d", maxMarshalDepth)
+	}
+	g.nodes++
+	if g.nodes > maxMarshalNodes {
+		return fmt.Errorf("size exceeds max nodes %d", maxMarshalNodes)
+	}
+
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return g.walk(v.Elem(), depth)
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		ref, ok := g.enter(v)
+		if !ok {
+			return fmt.Errorf("cyclic value of %s", v.Type())
+		}
+		defer delete(g.visiting, ref)
+		return g.walk(v.Elem(), depth)
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		ref, ok := g.enter(v)
+		if !ok {
+			return fmt.Errorf("cyclic value of %s", v.Type())
+		}
+		defer delete(g.visiting, ref)
+		iter := v.MapRange()
+		for iter.Next() {
+			if err := g.walk(iter.Key(), depth+1); err != nil {
+				return err
+			}
+			if err := g.walk(iter.Value(), depth+1); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		if v.IsNil() || v.Len() == 0 {
+			return nil
+		}
+		ref, ok := g.enter(v)
+		if !ok {
+			return fmt.Errorf("cyclic value of %s", v.Type())
+		}
+		defer delete(g.visiting, ref)
+		fallthrough
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := g.walk(v.Index(i), depth+1); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			field := t.Field(i)
+			// NOTE: Skip the fields ignored by yaml.Marshal.
+			if field.PkgPath != "" && !field.Anonymous {
+				continue
+			}
+			if strings.Split(field.Tag.Get("yaml"), ",")[0] == "-" {
+				continue
+			}
+			if err := g.walk(v.Field(i), depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kataras/iris"
+)
+
+type marshalTestNode struct {
+	Name string            `yaml:"name"`
+	Next *marshalTestNode  `yaml:"next,omitempty"`
+	Tags map[string]string `yaml:"tags,omitempty"`
+	// parent is ignored by yaml.Marshal, so it never makes a cycle.
+	parent *marshalTestNode
+}
+
+func TestMarshalYAML(t *testing.T) {
+	root := &marshalTestNode{Name: "root"}
+	root.Next = &marshalTestNode{Name: "child", parent: root}
+	if _, err := marshalYAML(root); err != nil {
+		t.Errorf("want marshaled, got %v", err)
+	}
+
+	// NOTE: The same value at different paths is not a cycle.
+	tags := map[string]string{"a": "b"}
+	shared := []*marshalTestNode{{Name: "a", Tags: tags}, {Name: "b", Tags: tags}}
+	if _, err := marshalYAML(shared); err != nil {
+		t.Errorf("want shared value marshaled, got %v", err)
+	}
+
+	var deep interface{} = "leaf"
+	for i := 0; i < maxMarshalDepth*2; i++ {
+		deep = map[string]interface{}{"nested": deep}
+	}
+	if _, err := marshalYAML(deep); err == nil || !strings.Contains(err.Error(), "max depth") {
+		t.Errorf("want max depth error, got %v", err)
+	}
+
+	cyclic := map[string]interface{}{}
+	cyclic["self"] = cyclic
+	if _, err := marshalYAML(cyclic); err == nil || !strings.Contains(err.Error(), "cyclic") {
+		t.Errorf("want cyclic error, got %v", err)
+	}
+
+	node := &marshalTestNode{Name: "loop"}
+	node.Next = node
+	if _, err := marshalYAML(node); err == nil || !strings.Contains(err.Error(), "cyclic") {
+		t.Errorf("want cyclic error, got %v", err)
+	}
+
+	large := make([]int, maxMarshalNodes)
+	if _, err := marshalYAML(large); err == nil || !strings.Contains(err.Error(), "max nodes") {
+		t.Errorf("want max nodes error, got %v", err)
+	}
+}
+
+func TestMarshalYAMLAPIError(t *testing.T) {
+	var deep interface{} = "leaf"
+	for i := 0; i < maxMarshalDepth*2; i++ {
+		deep = []interface{}{deep}
+	}
+
+	app := newTestApp(t, func(app *iris.Application) {
+		app.Get("/status", func(ctx iris.Context) {
+			buff, err := marshalYAML(deep)
+			if err != nil {
+				HandleAPIError(ctx, http.StatusInternalServerError, err)
+				return
+			}
+			ctx.Write(buff)
+		})
+	})
+
+	w := serveTestRequest(app, httptest.NewRequest(http.MethodGet, "/status", nil))
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "max depth") {
+		t.Errorf("want %d with max depth error, got %d: %s",
+			http.StatusInternalServerError, w.Code, w.Body)
+	}
+}
@@ -36,6 +36,7 @@ func (s *Server) setupMemberAPIs() {
 		{
 			Path:    "/status/members/{member:string}",
 			Method:  "DELETE",
+			Signed:  true,
 			Handler: s.purgeMember,
 		},
 	}
@@ -55,6 +56,11 @@ func (r ListMembersResp) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
 // These methods which operate with cluster guarantee atomicity.
 
 func (s *Server) listMembers(ctx iris.Context) {
+	r := ReadPagination(ctx)
+	if r == nil {
+		return
+	}
+
 	kv, err := s.cluster.GetPrefix(s.cluster.Layout().StatusMemberPrefix())
 	if err != nil {
 		ClusterPanic(err)
@@ -73,9 +79,17 @@ func (s *Server) listMembers(ctx iris.Context) {
 
 	sort.Sort(resp)
 
-	buff, err := yaml.Marshal(resp)
+	names := make([]string, 0, len(resp))
+	for _, m := range resp {
+		names = append(names, m.Options.Name)
+	}
+	page := NewPage(r, names, func(start, end int) interface{} {
+		return resp[start:end]
+	}, nil)
+
+	buff, err := yaml.Marshal(page)
 	if err != nil {
-		panic(fmt.Errorf("marshal %#v to yaml failed: %v", resp, err))
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", page, err))
 	}
 
 	ctx.Write(buff)
@@ -97,9 +97,15 @@ func (s *Server) setupMetadaAPIs() {
 }
 
 func (s *Server) listFilters(ctx iris.Context) {
-	buff, err := yaml.Marshal(filterKinds)
+	r := ReadPagination(ctx)
+	if r == nil {
+		return
+	}
+
+	kinds := stringsPage(r, filterKinds)
+	buff, err := yaml.Marshal(kinds)
 	if err != nil {
-		panic(fmt.Errorf("marshal %#v to yaml failed: %v", filterKinds, err))
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", kinds, err))
 	}
 
 	ctx.Header("Content-Type", "text/vnd.yaml")
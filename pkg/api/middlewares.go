@@ -21,14 +21,48 @@ import (
 	"fmt"
 	"net/http"
 	"runtime/debug"
+	"strings"
 	"time"
 
 	"github.com/megaease/easegress/pkg/common"
 	"github.com/megaease/easegress/pkg/logger"
 
 	"github.com/kataras/iris/context"
+	yaml "gopkg.in/yaml.v2"
 )
 
+const (
+	// maxPathParams is the maximum number of captured path parameters.
+	maxPathParams = 16
+	// maxPathParamsSize is the maximum total bytes of captured path parameters.
+	maxPathParamsSize = 4096
+	// maxPathParamSegments is the maximum segments of one captured path parameter,
+	// which only makes sense for the wildcard one such as {path:path}.
+	maxPathParamSegments = 64
+)
+
+// use appends the middleware to the chain of the app.
+func (s *Server) use(name string, middleware context.Handler) {
+	s.middlewares = append(s.middlewares, name)
+	s.app.Use(middleware)
+}
+
+// MiddlewareChain returns the names of active middlewares in execution order.
+func (s *Server) MiddlewareChain() []string {
+	return append([]string(nil), s.middlewares...)
+}
+
+func (s *Server) getMiddlewareChain(ctx context.Context) {
+	chain := s.MiddlewareChain()
+	buff, err := yaml.Marshal(chain)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", chain, err))
+	}
+
+	ctx.Header("Content-Type", "text/vnd.yaml")
+	ctx.Write(buff)
+}
+
 func newAPILogger() func(context.Context) {
 	return func(ctx context.Context) {
 		var (
@@ -90,3 +124,45 @@ func newConfigVersionAttacher(s *Server) func(context.Context) {
 		ctx.Next()
 	}
 }
+
+func newPathParamsLimiter() func(context.Context) {
+	return func(ctx context.Context) {
+		err := checkPathParams(ctx.Params())
+		if err != nil {
+			HandleAPIError(ctx, http.StatusBadRequest, err)
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+func checkPathParams(params *context.RequestParams) error {
+	if params.Len() > maxPathParams {
+		return fmt.Errorf("too many path parameters: %d > %d",
+			params.Len(), maxPathParams)
+	}
+
+	var err error
+	size := 0
+	params.Visit(func(key, value string) {
+		if err != nil {
+			return
+		}
+
+		size += len(key) + len(value)
+		if size > maxPathParamsSize {
+			err = fmt.Errorf("path parameters too large: exceed %d bytes",
+				maxPathParamsSize)
+			return
+		}
+
+		segments := strings.Count(value, "/") + 1
+		if segments > maxPathParamSegments {
+			err = fmt.Errorf("path parameter %s has too many segments: %d > %d",
+				key, segments, maxPathParamSegments)
+		}
+	})
+
+	return err
+}
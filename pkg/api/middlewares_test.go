@@ -0,0 +1,182 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
+
+	"github.com/kataras/iris"
+	"github.com/kataras/iris/context"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var testLogDir string
+
+func TestMain(m *testing.M) {
+	tempDir, err := ioutil.TempDir("", "eg-api-test")
+	if err != nil {
+		panic(err)
+	}
+	testLogDir = filepath.Join(tempDir, "log")
+	os.MkdirAll(testLogDir, 0755)
+	logger.Init(&option.Options{
+		Name:      "api-for-log",
+		AbsLogDir: testLogDir,
+	})
+
+	code := m.Run()
+
+	logger.Sync()
+	os.RemoveAll(tempDir)
+
+	os.Exit(code)
+}
+
+func newTestApp(t *testing.T, setup func(app *iris.Application)) *iris.Application {
+	app := iris.New()
+	app.Logger().SetOutput(ioutil.Discard)
+	setup(app)
+	err := app.Build()
+	if err != nil {
+		t.Fatalf("build app failed: %v", err)
+	}
+
+	return app
+}
+
+func serveTestRequest(app *iris.Application, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, r)
+	return w
+}
+
+func TestPathParamsLimiter(t *testing.T) {
+	app := newTestApp(t, func(app *iris.Application) {
+		app.Use(newPathParamsLimiter())
+		app.Get("/files/{path:path}", func(ctx iris.Context) {})
+	})
+
+	path := "/files" + strings.Repeat("/a", maxPathParamSegments)
+	w := serveTestRequest(app, httptest.NewRequest(http.MethodGet, path, nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("%d segments: want %d, got %d",
+			maxPathParamSegments, http.StatusOK, w.Code)
+	}
+
+	path = "/files" + strings.Repeat("/a", maxPathParamSegments*8)
+	w = serveTestRequest(app, httptest.NewRequest(http.MethodGet, path, nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("%d segments: want %d, got %d",
+			maxPathParamSegments*8, http.StatusBadRequest, w.Code)
+	}
+
+	path = "/files/" + strings.Repeat("a", maxPathParamsSize+1)
+	w = serveTestRequest(app, httptest.NewRequest(http.MethodGet, path, nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("%d bytes: want %d, got %d",
+			maxPathParamsSize+1, http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestMiddlewareChain(t *testing.T) {
+	s := &Server{app: iris.New(), debugToken: "secret"}
+	s.setupMiddlewares()
+
+	want := []string{
+		"configVersionAttacher",
+		"recoverer",
+		"apiLogger",
+		"latencyRecorder",
+		"maintenanceGuard",
+		"pathParamsLimiter",
+	}
+	if got := s.MiddlewareChain(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+
+	app := newTestApp(t, func(app *iris.Application) {
+		app.Get("/debug/middleware", s.debugAuth(s.getMiddlewareChain))
+	})
+	r := httptest.NewRequest(http.MethodGet, "/debug/middleware", nil)
+	if w := serveTestRequest(app, r); w.Code != http.StatusForbidden && w.Code != http.StatusUnauthorized {
+		t.Fatalf("no token: want rejected, got %d", w.Code)
+	}
+	r.Header.Set("Authorization", "Bearer secret")
+	w := serveTestRequest(app, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("want %d, got %d", http.StatusOK, w.Code)
+	}
+	got := []string{}
+	err := yaml.Unmarshal(w.Body.Bytes(), &got)
+	if err != nil {
+		t.Fatalf("unmarshal %s failed: %v", w.Body.String(), err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("debug api: want %v, got %v", want, got)
+	}
+}
+
+// middlewareConstructor returns the name of the function creating the
+// middleware, such as newRecoverer.
+func middlewareConstructor(h context.Handler) string {
+	name := context.HandlerName(h)
+	name = name[strings.LastIndex(name, "/")+1:]
+	return strings.Split(name, ".")[1]
+}
+
+func TestMiddlewareChainExecutionOrder(t *testing.T) {
+	s := &Server{cluster: &fakeCluster{kvs: map[string]string{}}}
+	executed := []string{}
+	app := newTestApp(t, func(app *iris.Application) {
+		s.app = app
+		s.setupMiddlewares()
+		app.Get("/", func(ctx iris.Context) {
+			// NOTE: The handlers before the route one are the executed middlewares.
+			for _, h := range ctx.Handlers()[:ctx.HandlerIndex(-1)] {
+				executed = append(executed, middlewareConstructor(h))
+			}
+		})
+	})
+
+	w := serveTestRequest(app, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK || w.Header().Get(ConfigVersionKey) != "0" {
+		t.Fatalf("want %d with config version, got %d %v", http.StatusOK, w.Code, w.Header())
+	}
+
+	want := []string{"newConfigVersionAttacher", "newRecoverer", "newAPILogger",
+		"newLatencyRecorder", "newMaintenanceGuard", "newPathParamsLimiter"}
+	if !reflect.DeepEqual(executed, want) {
+		t.Errorf("want executed in %v, got %v", want, executed)
+	}
+
+	wantChain := []string{"configVersionAttacher", "recoverer", "apiLogger",
+		"latencyRecorder", "maintenanceGuard", "pathParamsLimiter"}
+	if chain := s.MiddlewareChain(); !reflect.DeepEqual(chain, wantChain) {
+		t.Errorf("want chain %v, got %v", wantChain, chain)
+	}
+}
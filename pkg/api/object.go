@@ -19,7 +19,6 @@ package api
 
 import (
 	"fmt"
-	"io/ioutil"
 	"sort"
 
 	"github.com/megaease/easegress/pkg/supervisor"
@@ -51,39 +50,42 @@ func (s *Server) setupObjectAPIs() {
 		&APIEntry{
 			Path:    ObjectPrefix,
 			Method:  "POST",
+			Signed:  true,
 			Handler: s.createObject,
 		},
 		&APIEntry{
 			Path:    ObjectPrefix,
 			Method:  "GET",
-			Handler: s.listObjects,
+			Handler: s.degradable(s.listObjects),
 		},
 
 		&APIEntry{
 			Path:    ObjectPrefix + "/{name:string}",
 			Method:  "GET",
-			Handler: s.getObject,
+			Handler: s.degradable(s.getObject),
 		},
 		&APIEntry{
 			Path:    ObjectPrefix + "/{name:string}",
 			Method:  "PUT",
+			Signed:  true,
 			Handler: s.updateObject,
 		},
 		&APIEntry{
 			Path:    ObjectPrefix + "/{name:string}",
 			Method:  "DELETE",
+			Signed:  true,
 			Handler: s.deleteObject,
 		},
 
 		&APIEntry{
 			Path:    StatusObjectPrefix,
 			Method:  "GET",
-			Handler: s.listStatusObjects,
+			Handler: s.degradable(s.listStatusObjects),
 		},
 		&APIEntry{
 			Path:    StatusObjectPrefix + "/{name:string}",
 			Method:  "GET",
-			Handler: s.getStatusObject,
+			Handler: s.degradable(s.getStatusObject),
 		},
 	)
 
@@ -91,9 +93,9 @@ func (s *Server) setupObjectAPIs() {
 }
 
 func (s *Server) readObjectSpec(ctx iris.Context) (*supervisor.Spec, error) {
-	body, err := ioutil.ReadAll(ctx.Request().Body)
+	body, err := DecodeBody(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("read body failed: %v", err)
+		return nil, err
 	}
 
 	spec, err := supervisor.NewSpec(string(body))
@@ -133,8 +135,9 @@ func (s *Server) createObject(ctx iris.Context) {
 		return
 	}
 
-	s._putObject(spec)
+	s._putObject(spec, newAuditMeta(ctx))
 	s.upgradeConfigVersion(ctx)
+	addSpecWarnings(ctx, spec)
 
 	ctx.StatusCode(iris.StatusCreated)
 	location := fmt.Sprintf("%s/%s", ctx.Path(), name)
@@ -153,7 +156,7 @@ func (s *Server) deleteObject(ctx iris.Context) {
 		return
 	}
 
-	s._deleteObject(name)
+	s._deleteObject(name, newAuditMeta(ctx))
 	s.upgradeConfigVersion(ctx)
 }
 
@@ -198,20 +201,50 @@ func (s *Server) updateObject(ctx iris.Context) {
 		return
 	}
 
-	s._putObject(spec)
+	if existedSpec.YAMLConfig() == spec.YAMLConfig() {
+		AddWarning(ctx, "spec of %s is unchanged", name)
+	}
+
+	s._putObject(spec, newAuditMeta(ctx))
 	s.upgradeConfigVersion(ctx)
+	addSpecWarnings(ctx, spec)
 }
 
 func (s *Server) listObjects(ctx iris.Context) {
 	// No need to lock.
 
+	r := ReadPagination(ctx)
+	if r == nil {
+		return
+	}
+
 	specs := specList(s._listObjects())
 	// NOTE: Keep it consistent.
 	sort.Sort(specs)
 
-	buff, err := specs.Marshal()
+	names := make([]string, 0, len(specs))
+	for _, spec := range specs {
+		names = append(names, spec.Name())
+	}
+
+	var itemsErr error
+	page := NewPage(r, names, func(start, end int) interface{} {
+		items, err := specs[start:end].maps()
+		if err != nil {
+			itemsErr = err
+		}
+		return items
+	}, s._getObjectTime)
+	if itemsErr != nil {
+		HandleAPIError(ctx, iris.StatusInternalServerError, itemsErr)
+		return
+	}
+
+	buff, err := marshalYAML(page)
 	if err != nil {
-		panic(err)
+		HandleAPIError(ctx, iris.StatusInternalServerError,
+			fmt.Errorf("marshal specs to yaml failed: %v", err))
+		return
 	}
 
 	ctx.Header("Content-Type", "text/vnd.yaml")
@@ -231,9 +264,11 @@ func (s *Server) getStatusObject(ctx iris.Context) {
 	// NOTE: Maybe inconsistent, the object was deleted already here.
 	status := s._getStatusObject(name)
 
-	buff, err := yaml.Marshal(status)
+	buff, err := marshalYAML(status)
 	if err != nil {
-		panic(fmt.Errorf("marshal %#v to yaml failed: %v", status, err))
+		HandleAPIError(ctx, iris.StatusInternalServerError,
+			fmt.Errorf("marshal status to yaml failed: %v", err))
+		return
 	}
 
 	ctx.Header("Content-Type", "text/vnd.yaml")
@@ -243,11 +278,35 @@ func (s *Server) getStatusObject(ctx iris.Context) {
 func (s *Server) listStatusObjects(ctx iris.Context) {
 	// No need to lock.
 
+	r := ReadPagination(ctx)
+	if r == nil {
+		return
+	}
+
 	status := s._listStatusObjects()
 
-	buff, err := yaml.Marshal(status)
+	names := make([]string, 0, len(status))
+	for name := range status {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	page := NewPage(r, names, func(start, end int) interface{} {
+		if !r.Paginated() {
+			return status
+		}
+		items := make(map[string]map[string]interface{}, end-start)
+		for _, name := range names[start:end] {
+			items[name] = status[name]
+		}
+		return items
+	}, s._getObjectTime)
+
+	buff, err := marshalYAML(page)
 	if err != nil {
-		panic(fmt.Errorf("marshal %#v to yaml failed: %v", status, err))
+		HandleAPIError(ctx, iris.StatusInternalServerError,
+			fmt.Errorf("marshal status to yaml failed: %v", err))
+		return
 	}
 
 	ctx.Header("Content-Type", "text/vnd.yaml")
@@ -259,7 +318,8 @@ type specList []*supervisor.Spec
 func (s specList) Less(i, j int) bool { return s[i].Name() < s[j].Name() }
 func (s specList) Len() int           { return len(s) }
 func (s specList) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
-func (s specList) Marshal() ([]byte, error) {
+
+func (s specList) maps() ([]map[string]interface{}, error) {
 	specs := []map[string]interface{}{}
 	for _, spec := range s {
 		var m map[string]interface{}
@@ -270,17 +330,16 @@ func (s specList) Marshal() ([]byte, error) {
 		}
 		specs = append(specs, m)
 	}
-
-	buff, err := yaml.Marshal(specs)
-	if err != nil {
-		return nil, fmt.Errorf("marshal %#v to yaml failed: %v", specs, err)
-	}
-
-	return buff, nil
+	return specs, nil
 }
 
 func (s *Server) listObjectKinds(ctx iris.Context) {
-	kinds := supervisor.ObjectKinds()
+	r := ReadPagination(ctx)
+	if r == nil {
+		return
+	}
+
+	kinds := stringsPage(r, supervisor.ObjectKinds())
 	buff, err := yaml.Marshal(kinds)
 	if err != nil {
 		panic(fmt.Errorf("marshal %#v to yaml failed: %v", kinds, err))
@@ -0,0 +1,125 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/api/pagination"
+
+	"github.com/kataras/iris"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestDeleteObjectPrunesAuditMeta(t *testing.T) {
+	fc := &fakeCluster{kvs: map[string]string{}}
+	fc.kvs[fc.Layout().ConfigObjectKey("demo")] = "name: demo\nkind: DiffTestObject\nport: 10080\n"
+	fc.kvs[fc.Layout().AuditObjectKey("demo")] = "remoteAddr: 127.0.0.1\n"
+	s := &Server{cluster: fc}
+	app := newTestApp(t, func(app *iris.Application) {
+		app.Use(newRecoverer())
+		app.Delete("/objects/{name:string}", s.deleteObject)
+	})
+
+	r := httptest.NewRequest(http.MethodDelete, "/objects/demo", nil)
+	w := serveTestRequest(app, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("want %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if fc.transactions != 1 {
+		t.Errorf("want 1 transaction, got %d", fc.transactions)
+	}
+	if _, exists := fc.kvs[fc.Layout().ConfigObjectKey("demo")]; exists {
+		t.Errorf("want object deleted")
+	}
+	if _, exists := fc.kvs[fc.Layout().AuditObjectKey("demo")]; exists {
+		t.Errorf("want audit metadata deleted")
+	}
+}
+
+func TestListObjectsPagination(t *testing.T) {
+	fc := &fakeCluster{kvs: map[string]string{}}
+	for _, name := range []string{"c", "a", "e", "b", "d"} {
+		fc.kvs[fc.Layout().ConfigObjectKey(name)] = fmt.Sprintf(
+			"name: %s\nkind: DiffTestObject\nport: 10080\n", name)
+	}
+	fc.kvs[fc.Layout().AuditObjectKey("b")] = "time: 2021-06-01T10:00:00Z\n"
+	s := &Server{cluster: fc}
+	app := newTestApp(t, func(app *iris.Application) {
+		app.Use(newRecoverer())
+		app.Get("/objects", s.listObjects)
+	})
+
+	type page struct {
+		Items []struct {
+			Name string `yaml:"name"`
+		} `yaml:"items"`
+		NextCursor string `yaml:"nextCursor"`
+	}
+
+	list := func(query string) *page {
+		w := serveTestRequest(app, httptest.NewRequest(http.MethodGet, "/objects?"+query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("want %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		p := &page{}
+		if err := yaml.Unmarshal(w.Body.Bytes(), p); err != nil {
+			t.Fatalf("unmarshal %s failed: %v", w.Body.String(), err)
+		}
+		return p
+	}
+
+	names := ""
+	query := "limit=2"
+	for i := 0; i < 3; i++ {
+		p := list(query)
+		for _, item := range p.Items {
+			names += item.Name
+		}
+		if i == 0 {
+			name, ts, err := pagination.Decode(p.NextCursor)
+			want := time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+			if err != nil || name != "b" || !ts.Equal(want) {
+				t.Errorf("want cursor of b at %v, got %s %v %v", want, name, ts, err)
+			}
+		}
+		if (i == 2) != (p.NextCursor == "") {
+			t.Fatalf("page %d: unexpected next cursor %q", i, p.NextCursor)
+		}
+		query = "limit=2&cursor=" + p.NextCursor
+	}
+	if names != "abcde" {
+		t.Errorf("want abcde, got %s", names)
+	}
+
+	// The list without pagination parameters is kept.
+	w := serveTestRequest(app, httptest.NewRequest(http.MethodGet, "/objects", nil))
+	specs := []map[string]interface{}{}
+	if err := yaml.Unmarshal(w.Body.Bytes(), &specs); err != nil || len(specs) != 5 {
+		t.Errorf("want 5 specs, got %d: %v", len(specs), err)
+	}
+
+	w = serveTestRequest(app, httptest.NewRequest(http.MethodGet, "/objects?limit=0", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("want %d for invalid limit, got %d", http.StatusBadRequest, w.Code)
+	}
+}
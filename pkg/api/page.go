@@ -0,0 +1,67 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"time"
+
+	"github.com/megaease/easegress/pkg/api/pagination"
+
+	"github.com/kataras/iris"
+)
+
+// ReadPagination parses the pagination parameters of the list request,
+// it writes the error and returns nil if failed.
+func ReadPagination(ctx iris.Context) *pagination.Request {
+	r, err := pagination.ParseRequest(ctx.URLParam("limit"), ctx.URLParam("cursor"))
+	if err != nil {
+		HandleAPIError(ctx, iris.StatusBadRequest, err)
+		return nil
+	}
+	return r
+}
+
+// NewPage returns the page of the items named by the sorted names, the
+// next cursor is made of the last name in the page and its creation time.
+// The items themselves are returned if the list is not paginated.
+func NewPage(r *pagination.Request, names []string,
+	items func(start, end int) interface{}, createdAt func(name string) time.Time) interface{} {
+
+	start, end, more := r.Slice(names)
+	if !r.Paginated() {
+		return items(start, end)
+	}
+
+	page := &pagination.Page{Items: items(start, end)}
+	if more {
+		last := names[end-1]
+		var ts time.Time
+		if createdAt != nil {
+			ts = createdAt(last)
+		}
+		page.NextCursor = pagination.Encode(last, ts)
+	}
+	return page
+}
+
+// stringsPage returns the page of the sorted strings.
+func stringsPage(r *pagination.Request, ss []string) interface{} {
+	return NewPage(r, ss, func(start, end int) interface{} {
+		return ss[start:end]
+	}, nil)
+}
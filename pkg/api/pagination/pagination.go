@@ -0,0 +1,145 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package pagination implements the cursor-based pagination of the list
+// APIs, whose items are ordered by name.
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	// DefaultLimit is the limit of a page requested with a cursor only.
+	DefaultLimit = 100
+	// MaxLimit is the maximum limit of a page.
+	MaxLimit = 1000
+)
+
+type (
+	// Request is the pagination of a list request.
+	Request struct {
+		// Limit is 0 if the list is not paginated.
+		Limit int
+		// After is the name of the last item of the previous page.
+		After string
+	}
+
+	// Page is the response of a paginated list request, NextCursor is
+	// empty on the last page.
+	Page struct {
+		Items      interface{} `yaml:"items" json:"items"`
+		NextCursor string      `yaml:"nextCursor,omitempty" json:"nextCursor,omitempty"`
+	}
+
+	// cursor is encoded in JSON with short keys.
+	cursor struct {
+		Name string `json:"n"`
+		// Time is in unix nanoseconds, 0 means unknown.
+		Time int64 `json:"t,omitempty"`
+	}
+)
+
+// Encode encodes the name and the creation time of the last seen item
+// into an opaque cursor.
+func Encode(name string, ts time.Time) string {
+	c := &cursor{Name: name}
+	if !ts.IsZero() {
+		c.Time = ts.UnixNano()
+	}
+
+	buff, err := json.Marshal(c)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to json failed: %v", c, err))
+	}
+	return base64.RawURLEncoding.EncodeToString(buff)
+}
+
+// Decode decodes the cursor made by Encode.
+func Decode(token string) (name string, ts time.Time, err error) {
+	buff, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("invalid cursor: %v", err)
+	}
+
+	c := &cursor{}
+	if err := json.Unmarshal(buff, c); err != nil {
+		return "", time.Time{}, fmt.Errorf("invalid cursor: %v", err)
+	}
+	if c.Name == "" {
+		return "", time.Time{}, fmt.Errorf("invalid cursor: empty name")
+	}
+
+	if c.Time != 0 {
+		ts = time.Unix(0, c.Time)
+	}
+	return c.Name, ts, nil
+}
+
+// ParseRequest parses the limit and cursor parameters, the list is not
+// paginated if both of them are empty.
+func ParseRequest(limit, token string) (*Request, error) {
+	r := &Request{}
+	if limit == "" && token == "" {
+		return r, nil
+	}
+
+	r.Limit = DefaultLimit
+	if limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > MaxLimit {
+			return nil, fmt.Errorf("invalid limit %s, want 1 to %d", limit, MaxLimit)
+		}
+		r.Limit = n
+	}
+
+	if token != "" {
+		name, _, err := Decode(token)
+		if err != nil {
+			return nil, err
+		}
+		r.After = name
+	}
+
+	return r, nil
+}
+
+// Paginated returns whether the list is paginated.
+func (r *Request) Paginated() bool {
+	return r.Limit > 0
+}
+
+// Slice returns the range [start, end) of the page in the sorted names,
+// and whether there are more items after the page. The page starts after
+// the name in the cursor, even if the item of the name has been deleted.
+func (r *Request) Slice(names []string) (start, end int, more bool) {
+	if !r.Paginated() {
+		return 0, len(names), false
+	}
+
+	start = sort.Search(len(names), func(i int) bool { return names[i] > r.After })
+	end = start + r.Limit
+	if end >= len(names) {
+		return start, len(names), false
+	}
+	return start, end, true
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pagination
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCursor(t *testing.T) {
+	ts := time.Unix(1622541600, 123)
+	token := Encode("pipeline-a", ts)
+	name, got, err := Decode(token)
+	if err != nil || name != "pipeline-a" || !got.Equal(ts) {
+		t.Errorf("want pipeline-a at %v, got %s at %v: %v", ts, name, got, err)
+	}
+
+	name, got, err = Decode(Encode("b", time.Time{}))
+	if err != nil || name != "b" || !got.IsZero() {
+		t.Errorf("want b at zero time, got %s at %v: %v", name, got, err)
+	}
+
+	for _, token := range []string{"!", "bm90IGpzb24", Encode("", ts)} {
+		if _, _, err := Decode(token); err == nil {
+			t.Errorf("want error for cursor %s", token)
+		}
+	}
+}
+
+func TestParseRequest(t *testing.T) {
+	r, err := ParseRequest("", "")
+	if err != nil || r.Paginated() {
+		t.Errorf("want not paginated, got %+v: %v", r, err)
+	}
+
+	r, err = ParseRequest("", Encode("b", time.Time{}))
+	if err != nil || r.Limit != DefaultLimit || r.After != "b" {
+		t.Errorf("want default limit after b, got %+v: %v", r, err)
+	}
+
+	for _, limit := range []string{"0", "-1", "x", "1001"} {
+		if _, err := ParseRequest(limit, ""); err == nil {
+			t.Errorf("want error for limit %s", limit)
+		}
+	}
+}
+
+func TestSlice(t *testing.T) {
+	names := []string{"a", "b", "c", "d", "e"}
+
+	cases := []struct {
+		r          Request
+		start, end int
+		more       bool
+	}{
+		{Request{}, 0, 5, false},
+		{Request{Limit: 2}, 0, 2, true},
+		{Request{Limit: 2, After: "b"}, 2, 4, true},
+		{Request{Limit: 2, After: "c"}, 3, 5, false},
+		// The item of the cursor has been deleted.
+		{Request{Limit: 2, After: "bb"}, 2, 4, true},
+		{Request{Limit: 2, After: "z"}, 5, 5, false},
+	}
+	for i, c := range cases {
+		start, end, more := c.r.Slice(names)
+		if start != c.start || end != c.end || more != c.more {
+			t.Errorf("case %d: want (%d, %d, %v), got (%d, %d, %v)",
+				i, c.start, c.end, c.more, start, end, more)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+
+	"github.com/megaease/easegress/pkg/filter/proxy"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/v"
+
+	"github.com/kataras/iris"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// PipelinePrefix is the prefix of pipeline APIs.
+	PipelinePrefix = "/pipelines"
+
+	// RolloutPrefix is the prefix of rollout APIs, the id is the pipeline name.
+	RolloutPrefix = "/rollouts"
+)
+
+func (s *Server) setupPipelineAPIs() {
+	pipelineAPIs := []*APIEntry{
+		{
+			Path:    PipelinePrefix + "/{name:string}/filters/{filterName:string}/liveupdate",
+			Method:  "POST",
+			Signed:  true,
+			Handler: s.liveUpdateFilter,
+		},
+		{
+			Path:    PipelinePrefix + "/{name:string}/upstreams/{id:string}/draining",
+			Method:  "GET",
+			Handler: s.getUpstreamDraining,
+		},
+		{
+			Path:    RolloutPrefix + "/{name:string}/pause",
+			Method:  "POST",
+			Signed:  true,
+			Handler: s.pauseRollout,
+		},
+		{
+			Path:    RolloutPrefix + "/{name:string}/resume",
+			Method:  "POST",
+			Signed:  true,
+			Handler: s.resumeRollout,
+		},
+	}
+
+	s.RegisterAPIs(pipelineAPIs)
+}
+
+// getPipeline returns the running HTTPPipeline,
+// it writes the error and returns nil if failed.
+func (s *Server) getPipeline(ctx iris.Context, name string) *httppipeline.HTTPPipeline {
+	var instance supervisor.Object
+	exists := false
+	if s.pipelineGetter != nil {
+		instance, exists = s.pipelineGetter(name)
+	} else {
+		var ro *supervisor.RunningObject
+		ro, exists = supervisor.Global.GetRunningObject(name, supervisor.CategoryPipeline)
+		if exists {
+			instance = ro.Instance()
+		}
+	}
+	if !exists {
+		HandleAPIError(ctx, iris.StatusNotFound, fmt.Errorf("pipeline %s not found", name))
+		return nil
+	}
+
+	hp, ok := instance.(*httppipeline.HTTPPipeline)
+	if !ok {
+		HandleAPIError(ctx, iris.StatusBadRequest, fmt.Errorf("%s is not %s", name, httppipeline.Kind))
+		return nil
+	}
+
+	return hp
+}
+
+func (s *Server) liveUpdateFilter(ctx iris.Context) {
+	name, filterName := ctx.Params().Get("name"), ctx.Params().Get("filterName")
+
+	body, err := DecodeBody(ctx)
+	if err != nil {
+		HandleAPIError(ctx, iris.StatusBadRequest, err)
+		return
+	}
+
+	spec := &httppipeline.LiveUpdateSpec{}
+	err = yaml.Unmarshal(body, spec)
+	if err != nil {
+		HandleAPIError(ctx, iris.StatusBadRequest, fmt.Errorf("unmarshal failed: %v", err))
+		return
+	}
+	vr := v.Validate(spec, body)
+	if !vr.Valid() {
+		HandleAPIError(ctx, iris.StatusBadRequest, fmt.Errorf("validate failed: \n%s", vr))
+		return
+	}
+
+	hp := s.getPipeline(ctx, name)
+	if hp == nil {
+		return
+	}
+
+	meta := newAuditMeta(ctx)
+	status, err := hp.StartLiveUpdate(filterName, spec, func(spec *supervisor.Spec) (err error) {
+		// NOTE: It's called in the background, so recover the cluster error.
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("%v", r)
+			}
+		}()
+
+		s.Lock()
+		defer s.Unlock()
+
+		s._putObject(spec, meta)
+		s._plusOneVersion()
+
+		return nil
+	})
+	switch err {
+	case nil:
+	case httppipeline.ErrFilterNotFound:
+		HandleAPIError(ctx, iris.StatusNotFound, fmt.Errorf("filter %s not found", filterName))
+		return
+	case httppipeline.ErrLiveUpdateRunning:
+		HandleAPIError(ctx, iris.StatusConflict, err)
+		return
+	default:
+		HandleAPIError(ctx, iris.StatusBadRequest, err)
+		return
+	}
+
+	buff, err := yaml.Marshal(status)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", status, err))
+	}
+
+	ctx.StatusCode(iris.StatusAccepted)
+	ctx.Header("Content-Type", "text/vnd.yaml")
+	ctx.Write(buff)
+}
+
+// getUpstreamDraining returns the warm-down status of the upstream
+// removed from the Proxy filters, the id is the host of its URL.
+func (s *Server) getUpstreamDraining(ctx iris.Context) {
+	name, id := ctx.Params().Get("name"), ctx.Params().Get("id")
+
+	hp := s.getPipeline(ctx, name)
+	if hp == nil {
+		return
+	}
+
+	for _, filter := range hp.RunningFilters() {
+		p, ok := filter.(*proxy.Proxy)
+		if !ok {
+			continue
+		}
+
+		status, exists := p.DrainingStatus(id)
+		if !exists {
+			continue
+		}
+
+		buff, err := yaml.Marshal(status)
+		if err != nil {
+			panic(fmt.Errorf("marshal %#v to yaml failed: %v", status, err))
+		}
+
+		ctx.Header("Content-Type", "text/vnd.yaml")
+		ctx.Write(buff)
+		return
+	}
+
+	HandleAPIError(ctx, iris.StatusNotFound, fmt.Errorf("upstream %s not removed from pipeline %s", id, name))
+}
+
+func (s *Server) pauseRollout(ctx iris.Context) {
+	s.setRolloutPaused(ctx, true)
+}
+
+func (s *Server) resumeRollout(ctx iris.Context) {
+	s.setRolloutPaused(ctx, false)
+}
+
+func (s *Server) setRolloutPaused(ctx iris.Context, paused bool) {
+	name := ctx.Params().Get("name")
+
+	hp := s.getPipeline(ctx, name)
+	if hp == nil {
+		return
+	}
+
+	var status *httppipeline.RolloutStatus
+	var err error
+	if paused {
+		status, err = hp.PauseRollout()
+	} else {
+		status, err = hp.ResumeRollout()
+	}
+	if err != nil {
+		HandleAPIError(ctx, iris.StatusConflict, fmt.Errorf("pipeline %s: %v", name, err))
+		return
+	}
+
+	buff, err := yaml.Marshal(status)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", status, err))
+	}
+
+	ctx.Header("Content-Type", "text/vnd.yaml")
+	ctx.Write(buff)
+}
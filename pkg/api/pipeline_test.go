@@ -0,0 +1,236 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/tracing"
+
+	"github.com/kataras/iris"
+	yaml "gopkg.in/yaml.v2"
+)
+
+type (
+	pipelineTestFilter struct{}
+
+	pipelineTestSpec struct {
+		Version int `yaml:"version" jsonschema:"omitempty"`
+	}
+)
+
+func init() {
+	httppipeline.Register(&pipelineTestFilter{})
+}
+
+func (f *pipelineTestFilter) Kind() string             { return "PipelineTestFilter" }
+func (f *pipelineTestFilter) DefaultSpec() interface{} { return &pipelineTestSpec{} }
+func (f *pipelineTestFilter) Description() string      { return "" }
+func (f *pipelineTestFilter) Results() []string        { return nil }
+func (f *pipelineTestFilter) Status() interface{}      { return nil }
+func (f *pipelineTestFilter) Close()                   {}
+func (f *pipelineTestFilter) Init(filterSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+}
+func (f *pipelineTestFilter) Inherit(filterSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+}
+func (f *pipelineTestFilter) Handle(ctx context.HTTPContext) string {
+	return ctx.CallNextHandler("")
+}
+
+func newPipelineTestServer(t *testing.T) (*Server, *fakeCluster, *httppipeline.HTTPPipeline) {
+	superSpec, err := supervisor.NewSpec(`
+name: pipeline
+kind: HTTPPipeline
+filters:
+- name: filter
+  kind: PipelineTestFilter
+`)
+	if err != nil {
+		t.Fatalf("new spec failed: %v", err)
+	}
+	hp := &httppipeline.HTTPPipeline{}
+	hp.Init(superSpec, nil)
+
+	fc := &fakeCluster{kvs: map[string]string{}}
+	s := &Server{
+		cluster: fc,
+		pipelineGetter: func(name string) (supervisor.Object, bool) {
+			if name != "pipeline" {
+				return nil, false
+			}
+			return hp, true
+		},
+	}
+
+	return s, fc, hp
+}
+
+func TestLiveUpdateFilter(t *testing.T) {
+	s, fc, hp := newPipelineTestServer(t)
+	defer hp.Close()
+
+	app := newTestApp(t, func(app *iris.Application) {
+		app.Use(newRecoverer())
+		app.Post(PipelinePrefix+"/{name:string}/filters/{filterName:string}/liveupdate", s.liveUpdateFilter)
+	})
+
+	liveUpdate := func(pipeline, filter, body string) *httptest.ResponseRecorder {
+		path := PipelinePrefix + "/" + pipeline + "/filters/" + filter + "/liveupdate"
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		return serveTestRequest(app, r)
+	}
+
+	spec := func(filter string) string {
+		return `
+filter:
+  name: ` + filter + `
+  kind: PipelineTestFilter
+  version: 2
+shadow:
+  probability:
+    perMill: 1000
+    policy: random
+window: 200ms
+minSamples: 1
+`
+	}
+
+	for _, c := range []struct {
+		pipeline string
+		filter   string
+		body     string
+		code     int
+	}{
+		{"pipeline", "filter", "filter: {name: filter, kind: PipelineTestFilter}", http.StatusBadRequest},
+		{"absent", "filter", spec("filter"), http.StatusNotFound},
+		{"pipeline", "absent", spec("absent"), http.StatusNotFound},
+		{"pipeline", "filter", spec("other"), http.StatusBadRequest},
+	} {
+		w := liveUpdate(c.pipeline, c.filter, c.body)
+		if w.Code != c.code {
+			t.Errorf("%s/%s: want %d, got %d: %s", c.pipeline, c.filter, c.code, w.Code, w.Body.String())
+		}
+	}
+
+	w := liveUpdate("pipeline", "filter", spec("filter"))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("want %d, got %d: %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+	status := &httppipeline.LiveUpdateStatus{}
+	err := yaml.Unmarshal(w.Body.Bytes(), status)
+	if err != nil || status.State != httppipeline.LiveUpdateRunning {
+		t.Errorf("want running status, got %s: %v", w.Body.String(), err)
+	}
+
+	w = liveUpdate("pipeline", "filter", spec("filter"))
+	if w.Code != http.StatusConflict {
+		t.Errorf("want %d, got %d: %s", http.StatusConflict, w.Code, w.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	ctx := context.New(httptest.NewRecorder(), req, tracing.NoopTracing, "no trace")
+	hp.Handle(ctx)
+	ctx.Finish()
+
+	// NOTE: The promotion puts the pipeline spec with the audit metadata.
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		s.Lock()
+		value, promoted := fc.kvs[fc.Layout().ConfigObjectKey("pipeline")]
+		_, audited := fc.kvs[fc.Layout().AuditObjectKey("pipeline")]
+		s.Unlock()
+
+		if promoted {
+			if !strings.Contains(value, "version: 2") || !audited {
+				t.Errorf("want promoted spec with audit metadata, got %q", value)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("want promoted, got %+v", hp.Status())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPauseResumeRollout(t *testing.T) {
+	s, _, hp := newPipelineTestServer(t)
+	defer hp.Close()
+
+	app := newTestApp(t, func(app *iris.Application) {
+		app.Use(newRecoverer())
+		app.Post(RolloutPrefix+"/{name:string}/pause", s.pauseRollout)
+		app.Post(RolloutPrefix+"/{name:string}/resume", s.resumeRollout)
+	})
+
+	post := func(name, action string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, RolloutPrefix+"/"+name+"/"+action, nil)
+		return serveTestRequest(app, r)
+	}
+
+	if w := post("absent", "pause"); w.Code != http.StatusNotFound {
+		t.Errorf("want %d, got %d: %s", http.StatusNotFound, w.Code, w.Body.String())
+	}
+	if w := post("pipeline", "pause"); w.Code != http.StatusConflict {
+		t.Errorf("want %d, got %d: %s", http.StatusConflict, w.Code, w.Body.String())
+	}
+
+	superSpec, err := supervisor.NewSpec(`
+name: pipeline
+kind: HTTPPipeline
+filters:
+- name: filter
+  kind: PipelineTestFilter
+  version: 2
+progressiveRollout:
+  steps: [10%, 100%]
+  stepInterval: 1h
+`)
+	if err != nil {
+		t.Fatalf("new spec failed: %v", err)
+	}
+	next := &httppipeline.HTTPPipeline{}
+	next.Inherit(superSpec, hp, nil)
+	defer next.Close()
+	s.pipelineGetter = func(name string) (supervisor.Object, bool) {
+		return next, name == "pipeline"
+	}
+
+	for _, c := range []struct {
+		action string
+		state  string
+	}{
+		{"pause", httppipeline.RolloutPaused},
+		{"resume", httppipeline.RolloutRunning},
+	} {
+		w := post("pipeline", c.action)
+		status := &httppipeline.RolloutStatus{}
+		err := yaml.Unmarshal(w.Body.Bytes(), status)
+		if w.Code != http.StatusOK || err != nil || status.State != c.state {
+			t.Errorf("%s: want %s, got %d: %s", c.action, c.state, w.Code, w.Body.String())
+		}
+	}
+}
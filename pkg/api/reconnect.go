@@ -0,0 +1,47 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/megaease/easegress/pkg/logger"
+
+	"github.com/kataras/iris"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// reconnect re-establishes the connection to the cluster, which helps
+// to pick up the new addresses of the members after failover.
+func (s *Server) reconnect(ctx iris.Context) {
+	status, err := s.cluster.Reconnect()
+	if err != nil {
+		HandleAPIError(ctx, http.StatusServiceUnavailable, fmt.Errorf("reconnect failed: %v", err))
+		return
+	}
+	logger.Infof("cluster reconnected by %s: %+v", ctx.RemoteAddr(), status)
+
+	buff, err := yaml.Marshal(status)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", status, err))
+	}
+
+	ctx.Header("Content-Type", "text/vnd.yaml")
+	ctx.Write(buff)
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/cluster"
+
+	"github.com/kataras/iris"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// reconnectTestCluster connects with the endpoints at the time of reconnecting.
+type reconnectTestCluster struct {
+	cluster.Cluster
+	endpoints []string
+	err       error
+}
+
+func (c *reconnectTestCluster) Reconnect() (*cluster.ConnectionStatus, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &cluster.ConnectionStatus{Endpoints: c.endpoints, Connected: true}, nil
+}
+
+func TestReconnect(t *testing.T) {
+	c := &reconnectTestCluster{endpoints: []string{"http://10.0.0.1:2380"}}
+	s := &Server{cluster: c, debugToken: "secret"}
+	app := newTestApp(t, func(app *iris.Application) {
+		app.Post("/admin/reconnect", s.debugAuth(s.reconnect))
+	})
+
+	reconnect := func(token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/admin/reconnect", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		return serveTestRequest(app, r)
+	}
+
+	if w := reconnect("wrong"); w.Code != http.StatusUnauthorized {
+		t.Errorf("want %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	// NOTE: The member moved to the new address after failover.
+	c.endpoints = []string{"http://10.0.0.2:2380"}
+	w := reconnect("secret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("want %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+	status := &cluster.ConnectionStatus{}
+	err := yaml.Unmarshal(w.Body.Bytes(), status)
+	if err != nil {
+		t.Fatalf("unmarshal %s failed: %v", w.Body, err)
+	}
+	if !status.Connected || len(status.Endpoints) != 1 || status.Endpoints[0] != "http://10.0.0.2:2380" {
+		t.Errorf("want connected to the new endpoint, got %+v", status)
+	}
+
+	c.err = fmt.Errorf("cluster not ready")
+	if w := reconnect("secret"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("want %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+}
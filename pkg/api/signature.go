@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kataras/iris"
+)
+
+const (
+	// SignatureTimestampHeader is the header of the unix seconds
+	// when the request of a signed API is signed.
+	SignatureTimestampHeader = "X-Easegress-Timestamp"
+	// SignatureHeader is the header of the signature of
+	// the request of a signed API, see Sign.
+	SignatureHeader = "X-Easegress-Signature"
+)
+
+// Sign returns the hex-encoded HMAC-SHA256 of the method, the path with
+// query, the timestamp and the body joined by newlines, which is the
+// signature of the request of a signed API.
+func Sign(secret []byte, method, requestURI, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(method + "\n" + requestURI + "\n" + timestamp + "\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signatureAuth wraps the handler of signed APIs to verify the signature,
+// it rejects the request if the timestamp is out of the tolerance to stop
+// replaying. The signatures are not verified if there is no secret configured.
+func (s *Server) signatureAuth(handler iris.Handler) iris.Handler {
+	return func(ctx iris.Context) {
+		if len(s.signingSecret) == 0 {
+			handler(ctx)
+			return
+		}
+
+		timestamp := ctx.GetHeader(SignatureTimestampHeader)
+		seconds, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			HandleAPIError(ctx, http.StatusUnauthorized,
+				fmt.Errorf("invalid %s: %q", SignatureTimestampHeader, timestamp))
+			return
+		}
+
+		skew := time.Since(time.Unix(seconds, 0))
+		if skew < 0 {
+			skew = -skew
+		}
+		if skew > s.signingTolerance {
+			HandleAPIError(ctx, http.StatusUnauthorized,
+				fmt.Errorf("timestamp %s is out of tolerance %v", timestamp, s.signingTolerance))
+			return
+		}
+
+		body, err := ioutil.ReadAll(ctx.Request().Body)
+		if err != nil {
+			HandleAPIError(ctx, http.StatusBadRequest, fmt.Errorf("read body failed: %v", err))
+			return
+		}
+		ctx.Request().Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		want := Sign(s.signingSecret, ctx.Method(), ctx.Request().URL.RequestURI(), timestamp, body)
+		if !hmac.Equal([]byte(ctx.GetHeader(SignatureHeader)), []byte(want)) {
+			HandleAPIError(ctx, http.StatusUnauthorized, fmt.Errorf("invalid signature"))
+			return
+		}
+
+		handler(ctx)
+	}
+}
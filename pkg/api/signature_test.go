@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kataras/iris"
+)
+
+func TestSignatureAuth(t *testing.T) {
+	secret := []byte("secret")
+	s := &Server{signingSecret: secret, signingTolerance: time.Minute}
+	app := newTestApp(t, func(app *iris.Application) {
+		app.Post("/objects", s.signatureAuth(func(ctx iris.Context) {
+			// NOTE: The body is still readable after verified.
+			body, _ := ioutil.ReadAll(ctx.Request().Body)
+			ctx.Write(body)
+		}))
+	})
+
+	request := func(signedBody, body string, signedAt time.Time) *httptest.ResponseRecorder {
+		timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+		r := httptest.NewRequest(http.MethodPost, "/objects?force=true", strings.NewReader(body))
+		r.Header.Set(SignatureTimestampHeader, timestamp)
+		r.Header.Set(SignatureHeader,
+			Sign(secret, http.MethodPost, "/objects?force=true", timestamp, []byte(signedBody)))
+		return serveTestRequest(app, r)
+	}
+
+	w := request("name: demo", "name: demo", time.Now())
+	if w.Code != http.StatusOK || w.Body.String() != "name: demo" {
+		t.Errorf("valid signature: want %d with body, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	w = request("name: demo", "name: demo", time.Now().Add(-2*time.Minute))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expired timestamp: want %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	w = request("name: demo", "name: evil", time.Now())
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("tampered body: want %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/objects", strings.NewReader("name: demo"))
+	w = serveTestRequest(app, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("unsigned: want %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+func TestSignatureAuthDisabled(t *testing.T) {
+	s := &Server{}
+	app := newTestApp(t, func(app *iris.Application) {
+		app.Post("/objects", s.signatureAuth(func(ctx iris.Context) {}))
+	})
+
+	r := httptest.NewRequest(http.MethodPost, "/objects", strings.NewReader("name: demo"))
+	w := serveTestRequest(app, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("want %d without secret, got %d", http.StatusOK, w.Code)
+	}
+}
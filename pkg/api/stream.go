@@ -0,0 +1,52 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/kataras/iris"
+)
+
+// newStreamSlots returns the slots of streaming connections,
+// it's nil if they are unlimited.
+func newStreamSlots(max int) chan struct{} {
+	if max <= 0 {
+		return nil
+	}
+	return make(chan struct{}, max)
+}
+
+// acquireStream takes a slot for the streaming connection, which holds
+// it until the returned release is called. It's apart from the limits of
+// requests, the error is written and nil is returned if all are taken.
+func (s *Server) acquireStream(ctx iris.Context) (release func()) {
+	if s.streams == nil {
+		return func() {}
+	}
+
+	select {
+	case s.streams <- struct{}{}:
+		return func() { <-s.streams }
+	default:
+		HandleAPIError(ctx, http.StatusServiceUnavailable,
+			fmt.Errorf("too many streaming connections, max %d", cap(s.streams)))
+		return nil
+	}
+}
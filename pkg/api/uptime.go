@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kataras/iris"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// restartCountFile persists the restart count in the home dir,
+	// which survives the cleaning of the data dir.
+	restartCountFile = "restart_count"
+)
+
+type (
+	// Uptime is the response of uptime API.
+	Uptime struct {
+		StartTime string `yaml:"startTime"`
+		Uptime    string `yaml:"uptime"`
+		// RestartCount is absent if it failed to persist the count.
+		RestartCount *uint64 `yaml:"restartCount,omitempty"`
+	}
+)
+
+// countRestart increases the persisted restart count and returns it,
+// the first start counts zero.
+func countRestart(homeDir string) (uint64, error) {
+	path := filepath.Join(homeDir, restartCountFile)
+
+	var count uint64
+	buff, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return 0, fmt.Errorf("read %s failed: %v", path, err)
+	default:
+		count, err = strconv.ParseUint(strings.TrimSpace(string(buff)), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("parse %s failed: %v", path, err)
+		}
+		count++
+	}
+
+	err = ioutil.WriteFile(path, []byte(strconv.FormatUint(count, 10)), 0644)
+	if err != nil {
+		return 0, fmt.Errorf("write %s failed: %v", path, err)
+	}
+
+	return count, nil
+}
+
+func (s *Server) getUptime(ctx iris.Context) {
+	uptime := &Uptime{
+		StartTime:    s.startTime.Format(time.RFC3339),
+		Uptime:       time.Since(s.startTime).String(),
+		RestartCount: s.restartCount,
+	}
+
+	buff, err := yaml.Marshal(uptime)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", uptime, err))
+	}
+
+	ctx.Header("Content-Type", "text/vnd.yaml")
+	ctx.Write(buff)
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kataras/iris"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestCountRestart(t *testing.T) {
+	dir := t.TempDir()
+	for i := uint64(0); i < 3; i++ {
+		count, err := countRestart(dir)
+		if err != nil {
+			t.Fatalf("count restart failed: %v", err)
+		}
+		if count != i {
+			t.Fatalf("want restart count %d, got %d", i, count)
+		}
+	}
+}
+
+func TestGetUptime(t *testing.T) {
+	restartCount := uint64(2)
+	s := &Server{
+		debugToken:   "secret",
+		startTime:    time.Now(),
+		restartCount: &restartCount,
+	}
+	app := newTestApp(t, func(app *iris.Application) {
+		app.Get("/debug/uptime", s.debugAuth(s.getUptime))
+	})
+
+	getUptime := func() (*Uptime, time.Duration) {
+		r := httptest.NewRequest(http.MethodGet, "/debug/uptime", nil)
+		r.Header.Set("Authorization", "Bearer secret")
+		w := serveTestRequest(app, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("want %d, got %d", http.StatusOK, w.Code)
+		}
+
+		uptime := &Uptime{}
+		err := yaml.Unmarshal(w.Body.Bytes(), uptime)
+		if err != nil {
+			t.Fatalf("unmarshal %s failed: %v", w.Body.String(), err)
+		}
+		d, err := time.ParseDuration(uptime.Uptime)
+		if err != nil {
+			t.Fatalf("parse uptime %s failed: %v", uptime.Uptime, err)
+		}
+		return uptime, d
+	}
+
+	first, d1 := getUptime()
+	time.Sleep(10 * time.Millisecond)
+	second, d2 := getUptime()
+
+	if d2 <= d1 {
+		t.Errorf("want uptime increased, got %s then %s", d1, d2)
+	}
+	if first.StartTime != second.StartTime {
+		t.Errorf("want the same start time, got %s and %s", first.StartTime, second.StartTime)
+	}
+	if second.RestartCount == nil || *second.RestartCount != 2 {
+		t.Errorf("want restart count 2, got %v", second.RestartCount)
+	}
+}
@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+
+	"github.com/kataras/iris"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// WarningHeader is the header of the warnings of successful responses.
+const WarningHeader = "Warning"
+
+// AddWarning attaches the warning to the response without failing it, as
+// a Warning header of RFC 7234 with the code 299 (miscellaneous persistent
+// warning), it's called once per warning.
+func AddWarning(ctx iris.Context, format string, args ...interface{}) {
+	warning := fmt.Sprintf(format, args...)
+	ctx.ResponseWriter().Header().Add(WarningHeader, "299 - "+strconv.Quote(warning))
+}
+
+// addSpecWarnings warns the top-level fields of the spec which are ignored.
+func addSpecWarnings(ctx iris.Context, spec *supervisor.Spec) {
+	for _, field := range unknownFields(spec) {
+		AddWarning(ctx, "unknown field %s is ignored", field)
+	}
+}
+
+// unknownFields returns the top-level fields of the spec unknown to
+// its kind, nil if the object spec isn't a struct.
+func unknownFields(spec *supervisor.Spec) []string {
+	known := yamlFields(reflect.TypeOf(spec.ObjectSpec()))
+	if known == nil {
+		return nil
+	}
+	for field := range yamlFields(reflect.TypeOf(supervisor.MetaSpec{})) {
+		known[field] = struct{}{}
+	}
+
+	var whole map[string]interface{}
+	if err := yaml.Unmarshal([]byte(spec.YAMLConfig()), &whole); err != nil {
+		return nil
+	}
+
+	var unknown []string
+	for field := range whole {
+		if _, exists := known[field]; !exists {
+			unknown = append(unknown, field)
+		}
+	}
+	sort.Strings(unknown)
+
+	return unknown
+}
+
+// yamlFields returns the fields of the struct by the rules of yaml.v2,
+// nil if it's not a struct.
+func yamlFields(t reflect.Type) map[string]struct{} {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	fields := make(map[string]struct{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+
+		tag := f.Tag.Get("yaml")
+		if tag == "-" {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		if stringtool.StrInSlice("inline", parts[1:]) {
+			for field := range yamlFields(f.Type) {
+				fields[field] = struct{}{}
+			}
+			continue
+		}
+
+		name := parts[0]
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = struct{}{}
+	}
+
+	return fields
+}
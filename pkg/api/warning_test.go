@@ -0,0 +1,80 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kataras/iris"
+)
+
+func TestAddWarning(t *testing.T) {
+	app := newTestApp(t, func(app *iris.Application) {
+		app.Get("/warned", func(ctx iris.Context) {
+			AddWarning(ctx, "field %s is deprecated", "hosts")
+			AddWarning(ctx, `default "30s" applied`)
+			ctx.WriteString("ok")
+		})
+	})
+
+	w := serveTestRequest(app, httptest.NewRequest(http.MethodGet, "/warned", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "ok" {
+		t.Fatalf("want %d ok, got %d %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	want := []string{`299 - "field hosts is deprecated"`, `299 - "default \"30s\" applied"`}
+	if got := w.Header()[WarningHeader]; !reflect.DeepEqual(got, want) {
+		t.Errorf("want warnings %q, got %q", want, got)
+	}
+}
+
+func TestObjectWarnings(t *testing.T) {
+	fc := &fakeCluster{kvs: map[string]string{}}
+	s := &Server{cluster: fc}
+	app := newTestApp(t, func(app *iris.Application) {
+		app.Use(newRecoverer())
+		app.Post("/objects", s.createObject)
+		app.Put("/objects/{name:string}", s.updateObject)
+	})
+
+	spec := "name: demo\nkind: DiffTestObject\nport: 10080\nretries: 3\nweight: 1\n"
+	w := serveTestRequest(app, httptest.NewRequest(http.MethodPost, "/objects", strings.NewReader(spec)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("want %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	want := []string{`299 - "unknown field retries is ignored"`, `299 - "unknown field weight is ignored"`}
+	if got := w.Header()[WarningHeader]; !reflect.DeepEqual(got, want) {
+		t.Errorf("want warnings %q, got %q", want, got)
+	}
+
+	spec = "name: demo\nkind: DiffTestObject\nport: 10080\n"
+	w = serveTestRequest(app, httptest.NewRequest(http.MethodPut, "/objects/demo", strings.NewReader(spec)))
+	if w.Code != http.StatusOK || len(w.Header()[WarningHeader]) != 0 {
+		t.Errorf("want %d without warnings, got %d %q", http.StatusOK, w.Code, w.Header()[WarningHeader])
+	}
+
+	w = serveTestRequest(app, httptest.NewRequest(http.MethodPut, "/objects/demo", strings.NewReader(spec)))
+	want = []string{`299 - "spec of demo is unchanged"`}
+	if got := w.Header()[WarningHeader]; w.Code != http.StatusOK || !reflect.DeepEqual(got, want) {
+		t.Errorf("want %d with warnings %q, got %d %q", http.StatusOK, want, w.Code, got)
+	}
+}
@@ -375,10 +375,7 @@ func (c *cluster) getClient() (*clientv3.Client, error) {
 		return c.client, nil
 	}
 
-	endpoints := c.members.knownPeerURLs()
-	if c.opt.ForceNewCluster {
-		endpoints = []string{c.members.self().PeerURL}
-	}
+	endpoints := c.clientEndpoints()
 	logger.Infof("client connect with endpoints: %v", endpoints)
 	client, err := clientv3.New(clientv3.Config{
 		Endpoints:            endpoints,
@@ -400,6 +397,13 @@ func (c *cluster) getClient() (*clientv3.Client, error) {
 	return client, nil
 }
 
+func (c *cluster) clientEndpoints() []string {
+	if c.opt.ForceNewCluster {
+		return []string{c.members.self().PeerURL}
+	}
+	return c.members.knownPeerURLs()
+}
+
 func (c *cluster) closeClient() {
 	c.clientMutex.Lock()
 	defer c.clientMutex.Unlock()
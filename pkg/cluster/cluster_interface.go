@@ -48,6 +48,8 @@ type (
 
 		Mutex(name string) (Mutex, error)
 
+		Reconnect() (*ConnectionStatus, error)
+
 		CloseServer(wg *sync.WaitGroup)
 		StartServer() (chan struct{}, chan struct{}, error)
 
@@ -62,6 +64,7 @@ type (
 		WatchPrefix(prefix string) (<-chan map[string]*string, error)
 		WatchRaw(key string) (<-chan *clientv3.Event, error)
 		WatchRawPrefix(prefix string) (<-chan map[string]*clientv3.Event, error)
+		WatchRawPrefixEvents(prefix string) (<-chan []*clientv3.Event, error)
 		Close()
 	}
 )
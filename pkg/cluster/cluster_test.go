@@ -73,3 +73,41 @@ func TestCluster(t *testing.T) {
 	clusters := mockClusters(5)
 	defer closeClusters(clusters)
 }
+
+func TestReconnect(t *testing.T) {
+	clusters := mockClusters(1)
+	defer closeClusters(clusters)
+	c := clusters[0]
+
+	watcher, err := c.Watcher()
+	if err != nil {
+		t.Fatalf("get watcher failed: %v", err)
+	}
+	defer watcher.Close()
+	values, err := watcher.Watch("/reconnect")
+	if err != nil {
+		t.Fatalf("watch failed: %v", err)
+	}
+
+	status, err := c.Reconnect()
+	if err != nil {
+		t.Fatalf("reconnect failed: %v", err)
+	}
+	if !status.Connected || fmt.Sprint(status.Endpoints) != fmt.Sprint(c.clientEndpoints()) {
+		t.Fatalf("want connected with %v, got %+v", c.clientEndpoints(), status)
+	}
+
+	// NOTE: The watchers on the client survive reconnecting.
+	err = c.Put("/reconnect", "value")
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	select {
+	case value := <-values:
+		if value == nil || *value != "value" {
+			t.Errorf("want value, got %v", value)
+		}
+	case <-time.After(10 * time.Second):
+		t.Errorf("want the change watched after reconnecting")
+	}
+}
@@ -32,6 +32,8 @@ const (
 	configObjectPrefix       = "/config/objects/"
 	configObjectFormat       = "/config/objects/%s" // +objectName
 	configVersion            = "/config/version"
+	auditObjectPrefix        = "/audit/objects/"
+	auditObjectFormat        = "/audit/objects/%s" // +objectName
 
 	// the cluster name of this eg group will be registered under this path in etcd
 	// any new member(reader or writer ) will be rejected if it is configured a different cluster name
@@ -116,3 +118,13 @@ func (l *Layout) ConfigObjectKey(name string) string {
 func (l *Layout) ConfigVersion() string {
 	return configVersion
 }
+
+// AuditObjectPrefix returns the prefix of object audit metadata.
+func (l *Layout) AuditObjectPrefix() string {
+	return auditObjectPrefix
+}
+
+// AuditObjectKey returns the key of object audit metadata.
+func (l *Layout) AuditObjectKey(name string) string {
+	return fmt.Sprintf(auditObjectFormat, name)
+}
@@ -0,0 +1,58 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+// ConnectionStatus is the status of the client connection to the cluster.
+type ConnectionStatus struct {
+	Endpoints []string `yaml:"endpoints"`
+	Connected bool     `yaml:"connected"`
+	Error     string   `yaml:"error,omitempty"`
+}
+
+// Reconnect drops the connections of the client, then connects with the
+// latest known endpoints, whose host names are resolved again. The client
+// itself is kept, so the watchers and syncers on it survive reconnecting.
+func (c *cluster) Reconnect() (*ConnectionStatus, error) {
+	client, err := c.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints := c.clientEndpoints()
+	logger.Infof("client reconnect with endpoints: %v", endpoints)
+
+	// NOTE: Clear the endpoints first, otherwise the connections
+	// to the unchanged endpoints are kept.
+	client.SetEndpoints()
+	client.SetEndpoints(endpoints...)
+
+	status := &ConnectionStatus{Endpoints: client.Endpoints()}
+	_, err = client.MemberList(c.requestContext())
+	if err != nil {
+		logger.Errorf("client reconnect failed: %v", err)
+		status.Error = err.Error()
+	} else {
+		status.Connected = true
+	}
+
+	return status, nil
+}
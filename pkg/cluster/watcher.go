@@ -220,6 +220,39 @@ func (w *watcher) WatchRawPrefix(prefix string) (<-chan map[string]*clientv3.Eve
 	return prefixChan, nil
 }
 
+// WatchRawPrefixEvents sends all events of one watch response together,
+// in the order of their revisions. Unlike WatchRawPrefix, events of the
+// same transaction stay in one batch and DELETE events keep their revisions.
+func (w *watcher) WatchRawPrefixEvents(prefix string) (<-chan []*clientv3.Event, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	watchResp := w.w.Watch(ctx, prefix, clientv3.WithPrefix())
+
+	eventsChan := make(chan []*clientv3.Event, 10)
+
+	go func() {
+		defer cancel()
+		defer close(eventsChan)
+
+		for {
+			select {
+			case <-w.done:
+				return
+			case resp := <-watchResp:
+				if resp.Canceled {
+					logger.Errorf("watch raw prefix events %s canceled: %v", prefix, resp.Err())
+					return
+				}
+				if resp.IsProgressNotify() || len(resp.Events) == 0 {
+					continue
+				}
+				eventsChan <- resp.Events
+			}
+		}
+	}()
+
+	return eventsChan, nil
+}
+
 func (w *watcher) Close() {
 	close(w.done)
 
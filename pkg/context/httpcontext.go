@@ -18,9 +18,11 @@
 package context
 
 import (
+	"bufio"
 	stdcontext "context"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"runtime/debug"
 	"strings"
@@ -74,6 +76,12 @@ type (
 
 		CallNextHandler(lastResult string) string
 		SetHandlerCaller(caller HandlerCaller)
+
+		// Set and Get access the variables shared by all filters,
+		// which are released once the context finished.
+		// The built-in variables are the Var* ones.
+		Set(key string, value interface{})
+		Get(key string) (interface{}, bool)
 	}
 
 	// HTTPRequest is all operations for HTTP request.
@@ -120,8 +128,17 @@ type (
 		Body() io.Reader
 		OnFlushBody(func(body []byte, complete bool) (newBody []byte))
 
+		// AddPushPromise adds an HTTP/2 push promise, which is pushed
+		// after the headers of the response are written.
+		AddPushPromise(promise *PushPromise)
+		PushPromises() []*PushPromise
+
 		Std() http.ResponseWriter
 
+		// Hijack takes over the underlying connection, after which
+		// nothing is written to the client when the context finishes.
+		Hijack() (net.Conn, *bufio.ReadWriter, error)
+
 		Size() uint64 // bytes
 	}
 
@@ -137,6 +154,7 @@ type (
 		finishFuncs []FinishFunc
 		tags        []string
 		caller      HandlerCaller
+		vars        map[string]interface{}
 
 		r *httpRequest
 		w *httpResponse
@@ -281,6 +299,8 @@ func (ctx *httpContext) Finish() {
 	}
 
 	logger.HTTPAccess(ctx.Log())
+
+	ctx.vars = nil
 }
 
 func (ctx *httpContext) StatMetric() *httpstat.Metric {
@@ -18,8 +18,11 @@
 package context
 
 import (
+	"bufio"
 	"bytes"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os"
 	"strconv"
@@ -38,6 +41,12 @@ type (
 	// when body is flushing.
 	BodyFlushFunc = func(body []byte, complete bool) (newBody []byte)
 
+	// PushPromise is an HTTP/2 server push promise.
+	PushPromise struct {
+		Path   string
+		Header http.Header
+	}
+
 	httpResponse struct {
 		stdr *http.Request
 		std  http.ResponseWriter
@@ -48,6 +57,10 @@ type (
 		body           io.Reader
 		bodyWritten    uint64
 		bodyFlushFuncs []BodyFlushFunc
+
+		pushPromises []*PushPromise
+
+		hijacked bool
 	}
 )
 
@@ -89,6 +102,37 @@ func (w *httpResponse) OnFlushBody(fn BodyFlushFunc) {
 	w.bodyFlushFuncs = append(w.bodyFlushFuncs, fn)
 }
 
+func (w *httpResponse) AddPushPromise(promise *PushPromise) {
+	w.pushPromises = append(w.pushPromises, promise)
+}
+
+func (w *httpResponse) PushPromises() []*PushPromise {
+	return w.pushPromises
+}
+
+func (w *httpResponse) push() {
+	if len(w.pushPromises) == 0 {
+		return
+	}
+
+	pusher, ok := w.std.(http.Pusher)
+	if !ok {
+		logger.Debugf("push promises ignored: %s doesn't support server push", w.stdr.Proto)
+		return
+	}
+
+	for _, p := range w.pushPromises {
+		err := pusher.Push(p.Path, &http.PushOptions{Header: p.Header})
+		if err == http.ErrNotSupported {
+			// NOTE: The client disabled server push.
+			return
+		}
+		if err != nil {
+			logger.Warnf("push %s failed: %v", p.Path, err)
+		}
+	}
+}
+
 func (w *httpResponse) flushBody() {
 	if w.body == nil {
 		return
@@ -162,8 +206,15 @@ func (w *httpResponse) FlushedBodyBytes() uint64 {
 }
 
 func (w *httpResponse) finish() {
+	if w.hijacked {
+		return
+	}
+
 	// NOTE: WriteHeader must be called at most one time.
 	w.std.WriteHeader(w.StatusCode())
+	// NOTE: Push promises must be sent before the body,
+	// so the client knows not to request the resources itself.
+	w.push()
 	w.flushBody()
 }
 
@@ -184,3 +235,18 @@ func (w *httpResponse) Size() uint64 {
 func (w *httpResponse) Std() http.ResponseWriter {
 	return w.std
 }
+
+func (w *httpResponse) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.std.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s doesn't support hijacking", w.stdr.Proto)
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	w.hijacked = true
+	return conn, rw, nil
+}
@@ -0,0 +1,138 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package context
+
+import (
+	"bytes"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
+	"github.com/megaease/easegress/pkg/tracing"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+func TestMain(m *testing.M) {
+	tempDir, err := os.MkdirTemp("", "eg-context-test")
+	if err != nil {
+		panic(err)
+	}
+	absLogDir := filepath.Join(tempDir, "log")
+	os.MkdirAll(absLogDir, 0755)
+	logger.Init(&option.Options{
+		Name:      "context-for-log",
+		AbsLogDir: absLogDir,
+	})
+
+	code := m.Run()
+
+	logger.Sync()
+	os.RemoveAll(tempDir)
+
+	os.Exit(code)
+}
+
+func TestPushPromisesBeforeBody(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/style.css" {
+			w.Write([]byte("body{}"))
+			return
+		}
+
+		ctx := New(w, r, tracing.NoopTracing, "test")
+		ctx.Response().AddPushPromise(&PushPromise{Path: "/style.css"})
+		ctx.Response().SetBody(strings.NewReader(`<link rel="stylesheet" href="/style.css">`))
+		ctx.Finish()
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	addr := server.Listener.Addr().String()
+	conn, err := tls.Dial("tcp", addr, &tls.Config{
+		InsecureSkipVerify: true,
+		NextProtos:         []string{http2.NextProtoTLS},
+	})
+	if err != nil {
+		t.Fatalf("dial %s failed: %v", addr, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// NOTE: The standard client doesn't accept server push,
+	// so we talk to the server with raw frames.
+	if _, err := conn.Write([]byte(http2.ClientPreface)); err != nil {
+		t.Fatalf("write preface failed: %v", err)
+	}
+	framer := http2.NewFramer(conn, conn)
+	if err := framer.WriteSettings(); err != nil {
+		t.Fatalf("write settings failed: %v", err)
+	}
+
+	buff := bytes.NewBuffer(nil)
+	encoder := hpack.NewEncoder(buff)
+	encoder.WriteField(hpack.HeaderField{Name: ":method", Value: "GET"})
+	encoder.WriteField(hpack.HeaderField{Name: ":scheme", Value: "https"})
+	encoder.WriteField(hpack.HeaderField{Name: ":authority", Value: addr})
+	encoder.WriteField(hpack.HeaderField{Name: ":path", Value: "/"})
+	err = framer.WriteHeaders(http2.HeadersFrameParam{
+		StreamID:      1,
+		BlockFragment: buff.Bytes(),
+		EndStream:     true,
+		EndHeaders:    true,
+	})
+	if err != nil {
+		t.Fatalf("write headers failed: %v", err)
+	}
+
+	pushed := false
+	for {
+		frame, err := framer.ReadFrame()
+		if err != nil {
+			t.Fatalf("read frame failed: %v", err)
+		}
+
+		switch f := frame.(type) {
+		case *http2.SettingsFrame:
+			if !f.IsAck() {
+				framer.WriteSettingsAck()
+			}
+		case *http2.PushPromiseFrame:
+			if f.StreamID == 1 {
+				pushed = true
+			}
+		case *http2.DataFrame:
+			if f.StreamID != 1 {
+				continue
+			}
+			if !pushed {
+				t.Fatalf("body of the response arrived before the push promise")
+			}
+			return
+		}
+	}
+}
@@ -67,6 +67,7 @@ const (
 // categories of status code
 const (
 	egNetworkError = 1 << iota
+	egTimeout
 )
 
 // map status code to categories, note one status code could belong to
@@ -76,8 +77,8 @@ var (
 		EGStatusClientClosedRequest: egNetworkError,
 		EGStatusServiceUnavailable:  egNetworkError,
 		EGStatusBadGateway:          egNetworkError,
-		EGStatusGatewayTimeOut:      egNetworkError,
-		EGStatusRequestTimeOut:      egNetworkError,
+		EGStatusGatewayTimeOut:      egNetworkError | egTimeout,
+		EGStatusRequestTimeOut:      egNetworkError | egTimeout,
 	}
 )
 
@@ -85,3 +86,9 @@ func IsNetworkError(code int) bool {
 	c, ok := statusCodeCategory[code]
 	return ok && (c&egNetworkError) != 0
 }
+
+// IsTimeout returns whether the status code reports a timeout.
+func IsTimeout(code int) bool {
+	c, ok := statusCodeCategory[code]
+	return ok && (c&egTimeout) != 0
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package context
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+const (
+	// VarRequestID is the string ID of the request, it's the X-Request-Id
+	// header of the request, or a random one if the header is empty.
+	VarRequestID = "requestID"
+	// VarStartTime is the time.Time the request started.
+	VarStartTime = "startTime"
+	// VarClientIP is the string IP of the client.
+	VarClientIP = "clientIP"
+	// VarAuthenticatedUser is the string user authenticated by the filters
+	// like Validator, it doesn't exist if no user is authenticated.
+	VarAuthenticatedUser = "authenticatedUser"
+
+	requestIDHeader = "X-Request-Id"
+)
+
+func (ctx *httpContext) Set(key string, value interface{}) {
+	if ctx.vars == nil {
+		ctx.vars = make(map[string]interface{})
+	}
+	ctx.vars[key] = value
+}
+
+// Get returns the variable, the built-in ones not set by filters are
+// generated on the first access, so requests never pay for unused ones.
+func (ctx *httpContext) Get(key string) (interface{}, bool) {
+	if value, exists := ctx.vars[key]; exists {
+		return value, true
+	}
+
+	switch key {
+	case VarRequestID:
+		id := ctx.r.Header().Get(requestIDHeader)
+		if id == "" {
+			id = newRequestID()
+		}
+		// NOTE: Keep the generated one for the later accesses.
+		ctx.Set(key, id)
+		return id, true
+	case VarStartTime:
+		return *ctx.startTime, true
+	case VarClientIP:
+		return ctx.r.RealIP(), true
+	}
+
+	return nil, false
+}
+
+func newRequestID() string {
+	buff := make([]byte, 16)
+	// NOTE: crypto/rand.Read never fails on supported platforms.
+	rand.Read(buff)
+	return hex.EncodeToString(buff)
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package context
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/tracing"
+)
+
+func TestVars(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "192.168.1.2:12345"
+	ctx := New(httptest.NewRecorder(), req, tracing.NoopTracing, "no trace")
+
+	if _, exists := ctx.Get("unknown"); exists {
+		t.Errorf("want unknown variable not exist")
+	}
+	if _, exists := ctx.Get(VarAuthenticatedUser); exists {
+		t.Errorf("want no authenticated user")
+	}
+
+	ctx.Set("tenant", "megaease")
+	if value, _ := ctx.Get("tenant"); value != "megaease" {
+		t.Errorf("want tenant megaease, got %v", value)
+	}
+
+	id, _ := ctx.Get(VarRequestID)
+	if len(id.(string)) != 32 {
+		t.Errorf("want a random request id, got %v", id)
+	}
+	if again, _ := ctx.Get(VarRequestID); again != id {
+		t.Errorf("want the same request id, got %v and %v", id, again)
+	}
+
+	if ip, _ := ctx.Get(VarClientIP); ip != "192.168.1.2" {
+		t.Errorf("want client ip 192.168.1.2, got %v", ip)
+	}
+	startTime, _ := ctx.Get(VarStartTime)
+	if d := time.Since(startTime.(time.Time)); d < 0 || d > time.Minute {
+		t.Errorf("want start time of the request, got %v", startTime)
+	}
+
+	// NOTE: Filters are able to override the built-in ones.
+	ctx.Set(VarClientIP, "10.0.0.1")
+	if ip, _ := ctx.Get(VarClientIP); ip != "10.0.0.1" {
+		t.Errorf("want client ip overridden, got %v", ip)
+	}
+
+	ctx.Finish()
+	if _, exists := ctx.Get("tenant"); exists {
+		t.Errorf("want variables released once finished")
+	}
+}
+
+func TestRequestIDHeader(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Request-Id", "abc")
+	ctx := New(httptest.NewRecorder(), req, tracing.NoopTracing, "no trace")
+
+	if id, _ := ctx.Get(VarRequestID); id != "abc" {
+		t.Errorf("want request id abc, got %v", id)
+	}
+}
@@ -0,0 +1,322 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package abtest
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"os"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/protocol"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	// Kind is the kind of FingerprintABRouter.
+	Kind = "FingerprintABRouter"
+
+	// OverrideHeader carries the bucket forced by QA.
+	OverrideHeader = "X-Easegress-AB-Bucket"
+	// SecretHeader carries the secret authorizing the override.
+	SecretHeader = "X-Easegress-AB-Secret"
+
+	// bucketCount is the number of buckets, they are 0-99.
+	bucketCount = 100
+
+	resultPipelineNotFound = "pipelineNotFound"
+	resultUnauthorized     = "unauthorized"
+	resultInvalidOverride  = "invalidOverride"
+)
+
+var results = []string{resultPipelineNotFound, resultUnauthorized, resultInvalidOverride}
+
+func init() {
+	httppipeline.Register(&FingerprintABRouter{})
+}
+
+type (
+	// FingerprintABRouter is filter FingerprintABRouter.
+	FingerprintABRouter struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+
+		// secret is read from the environment variable, the override
+		// is disabled if it's empty.
+		secret string
+
+		// The counters are accessed atomically.
+		buckets   [bucketCount]uint64
+		overrides uint64
+
+		getHandler func(name string) (protocol.HTTPHandler, bool)
+	}
+
+	// Spec describes the FingerprintABRouter.
+	Spec struct {
+		// Fingerprint is computed from the first present attribute.
+		Fingerprint []*Attribute `yaml:"fingerprint" jsonschema:"required,minItems=1"`
+		// Salt shuffles the buckets, so that different experiments
+		// get different groups of users.
+		Salt     string     `yaml:"salt" jsonschema:"omitempty"`
+		Variants []*Variant `yaml:"variants" jsonschema:"required,minItems=1"`
+
+		// OverrideSecretEnv is the name of the environment variable
+		// holding the secret, which authorizes the override header.
+		OverrideSecretEnv string `yaml:"overrideSecretEnv" jsonschema:"omitempty"`
+	}
+
+	// Attribute is a request attribute of the fingerprint,
+	// exactly one of the fields is required.
+	Attribute struct {
+		Header   string `yaml:"header" jsonschema:"omitempty"`
+		Cookie   string `yaml:"cookie" jsonschema:"omitempty"`
+		ClientIP bool   `yaml:"clientIP" jsonschema:"omitempty"`
+	}
+
+	// Variant routes the buckets from From to To (inclusive) to Pipeline.
+	Variant struct {
+		Name     string `yaml:"name" jsonschema:"required"`
+		Pipeline string `yaml:"pipeline" jsonschema:"required"`
+		From     int    `yaml:"from" jsonschema:"minimum=0,maximum=99"`
+		To       int    `yaml:"to" jsonschema:"minimum=0,maximum=99"`
+	}
+
+	// Status is the status of FingerprintABRouter.
+	Status struct {
+		// Buckets are the request counts of the buckets
+		// which have requests.
+		Buckets   map[int]uint64 `yaml:"buckets"`
+		Overrides uint64         `yaml:"overrides"`
+	}
+)
+
+// Validate validates Spec.
+func (s Spec) Validate() error {
+	for _, a := range s.Fingerprint {
+		fields := 0
+		if a.Header != "" {
+			fields++
+		}
+		if a.Cookie != "" {
+			fields++
+		}
+		if a.ClientIP {
+			fields++
+		}
+		if fields != 1 {
+			return fmt.Errorf("exactly one of header, cookie and clientIP is required")
+		}
+	}
+
+	var owners [bucketCount]*Variant
+	for _, v := range s.Variants {
+		if v.From > v.To {
+			return fmt.Errorf("variant %s: from %d is greater than to %d", v.Name, v.From, v.To)
+		}
+		for b := v.From; b <= v.To; b++ {
+			if owners[b] != nil {
+				return fmt.Errorf("variant %s: bucket %d overlaps with variant %s",
+					v.Name, b, owners[b].Name)
+			}
+			owners[b] = v
+		}
+	}
+
+	return nil
+}
+
+// Kind returns the kind of FingerprintABRouter.
+func (r *FingerprintABRouter) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns default spec of FingerprintABRouter.
+func (r *FingerprintABRouter) DefaultSpec() interface{} {
+	return &Spec{}
+}
+
+// Description returns the description of FingerprintABRouter.
+func (r *FingerprintABRouter) Description() string {
+	return "FingerprintABRouter routes the requests to the pipelines of the variants by the buckets of their fingerprints."
+}
+
+// Results returns the results of FingerprintABRouter.
+func (r *FingerprintABRouter) Results() []string {
+	return results
+}
+
+// Init initializes FingerprintABRouter.
+func (r *FingerprintABRouter) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	r.pipeSpec, r.spec, r.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	r.reload()
+}
+
+// Inherit inherits previous generation of FingerprintABRouter.
+func (r *FingerprintABRouter) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	previousGeneration.Close()
+	r.Init(pipeSpec, super)
+}
+
+func (r *FingerprintABRouter) reload() {
+	r.getHandler = getHandler
+
+	if r.spec.OverrideSecretEnv != "" {
+		r.secret = os.Getenv(r.spec.OverrideSecretEnv)
+		if r.secret == "" {
+			logger.Warnf("%s: environment variable %s is empty, override disabled",
+				r.pipeSpec.Name(), r.spec.OverrideSecretEnv)
+		}
+	}
+}
+
+func getHandler(name string) (protocol.HTTPHandler, bool) {
+	ro, exists := supervisor.Global.GetRunningObject(name, supervisor.CategoryPipeline)
+	if !exists {
+		return nil, false
+	}
+	handler, ok := ro.Instance().(protocol.HTTPHandler)
+	return handler, ok
+}
+
+// Handle routes the request to the pipeline of its variant. The request
+// goes on in the current pipeline if it has no fingerprint, or its bucket
+// belongs to no variant.
+func (r *FingerprintABRouter) Handle(ctx context.HTTPContext) (result string) {
+	result = r.handle(ctx)
+	return ctx.CallNextHandler(result)
+}
+
+func (r *FingerprintABRouter) handle(ctx context.HTTPContext) string {
+	header := ctx.Request().Header()
+	override := header.Get(OverrideHeader)
+	secret := header.Get(SecretHeader)
+	// NOTE: The headers are never sent to the backends.
+	header.Del(OverrideHeader)
+	header.Del(SecretHeader)
+
+	var bucket int
+	if override != "" && r.secret != "" {
+		if subtle.ConstantTimeCompare([]byte(secret), []byte(r.secret)) != 1 {
+			ctx.Response().SetStatusCode(http.StatusUnauthorized)
+			return resultUnauthorized
+		}
+
+		var err error
+		bucket, err = strconv.Atoi(override)
+		if err != nil || bucket < 0 || bucket >= bucketCount {
+			ctx.Response().SetStatusCode(http.StatusBadRequest)
+			ctx.AddTag(fmt.Sprintf("invalid override bucket %q", override))
+			return resultInvalidOverride
+		}
+		atomic.AddUint64(&r.overrides, 1)
+	} else {
+		fingerprint, ok := r.fingerprint(ctx)
+		if !ok {
+			return ""
+		}
+		bucket = r.bucket(fingerprint)
+	}
+
+	atomic.AddUint64(&r.buckets[bucket], 1)
+
+	variant := r.variant(bucket)
+	if variant == nil {
+		return ""
+	}
+
+	handler, ok := r.getHandler(variant.Pipeline)
+	if !ok {
+		logger.Errorf("%s: pipeline %s of variant %s not found",
+			r.pipeSpec.Name(), variant.Pipeline, variant.Name)
+		ctx.Response().SetStatusCode(http.StatusServiceUnavailable)
+		return resultPipelineNotFound
+	}
+
+	ctx.AddTag(fmt.Sprintf("abVariant:%s", variant.Name))
+	handler.Handle(ctx)
+	return ""
+}
+
+func (r *FingerprintABRouter) fingerprint(ctx context.HTTPContext) (string, bool) {
+	req := ctx.Request()
+	for _, a := range r.spec.Fingerprint {
+		var value string
+		switch {
+		case a.Header != "":
+			value = req.Header().Get(a.Header)
+		case a.Cookie != "":
+			if cookie, err := req.Cookie(a.Cookie); err == nil {
+				value = cookie.Value
+			}
+		case a.ClientIP:
+			value = req.RealIP()
+		}
+
+		if value != "" {
+			return value, true
+		}
+	}
+
+	return "", false
+}
+
+// bucket maps the fingerprint to a stable bucket.
+func (r *FingerprintABRouter) bucket(fingerprint string) int {
+	h := fnv.New64a()
+	h.Write([]byte(r.spec.Salt))
+	h.Write([]byte(fingerprint))
+	return int(h.Sum64() % bucketCount)
+}
+
+func (r *FingerprintABRouter) variant(bucket int) *Variant {
+	for _, v := range r.spec.Variants {
+		if bucket >= v.From && bucket <= v.To {
+			return v
+		}
+	}
+
+	return nil
+}
+
+// Status returns Status.
+func (r *FingerprintABRouter) Status() interface{} {
+	s := &Status{
+		Buckets:   make(map[int]uint64),
+		Overrides: atomic.LoadUint64(&r.overrides),
+	}
+	for i := range r.buckets {
+		if count := atomic.LoadUint64(&r.buckets[i]); count > 0 {
+			s.Buckets[i] = count
+		}
+	}
+
+	return s
+}
+
+// Close closes FingerprintABRouter.
+func (r *FingerprintABRouter) Close() {}
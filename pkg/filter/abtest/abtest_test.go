@@ -0,0 +1,172 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package abtest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/protocol"
+	"github.com/megaease/easegress/pkg/tracing"
+)
+
+type recordHandler struct {
+	name    string
+	handled *[]string
+}
+
+func (h *recordHandler) Handle(ctx context.HTTPContext) {
+	*h.handled = append(*h.handled, h.name)
+}
+
+func newTestRouter(spec *Spec, secret string) (*FingerprintABRouter, *[]string) {
+	handled := &[]string{}
+	r := &FingerprintABRouter{
+		spec:   spec,
+		secret: secret,
+		getHandler: func(name string) (protocol.HTTPHandler, bool) {
+			return &recordHandler{name: name, handled: handled}, true
+		},
+	}
+	return r, handled
+}
+
+func newTestContext(header map[string]string) context.HTTPContext {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	return context.New(httptest.NewRecorder(), req, tracing.NoopTracing, "no trace")
+}
+
+func TestSpecValidate(t *testing.T) {
+	spec := Spec{
+		Fingerprint: []*Attribute{{Header: "X-User-Id"}, {ClientIP: true}},
+		Variants: []*Variant{
+			{Name: "a", Pipeline: "pipeline-a", From: 0, To: 49},
+			{Name: "b", Pipeline: "pipeline-b", From: 50, To: 99},
+		},
+	}
+	if err := spec.Validate(); err != nil {
+		t.Errorf("want valid spec, got %v", err)
+	}
+
+	spec.Variants[1].From = 49
+	if err := spec.Validate(); err == nil {
+		t.Errorf("want error for overlapped buckets")
+	}
+	spec.Variants[1].From = 50
+
+	spec.Fingerprint[0].Cookie = "session"
+	if err := spec.Validate(); err == nil {
+		t.Errorf("want error for attribute with both header and cookie")
+	}
+}
+
+func TestStableRouting(t *testing.T) {
+	r, handled := newTestRouter(&Spec{
+		Fingerprint: []*Attribute{{Header: "X-User-Id"}, {Cookie: "session"}},
+		Salt:        "checkout",
+		Variants: []*Variant{
+			{Name: "a", Pipeline: "pipeline-a", From: 0, To: 49},
+			{Name: "b", Pipeline: "pipeline-b", From: 50, To: 99},
+		},
+	}, "")
+
+	// NOTE: The same user always hits the same variant.
+	for i := 0; i < 3; i++ {
+		r.handle(newTestContext(map[string]string{"X-User-Id": "u1"}))
+	}
+	if len(*handled) != 3 || (*handled)[0] != (*handled)[1] || (*handled)[1] != (*handled)[2] {
+		t.Fatalf("want the same pipeline 3 times, got %v", *handled)
+	}
+	bucket := r.bucket("u1")
+	if got := r.Status().(*Status).Buckets[bucket]; got != 3 {
+		t.Errorf("want 3 requests in bucket %d, got %d", bucket, got)
+	}
+
+	// NOTE: The header takes precedence over the cookie.
+	*handled = nil
+	ctx := newTestContext(map[string]string{"X-User-Id": "u1", "Cookie": "session=s1"})
+	r.handle(ctx)
+	if want := r.variant(bucket).Pipeline; (*handled)[0] != want {
+		t.Errorf("want %s, got %s", want, (*handled)[0])
+	}
+
+	// NOTE: Requests without fingerprint go on in the current pipeline.
+	*handled = nil
+	if result := r.handle(newTestContext(nil)); result != "" || len(*handled) != 0 {
+		t.Errorf("want no routing, got %q %v", result, *handled)
+	}
+
+	// NOTE: The distribution is roughly even.
+	counts := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		counts[r.variant(r.bucket("user-"+strconv.Itoa(i))).Name]++
+	}
+	if counts["a"] < 350 || counts["b"] < 350 {
+		t.Errorf("want roughly even distribution, got %v", counts)
+	}
+}
+
+func TestOverride(t *testing.T) {
+	spec := &Spec{
+		Fingerprint: []*Attribute{{ClientIP: true}},
+		Variants:    []*Variant{{Name: "qa", Pipeline: "pipeline-qa", From: 99, To: 99}},
+	}
+
+	r, handled := newTestRouter(spec, "s3cret")
+	ctx := newTestContext(map[string]string{OverrideHeader: "99", SecretHeader: "s3cret"})
+	if result := r.handle(ctx); result != "" || len(*handled) != 1 || (*handled)[0] != "pipeline-qa" {
+		t.Fatalf("want routed to pipeline-qa, got %q %v", result, *handled)
+	}
+	if ctx.Request().Header().Get(SecretHeader) != "" {
+		t.Errorf("want secret header removed")
+	}
+	if s := r.Status().(*Status); s.Overrides != 1 || s.Buckets[99] != 1 {
+		t.Errorf("want 1 override in bucket 99, got %+v", s)
+	}
+
+	ctx = newTestContext(map[string]string{OverrideHeader: "99", SecretHeader: "wrong"})
+	if result := r.handle(ctx); result != resultUnauthorized {
+		t.Errorf("want %s, got %q", resultUnauthorized, result)
+	}
+
+	ctx = newTestContext(map[string]string{OverrideHeader: "100", SecretHeader: "s3cret"})
+	if result := r.handle(ctx); result != resultInvalidOverride {
+		t.Errorf("want %s, got %q", resultInvalidOverride, result)
+	}
+
+	// NOTE: The override is ignored without the secret.
+	r, handled = newTestRouter(spec, "")
+	ctx = newTestContext(map[string]string{OverrideHeader: "99"})
+	r.handle(ctx)
+	want := 0
+	if r.variant(r.bucket(ctx.Request().RealIP())) != nil {
+		want = 1
+	}
+	if len(*handled) != want {
+		t.Errorf("want override ignored, got %v", *handled)
+	}
+	if s := r.Status().(*Status); s.Overrides != 0 {
+		t.Errorf("want no override, got %d", s.Overrides)
+	}
+}
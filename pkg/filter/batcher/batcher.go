@@ -0,0 +1,445 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package batcher
+
+import (
+	"bytes"
+	stdcontext "context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/iotool"
+)
+
+const (
+	// Kind is the kind of RequestBatcher.
+	Kind = "RequestBatcher"
+
+	resultInvalidBody = "invalidBody"
+	resultBatchFailed = "batchFailed"
+
+	formatJSON      = "json"
+	formatMultipart = "multipart"
+	formatTemplate  = "template"
+)
+
+var (
+	results = []string{resultInvalidBody, resultBatchFailed}
+
+	errClosed = fmt.Errorf("request batcher closed")
+)
+
+func init() {
+	httppipeline.Register(&RequestBatcher{})
+}
+
+var (
+	// All RequestBatcher instances use one globalClient in order to reuse
+	// some resounces such as keepalive connections.
+	globalClient = &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 60 * time.Second,
+			}).DialContext,
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true,
+			},
+			MaxIdleConns:          10240,
+			MaxIdleConnsPerHost:   512,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+		},
+	}
+)
+
+type (
+	// RequestBatcher collects the requests arriving in a short window,
+	// sends them to the upstream in one batch request, and fans the
+	// batch response back to each of them.
+	RequestBatcher struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+
+		window   time.Duration
+		maxWait  time.Duration
+		timeout  time.Duration
+		template *template.Template
+
+		calls chan *call
+		done  chan struct{}
+		wg    sync.WaitGroup
+
+		// The counters are accessed atomically.
+		batches       uint64
+		requests      uint64
+		failedBatches uint64
+	}
+
+	// Spec describes the RequestBatcher.
+	Spec struct {
+		URL     string `yaml:"url" jsonschema:"required,format=uri"`
+		Method  string `yaml:"method,omitempty" jsonschema:"omitempty,enum=POST,enum=PUT"`
+		Timeout string `yaml:"timeout,omitempty" jsonschema:"omitempty,format=duration"`
+		// WindowMs is the idle time after the last request before the
+		// batch is sent, and MaxWaitMs bounds the time the first request
+		// of the batch waits when requests keep arriving.
+		WindowMs     int   `yaml:"windowMs,omitempty" jsonschema:"omitempty,minimum=1"`
+		MaxWaitMs    int   `yaml:"maxWaitMs,omitempty" jsonschema:"omitempty,minimum=1"`
+		MaxBatchSize int   `yaml:"maxBatchSize,omitempty" jsonschema:"omitempty,minimum=1"`
+		MaxBodyBytes int64 `yaml:"maxBodyBytes,omitempty" jsonschema:"omitempty,minimum=1"`
+
+		Format string `yaml:"format,omitempty" jsonschema:"omitempty,enum=json,enum=multipart,enum=template"`
+		// Template renders the batch body from the requests
+		// when the format is template.
+		Template    string `yaml:"template,omitempty" jsonschema:"omitempty"`
+		ContentType string `yaml:"contentType,omitempty" jsonschema:"omitempty"`
+		// ResponseField is the field of the JSON response object holding
+		// the array of responses, the response is the array itself if empty.
+		ResponseField string `yaml:"responseField,omitempty" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of RequestBatcher.
+	Status struct {
+		Batches       uint64 `yaml:"batches"`
+		Requests      uint64 `yaml:"requests"`
+		FailedBatches uint64 `yaml:"failedBatches"`
+	}
+
+	// call is a request waiting in the batch.
+	call struct {
+		method      string
+		path        string
+		query       string
+		header      http.Header
+		contentType string
+		body        []byte
+
+		reply chan *reply
+	}
+
+	// reply is the part of the batch response for one call.
+	reply struct {
+		statusCode  int
+		contentType string
+		body        []byte
+		err         error
+	}
+)
+
+// Validate validates the Spec.
+func (spec Spec) Validate() error {
+	if spec.WindowMs > 0 && spec.MaxWaitMs > 0 && spec.MaxWaitMs < spec.WindowMs {
+		return fmt.Errorf("maxWaitMs %d is less than windowMs %d", spec.MaxWaitMs, spec.WindowMs)
+	}
+
+	if spec.Format != formatTemplate {
+		if spec.Template != "" {
+			return fmt.Errorf("template is only used with format template")
+		}
+		return nil
+	}
+
+	if spec.Template == "" {
+		return fmt.Errorf("template is required with format template")
+	}
+	if _, err := newTemplate(spec.Template); err != nil {
+		return fmt.Errorf("invalid template: %v", err)
+	}
+	return nil
+}
+
+// Kind returns the kind of RequestBatcher.
+func (rb *RequestBatcher) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of RequestBatcher.
+func (rb *RequestBatcher) DefaultSpec() interface{} {
+	return &Spec{
+		Method:       http.MethodPost,
+		Timeout:      "30s",
+		WindowMs:     10,
+		MaxWaitMs:    100,
+		MaxBatchSize: 32,
+		MaxBodyBytes: 1024 * 1024,
+		Format:       formatJSON,
+	}
+}
+
+// Description returns the description of RequestBatcher.
+func (rb *RequestBatcher) Description() string {
+	return "RequestBatcher sends the requests to the upstream in batches."
+}
+
+// Results returns the results of RequestBatcher.
+func (rb *RequestBatcher) Results() []string {
+	return results
+}
+
+// Init initializes RequestBatcher.
+func (rb *RequestBatcher) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	rb.pipeSpec, rb.spec, rb.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	rb.reload()
+}
+
+// Inherit inherits previous generation of RequestBatcher.
+func (rb *RequestBatcher) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	previousGeneration.Close()
+	rb.Init(pipeSpec, super)
+}
+
+func (rb *RequestBatcher) reload() {
+	rb.window = time.Duration(rb.spec.WindowMs) * time.Millisecond
+	rb.maxWait = time.Duration(rb.spec.MaxWaitMs) * time.Millisecond
+
+	rb.timeout = 30 * time.Second
+	if d, err := time.ParseDuration(rb.spec.Timeout); err == nil {
+		rb.timeout = d
+	} else if rb.spec.Timeout != "" {
+		logger.Errorf("BUG: parse duration %s failed: %v", rb.spec.Timeout, err)
+	}
+
+	if rb.spec.Format == formatTemplate {
+		t, err := newTemplate(rb.spec.Template)
+		if err != nil {
+			logger.Errorf("BUG: parse template failed: %v", err)
+		}
+		rb.template = t
+	}
+
+	rb.calls = make(chan *call)
+	rb.done = make(chan struct{})
+	rb.wg.Add(1)
+	go rb.run()
+}
+
+// Handle handles the request in a batch.
+func (rb *RequestBatcher) Handle(ctx context.HTTPContext) string {
+	result := rb.handle(ctx)
+	return ctx.CallNextHandler(result)
+}
+
+func (rb *RequestBatcher) handle(ctx context.HTTPContext) string {
+	r, w := ctx.Request(), ctx.Response()
+
+	body, complete := iotool.ReadLimited(r.Body(), rb.spec.MaxBodyBytes)
+	if !complete {
+		ctx.AddTag(fmt.Sprintf("requestBatcher: request body exceeds %dB", rb.spec.MaxBodyBytes))
+		w.SetStatusCode(http.StatusRequestEntityTooLarge)
+		return resultInvalidBody
+	}
+	if rb.spec.Format == formatJSON && !json.Valid(body) {
+		ctx.AddTag("requestBatcher: request body is not valid json")
+		w.SetStatusCode(http.StatusBadRequest)
+		return resultInvalidBody
+	}
+
+	c := &call{
+		method:      r.Method(),
+		path:        r.Path(),
+		query:       r.Query(),
+		header:      r.Std().Header,
+		contentType: r.Header().Get("Content-Type"),
+		body:        body,
+		reply:       make(chan *reply, 1),
+	}
+
+	var rp *reply
+	select {
+	case rb.calls <- c:
+		rp = <-c.reply
+	case <-rb.done:
+		rp = &reply{err: errClosed}
+	}
+
+	if rp.err != nil {
+		ctx.AddTag(fmt.Sprintf("requestBatcher: %v", rp.err))
+		w.SetStatusCode(http.StatusServiceUnavailable)
+		return resultBatchFailed
+	}
+
+	w.SetStatusCode(rp.statusCode)
+	if rp.contentType != "" {
+		w.Header().Set("Content-Type", rp.contentType)
+	}
+	w.SetBody(bytes.NewReader(rp.body))
+	return ""
+}
+
+// run collects the calls into batches. A batch is sent when it is full,
+// when no call arrives in the window, or when its first call has waited
+// for maxWait.
+func (rb *RequestBatcher) run() {
+	defer rb.wg.Done()
+
+	var batch []*call
+	idle, maxWait := newStoppedTimer(), newStoppedTimer()
+
+	flush := func() {
+		stopTimer(idle)
+		stopTimer(maxWait)
+		go rb.send(batch)
+		batch = nil
+	}
+
+	for {
+		select {
+		case c := <-rb.calls:
+			batch = append(batch, c)
+			if len(batch) >= rb.spec.MaxBatchSize {
+				flush()
+				continue
+			}
+			if len(batch) == 1 {
+				maxWait.Reset(rb.maxWait)
+			}
+			stopTimer(idle)
+			idle.Reset(rb.window)
+		case <-idle.C:
+			flush()
+		case <-maxWait.C:
+			flush()
+		case <-rb.done:
+			stopTimer(idle)
+			stopTimer(maxWait)
+			for _, c := range batch {
+				c.reply <- &reply{err: errClosed}
+			}
+			return
+		}
+	}
+}
+
+func newStoppedTimer() *time.Timer {
+	t := time.NewTimer(time.Hour)
+	stopTimer(t)
+	return t
+}
+
+func stopTimer(t *time.Timer) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+}
+
+func (rb *RequestBatcher) send(batch []*call) {
+	atomic.AddUint64(&rb.batches, 1)
+	atomic.AddUint64(&rb.requests, uint64(len(batch)))
+
+	replies, err := rb.do(batch)
+	if err != nil {
+		atomic.AddUint64(&rb.failedBatches, 1)
+		logger.Warnf("requestBatcher %s: batch of %d requests failed: %v",
+			rb.pipeSpec.Name(), len(batch), err)
+		for _, c := range batch {
+			c.reply <- &reply{err: err}
+		}
+		return
+	}
+
+	for i, c := range batch {
+		c.reply <- replies[i]
+	}
+}
+
+func (rb *RequestBatcher) do(batch []*call) ([]*reply, error) {
+	body, contentType, err := rb.encode(batch)
+	if err != nil {
+		return nil, fmt.Errorf("encode batch failed: %v", err)
+	}
+
+	ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), rb.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, rb.spec.Method, rb.spec.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := globalClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read batch response failed: %v", err)
+	}
+
+	// NOTE: A failed batch response is not split, every request of the
+	// batch gets the whole of it.
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		replies := make([]*reply, len(batch))
+		for i := range replies {
+			replies[i] = &reply{
+				statusCode:  resp.StatusCode,
+				contentType: resp.Header.Get("Content-Type"),
+				body:        respBody,
+			}
+		}
+		return replies, nil
+	}
+
+	replies, err := rb.decode(resp, respBody)
+	if err != nil {
+		return nil, fmt.Errorf("decode batch response failed: %v", err)
+	}
+	if len(replies) != len(batch) {
+		return nil, fmt.Errorf("batch response has %d parts for %d requests",
+			len(replies), len(batch))
+	}
+	return replies, nil
+}
+
+// Status returns status.
+func (rb *RequestBatcher) Status() interface{} {
+	return &Status{
+		Batches:       atomic.LoadUint64(&rb.batches),
+		Requests:      atomic.LoadUint64(&rb.requests),
+		FailedBatches: atomic.LoadUint64(&rb.failedBatches),
+	}
+}
+
+// Close closes RequestBatcher, the calls in the pending batch fail.
+func (rb *RequestBatcher) Close() {
+	close(rb.done)
+	rb.wg.Wait()
+}
@@ -0,0 +1,251 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package batcher
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/option"
+	"github.com/megaease/easegress/pkg/tracing"
+)
+
+func TestMain(m *testing.M) {
+	tempDir, err := ioutil.TempDir("", "eg-batcher-test")
+	if err != nil {
+		panic(err)
+	}
+	absLogDir := filepath.Join(tempDir, "log")
+	os.MkdirAll(absLogDir, 0755)
+	logger.Init(&option.Options{
+		Name:      "batcher-for-log",
+		AbsLogDir: absLogDir,
+	})
+
+	code := m.Run()
+
+	logger.Sync()
+	os.RemoveAll(tempDir)
+
+	os.Exit(code)
+}
+
+// newUpstream serves the JSON batches by wrapping each item as {"echo": item},
+// the size of each batch is sent to sizes.
+func newUpstream(sizes chan int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var items []json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&items); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		sizes <- len(items)
+
+		resp := []map[string]json.RawMessage{}
+		for _, item := range items {
+			resp = append(resp, map[string]json.RawMessage{"echo": item})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"results": resp})
+	}))
+}
+
+func newTestFilter(t *testing.T, spec *Spec) *RequestBatcher {
+	pipeSpec, err := httppipeline.NewFilterSpec(
+		&httppipeline.FilterMetaSpec{Name: "batcher", Kind: Kind}, spec)
+	if err != nil {
+		t.Fatalf("new filter spec failed: %v", err)
+	}
+
+	rb := &RequestBatcher{}
+	rb.Init(pipeSpec, nil)
+	return rb
+}
+
+func doRequest(rb *RequestBatcher, body string) (string, int, string) {
+	req := httptest.NewRequest(http.MethodPost, "http://example.com/infer", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	ctx := context.New(w, req, tracing.NoopTracing, "no trace")
+	result := rb.handle(ctx)
+	ctx.Finish()
+	return result, w.Code, w.Body.String()
+}
+
+func TestBatchJSON(t *testing.T) {
+	sizes := make(chan int, 10)
+	upstream := newUpstream(sizes)
+	defer upstream.Close()
+
+	rb := newTestFilter(t, &Spec{
+		URL:           upstream.URL,
+		WindowMs:      1000,
+		MaxWaitMs:     5000,
+		MaxBatchSize:  3,
+		ResponseField: "results",
+	})
+	defer rb.Close()
+
+	var wg sync.WaitGroup
+	for _, n := range []string{"1", "2", "3"} {
+		wg.Add(1)
+		go func(n string) {
+			defer wg.Done()
+			result, code, body := doRequest(rb, `{"n":`+n+`}`)
+			if result != "" || code != http.StatusOK || body != `{"echo":{"n":`+n+`}}` {
+				t.Errorf("request %s: unexpected response %q %d %s", n, result, code, body)
+			}
+		}(n)
+	}
+	wg.Wait()
+
+	if size := <-sizes; size != 3 {
+		t.Errorf("want one batch of 3 requests, got %d", size)
+	}
+	status := rb.Status().(*Status)
+	if status.Batches != 1 || status.Requests != 3 || status.FailedBatches != 0 {
+		t.Errorf("unexpected status: %+v", status)
+	}
+}
+
+func TestBatchWindow(t *testing.T) {
+	sizes := make(chan int, 10)
+	upstream := newUpstream(sizes)
+	defer upstream.Close()
+
+	rb := newTestFilter(t, &Spec{
+		URL:           upstream.URL,
+		WindowMs:      10,
+		MaxBatchSize:  100,
+		ResponseField: "results",
+	})
+	defer rb.Close()
+
+	_, code, body := doRequest(rb, `"alone"`)
+	if code != http.StatusOK || body != `{"echo":"alone"}` {
+		t.Errorf("unexpected response %d %s", code, body)
+	}
+	if size := <-sizes; size != 1 {
+		t.Errorf("want one batch of 1 request, got %d", size)
+	}
+
+	result, code, _ := doRequest(rb, `not json`)
+	if result != resultInvalidBody || code != http.StatusBadRequest {
+		t.Errorf("want invalid body, got %q %d", result, code)
+	}
+}
+
+func TestBatchFailed(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/error" {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("oops"))
+			return
+		}
+		w.Write([]byte(`[1, 2]`))
+	}))
+	defer upstream.Close()
+
+	rb := newTestFilter(t, &Spec{URL: upstream.URL + "/error", WindowMs: 10})
+	_, code, body := doRequest(rb, `1`)
+	if code != http.StatusInternalServerError || body != "oops" {
+		t.Errorf("want the whole failed response, got %d %s", code, body)
+	}
+	rb.Close()
+
+	// The response has 2 parts for 1 request.
+	rb = newTestFilter(t, &Spec{URL: upstream.URL, WindowMs: 10})
+	result, code, _ := doRequest(rb, `1`)
+	if result != resultBatchFailed || code != http.StatusServiceUnavailable {
+		t.Errorf("want batch failed, got %q %d", result, code)
+	}
+	rb.Close()
+
+	result, _, _ = doRequest(rb, `1`)
+	if result != resultBatchFailed {
+		t.Errorf("want batch failed after closed, got %q", result)
+	}
+}
+
+func TestMultipart(t *testing.T) {
+	batch := []*call{
+		{contentType: "text/plain", body: []byte("first")},
+		{contentType: "application/json", body: []byte(`"second"`)},
+	}
+	body, contentType, err := encodeMultipart(batch)
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}}
+	resp.Header.Set("Content-Type", contentType)
+	replies, err := decodeMultipart(resp, body)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if len(replies) != 2 {
+		t.Fatalf("want 2 replies, got %d", len(replies))
+	}
+	for i, r := range replies {
+		if r.contentType != batch[i].contentType || string(r.body) != string(batch[i].body) {
+			t.Errorf("reply %d: unexpected %s %s", i, r.contentType, r.body)
+		}
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	spec := &Spec{
+		Format:   formatTemplate,
+		Template: `{"instances":[{{range $i, $r := .Requests}}{{if $i}},{{end}}{{json $r.Body}}{{end}}]}`,
+	}
+	if err := spec.Validate(); err != nil {
+		t.Fatalf("validate failed: %v", err)
+	}
+
+	rb := &RequestBatcher{spec: spec}
+	rb.template, _ = newTemplate(spec.Template)
+	body, contentType, err := rb.encode([]*call{{body: []byte("a")}, {body: []byte(`b"`)}})
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	if contentType != "application/json" || string(body) != `{"instances":["a","b\""]}` {
+		t.Errorf("unexpected batch %s %s", contentType, body)
+	}
+}
+
+func TestSpecValidate(t *testing.T) {
+	cases := []Spec{
+		{Format: formatTemplate},
+		{Format: formatTemplate, Template: "{{"},
+		{Format: formatJSON, Template: "{{.Requests}}"},
+		{WindowMs: 100, MaxWaitMs: 10},
+	}
+	for i, spec := range cases {
+		if spec.Validate() == nil {
+			t.Errorf("case %d: want validation error", i)
+		}
+	}
+}
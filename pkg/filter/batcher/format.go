@@ -0,0 +1,204 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package batcher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+type (
+	// templateData is the data to render the batch body with the template.
+	templateData struct {
+		Requests []*templateRequest
+	}
+
+	templateRequest struct {
+		Method string
+		Path   string
+		Query  string
+		Header http.Header
+		Body   string
+	}
+)
+
+func newTemplate(text string) (*template.Template, error) {
+	return template.New("batch").Funcs(template.FuncMap{
+		// json encodes the value, e.g. {{json .Body}} makes a JSON string.
+		"json": func(v interface{}) (string, error) {
+			buff, err := json.Marshal(v)
+			return string(buff), err
+		},
+	}).Parse(text)
+}
+
+// encode encodes the batch into the body of the batch request.
+func (rb *RequestBatcher) encode(batch []*call) (body []byte, contentType string, err error) {
+	switch rb.spec.Format {
+	case formatMultipart:
+		return encodeMultipart(batch)
+	case formatTemplate:
+		return rb.encodeTemplate(batch)
+	default:
+		return encodeJSON(batch), "application/json", nil
+	}
+}
+
+// encodeJSON encodes the batch as a JSON array of the request bodies,
+// which have been validated as JSON.
+func encodeJSON(batch []*call) []byte {
+	var buff bytes.Buffer
+	buff.WriteByte('[')
+	for i, c := range batch {
+		if i > 0 {
+			buff.WriteByte(',')
+		}
+		buff.Write(c.body)
+	}
+	buff.WriteByte(']')
+	return buff.Bytes()
+}
+
+// encodeMultipart encodes the batch as a multipart/mixed body, with one
+// part for each request in order.
+func encodeMultipart(batch []*call) ([]byte, string, error) {
+	var buff bytes.Buffer
+	w := multipart.NewWriter(&buff)
+	for i, c := range batch {
+		header := textproto.MIMEHeader{}
+		if c.contentType != "" {
+			header.Set("Content-Type", c.contentType)
+		}
+		header.Set("Content-ID", strconv.Itoa(i))
+		part, err := w.CreatePart(header)
+		if err != nil {
+			return nil, "", err
+		}
+		part.Write(c.body)
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return buff.Bytes(), "multipart/mixed; boundary=" + w.Boundary(), nil
+}
+
+func (rb *RequestBatcher) encodeTemplate(batch []*call) ([]byte, string, error) {
+	data := &templateData{}
+	for _, c := range batch {
+		data.Requests = append(data.Requests, &templateRequest{
+			Method: c.method,
+			Path:   c.path,
+			Query:  c.query,
+			Header: c.header,
+			Body:   string(c.body),
+		})
+	}
+
+	var buff bytes.Buffer
+	if err := rb.template.Execute(&buff, data); err != nil {
+		return nil, "", err
+	}
+
+	contentType := rb.spec.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	return buff.Bytes(), contentType, nil
+}
+
+// decode splits the successful batch response into the replies.
+func (rb *RequestBatcher) decode(resp *http.Response, body []byte) ([]*reply, error) {
+	if rb.spec.Format == formatMultipart {
+		return decodeMultipart(resp, body)
+	}
+	return decodeJSON(resp.StatusCode, body, rb.spec.ResponseField)
+}
+
+// decodeJSON decodes the JSON array of the responses, which is the
+// field of the response object if field is not empty.
+func decodeJSON(statusCode int, body []byte, field string) ([]*reply, error) {
+	if field != "" {
+		obj := map[string]json.RawMessage{}
+		if err := json.Unmarshal(body, &obj); err != nil {
+			return nil, err
+		}
+		var ok bool
+		if body, ok = obj[field]; !ok {
+			return nil, fmt.Errorf("field %s not found", field)
+		}
+	}
+
+	var parts []json.RawMessage
+	if err := json.Unmarshal(body, &parts); err != nil {
+		return nil, err
+	}
+
+	replies := make([]*reply, 0, len(parts))
+	for _, p := range parts {
+		replies = append(replies, &reply{
+			statusCode:  statusCode,
+			contentType: "application/json",
+			body:        p,
+		})
+	}
+	return replies, nil
+}
+
+// decodeMultipart decodes the multipart response, with one part for
+// each request in order.
+func decodeMultipart(resp *http.Response, body []byte) ([]*reply, error) {
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		return nil, fmt.Errorf("unexpected content type %s", mediaType)
+	}
+
+	var replies []*reply
+	r := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		part, err := r.NextPart()
+		if err != nil {
+			if err == io.EOF {
+				return replies, nil
+			}
+			return nil, err
+		}
+
+		partBody, err := ioutil.ReadAll(part)
+		if err != nil {
+			return nil, err
+		}
+		replies = append(replies, &reply{
+			statusCode:  resp.StatusCode,
+			contentType: part.Header.Get("Content-Type"),
+			body:        partBody,
+		})
+	}
+}
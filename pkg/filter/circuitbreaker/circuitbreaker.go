@@ -28,6 +28,7 @@ import (
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/object/httppipeline"
 	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/auditevent"
 	libcb "github.com/megaease/easegress/pkg/util/circuitbreaker"
 	"github.com/megaease/easegress/pkg/util/urlrule"
 )
@@ -61,6 +62,18 @@ type (
 		MaxWaitDurationInHalfOpen        string `yaml:"maxWaitDurationInHalfOpenState" jsonschema:"omitempty,format=duration"`
 		WaitDurationInOpen               string `yaml:"waitDurationInOpenState" jsonschema:"omitempty,format=duration"`
 		FailureStatusCodes               []int  `yaml:"failureStatusCodes" jsonschema:"omitempty,uniqueItems=true,format=httpcode-array"`
+
+		ErrorClassification *ErrorClassification `yaml:"errorClassification" jsonschema:"omitempty"`
+	}
+
+	// ErrorClassification classifies the responses of the upstream as
+	// successes, failures, or neither of them. It takes the place of
+	// failureStatusCodes and countingNetworkError when specified.
+	ErrorClassification struct {
+		SuccessCodes   []int `yaml:"successCodes" jsonschema:"omitempty,uniqueItems=true,format=httpcode-array"`
+		IgnoreCodes    []int `yaml:"ignoreCodes" jsonschema:"omitempty,uniqueItems=true,format=httpcode-array"`
+		FailCodes      []int `yaml:"failCodes" jsonschema:"omitempty,uniqueItems=true,format=httpcode-array"`
+		TimeoutAsError bool  `yaml:"timeoutAsError" jsonschema:"omitempty"`
 	}
 
 	// URLRule defines the circuit breaker rule for a URL pattern
@@ -108,9 +121,82 @@ URLLoop:
 		return fmt.Errorf("policy '%s' is not defined", name)
 	}
 
+	for _, p := range spec.Policies {
+		if p.ErrorClassification == nil {
+			continue
+		}
+		if err := p.ErrorClassification.validate(); err != nil {
+			return fmt.Errorf("policy '%s': %v", p.Name, err)
+		}
+	}
+
 	return nil
 }
 
+func (ec *ErrorClassification) validate() error {
+	codes := map[int]string{}
+	check := func(list string, cs []int) error {
+		for _, c := range cs {
+			if prev, ok := codes[c]; ok {
+				return fmt.Errorf("status code %d is in both %s and %s", c, prev, list)
+			}
+			codes[c] = list
+		}
+		return nil
+	}
+
+	if err := check("successCodes", ec.SuccessCodes); err != nil {
+		return err
+	}
+	if err := check("ignoreCodes", ec.IgnoreCodes); err != nil {
+		return err
+	}
+	return check("failCodes", ec.FailCodes)
+}
+
+func containsCode(codes []int, code int) bool {
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// classify returns whether the response with the status code is a failure,
+// and whether it should be ignored. Timeouts are failures only if
+// timeoutAsError is true, and ignored otherwise. A code in none of the lists
+// is a failure if it is not a 2xx code when failCodes is empty, and a success
+// otherwise when failCodes is specified.
+func (ec *ErrorClassification) classify(code int) (hasErr, ignore bool) {
+	switch {
+	case containsCode(ec.SuccessCodes, code):
+		return false, false
+	case containsCode(ec.IgnoreCodes, code):
+		return false, true
+	case containsCode(ec.FailCodes, code):
+		return true, false
+	case context.IsTimeout(code):
+		return ec.TimeoutAsError, !ec.TimeoutAsError
+	case len(ec.FailCodes) > 0:
+		return false, false
+	case len(ec.SuccessCodes) > 0:
+		return true, false
+	}
+	return code < 200 || code > 299, false
+}
+
+func (p *Policy) isFailure(code int) (hasErr, ignore bool) {
+	if p.ErrorClassification != nil {
+		return p.ErrorClassification.classify(code)
+	}
+
+	if p.CountingNetworkError && context.IsNetworkError(code) {
+		return true, false
+	}
+	return containsCode(p.FailureStatusCodes, code), false
+}
+
 func (url *URLRule) createCircuitBreaker() {
 	policy := libcb.Policy{
 		FailureRateThreshold:             url.policy.FailureRateThreshold,
@@ -194,6 +280,16 @@ func (cb *CircuitBreaker) setStateListenerForURL(u *URLRule) {
 			event.Time.UnixNano()/1e6,
 			event.Reason,
 		)
+
+		if auditevent.Enabled() {
+			auditevent.Publish(&auditevent.Event{
+				Time:   event.Time,
+				Type:   auditevent.TypeCircuitBreakerTransited,
+				Object: cb.pipeSpec.Pipeline(),
+				Filter: cb.pipeSpec.Name(),
+				Result: event.NewState,
+			})
+		}
 	})
 }
 
@@ -310,17 +406,12 @@ func (cb *CircuitBreaker) handle(ctx context.HTTPContext, u *URLRule) string {
 	result := ctx.CallNextHandler("")
 	d := time.Since(start)
 
-	statusCode := ctx.Response().StatusCode()
-	hasErr := u.policy.CountingNetworkError && context.IsNetworkError(statusCode)
-	if !hasErr {
-		for _, c := range u.policy.FailureStatusCodes {
-			if statusCode == c {
-				hasErr = true
-				break
-			}
-		}
+	hasErr, ignore := u.policy.isFailure(ctx.Response().StatusCode())
+	if ignore {
+		u.cb.ReleasePermission(stateID)
+	} else {
+		u.cb.RecordResult(stateID, hasErr, d)
 	}
-	u.cb.RecordResult(stateID, hasErr, d)
 
 	return result
 }
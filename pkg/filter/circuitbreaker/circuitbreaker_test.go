@@ -0,0 +1,93 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package circuitbreaker
+
+import (
+	"testing"
+)
+
+func TestErrorClassification(t *testing.T) {
+	cases := []struct {
+		ec     ErrorClassification
+		code   int
+		hasErr bool
+		ignore bool
+	}{
+		{ErrorClassification{}, 200, false, false},
+		{ErrorClassification{}, 404, true, false},
+		{ErrorClassification{}, 504, false, true},
+		{ErrorClassification{TimeoutAsError: true}, 504, true, false},
+		{ErrorClassification{TimeoutAsError: true}, 408, true, false},
+		{ErrorClassification{IgnoreCodes: []int{404}}, 404, false, true},
+		{ErrorClassification{IgnoreCodes: []int{504}, TimeoutAsError: true}, 504, false, true},
+		{ErrorClassification{FailCodes: []int{503}}, 400, false, false},
+		{ErrorClassification{FailCodes: []int{503}}, 503, true, false},
+		{ErrorClassification{FailCodes: []int{503}}, 504, false, true},
+		{ErrorClassification{SuccessCodes: []int{200, 404}}, 404, false, false},
+		{ErrorClassification{SuccessCodes: []int{200, 404}}, 201, true, false},
+		{ErrorClassification{SuccessCodes: []int{504}, TimeoutAsError: true}, 504, false, false},
+	}
+
+	for i, c := range cases {
+		hasErr, ignore := c.ec.classify(c.code)
+		if hasErr != c.hasErr || ignore != c.ignore {
+			t.Errorf("case %d: code %d: want (%v, %v), got (%v, %v)",
+				i, c.code, c.hasErr, c.ignore, hasErr, ignore)
+		}
+	}
+}
+
+func TestPolicyIsFailure(t *testing.T) {
+	p := &Policy{CountingNetworkError: true, FailureStatusCodes: []int{500}}
+	if hasErr, _ := p.isFailure(500); !hasErr {
+		t.Errorf("500 should be a failure")
+	}
+	if hasErr, _ := p.isFailure(502); !hasErr {
+		t.Errorf("502 should be a failure")
+	}
+	if hasErr, _ := p.isFailure(404); hasErr {
+		t.Errorf("404 should not be a failure")
+	}
+
+	p.ErrorClassification = &ErrorClassification{IgnoreCodes: []int{404}}
+	if hasErr, ignore := p.isFailure(404); hasErr || !ignore {
+		t.Errorf("404 should be ignored")
+	}
+}
+
+func TestSpecValidate(t *testing.T) {
+	spec := Spec{
+		Policies: []*Policy{{
+			Name: "default",
+			ErrorClassification: &ErrorClassification{
+				IgnoreCodes: []int{404},
+				FailCodes:   []int{503},
+			},
+		}},
+		DefaultPolicyRef: "default",
+		URLs:             []*URLRule{{}},
+	}
+	if err := spec.Validate(); err != nil {
+		t.Errorf("validate failed: %v", err)
+	}
+
+	spec.Policies[0].ErrorClassification.FailCodes = []int{503, 404}
+	if err := spec.Validate(); err == nil {
+		t.Errorf("validate should fail for code in both ignoreCodes and failCodes")
+	}
+}
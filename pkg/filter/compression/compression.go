@@ -0,0 +1,341 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package compression
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+)
+
+const (
+	// Kind is the kind of ResponseCompression.
+	Kind = "ResponseCompression"
+)
+
+var (
+	results = []string{}
+
+	// defaultSkipContentTypes are the types already compressed,
+	// compressing them again only burns CPU.
+	defaultSkipContentTypes = []string{
+		"image/jpeg", "image/png", "image/gif", "image/webp", "image/avif",
+		"video/*", "audio/*", "font/woff", "font/woff2",
+		"application/zip", "application/gzip", "application/x-gzip",
+		"application/zstd", "application/x-bzip2",
+		"application/x-7z-compressed", "application/x-rar-compressed",
+	}
+)
+
+func init() {
+	httppipeline.Register(&ResponseCompression{})
+}
+
+type (
+	// ResponseCompression is filter compressing the response body
+	// with the best encoding the client accepts.
+	ResponseCompression struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+
+		skipContentTypes map[string]struct{}
+		skipMajorTypes   map[string]struct{}
+
+		ratios *ratioHistogram
+	}
+
+	// Spec describes the ResponseCompression.
+	Spec struct {
+		// MinSizeBytes is the minimum size of the body to be compressed.
+		MinSizeBytes uint32 `yaml:"minSizeBytes" jsonschema:"omitempty"`
+		// Encodings are the enabled encodings, the former one wins
+		// if the client accepts several of them with the same quality.
+		Encodings []string `yaml:"encodings" jsonschema:"omitempty,uniqueItems=true"`
+		// SkipContentTypes are the media types never compressed,
+		// such as image/png or video/* for a whole major type.
+		SkipContentTypes []string `yaml:"skipContentTypes" jsonschema:"omitempty"`
+		// Policy picks the encoding by the content type and size,
+		// Encodings and MinSizeBytes are ignored if it's set.
+		Policy *CompressionPolicy `yaml:"policy,omitempty" jsonschema:"omitempty"`
+		// CompressLevel is the compression level of each encoding,
+		// the default level of the encoding is used if absent.
+		CompressLevel map[string]int `yaml:"compressLevel" jsonschema:"omitempty"`
+	}
+
+	readCloser struct {
+		io.Reader
+		io.Closer
+	}
+)
+
+// Validate validates Spec.
+func (spec Spec) Validate() error {
+	for _, encoding := range spec.Encodings {
+		if !supportedEncoding(encoding) {
+			return fmt.Errorf("unsupported encoding %s, supported encodings: %s",
+				encoding, strings.Join(supportedEncodings, ", "))
+		}
+	}
+
+	for encoding, level := range spec.CompressLevel {
+		r, exists := levelRanges[encoding]
+		if !exists {
+			return fmt.Errorf("compressLevel: unsupported encoding %s", encoding)
+		}
+		if level < r.min || level > r.max {
+			return fmt.Errorf("compressLevel: level of %s must be in [%d, %d], got %d",
+				encoding, r.min, r.max, level)
+		}
+	}
+
+	return nil
+}
+
+// Kind returns the kind of ResponseCompression.
+func (rc *ResponseCompression) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of ResponseCompression.
+func (rc *ResponseCompression) DefaultSpec() interface{} {
+	return &Spec{
+		Encodings:        supportedEncodings,
+		SkipContentTypes: defaultSkipContentTypes,
+	}
+}
+
+// Description returns the description of ResponseCompression.
+func (rc *ResponseCompression) Description() string {
+	return "ResponseCompression compresses the response body by the encoding negotiated with the client."
+}
+
+// Results returns the results of ResponseCompression.
+func (rc *ResponseCompression) Results() []string {
+	return results
+}
+
+// Init initializes ResponseCompression.
+func (rc *ResponseCompression) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	rc.pipeSpec, rc.spec, rc.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	rc.reload()
+}
+
+// Inherit inherits previous generation of ResponseCompression.
+func (rc *ResponseCompression) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	previousGeneration.Close()
+	rc.Init(pipeSpec, super)
+}
+
+func (rc *ResponseCompression) reload() {
+	rc.ratios = newRatioHistogram()
+	rc.skipContentTypes = make(map[string]struct{})
+	rc.skipMajorTypes = make(map[string]struct{})
+	for _, ct := range rc.spec.SkipContentTypes {
+		ct = strings.ToLower(strings.TrimSpace(ct))
+		if strings.HasSuffix(ct, "/*") {
+			rc.skipMajorTypes[strings.TrimSuffix(ct, "/*")] = struct{}{}
+		} else {
+			rc.skipContentTypes[ct] = struct{}{}
+		}
+	}
+}
+
+// Handle compresses the response body.
+func (rc *ResponseCompression) Handle(ctx context.HTTPContext) string {
+	rc.handle(ctx)
+	return ctx.CallNextHandler("")
+}
+
+func (rc *ResponseCompression) handle(ctx context.HTTPContext) {
+	r, w := ctx.Request(), ctx.Response()
+
+	if w.Body() == nil || r.Method() == http.MethodHead || !bodyAllowed(w.StatusCode()) {
+		return
+	}
+
+	ce := w.Header().Get(httpheader.KeyContentEncoding)
+	if ce != "" && !strings.EqualFold(ce, encodingIdentity) {
+		return
+	}
+
+	for _, cc := range w.Header().GetAll(httpheader.KeyCacheControl) {
+		if strings.Contains(strings.ToLower(cc), "no-transform") {
+			return
+		}
+	}
+
+	encodings := rc.spec.Encodings
+	if rc.spec.Policy != nil {
+		rule := rc.matchRule(ctx, mediaType(w.Header().Get(httpheader.KeyContentType)))
+		if rule == nil || rule.Algorithm == encodingIdentity {
+			return
+		}
+		encodings = []string{rule.Algorithm}
+	} else {
+		if rc.skipMediaType(mediaType(w.Header().Get(httpheader.KeyContentType))) {
+			return
+		}
+
+		if !rc.largeEnough(ctx, rc.spec.MinSizeBytes) {
+			return
+		}
+	}
+
+	// NOTE: The representation varies from now on,
+	// even if this client accepts none of the encodings.
+	w.Header().Add(httpheader.KeyVary, httpheader.KeyAcceptEncoding)
+
+	encoding := negotiateEncoding(r.Header().GetAll(httpheader.KeyAcceptEncoding), encodings)
+	if encoding == "" {
+		return
+	}
+
+	var level *int
+	if l, exists := rc.spec.CompressLevel[encoding]; exists {
+		level = &l
+	}
+	body, err := newEncodedBody(encoding, w.Body(), level)
+	if err != nil {
+		logger.Errorf("create %s encoder failed: %v", encoding, err)
+		return
+	}
+	body.onComplete = rc.ratios.observe
+
+	w.Header().Del(httpheader.KeyContentLength)
+	w.Header().Set(httpheader.KeyContentEncoding, encoding)
+	// NOTE: Transfer-Encoding is forbidden in HTTP/1.0 and HTTP/2.
+	if r.Proto() == "HTTP/1.1" {
+		w.Header().Set(httpheader.KeyTransferEncoding, "chunked")
+	}
+
+	ctx.AddTag(encoding)
+
+	w.SetBody(body)
+}
+
+// Reference: https://tools.ietf.org/html/rfc7230#section-3.3.3
+func bodyAllowed(code int) bool {
+	switch {
+	case code >= 100 && code < 200:
+		return false
+	case code == http.StatusNoContent, code == http.StatusNotModified:
+		return false
+	}
+
+	return true
+}
+
+// mediaType returns the lower case media type of contentType,
+// or empty string if it's invalid.
+func mediaType(contentType string) string {
+	if contentType == "" {
+		return ""
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+
+	return mediaType
+}
+
+func (rc *ResponseCompression) skipMediaType(mediaType string) bool {
+	if mediaType == "" {
+		return false
+	}
+
+	if _, exists := rc.skipContentTypes[mediaType]; exists {
+		return true
+	}
+
+	majorType := strings.SplitN(mediaType, "/", 2)[0]
+	_, exists := rc.skipMajorTypes[majorType]
+
+	return exists
+}
+
+// largeEnough reports whether the body reaches minSize.
+// For the body without Content-Length, it peeks at most
+// minSize bytes and puts them back to the response.
+func (rc *ResponseCompression) largeEnough(ctx context.HTTPContext, minSize uint32) bool {
+	if minSize == 0 {
+		return true
+	}
+
+	w := ctx.Response()
+	contentLength := w.Header().Get(httpheader.KeyContentLength)
+	if contentLength != "" {
+		cl, err := strconv.ParseInt(contentLength, 10, 64)
+		if err == nil {
+			return cl >= int64(minSize)
+		}
+	}
+
+	body := w.Body()
+	buff := make([]byte, minSize)
+	n, err := io.ReadFull(body, buff)
+	peeked := bytes.NewReader(buff[:n])
+
+	if err == nil {
+		setBody(w, io.MultiReader(peeked, body), body)
+		return true
+	}
+
+	setBody(w, peeked, body)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		w.Header().Set(httpheader.KeyContentLength, strconv.Itoa(n))
+	} else {
+		logger.Errorf("read body failed: %v", err)
+	}
+
+	return false
+}
+
+// setBody sets the body, and keeps the closer of the original body
+// because it needs to be closed after flushing.
+func setBody(w context.HTTPReponse, body io.Reader, original io.Reader) {
+	if closer, ok := original.(io.Closer); ok {
+		w.SetBody(&readCloser{Reader: body, Closer: closer})
+		return
+	}
+
+	w.SetBody(body)
+}
+
+// Status returns status.
+func (rc *ResponseCompression) Status() interface{} {
+	return &Status{
+		CompressionRatio: rc.ratios.status(),
+	}
+}
+
+// Close closes ResponseCompression.
+func (rc *ResponseCompression) Close() {}
@@ -0,0 +1,190 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package compression
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/megaease/easegress/pkg/logger"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/flate"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	encodingGzip    = "gzip"
+	encodingBrotli  = "br"
+	encodingZstd    = "zstd"
+	encodingDeflate = "deflate"
+)
+
+var (
+	bodyFlushSize = 8 * int64(os.Getpagesize())
+
+	supportedEncodings = []string{encodingGzip, encodingBrotli, encodingZstd, encodingDeflate}
+)
+
+type (
+	// encodedBody compresses the body lazily while being read,
+	// so that the response is still streamed to the client.
+	encodedBody struct {
+		encoding string
+		body     io.Reader
+		buff     *countingWriter
+		ew       io.WriteCloser
+		complete bool
+
+		// read is the size of the body read by the encoder, and
+		// onComplete is called with it and the encoded size
+		// once the whole body is encoded.
+		read       int64
+		onComplete func(read, written int64)
+	}
+
+	countingWriter struct {
+		*bytes.Buffer
+		written int64
+	}
+
+	// levelRange is the range of the compression levels of an encoding.
+	levelRange struct {
+		min, max int
+	}
+)
+
+// levelRanges are the valid compression levels, the levels of zstd are
+// mapped to the closest ones supported.
+var levelRanges = map[string]levelRange{
+	encodingGzip:    {gzip.HuffmanOnly, gzip.BestCompression},
+	encodingBrotli:  {brotli.BestSpeed, brotli.BestCompression},
+	encodingZstd:    {1, 22},
+	encodingDeflate: {flate.HuffmanOnly, flate.BestCompression},
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.Buffer.Write(p)
+	cw.written += int64(n)
+	return n, err
+}
+
+// newEncoder creates the encoder of the level, or the default
+// level of the encoding if level is nil.
+func newEncoder(encoding string, w io.Writer, level *int) (io.WriteCloser, error) {
+	switch encoding {
+	case encodingGzip:
+		if level != nil {
+			return gzip.NewWriterLevel(w, *level)
+		}
+		return gzip.NewWriter(w), nil
+	case encodingBrotli:
+		if level != nil {
+			return brotli.NewWriterLevel(w, *level), nil
+		}
+		return brotli.NewWriter(w), nil
+	case encodingZstd:
+		// NOTE: One goroutine per response is enough.
+		options := []zstd.EOption{zstd.WithEncoderConcurrency(1)}
+		if level != nil {
+			options = append(options, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(*level)))
+		}
+		return zstd.NewWriter(w, options...)
+	case encodingDeflate:
+		if level != nil {
+			return flate.NewWriter(w, *level)
+		}
+		return flate.NewWriter(w, flate.DefaultCompression)
+	default:
+		return nil, fmt.Errorf("unsupported encoding %s", encoding)
+	}
+}
+
+func newEncodedBody(encoding string, body io.Reader, level *int) (*encodedBody, error) {
+	buff := &countingWriter{Buffer: bytes.NewBuffer(nil)}
+	ew, err := newEncoder(encoding, buff, level)
+	if err != nil {
+		return nil, err
+	}
+
+	return &encodedBody{
+		encoding: encoding,
+		body:     body,
+		buff:     buff,
+		ew:       ew,
+	}, nil
+}
+
+// body -> ew -> p
+func (eb *encodedBody) Read(p []byte) (int, error) {
+	if eb.complete && eb.buff.Len() == 0 {
+		return 0, io.EOF
+	}
+
+	// NOTE: The encoder may hold the input without any output,
+	// so keep pulling until there is something to return.
+	for !eb.complete && eb.buff.Len() == 0 {
+		eb.pull()
+	}
+
+	n, err := eb.buff.Read(p)
+	if err == io.EOF && !eb.complete {
+		err = nil
+	}
+
+	return n, err
+}
+
+func (eb *encodedBody) pull() {
+	n, err := io.CopyN(eb.ew, eb.body, bodyFlushSize)
+	eb.read += n
+	switch err {
+	case nil:
+		// Nothing to do.
+	case io.EOF:
+		err := eb.ew.Close()
+		if err != nil {
+			logger.Errorf("BUG: close %s encoder failed: %v", eb.encoding, err)
+		}
+		eb.complete = true
+		if eb.onComplete != nil {
+			eb.onComplete(eb.read, eb.buff.written)
+		}
+	default:
+		eb.complete = true
+		logger.Errorf("copy body to %s encoder failed: %v", eb.encoding, err)
+	}
+}
+
+// Close closes the original body if it's closable,
+// since it's hidden from the flushing of the response.
+func (eb *encodedBody) Close() error {
+	if !eb.complete {
+		eb.complete = true
+		// NOTE: Release resources held by the encoder.
+		eb.ew.Close()
+	}
+
+	if body, ok := eb.body.(io.Closer); ok {
+		return body.Close()
+	}
+
+	return nil
+}
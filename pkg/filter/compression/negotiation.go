@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package compression
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	encodingIdentity = "identity"
+	encodingAny      = "*"
+)
+
+type (
+	acceptedEncoding struct {
+		name    string
+		quality float64
+	}
+)
+
+// parseAcceptEncoding parses the values of Accept-Encoding,
+// codings with invalid quality values are ignored.
+// Reference: https://tools.ietf.org/html/rfc7231#section-5.3.4
+func parseAcceptEncoding(values []string) []*acceptedEncoding {
+	accepted := []*acceptedEncoding{}
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			params := strings.Split(part, ";")
+			name := strings.ToLower(strings.TrimSpace(params[0]))
+			if name == "" {
+				continue
+			}
+
+			quality, valid := 1.0, true
+			for _, param := range params[1:] {
+				kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+				if len(kv) != 2 || strings.ToLower(strings.TrimSpace(kv[0])) != "q" {
+					continue
+				}
+				q, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+				if err != nil || q < 0 || q > 1 {
+					valid = false
+					break
+				}
+				quality = q
+			}
+			if !valid {
+				continue
+			}
+
+			accepted = append(accepted, &acceptedEncoding{
+				name:    name,
+				quality: quality,
+			})
+		}
+	}
+
+	return accepted
+}
+
+// negotiateEncoding returns the encoding with the highest quality value
+// among the supported ones, ties are broken by the order of supported.
+// It returns empty string if the client accepts none of them.
+func negotiateEncoding(values []string, supported []string) string {
+	accepted := parseAcceptEncoding(values)
+
+	anyQuality, anyListed := 0.0, false
+	qualities := make(map[string]float64, len(accepted))
+	for _, ae := range accepted {
+		if ae.name == encodingAny {
+			anyQuality, anyListed = ae.quality, true
+			continue
+		}
+		// NOTE: Keep the highest one for duplicated codings.
+		if q, exists := qualities[ae.name]; !exists || ae.quality > q {
+			qualities[ae.name] = ae.quality
+		}
+	}
+
+	best, bestQuality := "", 0.0
+	for _, encoding := range supported {
+		q, exists := qualities[encoding]
+		if !exists {
+			if !anyListed {
+				continue
+			}
+			q = anyQuality
+		}
+
+		if q > bestQuality {
+			best, bestQuality = encoding, q
+		}
+	}
+
+	return best
+}
@@ -0,0 +1,52 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package compression
+
+import (
+	"testing"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	supported := []string{"gzip", "br", "zstd"}
+
+	cases := []struct {
+		acceptEncoding []string
+		want           string
+	}{
+		{nil, ""},
+		{[]string{""}, ""},
+		{[]string{"identity"}, ""},
+		{[]string{"gzip;q=1.0, br;q=0.9, zstd;q=0.8"}, "gzip"},
+		{[]string{"gzip;q=0.5, br;q=0.9, zstd;q=0.8"}, "br"},
+		{[]string{"gzip;q=0.5", "zstd"}, "zstd"},
+		{[]string{"br, gzip"}, "gzip"},
+		{[]string{"GZIP ; Q=0.1, deflate"}, "gzip"},
+		{[]string{"gzip;q=0, br;q=0"}, ""},
+		{[]string{"*"}, "gzip"},
+		{[]string{"*;q=0.5, gzip;q=0.1"}, "br"},
+		{[]string{"*;q=0, zstd"}, "zstd"},
+		{[]string{"gzip;q=2, br;q=abc, zstd;q=0.3"}, "zstd"},
+		{[]string{"gzip;level=1;q=0.2, br;q=0.1"}, "gzip"},
+	}
+
+	for _, c := range cases {
+		got := negotiateEncoding(c.acceptEncoding, supported)
+		if got != c.want {
+			t.Errorf("accept encoding %q: want %q, got %q", c.acceptEncoding, c.want, got)
+		}
+	}
+}
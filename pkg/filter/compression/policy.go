@@ -0,0 +1,168 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compression
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/megaease/easegress/pkg/context"
+)
+
+// ratioBucketBounds are the upper bounds of the compression ratio
+// histogram buckets, the last bucket is unbounded for the bodies
+// growing after being compressed.
+var ratioBucketBounds = []float64{0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9, 1}
+
+type (
+	// CompressionPolicy picks the encoding by the rules, instead of
+	// negotiating among Encodings.
+	CompressionPolicy struct {
+		// Rules are evaluated in order, the first matching one
+		// determines the encoding.
+		Rules []*CompressionRule `yaml:"rules" jsonschema:"required"`
+		// OverrideDefaultDeny evaluates the rules for SkipContentTypes too,
+		// which are never compressed by default.
+		OverrideDefaultDeny bool `yaml:"overrideDefaultDeny" jsonschema:"omitempty"`
+	}
+
+	// CompressionRule matches the responses by the content type and size.
+	CompressionRule struct {
+		// ContentTypePattern matches the media type by the syntax
+		// of path.Match, such as application/json* or text/*.
+		ContentTypePattern string `yaml:"contentTypePattern" jsonschema:"required"`
+		MinSizeBytes       uint32 `yaml:"minSizeBytes" jsonschema:"omitempty"`
+		// Algorithm is one of the supported encodings,
+		// or identity to leave the response uncompressed.
+		Algorithm string `yaml:"algorithm" jsonschema:"required"`
+	}
+
+	// ratioHistogram accumulates the ratios of the compressed size
+	// to the uncompressed size, it's accessed atomically.
+	ratioHistogram struct {
+		// counts has one more unbounded bucket than ratioBucketBounds.
+		counts       []uint64
+		uncompressed uint64
+		compressed   uint64
+	}
+
+	// RatioHistogram is the histogram of the compression ratios.
+	RatioHistogram struct {
+		// Bounds are the upper bounds of the buckets,
+		// the last bucket in Counts is unbounded.
+		Bounds            []float64 `yaml:"bounds"`
+		Counts            []uint64  `yaml:"counts"`
+		Count             uint64    `yaml:"count"`
+		UncompressedBytes uint64    `yaml:"uncompressedBytes"`
+		CompressedBytes   uint64    `yaml:"compressedBytes"`
+	}
+
+	// Status is the status of ResponseCompression.
+	Status struct {
+		CompressionRatio *RatioHistogram `yaml:"compressionRatio"`
+	}
+)
+
+// Validate validates CompressionPolicy.
+func (p CompressionPolicy) Validate() error {
+	for i, rule := range p.Rules {
+		_, err := path.Match(rule.ContentTypePattern, "")
+		if err != nil {
+			return fmt.Errorf("rule %d: invalid contentTypePattern %s: %v", i, rule.ContentTypePattern, err)
+		}
+
+		if rule.Algorithm != encodingIdentity && !supportedEncoding(rule.Algorithm) {
+			return fmt.Errorf("rule %d: unsupported algorithm %s, supported algorithms: %s, %s",
+				i, rule.Algorithm, strings.Join(supportedEncodings, ", "), encodingIdentity)
+		}
+	}
+
+	return nil
+}
+
+func supportedEncoding(encoding string) bool {
+	for _, se := range supportedEncodings {
+		if encoding == se {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *CompressionRule) match(mediaType string) bool {
+	matched, _ := path.Match(strings.ToLower(r.ContentTypePattern), mediaType)
+	return matched
+}
+
+// matchRule returns the first rule matching the response,
+// or nil if none of them matches.
+func (rc *ResponseCompression) matchRule(ctx context.HTTPContext, mediaType string) *CompressionRule {
+	policy := rc.spec.Policy
+	if !policy.OverrideDefaultDeny && rc.skipMediaType(mediaType) {
+		return nil
+	}
+
+	for _, rule := range policy.Rules {
+		if !rule.match(mediaType) {
+			continue
+		}
+		if rule.MinSizeBytes > 0 && !rc.largeEnough(ctx, rule.MinSizeBytes) {
+			continue
+		}
+		return rule
+	}
+
+	return nil
+}
+
+func newRatioHistogram() *ratioHistogram {
+	return &ratioHistogram{
+		counts: make([]uint64, len(ratioBucketBounds)+1),
+	}
+}
+
+func (h *ratioHistogram) observe(uncompressed, compressed int64) {
+	if uncompressed <= 0 {
+		return
+	}
+
+	ratio := float64(compressed) / float64(uncompressed)
+	i := sort.SearchFloat64s(ratioBucketBounds, ratio)
+	atomic.AddUint64(&h.counts[i], 1)
+	atomic.AddUint64(&h.uncompressed, uint64(uncompressed))
+	atomic.AddUint64(&h.compressed, uint64(compressed))
+}
+
+func (h *ratioHistogram) status() *RatioHistogram {
+	s := &RatioHistogram{
+		Bounds:            ratioBucketBounds,
+		Counts:            make([]uint64, len(h.counts)),
+		UncompressedBytes: atomic.LoadUint64(&h.uncompressed),
+		CompressedBytes:   atomic.LoadUint64(&h.compressed),
+	}
+	for i := range h.counts {
+		s.Counts[i] = atomic.LoadUint64(&h.counts[i])
+		s.Count += s.Counts[i]
+	}
+
+	return s
+}
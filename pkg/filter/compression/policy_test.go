@@ -0,0 +1,132 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compression
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+)
+
+func newPolicyTestCompression(policy *CompressionPolicy) *ResponseCompression {
+	rc := &ResponseCompression{spec: &Spec{
+		SkipContentTypes: defaultSkipContentTypes,
+		Policy:           policy,
+		CompressLevel:    map[string]int{encodingGzip: 9},
+	}}
+	rc.reload()
+	return rc
+}
+
+func compressTestResponse(rc *ResponseCompression, contentType string, size int) string {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(httpheader.KeyAcceptEncoding, "gzip, br, zstd")
+	ctx := context.New(httptest.NewRecorder(), req, tracing.NoopTracing, "no trace")
+
+	w := ctx.Response()
+	w.Header().Set(httpheader.KeyContentType, contentType)
+	w.SetBody(strings.NewReader(strings.Repeat("a", size)))
+
+	rc.handle(ctx)
+	ioutil.ReadAll(w.Body())
+
+	return w.Header().Get(httpheader.KeyContentEncoding)
+}
+
+func TestCompressionPolicy(t *testing.T) {
+	rc := newPolicyTestCompression(&CompressionPolicy{
+		Rules: []*CompressionRule{
+			{ContentTypePattern: "application/json*", MinSizeBytes: 1024, Algorithm: encodingBrotli},
+			{ContentTypePattern: "text/event-stream", Algorithm: encodingIdentity},
+			{ContentTypePattern: "text/*", Algorithm: encodingZstd},
+			{ContentTypePattern: "*/*", MinSizeBytes: 100, Algorithm: encodingGzip},
+		},
+	})
+
+	for _, c := range []struct {
+		contentType string
+		size        int
+		want        string
+	}{
+		{"application/json", 2048, encodingBrotli},
+		{"application/json; charset=utf-8", 2048, encodingBrotli},
+		// NOTE: Falls through to the last rule.
+		{"application/json", 512, encodingGzip},
+		{"application/json", 50, ""},
+		{"text/event-stream", 2048, ""},
+		{"TEXT/HTML", 10, encodingZstd},
+		// NOTE: The default deny rule.
+		{"image/png", 2048, ""},
+		{"video/mp4", 2048, ""},
+		{"image/svg+xml", 2048, encodingGzip},
+	} {
+		if got := compressTestResponse(rc, c.contentType, c.size); got != c.want {
+			t.Errorf("%s of %d bytes: want %q, got %q", c.contentType, c.size, c.want, got)
+		}
+	}
+
+	status := rc.Status().(*Status).CompressionRatio
+	if status.Count != 5 {
+		t.Fatalf("want 5 compressed responses, got %d", status.Count)
+	}
+	if status.CompressedBytes >= status.UncompressedBytes || status.Counts[0] != 4 {
+		t.Errorf("want repeated bytes compressed well, got %+v", status)
+	}
+
+	rc = newPolicyTestCompression(&CompressionPolicy{
+		Rules:               []*CompressionRule{{ContentTypePattern: "image/*", Algorithm: encodingGzip}},
+		OverrideDefaultDeny: true,
+	})
+	if got := compressTestResponse(rc, "image/png", 2048); got != encodingGzip {
+		t.Errorf("want default deny overridden, got %q", got)
+	}
+}
+
+func TestSpecValidate(t *testing.T) {
+	for _, c := range []struct {
+		spec  Spec
+		valid bool
+	}{
+		{Spec{CompressLevel: map[string]int{encodingGzip: 9, encodingBrotli: 11, encodingZstd: 3}}, true},
+		{Spec{CompressLevel: map[string]int{encodingBrotli: 12}}, false},
+		{Spec{CompressLevel: map[string]int{"lz4": 1}}, false},
+		{Spec{Policy: &CompressionPolicy{Rules: []*CompressionRule{
+			{ContentTypePattern: "text/*", Algorithm: encodingIdentity},
+		}}}, true},
+		{Spec{Policy: &CompressionPolicy{Rules: []*CompressionRule{
+			{ContentTypePattern: "text/[", Algorithm: encodingGzip},
+		}}}, false},
+		{Spec{Policy: &CompressionPolicy{Rules: []*CompressionRule{
+			{ContentTypePattern: "text/*", Algorithm: "lz4"},
+		}}}, false},
+	} {
+		err := c.spec.Validate()
+		if err == nil && c.spec.Policy != nil {
+			err = c.spec.Policy.Validate()
+		}
+		if (err == nil) != c.valid {
+			t.Errorf("%+v: want valid %v, got %v", c.spec, c.valid, err)
+		}
+	}
+}
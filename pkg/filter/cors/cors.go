@@ -0,0 +1,411 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cors
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// Kind is the kind of DynamicCORSFilter.
+	Kind = "DynamicCORSFilter"
+
+	resultPreflighted = "preflighted"
+
+	// The labels of the policy misses.
+	missOrigin = "origin"
+	missMethod = "method"
+	missHeader = "header"
+)
+
+var (
+	results = []string{resultPreflighted}
+
+	defaultAllowedMethods = []string{http.MethodGet, http.MethodPost, http.MethodHead}
+	defaultAllowedHeaders = []string{"Origin", "Accept", "Content-Type", "X-Requested-With"}
+)
+
+func init() {
+	httppipeline.Register(&DynamicCORSFilter{})
+}
+
+type (
+	// DynamicCORSFilter is the filter for CORS requests, whose allowed
+	// origins are stored in etcd and applied once they are changed.
+	DynamicCORSFilter struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+
+		allowedMethods map[string]struct{}
+		allowedHeaders map[string]struct{}
+		maxAge         string
+
+		// origins stores *origins.
+		origins atomic.Value
+
+		missesMutex sync.Mutex
+		misses      map[string]uint64
+
+		done chan struct{}
+	}
+
+	// Spec describes the DynamicCORSFilter.
+	Spec struct {
+		// OriginsKey is the etcd key of the allowed origins in Origins.
+		OriginsKey       string   `yaml:"originsKey" jsonschema:"required"`
+		AllowedMethods   []string `yaml:"allowedMethods" jsonschema:"omitempty,uniqueItems=true,format=httpmethod-array"`
+		AllowedHeaders   []string `yaml:"allowedHeaders" jsonschema:"omitempty"`
+		AllowCredentials bool     `yaml:"allowCredentials" jsonschema:"omitempty"`
+		ExposedHeaders   []string `yaml:"exposedHeaders" jsonschema:"omitempty"`
+		// MaxAge is the seconds the preflight results are cached, 0 means no header.
+		MaxAge int `yaml:"maxAge" jsonschema:"omitempty,minimum=0"`
+	}
+
+	// Origins is the allowed origins stored in etcd, "*" allows all origins.
+	Origins struct {
+		Exact   []string `yaml:"exact"`
+		Regexps []string `yaml:"regexps"`
+	}
+
+	// Status is the status of DynamicCORSFilter.
+	Status struct {
+		// Misses is the count of blocked cross-origin requests, labeled by
+		// the policy missed, which is one of origin, method and header.
+		Misses map[string]uint64 `yaml:"misses"`
+	}
+
+	origins struct {
+		all     bool
+		exact   map[string]struct{}
+		regexps []*regexp.Regexp
+	}
+)
+
+// Kind returns the kind of DynamicCORSFilter.
+func (f *DynamicCORSFilter) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns default spec of DynamicCORSFilter.
+func (f *DynamicCORSFilter) DefaultSpec() interface{} {
+	return &Spec{}
+}
+
+// Description returns the description of DynamicCORSFilter.
+func (f *DynamicCORSFilter) Description() string {
+	return "DynamicCORSFilter handles CORS requests by the allowed origins in etcd."
+}
+
+// Results returns the results of DynamicCORSFilter.
+func (f *DynamicCORSFilter) Results() []string {
+	return results
+}
+
+// Init initializes DynamicCORSFilter.
+func (f *DynamicCORSFilter) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	f.pipeSpec, f.spec, f.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	f.reload(nil)
+}
+
+// Inherit inherits previous generation of DynamicCORSFilter.
+func (f *DynamicCORSFilter) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	previousGeneration.Close()
+	f.pipeSpec, f.spec, f.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	f.reload(previousGeneration.(*DynamicCORSFilter))
+}
+
+func (f *DynamicCORSFilter) reload(previousGeneration *DynamicCORSFilter) {
+	methods := f.spec.AllowedMethods
+	if len(methods) == 0 {
+		methods = defaultAllowedMethods
+	}
+	f.allowedMethods = make(map[string]struct{})
+	for _, method := range methods {
+		f.allowedMethods[strings.ToUpper(method)] = struct{}{}
+	}
+
+	headers := f.spec.AllowedHeaders
+	if len(headers) == 0 {
+		headers = defaultAllowedHeaders
+	}
+	f.allowedHeaders = make(map[string]struct{})
+	for _, header := range headers {
+		f.allowedHeaders[http.CanonicalHeaderKey(header)] = struct{}{}
+	}
+
+	if f.spec.MaxAge > 0 {
+		f.maxAge = strconv.Itoa(f.spec.MaxAge)
+	}
+
+	f.misses = make(map[string]uint64)
+	f.done = make(chan struct{})
+
+	// NOTE: Keep the origins of the previous generation until the
+	// ones of the key are loaded, if the key is not changed.
+	f.origins.Store(&origins{})
+	if previousGeneration != nil && previousGeneration.spec.OriginsKey == f.spec.OriginsKey {
+		f.origins.Store(previousGeneration.getOrigins())
+	}
+
+	if f.super != nil && f.super.Cluster() != nil {
+		go f.watch()
+	}
+}
+
+func (f *DynamicCORSFilter) watch() {
+	c := f.super.Cluster()
+	key := f.spec.OriginsKey
+
+	watcher, err := c.Watcher()
+	if err != nil {
+		logger.Errorf("%s get watcher failed: %v", f.pipeSpec.Name(), err)
+		return
+	}
+	defer watcher.Close()
+
+	// NOTE: Watch before getting the value to lose no changes.
+	valueChan, err := watcher.Watch(key)
+	if err != nil {
+		logger.Errorf("%s watch key %s failed: %v", f.pipeSpec.Name(), key, err)
+		return
+	}
+
+	value, err := c.Get(key)
+	if err != nil {
+		logger.Errorf("%s get key %s failed: %v", f.pipeSpec.Name(), key, err)
+	} else {
+		f.applyOrigins(value)
+	}
+
+	for {
+		select {
+		case <-f.done:
+			return
+		case value, ok := <-valueChan:
+			if !ok {
+				return
+			}
+			f.applyOrigins(value)
+		}
+	}
+}
+
+// applyOrigins applies the value of the origins key, nil means deleted.
+// The current origins are kept if the value is invalid.
+func (f *DynamicCORSFilter) applyOrigins(value *string) {
+	if value == nil {
+		logger.Warnf("%s: origins key %s deleted, all origins are blocked",
+			f.pipeSpec.Name(), f.spec.OriginsKey)
+		f.origins.Store(&origins{})
+		return
+	}
+
+	o, err := parseOrigins(*value)
+	if err != nil {
+		logger.Errorf("%s: invalid origins in key %s: %v",
+			f.pipeSpec.Name(), f.spec.OriginsKey, err)
+		return
+	}
+
+	f.origins.Store(o)
+	logger.Infof("%s: origins in key %s applied", f.pipeSpec.Name(), f.spec.OriginsKey)
+}
+
+func parseOrigins(value string) (*origins, error) {
+	spec := &Origins{}
+	err := yaml.Unmarshal([]byte(value), spec)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal %s to yaml failed: %v", value, err)
+	}
+
+	o := &origins{exact: make(map[string]struct{})}
+	for _, origin := range spec.Exact {
+		if origin == "*" {
+			o.all = true
+		}
+		o.exact[strings.ToLower(origin)] = struct{}{}
+	}
+	for _, expr := range spec.Regexps {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("compile regexp %s failed: %v", expr, err)
+		}
+		o.regexps = append(o.regexps, re)
+	}
+
+	return o, nil
+}
+
+func (o *origins) allowed(origin string) bool {
+	if o.all {
+		return true
+	}
+
+	if _, exists := o.exact[strings.ToLower(origin)]; exists {
+		return true
+	}
+
+	for _, re := range o.regexps {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f *DynamicCORSFilter) getOrigins() *origins {
+	return f.origins.Load().(*origins)
+}
+
+func (f *DynamicCORSFilter) miss(label string) {
+	f.missesMutex.Lock()
+	f.misses[label]++
+	f.missesMutex.Unlock()
+}
+
+// Handle handles the preflight requests and adds the CORS headers to
+// the responses of the actual requests. Cross-origin requests blocked
+// by the policy are passed without the CORS headers, so browsers refuse
+// to expose their responses, their preflight requests get 403.
+func (f *DynamicCORSFilter) Handle(ctx context.HTTPContext) string {
+	r := ctx.Request()
+	origin := r.Header().Get("Origin")
+	if origin == "" {
+		return ctx.CallNextHandler("")
+	}
+
+	if r.Method() == http.MethodOptions && r.Header().Get("Access-Control-Request-Method") != "" {
+		f.handlePreflight(ctx, origin)
+		return resultPreflighted
+	}
+
+	result := ctx.CallNextHandler("")
+
+	if !f.getOrigins().allowed(origin) {
+		f.miss(missOrigin)
+		return result
+	}
+
+	h := ctx.Response().Header()
+	h.Add("Vary", "Origin")
+	f.setAllowOrigin(ctx, origin)
+	if len(f.spec.ExposedHeaders) > 0 {
+		h.Set("Access-Control-Expose-Headers", strings.Join(f.spec.ExposedHeaders, ", "))
+	}
+
+	return result
+}
+
+func (f *DynamicCORSFilter) handlePreflight(ctx context.HTTPContext, origin string) {
+	r, w := ctx.Request(), ctx.Response()
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+
+	if !f.getOrigins().allowed(origin) {
+		f.miss(missOrigin)
+		w.SetStatusCode(http.StatusForbidden)
+		return
+	}
+
+	method := strings.ToUpper(r.Header().Get("Access-Control-Request-Method"))
+	if _, exists := f.allowedMethods[method]; !exists {
+		f.miss(missMethod)
+		w.SetStatusCode(http.StatusForbidden)
+		return
+	}
+
+	headers := parseHeaderList(r.Header().Get("Access-Control-Request-Headers"))
+	for _, header := range headers {
+		if _, exists := f.allowedHeaders[header]; !exists {
+			f.miss(missHeader)
+			w.SetStatusCode(http.StatusForbidden)
+			return
+		}
+	}
+
+	f.setAllowOrigin(ctx, origin)
+	h.Set("Access-Control-Allow-Methods", method)
+	if len(headers) > 0 {
+		h.Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+	}
+	if f.maxAge != "" {
+		h.Set("Access-Control-Max-Age", f.maxAge)
+	}
+	w.SetStatusCode(http.StatusNoContent)
+}
+
+func (f *DynamicCORSFilter) setAllowOrigin(ctx context.HTTPContext, origin string) {
+	h := ctx.Response().Header()
+	// NOTE: The wildcard is not allowed with credentials.
+	if f.getOrigins().all && !f.spec.AllowCredentials {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+	if f.spec.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func parseHeaderList(value string) []string {
+	headers := []string{}
+	for _, header := range strings.Split(value, ",") {
+		header = strings.TrimSpace(header)
+		if header != "" {
+			headers = append(headers, http.CanonicalHeaderKey(header))
+		}
+	}
+	return headers
+}
+
+// Status returns Status.
+func (f *DynamicCORSFilter) Status() interface{} {
+	f.missesMutex.Lock()
+	defer f.missesMutex.Unlock()
+
+	misses := make(map[string]uint64, len(f.misses))
+	for label, count := range f.misses {
+		misses[label] = count
+	}
+
+	return &Status{Misses: misses}
+}
+
+// Close closes DynamicCORSFilter.
+func (f *DynamicCORSFilter) Close() {
+	close(f.done)
+}
@@ -0,0 +1,233 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cors
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/option"
+	"github.com/megaease/easegress/pkg/tracing"
+)
+
+func TestMain(m *testing.M) {
+	tempDir, err := ioutil.TempDir("", "eg-cors-test")
+	if err != nil {
+		panic(err)
+	}
+	absLogDir := filepath.Join(tempDir, "log")
+	os.MkdirAll(absLogDir, 0755)
+	logger.Init(&option.Options{
+		Name:      "cors-for-log",
+		AbsLogDir: absLogDir,
+	})
+
+	code := m.Run()
+
+	logger.Sync()
+	os.RemoveAll(tempDir)
+
+	os.Exit(code)
+}
+
+func newTestFilter(t *testing.T, spec *Spec) *DynamicCORSFilter {
+	pipeSpec, err := httppipeline.NewFilterSpec(
+		&httppipeline.FilterMetaSpec{Name: "cors", Kind: Kind}, spec)
+	if err != nil {
+		t.Fatalf("new filter spec failed: %v", err)
+	}
+
+	f := &DynamicCORSFilter{}
+	f.Init(pipeSpec, nil)
+	return f
+}
+
+func newTestContext(method, origin string, header map[string]string) context.HTTPContext {
+	req := httptest.NewRequest(method, "/", nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	ctx := context.New(httptest.NewRecorder(), req, tracing.NoopTracing, "no trace")
+	ctx.SetHandlerCaller(func(lastResult string) string {
+		return lastResult
+	})
+	return ctx
+}
+
+func preflight(f *DynamicCORSFilter, origin, method, headers string) context.HTTPContext {
+	ctx := newTestContext(http.MethodOptions, origin, map[string]string{
+		"Access-Control-Request-Method":  method,
+		"Access-Control-Request-Headers": headers,
+	})
+	if result := f.Handle(ctx); result != resultPreflighted {
+		panic("want preflighted, got " + result)
+	}
+	return ctx
+}
+
+func TestParseOrigins(t *testing.T) {
+	o, err := parseOrigins(`
+exact: [https://a.example.com]
+regexps: ['^https://[a-z]+\.example\.org$']
+`)
+	if err != nil {
+		t.Fatalf("parse origins failed: %v", err)
+	}
+	for origin, want := range map[string]bool{
+		"https://a.example.com":   true,
+		"HTTPS://A.EXAMPLE.COM":   true,
+		"https://b.example.com":   false,
+		"https://b.example.org":   true,
+		"https://b.example.org.x": false,
+	} {
+		if got := o.allowed(origin); got != want {
+			t.Errorf("%s: want %v, got %v", origin, want, got)
+		}
+	}
+
+	if _, err := parseOrigins("regexps: ['(']"); err == nil {
+		t.Errorf("want error for invalid regexp")
+	}
+}
+
+func TestApplyOrigins(t *testing.T) {
+	// NOTE: It's closed by the next generation.
+	f := newTestFilter(t, &Spec{OriginsKey: "/cors/origins"})
+
+	if f.getOrigins().allowed("https://a.com") {
+		t.Errorf("want all origins blocked before loaded")
+	}
+
+	value := "exact: [https://a.com]"
+	f.applyOrigins(&value)
+	if !f.getOrigins().allowed("https://a.com") {
+		t.Errorf("want origin allowed once applied")
+	}
+
+	value = "exact: {"
+	f.applyOrigins(&value)
+	if !f.getOrigins().allowed("https://a.com") {
+		t.Errorf("want origins kept on invalid value")
+	}
+
+	f.applyOrigins(nil)
+	if f.getOrigins().allowed("https://a.com") {
+		t.Errorf("want all origins blocked once deleted")
+	}
+
+	// NOTE: The next generation keeps the origins until it loads them.
+	value = "exact: [https://a.com]"
+	f.applyOrigins(&value)
+	pipeSpec, _ := httppipeline.NewFilterSpec(
+		&httppipeline.FilterMetaSpec{Name: "cors", Kind: Kind}, &Spec{OriginsKey: "/cors/origins"})
+	next := &DynamicCORSFilter{}
+	next.Inherit(pipeSpec, f, nil)
+	defer next.Close()
+	if !next.getOrigins().allowed("https://a.com") {
+		t.Errorf("want origins inherited")
+	}
+}
+
+func TestHandle(t *testing.T) {
+	f := newTestFilter(t, &Spec{
+		OriginsKey:       "/cors/origins",
+		AllowedMethods:   []string{"GET", "PUT"},
+		AllowedHeaders:   []string{"content-type", "X-Token"},
+		AllowCredentials: true,
+		ExposedHeaders:   []string{"X-Request-Id"},
+		MaxAge:           600,
+	})
+	defer f.Close()
+	value := "exact: [https://a.com]\nregexps: ['^https://.*\\.b\\.com$']"
+	f.applyOrigins(&value)
+
+	ctx := preflight(f, "https://x.b.com", "PUT", "x-token, Content-Type")
+	h := ctx.Response().Header()
+	if ctx.Response().StatusCode() != http.StatusNoContent ||
+		h.Get("Access-Control-Allow-Origin") != "https://x.b.com" ||
+		h.Get("Access-Control-Allow-Methods") != "PUT" ||
+		h.Get("Access-Control-Allow-Headers") != "X-Token, Content-Type" ||
+		h.Get("Access-Control-Allow-Credentials") != "true" ||
+		h.Get("Access-Control-Max-Age") != "600" {
+		t.Errorf("want preflight allowed, got %d %s", ctx.Response().StatusCode(), h.Dump())
+	}
+
+	for _, c := range []struct {
+		origin, method, headers string
+	}{
+		{"https://c.com", "GET", ""},
+		{"https://a.com", "DELETE", ""},
+		{"https://a.com", "GET", "X-Other"},
+	} {
+		ctx := preflight(f, c.origin, c.method, c.headers)
+		if ctx.Response().StatusCode() != http.StatusForbidden ||
+			ctx.Response().Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("%+v: want preflight blocked", c)
+		}
+	}
+
+	ctx = newTestContext(http.MethodGet, "https://a.com", nil)
+	if result := f.Handle(ctx); result != "" {
+		t.Errorf("want empty result, got %s", result)
+	}
+	h = ctx.Response().Header()
+	if h.Get("Access-Control-Allow-Origin") != "https://a.com" ||
+		h.Get("Access-Control-Expose-Headers") != "X-Request-Id" {
+		t.Errorf("want CORS headers, got %s", h.Dump())
+	}
+
+	ctx = newTestContext(http.MethodGet, "https://c.com", nil)
+	f.Handle(ctx)
+	if ctx.Response().Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("want no CORS headers for blocked origin")
+	}
+
+	ctx = newTestContext(http.MethodGet, "", nil)
+	f.Handle(ctx)
+	if ctx.Response().Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("want no CORS headers for same-origin request")
+	}
+
+	misses := f.Status().(*Status).Misses
+	if misses[missOrigin] != 2 || misses[missMethod] != 1 || misses[missHeader] != 1 {
+		t.Errorf("want misses origin 2, method 1, header 1, got %v", misses)
+	}
+}
+
+func TestWildcardOrigin(t *testing.T) {
+	f := newTestFilter(t, &Spec{OriginsKey: "/cors/origins"})
+	defer f.Close()
+	value := "exact: ['*']"
+	f.applyOrigins(&value)
+
+	ctx := newTestContext(http.MethodGet, "https://any.com", nil)
+	f.Handle(ctx)
+	if got := ctx.Response().Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("want *, got %s", got)
+	}
+}
@@ -0,0 +1,213 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package deduplication
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	// Kind is the kind of Deduplication.
+	Kind = "Deduplication"
+
+	resultDuplicated = "duplicated"
+)
+
+var (
+	results = []string{resultDuplicated}
+)
+
+func init() {
+	httppipeline.Register(&Deduplication{})
+}
+
+type (
+	// Deduplication is filter rejecting the requests with the same key
+	// as one seen within the window, for time-based idempotency.
+	Deduplication struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+
+		window *slidingWindow
+	}
+
+	// Spec describes the Deduplication.
+	Spec struct {
+		// Window is how long a key is remembered.
+		Window string `yaml:"window" jsonschema:"required,format=duration"`
+		// BucketSize is the granularity of expiring keys, the smaller
+		// the more accurate, while checking more buckets per request.
+		BucketSize string `yaml:"bucketSize" jsonschema:"omitempty,format=duration"`
+		// KeyHeaders are the headers in the key besides the method and the
+		// URL, such as Idempotency-Key.
+		KeyHeaders []string `yaml:"keyHeaders" jsonschema:"omitempty,uniqueItems=true"`
+		// IncludeBody puts the request body in the key.
+		IncludeBody bool `yaml:"includeBody" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of Deduplication.
+	Status struct {
+		Keys int `yaml:"keys"`
+	}
+)
+
+// Validate validates Spec.
+func (spec Spec) Validate() error {
+	window, err := time.ParseDuration(spec.Window)
+	if err != nil {
+		return fmt.Errorf("invalid window %s: %v", spec.Window, err)
+	}
+
+	bucketSize, err := time.ParseDuration(spec.BucketSize)
+	if err != nil {
+		return fmt.Errorf("invalid bucket size %s: %v", spec.BucketSize, err)
+	}
+
+	if bucketSize <= 0 || bucketSize > window {
+		return fmt.Errorf("bucket size %s must be in (0, %s]", spec.BucketSize, spec.Window)
+	}
+
+	return nil
+}
+
+// Kind returns the kind of Deduplication.
+func (d *Deduplication) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of Deduplication.
+func (d *Deduplication) DefaultSpec() interface{} {
+	return &Spec{
+		BucketSize: "1s",
+	}
+}
+
+// Description returns the description of Deduplication.
+func (d *Deduplication) Description() string {
+	return "Deduplication rejects the same requests within the sliding window."
+}
+
+// Results returns the results of Deduplication.
+func (d *Deduplication) Results() []string {
+	return results
+}
+
+// Init initializes Deduplication.
+func (d *Deduplication) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	d.pipeSpec, d.spec, d.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	d.reload(nil /*no previous generation*/)
+}
+
+// Inherit inherits previous generation of Deduplication.
+func (d *Deduplication) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	d.pipeSpec, d.spec, d.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	d.reload(previousGeneration.(*Deduplication))
+	previousGeneration.Close()
+}
+
+func (d *Deduplication) reload(previousGeneration *Deduplication) {
+	// NOTE: The durations have been checked in validation.
+	window, _ := time.ParseDuration(d.spec.Window)
+	bucketSize, _ := time.ParseDuration(d.spec.BucketSize)
+
+	// NOTE: Keep the seen keys if the window is the same,
+	// so updating the spec doesn't let duplicated requests in.
+	if previousGeneration != nil {
+		prev := previousGeneration.spec
+		if prev.Window == d.spec.Window && prev.BucketSize == d.spec.BucketSize {
+			d.window = previousGeneration.window
+			return
+		}
+	}
+
+	d.window = newSlidingWindow(window, bucketSize)
+}
+
+// Handle rejects the request if it's duplicated.
+func (d *Deduplication) Handle(ctx context.HTTPContext) string {
+	result := d.handle(ctx)
+	return ctx.CallNextHandler(result)
+}
+
+func (d *Deduplication) handle(ctx context.HTTPContext) string {
+	key, err := d.key(ctx)
+	if err != nil {
+		logger.Errorf("%s: compute key failed: %v", d.pipeSpec.Name(), err)
+		return ""
+	}
+
+	if d.window.checkAndAdd(key, time.Now()) {
+		ctx.Response().SetStatusCode(http.StatusConflict)
+		ctx.AddTag("deduplication: duplicated request")
+		return resultDuplicated
+	}
+
+	return ""
+}
+
+func (d *Deduplication) key(ctx context.HTTPContext) (uint64, error) {
+	r := ctx.Request()
+
+	h := fnv.New64a()
+	write := func(s string) {
+		h.Write([]byte(s))
+		// NOTE: Separate the parts to avoid ambiguous concatenation.
+		h.Write([]byte{0})
+	}
+
+	write(r.Method())
+	write(r.Path())
+	write(r.Query())
+	for _, key := range d.spec.KeyHeaders {
+		write(r.Header().Get(key))
+	}
+
+	if d.spec.IncludeBody {
+		body, err := ioutil.ReadAll(r.Body())
+		if err != nil {
+			return 0, fmt.Errorf("read body failed: %v", err)
+		}
+		r.SetBody(bytes.NewReader(body))
+		h.Write(body)
+	}
+
+	return h.Sum64(), nil
+}
+
+// Status returns status.
+func (d *Deduplication) Status() interface{} {
+	return &Status{
+		Keys: d.window.size(time.Now()),
+	}
+}
+
+// Close closes Deduplication.
+func (d *Deduplication) Close() {}
@@ -0,0 +1,119 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package deduplication
+
+import (
+	"testing"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+)
+
+func TestSlidingWindow(t *testing.T) {
+	sw := newSlidingWindow(5*time.Second, time.Second)
+	start := time.Unix(1600000000, 0)
+
+	if sw.checkAndAdd(1, start) {
+		t.Fatalf("first request: want not duplicated")
+	}
+	if !sw.checkAndAdd(1, start.Add(4*time.Second)) {
+		t.Errorf("request in window: want duplicated")
+	}
+	if sw.checkAndAdd(2, start.Add(4*time.Second)) {
+		t.Errorf("another key: want not duplicated")
+	}
+	if got := sw.size(start.Add(4 * time.Second)); got != 2 {
+		t.Errorf("want 2 keys, got %d", got)
+	}
+
+	// NOTE: The bucket of the first request expires after the window.
+	if sw.checkAndAdd(1, start.Add(5*time.Second)) {
+		t.Errorf("request after window: want not duplicated")
+	}
+	if got := sw.size(start.Add(5 * time.Second)); got != 2 {
+		t.Errorf("want 2 keys after eviction, got %d", got)
+	}
+	if got := sw.size(start.Add(time.Minute)); got != 0 {
+		t.Errorf("want no keys long after, got %d", got)
+	}
+}
+
+func TestSpecValidate(t *testing.T) {
+	for _, spec := range []Spec{
+		{Window: "5s", BucketSize: "0s"},
+		{Window: "5s", BucketSize: "10s"},
+		{Window: "5x", BucketSize: "1s"},
+	} {
+		if err := spec.Validate(); err == nil {
+			t.Errorf("want error for %+v", spec)
+		}
+	}
+
+	if err := (Spec{Window: "5s", BucketSize: "1s"}).Validate(); err != nil {
+		t.Errorf("want valid, got %v", err)
+	}
+}
+
+// lruDedup is the count-bounded LRU baseline, which must be sized
+// for the peak number of keys in the window.
+type lruDedup struct {
+	cache  *lru.Cache
+	window time.Duration
+}
+
+func (l *lruDedup) checkAndAdd(key uint64, now time.Time) bool {
+	if seen, exists := l.cache.Get(key); exists && now.Sub(seen.(time.Time)) < l.window {
+		return true
+	}
+	l.cache.Add(key, now)
+	return false
+}
+
+// BenchmarkDeduplication compares the stores at 10k RPS in a 5s window,
+// half of the requests are duplicated.
+func BenchmarkDeduplication(b *testing.B) {
+	const (
+		rps    = 10000
+		window = 5 * time.Second
+	)
+	interval := time.Second / rps
+
+	run := func(b *testing.B, checkAndAdd func(key uint64, now time.Time) bool) {
+		now := time.Unix(1600000000, 0)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			now = now.Add(interval)
+			checkAndAdd(uint64(i/2), now)
+		}
+	}
+
+	b.Run("LRU", func(b *testing.B) {
+		cache, err := lru.New(rps * int(window/time.Second))
+		if err != nil {
+			b.Fatalf("create lru failed: %v", err)
+		}
+		l := &lruDedup{cache: cache, window: window}
+		run(b, l.checkAndAdd)
+	})
+
+	b.Run("SlidingWindow", func(b *testing.B) {
+		sw := newSlidingWindow(window, time.Second)
+		run(b, sw.checkAndAdd)
+	})
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package deduplication
+
+import (
+	"sync"
+	"time"
+)
+
+type (
+	// slidingWindow remembers the keys seen in the window, in buckets of
+	// bucketSize. The keys expire in whole buckets, so the actual window
+	// is rounded up to the bucket size.
+	slidingWindow struct {
+		mutex      sync.Mutex
+		bucketSize int64
+		// buckets is a ring indexed by the bucket number modulo its length.
+		buckets []*keyBucket
+	}
+
+	keyBucket struct {
+		// number is the start time divided by bucketSize.
+		number int64
+		keys   map[uint64]struct{}
+	}
+)
+
+func newSlidingWindow(window, bucketSize time.Duration) *slidingWindow {
+	n := int((window + bucketSize - 1) / bucketSize)
+	if n < 1 {
+		n = 1
+	}
+
+	sw := &slidingWindow{
+		bucketSize: int64(bucketSize),
+		buckets:    make([]*keyBucket, n),
+	}
+	for i := range sw.buckets {
+		sw.buckets[i] = &keyBucket{number: -1, keys: make(map[uint64]struct{})}
+	}
+
+	return sw
+}
+
+// checkAndAdd returns true if the key has been seen in the window,
+// otherwise it adds the key to the current bucket.
+func (sw *slidingWindow) checkAndAdd(key uint64, now time.Time) bool {
+	number := now.UnixNano() / sw.bucketSize
+	n := int64(len(sw.buckets))
+
+	sw.mutex.Lock()
+	defer sw.mutex.Unlock()
+
+	for _, b := range sw.buckets {
+		if b.number > number-n && b.number <= number {
+			if _, exists := b.keys[key]; exists {
+				return true
+			}
+		}
+	}
+
+	// NOTE: The slot is reused by the bucket n buckets later,
+	// which evicts the expired keys as a whole.
+	current := sw.buckets[number%n]
+	if current.number != number {
+		current.number = number
+		current.keys = make(map[uint64]struct{}, len(current.keys))
+	}
+	current.keys[key] = struct{}{}
+
+	return false
+}
+
+// size returns the number of keys in the active buckets.
+func (sw *slidingWindow) size(now time.Time) int {
+	number := now.UnixNano() / sw.bucketSize
+	n := int64(len(sw.buckets))
+
+	sw.mutex.Lock()
+	defer sw.mutex.Unlock()
+
+	size := 0
+	for _, b := range sw.buckets {
+		if b.number > number-n && b.number <= number {
+			size += len(b.keys)
+		}
+	}
+
+	return size
+}
@@ -0,0 +1,179 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package devmodeoverride
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	// Kind is the kind of DevModeOverride.
+	Kind = "DevModeOverride"
+
+	// OverrideHeader carries the base64 encoded partial pipeline spec.
+	OverrideHeader = "X-Easegress-Override"
+	// TokenHeader carries the token authorizing the override.
+	TokenHeader = "X-Easegress-Override-Token"
+
+	resultOverridden      = "overridden"
+	resultInvalidOverride = "invalidOverride"
+	resultUnauthorized    = "unauthorized"
+)
+
+var results = []string{resultOverridden, resultInvalidOverride, resultUnauthorized}
+
+func init() {
+	httppipeline.Register(&DevModeOverride{})
+}
+
+type (
+	// DevModeOverride is filter DevModeOverride.
+	DevModeOverride struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+
+		// overrides is accessed atomically.
+		overrides uint64
+	}
+
+	// Spec describes the DevModeOverride.
+	Spec struct {
+		// EnableDevMode is the safety flag, the override header is
+		// removed and ignored unless it's true.
+		EnableDevMode bool   `yaml:"enableDevMode" jsonschema:"omitempty"`
+		Token         string `yaml:"token" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of DevModeOverride.
+	Status struct {
+		Overrides uint64 `yaml:"overrides"`
+	}
+)
+
+// Validate validates Spec.
+func (s Spec) Validate() error {
+	if s.EnableDevMode && s.Token == "" {
+		return fmt.Errorf("token is required when enableDevMode is true")
+	}
+
+	return nil
+}
+
+// Kind returns the kind of DevModeOverride.
+func (o *DevModeOverride) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns default spec of DevModeOverride.
+func (o *DevModeOverride) DefaultSpec() interface{} {
+	return &Spec{}
+}
+
+// Description returns the description of DevModeOverride.
+func (o *DevModeOverride) Description() string {
+	return "DevModeOverride handles the request by the pipeline overridden by the request header."
+}
+
+// Results returns the results of DevModeOverride.
+func (o *DevModeOverride) Results() []string {
+	return results
+}
+
+// Init initializes DevModeOverride.
+func (o *DevModeOverride) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	o.pipeSpec, o.spec, o.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+}
+
+// Inherit inherits previous generation of DevModeOverride.
+func (o *DevModeOverride) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	previousGeneration.Close()
+	o.Init(pipeSpec, super)
+}
+
+// Handle handles HTTPContext.
+// The request carrying the override header is handled by a temporary
+// generation of the pipeline, the flow of this generation ends here.
+func (o *DevModeOverride) Handle(ctx context.HTTPContext) string {
+	header := ctx.Request().Header()
+	override := header.Get(OverrideHeader)
+	token := header.Get(TokenHeader)
+	// NOTE: Remove the headers so that the overridden pipeline doesn't
+	// override again, and they are never sent to the backends.
+	header.Del(OverrideHeader)
+	header.Del(TokenHeader)
+
+	if override == "" || !o.spec.EnableDevMode {
+		return ctx.CallNextHandler("")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(token), []byte(o.spec.Token)) != 1 {
+		ctx.Response().SetStatusCode(http.StatusUnauthorized)
+		return resultUnauthorized
+	}
+
+	return o.handleOverride(ctx, override)
+}
+
+func (o *DevModeOverride) handleOverride(ctx context.HTTPContext, override string) string {
+	buff, err := base64.StdEncoding.DecodeString(override)
+	if err != nil {
+		ctx.Response().SetStatusCode(http.StatusBadRequest)
+		ctx.AddTag(fmt.Sprintf("decode override failed: %v", err))
+		return resultInvalidOverride
+	}
+
+	pipeCtx, ok := httppipeline.GetPipelineContext(ctx)
+	if !ok {
+		logger.Errorf("BUG: no pipeline context for %s", o.pipeSpec.Name())
+		ctx.Response().SetStatusCode(http.StatusInternalServerError)
+		return resultInvalidOverride
+	}
+
+	err = pipeCtx.Pipeline().HandleWithOverride(ctx, buff)
+	if err != nil {
+		ctx.Response().SetStatusCode(http.StatusBadRequest)
+		ctx.AddTag(fmt.Sprintf("override pipeline failed: %v", err))
+		return resultInvalidOverride
+	}
+
+	atomic.AddUint64(&o.overrides, 1)
+	logger.Infof("%s: request %s %s handled by overridden pipeline",
+		o.pipeSpec.Name(), ctx.Request().Method(), ctx.Request().Path())
+
+	return resultOverridden
+}
+
+// Status returns Status.
+func (o *DevModeOverride) Status() interface{} {
+	return &Status{Overrides: atomic.LoadUint64(&o.overrides)}
+}
+
+// Close closes DevModeOverride.
+func (o *DevModeOverride) Close() {}
@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package devmodeoverride
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/tracing"
+)
+
+func newTestContext(override, token string) (context.HTTPContext, *http.Request) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if override != "" {
+		req.Header.Set(OverrideHeader, base64.StdEncoding.EncodeToString([]byte(override)))
+	}
+	if token != "" {
+		req.Header.Set(TokenHeader, token)
+	}
+	ctx := context.New(httptest.NewRecorder(), req, tracing.NoopTracing, "no trace")
+	ctx.SetHandlerCaller(func(lastResult string) string {
+		return lastResult
+	})
+	return ctx, req
+}
+
+func TestSpecValidate(t *testing.T) {
+	if err := (Spec{EnableDevMode: true}).Validate(); err == nil {
+		t.Errorf("want error for dev mode without token")
+	}
+	if err := (Spec{EnableDevMode: true, Token: "secret"}).Validate(); err != nil {
+		t.Errorf("want valid spec, got %v", err)
+	}
+}
+
+func TestHandle(t *testing.T) {
+	o := &DevModeOverride{spec: &Spec{Token: "secret"}}
+	ctx, req := newTestContext("filters: []", "secret")
+	if result := o.Handle(ctx); result != "" {
+		t.Errorf("want override ignored out of dev mode, got %s", result)
+	}
+	if req.Header.Get(OverrideHeader) != "" || req.Header.Get(TokenHeader) != "" {
+		t.Errorf("want override headers removed")
+	}
+
+	o.spec.EnableDevMode = true
+	ctx, _ = newTestContext("", "")
+	if result := o.Handle(ctx); result != "" {
+		t.Errorf("want pass without override, got %s", result)
+	}
+
+	ctx, _ = newTestContext("filters: []", "wrong")
+	if result := o.Handle(ctx); result != resultUnauthorized {
+		t.Errorf("want %s, got %s", resultUnauthorized, result)
+	}
+	if code := ctx.Response().StatusCode(); code != http.StatusUnauthorized {
+		t.Errorf("want status %d, got %d", http.StatusUnauthorized, code)
+	}
+
+	ctx, req = newTestContext("", "secret")
+	req.Header.Set(OverrideHeader, "not base64")
+	if result := o.Handle(ctx); result != resultInvalidOverride {
+		t.Errorf("want %s, got %s", resultInvalidOverride, result)
+	}
+}
@@ -0,0 +1,381 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dualwrite
+
+import (
+	"bytes"
+	stdcontext "context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/protocol"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/iotool"
+	librl "github.com/megaease/easegress/pkg/util/ratelimiter"
+)
+
+const (
+	// Kind is the kind of DualWrite.
+	Kind = "DualWrite"
+
+	resultPrimaryNotFound = "primaryNotFound"
+)
+
+var (
+	results = []string{resultPrimaryNotFound}
+)
+
+func init() {
+	httppipeline.Register(&DualWrite{})
+}
+
+type (
+	// DualWrite sends mutating requests to both the primary and the
+	// secondary pipelines, and responds with the primary response.
+	DualWrite struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+
+		timeout time.Duration
+		rl      *librl.RateLimiter
+
+		// The counters are accessed atomically.
+		mirrored        uint64
+		throttled       uint64
+		secondaryFailed uint64
+		discrepancies   uint64
+	}
+
+	// Spec describes the DualWrite.
+	Spec struct {
+		Primary   string `yaml:"primary" jsonschema:"required"`
+		Secondary string `yaml:"secondary" jsonschema:"required"`
+		// ShadowWrite writes the secondary asynchronously,
+		// so the response never waits for it.
+		ShadowWrite bool `yaml:"shadowWrite"`
+		// CompareBody compares the bodies besides the status codes.
+		CompareBody bool `yaml:"compareBody"`
+		// MaxBodyBytes bounds the bodies buffered for the secondary and
+		// the comparison, larger requests are written to the primary only.
+		MaxBodyBytes int64  `yaml:"maxBodyBytes" jsonschema:"omitempty,minimum=1"`
+		Timeout      string `yaml:"timeout" jsonschema:"omitempty,format=duration"`
+
+		SecondaryRateLimit *RateLimitSpec `yaml:"secondaryRateLimit,omitempty" jsonschema:"omitempty"`
+	}
+
+	// RateLimitSpec throttles the writes to the secondary,
+	// the throttled ones are written to the primary only.
+	RateLimitSpec struct {
+		TimeoutDuration    string `yaml:"timeoutDuration" jsonschema:"omitempty,format=duration"`
+		LimitRefreshPeriod string `yaml:"limitRefreshPeriod" jsonschema:"omitempty,format=duration"`
+		LimitForPeriod     int    `yaml:"limitForPeriod" jsonschema:"omitempty,minimum=1"`
+	}
+
+	// Status is the status of DualWrite.
+	Status struct {
+		Mirrored        uint64 `yaml:"mirrored"`
+		Throttled       uint64 `yaml:"throttled"`
+		SecondaryFailed uint64 `yaml:"secondaryFailed"`
+		Discrepancies   uint64 `yaml:"discrepancies"`
+	}
+
+	// writeResult is the response of a write to be compared.
+	writeResult struct {
+		statusCode int
+		// body is nil if it's not compared or too large.
+		body []byte
+		err  error
+	}
+
+	readCloser struct {
+		io.Reader
+		closer io.Closer
+	}
+
+	// discardResponseWriter discards the secondary response,
+	// it has been read before flushing.
+	discardResponseWriter struct {
+		header http.Header
+	}
+)
+
+// Kind returns the kind of DualWrite.
+func (dw *DualWrite) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of DualWrite.
+func (dw *DualWrite) DefaultSpec() interface{} {
+	return &Spec{
+		MaxBodyBytes: 1024 * 1024,
+		Timeout:      "30s",
+	}
+}
+
+// Description returns the description of DualWrite.
+func (dw *DualWrite) Description() string {
+	return "DualWrite writes mutating requests to both primary and secondary pipelines."
+}
+
+// Results returns the results of DualWrite.
+func (dw *DualWrite) Results() []string {
+	return results
+}
+
+// Init initializes DualWrite.
+func (dw *DualWrite) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	dw.pipeSpec, dw.spec, dw.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	dw.reload()
+}
+
+// Inherit inherits previous generation of DualWrite.
+func (dw *DualWrite) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	previousGeneration.Close()
+	dw.Init(pipeSpec, super)
+}
+
+func (dw *DualWrite) reload() {
+	dw.timeout = 30 * time.Second
+	if d, err := time.ParseDuration(dw.spec.Timeout); err == nil {
+		dw.timeout = d
+	} else if dw.spec.Timeout != "" {
+		logger.Errorf("BUG: parse duration %s failed: %v", dw.spec.Timeout, err)
+	}
+
+	dw.rl = nil
+	if rls := dw.spec.SecondaryRateLimit; rls != nil {
+		dw.rl = newRateLimiter(rls)
+	}
+}
+
+func newRateLimiter(spec *RateLimitSpec) *librl.RateLimiter {
+	policy := librl.NewPolicy()
+
+	if spec.LimitForPeriod > 0 {
+		policy.LimitForPeriod = spec.LimitForPeriod
+	}
+	if d, err := time.ParseDuration(spec.TimeoutDuration); err == nil {
+		policy.TimeoutDuration = d
+	}
+	if d, err := time.ParseDuration(spec.LimitRefreshPeriod); err == nil && d > 0 {
+		policy.LimitRefreshPeriod = d
+	}
+
+	return librl.New(policy)
+}
+
+// Handle writes the request to both pipelines if it's mutating.
+func (dw *DualWrite) Handle(ctx context.HTTPContext) (result string) {
+	result = dw.handle(ctx)
+	return ctx.CallNextHandler(result)
+}
+
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+func getHandler(name string) (protocol.HTTPHandler, bool) {
+	ro, exists := supervisor.Global.GetRunningObject(name, supervisor.CategoryPipeline)
+	if !exists {
+		return nil, false
+	}
+	handler, ok := ro.Instance().(protocol.HTTPHandler)
+	return handler, ok
+}
+
+func (dw *DualWrite) handle(ctx context.HTTPContext) string {
+	primary, ok := getHandler(dw.spec.Primary)
+	if !ok {
+		logger.Errorf("%s: primary pipeline %s not found", dw.pipeSpec.Name(), dw.spec.Primary)
+		ctx.Response().SetStatusCode(http.StatusServiceUnavailable)
+		return resultPrimaryNotFound
+	}
+
+	if !isMutating(ctx.Request().Method()) {
+		primary.Handle(ctx)
+		return ""
+	}
+
+	body, complete := iotool.ReadLimited(ctx.Request().Body(), dw.spec.MaxBodyBytes)
+	if !complete {
+		ctx.Request().SetBody(io.MultiReader(bytes.NewReader(body), ctx.Request().Body()))
+		ctx.AddTag(fmt.Sprintf("dualWrite: request body exceeds %dB, secondary skipped",
+			dw.spec.MaxBodyBytes))
+		primary.Handle(ctx)
+		return ""
+	}
+	ctx.Request().SetBody(bytes.NewReader(body))
+
+	var wait time.Duration
+	if dw.rl != nil {
+		var permitted bool
+		permitted, wait = dw.rl.AcquirePermission()
+		if !permitted {
+			atomic.AddUint64(&dw.throttled, 1)
+			primary.Handle(ctx)
+			return ""
+		}
+	}
+	atomic.AddUint64(&dw.mirrored, 1)
+
+	// NOTE: The shadow write must outlive the request.
+	var parent stdcontext.Context = ctx
+	if dw.spec.ShadowWrite {
+		parent = stdcontext.Background()
+	}
+	stdctx, cancel := stdcontext.WithTimeout(parent, dw.timeout)
+	req := ctx.Request().Std().Clone(stdctx)
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+
+	secondaryResult := make(chan *writeResult, 1)
+	go func() {
+		defer cancel()
+		if wait > 0 {
+			time.Sleep(wait)
+		}
+		secondaryResult <- dw.writeSecondary(req)
+	}()
+
+	method, path := ctx.Request().Method(), ctx.Request().Path()
+	primary.Handle(ctx)
+	primaryResult := dw.primaryResult(ctx)
+
+	if dw.spec.ShadowWrite {
+		go func() {
+			dw.compare(method, path, primaryResult, <-secondaryResult)
+		}()
+	} else {
+		dw.compare(method, path, primaryResult, <-secondaryResult)
+	}
+
+	return ""
+}
+
+func (dw *DualWrite) primaryResult(ctx context.HTTPContext) *writeResult {
+	result := &writeResult{statusCode: ctx.Response().StatusCode()}
+	if !dw.spec.CompareBody {
+		return result
+	}
+
+	original := ctx.Response().Body()
+	body, complete := iotool.ReadLimited(original, dw.spec.MaxBodyBytes)
+
+	// NOTE: Keep the original closer, it releases the upstream connection.
+	closer, _ := original.(io.Closer)
+	var rest io.Reader = bytes.NewReader(body)
+	if !complete {
+		rest = io.MultiReader(rest, original)
+	} else {
+		result.body = body
+	}
+	ctx.Response().SetBody(&readCloser{Reader: rest, closer: closer})
+
+	return result
+}
+
+func (dw *DualWrite) writeSecondary(req *http.Request) *writeResult {
+	secondary, ok := getHandler(dw.spec.Secondary)
+	if !ok {
+		return &writeResult{err: fmt.Errorf("secondary pipeline %s not found", dw.spec.Secondary)}
+	}
+
+	w := &discardResponseWriter{header: http.Header{}}
+	copyCtx := context.New(w, req, tracing.NoopTracing, "no trace")
+	defer copyCtx.Finish()
+
+	secondary.Handle(copyCtx)
+
+	result := &writeResult{statusCode: copyCtx.Response().StatusCode()}
+	if dw.spec.CompareBody {
+		body, complete := iotool.ReadLimited(copyCtx.Response().Body(), dw.spec.MaxBodyBytes)
+		if complete {
+			result.body = body
+		}
+	}
+
+	return result
+}
+
+// compare logs the discrepancy between the primary and secondary writes.
+func (dw *DualWrite) compare(method, path string, primary, secondary *writeResult) {
+	if secondary.err != nil {
+		atomic.AddUint64(&dw.secondaryFailed, 1)
+		logger.Warnf("dualWrite secondary failed: filter=%s method=%s path=%s secondary=%s err=%v",
+			dw.pipeSpec.Name(), method, path, dw.spec.Secondary, secondary.err)
+		return
+	}
+
+	bodyDiffers := primary.body != nil && secondary.body != nil &&
+		!bytes.Equal(primary.body, secondary.body)
+	if primary.statusCode == secondary.statusCode && !bodyDiffers {
+		return
+	}
+
+	atomic.AddUint64(&dw.discrepancies, 1)
+	logger.Warnf("dualWrite discrepancy: filter=%s method=%s path=%s "+
+		"primary=%s primaryStatus=%d secondary=%s secondaryStatus=%d bodyDiffers=%v",
+		dw.pipeSpec.Name(), method, path,
+		dw.spec.Primary, primary.statusCode, dw.spec.Secondary, secondary.statusCode, bodyDiffers)
+}
+
+// Status returns status.
+func (dw *DualWrite) Status() interface{} {
+	return &Status{
+		Mirrored:        atomic.LoadUint64(&dw.mirrored),
+		Throttled:       atomic.LoadUint64(&dw.throttled),
+		SecondaryFailed: atomic.LoadUint64(&dw.secondaryFailed),
+		Discrepancies:   atomic.LoadUint64(&dw.discrepancies),
+	}
+}
+
+// Close closes DualWrite.
+func (dw *DualWrite) Close() {}
+
+func (rc *readCloser) Close() error {
+	if rc.closer == nil {
+		return nil
+	}
+	return rc.closer.Close()
+}
+
+func (w *discardResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *discardResponseWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (w *discardResponseWriter) WriteHeader(statusCode int) {}
@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dualwrite
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+type closeRecorder struct {
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestReadCloser(t *testing.T) {
+	c := &closeRecorder{}
+	rc := &readCloser{Reader: bytes.NewReader([]byte("body")), closer: c}
+	body, _ := ioutil.ReadAll(rc)
+	if string(body) != "body" {
+		t.Fatalf("want body, got %s", body)
+	}
+	rc.Close()
+	if !c.closed {
+		t.Fatalf("want the original body closed")
+	}
+
+	rc = &readCloser{Reader: bytes.NewReader(nil)}
+	if rc.Close() != nil {
+		t.Fatalf("want nil error without closer")
+	}
+}
+
+func TestIsMutating(t *testing.T) {
+	for _, m := range []string{"POST", "PUT", "PATCH", "DELETE"} {
+		if !isMutating(m) {
+			t.Errorf("want %s mutating", m)
+		}
+	}
+	for _, m := range []string{"GET", "HEAD", "OPTIONS"} {
+		if isMutating(m) {
+			t.Errorf("want %s not mutating", m)
+		}
+	}
+}
+
+func TestSecondaryRateLimit(t *testing.T) {
+	rl := newRateLimiter(&RateLimitSpec{
+		TimeoutDuration:    "0s",
+		LimitRefreshPeriod: "1h",
+		LimitForPeriod:     2,
+	})
+
+	for i := 0; i < 2; i++ {
+		permitted, wait := rl.AcquirePermission()
+		if !permitted || wait != 0 {
+			t.Fatalf("write %d: want permitted without waiting, got %v %v", i, permitted, wait)
+		}
+	}
+	permitted, _ := rl.AcquirePermission()
+	if permitted {
+		t.Fatalf("want throttled after the limit")
+	}
+
+	dw := &DualWrite{spec: &Spec{SecondaryRateLimit: &RateLimitSpec{LimitForPeriod: 1}}}
+	dw.reload()
+	if dw.rl == nil || dw.timeout != 30*time.Second {
+		t.Fatalf("want rate limiter and default timeout, got %v %v", dw.rl, dw.timeout)
+	}
+}
@@ -0,0 +1,109 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package fieldencryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// encryptedPrefix marks the encrypted values, which are in the format
+// enc:<key id>:<base64url of nonce and sealed json of the value>.
+const encryptedPrefix = "enc:"
+
+func newGCM(key *Key) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key.Secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// encryptValue encrypts any json value into a string,
+// the key ID is authenticated as the additional data.
+func encryptValue(key *Key, value interface{}) (string, error) {
+	plaintext, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("marshal value to json failed: %v", err)
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return "", fmt.Errorf("generate nonce failed: %v", err)
+	}
+
+	sealed := gcm.Seal(nonce, nonce, plaintext, []byte(key.ID))
+
+	return encryptedPrefix + key.ID + ":" + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// decryptValue decrypts the value encrypted by encryptValue
+// with the key of the ID carried in it.
+func decryptValue(ks KeyStore, value interface{}) (interface{}, error) {
+	s, ok := value.(string)
+	if !ok || !strings.HasPrefix(s, encryptedPrefix) {
+		return nil, fmt.Errorf("value is not encrypted")
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(s, encryptedPrefix), ":", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("key id not found in encrypted value")
+	}
+
+	key, err := ks.Key(parts[0])
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("decode encrypted value failed: %v", err)
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("encrypted value too short")
+	}
+
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, []byte(key.ID))
+	if err != nil {
+		return nil, fmt.Errorf("decrypt value by key %s failed: %v", key.ID, err)
+	}
+
+	result, err := unmarshalJSON(plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal decrypted value to json failed: %v", err)
+	}
+
+	return result, nil
+}
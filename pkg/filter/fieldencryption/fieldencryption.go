@@ -0,0 +1,298 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package fieldencryption
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of FieldEncryption.
+	Kind = "FieldEncryption"
+
+	resultDecryptFailed = "decryptFailed"
+	resultEncryptFailed = "encryptFailed"
+)
+
+var (
+	results = []string{resultDecryptFailed, resultEncryptFailed}
+)
+
+func init() {
+	httppipeline.Register(&FieldEncryption{})
+}
+
+type (
+	// FieldEncryption is filter decrypting fields of the JSON request body,
+	// and encrypting fields of the JSON response body, by AES-256-GCM.
+	FieldEncryption struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+
+		keyStore KeyStore
+		// keyStoreInherited means the key store is handed over
+		// to the next generation, so it must not be closed.
+		keyStoreInherited bool
+		decryptFields     []*fieldPath
+		encryptFields     []*fieldPath
+	}
+
+	// Spec describes the FieldEncryption.
+	Spec struct {
+		KeyStore *KeyStoreSpec `yaml:"keyStore" jsonschema:"required"`
+		// DecryptRequestFields are the JSONPath of fields decrypted in requests.
+		DecryptRequestFields []string `yaml:"decryptRequestFields" jsonschema:"omitempty"`
+		// EncryptResponseFields are the JSONPath of fields encrypted in responses.
+		EncryptResponseFields []string `yaml:"encryptResponseFields" jsonschema:"omitempty"`
+	}
+)
+
+// Validate validates Spec.
+func (spec Spec) Validate() error {
+	for _, fields := range [][]string{spec.DecryptRequestFields, spec.EncryptResponseFields} {
+		for _, field := range fields {
+			_, err := parseFieldPath(field)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func parseFieldPaths(fields []string) []*fieldPath {
+	paths := make([]*fieldPath, 0, len(fields))
+	for _, field := range fields {
+		fp, err := parseFieldPath(field)
+		if err != nil {
+			logger.Errorf("BUG: parse field path %s failed: %v", field, err)
+			continue
+		}
+		paths = append(paths, fp)
+	}
+
+	return paths
+}
+
+// Kind returns the kind of FieldEncryption.
+func (fe *FieldEncryption) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of FieldEncryption.
+func (fe *FieldEncryption) DefaultSpec() interface{} {
+	return &Spec{}
+}
+
+// Description returns the description of FieldEncryption.
+func (fe *FieldEncryption) Description() string {
+	return "FieldEncryption decrypts fields of requests and encrypts fields of responses."
+}
+
+// Results returns the results of FieldEncryption.
+func (fe *FieldEncryption) Results() []string {
+	return results
+}
+
+// Init initializes FieldEncryption.
+func (fe *FieldEncryption) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	fe.pipeSpec, fe.spec, fe.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	fe.reload()
+}
+
+// Inherit inherits previous generation of FieldEncryption.
+func (fe *FieldEncryption) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	fe.pipeSpec, fe.spec, fe.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+
+	// NOTE: Keep the key store along with its retired keys,
+	// since the values encrypted by them may be still in flight.
+	prev := previousGeneration.(*FieldEncryption)
+	if reflect.DeepEqual(prev.spec.KeyStore, fe.spec.KeyStore) {
+		fe.keyStore = prev.keyStore
+		prev.keyStoreInherited = true
+	}
+
+	previousGeneration.Close()
+	fe.reload()
+}
+
+func (fe *FieldEncryption) reload() {
+	if fe.keyStore == nil {
+		fe.keyStore = newKeyStore(fe.spec.KeyStore)
+	}
+	fe.decryptFields = parseFieldPaths(fe.spec.DecryptRequestFields)
+	fe.encryptFields = parseFieldPaths(fe.spec.EncryptResponseFields)
+}
+
+// Handle decrypts the request, calls the next handler,
+// and encrypts the response.
+func (fe *FieldEncryption) Handle(ctx context.HTTPContext) string {
+	result := fe.decryptRequest(ctx)
+	result = ctx.CallNextHandler(result)
+
+	if encryptResult := fe.encryptResponse(ctx); encryptResult != "" {
+		return encryptResult
+	}
+
+	return result
+}
+
+func (fe *FieldEncryption) decryptRequest(ctx context.HTTPContext) string {
+	if len(fe.decryptFields) == 0 {
+		return ""
+	}
+
+	r := ctx.Request()
+	if !isJSON(r.Header().Get(httpheader.KeyContentType)) {
+		return ""
+	}
+
+	decrypt := func(value interface{}) (interface{}, error) {
+		return decryptValue(fe.keyStore, value)
+	}
+
+	body, err := transformBody(r.Body(), fe.decryptFields, decrypt)
+	if err != nil {
+		ctx.Response().SetStatusCode(http.StatusBadRequest)
+		ctx.AddTag(stringtool.Cat("fieldEncryption: decrypt request failed: ", err.Error()))
+		return resultDecryptFailed
+	}
+
+	r.SetBody(bytes.NewReader(body))
+	r.Header().Set(httpheader.KeyContentLength, strconv.Itoa(len(body)))
+
+	return ""
+}
+
+func (fe *FieldEncryption) encryptResponse(ctx context.HTTPContext) string {
+	w := ctx.Response()
+	if len(fe.encryptFields) == 0 || w.Body() == nil {
+		return ""
+	}
+
+	if !isJSON(w.Header().Get(httpheader.KeyContentType)) {
+		return ""
+	}
+
+	// NOTE: Use the same key for the whole response,
+	// even if the key is rotating at the moment.
+	key, err := fe.keyStore.CurrentKey()
+	encrypt := func(value interface{}) (interface{}, error) {
+		return encryptValue(key, value)
+	}
+
+	var body []byte
+	if err == nil {
+		body, err = transformBody(w.Body(), fe.encryptFields, encrypt)
+	}
+	if err != nil {
+		// NOTE: Never leak the plaintext of the fields.
+		w.SetStatusCode(http.StatusInternalServerError)
+		w.SetBody(nil)
+		w.Header().Del(httpheader.KeyContentLength)
+		ctx.AddTag(stringtool.Cat("fieldEncryption: encrypt response failed: ", err.Error()))
+		return resultEncryptFailed
+	}
+
+	w.SetBody(bytes.NewReader(body))
+	w.Header().Set(httpheader.KeyContentLength, strconv.Itoa(len(body)))
+
+	return ""
+}
+
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return mediaType == "application/json"
+}
+
+func unmarshalJSON(buff []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(buff))
+	// NOTE: Keep numbers as they are, float64 loses precision.
+	decoder.UseNumber()
+
+	var doc interface{}
+	err := decoder.Decode(&doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+func transformBody(body io.Reader, fields []*fieldPath, fn transformFunc) ([]byte, error) {
+	buff, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("read body failed: %v", err)
+	}
+	if len(bytes.TrimSpace(buff)) == 0 {
+		return buff, nil
+	}
+
+	doc, err := unmarshalJSON(buff)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal body to json failed: %v", err)
+	}
+
+	for _, fp := range fields {
+		doc, err = fp.transform(doc, fn)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", fp.raw, err)
+		}
+	}
+
+	buff, err = json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("marshal body to json failed: %v", err)
+	}
+
+	return buff, nil
+}
+
+// Status returns status.
+func (fe *FieldEncryption) Status() interface{} {
+	return nil
+}
+
+// Close closes FieldEncryption.
+func (fe *FieldEncryption) Close() {
+	if !fe.keyStoreInherited {
+		fe.keyStore.Close()
+	}
+}
@@ -0,0 +1,167 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package fieldencryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
+)
+
+var tempDir string
+
+func TestMain(m *testing.M) {
+	var err error
+	tempDir, err = ioutil.TempDir("", "eg-fieldencryption-test")
+	if err != nil {
+		panic(err)
+	}
+	absLogDir := filepath.Join(tempDir, "log")
+	os.MkdirAll(absLogDir, 0755)
+	logger.Init(&option.Options{
+		Name:      "fieldencryption-for-log",
+		AbsLogDir: absLogDir,
+	})
+
+	code := m.Run()
+
+	logger.Sync()
+	os.RemoveAll(tempDir)
+
+	os.Exit(code)
+}
+
+func newTestSecret(t *testing.T) string {
+	secret := make([]byte, keySize)
+	_, err := rand.Read(secret)
+	if err != nil {
+		t.Fatalf("generate secret failed: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(secret)
+}
+
+func writeTestKeys(t *testing.T, path string, current string, keys map[string]string) {
+	buff := bytes.NewBufferString(fmt.Sprintf("current: %s\n", current))
+	for id, secret := range keys {
+		fmt.Fprintf(buff, "%s: %s\n", id, secret)
+	}
+	err := ioutil.WriteFile(path, buff.Bytes(), 0600)
+	if err != nil {
+		t.Fatalf("write keys failed: %v", err)
+	}
+}
+
+func TestTransformBody(t *testing.T) {
+	path := filepath.Join(tempDir, "transform-keys.yaml")
+	writeTestKeys(t, path, "k1", map[string]string{"k1": newTestSecret(t)})
+	ks := newKeyStore(&KeyStoreSpec{File: &FileKeyStoreSpec{Path: path}})
+	defer ks.Close()
+
+	key, err := ks.CurrentKey()
+	if err != nil {
+		t.Fatalf("get current key failed: %v", err)
+	}
+
+	fields := parseFieldPaths([]string{"$.card.number", "$.items[*].ssn", "missing.field"})
+	body := `{"card":{"number":"4111111111111111","cvc":123},"items":[{"ssn":"1"},{"ssn":12345678901234567890}]}`
+
+	encrypted, err := transformBody(strings.NewReader(body), fields, func(v interface{}) (interface{}, error) {
+		return encryptValue(key, v)
+	})
+	if err != nil {
+		t.Fatalf("encrypt failed: %v", err)
+	}
+	for _, plain := range []string{"4111111111111111", `"1"`, "12345678901234567890"} {
+		if strings.Contains(string(encrypted), plain) {
+			t.Errorf("plaintext %s found in %s", plain, encrypted)
+		}
+	}
+	if !strings.Contains(string(encrypted), `"enc:k1:`) || !strings.Contains(string(encrypted), `"cvc":123`) {
+		t.Errorf("unexpected encrypted body %s", encrypted)
+	}
+
+	decrypted, err := transformBody(bytes.NewReader(encrypted), fields, func(v interface{}) (interface{}, error) {
+		return decryptValue(ks, v)
+	})
+	if err != nil {
+		t.Fatalf("decrypt failed: %v", err)
+	}
+	want := `{"card":{"cvc":123,"number":"4111111111111111"},"items":[{"ssn":"1"},{"ssn":12345678901234567890}]}`
+	if string(decrypted) != want {
+		t.Errorf("want %s, got %s", want, decrypted)
+	}
+
+	_, err = transformBody(strings.NewReader(body), fields, func(v interface{}) (interface{}, error) {
+		return decryptValue(ks, v)
+	})
+	if err == nil {
+		t.Errorf("want error for decrypting plaintext")
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	path := filepath.Join(tempDir, "rotation-keys.yaml")
+	k1, k2 := newTestSecret(t), newTestSecret(t)
+	writeTestKeys(t, path, "k1", map[string]string{"k1": k1})
+	ks := newKeyStore(&KeyStoreSpec{
+		File:          &FileKeyStoreSpec{Path: path},
+		RetiredKeyTTL: "100ms",
+	}).(*refreshingKeyStore)
+	defer ks.Close()
+
+	key, _ := ks.CurrentKey()
+	inFlight, err := encryptValue(key, "secret")
+	if err != nil {
+		t.Fatalf("encrypt failed: %v", err)
+	}
+
+	// NOTE: Rotate to k2 and remove k1 at once.
+	writeTestKeys(t, path, "k2", map[string]string{"k2": k2})
+	ks.reload()
+
+	if key, _ := ks.CurrentKey(); key.ID != "k2" {
+		t.Errorf("want current key k2, got %s", key.ID)
+	}
+	value, err := decryptValue(ks, inFlight)
+	if err != nil || value != "secret" {
+		t.Errorf("want in-flight value decrypted by retired key, got %v, %v", value, err)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	ks.reload()
+	_, err = decryptValue(ks, inFlight)
+	if err == nil {
+		t.Errorf("want expired retired key removed")
+	}
+
+	// NOTE: Keep the last good keys.
+	writeTestKeys(t, path, "k3", map[string]string{"k2": k2})
+	ks.reload()
+	if key, _ := ks.CurrentKey(); key.ID != "k2" {
+		t.Errorf("want current key k2 kept, got %s", key.ID)
+	}
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package fieldencryption
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type (
+	// fieldPath is a subset of JSONPath locating the fields,
+	// such as $.card.number, $.items[0].ssn and $.items[*].ssn.
+	fieldPath struct {
+		raw      string
+		segments []*pathSegment
+	}
+
+	pathSegment struct {
+		name     string
+		index    int
+		isIndex  bool
+		wildcard bool
+	}
+
+	transformFunc func(value interface{}) (interface{}, error)
+)
+
+func parseFieldPath(raw string) (*fieldPath, error) {
+	s := strings.TrimPrefix(strings.TrimSpace(raw), "$")
+	fp := &fieldPath{raw: raw}
+
+	for len(s) > 0 {
+		switch s[0] {
+		case '.':
+			s = s[1:]
+			end := strings.IndexAny(s, ".[")
+			if end == -1 {
+				end = len(s)
+			}
+			name := s[:end]
+			if name == "" {
+				return nil, fmt.Errorf("%s: empty field name", raw)
+			}
+			if name == "*" {
+				fp.segments = append(fp.segments, &pathSegment{wildcard: true})
+			} else {
+				fp.segments = append(fp.segments, &pathSegment{name: name})
+			}
+			s = s[end:]
+		case '[':
+			end := strings.IndexByte(s, ']')
+			if end == -1 {
+				return nil, fmt.Errorf("%s: unclosed bracket", raw)
+			}
+			inner := s[1:end]
+			if inner == "*" {
+				fp.segments = append(fp.segments, &pathSegment{wildcard: true})
+			} else {
+				index, err := strconv.Atoi(inner)
+				if err != nil || index < 0 {
+					return nil, fmt.Errorf("%s: invalid index %s", raw, inner)
+				}
+				fp.segments = append(fp.segments, &pathSegment{index: index, isIndex: true})
+			}
+			s = s[end+1:]
+		default:
+			if len(fp.segments) != 0 {
+				return nil, fmt.Errorf("%s: unexpected %q", raw, s[0])
+			}
+			// NOTE: The leading $. is optional.
+			s = "." + s
+		}
+	}
+
+	if len(fp.segments) == 0 {
+		return nil, fmt.Errorf("%s: no field", raw)
+	}
+
+	return fp, nil
+}
+
+// transform replaces the located values in place with the results of fn,
+// the missing fields are skipped.
+func (fp *fieldPath) transform(doc interface{}, fn transformFunc) (interface{}, error) {
+	return transformSegments(doc, fp.segments, fn)
+}
+
+func transformSegments(node interface{}, segments []*pathSegment, fn transformFunc) (interface{}, error) {
+	if len(segments) == 0 {
+		return fn(node)
+	}
+
+	seg, rest := segments[0], segments[1:]
+	var err error
+	switch v := node.(type) {
+	case map[string]interface{}:
+		if seg.isIndex {
+			return node, nil
+		}
+		if seg.wildcard {
+			for k := range v {
+				v[k], err = transformSegments(v[k], rest, fn)
+				if err != nil {
+					return nil, err
+				}
+			}
+			return node, nil
+		}
+		child, exists := v[seg.name]
+		if !exists {
+			return node, nil
+		}
+		v[seg.name], err = transformSegments(child, rest, fn)
+		if err != nil {
+			return nil, err
+		}
+	case []interface{}:
+		if seg.wildcard {
+			for i := range v {
+				v[i], err = transformSegments(v[i], rest, fn)
+				if err != nil {
+					return nil, err
+				}
+			}
+			return node, nil
+		}
+		if !seg.isIndex || seg.index >= len(v) {
+			return node, nil
+		}
+		v[seg.index], err = transformSegments(v[seg.index], rest, fn)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return node, nil
+}
@@ -0,0 +1,54 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package fieldencryption
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"gopkg.in/yaml.v2"
+)
+
+type (
+	// FileKeyStoreSpec describes the keys in a local YAML file, such as:
+	//
+	//   current: k2
+	//   k1: <base64 encoded key>
+	//   k2: <base64 encoded key>
+	//
+	// Rotate keys by adding a new key and pointing current to it.
+	FileKeyStoreSpec struct {
+		Path string `yaml:"path" jsonschema:"required"`
+	}
+)
+
+func newFileKeyLoader(spec *FileKeyStoreSpec) keyLoader {
+	return func() (map[string]string, error) {
+		buff, err := ioutil.ReadFile(spec.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		entries := map[string]string{}
+		err = yaml.Unmarshal(buff, &entries)
+		if err != nil {
+			return nil, fmt.Errorf("unmarshal %s to yaml failed: %v", spec.Path, err)
+		}
+
+		return entries, nil
+	}
+}
@@ -0,0 +1,268 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package fieldencryption
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const (
+	// keyIDCurrent is the entry naming the key for encryption,
+	// the other entries are key IDs to base64 encoded AES-256 keys.
+	keyIDCurrent = "current"
+
+	keySize = 32
+
+	defaultRefreshInterval = 30 * time.Second
+	defaultRetiredKeyTTL   = 5 * time.Minute
+)
+
+type (
+	// KeyStore provides versioned keys, the current key encrypts values,
+	// and any known key decrypts values by the key ID carried in them.
+	KeyStore interface {
+		CurrentKey() (*Key, error)
+		Key(id string) (*Key, error)
+		Close()
+	}
+
+	// Key is a versioned AES-256 key.
+	Key struct {
+		ID     string
+		Secret []byte
+	}
+
+	// KeyStoreSpec describes the KeyStore, exactly one of File and Vault is required.
+	KeyStoreSpec struct {
+		File  *FileKeyStoreSpec  `yaml:"file,omitempty" jsonschema:"omitempty"`
+		Vault *VaultKeyStoreSpec `yaml:"vault,omitempty" jsonschema:"omitempty"`
+
+		// RefreshInterval is the interval to reload keys for the rotation.
+		RefreshInterval string `yaml:"refreshInterval" jsonschema:"omitempty,format=duration"`
+		// RetiredKeyTTL is how long a key removed from the source still decrypts,
+		// so that values encrypted by it in flight won't break.
+		RetiredKeyTTL string `yaml:"retiredKeyTTL" jsonschema:"omitempty,format=duration"`
+	}
+
+	keySet struct {
+		current *Key
+		keys    map[string]*Key
+	}
+
+	keyLoader func() (map[string]string, error)
+
+	// refreshingKeyStore reloads keys from the source periodically,
+	// it keeps the last good keys if reloading failed.
+	refreshingKeyStore struct {
+		source          string
+		load            keyLoader
+		refreshInterval time.Duration
+		retiredKeyTTL   time.Duration
+
+		// keySet is *keySet
+		keySet  atomic.Value
+		retired map[string]time.Time
+
+		done chan struct{}
+	}
+)
+
+// Validate validates KeyStoreSpec.
+func (spec KeyStoreSpec) Validate() error {
+	if (spec.File == nil) == (spec.Vault == nil) {
+		return fmt.Errorf("exactly one of file and vault is required")
+	}
+
+	return nil
+}
+
+func (spec *KeyStoreSpec) durations() (refreshInterval, retiredKeyTTL time.Duration) {
+	refreshInterval, retiredKeyTTL = defaultRefreshInterval, defaultRetiredKeyTTL
+
+	if spec.RefreshInterval != "" {
+		d, err := time.ParseDuration(spec.RefreshInterval)
+		if err != nil {
+			logger.Errorf("BUG: parse duration %s failed: %v", spec.RefreshInterval, err)
+		} else {
+			refreshInterval = d
+		}
+	}
+
+	if spec.RetiredKeyTTL != "" {
+		d, err := time.ParseDuration(spec.RetiredKeyTTL)
+		if err != nil {
+			logger.Errorf("BUG: parse duration %s failed: %v", spec.RetiredKeyTTL, err)
+		} else {
+			retiredKeyTTL = d
+		}
+	}
+
+	return
+}
+
+// newKeyStore creates the KeyStore, it never fails
+// but keeps retrying if the keys are unavailable.
+func newKeyStore(spec *KeyStoreSpec) KeyStore {
+	refreshInterval, retiredKeyTTL := spec.durations()
+
+	var source string
+	var load keyLoader
+	if spec.File != nil {
+		source, load = "file "+spec.File.Path, newFileKeyLoader(spec.File)
+	} else {
+		source, load = "vault "+spec.Vault.Address, newVaultKeyLoader(spec.Vault)
+	}
+
+	ks := &refreshingKeyStore{
+		source:          source,
+		load:            load,
+		refreshInterval: refreshInterval,
+		retiredKeyTTL:   retiredKeyTTL,
+		retired:         make(map[string]time.Time),
+		done:            make(chan struct{}),
+	}
+	ks.keySet.Store(&keySet{keys: map[string]*Key{}})
+
+	ks.reload()
+	go ks.run()
+
+	return ks
+}
+
+func (ks *refreshingKeyStore) run() {
+	ticker := time.NewTicker(ks.refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ks.done:
+			return
+		case <-ticker.C:
+			ks.reload()
+		}
+	}
+}
+
+func (ks *refreshingKeyStore) reload() {
+	entries, err := ks.load()
+	if err != nil {
+		logger.Errorf("load keys from %s failed: %v", ks.source, err)
+		return
+	}
+
+	next, err := parseKeySet(entries)
+	if err != nil {
+		logger.Errorf("parse keys from %s failed: %v", ks.source, err)
+		return
+	}
+
+	// NOTE: Keep the removed keys for a while, so the values
+	// encrypted by them right before the rotation still decrypt.
+	now := time.Now()
+	prev := ks.keySet.Load().(*keySet)
+	for id, key := range prev.keys {
+		if _, exists := next.keys[id]; exists {
+			delete(ks.retired, id)
+			continue
+		}
+
+		expiry, exists := ks.retired[id]
+		if !exists {
+			expiry = now.Add(ks.retiredKeyTTL)
+			ks.retired[id] = expiry
+			logger.Infof("key %s removed from %s, retire it at %s",
+				id, ks.source, expiry.Format(time.RFC3339))
+		}
+		if now.Before(expiry) {
+			next.keys[id] = key
+		} else {
+			delete(ks.retired, id)
+		}
+	}
+
+	if prev.current == nil || prev.current.ID != next.current.ID {
+		logger.Infof("current key of %s rotated to %s", ks.source, next.current.ID)
+	}
+
+	ks.keySet.Store(next)
+}
+
+func parseKeySet(entries map[string]string) (*keySet, error) {
+	currentID := entries[keyIDCurrent]
+	if currentID == "" {
+		return nil, fmt.Errorf("%s key id is empty", keyIDCurrent)
+	}
+
+	ks := &keySet{keys: make(map[string]*Key)}
+	for id, value := range entries {
+		if id == keyIDCurrent {
+			continue
+		}
+		if strings.Contains(id, ":") {
+			return nil, fmt.Errorf("key id %s contains colon", id)
+		}
+
+		secret, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("decode key %s failed: %v", id, err)
+		}
+		if len(secret) != keySize {
+			return nil, fmt.Errorf("key %s is %d bytes, AES-256 needs %d bytes",
+				id, len(secret), keySize)
+		}
+
+		ks.keys[id] = &Key{ID: id, Secret: secret}
+	}
+
+	ks.current = ks.keys[currentID]
+	if ks.current == nil {
+		return nil, fmt.Errorf("%s key %s not found", keyIDCurrent, currentID)
+	}
+
+	return ks, nil
+}
+
+// CurrentKey returns the key for encryption.
+func (ks *refreshingKeyStore) CurrentKey() (*Key, error) {
+	current := ks.keySet.Load().(*keySet).current
+	if current == nil {
+		return nil, fmt.Errorf("no keys loaded from %s", ks.source)
+	}
+
+	return current, nil
+}
+
+// Key returns the key of the id for decryption.
+func (ks *refreshingKeyStore) Key(id string) (*Key, error) {
+	key, exists := ks.keySet.Load().(*keySet).keys[id]
+	if !exists {
+		return nil, fmt.Errorf("key %s not found in %s", id, ks.source)
+	}
+
+	return key, nil
+}
+
+// Close stops reloading keys.
+func (ks *refreshingKeyStore) Close() {
+	close(ks.done)
+}
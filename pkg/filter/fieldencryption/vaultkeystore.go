@@ -0,0 +1,101 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package fieldencryption
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	vaultTokenHeader = "X-Vault-Token"
+	vaultTimeout     = 10 * time.Second
+)
+
+type (
+	// VaultKeyStoreSpec describes the keys in a secret of HashiCorp Vault,
+	// the secret has the same entries as the file key store.
+	// Both the KV secrets engine version 1 and 2 are supported.
+	VaultKeyStoreSpec struct {
+		Address string `yaml:"address" jsonschema:"required,format=url"`
+		Token   string `yaml:"token" jsonschema:"required"`
+		// SecretPath is the path of the secret, such as secret/data/easegress/keys
+		// for the KV secrets engine version 2.
+		SecretPath string `yaml:"secretPath" jsonschema:"required"`
+	}
+
+	vaultSecret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+)
+
+func newVaultKeyLoader(spec *VaultKeyStoreSpec) keyLoader {
+	client := &http.Client{Timeout: vaultTimeout}
+	url := strings.TrimSuffix(spec.Address, "/") + "/v1/" + strings.TrimPrefix(spec.SecretPath, "/")
+
+	return func() (map[string]string, error) {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set(vaultTokenHeader, spec.Token)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		buff, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("read body failed: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("read secret %s failed: status code %d, body: %s",
+				spec.SecretPath, resp.StatusCode, buff)
+		}
+
+		secret := &vaultSecret{}
+		err = json.Unmarshal(buff, secret)
+		if err != nil {
+			return nil, fmt.Errorf("unmarshal secret %s to json failed: %v", spec.SecretPath, err)
+		}
+
+		data := secret.Data
+		// NOTE: Version 2 wraps the entries with metadata.
+		if inner, ok := data["data"].(map[string]interface{}); ok {
+			if _, exists := data["metadata"]; exists {
+				data = inner
+			}
+		}
+
+		entries := make(map[string]string, len(data))
+		for k, v := range data {
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("entry %s of secret %s is not a string", k, spec.SecretPath)
+			}
+			entries[k] = s
+		}
+
+		return entries, nil
+	}
+}
@@ -0,0 +1,238 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jsontransform
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var (
+	errCircularReference = fmt.Errorf("circular element reference")
+	errNoRootElement     = fmt.Errorf("no root element")
+)
+
+type (
+	// xmlConverter converts XML documents to JSON by the rules in the spec.
+	xmlConverter struct {
+		spec          *Spec
+		arrayElements map[string]struct{}
+	}
+
+	xmlElement struct {
+		key      string
+		attrs    []xmlAttr
+		children []*xmlElement
+		text     []byte
+		// ref is the id referenced by the reference attribute.
+		ref string
+	}
+
+	xmlAttr struct {
+		key   string
+		value string
+	}
+
+	// xmlDocument is the parsed document, ids map the values of the id
+	// attribute to their elements.
+	xmlDocument struct {
+		root *xmlElement
+		ids  map[string]*xmlElement
+	}
+)
+
+func newXMLConverter(spec *Spec) *xmlConverter {
+	c := &xmlConverter{
+		spec:          spec,
+		arrayElements: make(map[string]struct{}),
+	}
+	for _, name := range spec.ArrayElements {
+		c.arrayElements[name] = struct{}{}
+	}
+
+	return c
+}
+
+// convert converts the XML document to JSON.
+func (c *xmlConverter) convert(r io.Reader) ([]byte, error) {
+	doc, err := c.parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := c.convertElement(doc, doc.root, make(map[*xmlElement]struct{}), 1)
+	if err != nil {
+		return nil, err
+	}
+
+	var buff bytes.Buffer
+	encoder := json.NewEncoder(&buff)
+	// NOTE: Keep the text as it is, the result isn't embedded into HTML.
+	encoder.SetEscapeHTML(false)
+	err = encoder.Encode(map[string]interface{}{doc.root.key: value})
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimRight(buff.Bytes(), "\n"), nil
+}
+
+// key returns the key of the name, the namespace is replaced with its
+// configured prefix, or dropped if it isn't configured.
+func (c *xmlConverter) key(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+
+	prefix, exists := c.spec.NamespacePrefixes[name.Space]
+	if !exists || prefix == "" {
+		return name.Local
+	}
+
+	return prefix + ":" + name.Local
+}
+
+func (c *xmlConverter) parse(r io.Reader) (*xmlDocument, error) {
+	doc := &xmlDocument{ids: make(map[string]*xmlElement)}
+	decoder := xml.NewDecoder(r)
+
+	var stack []*xmlElement
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if uint32(len(stack)) >= c.spec.MaxDepth {
+				return nil, fmt.Errorf("exceed max depth %d", c.spec.MaxDepth)
+			}
+
+			e := &xmlElement{key: c.key(t.Name)}
+			for _, attr := range t.Attr {
+				// NOTE: Namespace declarations are not data.
+				if attr.Name.Space == "xmlns" || (attr.Name.Space == "" && attr.Name.Local == "xmlns") {
+					continue
+				}
+
+				if attr.Name.Local == c.spec.IDAttribute && c.spec.ReferenceAttribute != "" {
+					doc.ids[attr.Value] = e
+				}
+				if attr.Name.Local == c.spec.ReferenceAttribute && strings.HasPrefix(attr.Value, "#") {
+					e.ref = attr.Value[1:]
+				}
+
+				e.attrs = append(e.attrs, xmlAttr{
+					key:   c.spec.AttributePrefix + c.key(attr.Name),
+					value: attr.Value,
+				})
+			}
+
+			if len(stack) == 0 {
+				if doc.root != nil {
+					return nil, fmt.Errorf("multiple root elements")
+				}
+				doc.root = e
+			} else {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, e)
+			}
+			stack = append(stack, e)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				e := stack[len(stack)-1]
+				e.text = append(e.text, t...)
+			}
+		}
+	}
+
+	if doc.root == nil {
+		return nil, errNoRootElement
+	}
+
+	return doc, nil
+}
+
+// convertElement converts the element, visiting contains the elements
+// being converted on the path, for detecting circular references.
+func (c *xmlConverter) convertElement(doc *xmlDocument, e *xmlElement,
+	visiting map[*xmlElement]struct{}, depth uint32) (interface{}, error) {
+
+	if depth > c.spec.MaxDepth {
+		return nil, fmt.Errorf("exceed max depth %d", c.spec.MaxDepth)
+	}
+
+	if e.ref != "" && len(e.children) == 0 {
+		if target, exists := doc.ids[e.ref]; exists {
+			if _, exists := visiting[target]; exists {
+				return nil, fmt.Errorf("%w: %s", errCircularReference, e.ref)
+			}
+			e = target
+		}
+	}
+
+	visiting[e] = struct{}{}
+	defer delete(visiting, e)
+
+	text := strings.TrimSpace(string(e.text))
+	if len(e.attrs) == 0 && len(e.children) == 0 {
+		return text, nil
+	}
+
+	m := make(map[string]interface{}, len(e.attrs)+len(e.children)+1)
+	for _, attr := range e.attrs {
+		m[attr.key] = attr.value
+	}
+
+	counts := make(map[string]int, len(e.children))
+	for _, child := range e.children {
+		counts[child.key]++
+	}
+
+	for _, child := range e.children {
+		value, err := c.convertElement(doc, child, visiting, depth+1)
+		if err != nil {
+			return nil, err
+		}
+
+		_, isArray := c.arrayElements[child.key]
+		if !isArray && counts[child.key] == 1 {
+			m[child.key] = value
+			continue
+		}
+
+		values, _ := m[child.key].([]interface{})
+		m[child.key] = append(values, value)
+	}
+
+	if text != "" {
+		m[c.spec.TextKey] = text
+	}
+
+	return m, nil
+}
@@ -0,0 +1,214 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jsontransform
+
+import (
+	"bytes"
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of XMLToJSON.
+	Kind = "XMLToJSON"
+
+	// TargetRequest converts the request body.
+	TargetRequest = "request"
+	// TargetResponse converts the response body.
+	TargetResponse = "response"
+
+	resultConvertFailed = "convertFailed"
+
+	jsonContentType = "application/json"
+)
+
+var (
+	results = []string{resultConvertFailed}
+)
+
+func init() {
+	httppipeline.Register(&XMLToJSON{})
+}
+
+type (
+	// XMLToJSON is filter converting the XML body of the request
+	// or the response to JSON, other bodies pass through.
+	XMLToJSON struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+
+		converter *xmlConverter
+	}
+
+	// Spec describes the XMLToJSON.
+	Spec struct {
+		Target string `yaml:"target" jsonschema:"omitempty,enum=request,enum=response"`
+		// AttributePrefix is prepended to the keys of attributes.
+		AttributePrefix string `yaml:"attributePrefix" jsonschema:"omitempty"`
+		// TextKey is the key of the text of elements with attributes or children.
+		TextKey string `yaml:"textKey" jsonschema:"omitempty"`
+		// ArrayElements are the elements always converted to arrays,
+		// the repeated ones are converted to arrays anyway.
+		ArrayElements []string `yaml:"arrayElements" jsonschema:"omitempty,uniqueItems=true"`
+		// NamespacePrefixes maps namespace URIs to the prefixes of keys,
+		// the namespaces not in it are dropped.
+		NamespacePrefixes map[string]string `yaml:"namespacePrefixes" jsonschema:"omitempty"`
+		// ReferenceAttribute is the attribute referencing another element
+		// by its IDAttribute, such as href="#id1" of SOAP encoding.
+		// The references are resolved only if it's not empty.
+		ReferenceAttribute string `yaml:"referenceAttribute" jsonschema:"omitempty"`
+		IDAttribute        string `yaml:"idAttribute" jsonschema:"omitempty"`
+		MaxDepth           uint32 `yaml:"maxDepth" jsonschema:"omitempty,minimum=1"`
+	}
+)
+
+// Kind returns the kind of XMLToJSON.
+func (x *XMLToJSON) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of XMLToJSON.
+func (x *XMLToJSON) DefaultSpec() interface{} {
+	return &Spec{
+		Target:          TargetResponse,
+		AttributePrefix: "@",
+		TextKey:         "#text",
+		IDAttribute:     "id",
+		MaxDepth:        128,
+	}
+}
+
+// Description returns the description of XMLToJSON.
+func (x *XMLToJSON) Description() string {
+	return "XMLToJSON converts the XML body of the request or the response to JSON."
+}
+
+// Results returns the results of XMLToJSON.
+func (x *XMLToJSON) Results() []string {
+	return results
+}
+
+// Init initializes XMLToJSON.
+func (x *XMLToJSON) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	x.pipeSpec, x.spec, x.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	x.reload()
+}
+
+// Inherit inherits previous generation of XMLToJSON.
+func (x *XMLToJSON) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	previousGeneration.Close()
+	x.Init(pipeSpec, super)
+}
+
+func (x *XMLToJSON) reload() {
+	x.converter = newXMLConverter(x.spec)
+}
+
+// Handle converts the request body, or calls the next handler and
+// converts the response body.
+func (x *XMLToJSON) Handle(ctx context.HTTPContext) string {
+	if x.spec.Target == TargetRequest {
+		result := x.convertRequest(ctx)
+		return ctx.CallNextHandler(result)
+	}
+
+	result := ctx.CallNextHandler("")
+	if convertResult := x.convertResponse(ctx); convertResult != "" {
+		return convertResult
+	}
+
+	return result
+}
+
+func (x *XMLToJSON) convertRequest(ctx context.HTTPContext) string {
+	r := ctx.Request()
+	if !isXML(r.Header().Get(httpheader.KeyContentType)) {
+		return ""
+	}
+
+	body, err := x.converter.convert(r.Body())
+	if err != nil {
+		ctx.Response().SetStatusCode(http.StatusBadRequest)
+		ctx.AddTag(stringtool.Cat("xmlToJSON: convert request failed: ", err.Error()))
+		return resultConvertFailed
+	}
+
+	r.SetBody(bytes.NewReader(body))
+	r.Header().Set(httpheader.KeyContentType, jsonContentType)
+	r.Header().Set(httpheader.KeyContentLength, strconv.Itoa(len(body)))
+
+	return ""
+}
+
+func (x *XMLToJSON) convertResponse(ctx context.HTTPContext) string {
+	w := ctx.Response()
+	if w.Body() == nil || !isXML(w.Header().Get(httpheader.KeyContentType)) {
+		return ""
+	}
+
+	body, err := x.converter.convert(w.Body())
+	if err != nil {
+		// NOTE: The upstream sent an unconvertible body, circular
+		// references included, which is a bad gateway for the client.
+		w.SetStatusCode(http.StatusBadGateway)
+		w.SetBody(nil)
+		w.Header().Del(httpheader.KeyContentLength)
+		if errors.Is(err, errCircularReference) {
+			ctx.AddTag(stringtool.Cat("xmlToJSON: circular reference in response: ", err.Error()))
+		} else {
+			ctx.AddTag(stringtool.Cat("xmlToJSON: convert response failed: ", err.Error()))
+		}
+		return resultConvertFailed
+	}
+
+	w.SetBody(bytes.NewReader(body))
+	w.Header().Set(httpheader.KeyContentType, jsonContentType)
+	w.Header().Set(httpheader.KeyContentLength, strconv.Itoa(len(body)))
+
+	return ""
+}
+
+func isXML(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return mediaType == "application/xml" || mediaType == "text/xml" ||
+		strings.HasSuffix(mediaType, "+xml")
+}
+
+// Status returns status.
+func (x *XMLToJSON) Status() interface{} {
+	return nil
+}
+
+// Close closes XMLToJSON.
+func (x *XMLToJSON) Close() {}
@@ -0,0 +1,160 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jsontransform
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newTestConverter() *xmlConverter {
+	spec := (&XMLToJSON{}).DefaultSpec().(*Spec)
+	spec.ArrayElements = []string{"tag"}
+	spec.NamespacePrefixes = map[string]string{
+		"http://schemas.xmlsoap.org/soap/envelope/": "soap",
+	}
+	spec.ReferenceAttribute = "href"
+	return newXMLConverter(spec)
+}
+
+func convertToMap(t *testing.T, c *xmlConverter, doc string) map[string]interface{} {
+	buff, err := c.convert(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("convert %s failed: %v", doc, err)
+	}
+
+	m := map[string]interface{}{}
+	err = json.Unmarshal(buff, &m)
+	if err != nil {
+		t.Fatalf("unmarshal %s failed: %v", buff, err)
+	}
+	return m
+}
+
+func TestXMLToJSON(t *testing.T) {
+	c := newTestConverter()
+
+	got := convertToMap(t, c, `<?xml version="1.0"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/" xmlns:m="urn:orders">
+  <soap:Body>
+    <m:order id="o1" status="paid">
+      <item sku="A1">apple</item>
+      <item sku="B2">banana</item>
+      <tag>fresh</tag>
+      <note>deliver <!-- asap --> today</note>
+    </m:order>
+  </soap:Body>
+</soap:Envelope>`)
+
+	want := map[string]interface{}{
+		"soap:Envelope": map[string]interface{}{
+			"soap:Body": map[string]interface{}{
+				"order": map[string]interface{}{
+					"@id":     "o1",
+					"@status": "paid",
+					"item": []interface{}{
+						map[string]interface{}{"@sku": "A1", "#text": "apple"},
+						map[string]interface{}{"@sku": "B2", "#text": "banana"},
+					},
+					"tag":  []interface{}{"fresh"},
+					"note": "deliver  today",
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %#v, got %#v", want, got)
+	}
+}
+
+func TestXMLToJSONReferences(t *testing.T) {
+	c := newTestConverter()
+
+	got := convertToMap(t, c, `<result>
+  <customer href="#c1"/>
+  <profile id="c1"><name>Alice</name></profile>
+</result>`)
+	customer := got["result"].(map[string]interface{})["customer"]
+	if want := map[string]interface{}{"@id": "c1", "name": "Alice"}; !reflect.DeepEqual(customer, want) {
+		t.Errorf("want resolved reference %#v, got %#v", want, customer)
+	}
+
+	_, err := c.convert(strings.NewReader(`<result>
+  <node id="n1"><next href="#n2"/></node>
+  <node id="n2"><next href="#n1"/></node>
+</result>`))
+	if !errors.Is(err, errCircularReference) {
+		t.Errorf("want %v, got %v", errCircularReference, err)
+	}
+}
+
+func TestXMLToJSONInvalid(t *testing.T) {
+	c := newTestConverter()
+
+	for _, doc := range []string{
+		"",
+		"<a><b></a>",
+		"<a/><b/>",
+		"<a>&xxe;</a>",
+		strings.Repeat("<a>", 200) + strings.Repeat("</a>", 200),
+	} {
+		if _, err := c.convert(strings.NewReader(doc)); err == nil {
+			t.Errorf("want error for %q", doc)
+		}
+	}
+}
+
+func TestIsXML(t *testing.T) {
+	for contentType, want := range map[string]bool{
+		"application/xml":         true,
+		"text/xml; charset=utf-8": true,
+		"application/soap+xml":    true,
+		"application/json":        false,
+		"text/plain":              false,
+		"":                        false,
+	} {
+		if got := isXML(contentType); got != want {
+			t.Errorf("%q: want %v, got %v", contentType, want, got)
+		}
+	}
+}
+
+func BenchmarkXMLToJSON100KB(b *testing.B) {
+	var doc strings.Builder
+	doc.WriteString(`<catalog xmlns="urn:catalog">`)
+	for i := 0; doc.Len() < 100*1024; i++ {
+		fmt.Fprintf(&doc, `<product id="p%d" available="true"><name>Product %d</name>`+
+			`<price currency="USD">%d.99</price><tag>new</tag><tag>sale</tag></product>`, i, i, i)
+	}
+	doc.WriteString(`</catalog>`)
+	body := doc.String()
+
+	c := newTestConverter()
+	b.SetBytes(int64(len(body)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := c.convert(strings.NewReader(body))
+		if err != nil {
+			b.Fatalf("convert failed: %v", err)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package oauth2exchange
+
+import (
+	stdcontext "context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	grantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+	// maxTokenResponseBytes limits the body read from the token endpoint.
+	maxTokenResponseBytes = 64 * 1024
+)
+
+// errTokenRejected means the token endpoint rejected the subject token,
+// which is a 400 response in RFC 8693 section 2.2.2.
+var errTokenRejected = errors.New("subject token rejected by token endpoint")
+
+type (
+	// exchanger exchanges subject tokens at the token endpoint,
+	// and caches the issued tokens until they expire.
+	exchanger struct {
+		spec   *Spec
+		client *http.Client
+
+		mutex sync.Mutex
+		// cache is keyed by the sha256 of the subject token,
+		// so the inbound tokens are not kept in memory.
+		cache map[string]*issuedToken
+	}
+
+	issuedToken struct {
+		token     string
+		tokenType string
+		expiresAt time.Time
+	}
+
+	// tokenResponse is the successful response of RFC 8693 section 2.2.1.
+	tokenResponse struct {
+		AccessToken     string `json:"access_token"`
+		IssuedTokenType string `json:"issued_token_type"`
+		TokenType       string `json:"token_type"`
+		ExpiresIn       int64  `json:"expires_in"`
+	}
+)
+
+func newExchanger(spec *Spec, timeout time.Duration) *exchanger {
+	return &exchanger{
+		spec:   spec,
+		client: &http.Client{Timeout: timeout},
+		cache:  make(map[string]*issuedToken),
+	}
+}
+
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (e *exchanger) get(key string, now time.Time) *issuedToken {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	it, exists := e.cache[key]
+	if !exists {
+		return nil
+	}
+	if !now.Before(it.expiresAt) {
+		delete(e.cache, key)
+		return nil
+	}
+
+	return it
+}
+
+func (e *exchanger) put(key string, it *issuedToken) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.cache[key] = it
+}
+
+// purge removes the expired tokens.
+func (e *exchanger) purge(now time.Time) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	for key, it := range e.cache {
+		if !now.Before(it.expiresAt) {
+			delete(e.cache, key)
+		}
+	}
+}
+
+func (e *exchanger) size() int {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return len(e.cache)
+}
+
+// exchange returns the token issued for the subject token,
+// from the cache if it has not expired.
+func (e *exchanger) exchange(ctx stdcontext.Context, subjectToken string) (*issuedToken, error) {
+	key := tokenHash(subjectToken)
+	if it := e.get(key, time.Now()); it != nil {
+		return it, nil
+	}
+
+	it, err := e.request(ctx, subjectToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// NOTE: The token without expires_in is not cached,
+	// since we can't know when it becomes invalid.
+	if !it.expiresAt.IsZero() {
+		e.put(key, it)
+	}
+
+	return it, nil
+}
+
+func (e *exchanger) request(ctx stdcontext.Context, subjectToken string) (*issuedToken, error) {
+	form := url.Values{}
+	form.Set("grant_type", grantTypeTokenExchange)
+	form.Set("subject_token", subjectToken)
+	form.Set("subject_token_type", e.spec.SubjectTokenType)
+	if e.spec.RequestedTokenType != "" {
+		form.Set("requested_token_type", e.spec.RequestedTokenType)
+	}
+	if e.spec.Audience != "" {
+		form.Set("audience", e.spec.Audience)
+	}
+	if e.spec.Resource != "" {
+		form.Set("resource", e.spec.Resource)
+	}
+	if len(e.spec.Scopes) != 0 {
+		form.Set("scope", strings.Join(e.spec.Scopes, " "))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		e.spec.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("new request failed: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if e.spec.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(e.spec.ClientID), url.QueryEscape(e.spec.ClientSecret))
+	}
+
+	startTime := time.Now()
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("do request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxTokenResponseBytes))
+	if err != nil {
+		return nil, fmt.Errorf("read response body failed: %v", err)
+	}
+
+	if resp.StatusCode == http.StatusBadRequest {
+		return nil, errTokenRejected
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	tr := &tokenResponse{}
+	err = json.Unmarshal(body, tr)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal response body failed: %v", err)
+	}
+	if tr.AccessToken == "" {
+		return nil, fmt.Errorf("no access_token in response")
+	}
+
+	it := &issuedToken{
+		token:     tr.AccessToken,
+		tokenType: tr.TokenType,
+	}
+	// NOTE: The token type is case-insensitive in RFC 6749 section 5.1,
+	// normalize the common one for the Authorization header.
+	if it.tokenType == "" || strings.EqualFold(it.tokenType, "bearer") {
+		it.tokenType = "Bearer"
+	}
+	// NOTE: Count the expiry from the time of sending the request,
+	// so the token never outlives the one seen by the token endpoint.
+	if tr.ExpiresIn > 0 {
+		it.expiresAt = startTime.Add(time.Duration(tr.ExpiresIn) * time.Second)
+	}
+
+	return it, nil
+}
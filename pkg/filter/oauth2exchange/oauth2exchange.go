@@ -0,0 +1,226 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package oauth2exchange
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	// Kind is the kind of OAuth2TokenExchange.
+	Kind = "OAuth2TokenExchange"
+
+	resultUnauthorized   = "unauthorized"
+	resultExchangeFailed = "exchangeFailed"
+
+	tokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+
+	purgeInterval = time.Minute
+)
+
+var (
+	results = []string{resultUnauthorized, resultExchangeFailed}
+)
+
+func init() {
+	httppipeline.Register(&OAuth2TokenExchange{})
+}
+
+type (
+	// OAuth2TokenExchange is the filter exchanging the inbound bearer token
+	// for the service-scoped one, which is RFC 8693.
+	OAuth2TokenExchange struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+
+		exchanger *exchanger
+		done      chan struct{}
+	}
+
+	// Spec describes the OAuth2TokenExchange.
+	Spec struct {
+		TokenEndpoint string `yaml:"tokenEndpoint" jsonschema:"required,format=uri"`
+		// ClientID and ClientSecret authenticate the filter
+		// to the token endpoint by HTTP Basic authentication.
+		ClientID     string `yaml:"clientID" jsonschema:"omitempty"`
+		ClientSecret string `yaml:"clientSecret" jsonschema:"omitempty"`
+
+		SubjectTokenType   string   `yaml:"subjectTokenType" jsonschema:"omitempty,format=uri"`
+		RequestedTokenType string   `yaml:"requestedTokenType" jsonschema:"omitempty,format=uri"`
+		Audience           string   `yaml:"audience" jsonschema:"omitempty"`
+		Resource           string   `yaml:"resource" jsonschema:"omitempty,format=uri"`
+		Scopes             []string `yaml:"scopes" jsonschema:"omitempty,uniqueItems=true"`
+
+		Timeout string `yaml:"timeout" jsonschema:"omitempty,format=duration"`
+	}
+
+	// Status is the status of OAuth2TokenExchange.
+	Status struct {
+		CachedTokens int `yaml:"cachedTokens"`
+	}
+)
+
+// Validate validates Spec.
+func (s Spec) Validate() error {
+	if s.ClientSecret != "" && s.ClientID == "" {
+		return fmt.Errorf("clientSecret requires clientID")
+	}
+
+	if s.Timeout != "" {
+		timeout, err := time.ParseDuration(s.Timeout)
+		if err != nil {
+			return fmt.Errorf("invalid timeout %s: %v", s.Timeout, err)
+		}
+		if timeout <= 0 {
+			return fmt.Errorf("timeout %s must be positive", s.Timeout)
+		}
+	}
+
+	return nil
+}
+
+// Kind returns the kind of OAuth2TokenExchange.
+func (te *OAuth2TokenExchange) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of OAuth2TokenExchange.
+func (te *OAuth2TokenExchange) DefaultSpec() interface{} {
+	return &Spec{
+		SubjectTokenType: tokenTypeAccessToken,
+		Timeout:          "5s",
+	}
+}
+
+// Description returns the description of OAuth2TokenExchange.
+func (te *OAuth2TokenExchange) Description() string {
+	return "OAuth2TokenExchange exchanges the inbound token for the service-scoped one."
+}
+
+// Results returns the results of OAuth2TokenExchange.
+func (te *OAuth2TokenExchange) Results() []string {
+	return results
+}
+
+// Init initializes OAuth2TokenExchange.
+func (te *OAuth2TokenExchange) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	te.pipeSpec, te.spec, te.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	te.reload()
+}
+
+// Inherit inherits previous generation of OAuth2TokenExchange.
+func (te *OAuth2TokenExchange) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	previousGeneration.Close()
+	te.Init(pipeSpec, super)
+}
+
+func (te *OAuth2TokenExchange) reload() {
+	var timeout time.Duration
+	if te.spec.Timeout != "" {
+		var err error
+		timeout, err = time.ParseDuration(te.spec.Timeout)
+		if err != nil {
+			logger.Errorf("BUG: parse duration %s failed: %v", te.spec.Timeout, err)
+		}
+	}
+
+	te.exchanger = newExchanger(te.spec, timeout)
+	te.done = make(chan struct{})
+	go te.run()
+}
+
+func (te *OAuth2TokenExchange) run() {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-te.done:
+			return
+		case now := <-ticker.C:
+			te.exchanger.purge(now)
+		}
+	}
+}
+
+// bearerToken returns the token in the Authorization header,
+// the scheme is case-insensitive in RFC 6750.
+func bearerToken(authorization string) string {
+	const prefix = "bearer "
+	if len(authorization) <= len(prefix) || !strings.EqualFold(authorization[:len(prefix)], prefix) {
+		return ""
+	}
+	return strings.TrimSpace(authorization[len(prefix):])
+}
+
+// Handle replaces the inbound token with the exchanged one.
+func (te *OAuth2TokenExchange) Handle(ctx context.HTTPContext) string {
+	result := te.handle(ctx)
+	return ctx.CallNextHandler(result)
+}
+
+func (te *OAuth2TokenExchange) handle(ctx context.HTTPContext) string {
+	r, w := ctx.Request(), ctx.Response()
+
+	subjectToken := bearerToken(r.Header().Get("Authorization"))
+	if subjectToken == "" {
+		w.SetStatusCode(http.StatusUnauthorized)
+		ctx.AddTag("oauth2TokenExchange: no bearer token")
+		return resultUnauthorized
+	}
+
+	it, err := te.exchanger.exchange(ctx, subjectToken)
+	if err == errTokenRejected {
+		w.SetStatusCode(http.StatusUnauthorized)
+		ctx.AddTag(fmt.Sprintf("oauth2TokenExchange: %v", err))
+		return resultUnauthorized
+	}
+	if err != nil {
+		logger.Errorf("%s: exchange token failed: %v", te.pipeSpec.Name(), err)
+		w.SetStatusCode(http.StatusServiceUnavailable)
+		ctx.AddTag(fmt.Sprintf("oauth2TokenExchange: %v", err))
+		return resultExchangeFailed
+	}
+
+	r.Header().Set("Authorization", it.tokenType+" "+it.token)
+
+	return ""
+}
+
+// Status returns status.
+func (te *OAuth2TokenExchange) Status() interface{} {
+	return &Status{
+		CachedTokens: te.exchanger.size(),
+	}
+}
+
+// Close closes OAuth2TokenExchange.
+func (te *OAuth2TokenExchange) Close() {
+	close(te.done)
+}
@@ -0,0 +1,161 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package oauth2exchange
+
+import (
+	stdcontext "context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTokenEndpoint(t *testing.T, calls *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+
+		if id, secret, _ := r.BasicAuth(); id != "gateway" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parse form failed: %v", err)
+		}
+		if got := r.PostForm.Get("grant_type"); got != grantTypeTokenExchange {
+			t.Errorf("want grant_type %s, got %s", grantTypeTokenExchange, got)
+		}
+		if got := r.PostForm.Get("subject_token_type"); got != tokenTypeAccessToken {
+			t.Errorf("want subject_token_type %s, got %s", tokenTypeAccessToken, got)
+		}
+		if got := r.PostForm.Get("audience"); got != "orders" {
+			t.Errorf("want audience orders, got %s", got)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		switch subject := r.PostForm.Get("subject_token"); subject {
+		case "revoked":
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"invalid_grant"}`)
+		case "short-lived":
+			fmt.Fprintf(w, `{"access_token":"exchanged-%s","token_type":"bearer","expires_in":1}`, subject)
+		default:
+			fmt.Fprintf(w, `{"access_token":"exchanged-%s","issued_token_type":"%s","token_type":"Bearer","expires_in":3600}`,
+				subject, tokenTypeAccessToken)
+		}
+	}))
+}
+
+func TestExchange(t *testing.T) {
+	var calls int32
+	server := newTokenEndpoint(t, &calls)
+	defer server.Close()
+
+	e := newExchanger(&Spec{
+		TokenEndpoint:    server.URL,
+		ClientID:         "gateway",
+		ClientSecret:     "secret",
+		SubjectTokenType: tokenTypeAccessToken,
+		Audience:         "orders",
+	}, time.Second)
+	ctx := stdcontext.Background()
+
+	it, err := e.exchange(ctx, "alice")
+	if err != nil {
+		t.Fatalf("exchange failed: %v", err)
+	}
+	if it.tokenType != "Bearer" || it.token != "exchanged-alice" {
+		t.Fatalf("want Bearer exchanged-alice, got %s %s", it.tokenType, it.token)
+	}
+
+	// NOTE: The second exchange is served from the cache.
+	it, err = e.exchange(ctx, "alice")
+	if err != nil || it.token != "exchanged-alice" {
+		t.Fatalf("cached exchange: want exchanged-alice, got %+v, %v", it, err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Fatalf("want 1 call to token endpoint, got %d", got)
+	}
+	if _, exists := e.cache["alice"]; exists {
+		t.Fatalf("want cache keyed by token hash, got raw token")
+	}
+
+	_, err = e.exchange(ctx, "revoked")
+	if err != errTokenRejected {
+		t.Fatalf("want %v, got %v", errTokenRejected, err)
+	}
+	if got := e.size(); got != 1 {
+		t.Fatalf("want rejected token not cached, got %d tokens", got)
+	}
+}
+
+func TestExchangeExpiry(t *testing.T) {
+	var calls int32
+	server := newTokenEndpoint(t, &calls)
+	defer server.Close()
+
+	e := newExchanger(&Spec{
+		TokenEndpoint:    server.URL,
+		ClientID:         "gateway",
+		ClientSecret:     "secret",
+		SubjectTokenType: tokenTypeAccessToken,
+		Audience:         "orders",
+	}, time.Second)
+	ctx := stdcontext.Background()
+
+	it, err := e.exchange(ctx, "short-lived")
+	if err != nil {
+		t.Fatalf("exchange failed: %v", err)
+	}
+	if it.tokenType != "Bearer" {
+		t.Fatalf("want normalized token type Bearer, got %s", it.tokenType)
+	}
+
+	e.purge(it.expiresAt.Add(-time.Millisecond))
+	if got := e.size(); got != 1 {
+		t.Fatalf("want 1 token before expiry, got %d", got)
+	}
+	e.purge(it.expiresAt)
+	if got := e.size(); got != 0 {
+		t.Fatalf("want no tokens after expiry, got %d", got)
+	}
+
+	_, err = e.exchange(ctx, "short-lived")
+	if err != nil {
+		t.Fatalf("exchange failed: %v", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Fatalf("want expired token exchanged again, got %d calls", got)
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	for authorization, want := range map[string]string{
+		"Bearer abc":  "abc",
+		"bearer abc":  "abc",
+		"Basic abc":   "",
+		"Bearer ":     "",
+		"":            "",
+		"Bearer  abc": "abc",
+	} {
+		if got := bearerToken(authorization); got != want {
+			t.Errorf("%q: want %q, got %q", authorization, want, got)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	stdcontext "context"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+)
+
+// detachedContext keeps the values of the parent context,
+// but is never done, nor has deadline.
+type detachedContext struct {
+	parent stdcontext.Context
+}
+
+func (dc detachedContext) Deadline() (time.Time, bool)       { return time.Time{}, false }
+func (dc detachedContext) Done() <-chan struct{}             { return nil }
+func (dc detachedContext) Err() error                        { return nil }
+func (dc detachedContext) Value(key interface{}) interface{} { return dc.parent.Value(key) }
+
+// upstreamContext returns the context of the upstream request.
+// The HTTPContext is done once the client disconnected, so using it
+// directly cancels the in-flight upstream request too.
+// Without cancellation propagation, the upstream request is only
+// cancelled by the others, such as the TimeLimiter.
+func (p *pool) upstreamContext(ctx context.HTTPContext) stdcontext.Context {
+	if p.cancellationPropagation {
+		return ctx
+	}
+
+	upstreamCtx, cancel := stdcontext.WithCancel(detachedContext{parent: ctx})
+	go func() {
+		select {
+		case <-ctx.Done():
+			if !ctx.ClientDisconnected() {
+				cancel()
+			}
+		case <-upstreamCtx.Done():
+		}
+	}()
+
+	// NOTE: The response body is still being copied to
+	// the client after the pipeline, so release it at the end.
+	ctx.Lock()
+	ctx.OnFinish(cancel)
+	ctx.Unlock()
+
+	return upstreamCtx
+}
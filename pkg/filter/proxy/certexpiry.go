@@ -0,0 +1,265 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	stdcontext "context"
+	"crypto/tls"
+	"fmt"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const (
+	defaultCertCheckInterval = 24 * time.Hour
+	defaultWarnThresholdDays = 30
+
+	certCheckTimeout = 10 * time.Second
+	// certCheckDelay delays the first check to leave the
+	// connections at startup to the requests and pre-warming.
+	certCheckDelay = 10 * time.Second
+)
+
+type (
+	// certChecker checks the expiry of the certificates of the https
+	// servers periodically, the servers with expired certificates are
+	// degraded.
+	certChecker struct {
+		interval time.Duration
+		warnDays int
+		servers  func() *staticServers
+
+		mutex sync.Mutex
+		// states are keyed by the address of the servers.
+		states map[string]*CertExpiryStatus
+
+		done chan struct{}
+	}
+
+	// CertExpiryStatus is the status of the certificate of a server.
+	CertExpiryStatus struct {
+		// Days is the days before the certificate expires,
+		// it's zero or negative once expired.
+		Days     int    `yaml:"days"`
+		NotAfter string `yaml:"notAfter,omitempty"`
+		Degraded bool   `yaml:"degraded"`
+		Error    string `yaml:"error,omitempty"`
+	}
+)
+
+func (s PoolSpec) validateCertCheck() error {
+	if s.CertCheckInterval != "" {
+		interval, err := time.ParseDuration(s.CertCheckInterval)
+		if err != nil || interval <= 0 {
+			return fmt.Errorf("invalid certCheckInterval %s", s.CertCheckInterval)
+		}
+	}
+
+	return nil
+}
+
+func newCertChecker(spec *PoolSpec, servers func() *staticServers) *certChecker {
+	cc := &certChecker{
+		interval: parseDurationOrDefault(spec.CertCheckInterval, defaultCertCheckInterval),
+		warnDays: spec.WarnThresholdDays,
+		servers:  servers,
+		states:   make(map[string]*CertExpiryStatus),
+		done:     make(chan struct{}),
+	}
+	if cc.warnDays == 0 {
+		cc.warnDays = defaultWarnThresholdDays
+	}
+
+	go cc.run()
+
+	return cc
+}
+
+func (cc *certChecker) run() {
+	select {
+	case <-cc.done:
+		return
+	case <-time.After(certCheckDelay):
+	}
+
+	ticker := time.NewTicker(cc.interval)
+	defer ticker.Stop()
+
+	for {
+		cc.checkAll()
+
+		select {
+		case <-cc.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (cc *certChecker) checkAll() {
+	static := cc.servers()
+	if static == nil {
+		return
+	}
+
+	var wg sync.WaitGroup
+	checked := make(map[string]bool)
+	for _, server := range static.servers {
+		scheme, addr, err := serverAddr(server.URL)
+		if err != nil || scheme != "https" || checked[addr] {
+			continue
+		}
+		checked[addr] = true
+
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+
+			ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), certCheckTimeout)
+			defer cancel()
+
+			notAfter, err := checkCertExpiry(ctx, addr)
+			cc.record(addr, notAfter, err)
+		}(addr)
+	}
+	wg.Wait()
+
+	// NOTE: Forget the removed servers.
+	cc.mutex.Lock()
+	for addr := range cc.states {
+		if !checked[addr] {
+			delete(cc.states, addr)
+		}
+	}
+	cc.mutex.Unlock()
+}
+
+// checkCertExpiry handshakes with the server, and returns
+// the expiry time of the leaf certificate.
+func checkCertExpiry(ctx stdcontext.Context, addr string) (time.Time, error) {
+	host, _, _ := net.SplitHostPort(addr)
+	dialer := &tls.Dialer{
+		// NOTE: Read the certificate even if it's untrusted or
+		// expired, in the same way as globalClient.
+		Config: &tls.Config{ServerName: host, InsecureSkipVerify: true},
+	}
+
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer conn.Close()
+
+	certs := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return time.Time{}, fmt.Errorf("no peer certificate")
+	}
+
+	return certs[0].NotAfter, nil
+}
+
+func (cc *certChecker) record(addr string, notAfter time.Time, err error) {
+	if err != nil {
+		logger.Warnf("check certificate of %s failed: %v", addr, err)
+
+		cc.mutex.Lock()
+		defer cc.mutex.Unlock()
+
+		// NOTE: Keep the last expiry if the check failed.
+		state := &CertExpiryStatus{Error: err.Error()}
+		if prev, exists := cc.states[addr]; exists {
+			state.Days, state.NotAfter, state.Degraded = prev.Days, prev.NotAfter, prev.Degraded
+		}
+		cc.states[addr] = state
+		return
+	}
+
+	days := int(math.Floor(time.Until(notAfter).Hours() / 24))
+	switch {
+	case days <= 0:
+		logger.Errorf("certificate of %s expired at %s", addr, notAfter.Format(time.RFC3339))
+	case days <= cc.warnDays:
+		logger.Warnf("certificate of %s expires in %d days at %s", addr, days, notAfter.Format(time.RFC3339))
+	}
+
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	cc.states[addr] = &CertExpiryStatus{
+		Days:     days,
+		NotAfter: notAfter.Format(time.RFC3339),
+		Degraded: days <= 0,
+	}
+}
+
+func (cc *certChecker) status() map[string]*CertExpiryStatus {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	if len(cc.states) == 0 {
+		return nil
+	}
+
+	s := make(map[string]*CertExpiryStatus, len(cc.states))
+	for addr, state := range cc.states {
+		copied := *state
+		s[addr] = &copied
+	}
+
+	return s
+}
+
+// degrade marks the servers with expired certificates as degraded.
+func (cc *certChecker) degrade(static *staticServers, health map[string]*ServerHealthStatus) map[string]*ServerHealthStatus {
+	if static == nil {
+		return health
+	}
+
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	for _, server := range static.servers {
+		_, addr, err := serverAddr(server.URL)
+		if err != nil {
+			continue
+		}
+		state, exists := cc.states[addr]
+		if !exists || !state.Degraded {
+			continue
+		}
+
+		if health == nil {
+			health = make(map[string]*ServerHealthStatus)
+		}
+		if health[server.URL] == nil {
+			// NOTE: The server is regarded as healthy without health check.
+			health[server.URL] = &ServerHealthStatus{Healthy: true}
+		}
+		health[server.URL].Degraded = true
+	}
+
+	return health
+}
+
+func (cc *certChecker) close() {
+	close(cc.done)
+}
@@ -0,0 +1,120 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newCertExpiryTestServer(t *testing.T, notAfter time.Time) *httptest.Server {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key failed: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:    notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate failed: %v", err)
+	}
+
+	s := httptest.NewUnstartedServer(http.NotFoundHandler())
+	s.TLS = &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	}
+	s.StartTLS()
+	return s
+}
+
+func TestCertChecker(t *testing.T) {
+	valid := newCertExpiryTestServer(t, time.Now().Add(90*24*time.Hour))
+	defer valid.Close()
+	expiring := newCertExpiryTestServer(t, time.Now().Add(10*24*time.Hour+time.Hour))
+	defer expiring.Close()
+	expired := newCertExpiryTestServer(t, time.Now().Add(-2*24*time.Hour))
+	defer expired.Close()
+	plain := httptest.NewServer(http.NotFoundHandler())
+	defer plain.Close()
+
+	static := newStaticServers([]*Server{
+		{URL: valid.URL},
+		{URL: expiring.URL},
+		{URL: expired.URL},
+		{URL: plain.URL},
+	}, nil, LoadBalance{Policy: PolicyRoundRobin})
+
+	cc := newCertChecker(&PoolSpec{CertCheckInterval: "1h"}, func() *staticServers { return static })
+	defer cc.close()
+	cc.checkAll()
+
+	status := cc.status()
+	if len(status) != 3 {
+		t.Fatalf("want 3 https servers checked, got %d", len(status))
+	}
+	for _, c := range []struct {
+		server   *httptest.Server
+		days     int
+		degraded bool
+	}{
+		{valid, 89, false},
+		{expiring, 10, false},
+		{expired, -3, true},
+	} {
+		_, addr, _ := serverAddr(c.server.URL)
+		s := status[addr]
+		if s.Days != c.days || s.Degraded != c.degraded || s.Error != "" {
+			t.Errorf("%s: want days %d degraded %v, got %+v", addr, c.days, c.degraded, s)
+		}
+	}
+
+	health := cc.degrade(static, nil)
+	if len(health) != 1 || !health[expired.URL].Degraded || !health[expired.URL].Healthy {
+		t.Errorf("want only %s degraded, got %v", expired.URL, health)
+	}
+
+	// NOTE: The last expiry is kept if the check failed.
+	expired.Close()
+	cc.checkAll()
+	_, addr, _ := serverAddr(expired.URL)
+	if s := cc.status()[addr]; s.Error == "" || !s.Degraded {
+		t.Errorf("want failed check keeping degraded, got %+v", s)
+	}
+}
+
+func TestCertCheckValidate(t *testing.T) {
+	if err := (PoolSpec{CertCheckInterval: "12h"}).validateCertCheck(); err != nil {
+		t.Errorf("want valid, got %v", err)
+	}
+	if err := (PoolSpec{CertCheckInterval: "-1h"}).validateCertCheck(); err == nil {
+		t.Errorf("want error for negative interval")
+	}
+}
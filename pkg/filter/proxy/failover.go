@@ -0,0 +1,176 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/httpstat"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+// maxDiscardBytes is the most bytes read from the failed response
+// to reuse the connection.
+const maxDiscardBytes = 4096
+
+type (
+	// failoverServer is the secondary server tried in order,
+	// when the primary one fails.
+	failoverServer struct {
+		server      *Server
+		maxAttempts int
+	}
+)
+
+func (s *PoolSpec) validateFailoverOrder() error {
+	servers := make(map[string]struct{}, len(s.Servers))
+	for _, server := range s.Servers {
+		servers[server.URL] = struct{}{}
+	}
+
+	for _, url := range s.FailoverOrder {
+		if _, exists := servers[url]; !exists {
+			return fmt.Errorf("failoverOrder %s is not in servers", url)
+		}
+	}
+
+	if s.ServiceName == "" && s.SRVRecord == "" && len(primaryServers(s)) == 0 {
+		return fmt.Errorf("failoverOrder leaves no primary server")
+	}
+
+	return nil
+}
+
+// primaryServers returns the servers not in failoverOrder.
+func primaryServers(spec *PoolSpec) []*Server {
+	if len(spec.FailoverOrder) == 0 {
+		return spec.Servers
+	}
+
+	secondaries := make(map[string]struct{}, len(spec.FailoverOrder))
+	for _, url := range spec.FailoverOrder {
+		secondaries[url] = struct{}{}
+	}
+
+	primaries := []*Server{}
+	for _, server := range spec.Servers {
+		if _, exists := secondaries[server.URL]; !exists {
+			primaries = append(primaries, server)
+		}
+	}
+
+	return primaries
+}
+
+func newFailoverServers(spec *PoolSpec) []*failoverServer {
+	servers := make(map[string]*Server, len(spec.Servers))
+	for _, server := range spec.Servers {
+		servers[server.URL] = server
+	}
+
+	var failover []*failoverServer
+	for _, url := range spec.FailoverOrder {
+		server, exists := servers[url]
+		if !exists {
+			logger.Errorf("BUG: failoverOrder %s is not in servers", url)
+			continue
+		}
+
+		maxAttempts := server.MaxAttempts
+		if maxAttempts <= 0 {
+			maxAttempts = 1
+		}
+		failover = append(failover, &failoverServer{
+			server:      server,
+			maxAttempts: maxAttempts,
+		})
+	}
+
+	return failover
+}
+
+func (p *pool) isFailureCode(code int) bool {
+	for _, failureCode := range p.failureCodes {
+		if code == failureCode {
+			return true
+		}
+	}
+	return false
+}
+
+// discardResponse closes the response of the failed attempt,
+// which is still counted in the statistics.
+func (p *pool) discardResponse(ctx context.HTTPContext,
+	req *request, resp *http.Response, span tracing.Span) {
+
+	io.CopyN(ioutil.Discard, resp.Body, maxDiscardBytes)
+	resp.Body.Close()
+	req.finish()
+	span.Finish()
+
+	p.httpStat.Stat(&httpstat.Metric{
+		StatusCode: resp.StatusCode,
+		Duration:   req.total(),
+		ReqSize:    ctx.Request().Size(),
+		RespSize:   uint64(responseMetaSize(resp)),
+	})
+}
+
+// handleWithFailover tries the primary server, then the secondary ones
+// in failoverOrder until one succeeds, the last attempt writes the
+// response whether it succeeds or not.
+func (p *pool) handleWithFailover(ctx context.HTTPContext, primary *Server, reqBody io.Reader) string {
+	// NOTE: The body is sent more than once.
+	body, err := ioutil.ReadAll(reqBody)
+	if err != nil {
+		p.addTag(ctx, "readBodyErr", err.Error())
+		ctx.Response().SetStatusCode(http.StatusBadRequest)
+		return resultClientError
+	}
+
+	attempts := []*Server{primary}
+	for _, fs := range p.failover {
+		for i := 0; i < fs.maxAttempts; i++ {
+			attempts = append(attempts, fs.server)
+		}
+	}
+
+	for i, server := range attempts {
+		lastAttempt := i == len(attempts)-1
+		result, reason := p.handleServer(ctx, server, bytes.NewReader(body), lastAttempt)
+		if reason == "" {
+			return result
+		}
+
+		next := attempts[i+1]
+		logger.Warnf("%s: fail over from %s to %s: %s", p.tagPrefix, server.URL, next.URL, reason)
+		p.addTag(ctx, "failover", stringtool.Cat(server.URL, " -> ", next.URL, ": ", reason))
+	}
+
+	// NOTE: The last attempt never returns the reason.
+	logger.Errorf("BUG: no attempt handled the request")
+	ctx.Response().SetStatusCode(http.StatusServiceUnavailable)
+	return resultInternalError
+}
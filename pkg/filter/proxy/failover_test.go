@@ -0,0 +1,157 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/tracing"
+)
+
+type failoverTestServer struct {
+	*httptest.Server
+	calls  int32
+	status int32
+}
+
+func newFailoverTestServer(t *testing.T, status int) *failoverTestServer {
+	s := &failoverTestServer{status: int32(status)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&s.calls, 1)
+		body, _ := ioutil.ReadAll(r.Body)
+		if string(body) != "payload" {
+			t.Errorf("want body payload, got %q", body)
+		}
+		w.WriteHeader(int(atomic.LoadInt32(&s.status)))
+	}))
+	return s
+}
+
+// unreachableURL returns the URL of a closed server.
+func unreachableURL() string {
+	s := httptest.NewServer(http.NotFoundHandler())
+	s.Close()
+	return s.URL
+}
+
+func newFailoverTestContext() context.HTTPContext {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("payload"))
+	return context.New(httptest.NewRecorder(), req, tracing.NoopTracing, "no trace")
+}
+
+func TestFailoverOrder(t *testing.T) {
+	primary := newFailoverTestServer(t, http.StatusServiceUnavailable)
+	defer primary.Close()
+	secondary := newFailoverTestServer(t, http.StatusOK)
+	defer secondary.Close()
+	unreachable := unreachableURL()
+
+	spec := &PoolSpec{
+		Servers: []*Server{
+			{URL: primary.URL},
+			{URL: unreachable, MaxAttempts: 2},
+			{URL: secondary.URL},
+		},
+		FailoverOrder: []string{unreachable, secondary.URL},
+		LoadBalance:   &LoadBalance{Policy: PolicyRoundRobin},
+	}
+	if err := spec.Validate(); err != nil {
+		t.Fatalf("validate failed: %v", err)
+	}
+	p := newPool(spec, "proxy#main", true, []int{http.StatusServiceUnavailable}, nil)
+	defer p.close()
+
+	ctx := newFailoverTestContext()
+	result := p.handle(ctx, ctx.Request().Body())
+	if result != "" {
+		t.Fatalf("want no result, got %s", result)
+	}
+	if code := ctx.Response().StatusCode(); code != http.StatusOK {
+		t.Fatalf("want %d from the secondary, got %d", http.StatusOK, code)
+	}
+	if calls := atomic.LoadInt32(&primary.calls); calls != 1 {
+		t.Errorf("want primary called once, got %d", calls)
+	}
+	if calls := atomic.LoadInt32(&secondary.calls); calls != 1 {
+		t.Errorf("want secondary called once, got %d", calls)
+	}
+
+	// NOTE: The secondaries are excluded from the load balance.
+	atomic.StoreInt32(&primary.status, http.StatusOK)
+	for i := 0; i < 3; i++ {
+		ctx = newFailoverTestContext()
+		p.handle(ctx, ctx.Request().Body())
+	}
+	if calls := atomic.LoadInt32(&primary.calls); calls != 4 {
+		t.Errorf("want primary called 4 times, got %d", calls)
+	}
+	if calls := atomic.LoadInt32(&secondary.calls); calls != 1 {
+		t.Errorf("want secondary not called while primary works, got %d", calls)
+	}
+}
+
+func TestFailoverOrderExhausted(t *testing.T) {
+	primary := newFailoverTestServer(t, http.StatusServiceUnavailable)
+	defer primary.Close()
+	unreachable := unreachableURL()
+
+	spec := &PoolSpec{
+		Servers: []*Server{
+			{URL: primary.URL},
+			{URL: unreachable, MaxAttempts: 2},
+		},
+		FailoverOrder: []string{unreachable},
+		LoadBalance:   &LoadBalance{Policy: PolicyRoundRobin},
+	}
+	p := newPool(spec, "proxy#main", true, []int{http.StatusServiceUnavailable}, nil)
+	defer p.close()
+
+	ctx := newFailoverTestContext()
+	result := p.handle(ctx, ctx.Request().Body())
+	if result != resultServerError {
+		t.Fatalf("want result %s, got %s", resultServerError, result)
+	}
+	if code := ctx.Response().StatusCode(); code != http.StatusServiceUnavailable {
+		t.Fatalf("want %d, got %d", http.StatusServiceUnavailable, code)
+	}
+}
+
+func TestFailoverOrderValidate(t *testing.T) {
+	for _, spec := range []*PoolSpec{
+		{
+			Servers:       []*Server{{URL: "http://127.0.0.1:9090"}},
+			FailoverOrder: []string{"http://127.0.0.1:9091"},
+			LoadBalance:   &LoadBalance{Policy: PolicyRoundRobin},
+		},
+		{
+			Servers:       []*Server{{URL: "http://127.0.0.1:9090"}},
+			FailoverOrder: []string{"http://127.0.0.1:9090"},
+			LoadBalance:   &LoadBalance{Policy: PolicyRoundRobin},
+		},
+	} {
+		if err := spec.Validate(); err == nil {
+			t.Errorf("want error for %+v", spec)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+)
+
+const (
+	grpcTimeoutHeader = "Grpc-Timeout"
+	grpcStatusHeader  = "Grpc-Status"
+	grpcMessageHeader = "Grpc-Message"
+
+	// Reference: https://github.com/grpc/grpc/blob/master/doc/statuscodes.md
+	grpcStatusDeadlineExceeded = "4"
+
+	// The value of grpc-timeout is at most 8 digits.
+	grpcMaxTimeoutValue int64 = 100000000 - 1
+)
+
+var grpcTimeoutUnits = []struct {
+	unit     string
+	duration time.Duration
+}{
+	{"n", time.Nanosecond},
+	{"u", time.Microsecond},
+	{"m", time.Millisecond},
+	{"S", time.Second},
+	{"M", time.Minute},
+	{"H", time.Hour},
+}
+
+func isGRPC(ctx context.HTTPContext) bool {
+	return strings.HasPrefix(ctx.Request().Header().Get("Content-Type"), "application/grpc")
+}
+
+// parseGRPCTimeout parses grpc-timeout.
+// Reference: https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-HTTP2.md
+func parseGRPCTimeout(s string) (time.Duration, error) {
+	if len(s) < 2 || len(s) > 9 {
+		return 0, fmt.Errorf("invalid grpc-timeout: %s", s)
+	}
+
+	value, err := strconv.ParseInt(s[:len(s)-1], 10, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid grpc-timeout: %s", s)
+	}
+
+	unit := s[len(s)-1:]
+	for _, u := range grpcTimeoutUnits {
+		if u.unit == unit {
+			return time.Duration(value) * u.duration, nil
+		}
+	}
+
+	return 0, fmt.Errorf("invalid grpc-timeout unit: %s", s)
+}
+
+// encodeGRPCTimeout encodes the timeout in the finest unit fitting in 8 digits,
+// it rounds up to not shorten the deadline.
+func encodeGRPCTimeout(d time.Duration) string {
+	if d <= 0 {
+		return "0n"
+	}
+
+	for _, u := range grpcTimeoutUnits {
+		value := int64(d / u.duration)
+		if d%u.duration > 0 {
+			value++
+		}
+		if value <= grpcMaxTimeoutValue {
+			return strconv.FormatInt(value, 10) + u.unit
+		}
+	}
+
+	return strconv.FormatInt(grpcMaxTimeoutValue, 10) + "H"
+}
+
+// propagateGRPCDeadline sets the remaining time of the inbound grpc-timeout
+// to the upstream call, it returns false if the deadline has been exceeded.
+func propagateGRPCDeadline(ctx context.HTTPContext) bool {
+	if !isGRPC(ctx) {
+		return true
+	}
+
+	header := ctx.Request().Header()
+	value := header.Get(grpcTimeoutHeader)
+	if value == "" {
+		return true
+	}
+
+	timeout, err := parseGRPCTimeout(value)
+	if err != nil {
+		// NOTE: Leave the invalid one to the upstream.
+		ctx.AddTag(err.Error())
+		return true
+	}
+
+	remaining := timeout - ctx.Duration()
+	if remaining <= 0 {
+		return false
+	}
+
+	header.Set(grpcTimeoutHeader, encodeGRPCTimeout(remaining))
+
+	return true
+}
+
+// failGRPCDeadlineExceeded responds a Trailers-Only gRPC response.
+func failGRPCDeadlineExceeded(ctx context.HTTPContext) {
+	w := ctx.Response()
+	w.SetStatusCode(http.StatusOK)
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set(grpcStatusHeader, grpcStatusDeadlineExceeded)
+	w.Header().Set(grpcMessageHeader, "deadline exceeded in gateway")
+	w.SetBody(nil)
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGRPCTimeout(t *testing.T) {
+	cases := []struct {
+		value    string
+		duration time.Duration
+	}{
+		{"100m", 100 * time.Millisecond},
+		{"3S", 3 * time.Second},
+		{"99999999n", 99999999 * time.Nanosecond},
+		{"1H", time.Hour},
+	}
+	for _, c := range cases {
+		d, err := parseGRPCTimeout(c.value)
+		if err != nil || d != c.duration {
+			t.Errorf("parse %s: want %v, got %v, %v", c.value, c.duration, d, err)
+		}
+	}
+
+	for _, value := range []string{"", "1", "100x", "-1m", "123456789m"} {
+		if _, err := parseGRPCTimeout(value); err == nil {
+			t.Errorf("parse %s: want error", value)
+		}
+	}
+
+	encodes := map[time.Duration]string{
+		0:                          "0n",
+		100 * time.Millisecond:     "100000u",
+		1500 * time.Microsecond:    "1500000n",
+		2*time.Second + 1:          "2000001u",
+		30 * time.Minute:           "1800000m",
+		200000 * time.Hour:         "12000000M",
+		-1 * time.Millisecond:      "0n",
+		99999999 * time.Nanosecond: "99999999n",
+	}
+	for d, want := range encodes {
+		if got := encodeGRPCTimeout(d); got != want {
+			t.Errorf("encode %v: want %s, got %s", d, want, got)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/http3"
+)
+
+const (
+	// upstreamH3Auto uses HTTP/3 to the servers advertising it by Alt-Svc.
+	upstreamH3Auto = "auto"
+
+	// defaultAltSvcMaxAge is the freshness of Alt-Svc without ma, see RFC 7838.
+	defaultAltSvcMaxAge = 24 * time.Hour
+)
+
+const (
+	h3Off h3Mode = iota
+	h3On
+	h3Auto
+)
+
+var (
+	// globalH3Client is the globalClient over HTTP/3, it skips
+	// the certificate verification in the same way.
+	globalH3Client = &http.Client{
+		Timeout: 0,
+		Transport: &http3.RoundTripper{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true,
+			},
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+)
+
+type (
+	h3Mode int
+
+	// h3Servers records the servers advertising HTTP/3 by Alt-Svc,
+	// it's keyed by server URL, and the value is the expiry time.
+	h3Servers struct {
+		servers sync.Map
+	}
+)
+
+// h3Mode returns the mode of upstreamH3, which is true, false or auto.
+func (s PoolSpec) h3Mode() (h3Mode, error) {
+	switch v := s.UpstreamH3.(type) {
+	case nil:
+		return h3Off, nil
+	case bool:
+		if v {
+			return h3On, nil
+		}
+		return h3Off, nil
+	case string:
+		if v == upstreamH3Auto {
+			return h3Auto, nil
+		}
+	}
+
+	return h3Off, fmt.Errorf("upstreamH3 must be true, false or %s, got %v", upstreamH3Auto, s.UpstreamH3)
+}
+
+func (s PoolSpec) validateUpstreamH3() error {
+	mode, err := s.h3Mode()
+	if err != nil {
+		return err
+	}
+
+	// NOTE: HTTP/3 runs over TLS only.
+	if mode == h3On {
+		for _, server := range s.Servers {
+			if !strings.HasPrefix(server.URL, "https://") {
+				return fmt.Errorf("upstreamH3 needs https servers, got %s", server.URL)
+			}
+		}
+	}
+
+	return nil
+}
+
+// useH3 reports whether to send the request to the server over HTTP/3.
+func (p *pool) useH3(server *Server) bool {
+	switch p.h3Mode {
+	case h3On:
+		return true
+	case h3Auto:
+		return p.h3Servers.available(server.URL)
+	default:
+		return false
+	}
+}
+
+func (hs *h3Servers) available(serverURL string) bool {
+	value, ok := hs.servers.Load(serverURL)
+	if !ok {
+		return false
+	}
+
+	if time.Now().After(value.(time.Time)) {
+		hs.servers.Delete(serverURL)
+		return false
+	}
+
+	return true
+}
+
+// update records the Alt-Svc of the server response.
+func (hs *h3Servers) update(serverURL string, altSvc string) {
+	if altSvc == "" || !strings.HasPrefix(serverURL, "https://") {
+		return
+	}
+
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+	}
+
+	maxAge, ok := parseAltSvcH3(altSvc, port)
+	if !ok {
+		hs.servers.Delete(serverURL)
+		return
+	}
+
+	hs.servers.Store(serverURL, time.Now().Add(maxAge))
+}
+
+// forget stops using HTTP/3 to the server until it's advertised again.
+func (hs *h3Servers) forget(serverURL string) {
+	hs.servers.Delete(serverURL)
+}
+
+// parseAltSvcH3 returns the max age of the HTTP/3 alternative on the same
+// port in Alt-Svc, such as `h3=":443"; ma=86400, h3-29=":443"`.
+// NOTE: Alternatives on other hosts or ports are ignored, since requests
+// are sent to the server URL.
+func parseAltSvcH3(altSvc, port string) (time.Duration, bool) {
+	for _, alternative := range strings.Split(altSvc, ",") {
+		params := strings.Split(alternative, ";")
+		protocolAuthority := strings.SplitN(strings.TrimSpace(params[0]), "=", 2)
+		if len(protocolAuthority) != 2 {
+			// NOTE: It's clear or invalid.
+			continue
+		}
+
+		protocol := protocolAuthority[0]
+		if protocol != "h3" && !strings.HasPrefix(protocol, "h3-") {
+			continue
+		}
+
+		authority := strings.Trim(protocolAuthority[1], `"`)
+		if authority != ":"+port {
+			continue
+		}
+
+		maxAge := defaultAltSvcMaxAge
+		for _, param := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) == 2 && kv[0] == "ma" {
+				seconds, err := strconv.Atoi(kv[1])
+				if err == nil {
+					maxAge = time.Duration(seconds) * time.Second
+				}
+			}
+		}
+
+		return maxAge, maxAge > 0
+	}
+
+	return 0, false
+}
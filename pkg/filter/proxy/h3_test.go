@@ -0,0 +1,109 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseAltSvcH3(t *testing.T) {
+	cases := []struct {
+		altSvc string
+		port   string
+		maxAge time.Duration
+		ok     bool
+	}{
+		{`h3=":443"; ma=3600`, "443", time.Hour, true},
+		{`h2=":443", h3-29=":443"`, "443", defaultAltSvcMaxAge, true},
+		{`h3=":8443"; ma=3600`, "443", 0, false},
+		{`h3="alt.example.com:443"`, "443", 0, false},
+		{`h3=":443"; ma=0`, "443", 0, false},
+		{`clear`, "443", 0, false},
+		{`h2=":443"`, "443", 0, false},
+	}
+
+	for _, c := range cases {
+		maxAge, ok := parseAltSvcH3(c.altSvc, c.port)
+		if ok != c.ok || (ok && maxAge != c.maxAge) {
+			t.Errorf("%s: want %v %v, got %v %v", c.altSvc, c.maxAge, c.ok, maxAge, ok)
+		}
+	}
+}
+
+func TestH3Mode(t *testing.T) {
+	cases := []struct {
+		upstreamH3 interface{}
+		mode       h3Mode
+		valid      bool
+	}{
+		{nil, h3Off, true},
+		{false, h3Off, true},
+		{true, h3On, true},
+		{"auto", h3Auto, true},
+		{"always", h3Off, false},
+	}
+
+	for _, c := range cases {
+		mode, err := PoolSpec{UpstreamH3: c.upstreamH3}.h3Mode()
+		if mode != c.mode || (err == nil) != c.valid {
+			t.Errorf("%v: want %v valid %v, got %v %v", c.upstreamH3, c.mode, c.valid, mode, err)
+		}
+	}
+
+	spec := PoolSpec{UpstreamH3: true, Servers: []*Server{{URL: "http://127.0.0.1:8080"}}}
+	if spec.validateUpstreamH3() == nil {
+		t.Errorf("want error for http server with upstreamH3")
+	}
+}
+
+func TestH3ServersAuto(t *testing.T) {
+	p := &pool{h3Mode: h3Auto}
+	server := &Server{URL: "https://127.0.0.1:8443"}
+
+	if p.useH3(server) {
+		t.Fatalf("want TCP before Alt-Svc")
+	}
+
+	p.h3Servers.update(server.URL, `h3=":8443"; ma=60`)
+	if !p.useH3(server) {
+		t.Fatalf("want HTTP/3 after Alt-Svc")
+	}
+
+	p.h3Servers.forget(server.URL)
+	if p.useH3(server) {
+		t.Fatalf("want TCP after HTTP/3 failed")
+	}
+
+	p.h3Servers.update(server.URL, `h3=":8443"; ma=60`)
+	p.h3Servers.update(server.URL, `clear`)
+	if p.useH3(server) {
+		t.Fatalf("want TCP after Alt-Svc cleared")
+	}
+
+	p.h3Servers.servers.Store(server.URL, time.Now().Add(-time.Second))
+	if p.useH3(server) {
+		t.Fatalf("want TCP after Alt-Svc expired")
+	}
+
+	plain := &Server{URL: "http://127.0.0.1:8080"}
+	p.h3Servers.update(plain.URL, `h3=":8080"`)
+	if p.useH3(plain) {
+		t.Fatalf("want TCP for http server")
+	}
+}
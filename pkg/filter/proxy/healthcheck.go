@@ -0,0 +1,345 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package proxy
+
+import (
+	stdcontext "context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	defaultHealthCheckInterval = 10 * time.Second
+	defaultHealthCheckTimeout  = 3 * time.Second
+)
+
+type (
+	// HealthCheckSpec describes the active health check of servers,
+	// exactly one of HTTP, Shell and Probes is required.
+	HealthCheckSpec struct {
+		Interval string `yaml:"interval" jsonschema:"omitempty,format=duration"`
+		Timeout  string `yaml:"timeout" jsonschema:"omitempty,format=duration"`
+		// Fails is the number of consecutive failures to mark a server unhealthy.
+		Fails int `yaml:"fails" jsonschema:"omitempty,minimum=1"`
+		// Passes is the number of consecutive successes to mark a server healthy.
+		Passes int `yaml:"passes" jsonschema:"omitempty,minimum=1"`
+
+		HTTP  *HTTPHealthCheckSpec  `yaml:"http,omitempty" jsonschema:"omitempty"`
+		Shell *ShellHealthCheckSpec `yaml:"shell,omitempty" jsonschema:"omitempty"`
+		// Probes check the servers in different protocols,
+		// all of them must pass.
+		Probes []*ProbeSpec `yaml:"probes,omitempty" jsonschema:"omitempty"`
+	}
+
+	// HTTPHealthCheckSpec checks servers by requesting the path,
+	// the status code 2xx and 3xx means healthy.
+	HTTPHealthCheckSpec struct {
+		Path string `yaml:"path" jsonschema:"required,pattern=^/"`
+	}
+
+	// ShellHealthCheckSpec checks servers by running the command with sh,
+	// exit code 0 means healthy. The command must be one of the
+	// health-check-allowed-commands in the startup options exactly.
+	// The server is passed by environment variables EG_SERVER_URL,
+	// EG_SERVER_HOST and EG_SERVER_PORT, such as:
+	//
+	//   redis-cli -h $EG_SERVER_HOST -p $EG_SERVER_PORT ping
+	ShellHealthCheckSpec struct {
+		Command string `yaml:"command" jsonschema:"required"`
+	}
+
+	healthChecker struct {
+		spec     *HealthCheckSpec
+		interval time.Duration
+		timeout  time.Duration
+		fails    int
+		passes   int
+
+		// check is nil if the check is disabled.
+		check   func(ctx stdcontext.Context, server *Server) error
+		servers func() *staticServers
+
+		mutex   sync.Mutex
+		states  map[string]*serverHealth
+		version uint64
+		cache   *healthyServersCache
+
+		done chan struct{}
+	}
+
+	serverHealth struct {
+		healthy bool
+		fails   int
+		passes  int
+	}
+
+	healthyServersCache struct {
+		source  *staticServers
+		version uint64
+		healthy *staticServers
+	}
+
+	// ServerHealthStatus is the status of health of a server.
+	ServerHealthStatus struct {
+		Healthy bool `yaml:"healthy"`
+		Fails   int  `yaml:"fails"`
+		Passes  int  `yaml:"passes"`
+		// Degraded is true if the certificate of the server expired.
+		Degraded bool `yaml:"degraded,omitempty"`
+	}
+)
+
+// Validate validates HealthCheckSpec.
+func (spec HealthCheckSpec) Validate() error {
+	checks := 0
+	if spec.HTTP != nil {
+		checks++
+	}
+	if spec.Shell != nil {
+		checks++
+	}
+	if len(spec.Probes) > 0 {
+		checks++
+	}
+	if checks != 1 {
+		return fmt.Errorf("exactly one of http, shell and probes is required")
+	}
+
+	return nil
+}
+
+func parseDurationOrDefault(s string, defaultValue time.Duration) time.Duration {
+	if s == "" {
+		return defaultValue
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		logger.Errorf("BUG: parse duration %s failed: %v", s, err)
+		return defaultValue
+	}
+
+	return d
+}
+
+func newHealthChecker(spec *HealthCheckSpec, allowedCommands []string,
+	servers func() *staticServers) *healthChecker {
+
+	hc := &healthChecker{
+		spec:     spec,
+		interval: parseDurationOrDefault(spec.Interval, defaultHealthCheckInterval),
+		timeout:  parseDurationOrDefault(spec.Timeout, defaultHealthCheckTimeout),
+		fails:    spec.Fails,
+		passes:   spec.Passes,
+		servers:  servers,
+		states:   make(map[string]*serverHealth),
+		done:     make(chan struct{}),
+	}
+	if hc.fails <= 0 {
+		hc.fails = 1
+	}
+	if hc.passes <= 0 {
+		hc.passes = 1
+	}
+
+	switch {
+	case spec.HTTP != nil:
+		hc.check = hc.checkHTTP
+	case len(spec.Probes) > 0:
+		hc.check = hc.checkProbes
+	case spec.Shell != nil:
+		// NOTE: Anyone who can edit the spec must not be able to run
+		// arbitrary commands, so it's restricted by the startup options.
+		if stringtool.StrInSlice(spec.Shell.Command, allowedCommands) {
+			hc.check = hc.checkShell
+		} else {
+			logger.Errorf("shell health check disabled: command %q is not allowed, "+
+				"add it to health-check-allowed-commands to enable it", spec.Shell.Command)
+		}
+	}
+
+	if hc.check != nil {
+		go hc.run()
+	}
+
+	return hc
+}
+
+func (hc *healthChecker) run() {
+	ticker := time.NewTicker(hc.interval)
+	defer ticker.Stop()
+
+	for {
+		hc.checkAll()
+
+		select {
+		case <-hc.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (hc *healthChecker) checkAll() {
+	static := hc.servers()
+	if static == nil {
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, server := range static.servers {
+		wg.Add(1)
+		go func(server *Server) {
+			defer wg.Done()
+
+			ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), hc.timeout)
+			defer cancel()
+
+			err := hc.check(ctx, server)
+			hc.record(server.URL, err)
+		}(server)
+	}
+	wg.Wait()
+}
+
+func (hc *healthChecker) record(serverURL string, err error) {
+	hc.mutex.Lock()
+	defer hc.mutex.Unlock()
+
+	state, exists := hc.states[serverURL]
+	if !exists {
+		state = &serverHealth{healthy: true}
+		hc.states[serverURL] = state
+	}
+
+	if err == nil {
+		state.fails = 0
+		state.passes++
+		if !state.healthy && state.passes >= hc.passes {
+			state.healthy = true
+			hc.version++
+			logger.Infof("server %s turns healthy", serverURL)
+		}
+		return
+	}
+
+	state.passes = 0
+	state.fails++
+	if state.healthy && state.fails >= hc.fails {
+		state.healthy = false
+		hc.version++
+		logger.Warnf("server %s turns unhealthy: %v", serverURL, err)
+	}
+}
+
+func (hc *healthChecker) checkHTTP(ctx stdcontext.Context, server *Server) error {
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		return err
+	}
+
+	return probeHTTPServer(ctx, u, &ProbeSpec{Protocol: probeHTTP, Path: hc.spec.HTTP.Path})
+}
+
+func (hc *healthChecker) checkShell(ctx stdcontext.Context, server *Server) error {
+	cmd := exec.CommandContext(ctx, "sh", "-c", hc.spec.Shell.Command)
+	cmd.Env = append(os.Environ(), "EG_SERVER_URL="+server.URL)
+	if u, err := url.Parse(server.URL); err == nil {
+		cmd.Env = append(cmd.Env, "EG_SERVER_HOST="+u.Hostname(), "EG_SERVER_PORT="+u.Port())
+	}
+
+	type result struct {
+		output []byte
+		err    error
+	}
+	resultChan := make(chan *result, 1)
+	go func() {
+		output, err := cmd.CombinedOutput()
+		resultChan <- &result{output: output, err: err}
+	}()
+
+	// NOTE: Don't wait for the output after timeout, the processes
+	// forked by sh may still hold it after sh is killed.
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("command timeout after %v", hc.timeout)
+	case r := <-resultChan:
+		if r.err != nil {
+			return fmt.Errorf("%v: %s", r.err, r.output)
+		}
+		return nil
+	}
+}
+
+// filter returns the healthy ones of the servers, it returns
+// all of them if none is healthy, in order not to drop all traffic.
+func (hc *healthChecker) filter(static *staticServers) *staticServers {
+	hc.mutex.Lock()
+	defer hc.mutex.Unlock()
+
+	if hc.cache != nil && hc.cache.source == static && hc.cache.version == hc.version {
+		return hc.cache.healthy
+	}
+
+	healthy := &staticServers{lb: static.lb}
+	for _, server := range static.servers {
+		if state, exists := hc.states[server.URL]; !exists || state.healthy {
+			healthy.servers = append(healthy.servers, server)
+		}
+	}
+	if healthy.len() == 0 {
+		logger.Warnf("no healthy server, use all of them")
+		healthy = static
+	} else {
+		healthy.prepare()
+	}
+
+	hc.cache = &healthyServersCache{
+		source:  static,
+		version: hc.version,
+		healthy: healthy,
+	}
+
+	return healthy
+}
+
+func (hc *healthChecker) status() map[string]*ServerHealthStatus {
+	hc.mutex.Lock()
+	defer hc.mutex.Unlock()
+
+	s := make(map[string]*ServerHealthStatus, len(hc.states))
+	for serverURL, state := range hc.states {
+		s[serverURL] = &ServerHealthStatus{
+			Healthy: state.healthy,
+			Fails:   state.fails,
+			Passes:  state.passes,
+		}
+	}
+
+	return s
+}
+
+func (hc *healthChecker) close() {
+	close(hc.done)
+}
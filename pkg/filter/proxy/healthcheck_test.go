@@ -0,0 +1,115 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package proxy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
+)
+
+func TestMain(m *testing.M) {
+	tempDir, err := ioutil.TempDir("", "eg-proxy-test")
+	if err != nil {
+		panic(err)
+	}
+	absLogDir := filepath.Join(tempDir, "log")
+	os.MkdirAll(absLogDir, 0755)
+	logger.Init(&option.Options{
+		Name:      "proxy-for-log",
+		AbsLogDir: absLogDir,
+	})
+
+	code := m.Run()
+
+	logger.Sync()
+	os.RemoveAll(tempDir)
+
+	os.Exit(code)
+}
+
+func TestShellHealthCheck(t *testing.T) {
+	static := newStaticServers([]*Server{
+		{URL: "http://127.0.0.1:6379"},
+		{URL: "http://127.0.0.1:6380"},
+	}, nil, LoadBalance{Policy: PolicyRoundRobin})
+	servers := func() *staticServers { return static }
+
+	command := `test "$EG_SERVER_PORT" = 6379`
+	spec := &HealthCheckSpec{
+		Interval: "1h",
+		Shell:    &ShellHealthCheckSpec{Command: command},
+	}
+
+	hc := newHealthChecker(spec, []string{command}, servers)
+	defer hc.close()
+	hc.checkAll()
+
+	healthy := hc.filter(static)
+	if healthy.len() != 1 || healthy.servers[0].URL != "http://127.0.0.1:6379" {
+		t.Errorf("want only server 6379 healthy, got %v", healthy.servers)
+	}
+	if status := hc.status(); status["http://127.0.0.1:6380"] == nil || status["http://127.0.0.1:6380"].Healthy {
+		t.Errorf("want server 6380 unhealthy in status, got %v", status)
+	}
+
+	// NOTE: The command is not in the allowed list.
+	hc = newHealthChecker(spec, []string{"redis-cli ping"}, servers)
+	defer hc.close()
+	if hc.check != nil {
+		t.Fatalf("want shell health check disabled")
+	}
+	if healthy := hc.filter(static); healthy.len() != 2 {
+		t.Errorf("want all servers healthy, got %v", healthy.servers)
+	}
+}
+
+func TestShellHealthCheckTimeout(t *testing.T) {
+	static := newStaticServers([]*Server{{URL: "http://127.0.0.1:6379"}},
+		nil, LoadBalance{Policy: PolicyRoundRobin})
+
+	command := "sleep 10"
+	hc := newHealthChecker(&HealthCheckSpec{
+		Interval: "1h",
+		Timeout:  "100ms",
+		Fails:    2,
+		Shell:    &ShellHealthCheckSpec{Command: command},
+	}, []string{command}, func() *staticServers { return static })
+	defer hc.close()
+
+	start := time.Now()
+	hc.checkAll()
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("want check timeout in 100ms, took %v", elapsed)
+	}
+
+	// NOTE: The initial run may or may not have been recorded,
+	// so check again to reach the fails threshold for sure.
+	hc.checkAll()
+	if status := hc.status(); status["http://127.0.0.1:6379"].Healthy {
+		t.Errorf("want server unhealthy after timeouts, got %v", status)
+	}
+	// NOTE: None healthy means all of them.
+	if healthy := hc.filter(static); healthy.len() != 1 {
+		t.Errorf("want all servers used when none healthy, got %v", healthy.servers)
+	}
+}
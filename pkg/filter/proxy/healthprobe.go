@@ -0,0 +1,216 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	stdcontext "context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/miekg/dns"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	probeTCP  = "tcp"
+	probeHTTP = "http"
+	probeGRPC = "grpc"
+	probeDNS  = "dns"
+
+	defaultDNSPort = 53
+)
+
+type (
+	// ProbeSpec is the health check of one protocol, the success
+	// conditions are:
+	//   tcp:  the connection is established.
+	//   http: the status code of Path is 2xx or 3xx.
+	//   grpc: grpc.health.v1.Health/Check of Service returns SERVING.
+	//   dns:  the RCODE of resolving Name by the server is in RCodes.
+	ProbeSpec struct {
+		Protocol string `yaml:"protocol" jsonschema:"required,enum=tcp,enum=http,enum=grpc,enum=dns"`
+		// Port overrides the port of the servers,
+		// the default of dns is 53.
+		Port int `yaml:"port" jsonschema:"omitempty,minimum=1,maximum=65535"`
+
+		Path    string   `yaml:"path" jsonschema:"omitempty,pattern=^/"`
+		Service string   `yaml:"service" jsonschema:"omitempty"`
+		Name    string   `yaml:"name" jsonschema:"omitempty"`
+		RCodes  []string `yaml:"rcodes" jsonschema:"omitempty,uniqueItems=true"`
+	}
+)
+
+// Validate validates ProbeSpec.
+func (spec ProbeSpec) Validate() error {
+	switch spec.Protocol {
+	case probeHTTP:
+		if spec.Path == "" {
+			return fmt.Errorf("path is required by http probe")
+		}
+	case probeDNS:
+		if spec.Name == "" {
+			return fmt.Errorf("name is required by dns probe")
+		}
+		for _, rcode := range spec.RCodes {
+			if _, exists := dns.StringToRcode[rcode]; !exists {
+				return fmt.Errorf("unknown rcode %s", rcode)
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkProbes checks the server by all probes, the first failure fails it.
+func (hc *healthChecker) checkProbes(ctx stdcontext.Context, server *Server) error {
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		return err
+	}
+
+	for _, probe := range hc.spec.Probes {
+		var err error
+		switch probe.Protocol {
+		case probeTCP:
+			err = probeTCPServer(ctx, probeAddr(u, probe.Port))
+		case probeHTTP:
+			err = probeHTTPServer(ctx, u, probe)
+		case probeGRPC:
+			err = probeGRPCServer(ctx, u, probe)
+		case probeDNS:
+			port := probe.Port
+			if port == 0 {
+				port = defaultDNSPort
+			}
+			err = probeDNSServer(ctx, probeAddr(u, port), probe)
+		}
+		if err != nil {
+			return fmt.Errorf("%s probe: %v", probe.Protocol, err)
+		}
+	}
+
+	return nil
+}
+
+// probeAddr returns the address of the server, with the port
+// overridden if it's not zero.
+func probeAddr(u *url.URL, port int) string {
+	if port != 0 {
+		return net.JoinHostPort(u.Hostname(), strconv.Itoa(port))
+	}
+
+	if u.Port() != "" {
+		return u.Host
+	}
+
+	if u.Scheme == "https" {
+		return net.JoinHostPort(u.Hostname(), "443")
+	}
+	return net.JoinHostPort(u.Hostname(), "80")
+}
+
+func probeTCPServer(ctx stdcontext.Context, addr string) error {
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return conn.Close()
+}
+
+func probeHTTPServer(ctx stdcontext.Context, u *url.URL, probe *ProbeSpec) error {
+	target := *u
+	if probe.Port != 0 {
+		target.Host = probeAddr(u, probe.Port)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String()+probe.Path, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := globalClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return fmt.Errorf("status code %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+func probeGRPCServer(ctx stdcontext.Context, u *url.URL, probe *ProbeSpec) error {
+	// NOTE: Skip the certificate verification in the same way as globalClient.
+	creds := grpc.WithInsecure()
+	if u.Scheme == "https" {
+		creds = grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+			InsecureSkipVerify: true,
+		}))
+	}
+
+	conn, err := grpc.DialContext(ctx, probeAddr(u, probe.Port), creds, grpc.WithBlock())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx,
+		&healthpb.HealthCheckRequest{Service: probe.Service})
+	if err != nil {
+		return err
+	}
+
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("status %s", resp.Status)
+	}
+
+	return nil
+}
+
+func probeDNSServer(ctx stdcontext.Context, addr string, probe *ProbeSpec) error {
+	msg := &dns.Msg{}
+	msg.SetQuestion(dns.Fqdn(probe.Name), dns.TypeA)
+
+	resp, _, err := (&dns.Client{}).ExchangeContext(ctx, msg, addr)
+	if err != nil {
+		return err
+	}
+
+	rcodes := probe.RCodes
+	if len(rcodes) == 0 {
+		rcodes = []string{dns.RcodeToString[dns.RcodeSuccess]}
+	}
+
+	rcode := dns.RcodeToString[resp.Rcode]
+	for _, want := range rcodes {
+		if rcode == want {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("rcode %s", rcode)
+}
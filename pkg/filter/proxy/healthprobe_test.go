@@ -0,0 +1,154 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	stdcontext "context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestProbeSpecValidate(t *testing.T) {
+	for _, c := range []struct {
+		spec  ProbeSpec
+		valid bool
+	}{
+		{ProbeSpec{Protocol: probeTCP}, true},
+		{ProbeSpec{Protocol: probeHTTP, Path: "/healthz"}, true},
+		{ProbeSpec{Protocol: probeHTTP}, false},
+		{ProbeSpec{Protocol: probeGRPC}, true},
+		{ProbeSpec{Protocol: probeDNS, Name: "example.com", RCodes: []string{"NOERROR", "NXDOMAIN"}}, true},
+		{ProbeSpec{Protocol: probeDNS}, false},
+		{ProbeSpec{Protocol: probeDNS, Name: "example.com", RCodes: []string{"OK"}}, false},
+	} {
+		if err := c.spec.Validate(); (err == nil) != c.valid {
+			t.Errorf("%+v: want valid %v, got %v", c.spec, c.valid, err)
+		}
+	}
+}
+
+func newProbeTestDNSServer(t *testing.T) int {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen udp failed: %v", err)
+	}
+
+	server := &dns.Server{
+		PacketConn: conn,
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+			resp := &dns.Msg{}
+			resp.SetReply(req)
+			if req.Question[0].Name != "healthy.local." {
+				resp.Rcode = dns.RcodeNameError
+			}
+			w.WriteMsg(resp)
+		}),
+	}
+	go server.ActivateAndServe()
+	t.Cleanup(func() { server.Shutdown() })
+
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func newProbeTestGRPCServer(t *testing.T) (string, *health.Server) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen tcp failed: %v", err)
+	}
+
+	healthServer := health.NewServer()
+	server := grpc.NewServer()
+	healthpb.RegisterHealthServer(server, healthServer)
+	go server.Serve(ln)
+	t.Cleanup(server.Stop)
+
+	return ln.Addr().String(), healthServer
+}
+
+func TestHealthCheckProbes(t *testing.T) {
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer httpServer.Close()
+	httpURL, _ := url.Parse(httpServer.URL)
+	httpPort, _ := strconv.Atoi(httpURL.Port())
+
+	grpcAddr, grpcHealth := newProbeTestGRPCServer(t)
+	dnsPort := newProbeTestDNSServer(t)
+
+	// NOTE: The port of a closed listener refuses connections.
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedPort := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	server := &Server{URL: "http://" + grpcAddr}
+	check := func(probes ...*ProbeSpec) error {
+		hc := &healthChecker{spec: &HealthCheckSpec{Probes: probes}}
+		ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), 3*time.Second)
+		defer cancel()
+		return hc.checkProbes(ctx, server)
+	}
+
+	tcp := &ProbeSpec{Protocol: probeTCP}
+	httpProbe := &ProbeSpec{Protocol: probeHTTP, Port: httpPort, Path: "/healthz"}
+	grpcProbe := &ProbeSpec{Protocol: probeGRPC, Service: "order"}
+	dnsProbe := &ProbeSpec{Protocol: probeDNS, Port: dnsPort, Name: "healthy.local"}
+
+	grpcHealth.SetServingStatus("order", healthpb.HealthCheckResponse_SERVING)
+	if err := check(tcp, httpProbe, grpcProbe, dnsProbe); err != nil {
+		t.Fatalf("want all probes passed, got %v", err)
+	}
+
+	for _, c := range []struct {
+		name  string
+		probe *ProbeSpec
+	}{
+		{"tcp", &ProbeSpec{Protocol: probeTCP, Port: closedPort}},
+		{"http", &ProbeSpec{Protocol: probeHTTP, Port: httpPort, Path: "/unhealthy"}},
+		{"grpc", &ProbeSpec{Protocol: probeGRPC, Service: "payment"}},
+		{"dns", &ProbeSpec{Protocol: probeDNS, Port: dnsPort, Name: "unhealthy.local"}},
+	} {
+		// NOTE: All probes must pass.
+		if err := check(tcp, httpProbe, grpcProbe, dnsProbe, c.probe); err == nil {
+			t.Errorf("%s: want failed probe", c.name)
+		}
+	}
+
+	grpcHealth.SetServingStatus("order", healthpb.HealthCheckResponse_NOT_SERVING)
+	if err := check(grpcProbe); err == nil {
+		t.Errorf("want not serving grpc failed")
+	}
+
+	dnsProbe.RCodes = []string{"NOERROR", "NXDOMAIN"}
+	dnsProbe.Name = "unhealthy.local"
+	if err := check(dnsProbe); err != nil {
+		t.Errorf("want NXDOMAIN accepted, got %v", err)
+	}
+}
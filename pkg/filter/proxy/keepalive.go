@@ -0,0 +1,241 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultTCPKeepaliveIdle     = 30 * time.Second
+	defaultTCPKeepaliveInterval = 15 * time.Second
+)
+
+type (
+	// keepaliveDialer dials the connections of the pools with their TCP
+	// keepalive settings. Once a connection is broken by the keepalive
+	// probes, the next connection to the same address is counted as a
+	// reconnect.
+	keepaliveDialer struct {
+		dialer   net.Dialer
+		enabled  bool
+		idle     time.Duration
+		interval time.Duration
+
+		// broken is the set of the addresses whose connections are
+		// broken by the keepalive probes and not dialed again yet.
+		broken     sync.Map
+		reconnects uint64
+	}
+
+	keepaliveConn struct {
+		net.Conn
+		addr   string
+		dialer *keepaliveDialer
+	}
+
+	// poolClientKey is the settings of the pools sharing a client.
+	poolClientKey struct {
+		keepalive            bool
+		idle                 time.Duration
+		interval             time.Duration
+		tlsResumption        bool
+		sessionCacheCapacity int
+	}
+
+	// poolClient is the client shared by the pools, and the dialer
+	// counting the keepalive reconnects of it.
+	poolClient struct {
+		client    *http.Client
+		keepalive *keepaliveDialer
+	}
+)
+
+var (
+	// defaultKeepaliveDialer dials the connections of the globalClient.
+	defaultKeepaliveDialer = newKeepaliveDialer(&PoolSpec{})
+
+	defaultPoolClientKey = poolClientKey{
+		keepalive: true,
+		idle:      defaultTCPKeepaliveIdle,
+		interval:  defaultTCPKeepaliveInterval,
+	}
+	defaultPoolClient = &poolClient{
+		client:    globalClient,
+		keepalive: defaultKeepaliveDialer,
+	}
+
+	// poolClients are the clients of the pools with the non-default
+	// settings, they live as long as the globalClient.
+	poolClients      = map[poolClientKey]*poolClient{}
+	poolClientsMutex sync.Mutex
+)
+
+func (s PoolSpec) tcpKeepalive() bool {
+	return s.TCPKeepalive == nil || *s.TCPKeepalive
+}
+
+func (s PoolSpec) tcpKeepaliveDurations() (idle, interval time.Duration, err error) {
+	idle, interval = defaultTCPKeepaliveIdle, defaultTCPKeepaliveInterval
+
+	if s.TCPKeepaliveIdle != "" {
+		idle, err = time.ParseDuration(s.TCPKeepaliveIdle)
+		if err != nil || idle < time.Second {
+			return 0, 0, fmt.Errorf("invalid tcpKeepaliveIdle %s", s.TCPKeepaliveIdle)
+		}
+	}
+
+	if s.TCPKeepaliveInterval != "" {
+		interval, err = time.ParseDuration(s.TCPKeepaliveInterval)
+		if err != nil || interval < time.Second {
+			return 0, 0, fmt.Errorf("invalid tcpKeepaliveInterval %s", s.TCPKeepaliveInterval)
+		}
+	}
+
+	return idle, interval, nil
+}
+
+func (s PoolSpec) validateTCPKeepalive() error {
+	if !s.tcpKeepalive() && (s.TCPKeepaliveIdle != "" || s.TCPKeepaliveInterval != "") {
+		return fmt.Errorf("tcpKeepaliveIdle and tcpKeepaliveInterval need tcpKeepalive")
+	}
+
+	_, _, err := s.tcpKeepaliveDurations()
+	return err
+}
+
+func newKeepaliveDialer(spec *PoolSpec) *keepaliveDialer {
+	// NOTE: The spec has been validated.
+	idle, interval, _ := spec.tcpKeepaliveDurations()
+
+	return &keepaliveDialer{
+		dialer: net.Dialer{
+			Timeout: 30 * time.Second,
+			// NOTE: The keepalive of the standard library sets the same
+			// idle time and interval, so it's disabled here and the
+			// connections are set up by setKeepalive instead.
+			KeepAlive: -1,
+			DualStack: true,
+		},
+		enabled:  spec.tcpKeepalive(),
+		idle:     idle,
+		interval: interval,
+	}
+}
+
+func (d *keepaliveDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := d.dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if !d.enabled {
+		return conn, nil
+	}
+
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		err = setKeepalive(tcpConn, d.idle, d.interval)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	if _, loaded := d.broken.LoadAndDelete(addr); loaded {
+		atomic.AddUint64(&d.reconnects, 1)
+	}
+
+	return &keepaliveConn{Conn: conn, addr: addr, dialer: d}, nil
+}
+
+func (d *keepaliveDialer) reconnectCount() uint64 {
+	return atomic.LoadUint64(&d.reconnects)
+}
+
+// Read marks the address broken if the connection timed out, which is
+// how the kernel reports the peer not answering the keepalive probes.
+func (c *keepaliveConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if err != nil && errors.Is(err, syscall.ETIMEDOUT) {
+		c.dialer.broken.Store(c.addr, struct{}{})
+	}
+	return n, err
+}
+
+// cloneClient returns a client with its own connections,
+// the settings are the same as the client.
+func cloneClient(client *http.Client) *http.Client {
+	transport := client.Transport.(*http.Transport).Clone()
+
+	return &http.Client{
+		Timeout:       client.Timeout,
+		Transport:     transport,
+		CheckRedirect: client.CheckRedirect,
+	}
+}
+
+// getPoolClient returns the client shared by the pools with the same
+// keepalive and TLS resumption settings, so the connections are reused
+// across the pools and their generations. It's the globalClient if the
+// settings are the defaults.
+func getPoolClient(spec *PoolSpec) *poolClient {
+	// NOTE: The spec has been validated.
+	idle, interval, _ := spec.tcpKeepaliveDurations()
+	key := poolClientKey{
+		keepalive: spec.tcpKeepalive(),
+		idle:      idle,
+		interval:  interval,
+	}
+	if spec.TLSSessionResumption {
+		key.tlsResumption = true
+		key.sessionCacheCapacity = spec.SessionCacheCapacity
+	}
+
+	if key == defaultPoolClientKey {
+		return defaultPoolClient
+	}
+
+	poolClientsMutex.Lock()
+	defer poolClientsMutex.Unlock()
+
+	if c, exists := poolClients[key]; exists {
+		return c
+	}
+
+	var client *http.Client
+	if spec.TLSSessionResumption {
+		client = newTLSResumptionClient(spec.SessionCacheCapacity)
+	} else {
+		client = cloneClient(globalClient)
+	}
+	keepalive := newKeepaliveDialer(spec)
+	client.Transport.(*http.Transport).DialContext = keepalive.DialContext
+
+	c := &poolClient{client: client, keepalive: keepalive}
+	poolClients[key] = c
+
+	return c
+}
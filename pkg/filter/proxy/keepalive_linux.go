@@ -0,0 +1,57 @@
+//go:build linux
+// +build linux
+
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"net"
+	"syscall"
+	"time"
+)
+
+// setKeepalive enables the keepalive of conn, the first probe is sent
+// after idle, and the following ones are sent every interval.
+func setKeepalive(conn *net.TCPConn, idle, interval time.Duration) error {
+	err := conn.SetKeepAlive(true)
+	if err != nil {
+		return err
+	}
+
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var sockErr error
+	err = rawConn.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP,
+			syscall.TCP_KEEPIDLE, int(idle/time.Second))
+		if sockErr != nil {
+			return
+		}
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP,
+			syscall.TCP_KEEPINTVL, int(interval/time.Second))
+	})
+	if err != nil {
+		return err
+	}
+
+	return sockErr
+}
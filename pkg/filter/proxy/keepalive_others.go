@@ -0,0 +1,37 @@
+//go:build !linux
+// +build !linux
+
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"net"
+	"time"
+)
+
+// setKeepalive enables the keepalive of conn, the interval can't be
+// set apart from the idle time on this platform, so both are idle.
+func setKeepalive(conn *net.TCPConn, idle, interval time.Duration) error {
+	err := conn.SetKeepAlive(true)
+	if err != nil {
+		return err
+	}
+
+	return conn.SetKeepAlivePeriod(idle)
+}
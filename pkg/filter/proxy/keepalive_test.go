@@ -0,0 +1,141 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"context"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+type timedOutConn struct {
+	net.Conn
+}
+
+func (c timedOutConn) Read(b []byte) (int, error) {
+	return 0, &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ETIMEDOUT)}
+}
+
+func TestValidateTCPKeepalive(t *testing.T) {
+	disabled := false
+	for _, c := range []struct {
+		spec  PoolSpec
+		valid bool
+	}{
+		{PoolSpec{}, true},
+		{PoolSpec{TCPKeepaliveIdle: "1m", TCPKeepaliveInterval: "10s"}, true},
+		{PoolSpec{TCPKeepaliveIdle: "500ms"}, false},
+		{PoolSpec{TCPKeepaliveInterval: "abc"}, false},
+		{PoolSpec{TCPKeepalive: &disabled}, true},
+		{PoolSpec{TCPKeepalive: &disabled, TCPKeepaliveIdle: "1m"}, false},
+	} {
+		err := c.spec.validateTCPKeepalive()
+		if (err == nil) != c.valid {
+			t.Errorf("%+v: want valid %v, got %v", c.spec, c.valid, err)
+		}
+	}
+
+	d := newKeepaliveDialer(&PoolSpec{})
+	if !d.enabled || d.idle != defaultTCPKeepaliveIdle || d.interval != defaultTCPKeepaliveInterval {
+		t.Errorf("want keepalive enabled with defaults, got %v %v %v", d.enabled, d.idle, d.interval)
+	}
+}
+
+func TestKeepaliveReconnects(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	d := newKeepaliveDialer(&PoolSpec{})
+	addr := ln.Addr().String()
+	dial := func() *keepaliveConn {
+		conn, err := d.DialContext(context.Background(), "tcp", addr)
+		if err != nil {
+			t.Fatalf("dial failed: %v", err)
+		}
+		return conn.(*keepaliveConn)
+	}
+
+	conn := dial()
+	conn.Close()
+	dial().Close()
+	if n := d.reconnectCount(); n != 0 {
+		t.Fatalf("want no reconnects, got %d", n)
+	}
+
+	// NOTE: It's how the connection fails once the keepalive probes
+	// are not answered.
+	conn = dial()
+	conn.Conn.Close()
+	conn.Conn = timedOutConn{conn.Conn}
+	conn.Read(make([]byte, 1))
+
+	dial().Close()
+	dial().Close()
+	if n := d.reconnectCount(); n != 1 {
+		t.Fatalf("want 1 reconnect, got %d", n)
+	}
+}
+
+func TestPoolClientShared(t *testing.T) {
+	disabled := false
+	newTestPool := func(spec PoolSpec) *pool {
+		spec.Servers = []*Server{{URL: "http://127.0.0.1:9095"}}
+		spec.LoadBalance = &LoadBalance{Policy: PolicyRoundRobin}
+		return newPool(&spec, "proxy#main", true, nil, nil)
+	}
+
+	p := newTestPool(PoolSpec{})
+	defer p.close()
+	if p.client != globalClient || p.keepalive != defaultKeepaliveDialer {
+		t.Fatalf("want globalClient for the default settings")
+	}
+
+	p1 := newTestPool(PoolSpec{TCPKeepalive: &disabled})
+	defer p1.close()
+	p2 := newTestPool(PoolSpec{TCPKeepalive: &disabled})
+	defer p2.close()
+	if p1.client == globalClient || p1.client != p2.client || p1.keepalive != p2.keepalive {
+		t.Fatalf("want one client shared by the pools with the same settings")
+	}
+
+	p3 := newTestPool(PoolSpec{TLSSessionResumption: true})
+	defer p3.close()
+	if p3.client == globalClient || p3.client == p1.client {
+		t.Fatalf("want another client for the other settings")
+	}
+
+	// NOTE: The pre-warmed pool parks connections of its own.
+	p2.enablePreWarm()
+	if p2.client == p1.client || !p2.ownClient {
+		t.Fatalf("want pre-warmed pool having its own client")
+	}
+}
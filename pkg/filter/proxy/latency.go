@@ -0,0 +1,173 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+)
+
+const (
+	latencyDistributionNormal      = "normal"
+	latencyDistributionExponential = "exponential"
+	latencyDistributionPiecewise   = "piecewise"
+)
+
+type (
+	// LatencyInjectionSpec describes the latency injected before
+	// forwarding the requests, for chaos testing. The latency is a
+	// uniform random one in [minMs, maxMs] if distribution is empty.
+	LatencyInjectionSpec struct {
+		MinMs        float64                  `yaml:"minMs,omitempty" jsonschema:"omitempty,minimum=0"`
+		MaxMs        float64                  `yaml:"maxMs,omitempty" jsonschema:"omitempty,minimum=0"`
+		Distribution *LatencyDistributionSpec `yaml:"distribution,omitempty" jsonschema:"omitempty"`
+	}
+
+	// LatencyDistributionSpec describes the distribution the latency
+	// is sampled from. The lambda of exponential is the rate per
+	// millisecond, so the mean latency is 1/lambda ms. The points of
+	// piecewise are the piecewise linear CDF of the latency.
+	LatencyDistributionSpec struct {
+		Type     string          `yaml:"type" jsonschema:"required,enum=normal,enum=exponential,enum=piecewise"`
+		MeanMs   float64         `yaml:"meanMs,omitempty" jsonschema:"omitempty,minimum=0"`
+		StddevMs float64         `yaml:"stddevMs,omitempty" jsonschema:"omitempty,minimum=0"`
+		Lambda   float64         `yaml:"lambda,omitempty" jsonschema:"omitempty"`
+		Points   []*LatencyPoint `yaml:"points,omitempty" jsonschema:"omitempty"`
+	}
+
+	// LatencyPoint is a point of the piecewise linear CDF, percentile
+	// percent of the latencies are at most latencyMs.
+	LatencyPoint struct {
+		Percentile float64 `yaml:"percentile" jsonschema:"required,minimum=0,maximum=100"`
+		LatencyMs  float64 `yaml:"latencyMs" jsonschema:"required,minimum=0"`
+	}
+
+	// latencyRand is the source of the samples, both the global
+	// functions of math/rand and *rand.Rand satisfy it.
+	latencyRand interface {
+		Float64() float64
+		NormFloat64() float64
+		ExpFloat64() float64
+	}
+
+	globalLatencyRand struct{}
+)
+
+func (globalLatencyRand) Float64() float64     { return rand.Float64() }
+func (globalLatencyRand) NormFloat64() float64 { return rand.NormFloat64() }
+func (globalLatencyRand) ExpFloat64() float64  { return rand.ExpFloat64() }
+
+func (spec *LatencyInjectionSpec) validate() error {
+	if spec.Distribution == nil {
+		if spec.MaxMs < spec.MinMs {
+			return fmt.Errorf("maxMs of latencyInjection is less than minMs")
+		}
+		return nil
+	}
+
+	d := spec.Distribution
+	switch d.Type {
+	case latencyDistributionNormal:
+		if d.MeanMs <= 0 {
+			return fmt.Errorf("meanMs of normal distribution must be positive")
+		}
+	case latencyDistributionExponential:
+		if d.Lambda <= 0 {
+			return fmt.Errorf("lambda of exponential distribution must be positive")
+		}
+	case latencyDistributionPiecewise:
+		if len(d.Points) < 2 {
+			return fmt.Errorf("piecewise distribution needs at least 2 points")
+		}
+		for i := 1; i < len(d.Points); i++ {
+			prev, p := d.Points[i-1], d.Points[i]
+			if p.Percentile <= prev.Percentile {
+				return fmt.Errorf("percentiles of piecewise distribution must be increasing")
+			}
+			if p.LatencyMs < prev.LatencyMs {
+				return fmt.Errorf("latencyMs of piecewise distribution must be non-decreasing")
+			}
+		}
+	default:
+		return fmt.Errorf("unknown latency distribution: %s", d.Type)
+	}
+
+	return nil
+}
+
+// sample samples a latency, the negative ones of normal are taken as zero.
+func (spec *LatencyInjectionSpec) sample(r latencyRand) time.Duration {
+	var ms float64
+
+	d := spec.Distribution
+	switch {
+	case d == nil:
+		ms = spec.MinMs + r.Float64()*(spec.MaxMs-spec.MinMs)
+	case d.Type == latencyDistributionNormal:
+		ms = d.MeanMs + r.NormFloat64()*d.StddevMs
+	case d.Type == latencyDistributionExponential:
+		ms = r.ExpFloat64() / d.Lambda
+	case d.Type == latencyDistributionPiecewise:
+		ms = samplePiecewise(d.Points, r.Float64()*100)
+	}
+
+	return time.Duration(math.Max(ms, 0) * float64(time.Millisecond))
+}
+
+// samplePiecewise returns the latency of the percentile by linear
+// interpolation, the ones out of the points are clamped to the ends.
+func samplePiecewise(points []*LatencyPoint, percentile float64) float64 {
+	if percentile <= points[0].Percentile {
+		return points[0].LatencyMs
+	}
+
+	for i := 1; i < len(points); i++ {
+		prev, p := points[i-1], points[i]
+		if percentile <= p.Percentile {
+			ratio := (percentile - prev.Percentile) / (p.Percentile - prev.Percentile)
+			return prev.LatencyMs + ratio*(p.LatencyMs-prev.LatencyMs)
+		}
+	}
+
+	return points[len(points)-1].LatencyMs
+}
+
+// injectLatency delays the request by a sampled latency, it stops
+// waiting and returns false once the client disconnected.
+func injectLatency(ctx context.HTTPContext, spec *LatencyInjectionSpec) bool {
+	latency := spec.sample(globalLatencyRand{})
+	if latency <= 0 {
+		return true
+	}
+
+	ctx.AddTag(fmt.Sprintf("latency injected: %v", latency))
+
+	timer := time.NewTimer(latency)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
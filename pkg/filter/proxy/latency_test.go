@@ -0,0 +1,199 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	stdcontext "context"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/tracing"
+)
+
+func sampleLatencies(spec *LatencyInjectionSpec, n int) []float64 {
+	r := rand.New(rand.NewSource(1))
+	samples := make([]float64, n)
+	for i := range samples {
+		samples[i] = float64(spec.sample(r)) / float64(time.Millisecond)
+	}
+	sort.Float64s(samples)
+	return samples
+}
+
+func mean(samples []float64) float64 {
+	sum := 0.0
+	for _, s := range samples {
+		sum += s
+	}
+	return sum / float64(len(samples))
+}
+
+func TestLatencySample(t *testing.T) {
+	const n = 20000
+
+	samples := sampleLatencies(&LatencyInjectionSpec{MinMs: 10, MaxMs: 20}, n)
+	if samples[0] < 10 || samples[n-1] > 20 {
+		t.Errorf("uniform: want in [10, 20], got [%v, %v]", samples[0], samples[n-1])
+	}
+
+	samples = sampleLatencies(&LatencyInjectionSpec{
+		Distribution: &LatencyDistributionSpec{Type: "normal", MeanMs: 100, StddevMs: 10},
+	}, n)
+	if m := mean(samples); math.Abs(m-100) > 1 {
+		t.Errorf("normal: want mean 100, got %v", m)
+	}
+
+	// NOTE: The negative ones are taken as zero.
+	samples = sampleLatencies(&LatencyInjectionSpec{
+		Distribution: &LatencyDistributionSpec{Type: "normal", MeanMs: 1, StddevMs: 10},
+	}, n)
+	if samples[0] != 0 {
+		t.Errorf("normal: want no negative latency, got %v", samples[0])
+	}
+
+	samples = sampleLatencies(&LatencyInjectionSpec{
+		Distribution: &LatencyDistributionSpec{Type: "exponential", Lambda: 0.02},
+	}, n)
+	if m := mean(samples); math.Abs(m-50) > 2 {
+		t.Errorf("exponential: want mean 50, got %v", m)
+	}
+
+	samples = sampleLatencies(&LatencyInjectionSpec{
+		Distribution: &LatencyDistributionSpec{
+			Type: "piecewise",
+			Points: []*LatencyPoint{
+				{Percentile: 0, LatencyMs: 0},
+				{Percentile: 50, LatencyMs: 10},
+				{Percentile: 99, LatencyMs: 100},
+				{Percentile: 100, LatencyMs: 1000},
+			},
+		},
+	}, n)
+	if p50 := samples[n/2]; math.Abs(p50-10) > 1 {
+		t.Errorf("piecewise: want p50 10, got %v", p50)
+	}
+	// NOTE: p90 is 10+(90-50)*(100-10)/(99-50).
+	if p90 := samples[n*90/100]; math.Abs(p90-83.47) > 2 {
+		t.Errorf("piecewise: want p90 83.47, got %v", p90)
+	}
+}
+
+func TestSamplePiecewise(t *testing.T) {
+	points := []*LatencyPoint{
+		{Percentile: 10, LatencyMs: 5},
+		{Percentile: 60, LatencyMs: 10},
+		{Percentile: 90, LatencyMs: 40},
+	}
+	cases := map[float64]float64{
+		0:   5,
+		10:  5,
+		35:  7.5,
+		60:  10,
+		80:  30,
+		100: 40,
+	}
+	for percentile, want := range cases {
+		if got := samplePiecewise(points, percentile); math.Abs(got-want) > 1e-9 {
+			t.Errorf("percentile %v: want %v, got %v", percentile, want, got)
+		}
+	}
+}
+
+func TestLatencyInjectionValidate(t *testing.T) {
+	valid := []*LatencyInjectionSpec{
+		{MinMs: 10, MaxMs: 10},
+		{Distribution: &LatencyDistributionSpec{Type: "normal", MeanMs: 10}},
+		{Distribution: &LatencyDistributionSpec{Type: "exponential", Lambda: 1}},
+		{Distribution: &LatencyDistributionSpec{Type: "piecewise", Points: []*LatencyPoint{
+			{Percentile: 0, LatencyMs: 1}, {Percentile: 100, LatencyMs: 1},
+		}}},
+	}
+	for i, spec := range valid {
+		if err := spec.validate(); err != nil {
+			t.Errorf("spec %d: want valid, got %v", i, err)
+		}
+	}
+
+	invalid := []*LatencyInjectionSpec{
+		{MinMs: 20, MaxMs: 10},
+		{Distribution: &LatencyDistributionSpec{Type: "normal"}},
+		{Distribution: &LatencyDistributionSpec{Type: "exponential"}},
+		{Distribution: &LatencyDistributionSpec{Type: "piecewise", Points: []*LatencyPoint{
+			{Percentile: 0, LatencyMs: 1},
+		}}},
+		{Distribution: &LatencyDistributionSpec{Type: "piecewise", Points: []*LatencyPoint{
+			{Percentile: 50, LatencyMs: 1}, {Percentile: 50, LatencyMs: 2},
+		}}},
+		{Distribution: &LatencyDistributionSpec{Type: "piecewise", Points: []*LatencyPoint{
+			{Percentile: 0, LatencyMs: 2}, {Percentile: 100, LatencyMs: 1},
+		}}},
+		{Distribution: &LatencyDistributionSpec{Type: "pareto"}},
+	}
+	for i, spec := range invalid {
+		if err := spec.validate(); err == nil {
+			t.Errorf("spec %d: want invalid", i)
+		}
+	}
+}
+
+func TestLatencyInjectionClientClosed(t *testing.T) {
+	stdctx, cancel := stdcontext.WithCancel(stdcontext.Background())
+	req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(stdctx)
+	ctx := context.New(httptest.NewRecorder(), req, tracing.NoopTracing, "no trace")
+	defer ctx.Finish()
+
+	p := &Proxy{spec: &Spec{
+		LatencyInjection: &LatencyInjectionSpec{MinMs: 10000, MaxMs: 10000},
+	}}
+
+	time.AfterFunc(10*time.Millisecond, cancel)
+	start := time.Now()
+	if result := p.handle(ctx); result != resultClientError {
+		t.Errorf("want %s, got %s", resultClientError, result)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("want waiting stopped by client, waited %v", d)
+	}
+}
+
+func TestLatencyInjectionDeadline(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set(grpcTimeoutHeader, "20m")
+	ctx := context.New(httptest.NewRecorder(), req, tracing.NoopTracing, "no trace")
+	defer ctx.Finish()
+
+	p := &Proxy{spec: &Spec{
+		PropagateDeadline: true,
+		LatencyInjection:  &LatencyInjectionSpec{MinMs: 50, MaxMs: 50},
+	}}
+
+	// NOTE: The deadline is exceeded during the injected latency.
+	if result := p.handle(ctx); result != resultDeadlineExceeded {
+		t.Errorf("want %s, got %s", resultDeadlineExceeded, result)
+	}
+	if status := ctx.Response().Header().Get(grpcStatusHeader); status != grpcStatusDeadlineExceeded {
+		t.Errorf("want grpc status %s, got %s", grpcStatusDeadlineExceeded, status)
+	}
+}
@@ -18,16 +18,23 @@
 package proxy
 
 import (
+	stdcontext "context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/megaease/easegress/pkg/context"
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/tracing"
 	"github.com/megaease/easegress/pkg/util/callbackreader"
+	"github.com/megaease/easegress/pkg/util/connlimiter"
 	"github.com/megaease/easegress/pkg/util/httpfilter"
 	"github.com/megaease/easegress/pkg/util/httpheader"
 	"github.com/megaease/easegress/pkg/util/httpstat"
@@ -48,6 +55,43 @@ type (
 		servers     *servers
 		httpStat    *httpstat.HTTPStat
 		memoryCache *memorycache.MemoryCache
+
+		// failover is the secondary servers in order, and failureCodes
+		// make the response of the non-last attempt fail over.
+		failover     []*failoverServer
+		failureCodes []int
+
+		// connLimiters are keyed by server URL,
+		// only used when MaxConnsPerHost > 0. They are pruned once
+		// the servers version differs from connLimitersVersion.
+		connLimiters        sync.Map
+		connLimitersVersion uint64
+
+		// cancellationPropagation cancels the upstream requests
+		// once the client disconnected, and clientCancelled counts them.
+		cancellationPropagation bool
+		clientCancelled         uint64
+
+		// h3Servers are the servers advertising HTTP/3,
+		// only used in h3Auto mode. h3Requests counts the
+		// requests sent over HTTP/3.
+		h3Mode     h3Mode
+		h3Servers  h3Servers
+		h3Requests uint64
+
+		// client is shared by the pools with the same keepalive and
+		// TLS resumption settings, see getPoolClient. ownClient is
+		// true if the pool clones a client of its own for pre-warming.
+		client    *http.Client
+		ownClient bool
+		keepalive *keepaliveDialer
+		tlsStat   tlsStat
+
+		// park holds the pre-warmed connections, it's nil if
+		// the connections are not pre-warmed.
+		park *connPark
+
+		certChecker *certChecker
 	}
 
 	// PoolSpec decribes a pool of servers.
@@ -60,18 +104,87 @@ type (
 		ServiceName     string            `yaml:"serviceName" jsonschema:"omitempty"`
 		LoadBalance     *LoadBalance      `yaml:"loadBalance" jsonschema:"required"`
 		MemoryCache     *memorycache.Spec `yaml:"memoryCache,omitempty" jsonschema:"omitempty"`
+		MaxConnsPerHost int               `yaml:"maxConnsPerHost" jsonschema:"omitempty,minimum=0"`
+		MaxQueueDepth   int               `yaml:"maxQueueDepth" jsonschema:"omitempty,minimum=0"`
+		HealthCheck     *HealthCheckSpec  `yaml:"healthCheck,omitempty" jsonschema:"omitempty"`
+		// SRVRecord is the DNS SRV record publishing the servers,
+		// such as _http._tcp.myservice.local, the static servers
+		// are the fallback if it failed to lookup at the beginning.
+		SRVRecord          string `yaml:"srvRecord" jsonschema:"omitempty"`
+		DNSServer          string `yaml:"dnsServer" jsonschema:"omitempty"`
+		DNSRefreshInterval string `yaml:"dnsRefreshInterval" jsonschema:"omitempty,format=duration"`
+		// FailoverOrder is the URLs of the secondary servers, which are
+		// excluded from the load balance, and tried in order when the
+		// primary one fails, such as the ones in another region.
+		FailoverOrder []string `yaml:"failoverOrder" jsonschema:"omitempty,uniqueItems=true"`
+		// UpstreamH3 sends the requests over HTTP/3 if it's true, or only to
+		// the servers advertising HTTP/3 by Alt-Svc if it's auto.
+		UpstreamH3 interface{} `yaml:"upstreamH3,omitempty" jsonschema:"-"`
+		// TLSSessionResumption resumes the TLS sessions to the https
+		// servers on new connections, with a session cache of
+		// SessionCacheCapacity entries.
+		TLSSessionResumption bool `yaml:"tlsSessionResumption" jsonschema:"omitempty"`
+		SessionCacheCapacity int  `yaml:"sessionCacheCapacity" jsonschema:"omitempty,minimum=0"`
+		// TCPKeepalive probes the idle connections to the servers, which is
+		// true if omitted. The first probe is sent after TCPKeepaliveIdle,
+		// and the following ones are sent every TCPKeepaliveInterval.
+		TCPKeepalive         *bool  `yaml:"tcpKeepalive,omitempty" jsonschema:"omitempty"`
+		TCPKeepaliveIdle     string `yaml:"tcpKeepaliveIdle" jsonschema:"omitempty,format=duration"`
+		TCPKeepaliveInterval string `yaml:"tcpKeepaliveInterval" jsonschema:"omitempty,format=duration"`
+		// CertCheckInterval is the interval to check the expiry of the
+		// certificates of the https servers, which are warned once they
+		// expire within WarnThresholdDays.
+		CertCheckInterval string `yaml:"certCheckInterval" jsonschema:"omitempty,format=duration"`
+		WarnThresholdDays int    `yaml:"warnThresholdDays" jsonschema:"omitempty,minimum=0"`
 	}
 
 	// PoolStatus is the status of Pool.
 	PoolStatus struct {
-		Stat *httpstat.Status `yaml:"stat"`
+		Stat         *httpstat.Status               `yaml:"stat"`
+		ConnLimiters map[string]*connlimiter.Status `yaml:"connLimiters,omitempty"`
+		Health       map[string]*ServerHealthStatus `yaml:"health,omitempty"`
+
+		// ClientCancelled is the count of the upstream requests
+		// cancelled by client disconnecting, which are not in Stat.
+		ClientCancelled uint64 `yaml:"clientCancelled"`
+		// H3Requests is the count of the requests sent over HTTP/3.
+		H3Requests uint64 `yaml:"h3Requests"`
+		// TLSHandshakes is only present if tlsSessionResumption is true.
+		TLSHandshakes *TLSHandshakeStatus `yaml:"tlsHandshakes,omitempty"`
+		// KeepaliveReconnects is the count of the connections dialed
+		// again after the previous ones broken by the keepalive probes,
+		// it's shared by the pools with the same keepalive settings.
+		KeepaliveReconnects uint64 `yaml:"keepaliveReconnects"`
+		// CertExpiry is keyed by the address of the https servers,
+		// the ones with expired certificates are degraded in Health too.
+		CertExpiry map[string]*CertExpiryStatus `yaml:"certExpiry,omitempty"`
 	}
 )
 
 // Validate validates poolSpec.
 func (s PoolSpec) Validate() error {
-	if s.ServiceName == "" && len(s.Servers) == 0 {
-		return fmt.Errorf("both serviceName and servers are empty")
+	if s.ServiceName == "" && s.SRVRecord == "" && len(s.Servers) == 0 {
+		return fmt.Errorf("serviceName, srvRecord and servers are all empty")
+	}
+
+	if s.SRVRecord != "" {
+		if s.ServiceName != "" {
+			return fmt.Errorf("both serviceName and srvRecord are specified")
+		}
+
+		// NOTE: The servers in SRV record are weighted.
+		switch s.LoadBalance.Policy {
+		case PolicyRoundRobin, PolicyRandom:
+			return fmt.Errorf("srvRecord needs loadBalance policy %s to use the srv weights, or a hash one",
+				PolicyWeightedRandom)
+		}
+
+		if s.DNSRefreshInterval != "" {
+			interval, err := time.ParseDuration(s.DNSRefreshInterval)
+			if err != nil || interval <= 0 {
+				return fmt.Errorf("invalid dnsRefreshInterval %s", s.DNSRefreshInterval)
+			}
+		}
 	}
 
 	serversGotWeight := 0
@@ -85,8 +198,38 @@ func (s PoolSpec) Validate() error {
 			serversGotWeight, len(s.Servers))
 	}
 
-	if s.ServiceName == "" {
-		servers := newStaticServers(s.Servers, s.ServersTags, *s.LoadBalance)
+	if s.MaxQueueDepth > 0 && s.MaxConnsPerHost == 0 {
+		return fmt.Errorf("maxQueueDepth needs maxConnsPerHost")
+	}
+
+	if len(s.FailoverOrder) > 0 {
+		err := s.validateFailoverOrder()
+		if err != nil {
+			return err
+		}
+	}
+
+	err := s.validateUpstreamH3()
+	if err != nil {
+		return err
+	}
+
+	if s.SessionCacheCapacity > 0 && !s.TLSSessionResumption {
+		return fmt.Errorf("sessionCacheCapacity needs tlsSessionResumption")
+	}
+
+	err = s.validateTCPKeepalive()
+	if err != nil {
+		return err
+	}
+
+	err = s.validateCertCheck()
+	if err != nil {
+		return err
+	}
+
+	if s.ServiceName == "" && s.SRVRecord == "" {
+		servers := newStaticServers(primaryServers(&s), s.ServersTags, *s.LoadBalance)
 		if servers.len() == 0 {
 			return fmt.Errorf("serversTags picks none of servers")
 		}
@@ -96,7 +239,7 @@ func (s PoolSpec) Validate() error {
 }
 
 func newPool(spec *PoolSpec, tagPrefix string,
-	writeResponse bool, failureCodes []int) *pool {
+	writeResponse bool, failureCodes []int, allowedCommands []string) *pool {
 
 	var filter *httpfilter.HTTPFilter
 	if spec.Filter != nil {
@@ -108,6 +251,21 @@ func newPool(spec *PoolSpec, tagPrefix string,
 		memoryCache = memorycache.New(spec.MemoryCache)
 	}
 
+	// NOTE: The secondary servers only serve the failover.
+	serversSpec := spec
+	if len(spec.FailoverOrder) > 0 {
+		primarySpec := *spec
+		primarySpec.Servers = primaryServers(spec)
+		serversSpec = &primarySpec
+	}
+
+	// NOTE: The spec has been validated.
+	mode, _ := spec.h3Mode()
+
+	client := getPoolClient(spec)
+
+	servers := newServers(serversSpec, allowedCommands)
+
 	return &pool{
 		spec: spec,
 
@@ -115,63 +273,220 @@ func newPool(spec *PoolSpec, tagPrefix string,
 		writeResponse: writeResponse,
 
 		filter:      filter,
-		servers:     newServers(spec),
+		servers:     servers,
 		httpStat:    httpstat.New(),
 		memoryCache: memoryCache,
+
+		failover:     newFailoverServers(spec),
+		failureCodes: failureCodes,
+
+		cancellationPropagation: true,
+
+		h3Mode: mode,
+
+		client:    client.client,
+		keepalive: client.keepalive,
+
+		certChecker: newCertChecker(spec, func() *staticServers {
+			static, _ := servers.snapshot()
+			return static
+		}),
 	}
 }
 
 func (p *pool) status() *PoolStatus {
-	s := &PoolStatus{Stat: p.httpStat.Status()}
+	s := &PoolStatus{
+		Stat:            p.httpStat.Status(),
+		ClientCancelled: atomic.LoadUint64(&p.clientCancelled),
+		H3Requests:      atomic.LoadUint64(&p.h3Requests),
+
+		KeepaliveReconnects: p.keepalive.reconnectCount(),
+	}
+
+	if p.spec.TLSSessionResumption {
+		s.TLSHandshakes = p.tlsStat.status()
+	}
+
+	p.pruneConnLimiters()
+	p.connLimiters.Range(func(key, value interface{}) bool {
+		if s.ConnLimiters == nil {
+			s.ConnLimiters = make(map[string]*connlimiter.Status)
+		}
+		s.ConnLimiters[key.(string)] = value.(*connlimiter.ConnLimiter).Status()
+		return true
+	})
+
+	if p.servers.healthCheck != nil {
+		s.Health = p.servers.healthCheck.status()
+	}
+
+	s.CertExpiry = p.certChecker.status()
+	static, _ := p.servers.snapshot()
+	s.Health = p.certChecker.degrade(static, s.Health)
+
 	return s
 }
 
-func (p *pool) handle(ctx context.HTTPContext, reqBody io.Reader) string {
-	addTag := func(subPerfix, msg string) {
-		tag := stringtool.Cat(p.tagPrefix, "#", subPerfix, ": ", msg)
-		ctx.Lock()
-		ctx.AddTag(tag)
-		ctx.Unlock()
+func (p *pool) connLimiter(server *Server) *connlimiter.ConnLimiter {
+	p.pruneConnLimiters()
+
+	if cl, ok := p.connLimiters.Load(server.URL); ok {
+		return cl.(*connlimiter.ConnLimiter)
 	}
 
-	w := ctx.Response()
+	cl, _ := p.connLimiters.LoadOrStore(server.URL,
+		connlimiter.New(p.spec.MaxConnsPerHost, p.spec.MaxQueueDepth))
+	return cl.(*connlimiter.ConnLimiter)
+}
 
+// pruneConnLimiters deletes the limiters of the servers removed by
+// the service registry or the SRV record, the holders of their
+// connections still release to them.
+func (p *pool) pruneConnLimiters() {
+	version := atomic.LoadUint64(&p.servers.version)
+	prevVersion := atomic.LoadUint64(&p.connLimitersVersion)
+	if version == prevVersion ||
+		!atomic.CompareAndSwapUint64(&p.connLimitersVersion, prevVersion, version) {
+		return
+	}
+
+	remaining := make(map[string]struct{})
+	if static, _ := p.servers.snapshot(); static != nil {
+		for _, server := range static.servers {
+			remaining[server.URL] = struct{}{}
+		}
+	}
+	for _, fs := range p.failover {
+		remaining[fs.server.URL] = struct{}{}
+	}
+
+	p.connLimiters.Range(func(key, value interface{}) bool {
+		if _, exists := remaining[key.(string)]; !exists {
+			p.connLimiters.Delete(key)
+		}
+		return true
+	})
+}
+
+func (p *pool) addTag(ctx context.HTTPContext, subPerfix, msg string) {
+	tag := stringtool.Cat(p.tagPrefix, "#", subPerfix, ": ", msg)
+	ctx.Lock()
+	ctx.AddTag(tag)
+	ctx.Unlock()
+}
+
+func (p *pool) handle(ctx context.HTTPContext, reqBody io.Reader) string {
 	server, err := p.servers.next(ctx)
 	if err != nil {
-		addTag("serverErr", err.Error())
-		w.SetStatusCode(http.StatusServiceUnavailable)
+		p.addTag(ctx, "serverErr", err.Error())
+		ctx.Response().SetStatusCode(http.StatusServiceUnavailable)
 		return resultInternalError
 	}
+
+	if len(p.failover) > 0 {
+		return p.handleWithFailover(ctx, server, reqBody)
+	}
+
+	result, _ := p.handleServer(ctx, server, reqBody, true /*lastAttempt*/)
+	return result
+}
+
+// isTimeoutError returns whether the request to the server failed for
+// timing out, which is reported as a gateway timeout to the client.
+func isTimeoutError(err error) bool {
+	if errors.Is(err, stdcontext.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// handleServer sends the request to the server, it returns the reason
+// without writing the response if the attempt failed and isn't the last one.
+func (p *pool) handleServer(ctx context.HTTPContext, server *Server,
+	reqBody io.Reader, lastAttempt bool) (result string, failoverReason string) {
+
+	addTag := func(subPerfix, msg string) {
+		p.addTag(ctx, subPerfix, msg)
+	}
+
+	w := ctx.Response()
+
 	addTag("addr", server.URL)
 
+	// NOTE: The connection is held until the response has been
+	// written to the client, or has been drained for mirror pool.
+	releaseConn := func() {}
+	if p.spec.MaxConnsPerHost > 0 {
+		cl := p.connLimiter(server)
+		err := cl.Acquire(ctx)
+		if err != nil {
+			addTag("connLimitErr", err.Error())
+			if !lastAttempt {
+				return "", fmt.Sprintf("acquire connection failed: %v", err)
+			}
+			w.SetStatusCode(http.StatusServiceUnavailable)
+			return resultServerError, ""
+		}
+		releaseOnce := &sync.Once{}
+		releaseConn = func() { releaseOnce.Do(cl.Release) }
+	}
+
 	req, err := p.prepareRequest(ctx, server, reqBody)
 	if err != nil {
+		releaseConn()
 		msg := stringtool.Cat("prepare request failed: ", err.Error())
 		logger.Errorf("BUG: %s", msg)
 		addTag("bug", msg)
 		w.SetStatusCode(http.StatusInternalServerError)
-		return resultInternalError
+		return resultInternalError, ""
+	}
+
+	// NOTE: The request is in flight until the connection is released,
+	// it's aborted if the server is removed and warmed down already.
+	inflightDone := server.inflight.add(req.cancel)
+	release := releaseConn
+	releaseConn = func() {
+		release()
+		inflightDone()
 	}
 
 	resp, span, err := p.doRequest(ctx, req)
 	if err != nil {
+		releaseConn()
+
 		// NOTE: May add option to cancel the tracing if failed here.
 		// ctx.Span().Cancel()
 
 		addTag("doRequestErr", fmt.Sprintf("%v", err))
 		addTag("trace", req.detail())
 		if ctx.ClientDisconnected() {
+			atomic.AddUint64(&p.clientCancelled, 1)
 			// NOTE: The HTTPContext will set 499 by itself if client is Disconnected.
 			// w.SetStatusCode((499)
-			return resultClientError
+			return resultClientError, ""
+		}
+
+		if !lastAttempt {
+			return "", fmt.Sprintf("do request failed: %v", err)
 		}
 
-		w.SetStatusCode(http.StatusServiceUnavailable)
-		return resultServerError
+		if isTimeoutError(err) {
+			w.SetStatusCode(http.StatusGatewayTimeout)
+		} else {
+			w.SetStatusCode(http.StatusServiceUnavailable)
+		}
+		return resultServerError, ""
 	}
 
 	addTag("code", strconv.Itoa(resp.StatusCode))
 
+	if !lastAttempt && p.isFailureCode(resp.StatusCode) {
+		p.discardResponse(ctx, req, resp, span)
+		releaseConn()
+		return "", fmt.Sprintf("failure status code %d", resp.StatusCode)
+	}
+
 	ctx.Lock()
 	defer ctx.Unlock()
 	respBody := p.statRequestResponse(ctx, req, resp, span)
@@ -180,8 +495,9 @@ func (p *pool) handle(ctx context.HTTPContext, reqBody io.Reader) string {
 		w.SetStatusCode(resp.StatusCode)
 		w.Header().AddFromStd(resp.Header)
 		w.SetBody(respBody)
+		ctx.OnFinish(releaseConn)
 
-		return ""
+		return "", ""
 	}
 
 	go func() {
@@ -189,11 +505,12 @@ func (p *pool) handle(ctx context.HTTPContext, reqBody io.Reader) string {
 		// Reference: https://golang.org/pkg/net/http/#Response
 		// And we do NOT do statistics of duration and respSize
 		// for it, because we can't wait for it to finish.
+		defer releaseConn()
 		defer resp.Body.Close()
 		io.Copy(ioutil.Discard, resp.Body)
 	}()
 
-	return ""
+	return "", ""
 }
 
 func (p *pool) prepareRequest(ctx context.HTTPContext, server *Server, reqBody io.Reader) (req *request, err error) {
@@ -211,10 +528,27 @@ func (p *pool) doRequest(ctx context.HTTPContext, req *request) (*http.Response,
 	span := ctx.Span().NewChildWithStart(spanName, req.startTime())
 	span.Tracer().Inject(span.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(req.std.Header))
 
-	resp, err := globalClient.Do(req.std)
+	client, stdr, useH3 := p.client, req.std, p.useH3(req.server)
+	if useH3 {
+		client = globalH3Client
+		atomic.AddUint64(&p.h3Requests, 1)
+	} else if p.spec.TLSSessionResumption {
+		stdr = p.tlsStat.withTrace(stdr)
+	}
+
+	resp, err := client.Do(stdr)
 	if err != nil {
+		// NOTE: Fall back to TCP until HTTP/3 is advertised again.
+		if useH3 && p.h3Mode == h3Auto {
+			p.h3Servers.forget(req.server.URL)
+		}
 		return nil, nil, err
 	}
+
+	if p.h3Mode == h3Auto {
+		p.h3Servers.update(req.server.URL, resp.Header.Get("Alt-Svc"))
+	}
+
 	return resp, span, nil
 }
 
@@ -276,4 +610,14 @@ func responseMetaSize(resp *http.Response) int {
 
 func (p *pool) close() {
 	p.servers.close()
+	p.certChecker.close()
+
+	// NOTE: The idle connections of the shared clients are
+	// left to the other pools and the next generation.
+	if p.ownClient {
+		p.client.CloseIdleConnections()
+	}
+	if p.park != nil {
+		p.park.close()
+	}
 }
@@ -0,0 +1,72 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package proxy
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestConnLimitersPruned(t *testing.T) {
+	a := newFailoverTestServer(t, http.StatusOK)
+	defer a.Close()
+	b := newFailoverTestServer(t, http.StatusOK)
+	defer b.Close()
+
+	spec := &PoolSpec{
+		Servers:         []*Server{{URL: a.URL}, {URL: b.URL}},
+		LoadBalance:     &LoadBalance{Policy: PolicyRoundRobin},
+		MaxConnsPerHost: 1,
+	}
+	if err := spec.Validate(); err != nil {
+		t.Fatalf("validate failed: %v", err)
+	}
+	p := newPool(spec, "proxy#main", true, nil, nil)
+	defer p.close()
+
+	handle := func() {
+		ctx := newFailoverTestContext()
+		p.handle(ctx, ctx.Request().Body())
+		if code := ctx.Response().StatusCode(); code != http.StatusOK {
+			t.Fatalf("want %d, got %d", http.StatusOK, code)
+		}
+		ctx.Finish()
+	}
+
+	handle()
+	handle()
+	if n := len(p.status().ConnLimiters); n != 2 {
+		t.Fatalf("want 2 conn limiters, got %d", n)
+	}
+
+	// NOTE: It's what the service registry does once a server left.
+	spec.Servers = spec.Servers[:1]
+	p.servers.useStaticServers()
+
+	status := p.status()
+	if n := len(status.ConnLimiters); n != 1 {
+		t.Fatalf("want 1 conn limiter, got %d", n)
+	}
+	if _, exists := status.ConnLimiters[a.URL]; !exists {
+		t.Errorf("want conn limiter of %s kept", a.URL)
+	}
+
+	handle()
+	if conns := p.status().ConnLimiters[a.URL].Conns; conns != 0 {
+		t.Errorf("want all connections released, got %d", conns)
+	}
+}
@@ -0,0 +1,263 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const (
+	// preWarmTimeout bounds pre-warming the connections, which
+	// blocks the pipeline from being ready.
+	preWarmTimeout = 10 * time.Second
+)
+
+type (
+	// connPark holds the pre-warmed connections keyed by the scheme and
+	// address, the transport takes them before dialing the new ones.
+	connPark struct {
+		mutex       sync.Mutex
+		conns       map[string][]*parkedConn
+		idleTimeout time.Duration
+	}
+
+	parkedConn struct {
+		net.Conn
+		parkedAt time.Time
+	}
+
+	// PreWarmStatus is the status of pre-warming the connections.
+	PreWarmStatus struct {
+		Connections uint64 `yaml:"connections"`
+		Failures    uint64 `yaml:"failures"`
+		// Duration is the time from the pipeline activated to all
+		// connections established or failed.
+		Duration string `yaml:"duration"`
+	}
+)
+
+func newConnPark(idleTimeout time.Duration) *connPark {
+	return &connPark{
+		conns:       make(map[string][]*parkedConn),
+		idleTimeout: idleTimeout,
+	}
+}
+
+func parkKey(scheme, addr string) string {
+	return scheme + "://" + addr
+}
+
+func (p *connPark) put(key string, conn net.Conn) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.conns[key] = append(p.conns[key], &parkedConn{Conn: conn, parkedAt: time.Now()})
+}
+
+// take returns a parked connection of key, the ones idle
+// longer than idleTimeout are closed instead.
+func (p *connPark) take(key string) net.Conn {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	conns := p.conns[key]
+	for len(conns) > 0 {
+		conn := conns[len(conns)-1]
+		conns = conns[:len(conns)-1]
+		if time.Since(conn.parkedAt) < p.idleTimeout {
+			p.conns[key] = conns
+			return conn.Conn
+		}
+		conn.Close()
+	}
+
+	delete(p.conns, key)
+	return nil
+}
+
+func (p *connPark) close() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for key, conns := range p.conns {
+		for _, conn := range conns {
+			conn.Close()
+		}
+		delete(p.conns, key)
+	}
+}
+
+// enablePreWarm makes the client of the pool take the pre-warmed
+// connections, it must be called before the pool handles requests.
+func (p *pool) enablePreWarm() {
+	// NOTE: The parked connections are the pool's own ones,
+	// so it takes a client of its own instead of the shared one.
+	p.client, p.ownClient = cloneClient(p.client), true
+
+	transport := p.client.Transport.(*http.Transport)
+	p.park = newConnPark(transport.IdleConnTimeout)
+
+	dial := transport.DialContext
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if conn := p.park.take(parkKey("http", addr)); conn != nil {
+			return conn, nil
+		}
+		return dial(ctx, network, addr)
+	}
+
+	// NOTE: The transport reports the TLS handshake to the trace once it
+	// gets the connection, so the pre-warmed ones are counted in tlsStat
+	// when they are used.
+	transport.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if conn := p.park.take(parkKey("https", addr)); conn != nil {
+			return conn, nil
+		}
+		return p.dialTLS(ctx, dial, network, addr)
+	}
+}
+
+func (p *pool) dialTLS(ctx context.Context,
+	dial func(ctx context.Context, network, addr string) (net.Conn, error),
+	network, addr string) (net.Conn, error) {
+
+	conn, err := dial(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	config := p.client.Transport.(*http.Transport).TLSClientConfig.Clone()
+	config.ServerName, _, _ = net.SplitHostPort(addr)
+	tlsConn := tls.Client(conn, config)
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	err = tlsConn.Handshake()
+	conn.SetDeadline(time.Time{})
+
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return tlsConn, nil
+}
+
+// preWarm parks n connections to each server of the pool.
+func (p *pool) preWarm(ctx context.Context, n int, status *PreWarmStatus) {
+	static, _ := p.servers.snapshot()
+	if static == nil {
+		return
+	}
+
+	transport := p.client.Transport.(*http.Transport)
+	wg := &sync.WaitGroup{}
+	for _, server := range static.servers {
+		scheme, addr, err := serverAddr(server.URL)
+		if err != nil {
+			logger.Errorf("pre-warm connections to %s failed: %v", server.URL, err)
+			atomic.AddUint64(&status.Failures, uint64(n))
+			continue
+		}
+
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				var conn net.Conn
+				var err error
+				if scheme == "https" {
+					conn, err = p.dialTLS(ctx, transport.DialContext, "tcp", addr)
+				} else {
+					conn, err = transport.DialContext(ctx, "tcp", addr)
+				}
+				if err != nil {
+					logger.Errorf("pre-warm connection to %s failed: %v", addr, err)
+					atomic.AddUint64(&status.Failures, 1)
+					return
+				}
+
+				p.park.put(parkKey(scheme, addr), conn)
+				atomic.AddUint64(&status.Connections, 1)
+			}()
+		}
+	}
+
+	wg.Wait()
+}
+
+// serverAddr returns the scheme and the address the transport dials for rawURL.
+func serverAddr(rawURL string) (string, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", err
+	}
+
+	port := u.Port()
+	switch u.Scheme {
+	case "http":
+		if port == "" {
+			port = "80"
+		}
+	case "https":
+		if port == "" {
+			port = "443"
+		}
+	default:
+		return "", "", fmt.Errorf("unsupported scheme %s", u.Scheme)
+	}
+
+	return u.Scheme, net.JoinHostPort(u.Hostname(), port), nil
+}
+
+// preWarm pre-warms the connections of all pools, and blocks until all
+// of them are established or failed, so the pipeline is not ready until then.
+func (b *Proxy) preWarm(activatedAt time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), preWarmTimeout)
+	defer cancel()
+
+	status := &PreWarmStatus{}
+	wg := &sync.WaitGroup{}
+	for _, p := range b.pools() {
+		p.enablePreWarm()
+
+		wg.Add(1)
+		go func(p *pool) {
+			defer wg.Done()
+			p.preWarm(ctx, b.spec.PreWarmConnections, status)
+		}(p)
+	}
+	wg.Wait()
+
+	status.Duration = time.Since(activatedAt).String()
+	b.preWarmStatus = status
+
+	logger.Infof("%s pre-warmed %d connections (%d failed) in %s",
+		b.pipeSpec.Name(), status.Connections, status.Failures, status.Duration)
+}
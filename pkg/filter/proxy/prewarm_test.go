@@ -0,0 +1,140 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newPreWarmTestServer(handler http.Handler, tls bool) (*httptest.Server, *int32) {
+	var conns int32
+	server := httptest.NewUnstartedServer(handler)
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	if tls {
+		server.StartTLS()
+	} else {
+		server.Start()
+	}
+	return server, &conns
+}
+
+// acceptedConns waits for the server accepting want connections,
+// as it's notified asynchronously.
+func acceptedConns(conns *int32, want int32) int32 {
+	for i := 0; i < 100 && atomic.LoadInt32(conns) < want; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return atomic.LoadInt32(conns)
+}
+
+func TestPreWarm(t *testing.T) {
+	for _, tls := range []bool{false, true} {
+		server, conns := newPreWarmTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), tls)
+		defer server.Close()
+
+		spec := &PoolSpec{
+			Servers:              []*Server{{URL: server.URL}},
+			LoadBalance:          &LoadBalance{Policy: PolicyRoundRobin},
+			TLSSessionResumption: tls,
+		}
+		p := newPool(spec, "proxy#main", true, nil, nil)
+		defer p.close()
+		p.enablePreWarm()
+
+		status := &PreWarmStatus{}
+		p.preWarm(context.Background(), 2, status)
+		if status.Connections != 2 || status.Failures != 0 {
+			t.Fatalf("tls %v: want 2 connections, got %+v", tls, status)
+		}
+		if n := acceptedConns(conns, 2); n != 2 {
+			t.Fatalf("tls %v: want 2 connections accepted, got %d", tls, n)
+		}
+
+		for i := 0; i < 3; i++ {
+			ctx := newFailoverTestContext()
+			p.handle(ctx, ctx.Request().Body())
+			if code := ctx.Response().StatusCode(); code != http.StatusOK {
+				t.Fatalf("tls %v: want %d, got %d", tls, http.StatusOK, code)
+			}
+			ctx.Finish()
+		}
+
+		// NOTE: The requests are sent over the pre-warmed connections.
+		if n := acceptedConns(conns, 3); n != 2 {
+			t.Errorf("tls %v: want no more connections, got %d", tls, n)
+		}
+		// NOTE: The handshake is counted once the connection is used.
+		if tls {
+			if full := p.status().TLSHandshakes.Full; full != 1 {
+				t.Errorf("want 1 full handshake, got %d", full)
+			}
+		}
+	}
+}
+
+func TestPreWarmFailures(t *testing.T) {
+	spec := &PoolSpec{
+		Servers:     []*Server{{URL: unreachableURL()}},
+		LoadBalance: &LoadBalance{Policy: PolicyRoundRobin},
+	}
+	p := newPool(spec, "proxy#main", true, nil, nil)
+	defer p.close()
+	p.enablePreWarm()
+
+	status := &PreWarmStatus{}
+	p.preWarm(context.Background(), 3, status)
+	if status.Connections != 0 || status.Failures != 3 {
+		t.Fatalf("want 3 failures, got %+v", status)
+	}
+
+	// NOTE: The requests dial new connections then.
+	ctx := newFailoverTestContext()
+	p.handle(ctx, ctx.Request().Body())
+	if code := ctx.Response().StatusCode(); code == http.StatusOK {
+		t.Errorf("want request to unreachable server failed")
+	}
+}
+
+func TestServerAddr(t *testing.T) {
+	for _, c := range []struct {
+		url, scheme, addr string
+	}{
+		{"http://127.0.0.1", "http", "127.0.0.1:80"},
+		{"https://example.com", "https", "example.com:443"},
+		{"http://[::1]:8080/path", "http", "[::1]:8080"},
+	} {
+		scheme, addr, err := serverAddr(c.url)
+		if err != nil || scheme != c.scheme || addr != c.addr {
+			t.Errorf("%s: want %s %s, got %s %s %v", c.url, c.scheme, c.addr, scheme, addr, err)
+		}
+	}
+
+	if _, _, err := serverAddr("ftp://example.com"); err == nil {
+		t.Errorf("want error for ftp")
+	}
+}
@@ -20,7 +20,6 @@ package proxy
 import (
 	"crypto/tls"
 	"fmt"
-	"net"
 	"net/http"
 	"sync"
 	"time"
@@ -29,6 +28,7 @@ import (
 	"github.com/megaease/easegress/pkg/object/httppipeline"
 	"github.com/megaease/easegress/pkg/supervisor"
 	"github.com/megaease/easegress/pkg/util/fallback"
+	"github.com/megaease/easegress/pkg/util/masterslavereader"
 )
 
 const (
@@ -39,6 +39,8 @@ const (
 	resultInternalError = "interalError"
 	resultClientError   = "clientError"
 	resultServerError   = "serverError"
+
+	resultDeadlineExceeded = "deadlineExceeded"
 )
 
 var (
@@ -47,6 +49,7 @@ var (
 		resultInternalError,
 		resultClientError,
 		resultServerError,
+		resultDeadlineExceeded,
 	}
 )
 
@@ -62,11 +65,9 @@ var (
 		Timeout: 0,
 		Transport: &http.Transport{
 			Proxy: http.ProxyFromEnvironment,
-			DialContext: (&net.Dialer{
-				Timeout:   30 * time.Second,
-				KeepAlive: 60 * time.Second,
-				DualStack: true,
-			}).DialContext,
+			// NOTE: It's the dialer of the pools with the default
+			// keepalive settings, see getPoolClient.
+			DialContext: defaultKeepaliveDialer.DialContext,
 			TLSClientConfig: &tls.Config{
 				// NOTE: Could make it an paramenter,
 				// when the requests need cross WAN.
@@ -101,6 +102,11 @@ type (
 		mirrorPool     *pool
 
 		compression *compression
+
+		// drainer is inherited from the previous generations.
+		drainer *drainer
+
+		preWarmStatus *PreWarmStatus
 	}
 
 	// Spec describes the Proxy.
@@ -113,6 +119,22 @@ type (
 		MirrorPool     *PoolSpec        `yaml:"mirrorPool,omitempty" jsonschema:"omitempty"`
 		FailureCodes   []int            `yaml:"failureCodes" jsonschema:"omitempty,uniqueItems=true,format=httpcode-array"`
 		Compression    *CompressionSpec `yaml:"compression,omitempty" jsonschema:"omitempty"`
+
+		// PropagateDeadline sets the remaining time of the inbound
+		// grpc-timeout to the upstream gRPC calls.
+		PropagateDeadline bool `yaml:"propagateDeadline" jsonschema:"omitempty"`
+
+		// CancellationPropagation cancels the in-flight upstream
+		// requests once the client disconnected, it's true by default.
+		CancellationPropagation bool `yaml:"cancellationPropagation" jsonschema:"omitempty"`
+
+		// PreWarmConnections is the number of connections established
+		// to each server of the pools before the pipeline is ready.
+		PreWarmConnections int `yaml:"preWarmConnections" jsonschema:"omitempty,minimum=0"`
+
+		// LatencyInjection delays the requests before forwarding
+		// them, for chaos testing.
+		LatencyInjection *LatencyInjectionSpec `yaml:"latencyInjection,omitempty" jsonschema:"omitempty"`
 	}
 
 	// FallbackSpec describes the fallback policy.
@@ -126,6 +148,8 @@ type (
 		MainPool       *PoolStatus   `yaml:"mainPool"`
 		CandidatePools []*PoolStatus `yaml:"candidatePool,omitempty"`
 		MirrorPool     *PoolStatus   `yaml:"mirrorPool,omitempty"`
+		// PreWarm is only present if preWarmConnections is set.
+		PreWarm *PreWarmStatus `yaml:"preWarm,omitempty"`
 	}
 )
 
@@ -163,6 +187,12 @@ func (s Spec) Validate() error {
 		}
 	}
 
+	if s.LatencyInjection != nil {
+		if err := s.LatencyInjection.validate(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -173,7 +203,9 @@ func (b *Proxy) Kind() string {
 
 // DefaultSpec returns the default spec of Proxy.
 func (b *Proxy) DefaultSpec() interface{} {
-	return &Spec{}
+	return &Spec{
+		CancellationPropagation: true,
+	}
 }
 
 // Description returns the description of Proxy.
@@ -189,6 +221,7 @@ func (b *Proxy) Results() []string {
 // Init initializes Proxy.
 func (b *Proxy) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
 	b.pipeSpec, b.spec, b.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	b.drainer = newDrainer(pipeSpec.Name())
 	b.reload()
 }
 
@@ -197,12 +230,46 @@ func (b *Proxy) Inherit(pipeSpec *httppipeline.FilterSpec,
 	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
 
 	previousGeneration.Close()
-	b.Init(pipeSpec, super)
+	b.pipeSpec, b.spec, b.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	b.reload()
+
+	// NOTE: The removed servers stop receiving new requests since now,
+	// and the requests in flight of them are handled by the previous generation.
+	prev := previousGeneration.(*Proxy)
+	b.drainer = prev.drainer
+	b.drainer.drain(b.servers(), removedServers(prev.pools(), b.pools()))
+}
+
+func (b *Proxy) pools() []*pool {
+	pools := append([]*pool{b.mainPool}, b.candidatePools...)
+	if b.mirrorPool != nil {
+		pools = append(pools, b.mirrorPool)
+	}
+
+	return pools
+}
+
+func (b *Proxy) servers() []*Server {
+	servers := []*Server{}
+	for _, p := range b.pools() {
+		servers = append(servers, p.spec.Servers...)
+	}
+
+	return servers
+}
+
+// DrainingStatus returns the status of the removed server warming down,
+// the id is the host of the server URL.
+func (b *Proxy) DrainingStatus(id string) (*DrainingStatus, bool) {
+	return b.drainer.status(id)
 }
 
 func (b *Proxy) reload() {
+	activatedAt := time.Now()
+	allowedCommands := b.super.Options().HealthCheckAllowedCommands
+
 	b.mainPool = newPool(b.spec.MainPool, "proxy#main",
-		true /*writeResponse*/, b.spec.FailureCodes)
+		true /*writeResponse*/, b.spec.FailureCodes, allowedCommands)
 
 	if b.spec.Fallback != nil {
 		b.fallback = fallback.New(&b.spec.Fallback.Spec)
@@ -212,18 +279,30 @@ func (b *Proxy) reload() {
 		var candidatePools []*pool
 		for k := range b.spec.CandidatePools {
 			candidatePools = append(candidatePools, newPool(b.spec.CandidatePools[k], fmt.Sprintf("backedn#candidate#%d", k),
-				true, b.spec.FailureCodes))
+				true, b.spec.FailureCodes, allowedCommands))
 		}
 		b.candidatePools = candidatePools
 	}
 	if b.spec.MirrorPool != nil {
 		b.mirrorPool = newPool(b.spec.MirrorPool, "proxy#mirror",
-			false /*writeResponse*/, b.spec.FailureCodes)
+			false /*writeResponse*/, b.spec.FailureCodes, allowedCommands)
 	}
 
 	if b.spec.Compression != nil {
 		b.compression = newcompression(b.spec.Compression)
 	}
+
+	b.mainPool.cancellationPropagation = b.spec.CancellationPropagation
+	for _, p := range b.candidatePools {
+		p.cancellationPropagation = b.spec.CancellationPropagation
+	}
+	if b.mirrorPool != nil {
+		b.mirrorPool.cancellationPropagation = b.spec.CancellationPropagation
+	}
+
+	if b.spec.PreWarmConnections > 0 {
+		b.preWarm(activatedAt)
+	}
 }
 
 // Status returns Proxy status.
@@ -239,6 +318,7 @@ func (b *Proxy) Status() interface{} {
 	if b.mirrorPool != nil {
 		s.MirrorPool = b.mirrorPool.status()
 	}
+	s.PreWarm = b.preWarmStatus
 	return s
 }
 
@@ -276,8 +356,21 @@ func (b *Proxy) Handle(ctx context.HTTPContext) (result string) {
 }
 
 func (b *Proxy) handle(ctx context.HTTPContext) (result string) {
+	// NOTE: The latency is injected before propagating the deadline,
+	// so the remaining time of the upstream call excludes it.
+	if b.spec.LatencyInjection != nil && !injectLatency(ctx, b.spec.LatencyInjection) {
+		ctx.AddTag("client closed connection during latency injection")
+		return resultClientError
+	}
+
+	if b.spec.PropagateDeadline && !propagateGRPCDeadline(ctx) {
+		ctx.AddTag("grpc deadline exceeded before forwarding")
+		failGRPCDeadlineExceeded(ctx)
+		return resultDeadlineExceeded
+	}
+
 	if b.mirrorPool != nil && b.mirrorPool.filter.Filter(ctx) {
-		master, slave := newMasterSlaveReader(ctx.Request().Body())
+		master, slave := masterslavereader.New(ctx.Request().Body())
 		ctx.Request().SetBody(master)
 
 		wg := &sync.WaitGroup{}
@@ -19,6 +19,7 @@ package proxy
 
 import (
 	"bytes"
+	stdcontext "context"
 	"fmt"
 	"io"
 	"net/http"
@@ -36,6 +37,8 @@ type (
 		std        *http.Request
 		statResult *httpstat.Result
 		createTime time.Time
+		// cancel aborts the request, and releases its context.
+		cancel     stdcontext.CancelFunc
 		_startTime *time.Time
 		_endTime   *time.Time
 	}
@@ -59,11 +62,14 @@ func (p *pool) newRequest(ctx context.HTTPContext, server *Server, reqBody io.Re
 		url += "?" + r.Query()
 	}
 
-	newCtx := httpstat.WithHTTPStat(ctx, req.statResult)
+	upstreamCtx, cancel := stdcontext.WithCancel(p.upstreamContext(ctx))
+	newCtx := httpstat.WithHTTPStat(upstreamCtx, req.statResult)
 	stdr, err := http.NewRequestWithContext(newCtx, r.Method(), url, reqBody)
 	if err != nil {
+		cancel()
 		return nil, fmt.Errorf("BUG: new request failed: %v", err)
 	}
+	req.cancel = cancel
 	stdr.Header = r.Header().Std()
 
 	req.std = stdr
@@ -57,7 +57,13 @@ type (
 		mutex   sync.Mutex
 		service *serviceregistry.Service
 		static  *staticServers
+		// version is increased atomically once static is replaced.
+		version uint64
+		srv     *srvResolver
 		done    chan struct{}
+
+		affinity    *sessionAffinity
+		healthCheck *healthChecker
 	}
 
 	staticServers struct {
@@ -72,12 +78,21 @@ type (
 		URL    string   `yaml:"url" jsonschema:"required,format=url"`
 		Tags   []string `yaml:"tags" jsonschema:"omitempty,uniqueItems=true"`
 		Weight int      `yaml:"weight" jsonschema:"omitempty,minimum=0,maximum=100"`
+		// MaxAttempts is the attempts of the server in failoverOrder, default 1.
+		MaxAttempts int `yaml:"maxAttempts" jsonschema:"omitempty,minimum=0"`
+		// WarmDownPeriod is how long the requests in flight are allowed
+		// to complete after the server is removed by updating the spec.
+		WarmDownPeriod string `yaml:"warmDownPeriod" jsonschema:"omitempty,format=duration"`
+
+		inflight inflightRequests
 	}
 
 	// LoadBalance is load balance for multiple servers.
 	LoadBalance struct {
 		Policy        string `yaml:"policy" jsonschema:"required,enum=roundRobin,enum=random,enum=weightedRandom,enum=ipHash,enum=headerHash"`
 		HeaderHashKey string `yaml:"headerHashKey" jsonschema:"omitempty"`
+
+		SessionAffinity *DatabaseSessionAffinity `yaml:"sessionAffinity,omitempty" jsonschema:"omitempty"`
 	}
 )
 
@@ -94,20 +109,41 @@ func (lb LoadBalance) Validate() error {
 	return nil
 }
 
-func newServers(poolSpec *PoolSpec) *servers {
+func newServers(poolSpec *PoolSpec, allowedCommands []string) *servers {
 	s := &servers{
 		poolSpec: poolSpec,
 		done:     make(chan struct{}),
 	}
 
+	if poolSpec.LoadBalance.SessionAffinity != nil {
+		s.affinity = newSessionAffinity(poolSpec.LoadBalance.SessionAffinity)
+	}
+
+	if poolSpec.SRVRecord != "" {
+		s.srv = newSRVResolver(poolSpec)
+	}
+
 	s.tryUpdateService()
 
+	if poolSpec.HealthCheck != nil {
+		s.healthCheck = newHealthChecker(poolSpec.HealthCheck, allowedCommands,
+			func() *staticServers {
+				static, _ := s.snapshot()
+				return static
+			})
+	}
+
 	go s.run()
 
 	return s
 }
 
 func (s *servers) run() {
+	if s.srv != nil {
+		s.runSRV()
+		return
+	}
+
 	if s.poolSpec.ServiceName == "" {
 		return
 	}
@@ -150,14 +186,20 @@ func (s *servers) mustUpdateService() *serviceregistry.Service {
 	}
 }
 
-// tryUpdateService uses static servers if it failed to get service.
+// tryUpdateService uses static servers if it failed to get service
+// or to lookup the SRV record.
 func (s *servers) tryUpdateService() {
-	if s.poolSpec.ServiceName == "" {
+	var err error
+	switch {
+	case s.srv != nil:
+		err = s.useSRVServers()
+	case s.poolSpec.ServiceName != "":
+		_, err = s.useService()
+	default:
 		s.useStaticServers()
 		return
 	}
 
-	_, err := s.useService()
 	if err == nil {
 		return
 	}
@@ -178,6 +220,7 @@ func (s *servers) useStaticServers() {
 		s.poolSpec.ServersTags,
 		*s.poolSpec.LoadBalance)
 	s.service = nil
+	atomic.AddUint64(&s.version, 1)
 }
 
 func (s *servers) useService() (*serviceregistry.Service, error) {
@@ -201,6 +244,7 @@ func (s *servers) useService() (*serviceregistry.Service, error) {
 	static := newStaticServers(serversInput, s.poolSpec.ServersTags, *s.poolSpec.LoadBalance)
 
 	s.static, s.service = static, service
+	atomic.AddUint64(&s.version, 1)
 
 	return service, nil
 }
@@ -225,15 +269,29 @@ func (s *servers) len() int {
 func (s *servers) next(ctx context.HTTPContext) (*Server, error) {
 	static, _ := s.snapshot()
 
-	if static.len() == 0 {
+	if static == nil || static.len() == 0 {
 		return nil, fmt.Errorf("no server available")
 	}
 
+	if s.healthCheck != nil {
+		static = s.healthCheck.filter(static)
+	}
+
+	if s.affinity != nil {
+		return s.affinity.next(ctx, static), nil
+	}
+
 	return static.next(ctx), nil
 }
 
 func (s *servers) close() {
 	close(s.done)
+	if s.affinity != nil {
+		s.affinity.close()
+	}
+	if s.healthCheck != nil {
+		s.healthCheck.close()
+	}
 }
 
 func newStaticServers(servers []*Server, tags []string, lb LoadBalance) *staticServers {
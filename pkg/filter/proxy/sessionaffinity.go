@@ -0,0 +1,162 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/redisclient"
+)
+
+const (
+	// EvictionLRU refreshes the TTL of the session on every request,
+	// so the least recently used sessions are evicted first.
+	EvictionLRU = "lru"
+	// EvictionTime evicts the session after TTL since it was created.
+	EvictionTime = "time"
+
+	defaultSessionKeyPrefix = "easegress:session:"
+)
+
+type (
+	// DatabaseSessionAffinity stores the session-to-upstream mapping
+	// in Redis, so that multiple Easegress instances sharing the same
+	// Redis route the same session to the same upstream.
+	DatabaseSessionAffinity struct {
+		CookieName string            `yaml:"cookieName" jsonschema:"required"`
+		SessionTTL string            `yaml:"sessionTTL" jsonschema:"required,format=duration"`
+		Eviction   string            `yaml:"eviction" jsonschema:"omitempty,enum=,enum=lru,enum=time"`
+		KeyPrefix  string            `yaml:"keyPrefix" jsonschema:"omitempty"`
+		Redis      *redisclient.Spec `yaml:"redis" jsonschema:"required"`
+	}
+
+	sessionAffinity struct {
+		spec      *DatabaseSessionAffinity
+		ttl       time.Duration
+		keyPrefix string
+		client    *redisclient.Client
+	}
+)
+
+// Validate validates DatabaseSessionAffinity.
+func (dsa DatabaseSessionAffinity) Validate() error {
+	ttl, err := time.ParseDuration(dsa.SessionTTL)
+	if err != nil {
+		return fmt.Errorf("invalid sessionTTL %s: %v", dsa.SessionTTL, err)
+	}
+	if ttl < time.Millisecond {
+		return fmt.Errorf("sessionTTL %s is less than 1ms", dsa.SessionTTL)
+	}
+
+	return nil
+}
+
+func newSessionAffinity(spec *DatabaseSessionAffinity) *sessionAffinity {
+	ttl, err := time.ParseDuration(spec.SessionTTL)
+	if err != nil {
+		logger.Errorf("BUG: parse duration %s failed: %v", spec.SessionTTL, err)
+	}
+
+	keyPrefix := spec.KeyPrefix
+	if keyPrefix == "" {
+		keyPrefix = defaultSessionKeyPrefix
+	}
+
+	return &sessionAffinity{
+		spec:      spec,
+		ttl:       ttl,
+		keyPrefix: keyPrefix,
+		client:    redisclient.New(spec.Redis),
+	}
+}
+
+// next returns the server bound to the session, it binds the server
+// picked by the load balance policy if there is none. It falls back
+// to the load balance policy if the database is unavailable.
+func (sa *sessionAffinity) next(ctx context.HTTPContext, static *staticServers) *Server {
+	cookie, err := ctx.Request().Cookie(sa.spec.CookieName)
+	if err != nil || cookie.Value == "" {
+		return static.next(ctx)
+	}
+
+	key := sa.keyPrefix + cookie.Value
+	ttl := strconv.FormatInt(sa.ttl.Milliseconds(), 10)
+
+	if server := sa.lookup(key, ttl, static); server != nil {
+		return server
+	}
+
+	server := static.next(ctx)
+
+	// NOTE: Only set if not exists, another instance may have bound
+	// the session to a different server in the meantime.
+	reply, err := sa.client.Do("SET", key, server.URL, "PX", ttl, "NX")
+	if err != nil {
+		logger.Warnf("bind session to %s failed: %v", server.URL, err)
+		return server
+	}
+	if reply == nil {
+		if bound := sa.lookup(key, ttl, static); bound != nil {
+			return bound
+		}
+	}
+
+	return server
+}
+
+func (sa *sessionAffinity) lookup(key, ttl string, static *staticServers) *Server {
+	reply, err := sa.client.Do("GET", key)
+	if err != nil {
+		logger.Warnf("get session %s failed: %v", key, err)
+		return nil
+	}
+	url, ok := reply.(string)
+	if !ok {
+		return nil
+	}
+
+	for _, server := range static.servers {
+		if server.URL != url {
+			continue
+		}
+
+		if sa.spec.Eviction == EvictionLRU {
+			_, err := sa.client.Do("PEXPIRE", key, ttl)
+			if err != nil {
+				logger.Warnf("refresh session %s failed: %v", key, err)
+			}
+		}
+		return server
+	}
+
+	// NOTE: The bound server is gone, rebind the session.
+	_, err = sa.client.Do("DEL", key)
+	if err != nil {
+		logger.Warnf("delete session %s failed: %v", key, err)
+	}
+
+	return nil
+}
+
+func (sa *sessionAffinity) close() {
+	sa.client.Close()
+}
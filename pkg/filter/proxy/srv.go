@@ -0,0 +1,169 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	stdcontext "context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const (
+	defaultDNSRefreshInterval = 30 * time.Second
+	srvLookupTimeout          = 5 * time.Second
+)
+
+type (
+	// srvResolver resolves the SRV record into servers.
+	srvResolver struct {
+		record          string
+		scheme          string
+		refreshInterval time.Duration
+		resolver        *net.Resolver
+	}
+)
+
+func newSRVResolver(poolSpec *PoolSpec) *srvResolver {
+	r := &srvResolver{
+		record:          poolSpec.SRVRecord,
+		scheme:          "http",
+		refreshInterval: defaultDNSRefreshInterval,
+		resolver:        net.DefaultResolver,
+	}
+
+	// NOTE: The service label tells the scheme, such as _https._tcp.myservice.local.
+	if strings.HasPrefix(r.record, "_https.") {
+		r.scheme = "https"
+	}
+
+	if poolSpec.DNSRefreshInterval != "" {
+		// NOTE: It has been checked in validation.
+		r.refreshInterval, _ = time.ParseDuration(poolSpec.DNSRefreshInterval)
+	}
+
+	if poolSpec.DNSServer != "" {
+		dnsServer := poolSpec.DNSServer
+		r.resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx stdcontext.Context, network, address string) (net.Conn, error) {
+				d := net.Dialer{}
+				return d.DialContext(ctx, network, dnsServer)
+			},
+		}
+	}
+
+	return r
+}
+
+// lookup returns the servers of the lowest priority value in the SRV record,
+// the ones of higher values are only for failover in RFC 2782.
+// The SRV weights become the server weights for weightedRandom.
+func (r *srvResolver) lookup(ctx stdcontext.Context) ([]*Server, error) {
+	_, addrs, err := r.resolver.LookupSRV(ctx, "", "", r.record)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no target")
+	}
+
+	// NOTE: The addrs are sorted by priority.
+	priority := addrs[0].Priority
+	servers := []*Server{}
+	weightsSum := 0
+	for _, addr := range addrs {
+		if addr.Priority != priority {
+			break
+		}
+		host := strings.TrimSuffix(addr.Target, ".")
+		servers = append(servers, &Server{
+			URL:    r.scheme + "://" + net.JoinHostPort(host, strconv.Itoa(int(addr.Port))),
+			Weight: int(addr.Weight),
+		})
+		weightsSum += int(addr.Weight)
+	}
+
+	// NOTE: All zero weights means equal chances in RFC 2782.
+	if weightsSum == 0 {
+		for _, server := range servers {
+			server.Weight = 1
+		}
+	}
+
+	return servers, nil
+}
+
+func sameServers(x, y []*Server) bool {
+	if len(x) != len(y) {
+		return false
+	}
+
+	for i := range x {
+		if x[i].URL != y[i].URL || x[i].Weight != y[i].Weight {
+			return false
+		}
+	}
+
+	return true
+}
+
+// useSRVServers replaces the servers with the ones in the SRV record.
+func (s *servers) useSRVServers() error {
+	ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), srvLookupTimeout)
+	defer cancel()
+
+	servers, err := s.srv.lookup(ctx)
+	if err != nil {
+		return fmt.Errorf("lookup srv record %s failed: %v", s.srv.record, err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// NOTE: Keep the state of load balance if nothing changed.
+	if s.static != nil && sameServers(s.static.servers, servers) {
+		return nil
+	}
+	s.static = newStaticServers(servers, nil, *s.poolSpec.LoadBalance)
+	atomic.AddUint64(&s.version, 1)
+
+	return nil
+}
+
+func (s *servers) runSRV() {
+	ticker := time.NewTicker(s.srv.refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			err := s.useSRVServers()
+			if err != nil {
+				logger.Warnf("%v, keep the previous servers", err)
+			}
+		}
+	}
+}
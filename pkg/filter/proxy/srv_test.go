@@ -0,0 +1,238 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	stdcontext "context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// mockDNSServer answers the SRV queries with the records set by tests.
+type mockDNSServer struct {
+	conn net.PacketConn
+
+	mutex   sync.Mutex
+	records []dnsmessage.SRVResource
+}
+
+func newMockDNSServer(t *testing.T) *mockDNSServer {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen udp failed: %v", err)
+	}
+
+	m := &mockDNSServer{conn: conn}
+	go m.serve()
+	return m
+}
+
+func (m *mockDNSServer) setRecords(records ...dnsmessage.SRVResource) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.records = records
+}
+
+func (m *mockDNSServer) serve() {
+	buff := make([]byte, 512)
+	for {
+		n, addr, err := m.conn.ReadFrom(buff)
+		if err != nil {
+			return
+		}
+
+		query := dnsmessage.Message{}
+		if query.Unpack(buff[:n]) != nil || len(query.Questions) != 1 {
+			continue
+		}
+		q := query.Questions[0]
+
+		resp := dnsmessage.Message{
+			Header: dnsmessage.Header{
+				ID:            query.ID,
+				Response:      true,
+				Authoritative: true,
+			},
+			Questions: query.Questions,
+		}
+		if q.Type == dnsmessage.TypeSRV {
+			m.mutex.Lock()
+			for _, record := range m.records {
+				record := record
+				resp.Answers = append(resp.Answers, dnsmessage.Resource{
+					Header: dnsmessage.ResourceHeader{
+						Name:  q.Name,
+						Type:  dnsmessage.TypeSRV,
+						Class: dnsmessage.ClassINET,
+						TTL:   1,
+					},
+					Body: &record,
+				})
+			}
+			m.mutex.Unlock()
+		}
+
+		out, err := resp.Pack()
+		if err != nil {
+			continue
+		}
+		m.conn.WriteTo(out, addr)
+	}
+}
+
+func (m *mockDNSServer) close() {
+	m.conn.Close()
+}
+
+func srvRecord(target string, port, priority, weight uint16) dnsmessage.SRVResource {
+	return dnsmessage.SRVResource{
+		Priority: priority,
+		Weight:   weight,
+		Port:     port,
+		Target:   dnsmessage.MustNewName(target),
+	}
+}
+
+func TestSRVLookup(t *testing.T) {
+	dns := newMockDNSServer(t)
+	defer dns.close()
+
+	dns.setRecords(
+		srvRecord("a.myservice.local.", 8080, 10, 3),
+		srvRecord("b.myservice.local.", 8081, 10, 1),
+		srvRecord("backup.myservice.local.", 9090, 20, 1),
+	)
+
+	r := newSRVResolver(&PoolSpec{
+		SRVRecord: "_https._tcp.myservice.local",
+		DNSServer: dns.conn.LocalAddr().String(),
+	})
+	servers, err := r.lookup(stdcontext.Background())
+	if err != nil {
+		t.Fatalf("lookup failed: %v", err)
+	}
+
+	weights := map[string]int{}
+	for _, server := range servers {
+		weights[server.URL] = server.Weight
+	}
+	want := map[string]int{
+		"https://a.myservice.local:8080": 3,
+		"https://b.myservice.local:8081": 1,
+	}
+	if len(weights) != len(want) {
+		t.Fatalf("want servers of the lowest priority %v, got %v", want, weights)
+	}
+	for url, weight := range want {
+		if weights[url] != weight {
+			t.Errorf("%s: want weight %d, got %d", url, weight, weights[url])
+		}
+	}
+
+	dns.setRecords(
+		srvRecord("a.myservice.local.", 8080, 10, 0),
+		srvRecord("b.myservice.local.", 8081, 10, 0),
+	)
+	servers, err = r.lookup(stdcontext.Background())
+	if err != nil {
+		t.Fatalf("lookup failed: %v", err)
+	}
+	for _, server := range servers {
+		if server.Weight != 1 {
+			t.Errorf("all zero weights: want weight 1, got %d", server.Weight)
+		}
+	}
+}
+
+func TestSRVServers(t *testing.T) {
+	dns := newMockDNSServer(t)
+	defer dns.close()
+
+	dns.setRecords(
+		srvRecord("a.myservice.local.", 8080, 10, 3),
+		srvRecord("b.myservice.local.", 8081, 10, 1),
+	)
+
+	poolSpec := &PoolSpec{
+		SRVRecord:          "_http._tcp.myservice.local",
+		DNSServer:          dns.conn.LocalAddr().String(),
+		DNSRefreshInterval: "20ms",
+		LoadBalance:        &LoadBalance{Policy: PolicyWeightedRandom},
+	}
+	if err := poolSpec.Validate(); err != nil {
+		t.Fatalf("validate failed: %v", err)
+	}
+	s := newServers(poolSpec, nil)
+	defer s.close()
+
+	static, _ := s.snapshot()
+	if static.len() != 2 {
+		t.Fatalf("want 2 servers, got %d", static.len())
+	}
+
+	// NOTE: The SRV weights drive weightedRandom.
+	picks := map[string]int{}
+	for i := 0; i < 4000; i++ {
+		picks[static.weightedRandom(nil).URL]++
+	}
+	ratio := float64(picks["http://a.myservice.local:8080"]) / float64(picks["http://b.myservice.local:8081"])
+	if ratio < 2 || ratio > 4.5 {
+		t.Errorf("want picks about 3:1, got %v", picks)
+	}
+
+	dns.setRecords(srvRecord("c.myservice.local.", 9090, 10, 1))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		static, _ = s.snapshot()
+		if static.len() == 1 && static.servers[0].URL == "http://c.myservice.local:9090" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("servers not refreshed: %v", static.servers)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSRVSpecValidate(t *testing.T) {
+	for _, spec := range []*PoolSpec{
+		{
+			SRVRecord:   "_http._tcp.myservice.local",
+			ServiceName: "myservice",
+			LoadBalance: &LoadBalance{Policy: PolicyWeightedRandom},
+		},
+		{
+			SRVRecord:   "_http._tcp.myservice.local",
+			LoadBalance: &LoadBalance{Policy: PolicyRoundRobin},
+		},
+		{
+			SRVRecord:          "_http._tcp.myservice.local",
+			DNSRefreshInterval: "0s",
+			LoadBalance:        &LoadBalance{Policy: PolicyWeightedRandom},
+		},
+	} {
+		if err := spec.Validate(); err == nil {
+			t.Errorf("want error for %+v", spec)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync/atomic"
+)
+
+type (
+	// tlsStat counts the TLS handshakes to the servers,
+	// it's accessed atomically.
+	tlsStat struct {
+		full    uint64
+		resumed uint64
+	}
+
+	// TLSHandshakeStatus is the status of the TLS handshakes to the servers.
+	TLSHandshakeStatus struct {
+		Full    uint64 `yaml:"full"`
+		Resumed uint64 `yaml:"resumed"`
+	}
+)
+
+// newTLSResumptionClient returns a client with its own connections and
+// TLS session cache, so the new connections to the https servers resume
+// the previous sessions instead of doing full handshakes.
+func newTLSResumptionClient(capacity int) *http.Client {
+	client := cloneClient(globalClient)
+	transport := client.Transport.(*http.Transport)
+
+	// NOTE: The client resumes sessions by the tickets issued by the
+	// servers, which are cached by server name. The client certificate
+	// of mutual TLS is bound to the resumed session, so the server
+	// still gets it without presenting it again. Zero capacity is the
+	// default one of crypto/tls.
+	transport.TLSClientConfig.SessionTicketsDisabled = false
+	transport.TLSClientConfig.ClientSessionCache = tls.NewLRUClientSessionCache(capacity)
+
+	return client
+}
+
+// withTrace returns the request counting the TLS handshake of
+// the new connection, the reused connections are not counted.
+func (s *tlsStat) withTrace(req *http.Request) *http.Request {
+	trace := &httptrace.ClientTrace{
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			if err != nil {
+				return
+			}
+			if state.DidResume {
+				atomic.AddUint64(&s.resumed, 1)
+			} else {
+				atomic.AddUint64(&s.full, 1)
+			}
+		},
+	}
+
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+}
+
+func (s *tlsStat) status() *TLSHandshakeStatus {
+	return &TLSHandshakeStatus{
+		Full:    atomic.LoadUint64(&s.full),
+		Resumed: atomic.LoadUint64(&s.resumed),
+	}
+}
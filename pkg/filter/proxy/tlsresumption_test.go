@@ -0,0 +1,53 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTLSResumptionClient(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	client := newTLSResumptionClient(0)
+	stat := &tlsStat{}
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		resp, err := client.Do(stat.withTrace(req))
+		if err != nil {
+			t.Fatalf("request %d failed: %v", i, err)
+		}
+		resp.Body.Close()
+
+		// NOTE: Close the connection to handshake again.
+		client.CloseIdleConnections()
+	}
+
+	status := stat.status()
+	if status.Full != 1 || status.Resumed != 2 {
+		t.Fatalf("want 1 full and 2 resumed handshakes, got %+v", status)
+	}
+
+	// NOTE: The global client must be left untouched.
+	if globalClient.Transport.(*http.Transport).TLSClientConfig.ClientSessionCache != nil {
+		t.Fatalf("want no session cache in the global client")
+	}
+}
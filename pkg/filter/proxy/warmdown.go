@@ -0,0 +1,262 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	stdcontext "context"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const (
+	drainCheckInterval = 100 * time.Millisecond
+	// drainedRetention keeps the status of the drained servers for querying.
+	drainedRetention = 10 * time.Minute
+)
+
+type (
+	// inflightRequests tracks the requests in flight to a server,
+	// to abort them once its warm-down period expires.
+	inflightRequests struct {
+		mutex   sync.Mutex
+		nextID  uint64
+		cancels map[uint64]stdcontext.CancelFunc
+	}
+
+	// drainer warms down the servers removed by updating the spec,
+	// it's handed over to the next generations of Proxy.
+	drainer struct {
+		name string
+
+		mutex sync.Mutex
+		// servers are keyed by URL.
+		servers map[string]*drainingServer
+	}
+
+	drainingServer struct {
+		server    *Server
+		removedAt time.Time
+		deadline  time.Time
+		// drainedAt is zero until it's drained.
+		drainedAt time.Time
+		aborted   int
+	}
+
+	// DrainingStatus is the status of the server warming down.
+	DrainingStatus struct {
+		ID        string `yaml:"id"`
+		URL       string `yaml:"url"`
+		Draining  bool   `yaml:"draining"`
+		InFlight  int    `yaml:"inFlight"`
+		RemovedAt string `yaml:"removedAt"`
+		Deadline  string `yaml:"deadline"`
+		DrainedAt string `yaml:"drainedAt,omitempty"`
+		Aborted   int    `yaml:"aborted"`
+	}
+)
+
+// add tracks the request, done must be called after it finished.
+func (ir *inflightRequests) add(cancel stdcontext.CancelFunc) (done func()) {
+	ir.mutex.Lock()
+	defer ir.mutex.Unlock()
+
+	if ir.cancels == nil {
+		ir.cancels = make(map[uint64]stdcontext.CancelFunc)
+	}
+	id := ir.nextID
+	ir.nextID++
+	ir.cancels[id] = cancel
+
+	once := &sync.Once{}
+	return func() {
+		once.Do(func() {
+			ir.mutex.Lock()
+			delete(ir.cancels, id)
+			ir.mutex.Unlock()
+			cancel()
+		})
+	}
+}
+
+func (ir *inflightRequests) count() int {
+	ir.mutex.Lock()
+	defer ir.mutex.Unlock()
+
+	return len(ir.cancels)
+}
+
+// abort cancels all requests in flight, and returns the count of them.
+func (ir *inflightRequests) abort() int {
+	ir.mutex.Lock()
+	defer ir.mutex.Unlock()
+
+	for _, cancel := range ir.cancels {
+		cancel()
+	}
+	count := len(ir.cancels)
+	ir.cancels = nil
+
+	return count
+}
+
+// serverID returns the host of the server URL, which is the id in the API.
+func serverID(server *Server) string {
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		return server.URL
+	}
+
+	return u.Host
+}
+
+func newDrainer(name string) *drainer {
+	return &drainer{
+		name:    name,
+		servers: make(map[string]*drainingServer),
+	}
+}
+
+// removedServers returns the servers of prev which have warm-down period
+// and are removed in next.
+func removedServers(prev, next []*pool) []*Server {
+	remaining := make(map[string]struct{})
+	for _, p := range next {
+		for _, server := range p.spec.Servers {
+			remaining[server.URL] = struct{}{}
+		}
+	}
+
+	servers := []*Server{}
+	for _, p := range prev {
+		for _, server := range p.spec.Servers {
+			if _, exists := remaining[server.URL]; exists || server.WarmDownPeriod == "" {
+				continue
+			}
+			servers = append(servers, server)
+		}
+	}
+
+	return servers
+}
+
+// drain stops tracking the servers present again, and warms down the removed ones.
+func (d *drainer) drain(present, removed []*Server) {
+	now := time.Now()
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for key, ds := range d.servers {
+		if !ds.drainedAt.IsZero() && now.Sub(ds.drainedAt) > drainedRetention {
+			delete(d.servers, key)
+		}
+	}
+	for _, server := range present {
+		if ds, exists := d.servers[server.URL]; exists && !ds.drainedAt.IsZero() {
+			delete(d.servers, server.URL)
+		}
+	}
+
+	for _, server := range removed {
+		period, err := time.ParseDuration(server.WarmDownPeriod)
+		if err != nil {
+			logger.Errorf("BUG: parse duration %s failed: %v", server.WarmDownPeriod, err)
+			continue
+		}
+
+		ds := &drainingServer{
+			server:    server,
+			removedAt: now,
+			deadline:  now.Add(period),
+		}
+		d.servers[server.URL] = ds
+		logger.Infof("%s: warm down removed server %s for %s", d.name, server.URL, period)
+
+		go d.warmDown(ds)
+	}
+}
+
+func (d *drainer) warmDown(ds *drainingServer) {
+	ticker := time.NewTicker(drainCheckInterval)
+	defer ticker.Stop()
+	timer := time.NewTimer(time.Until(ds.deadline))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if ds.server.inflight.count() == 0 {
+				d.drained(ds, 0)
+				return
+			}
+		case <-timer.C:
+			d.drained(ds, ds.server.inflight.abort())
+			return
+		}
+	}
+}
+
+func (d *drainer) drained(ds *drainingServer, aborted int) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	ds.drainedAt, ds.aborted = time.Now(), aborted
+	if aborted > 0 {
+		logger.Warnf("%s: removed server %s drained, aborted %d requests after warm-down period",
+			d.name, ds.server.URL, aborted)
+	} else {
+		logger.Infof("%s: removed server %s drained", d.name, ds.server.URL)
+	}
+}
+
+// status returns the status of the most recently removed server with the id.
+func (d *drainer) status(id string) (*DrainingStatus, bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	var latest *drainingServer
+	for _, ds := range d.servers {
+		if serverID(ds.server) != id {
+			continue
+		}
+		if latest == nil || ds.removedAt.After(latest.removedAt) {
+			latest = ds
+		}
+	}
+	if latest == nil {
+		return nil, false
+	}
+
+	status := &DrainingStatus{
+		ID:        id,
+		URL:       latest.server.URL,
+		Draining:  latest.drainedAt.IsZero(),
+		InFlight:  latest.server.inflight.count(),
+		RemovedAt: latest.removedAt.Format(time.RFC3339),
+		Deadline:  latest.deadline.Format(time.RFC3339),
+		Aborted:   latest.aborted,
+	}
+	if !latest.drainedAt.IsZero() {
+		status.DrainedAt = latest.drainedAt.Format(time.RFC3339)
+	}
+
+	return status, true
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	stdcontext "context"
+	"testing"
+	"time"
+)
+
+func waitDrained(t *testing.T, d *drainer, id string) *DrainingStatus {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		status, exists := d.status(id)
+		if !exists {
+			t.Fatalf("status of %s not found", id)
+		}
+		if !status.Draining {
+			return status
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("%s not drained", id)
+	return nil
+}
+
+func TestRemovedServers(t *testing.T) {
+	prev := []*pool{{spec: &PoolSpec{Servers: []*Server{
+		{URL: "http://127.0.0.1:9091", WarmDownPeriod: "10s"},
+		{URL: "http://127.0.0.1:9092", WarmDownPeriod: "10s"},
+		{URL: "http://127.0.0.1:9093"},
+	}}}}
+	next := []*pool{{spec: &PoolSpec{Servers: []*Server{
+		{URL: "http://127.0.0.1:9091"},
+	}}}}
+
+	removed := removedServers(prev, next)
+	if len(removed) != 1 || removed[0].URL != "http://127.0.0.1:9092" {
+		t.Fatalf("want only http://127.0.0.1:9092 removed, got %v", removed)
+	}
+}
+
+func TestWarmDownDrained(t *testing.T) {
+	server := &Server{URL: "http://127.0.0.1:9091", WarmDownPeriod: "10s"}
+	ctx, cancel := stdcontext.WithCancel(stdcontext.Background())
+	done := server.inflight.add(cancel)
+
+	d := newDrainer("proxy")
+	d.drain(nil, []*Server{server})
+
+	status, exists := d.status("127.0.0.1:9091")
+	if !exists || !status.Draining || status.InFlight != 1 {
+		t.Fatalf("want draining with 1 request in flight, got %+v", status)
+	}
+
+	done()
+	status = waitDrained(t, d, "127.0.0.1:9091")
+	if status.Aborted != 0 || status.InFlight != 0 {
+		t.Fatalf("want drained without aborting, got %+v", status)
+	}
+	if ctx.Err() == nil {
+		t.Errorf("want context of the finished request released")
+	}
+}
+
+func TestWarmDownAborted(t *testing.T) {
+	server := &Server{URL: "http://127.0.0.1:9091", WarmDownPeriod: "50ms"}
+	ctx, cancel := stdcontext.WithCancel(stdcontext.Background())
+	server.inflight.add(cancel)
+
+	d := newDrainer("proxy")
+	d.drain(nil, []*Server{server})
+
+	status := waitDrained(t, d, "127.0.0.1:9091")
+	if status.Aborted != 1 {
+		t.Fatalf("want 1 request aborted, got %+v", status)
+	}
+	if ctx.Err() == nil {
+		t.Errorf("want the request in flight aborted")
+	}
+
+	// NOTE: The drained status is dropped once the server is back.
+	d.drain([]*Server{{URL: "http://127.0.0.1:9091"}}, nil)
+	if _, exists := d.status("127.0.0.1:9091"); exists {
+		t.Errorf("want status dropped for the server present again")
+	}
+}
@@ -66,6 +66,13 @@ type (
 		Policies         []*Policy  `yaml:"policies" jsonschema:"required"`
 		DefaultPolicyRef string     `yaml:"defaultPolicyRef" jsonschema:"omitempty"`
 		URLs             []*URLRule `yaml:"urls" jsonschema:"required"`
+
+		// RejectionBody adds the Retry-After header and a body detailing
+		// the limit hit to rejected responses.
+		RejectionBody bool `yaml:"rejectionBody" jsonschema:"omitempty"`
+		// RejectionEncoder is the name of the registered encoder
+		// of the rejection body, it's json if empty.
+		RejectionEncoder string `yaml:"rejectionEncoder" jsonschema:"omitempty"`
 	}
 
 	// RateLimiter defines the rate limiter
@@ -94,10 +101,22 @@ URLLoop:
 		return fmt.Errorf("policy '%s' is not defined", name)
 	}
 
+	if spec.RejectionEncoder != "" {
+		if _, exists := rejectionEncoders[spec.RejectionEncoder]; !exists {
+			return fmt.Errorf("rejection encoder '%s' is not registered", spec.RejectionEncoder)
+		}
+	}
+
 	return nil
 }
 
 func (url *URLRule) createRateLimiter() {
+	policy := url.libPolicy()
+	url.rl = librl.New(&policy)
+}
+
+// libPolicy returns the policy with defaults filled.
+func (url *URLRule) libPolicy() librl.Policy {
 	policy := librl.Policy{
 		LimitForPeriod: url.policy.LimitForPeriod,
 	}
@@ -118,7 +137,7 @@ func (url *URLRule) createRateLimiter() {
 		policy.LimitRefreshPeriod = 10 * time.Millisecond
 	}
 
-	url.rl = librl.New(&policy)
+	return policy
 }
 
 // Kind returns the kind of RateLimiter.
@@ -261,6 +280,9 @@ func (rl *RateLimiter) handle(ctx context.HTTPContext) string {
 			ctx.AddTag("rateLimiter: too many requests")
 			ctx.Response().SetStatusCode(http.StatusTooManyRequests)
 			ctx.Response().Std().Header().Set("X-EG-Rate-Limiter", "too-many-requests")
+			if rl.spec.RejectionBody {
+				rl.writeRejection(ctx, u)
+			}
 			return resultRateLimited
 		}
 
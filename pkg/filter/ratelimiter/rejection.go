@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ratelimiter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	defaultRejectionEncoder = "json"
+)
+
+type (
+	// RejectionErr is the body of rejected responses,
+	// detailing the limit hit.
+	RejectionErr struct {
+		Code               int    `json:"code" yaml:"code"`
+		Message            string `json:"message" yaml:"message"`
+		Policy             string `json:"policy" yaml:"policy"`
+		LimitForPeriod     int    `json:"limitForPeriod" yaml:"limitForPeriod"`
+		LimitRefreshPeriod string `json:"limitRefreshPeriod" yaml:"limitRefreshPeriod"`
+		// RetryAfter is the estimated seconds to wait before retrying,
+		// it's the same as the Retry-After header.
+		RetryAfter int `json:"retryAfter" yaml:"retryAfter"`
+	}
+
+	// RejectionEncoder encodes the rejection body, and returns
+	// its content type.
+	RejectionEncoder func(rej *RejectionErr) (contentType string, body []byte, err error)
+)
+
+var (
+	rejectionEncoders = map[string]RejectionEncoder{
+		"json": encodeRejectionJSON,
+		"yaml": encodeRejectionYAML,
+	}
+)
+
+// RegisterRejectionEncoder registers the encoder of rejection bodies,
+// which could be referred by rejectionEncoder of the spec.
+// It must be called in init functions.
+func RegisterRejectionEncoder(name string, encoder RejectionEncoder) {
+	if name == "" {
+		panic(fmt.Errorf("empty rejection encoder name"))
+	}
+
+	if _, exists := rejectionEncoders[name]; exists {
+		panic(fmt.Errorf("rejection encoder %s registered twice", name))
+	}
+
+	rejectionEncoders[name] = encoder
+}
+
+func encodeRejectionJSON(rej *RejectionErr) (string, []byte, error) {
+	buff, err := json.Marshal(rej)
+	return "application/json", buff, err
+}
+
+func encodeRejectionYAML(rej *RejectionErr) (string, []byte, error) {
+	buff, err := yaml.Marshal(rej)
+	return "text/vnd.yaml", buff, err
+}
+
+func (url *URLRule) newRejectionErr() *RejectionErr {
+	policy := url.libPolicy()
+
+	// NOTE: The permissions are reserved up to the timeout duration
+	// ahead, so it's free at the earliest in the next period after it.
+	retryAfter := int(math.Ceil((policy.TimeoutDuration + policy.LimitRefreshPeriod).Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+
+	return &RejectionErr{
+		Code:               http.StatusTooManyRequests,
+		Message:            "too many requests",
+		Policy:             url.policy.Name,
+		LimitForPeriod:     policy.LimitForPeriod,
+		LimitRefreshPeriod: policy.LimitRefreshPeriod.String(),
+		RetryAfter:         retryAfter,
+	}
+}
+
+func (rl *RateLimiter) writeRejection(ctx context.HTTPContext, u *URLRule) {
+	rej := u.newRejectionErr()
+	header := ctx.Response().Std().Header()
+	header.Set("Retry-After", strconv.Itoa(rej.RetryAfter))
+
+	name := rl.spec.RejectionEncoder
+	if name == "" {
+		name = defaultRejectionEncoder
+	}
+	contentType, body, err := rejectionEncoders[name](rej)
+	if err != nil {
+		logger.Errorf("encode rejection %#v by %s failed: %v", rej, name, err)
+		return
+	}
+
+	header.Set("Content-Type", contentType)
+	ctx.Response().SetBody(bytes.NewReader(body))
+}
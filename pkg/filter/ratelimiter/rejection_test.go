@@ -0,0 +1,142 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ratelimiter
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/tracing"
+)
+
+func newTestRateLimiter(spec *Spec) *RateLimiter {
+	spec.Policies = []*Policy{
+		{
+			Name:               "policy-example",
+			TimeoutDuration:    "0s",
+			LimitRefreshPeriod: "1500ms",
+			LimitForPeriod:     1,
+		},
+	}
+	spec.DefaultPolicyRef = "policy-example"
+	u := &URLRule{}
+	u.URL.Prefix = "/"
+	spec.URLs = []*URLRule{u}
+
+	rl := &RateLimiter{spec: spec}
+	u.Init()
+	rl.bindPolicyToURL(u)
+	u.createRateLimiter()
+
+	return rl
+}
+
+func handleTestRequest(rl *RateLimiter) (context.HTTPContext, string) {
+	req := httptest.NewRequest(http.MethodGet, "/pets/1", nil)
+	ctx := context.New(httptest.NewRecorder(), req, tracing.NoopTracing, "test")
+	return ctx, rl.handle(ctx)
+}
+
+func TestRejectionBody(t *testing.T) {
+	rl := newTestRateLimiter(&Spec{RejectionBody: true})
+
+	if _, result := handleTestRequest(rl); result != "" {
+		t.Fatalf("want permitted, got %s", result)
+	}
+
+	ctx, result := handleTestRequest(rl)
+	if result != resultRateLimited {
+		t.Fatalf("want %s, got %s", resultRateLimited, result)
+	}
+	if code := ctx.Response().StatusCode(); code != http.StatusTooManyRequests {
+		t.Fatalf("want %d, got %d", http.StatusTooManyRequests, code)
+	}
+
+	header := ctx.Response().Std().Header()
+	if got := header.Get("Retry-After"); got != "2" {
+		t.Errorf("want Retry-After 2, got %s", got)
+	}
+	if got := header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("want content type application/json, got %s", got)
+	}
+
+	body, err := ioutil.ReadAll(ctx.Response().Body())
+	if err != nil {
+		t.Fatalf("read body failed: %v", err)
+	}
+	rej := &RejectionErr{}
+	err = json.Unmarshal(body, rej)
+	if err != nil {
+		t.Fatalf("unmarshal %s failed: %v", body, err)
+	}
+	want := RejectionErr{
+		Code:               http.StatusTooManyRequests,
+		Message:            "too many requests",
+		Policy:             "policy-example",
+		LimitForPeriod:     1,
+		LimitRefreshPeriod: "1.5s",
+		RetryAfter:         2,
+	}
+	if *rej != want {
+		t.Errorf("want %+v, got %+v", want, *rej)
+	}
+}
+
+func TestRejectionWithoutBody(t *testing.T) {
+	rl := newTestRateLimiter(&Spec{})
+
+	handleTestRequest(rl)
+	ctx, result := handleTestRequest(rl)
+	if result != resultRateLimited {
+		t.Fatalf("want %s, got %s", resultRateLimited, result)
+	}
+	if ctx.Response().Body() != nil {
+		t.Errorf("want no body")
+	}
+	if got := ctx.Response().Std().Header().Get("Retry-After"); got != "" {
+		t.Errorf("want no Retry-After, got %s", got)
+	}
+}
+
+func TestCustomRejectionEncoder(t *testing.T) {
+	RegisterRejectionEncoder("test-plain", func(rej *RejectionErr) (string, []byte, error) {
+		return "text/plain", []byte(rej.Message), nil
+	})
+
+	spec := &Spec{RejectionBody: true, RejectionEncoder: "test-plain"}
+	rl := newTestRateLimiter(spec)
+	if err := spec.Validate(); err != nil {
+		t.Fatalf("validate failed: %v", err)
+	}
+
+	handleTestRequest(rl)
+	ctx, _ := handleTestRequest(rl)
+	body, _ := ioutil.ReadAll(ctx.Response().Body())
+	if string(body) != "too many requests" {
+		t.Errorf("want custom body, got %s", body)
+	}
+
+	spec.RejectionEncoder = "unknown"
+	if spec.Validate() == nil {
+		t.Errorf("want error for unregistered encoder")
+	}
+}
@@ -22,6 +22,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"math/rand"
+	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -29,6 +31,7 @@ import (
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/object/httppipeline"
 	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/httpheader"
 	"github.com/megaease/easegress/pkg/util/urlrule"
 )
 
@@ -58,6 +61,19 @@ type (
 		backOffPolicy        backOffPolicy
 		CountingNetworkError bool  `yaml:"countingNetworkError" jsonschema:"omitempty"`
 		FailureStatusCodes   []int `yaml:"failureStatusCodes" jsonschema:"omitempty,uniqueItems=true,format=httpcode-array"`
+		// RetryOnHeaders retries the responses with a matching header,
+		// even if the status code is not a failure one.
+		RetryOnHeaders []*HeaderRule `yaml:"retryOnHeaders" jsonschema:"omitempty"`
+		// MaxWaitDuration caps the delay in Retry-After.
+		MaxWaitDuration string `yaml:"maxWaitDuration" jsonschema:"omitempty,format=duration"`
+		maxWaitDuration time.Duration
+	}
+
+	// HeaderRule matches the response header, the value matches any
+	// value if it's empty.
+	HeaderRule struct {
+		Header string `yaml:"header" jsonschema:"required"`
+		Value  string `yaml:"value" jsonschema:"omitempty"`
 	}
 
 	URLRule struct {
@@ -156,6 +172,12 @@ func (r *Retryer) initURL(u *URLRule) {
 	} else {
 		u.policy.waitDuration = time.Millisecond * 500
 	}
+
+	if d := u.policy.MaxWaitDuration; d != "" {
+		u.policy.maxWaitDuration, _ = time.ParseDuration(d)
+	} else {
+		u.policy.maxWaitDuration = 30 * time.Second
+	}
 }
 
 // Init initializes Retryer.
@@ -173,14 +195,57 @@ func (r *Retryer) Inherit(pipeSpec *httppipeline.FilterSpec, previousGeneration
 	r.Init(pipeSpec, super)
 }
 
+// matchRetryHeaders returns whether the response header matches one of
+// retryOnHeaders, and the delay in its Retry-After if it's present.
+func (p *Policy) matchRetryHeaders(h *httpheader.HTTPHeader) (bool, time.Duration) {
+	for _, rule := range p.RetryOnHeaders {
+		matched := false
+		for _, v := range h.GetAll(rule.Header) {
+			if rule.Value == "" || v == rule.Value {
+				matched = true
+				break
+			}
+		}
+		if matched {
+			return true, parseRetryAfter(h.Get("Retry-After"))
+		}
+	}
+	return false, 0
+}
+
+// parseRetryAfter parses Retry-After in seconds or in HTTP date,
+// it returns 0 if the value is absent or invalid.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
 func (r *Retryer) handle(ctx context.HTTPContext, u *URLRule) string {
 	attempt := 0
 	base := float64(u.policy.waitDuration)
 
 	data, _ := ioutil.ReadAll(ctx.Request().Body())
+	// NOTE: The proxy adds the headers of the upstream response to the
+	// ones of the response, so the headers of the previous attempts are
+	// dropped to match only the latest upstream response.
+	header := ctx.Response().Header().Copy()
 	for {
 		attempt++
 		ctx.Request().SetBody(bytes.NewReader(data))
+		ctx.Response().Header().Reset(header.Copy().Std())
 
 		result := ctx.CallNextHandler("")
 
@@ -194,6 +259,10 @@ func (r *Retryer) handle(ctx context.HTTPContext, u *URLRule) string {
 				}
 			}
 		}
+		var retryAfter time.Duration
+		if !hasErr {
+			hasErr, retryAfter = u.policy.matchRetryHeaders(ctx.Response().Header())
+		}
 
 		if !hasErr {
 			ctx.AddTag(fmt.Sprintf("retryer: succeeded after %d attempts", attempt))
@@ -217,6 +286,13 @@ func (r *Retryer) handle(ctx context.HTTPContext, u *URLRule) string {
 
 		delta := base * u.policy.RandomizationFactor
 		d := base - delta + float64(rand.Intn(int(delta*2+1)))
+		// NOTE: The upstream asking for a retry tells the delay.
+		if retryAfter > 0 {
+			if retryAfter > u.policy.maxWaitDuration {
+				retryAfter = u.policy.maxWaitDuration
+			}
+			d = float64(retryAfter)
+		}
 		timer := time.NewTimer(time.Duration(d))
 
 		select {
@@ -0,0 +1,177 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package retryer
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/option"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+	"github.com/megaease/easegress/pkg/util/urlrule"
+)
+
+func TestMain(m *testing.M) {
+	tempDir, err := ioutil.TempDir("", "eg-retryer-test")
+	if err != nil {
+		panic(err)
+	}
+	absLogDir := filepath.Join(tempDir, "log")
+	os.MkdirAll(absLogDir, 0755)
+	logger.Init(&option.Options{
+		Name:      "retryer-for-log",
+		AbsLogDir: absLogDir,
+	})
+
+	code := m.Run()
+
+	logger.Sync()
+	os.RemoveAll(tempDir)
+
+	os.Exit(code)
+}
+
+func newTestFilter(t *testing.T, policy *Policy) *Retryer {
+	spec := &Spec{
+		Policies: []*Policy{policy},
+		URLs: []*URLRule{{
+			URLRule: urlrule.URLRule{
+				URL:       urlrule.StringMatch{Prefix: "/"},
+				PolicyRef: policy.Name,
+			},
+		}},
+	}
+	pipeSpec, err := httppipeline.NewFilterSpec(
+		&httppipeline.FilterMetaSpec{Name: "retryer", Kind: Kind}, spec)
+	if err != nil {
+		t.Fatalf("new filter spec failed: %v", err)
+	}
+
+	r := &Retryer{}
+	r.Init(pipeSpec, nil)
+	return r
+}
+
+// runRetryer runs the retryer with the next handler adding the headers
+// of the attempts like the proxy, it returns the number of the attempts.
+func runRetryer(r *Retryer, headers []http.Header) (int, context.HTTPContext) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	ctx := context.New(httptest.NewRecorder(), req, tracing.NoopTracing, "no trace")
+
+	attempts := 0
+	ctx.SetHandlerCaller(func(lastResult string) string {
+		ctx.Response().Header().AddFromStd(headers[attempts])
+		attempts++
+		return lastResult
+	})
+	r.Handle(ctx)
+
+	return attempts, ctx
+}
+
+func TestRetryOnHeaders(t *testing.T) {
+	r := newTestFilter(t, &Policy{
+		Name:            "policy",
+		MaxAttempts:     5,
+		WaitDuration:    "1ms",
+		BackOffPolicy:   "random",
+		MaxWaitDuration: "10ms",
+		RetryOnHeaders:  []*HeaderRule{{Header: "X-Retry", Value: "true"}},
+	})
+
+	// NOTE: The headers of the previous attempts must not match.
+	attempts, ctx := runRetryer(r, []http.Header{
+		{"X-Retry": {"true"}, "Retry-After": {"86400"}},
+		{"X-Retry": {"true"}, "Retry-After": {"1"}},
+		{"X-Upstream": {"third"}},
+		{"X-Retry": {"true"}},
+	})
+	if attempts != 3 {
+		t.Fatalf("want 3 attempts, got %d", attempts)
+	}
+	header := ctx.Response().Header()
+	if header.Get("X-Retry") != "" || header.Get("Retry-After") != "" {
+		t.Errorf("want headers of previous attempts dropped, got %v", header.Std())
+	}
+	if header.Get("X-Upstream") != "third" {
+		t.Errorf("want headers of the last attempt, got %v", header.Std())
+	}
+
+	attempts, _ = runRetryer(r, []http.Header{
+		{"X-Retry": {"true"}},
+		{"X-Retry": {"true"}},
+		{"X-Retry": {"true"}},
+		{"X-Retry": {"true"}},
+		{"X-Retry": {"true"}},
+	})
+	if attempts != 5 {
+		t.Fatalf("want 5 attempts, got %d", attempts)
+	}
+}
+
+func TestMatchRetryHeaders(t *testing.T) {
+	p := &Policy{RetryOnHeaders: []*HeaderRule{
+		{Header: "X-Retry", Value: "true"},
+		{Header: "Retry-After"},
+	}}
+
+	cases := []struct {
+		header  http.Header
+		matched bool
+		delay   time.Duration
+	}{
+		{http.Header{}, false, 0},
+		{http.Header{"X-Retry": {"false"}}, false, 0},
+		{http.Header{"X-Retry": {"false", "true"}}, true, 0},
+		{http.Header{"X-Retry": {"true"}, "Retry-After": {"2"}}, true, 2 * time.Second},
+		{http.Header{"Retry-After": {"5"}}, true, 5 * time.Second},
+		{http.Header{"Retry-After": {"soon"}}, true, 0},
+	}
+
+	for i, c := range cases {
+		matched, delay := p.matchRetryHeaders(httpheader.New(c.header))
+		if matched != c.matched || delay != c.delay {
+			t.Errorf("case %d: want (%v, %v), got (%v, %v)", i, c.matched, c.delay, matched, delay)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if d := parseRetryAfter("-1"); d != 0 {
+		t.Errorf("want 0 for negative seconds, got %v", d)
+	}
+
+	date := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	if d := parseRetryAfter(date); d <= 55*time.Second || d > time.Minute {
+		t.Errorf("want about 1m for %s, got %v", date, d)
+	}
+
+	date = time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)
+	if d := parseRetryAfter(date); d != 0 {
+		t.Errorf("want 0 for the past date, got %v", d)
+	}
+}
@@ -0,0 +1,421 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package saml
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	// Kind is the kind of SAMLAuth.
+	Kind = "SAMLAuth"
+
+	resultRedirected      = "redirected"
+	resultUnauthorized    = "unauthorized"
+	resultInvalidResponse = "invalidResponse"
+
+	defaultCookieName = "EG_SAML_SESSION"
+	defaultSessionTTL = 8 * time.Hour
+	defaultClockSkew  = time.Minute
+
+	// pendingRequestTTL is how long the user can take at the IdP.
+	pendingRequestTTL = 10 * time.Minute
+	// maxRelayStateSize is the limit of SAML bindings.
+	maxRelayStateSize = 80
+	maxACSBodySize    = 1024 * 1024
+)
+
+var results = []string{resultRedirected, resultUnauthorized, resultInvalidResponse}
+
+func init() {
+	httppipeline.Register(&SAMLAuth{})
+}
+
+type (
+	// SAMLAuth is filter SAMLAuth, the service provider of SAML 2.0 SSO.
+	SAMLAuth struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+
+		sp         *serviceProvider
+		acsPath    string
+		secure     bool
+		sessionTTL time.Duration
+		// headers are all the headers forwarded to the upstream.
+		headers []string
+	}
+
+	// Spec describes the SAMLAuth.
+	Spec struct {
+		EntityID string `yaml:"entityID" jsonschema:"required"`
+		// ACSURL is the assertion consumer service URL of the filter,
+		// the IdP posts the responses to it.
+		ACSURL         string `yaml:"acsURL" jsonschema:"required,format=uri"`
+		IdPSSOURL      string `yaml:"idpSSOURL" jsonschema:"required,format=uri"`
+		IdPEntityID    string `yaml:"idpEntityID" jsonschema:"omitempty"`
+		IdPCertificate string `yaml:"idpCertificate" jsonschema:"required"`
+
+		// AllowIdPInitiated accepts the unsolicited responses.
+		AllowIdPInitiated bool `yaml:"allowIdPInitiated" jsonschema:"omitempty"`
+
+		SessionSecret string `yaml:"sessionSecret" jsonschema:"required,minLength=32"`
+		CookieName    string `yaml:"cookieName" jsonschema:"omitempty"`
+		SessionTTL    string `yaml:"sessionTTL" jsonschema:"omitempty,format=duration"`
+		ClockSkew     string `yaml:"clockSkew" jsonschema:"omitempty,format=duration"`
+
+		NameIDHeader string `yaml:"nameIDHeader" jsonschema:"omitempty"`
+		// Attributes maps the names of the assertion attributes
+		// to the request headers.
+		Attributes map[string]string `yaml:"attributes" jsonschema:"omitempty"`
+	}
+)
+
+// Validate validates Spec.
+func (s Spec) Validate() error {
+	if _, err := parseCertificate(s.IdPCertificate); err != nil {
+		return err
+	}
+
+	u, err := url.Parse(s.ACSURL)
+	if err != nil || u.Path == "" {
+		return fmt.Errorf("invalid acsURL %s", s.ACSURL)
+	}
+
+	for _, d := range []string{s.SessionTTL, s.ClockSkew} {
+		if d == "" {
+			continue
+		}
+		if v, err := time.ParseDuration(d); err != nil || v < 0 {
+			return fmt.Errorf("invalid duration %s", d)
+		}
+	}
+
+	return nil
+}
+
+func parseCertificate(certPEM string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil {
+		return nil, fmt.Errorf("invalid idpCertificate: no PEM block")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid idpCertificate: %v", err)
+	}
+	return cert, nil
+}
+
+func parseDuration(s string, defaultValue time.Duration) time.Duration {
+	if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return d
+	}
+	return defaultValue
+}
+
+// Kind returns the kind of SAMLAuth.
+func (sa *SAMLAuth) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns default spec of SAMLAuth.
+func (sa *SAMLAuth) DefaultSpec() interface{} {
+	return &Spec{
+		CookieName: defaultCookieName,
+		SessionTTL: "8h",
+		ClockSkew:  "1m",
+	}
+}
+
+// Description returns the description of SAMLAuth.
+func (sa *SAMLAuth) Description() string {
+	return "SAMLAuth authenticates the requests by SAML 2.0 SSO as the service provider."
+}
+
+// Results returns the results of SAMLAuth.
+func (sa *SAMLAuth) Results() []string {
+	return results
+}
+
+// Init initializes SAMLAuth.
+func (sa *SAMLAuth) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	sa.pipeSpec, sa.spec, sa.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	sa.reload()
+}
+
+// Inherit inherits previous generation of SAMLAuth.
+func (sa *SAMLAuth) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	previousGeneration.Close()
+	sa.Init(pipeSpec, super)
+}
+
+func (sa *SAMLAuth) reload() {
+	// NOTE: The spec has been validated.
+	cert, _ := parseCertificate(sa.spec.IdPCertificate)
+	acsURL, _ := url.Parse(sa.spec.ACSURL)
+
+	sa.sp = &serviceProvider{
+		entityID:    sa.spec.EntityID,
+		acsURL:      sa.spec.ACSURL,
+		idpSSOURL:   sa.spec.IdPSSOURL,
+		idpEntityID: sa.spec.IdPEntityID,
+		idpCert:     cert,
+		clockSkew:   parseDuration(sa.spec.ClockSkew, defaultClockSkew),
+	}
+	sa.acsPath = acsURL.Path
+	sa.secure = acsURL.Scheme == "https"
+	sa.sessionTTL = parseDuration(sa.spec.SessionTTL, defaultSessionTTL)
+
+	if sa.spec.CookieName == "" {
+		sa.spec.CookieName = defaultCookieName
+	}
+
+	sa.headers = nil
+	if sa.spec.NameIDHeader != "" {
+		sa.headers = append(sa.headers, sa.spec.NameIDHeader)
+	}
+	for _, header := range sa.spec.Attributes {
+		sa.headers = append(sa.headers, header)
+	}
+}
+
+// Handle authenticates the request by the session cookie, the
+// unauthenticated GET requests are redirected to the IdP.
+func (sa *SAMLAuth) Handle(ctx context.HTTPContext) string {
+	result := sa.handle(ctx)
+	return ctx.CallNextHandler(result)
+}
+
+func (sa *SAMLAuth) handle(ctx context.HTTPContext) string {
+	req := ctx.Request()
+	if req.Path() == sa.acsPath {
+		return sa.handleACS(ctx)
+	}
+
+	// NOTE: Remove the headers from the client to avoid spoofing.
+	for _, header := range sa.headers {
+		req.Header().Del(header)
+	}
+
+	if s, ok := sa.session(req); ok {
+		if sa.spec.NameIDHeader != "" {
+			req.Header().Set(sa.spec.NameIDHeader, s.NameID)
+		}
+		for name, header := range sa.spec.Attributes {
+			if values := s.Attributes[name]; len(values) > 0 {
+				req.Header().Set(header, strings.Join(values, ","))
+			}
+		}
+		if s.NameID != "" {
+			ctx.Set(context.VarAuthenticatedUser, s.NameID)
+		}
+		return ""
+	}
+
+	if req.Method() != http.MethodGet && req.Method() != http.MethodHead {
+		ctx.Response().SetStatusCode(http.StatusUnauthorized)
+		return resultUnauthorized
+	}
+
+	return sa.redirectToIdP(ctx)
+}
+
+func (sa *SAMLAuth) session(req context.HTTPRequest) (*session, bool) {
+	cookie, err := req.Cookie(sa.spec.CookieName)
+	if err != nil {
+		return nil, false
+	}
+
+	s := &session{}
+	if err := decodeCookie([]byte(sa.spec.SessionSecret), cookie.Value, s); err != nil {
+		return nil, false
+	}
+	if time.Now().Unix() >= s.Expires {
+		return nil, false
+	}
+
+	return s, true
+}
+
+func (sa *SAMLAuth) redirectToIdP(ctx context.HTTPContext) string {
+	now := time.Now()
+	id := newRequestID()
+
+	// NOTE: The RelayState brings the user back after login.
+	relayState := ctx.Request().Std().URL.RequestURI()
+	if len(relayState) > maxRelayStateSize {
+		relayState = ctx.Request().Path()
+		if len(relayState) > maxRelayStateSize {
+			relayState = "/"
+		}
+	}
+
+	location, err := sa.sp.authnRequestURL(id, relayState, now)
+	if err == nil {
+		var value string
+		value, err = encodeCookie([]byte(sa.spec.SessionSecret), &pendingRequest{
+			ID:      id,
+			Expires: now.Add(pendingRequestTTL).Unix(),
+		})
+		if err == nil {
+			sa.setCookie(ctx, sa.requestCookieName(), value, sa.acsPath, pendingRequestTTL)
+		}
+	}
+	if err != nil {
+		logger.Errorf("%s: build authn request failed: %v", sa.pipeSpec.Name(), err)
+		ctx.Response().SetStatusCode(http.StatusInternalServerError)
+		return resultUnauthorized
+	}
+
+	ctx.Response().Header().Set("Location", location)
+	ctx.Response().SetStatusCode(http.StatusFound)
+	return resultRedirected
+}
+
+func (sa *SAMLAuth) requestCookieName() string {
+	return sa.spec.CookieName + "_REQUEST"
+}
+
+func (sa *SAMLAuth) setCookie(ctx context.HTTPContext, name, value, path string, ttl time.Duration) {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		HttpOnly: true,
+		Secure:   sa.secure,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if ttl < 0 {
+		cookie.MaxAge = -1
+	} else {
+		cookie.MaxAge = int(ttl / time.Second)
+	}
+	// NOTE: The IdP posts to the ACS cross-site, the request
+	// cookie is sent only with SameSite=None, which requires Secure.
+	if name == sa.requestCookieName() && sa.secure {
+		cookie.SameSite = http.SameSiteNoneMode
+	}
+	ctx.Response().SetCookie(cookie)
+}
+
+func (sa *SAMLAuth) handleACS(ctx context.HTTPContext) string {
+	req := ctx.Request()
+	if req.Method() != http.MethodPost {
+		ctx.Response().SetStatusCode(http.StatusMethodNotAllowed)
+		return resultInvalidResponse
+	}
+
+	fail := func(err error) string {
+		logger.Warnf("%s: invalid SAML response: %v", sa.pipeSpec.Name(), err)
+		ctx.AddTag(fmt.Sprintf("invalid SAML response: %v", err))
+		ctx.Response().SetStatusCode(http.StatusForbidden)
+		return resultInvalidResponse
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(req.Body(), maxACSBodySize))
+	if err != nil {
+		return fail(err)
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return fail(err)
+	}
+	data, err := base64.StdEncoding.DecodeString(form.Get("SAMLResponse"))
+	if err != nil || len(data) == 0 {
+		return fail(fmt.Errorf("invalid SAMLResponse"))
+	}
+
+	now := time.Now()
+	a, err := sa.sp.parseResponse(data, now)
+	if err != nil {
+		return fail(err)
+	}
+
+	if a.InResponseTo == "" {
+		if !sa.spec.AllowIdPInitiated {
+			return fail(fmt.Errorf("IdP-initiated login is not allowed"))
+		}
+	} else {
+		pending := &pendingRequest{}
+		cookie, err := req.Cookie(sa.requestCookieName())
+		if err == nil {
+			err = decodeCookie([]byte(sa.spec.SessionSecret), cookie.Value, pending)
+		}
+		if err != nil || now.Unix() >= pending.Expires || pending.ID != a.InResponseTo {
+			return fail(fmt.Errorf("response to unknown request %s", a.InResponseTo))
+		}
+		sa.setCookie(ctx, sa.requestCookieName(), "", sa.acsPath, -1)
+	}
+
+	expires := now.Add(sa.sessionTTL)
+	if !a.SessionNotOnOrAfter.IsZero() && a.SessionNotOnOrAfter.Before(expires) {
+		expires = a.SessionNotOnOrAfter
+	}
+	s := &session{NameID: a.NameID, Expires: expires.Unix()}
+	for name := range sa.spec.Attributes {
+		if values, exists := a.Attributes[name]; exists {
+			if s.Attributes == nil {
+				s.Attributes = make(map[string][]string)
+			}
+			s.Attributes[name] = values
+		}
+	}
+	value, err := encodeCookie([]byte(sa.spec.SessionSecret), s)
+	if err != nil {
+		return fail(err)
+	}
+	sa.setCookie(ctx, sa.spec.CookieName, value, "/", expires.Sub(now))
+
+	logger.Infof("%s: %s logged in", sa.pipeSpec.Name(), a.NameID)
+
+	ctx.Response().Header().Set("Location", localPath(form.Get("RelayState")))
+	ctx.Response().SetStatusCode(http.StatusFound)
+	return resultRedirected
+}
+
+// localPath returns the relay state if it's a local path,
+// to avoid the open redirection.
+func localPath(relayState string) string {
+	if !strings.HasPrefix(relayState, "/") || strings.HasPrefix(relayState, "//") ||
+		strings.HasPrefix(relayState, "/\\") {
+		return "/"
+	}
+	return relayState
+}
+
+// Status returns status.
+func (sa *SAMLAuth) Status() interface{} { return nil }
+
+// Close closes SAMLAuth.
+func (sa *SAMLAuth) Close() {}
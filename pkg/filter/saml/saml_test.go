@@ -0,0 +1,339 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/option"
+	"github.com/megaease/easegress/pkg/tracing"
+)
+
+const (
+	testACSURL    = "https://gw.example.com/saml/acs"
+	testEntityID  = "https://gw.example.com/saml"
+	testIdPEntity = "https://idp.example.com"
+)
+
+func TestMain(m *testing.M) {
+	tempDir, err := ioutil.TempDir("", "eg-saml-test")
+	if err != nil {
+		panic(err)
+	}
+	absLogDir := filepath.Join(tempDir, "log")
+	os.MkdirAll(absLogDir, 0755)
+	logger.Init(&option.Options{
+		Name:      "saml-for-log",
+		AbsLogDir: absLogDir,
+	})
+
+	code := m.Run()
+
+	logger.Sync()
+	os.RemoveAll(tempDir)
+
+	os.Exit(code)
+}
+
+type testIdP struct {
+	key     *rsa.PrivateKey
+	certPEM string
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key failed: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate failed: %v", err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	return &testIdP{key: key, certPEM: string(certPEM)}
+}
+
+// sign replaces the placeholder <!--sig--> in the element of the id
+// with its enveloped signature.
+func (idp *testIdP) sign(t *testing.T, doc, id string) string {
+	root, err := parseXML([]byte(doc))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	var el *xmlNode
+	root.walk(func(n *xmlNode) {
+		if n.attr("ID") == id {
+			el = n
+		}
+	})
+
+	// NOTE: The comment placeholder is omitted by the canonicalization.
+	digest := sha256.Sum256(canonicalize(el, nil, nil))
+	signedInfo := fmt.Sprintf(`<ds:SignedInfo>`+
+		`<ds:CanonicalizationMethod Algorithm="%s"/>`+
+		`<ds:SignatureMethod Algorithm="%s"/>`+
+		`<ds:Reference URI="#%s"><ds:Transforms>`+
+		`<ds:Transform Algorithm="%s"/><ds:Transform Algorithm="%s"/>`+
+		`</ds:Transforms><ds:DigestMethod Algorithm="%s"/>`+
+		`<ds:DigestValue>%s</ds:DigestValue></ds:Reference></ds:SignedInfo>`,
+		algExcC14N, algRSASHA256, id, algEnveloped, algExcC14N, algSHA256,
+		base64.StdEncoding.EncodeToString(digest[:]))
+
+	sig, _ := parseXML([]byte(`<ds:Signature xmlns:ds="` + nsDSig + `">` + signedInfo + `</ds:Signature>`))
+	hashed := sha256.Sum256(canonicalize(sig.element(nsDSig, "SignedInfo"), nil, nil))
+	value, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, hashed[:])
+	if err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+
+	signature := `<ds:Signature xmlns:ds="` + nsDSig + `">` + signedInfo +
+		`<ds:SignatureValue>` + base64.StdEncoding.EncodeToString(value) + `</ds:SignatureValue></ds:Signature>`
+	return strings.Replace(doc, "<!--sig:"+id+"-->", signature, 1)
+}
+
+type testResponse struct {
+	inResponseTo string
+	audience     string
+	notOnOrAfter time.Time
+}
+
+func (r *testResponse) xml() string {
+	inResponseTo := ""
+	if r.inResponseTo != "" {
+		inResponseTo = fmt.Sprintf(` InResponseTo="%s"`, r.inResponseTo)
+	}
+	if r.audience == "" {
+		r.audience = testEntityID
+	}
+	if r.notOnOrAfter.IsZero() {
+		r.notOnOrAfter = time.Now().Add(5 * time.Minute)
+	}
+	now := time.Now().UTC().Format(samlTimeFormat)
+	notOnOrAfter := r.notOnOrAfter.UTC().Format(samlTimeFormat)
+
+	return fmt.Sprintf(`<samlp:Response xmlns:samlp="%[1]s" ID="_r1" Version="2.0" IssueInstant="%[3]s" Destination="%[4]s"%[5]s>
+<saml:Issuer xmlns:saml="%[2]s">%[6]s</saml:Issuer>
+<samlp:Status><samlp:StatusCode Value="%[7]s"/></samlp:Status>
+<saml:Assertion xmlns:saml="%[2]s" ID="_a1" Version="2.0" IssueInstant="%[3]s">
+<saml:Issuer>%[6]s</saml:Issuer><!--sig:_a1-->
+<saml:Subject><saml:NameID>alice@example.com</saml:NameID>
+<saml:SubjectConfirmation Method="%[8]s"><saml:SubjectConfirmationData Recipient="%[4]s" NotOnOrAfter="%[9]s"%[5]s/></saml:SubjectConfirmation>
+</saml:Subject>
+<saml:Conditions NotBefore="%[3]s" NotOnOrAfter="%[9]s"><saml:AudienceRestriction><saml:Audience>%[10]s</saml:Audience></saml:AudienceRestriction></saml:Conditions>
+<saml:AuthnStatement AuthnInstant="%[3]s"/>
+<saml:AttributeStatement>
+<saml:Attribute Name="email"><saml:AttributeValue>alice@example.com</saml:AttributeValue></saml:Attribute>
+<saml:Attribute Name="groups"><saml:AttributeValue>dev</saml:AttributeValue><saml:AttributeValue>ops</saml:AttributeValue></saml:Attribute>
+</saml:AttributeStatement>
+</saml:Assertion>
+</samlp:Response>`, nsProtocol, nsAssertion, now, testACSURL, inResponseTo, testIdPEntity,
+		statusSuccess, methodBearer, notOnOrAfter, r.audience)
+}
+
+func newTestFilter(t *testing.T, idp *testIdP, allowIdPInitiated bool) *SAMLAuth {
+	spec := &Spec{
+		EntityID:          testEntityID,
+		ACSURL:            testACSURL,
+		IdPSSOURL:         "https://idp.example.com/sso",
+		IdPEntityID:       testIdPEntity,
+		IdPCertificate:    idp.certPEM,
+		AllowIdPInitiated: allowIdPInitiated,
+		SessionSecret:     "0123456789abcdef0123456789abcdef",
+		NameIDHeader:      "X-User",
+		Attributes:        map[string]string{"groups": "X-Groups"},
+	}
+	if err := spec.Validate(); err != nil {
+		t.Fatalf("want valid spec, got %v", err)
+	}
+	pipeSpec, err := httppipeline.NewFilterSpec(
+		&httppipeline.FilterMetaSpec{Name: "saml", Kind: Kind}, spec)
+	if err != nil {
+		t.Fatalf("new filter spec failed: %v", err)
+	}
+
+	sa := &SAMLAuth{}
+	sa.Init(pipeSpec, nil)
+	return sa
+}
+
+func newTestContext(method, target, body string, header map[string]string) context.HTTPContext {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	return context.New(httptest.NewRecorder(), req, tracing.NoopTracing, "no trace")
+}
+
+func responseCookies(ctx context.HTTPContext) map[string]*http.Cookie {
+	resp := &http.Response{Header: ctx.Response().Header().Std()}
+	cookies := map[string]*http.Cookie{}
+	for _, c := range resp.Cookies() {
+		cookies[c.Name] = c
+	}
+	return cookies
+}
+
+func postACS(sa *SAMLAuth, response, relayState, cookie string) context.HTTPContext {
+	form := url.Values{}
+	form.Set("SAMLResponse", base64.StdEncoding.EncodeToString([]byte(response)))
+	form.Set("RelayState", relayState)
+	header := map[string]string{"Content-Type": "application/x-www-form-urlencoded"}
+	if cookie != "" {
+		header["Cookie"] = cookie
+	}
+	ctx := newTestContext(http.MethodPost, "/saml/acs", form.Encode(), header)
+	sa.handle(ctx)
+	return ctx
+}
+
+func TestSPInitiatedLogin(t *testing.T) {
+	idp := newTestIdP(t)
+	sa := newTestFilter(t, idp, false)
+
+	ctx := newTestContext(http.MethodGet, "/app?x=1", "", nil)
+	if result := sa.handle(ctx); result != resultRedirected {
+		t.Fatalf("want %s, got %q", resultRedirected, result)
+	}
+	location, _ := url.Parse(ctx.Response().Header().Get("Location"))
+	if location.Host != "idp.example.com" || location.Query().Get("RelayState") != "/app?x=1" {
+		t.Fatalf("unexpected location %s", location)
+	}
+	deflated, _ := base64.StdEncoding.DecodeString(location.Query().Get("SAMLRequest"))
+	request, _ := ioutil.ReadAll(flate.NewReader(bytes.NewReader(deflated)))
+	authnRequest, err := parseXML(request)
+	if err != nil || !authnRequest.is(nsProtocol, "AuthnRequest") ||
+		authnRequest.attr("AssertionConsumerServiceURL") != testACSURL {
+		t.Fatalf("unexpected authn request %s", request)
+	}
+	requestCookie := responseCookies(ctx)[sa.requestCookieName()]
+	if requestCookie == nil || requestCookie.SameSite != http.SameSiteNoneMode || !requestCookie.Secure {
+		t.Fatalf("want secure request cookie, got %v", requestCookie)
+	}
+
+	id := authnRequest.attr("ID")
+	response := idp.sign(t, (&testResponse{inResponseTo: id}).xml(), "_a1")
+
+	// NOTE: The response must come with the request cookie.
+	ctx = postACS(sa, response, "/app?x=1", "")
+	if code := ctx.Response().StatusCode(); code != http.StatusForbidden {
+		t.Fatalf("want %d without request cookie, got %d", http.StatusForbidden, code)
+	}
+
+	ctx = postACS(sa, response, "/app?x=1", requestCookie.Name+"="+requestCookie.Value)
+	if code := ctx.Response().StatusCode(); code != http.StatusFound {
+		t.Fatalf("want %d, got %d", http.StatusFound, code)
+	}
+	if location := ctx.Response().Header().Get("Location"); location != "/app?x=1" {
+		t.Errorf("want redirected back to /app?x=1, got %s", location)
+	}
+	sessionCookie := responseCookies(ctx)[defaultCookieName]
+	if sessionCookie == nil {
+		t.Fatalf("want session cookie")
+	}
+
+	ctx = newTestContext(http.MethodPost, "/app", "", map[string]string{
+		"Cookie":   sessionCookie.Name + "=" + sessionCookie.Value,
+		"X-Groups": "admin",
+	})
+	if result := sa.handle(ctx); result != "" {
+		t.Fatalf("want authenticated, got %q", result)
+	}
+	header := ctx.Request().Header()
+	if header.Get("X-User") != "alice@example.com" || header.Get("X-Groups") != "dev,ops" {
+		t.Errorf("unexpected headers %s", header.Dump())
+	}
+	if user, _ := ctx.Get(context.VarAuthenticatedUser); user != "alice@example.com" {
+		t.Errorf("want authenticated user alice@example.com, got %v", user)
+	}
+
+	// NOTE: The forged cookie is refused.
+	ctx = newTestContext(http.MethodPost, "/app", "", map[string]string{
+		"Cookie": sessionCookie.Name + "=" + sessionCookie.Value + "x",
+	})
+	if result := sa.handle(ctx); result != resultUnauthorized {
+		t.Errorf("want %s, got %q", resultUnauthorized, result)
+	}
+}
+
+func TestIdPInitiatedLogin(t *testing.T) {
+	idp := newTestIdP(t)
+	response := idp.sign(t, (&testResponse{}).xml(), "_a1")
+
+	ctx := postACS(newTestFilter(t, idp, false), response, "/", "")
+	if code := ctx.Response().StatusCode(); code != http.StatusForbidden {
+		t.Errorf("want %d for disallowed IdP-initiated login, got %d", http.StatusForbidden, code)
+	}
+
+	ctx = postACS(newTestFilter(t, idp, true), response, "https://evil.example.com", "")
+	if code := ctx.Response().StatusCode(); code != http.StatusFound {
+		t.Fatalf("want %d, got %d", http.StatusFound, code)
+	}
+	if location := ctx.Response().Header().Get("Location"); location != "/" {
+		t.Errorf("want redirected to /, got %s", location)
+	}
+}
+
+func TestInvalidResponse(t *testing.T) {
+	idp := newTestIdP(t)
+	sa := newTestFilter(t, idp, true)
+
+	signed := idp.sign(t, (&testResponse{}).xml(), "_a1")
+	for name, response := range map[string]string{
+		"unsigned":       (&testResponse{}).xml(),
+		"tampered":       strings.Replace(signed, ">ops<", ">admin<", 1),
+		"wrong audience": idp.sign(t, (&testResponse{audience: "https://other.example.com"}).xml(), "_a1"),
+		"expired":        idp.sign(t, (&testResponse{notOnOrAfter: time.Now().Add(-time.Hour)}).xml(), "_a1"),
+		"other signer":   newTestIdP(t).sign(t, (&testResponse{}).xml(), "_a1"),
+		"wrapped": strings.Replace(signed, "</samlp:Response>",
+			`<saml:Assertion xmlns:saml="`+nsAssertion+`" ID="_a2"></saml:Assertion></samlp:Response>`, 1),
+	} {
+		ctx := postACS(sa, response, "/", "")
+		if code := ctx.Response().StatusCode(); code != http.StatusForbidden {
+			t.Errorf("%s: want %d, got %d", name, http.StatusForbidden, code)
+		}
+	}
+}
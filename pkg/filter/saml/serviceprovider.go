@@ -0,0 +1,343 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	nsProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	nsAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+
+	statusSuccess       = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	methodBearer        = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+	bindingHTTPPost     = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	samlTimeFormat      = "2006-01-02T15:04:05Z"
+	requestIDRandomSize = 16
+)
+
+type (
+	// serviceProvider validates the responses of the IdP.
+	serviceProvider struct {
+		entityID    string
+		acsURL      string
+		idpSSOURL   string
+		idpEntityID string
+		idpCert     *x509.Certificate
+		clockSkew   time.Duration
+	}
+
+	// assertion is the information extracted from a valid response.
+	assertion struct {
+		NameID     string
+		Attributes map[string][]string
+		// InResponseTo is empty for the IdP-initiated flow.
+		InResponseTo string
+		// SessionNotOnOrAfter is zero if the IdP doesn't limit the session.
+		SessionNotOnOrAfter time.Time
+	}
+
+	// session is stored in the session cookie.
+	session struct {
+		NameID     string              `json:"n"`
+		Attributes map[string][]string `json:"a,omitempty"`
+		Expires    int64               `json:"e"`
+	}
+
+	// pendingRequest is stored in the request cookie
+	// during the SP-initiated flow.
+	pendingRequest struct {
+		ID      string `json:"i"`
+		Expires int64  `json:"e"`
+	}
+)
+
+func newRequestID() string {
+	buff := make([]byte, requestIDRandomSize)
+	rand.Read(buff)
+	// NOTE: The ID must not start with a digit.
+	return "_" + hex.EncodeToString(buff)
+}
+
+// authnRequestURL returns the URL of the IdP redirecting binding.
+func (sp *serviceProvider) authnRequestURL(id, relayState string, now time.Time) (string, error) {
+	request := fmt.Sprintf(`<samlp:AuthnRequest xmlns:samlp="%s" xmlns:saml="%s" ID="%s" Version="2.0" `+
+		`IssueInstant="%s" Destination="%s" AssertionConsumerServiceURL="%s" ProtocolBinding="%s">`+
+		`<saml:Issuer>%s</saml:Issuer><samlp:NameIDPolicy AllowCreate="true"/></samlp:AuthnRequest>`,
+		nsProtocol, nsAssertion, id, now.UTC().Format(samlTimeFormat), escapeAttr(sp.idpSSOURL),
+		escapeAttr(sp.acsURL), bindingHTTPPost, escapeText(sp.entityID))
+
+	buff := &bytes.Buffer{}
+	w, _ := flate.NewWriter(buff, flate.DefaultCompression)
+	w.Write([]byte(request))
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("SAMLRequest", base64.StdEncoding.EncodeToString(buff.Bytes()))
+	if relayState != "" {
+		query.Set("RelayState", relayState)
+	}
+
+	sep := "?"
+	if strings.Contains(sp.idpSSOURL, "?") {
+		sep = "&"
+	}
+	return sp.idpSSOURL + sep + query.Encode(), nil
+}
+
+// parseResponse validates the SAML response posted to the ACS. At least
+// one of the response and the assertion must be signed, and only the
+// signed elements are read to avoid the signature wrapping attacks.
+func (sp *serviceProvider) parseResponse(data []byte, now time.Time) (*assertion, error) {
+	root, err := parseXML(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse response failed: %v", err)
+	}
+	if !root.is(nsProtocol, "Response") {
+		return nil, fmt.Errorf("not a SAML response")
+	}
+
+	ids := map[string]bool{}
+	duplicated := false
+	root.walk(func(n *xmlNode) {
+		if id := n.attr("ID"); id != "" {
+			duplicated = duplicated || ids[id]
+			ids[id] = true
+		}
+	})
+	if duplicated {
+		return nil, fmt.Errorf("duplicated IDs")
+	}
+
+	if dest := root.attr("Destination"); dest != "" && dest != sp.acsURL {
+		return nil, fmt.Errorf("unexpected destination %s", dest)
+	}
+	if err := sp.checkIssuer(root, false); err != nil {
+		return nil, err
+	}
+
+	status := root.element(nsProtocol, "Status")
+	if status == nil || status.element(nsProtocol, "StatusCode") == nil {
+		return nil, fmt.Errorf("no status")
+	}
+	if code := status.element(nsProtocol, "StatusCode").attr("Value"); code != statusSuccess {
+		return nil, fmt.Errorf("status %s", code)
+	}
+
+	if len(root.elements(nsAssertion, "EncryptedAssertion")) > 0 {
+		return nil, fmt.Errorf("encrypted assertion is not supported")
+	}
+	assertions := root.elements(nsAssertion, "Assertion")
+	if len(assertions) != 1 {
+		return nil, fmt.Errorf("exactly one assertion is required")
+	}
+	a := assertions[0]
+
+	responseErr := verifySignature(root, sp.idpCert)
+	if responseErr != nil && responseErr != errNotSigned {
+		return nil, fmt.Errorf("response: %v", responseErr)
+	}
+	assertionErr := verifySignature(a, sp.idpCert)
+	if assertionErr != nil && assertionErr != errNotSigned {
+		return nil, fmt.Errorf("assertion: %v", assertionErr)
+	}
+	if responseErr == errNotSigned && assertionErr == errNotSigned {
+		return nil, fmt.Errorf("neither response nor assertion is signed")
+	}
+
+	return sp.parseAssertion(a, root.attr("InResponseTo"), now)
+}
+
+func (sp *serviceProvider) checkIssuer(n *xmlNode, required bool) error {
+	if sp.idpEntityID == "" {
+		return nil
+	}
+
+	issuer := n.element(nsAssertion, "Issuer")
+	if issuer == nil {
+		if required {
+			return fmt.Errorf("no issuer")
+		}
+		return nil
+	}
+	if issuer.text() != sp.idpEntityID {
+		return fmt.Errorf("unexpected issuer %s", issuer.text())
+	}
+	return nil
+}
+
+func (sp *serviceProvider) parseAssertion(a *xmlNode, inResponseTo string, now time.Time) (*assertion, error) {
+	if err := sp.checkIssuer(a, true); err != nil {
+		return nil, err
+	}
+
+	result := &assertion{
+		Attributes:   map[string][]string{},
+		InResponseTo: inResponseTo,
+	}
+
+	subject := a.element(nsAssertion, "Subject")
+	if subject == nil {
+		return nil, fmt.Errorf("no subject")
+	}
+	if nameID := subject.element(nsAssertion, "NameID"); nameID != nil {
+		result.NameID = nameID.text()
+	}
+
+	confirmed := false
+	for _, sc := range subject.elements(nsAssertion, "SubjectConfirmation") {
+		if sc.attr("Method") != methodBearer {
+			continue
+		}
+		data := sc.element(nsAssertion, "SubjectConfirmationData")
+		if data == nil {
+			continue
+		}
+		if recipient := data.attr("Recipient"); recipient != "" && recipient != sp.acsURL {
+			continue
+		}
+		if notOnOrAfter, err := parseTime(data.attr("NotOnOrAfter")); err != nil ||
+			!notOnOrAfter.IsZero() && !now.Before(notOnOrAfter.Add(sp.clockSkew)) {
+			continue
+		}
+		if id := data.attr("InResponseTo"); id != "" {
+			if result.InResponseTo != "" && result.InResponseTo != id {
+				continue
+			}
+			result.InResponseTo = id
+		}
+		confirmed = true
+		break
+	}
+	if !confirmed {
+		return nil, fmt.Errorf("no valid bearer subject confirmation")
+	}
+
+	if conditions := a.element(nsAssertion, "Conditions"); conditions != nil {
+		notBefore, err := parseTime(conditions.attr("NotBefore"))
+		if err != nil {
+			return nil, err
+		}
+		if !notBefore.IsZero() && now.Add(sp.clockSkew).Before(notBefore) {
+			return nil, fmt.Errorf("assertion is not yet valid")
+		}
+		notOnOrAfter, err := parseTime(conditions.attr("NotOnOrAfter"))
+		if err != nil {
+			return nil, err
+		}
+		if !notOnOrAfter.IsZero() && !now.Before(notOnOrAfter.Add(sp.clockSkew)) {
+			return nil, fmt.Errorf("assertion expired")
+		}
+
+		for _, ar := range conditions.elements(nsAssertion, "AudienceRestriction") {
+			matched := false
+			for _, audience := range ar.elements(nsAssertion, "Audience") {
+				matched = matched || audience.text() == sp.entityID
+			}
+			if !matched {
+				return nil, fmt.Errorf("audience mismatched")
+			}
+		}
+	}
+
+	if authn := a.element(nsAssertion, "AuthnStatement"); authn != nil {
+		sessionNotOnOrAfter, err := parseTime(authn.attr("SessionNotOnOrAfter"))
+		if err != nil {
+			return nil, err
+		}
+		result.SessionNotOnOrAfter = sessionNotOnOrAfter
+	}
+
+	for _, as := range a.elements(nsAssertion, "AttributeStatement") {
+		for _, attr := range as.elements(nsAssertion, "Attribute") {
+			var values []string
+			for _, v := range attr.elements(nsAssertion, "AttributeValue") {
+				values = append(values, v.text())
+			}
+			for _, name := range []string{attr.attr("Name"), attr.attr("FriendlyName")} {
+				if name != "" {
+					result.Attributes[name] = append(result.Attributes[name], values...)
+				}
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %s", s)
+	}
+	return t, nil
+}
+
+// encodeCookie signs the value by HMAC-SHA256.
+func encodeCookie(key []byte, v interface{}) (string, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+func decodeCookie(key []byte, value string, v interface{}) error {
+	parts := strings.Split(value, ".")
+	if len(parts) != 2 {
+		return fmt.Errorf("malformed cookie")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return fmt.Errorf("malformed cookie")
+	}
+	sum, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return fmt.Errorf("malformed cookie")
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	if !hmac.Equal(sum, mac.Sum(nil)) {
+		return fmt.Errorf("invalid cookie signature")
+	}
+
+	return json.Unmarshal(payload, v)
+}
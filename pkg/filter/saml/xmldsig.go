@@ -0,0 +1,469 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package saml
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	// Register the hash functions of the signature algorithms.
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+)
+
+const (
+	nsXML     = "http://www.w3.org/XML/1998/namespace"
+	nsDSig    = "http://www.w3.org/2000/09/xmldsig#"
+	nsExcC14N = "http://www.w3.org/2001/10/xml-exc-c14n#"
+
+	algExcC14N   = nsExcC14N
+	algEnveloped = nsDSig + "enveloped-signature"
+	algRSASHA1   = nsDSig + "rsa-sha1"
+	algRSASHA256 = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	algSHA1      = nsDSig + "sha1"
+	algSHA256    = "http://www.w3.org/2001/04/xmlenc#sha256"
+)
+
+var (
+	signatureHashes = map[string]crypto.Hash{
+		algRSASHA1:   crypto.SHA1,
+		algRSASHA256: crypto.SHA256,
+	}
+	digestHashes = map[string]crypto.Hash{
+		algSHA1:   crypto.SHA1,
+		algSHA256: crypto.SHA256,
+	}
+
+	errNotSigned = fmt.Errorf("not signed")
+)
+
+// xmlNode is an element keeping the namespace prefixes,
+// which are required by the canonicalization.
+type xmlNode struct {
+	parent *xmlNode
+
+	prefix string
+	local  string
+	// attrs are the attributes except the namespace declarations,
+	// their Name.Space are the prefixes.
+	attrs []xml.Attr
+	// nsDecls are keyed by the prefixes, the default one is "".
+	nsDecls map[string]string
+	// children are *xmlNode, xml.CharData and xml.ProcInst.
+	children []interface{}
+}
+
+// parseXML parses the document, DTDs are refused to
+// avoid the entity expansion attacks.
+func parseXML(data []byte) (*xmlNode, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+
+	var root, current *xmlNode
+	for {
+		token, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if current == nil && root != nil {
+				return nil, fmt.Errorf("multiple root elements")
+			}
+			n := &xmlNode{
+				parent: current,
+				prefix: t.Name.Space,
+				local:  t.Name.Local,
+			}
+			for _, a := range t.Attr {
+				switch {
+				case a.Name.Space == "" && a.Name.Local == "xmlns":
+					n.declare("", a.Value)
+				case a.Name.Space == "xmlns":
+					n.declare(a.Name.Local, a.Value)
+				default:
+					n.attrs = append(n.attrs, a)
+				}
+			}
+			if current == nil {
+				root = n
+			} else {
+				current.children = append(current.children, n)
+			}
+			current = n
+		case xml.EndElement:
+			if current == nil || current.prefix != t.Name.Space || current.local != t.Name.Local {
+				return nil, fmt.Errorf("unexpected end element %s", t.Name.Local)
+			}
+			current = current.parent
+		case xml.CharData:
+			if current != nil {
+				current.children = append(current.children, t.Copy())
+			}
+		case xml.ProcInst:
+			if current != nil {
+				current.children = append(current.children, t.Copy())
+			}
+		case xml.Directive:
+			return nil, fmt.Errorf("DTD is not allowed")
+		}
+	}
+
+	if root == nil || current != nil {
+		return nil, fmt.Errorf("incomplete document")
+	}
+
+	return root, nil
+}
+
+func (n *xmlNode) declare(prefix, uri string) {
+	if n.nsDecls == nil {
+		n.nsDecls = make(map[string]string)
+	}
+	n.nsDecls[prefix] = uri
+}
+
+// lookupNS returns the namespace of the prefix in scope.
+func (n *xmlNode) lookupNS(prefix string) (string, bool) {
+	if prefix == "xml" {
+		return nsXML, true
+	}
+	for ; n != nil; n = n.parent {
+		if uri, exists := n.nsDecls[prefix]; exists {
+			return uri, true
+		}
+	}
+	return "", false
+}
+
+func (n *xmlNode) is(space, local string) bool {
+	uri, _ := n.lookupNS(n.prefix)
+	return uri == space && n.local == local
+}
+
+func (n *xmlNode) elements(space, local string) []*xmlNode {
+	var elements []*xmlNode
+	for _, child := range n.children {
+		if c, ok := child.(*xmlNode); ok && c.is(space, local) {
+			elements = append(elements, c)
+		}
+	}
+	return elements
+}
+
+func (n *xmlNode) element(space, local string) *xmlNode {
+	if elements := n.elements(space, local); len(elements) > 0 {
+		return elements[0]
+	}
+	return nil
+}
+
+// attr returns the value of the unqualified attribute.
+func (n *xmlNode) attr(local string) string {
+	for _, a := range n.attrs {
+		if a.Name.Space == "" && a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func (n *xmlNode) text() string {
+	var text strings.Builder
+	for _, child := range n.children {
+		if c, ok := child.(xml.CharData); ok {
+			text.Write(c)
+		}
+	}
+	return strings.TrimSpace(text.String())
+}
+
+// walk calls fn on the node and all its descendants.
+func (n *xmlNode) walk(fn func(*xmlNode)) {
+	fn(n)
+	for _, child := range n.children {
+		if c, ok := child.(*xmlNode); ok {
+			c.walk(fn)
+		}
+	}
+}
+
+func qname(prefix, local string) string {
+	if prefix == "" {
+		return local
+	}
+	return prefix + ":" + local
+}
+
+// canonicalize serializes the node by the Exclusive XML Canonicalization
+// without comments, the skip node is omitted which is the enveloped
+// signature.
+func canonicalize(n *xmlNode, inclusivePrefixes []string, skip *xmlNode) []byte {
+	inclusive := make(map[string]bool, len(inclusivePrefixes))
+	for _, prefix := range inclusivePrefixes {
+		if prefix == "#default" {
+			prefix = ""
+		}
+		inclusive[prefix] = true
+	}
+
+	buff := &bytes.Buffer{}
+	c14nElement(buff, n, map[string]string{}, inclusive, skip)
+	return buff.Bytes()
+}
+
+// c14nElement writes the element, rendered are the namespace
+// declarations in effect of the output ancestors.
+func c14nElement(buff *bytes.Buffer, n *xmlNode, rendered map[string]string,
+	inclusive map[string]bool, skip *xmlNode) {
+
+	// NOTE: The namespaces visibly utilized by the element and its
+	// attributes, plus the in-scope ones in the inclusive list.
+	prefixes := map[string]bool{n.prefix: true}
+	for _, a := range n.attrs {
+		if a.Name.Space != "" && a.Name.Space != "xml" {
+			prefixes[a.Name.Space] = true
+		}
+	}
+	for prefix := range inclusive {
+		if _, exists := n.lookupNS(prefix); exists {
+			prefixes[prefix] = true
+		}
+	}
+
+	var decls []string
+	scope := rendered
+	for prefix := range prefixes {
+		uri, exists := n.lookupNS(prefix)
+		if !exists && prefix != "" {
+			continue
+		}
+		if current, exists := rendered[prefix]; exists && current == uri ||
+			!exists && prefix == "" && uri == "" {
+			continue
+		}
+
+		if len(decls) == 0 {
+			scope = make(map[string]string, len(rendered)+1)
+			for k, v := range rendered {
+				scope[k] = v
+			}
+		}
+		scope[prefix] = uri
+		decls = append(decls, prefix)
+	}
+	sort.Strings(decls)
+
+	attrs := make([]xml.Attr, len(n.attrs))
+	copy(attrs, n.attrs)
+	attrNS := func(a xml.Attr) string {
+		if a.Name.Space == "" {
+			return ""
+		}
+		uri, _ := n.lookupNS(a.Name.Space)
+		return uri
+	}
+	sort.SliceStable(attrs, func(i, j int) bool {
+		nsi, nsj := attrNS(attrs[i]), attrNS(attrs[j])
+		if nsi != nsj {
+			return nsi < nsj
+		}
+		return attrs[i].Name.Local < attrs[j].Name.Local
+	})
+
+	name := qname(n.prefix, n.local)
+	buff.WriteString("<" + name)
+	for _, prefix := range decls {
+		if prefix == "" {
+			buff.WriteString(" xmlns")
+		} else {
+			buff.WriteString(" xmlns:" + prefix)
+		}
+		buff.WriteString(`="` + escapeAttr(scope[prefix]) + `"`)
+	}
+	for _, a := range attrs {
+		buff.WriteString(" " + qname(a.Name.Space, a.Name.Local) + `="` + escapeAttr(a.Value) + `"`)
+	}
+	buff.WriteString(">")
+
+	for _, child := range n.children {
+		switch c := child.(type) {
+		case *xmlNode:
+			if c != skip {
+				c14nElement(buff, c, scope, inclusive, skip)
+			}
+		case xml.CharData:
+			buff.WriteString(escapeText(string(c)))
+		case xml.ProcInst:
+			buff.WriteString("<?" + c.Target)
+			if len(c.Inst) > 0 {
+				buff.WriteString(" " + string(c.Inst))
+			}
+			buff.WriteString("?>")
+		}
+	}
+
+	buff.WriteString("</" + name + ">")
+}
+
+var (
+	textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+	attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;",
+		"\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+)
+
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+func escapeAttr(s string) string {
+	return attrEscaper.Replace(s)
+}
+
+// decodeBase64 decodes the base64 content which may be wrapped.
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\r', '\n':
+			return -1
+		}
+		return r
+	}, s)
+	return base64.StdEncoding.DecodeString(s)
+}
+
+// verifySignature verifies the enveloped signature of the element,
+// which must refer to the element itself.
+func verifySignature(n *xmlNode, cert *x509.Certificate) error {
+	sig := n.element(nsDSig, "Signature")
+	if sig == nil {
+		return errNotSigned
+	}
+
+	signedInfo := sig.element(nsDSig, "SignedInfo")
+	if signedInfo == nil {
+		return fmt.Errorf("no SignedInfo")
+	}
+
+	c14nMethod := signedInfo.element(nsDSig, "CanonicalizationMethod")
+	if c14nMethod == nil || c14nMethod.attr("Algorithm") != algExcC14N {
+		return fmt.Errorf("unsupported canonicalization method")
+	}
+
+	sigMethod := signedInfo.element(nsDSig, "SignatureMethod")
+	if sigMethod == nil {
+		return fmt.Errorf("no SignatureMethod")
+	}
+	sigHash, exists := signatureHashes[sigMethod.attr("Algorithm")]
+	if !exists {
+		return fmt.Errorf("unsupported signature method %s", sigMethod.attr("Algorithm"))
+	}
+
+	references := signedInfo.elements(nsDSig, "Reference")
+	if len(references) != 1 {
+		return fmt.Errorf("exactly one Reference is required")
+	}
+	ref := references[0]
+	id := n.attr("ID")
+	if id == "" || ref.attr("URI") != "#"+id {
+		return fmt.Errorf("reference %s doesn't refer to the signed element", ref.attr("URI"))
+	}
+
+	var refPrefixes []string
+	excC14N := false
+	if transforms := ref.element(nsDSig, "Transforms"); transforms != nil {
+		for _, t := range transforms.elements(nsDSig, "Transform") {
+			switch t.attr("Algorithm") {
+			case algEnveloped:
+			case algExcC14N:
+				excC14N = true
+				refPrefixes = inclusivePrefixes(t)
+			default:
+				return fmt.Errorf("unsupported transform %s", t.attr("Algorithm"))
+			}
+		}
+	}
+	if !excC14N {
+		return fmt.Errorf("exclusive canonicalization transform is required")
+	}
+
+	digestMethod := ref.element(nsDSig, "DigestMethod")
+	if digestMethod == nil {
+		return fmt.Errorf("no DigestMethod")
+	}
+	digestHash, exists := digestHashes[digestMethod.attr("Algorithm")]
+	if !exists {
+		return fmt.Errorf("unsupported digest method %s", digestMethod.attr("Algorithm"))
+	}
+	digestValue := ref.element(nsDSig, "DigestValue")
+	if digestValue == nil {
+		return fmt.Errorf("no DigestValue")
+	}
+	wantDigest, err := decodeBase64(digestValue.text())
+	if err != nil {
+		return fmt.Errorf("decode digest failed: %v", err)
+	}
+
+	sigValue := sig.element(nsDSig, "SignatureValue")
+	if sigValue == nil {
+		return fmt.Errorf("no SignatureValue")
+	}
+	signature, err := decodeBase64(sigValue.text())
+	if err != nil {
+		return fmt.Errorf("decode signature failed: %v", err)
+	}
+
+	publicKey, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("unsupported public key of the certificate")
+	}
+
+	h := sigHash.New()
+	h.Write(canonicalize(signedInfo, inclusivePrefixes(c14nMethod), nil))
+	err = rsa.VerifyPKCS1v15(publicKey, sigHash, h.Sum(nil), signature)
+	if err != nil {
+		return fmt.Errorf("verify signature failed: %v", err)
+	}
+
+	h = digestHash.New()
+	h.Write(canonicalize(n, refPrefixes, sig))
+	if subtle.ConstantTimeCompare(h.Sum(nil), wantDigest) != 1 {
+		return fmt.Errorf("digest mismatched")
+	}
+
+	return nil
+}
+
+func inclusivePrefixes(method *xmlNode) []string {
+	if in := method.element(nsExcC14N, "InclusiveNamespaces"); in != nil {
+		return strings.Fields(in.attr("PrefixList"))
+	}
+	return nil
+}
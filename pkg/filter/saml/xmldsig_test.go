@@ -0,0 +1,72 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package saml
+
+import (
+	"testing"
+)
+
+func TestCanonicalize(t *testing.T) {
+	// NOTE: The example of the Exclusive XML Canonicalization spec.
+	doc := `<n0:local xmlns:n0="foo:bar" xmlns:n3="ftp://example.org"><n1:elem2 xmlns:n1="http://example.net" xml:lang="en"><n3:stuff xmlns:n3="ftp://example.org"/></n1:elem2></n0:local>`
+	root, err := parseXML([]byte(doc))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	elem2 := root.children[0].(*xmlNode)
+	want := `<n1:elem2 xmlns:n1="http://example.net" xml:lang="en"><n3:stuff xmlns:n3="ftp://example.org"></n3:stuff></n1:elem2>`
+	if got := string(canonicalize(elem2, nil, nil)); got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+
+	// NOTE: The unused n3 is rendered if it's inclusive.
+	want = `<n1:elem2 xmlns:n1="http://example.net" xmlns:n3="ftp://example.org" xml:lang="en"><n3:stuff></n3:stuff></n1:elem2>`
+	if got := string(canonicalize(elem2, []string{"n3"}, nil)); got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+
+	doc = "<?xml version=\"1.0\"?>\n<a xmlns=\"urn:a\" xmlns:b=\"urn:b\" xmlns:c=\"urn:c\" z='1' b:y='2' a='3&amp;\"'>" +
+		"<!-- comment --><c xmlns=\"\">t&lt;&gt;\r\n</c><b:d/></a>"
+	root, err = parseXML([]byte(doc))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	want = `<a xmlns="urn:a" xmlns:b="urn:b" a="3&amp;&quot;" z="1" b:y="2"><c xmlns="">t&lt;&gt;` + "\n" + `</c><b:d></b:d></a>`
+	if got := string(canonicalize(root, nil, nil)); got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+
+	// NOTE: The skipped element is omitted.
+	want = `<a xmlns="urn:a" xmlns:b="urn:b" a="3&amp;&quot;" z="1" b:y="2"><c xmlns="">t&lt;&gt;` + "\n" + `</c></a>`
+	if got := string(canonicalize(root, nil, root.children[1].(*xmlNode))); got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+}
+
+func TestParseXML(t *testing.T) {
+	for _, doc := range []string{
+		`<!DOCTYPE a [<!ENTITY x "x">]><a>&x;</a>`,
+		`<a><b></a></b>`,
+		`<a></a><b></b>`,
+		`<a>`,
+	} {
+		if _, err := parseXML([]byte(doc)); err == nil {
+			t.Errorf("%s: want error", doc)
+		}
+	}
+}
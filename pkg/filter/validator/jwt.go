@@ -54,6 +54,12 @@ type JWTValidator struct {
 
 // Validate validates the JWT token of a http request
 func (v *JWTValidator) Validate(req context.HTTPRequest) error {
+	_, err := v.validate(req)
+	return err
+}
+
+// validate validates the JWT token, and returns its subject.
+func (v *JWTValidator) validate(req context.HTTPRequest) (string, error) {
 	var token string
 
 	if v.spec.CookieName != "" {
@@ -66,18 +72,23 @@ func (v *JWTValidator) Validate(req context.HTTPRequest) error {
 		const prefix = "Bearer "
 		authHdr := req.Header().Get("Authorization")
 		if !strings.HasPrefix(authHdr, prefix) {
-			return fmt.Errorf("unexpected authrization header: %s", authHdr)
+			return "", fmt.Errorf("unexpected authrization header: %s", authHdr)
 		}
 		token = authHdr[len(prefix):]
 	}
 
 	// jwt.Parse does everything incuding parsing and verification
-	_, e := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+	t, e := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
 		if alg := token.Method.Alg(); alg != v.spec.Algorithm {
 			return nil, fmt.Errorf("unexpected signing method: %v", alg)
 		}
 		return v.secretBytes, nil
 	})
+	if e != nil {
+		return "", e
+	}
 
-	return e
+	claims, _ := t.Claims.(jwt.MapClaims)
+	subject, _ := claims["sub"].(string)
+	return subject, nil
 }
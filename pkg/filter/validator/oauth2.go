@@ -133,12 +133,18 @@ func (v *OAuth2Validator) introspectToken(tokenStr string) (*tokenInfo, error) {
 
 // Validate validates the access token of a http request
 func (v *OAuth2Validator) Validate(req context.HTTPRequest) error {
+	_, err := v.validate(req)
+	return err
+}
+
+// validate validates the access token, and returns its subject.
+func (v *OAuth2Validator) validate(req context.HTTPRequest) (string, error) {
 	const prefix = "Bearer "
 
 	hdr := req.Header()
 	tokenStr := hdr.Get("Authorization")
 	if !strings.HasPrefix(tokenStr, prefix) {
-		return fmt.Errorf("unexpected authorization header: %s", tokenStr)
+		return "", fmt.Errorf("unexpected authorization header: %s", tokenStr)
 	}
 	tokenStr = tokenStr[len(prefix):]
 
@@ -146,10 +152,10 @@ func (v *OAuth2Validator) Validate(req context.HTTPRequest) error {
 	if v.spec.TokenIntrospect != nil {
 		ti, e := v.introspectToken(tokenStr)
 		if e != nil {
-			return e
+			return "", e
 		}
 		if !ti.Active {
-			return fmt.Errorf("oauth2 authorization failed, token is inactive")
+			return "", fmt.Errorf("oauth2 authorization failed, token is inactive")
 		}
 		subject = ti.Subject
 		scope = ti.Scope
@@ -161,7 +167,7 @@ func (v *OAuth2Validator) Validate(req context.HTTPRequest) error {
 			return v.spec.JWT.secretBytes, nil
 		})
 		if e != nil {
-			return e
+			return "", e
 		}
 
 		claims := token.Claims.(jwt.MapClaims)
@@ -177,5 +183,5 @@ func (v *OAuth2Validator) Validate(req context.HTTPRequest) error {
 		hdr.Set("X-Authenticated-Scope", scope)
 	}
 
-	return nil
+	return subject, nil
 }
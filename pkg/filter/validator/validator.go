@@ -136,12 +136,13 @@ func (v *Validator) handle(ctx context.HTTPContext) string {
 	}
 
 	if v.jwt != nil {
-		err := v.jwt.Validate(req)
+		subject, err := v.jwt.validate(req)
 		if err != nil {
 			ctx.Response().SetStatusCode(http.StatusForbidden)
 			ctx.AddTag(stringtool.Cat("JWT validator: ", err.Error()))
 			return resultInvalid
 		}
+		setAuthenticatedUser(ctx, subject)
 	}
 
 	if v.signer != nil {
@@ -154,17 +155,24 @@ func (v *Validator) handle(ctx context.HTTPContext) string {
 	}
 
 	if v.oauth2 != nil {
-		err := v.oauth2.Validate(req)
+		subject, err := v.oauth2.validate(req)
 		if err != nil {
 			ctx.Response().SetStatusCode(http.StatusForbidden)
 			ctx.AddTag(stringtool.Cat("oauth2 validator: ", err.Error()))
 			return resultInvalid
 		}
+		setAuthenticatedUser(ctx, subject)
 	}
 
 	return ""
 }
 
+func setAuthenticatedUser(ctx context.HTTPContext, subject string) {
+	if subject != "" {
+		ctx.Set(context.VarAuthenticatedUser, subject)
+	}
+}
+
 // Status returns status.
 func (v *Validator) Status() interface{} { return nil }
 
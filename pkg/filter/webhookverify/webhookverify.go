@@ -0,0 +1,392 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package webhookverify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/iotool"
+)
+
+const (
+	// Kind is the kind of WebhookVerification.
+	Kind = "WebhookVerification"
+
+	resultInvalidSignature = "invalidSignature"
+	resultReplayedRequest  = "replayedRequest"
+
+	providerGitHub = "github"
+	providerStripe = "stripe"
+	providerSlack  = "slack"
+	providerCustom = "custom"
+)
+
+var (
+	results = []string{resultInvalidSignature, resultReplayedRequest}
+
+	// nowFunc is the clock checking the timestamps, it's replaced in tests.
+	nowFunc = time.Now
+)
+
+func init() {
+	httppipeline.Register(&WebhookVerification{})
+}
+
+type (
+	// WebhookVerification verifies the signature over the request body
+	// of the webhooks from the external systems.
+	WebhookVerification struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+
+		replayWindow time.Duration
+		verify       func(h http.Header, body []byte) (timestamp int64, err error)
+
+		// The counters are accessed atomically.
+		verified         uint64
+		invalidSignature uint64
+		replayed         uint64
+	}
+
+	// Spec describes the WebhookVerification.
+	Spec struct {
+		Provider string `yaml:"provider" jsonschema:"required,enum=github,enum=stripe,enum=slack,enum=custom"`
+		Secret   string `yaml:"secret" jsonschema:"required"`
+		// ReplayWindow is the maximum age of the timestamp of the
+		// providers signing it, the older requests are rejected.
+		ReplayWindow string `yaml:"replayWindow,omitempty" jsonschema:"omitempty,format=duration"`
+		MaxBodyBytes int64  `yaml:"maxBodyBytes,omitempty" jsonschema:"omitempty,minimum=1"`
+
+		Custom *CustomSpec `yaml:"custom,omitempty" jsonschema:"omitempty"`
+	}
+
+	// CustomSpec describes how the custom provider signs the request.
+	CustomSpec struct {
+		SignatureHeader string `yaml:"signatureHeader" jsonschema:"required"`
+		// SignaturePrefix is trimmed from the signature, such as sha256=.
+		SignaturePrefix string `yaml:"signaturePrefix,omitempty" jsonschema:"omitempty"`
+		// TimestampHeader carries the unix timestamp in seconds,
+		// the replay window is checked only if it's specified.
+		TimestampHeader string `yaml:"timestampHeader,omitempty" jsonschema:"omitempty"`
+		// Payload is the signed content, {timestamp} and {body} in it are
+		// replaced with the timestamp and the request body, default is {body}.
+		Payload   string `yaml:"payload,omitempty" jsonschema:"omitempty"`
+		Algorithm string `yaml:"algorithm,omitempty" jsonschema:"omitempty,enum=sha1,enum=sha256,enum=sha512"`
+		Encoding  string `yaml:"encoding,omitempty" jsonschema:"omitempty,enum=hex,enum=base64"`
+	}
+
+	// Status is the status of WebhookVerification.
+	Status struct {
+		Verified         uint64 `yaml:"verified"`
+		InvalidSignature uint64 `yaml:"invalidSignature"`
+		Replayed         uint64 `yaml:"replayed"`
+	}
+)
+
+// Validate validates the Spec.
+func (spec Spec) Validate() error {
+	if spec.Provider == providerCustom && spec.Custom == nil {
+		return fmt.Errorf("custom is required by provider custom")
+	}
+	if spec.Provider != providerCustom && spec.Custom != nil {
+		return fmt.Errorf("custom is only used by provider custom")
+	}
+	return nil
+}
+
+// Kind returns the kind of WebhookVerification.
+func (wv *WebhookVerification) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of WebhookVerification.
+func (wv *WebhookVerification) DefaultSpec() interface{} {
+	return &Spec{
+		ReplayWindow: "5m",
+		MaxBodyBytes: 1024 * 1024,
+	}
+}
+
+// Description returns the description of WebhookVerification.
+func (wv *WebhookVerification) Description() string {
+	return "WebhookVerification verifies the signatures of webhooks."
+}
+
+// Results returns the results of WebhookVerification.
+func (wv *WebhookVerification) Results() []string {
+	return results
+}
+
+// Init initializes WebhookVerification.
+func (wv *WebhookVerification) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	wv.pipeSpec, wv.spec, wv.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	wv.reload()
+}
+
+// Inherit inherits previous generation of WebhookVerification.
+func (wv *WebhookVerification) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	previousGeneration.Close()
+	wv.Init(pipeSpec, super)
+}
+
+func (wv *WebhookVerification) reload() {
+	wv.replayWindow = 5 * time.Minute
+	if d, err := time.ParseDuration(wv.spec.ReplayWindow); err == nil {
+		wv.replayWindow = d
+	} else if wv.spec.ReplayWindow != "" {
+		logger.Errorf("BUG: parse duration %s failed: %v", wv.spec.ReplayWindow, err)
+	}
+
+	secret := []byte(wv.spec.Secret)
+	switch wv.spec.Provider {
+	case providerGitHub:
+		wv.verify = func(h http.Header, body []byte) (int64, error) {
+			return 0, verifyGitHub(secret, h, body)
+		}
+	case providerStripe:
+		wv.verify = func(h http.Header, body []byte) (int64, error) {
+			return verifyStripe(secret, h, body)
+		}
+	case providerSlack:
+		wv.verify = func(h http.Header, body []byte) (int64, error) {
+			return verifySlack(secret, h, body)
+		}
+	case providerCustom:
+		custom := wv.spec.Custom
+		wv.verify = func(h http.Header, body []byte) (int64, error) {
+			return verifyCustom(secret, custom, h, body)
+		}
+	}
+}
+
+// Handle verifies the signature of the request.
+func (wv *WebhookVerification) Handle(ctx context.HTTPContext) string {
+	result := wv.handle(ctx)
+	return ctx.CallNextHandler(result)
+}
+
+func (wv *WebhookVerification) handle(ctx context.HTTPContext) string {
+	body, complete := iotool.ReadLimited(ctx.Request().Body(), wv.spec.MaxBodyBytes)
+	if !complete {
+		atomic.AddUint64(&wv.invalidSignature, 1)
+		ctx.AddTag(fmt.Sprintf("webhookVerification: request body exceeds %dB", wv.spec.MaxBodyBytes))
+		ctx.Response().SetStatusCode(http.StatusRequestEntityTooLarge)
+		return resultInvalidSignature
+	}
+	ctx.Request().SetBody(bytes.NewReader(body))
+
+	timestamp, err := wv.verify(ctx.Request().Std().Header, body)
+	if err != nil {
+		atomic.AddUint64(&wv.invalidSignature, 1)
+		ctx.AddTag(fmt.Sprintf("webhookVerification: %v", err))
+		ctx.Response().SetStatusCode(http.StatusUnauthorized)
+		return resultInvalidSignature
+	}
+
+	// NOTE: The timestamp is checked after the signature,
+	// otherwise it could be forged.
+	if timestamp != 0 {
+		age := nowFunc().Sub(time.Unix(timestamp, 0))
+		if age > wv.replayWindow || age < -wv.replayWindow {
+			atomic.AddUint64(&wv.replayed, 1)
+			ctx.AddTag(fmt.Sprintf("webhookVerification: timestamp %d is out of the replay window", timestamp))
+			ctx.Response().SetStatusCode(http.StatusBadRequest)
+			return resultReplayedRequest
+		}
+	}
+
+	atomic.AddUint64(&wv.verified, 1)
+	return ""
+}
+
+func sign(newHash func() hash.Hash, secret []byte, payload ...[]byte) []byte {
+	mac := hmac.New(newHash, secret)
+	for _, p := range payload {
+		mac.Write(p)
+	}
+	return mac.Sum(nil)
+}
+
+// equalHex compares the hex signature with the expected one in constant time.
+func equalHex(signature string, expected []byte) bool {
+	decoded, err := hex.DecodeString(signature)
+	return err == nil && hmac.Equal(decoded, expected)
+}
+
+func parseTimestamp(value string) (int64, error) {
+	if value == "" {
+		return 0, fmt.Errorf("timestamp is missing")
+	}
+	timestamp, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || timestamp <= 0 {
+		return 0, fmt.Errorf("invalid timestamp %s", value)
+	}
+	return timestamp, nil
+}
+
+// verifyGitHub verifies X-Hub-Signature-256, which is sha256=<hex hmac of body>.
+func verifyGitHub(secret []byte, h http.Header, body []byte) error {
+	signature := h.Get("X-Hub-Signature-256")
+	if !strings.HasPrefix(signature, "sha256=") {
+		return fmt.Errorf("X-Hub-Signature-256 is missing or invalid")
+	}
+	if !equalHex(strings.TrimPrefix(signature, "sha256="), sign(sha256.New, secret, body)) {
+		return fmt.Errorf("signature mismatched")
+	}
+	return nil
+}
+
+// verifyStripe verifies Stripe-Signature, which is like t=<timestamp>,v1=<hex>,
+// the v1 signatures are the hmac of <timestamp>.<body>, any of them matches.
+func verifyStripe(secret []byte, h http.Header, body []byte) (int64, error) {
+	var t string
+	var signatures []string
+	for _, item := range strings.Split(h.Get("Stripe-Signature"), ",") {
+		kv := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "t":
+			t = kv[1]
+		case "v1":
+			signatures = append(signatures, kv[1])
+		}
+	}
+
+	timestamp, err := parseTimestamp(t)
+	if err != nil {
+		return 0, err
+	}
+	if len(signatures) == 0 {
+		return 0, fmt.Errorf("v1 signature is missing")
+	}
+
+	expected := sign(sha256.New, secret, []byte(t), []byte("."), body)
+	for _, s := range signatures {
+		if equalHex(s, expected) {
+			return timestamp, nil
+		}
+	}
+	return 0, fmt.Errorf("signature mismatched")
+}
+
+// verifySlack verifies X-Slack-Signature, which is v0=<hex hmac of
+// v0:<X-Slack-Request-Timestamp>:<body>>.
+func verifySlack(secret []byte, h http.Header, body []byte) (int64, error) {
+	t := h.Get("X-Slack-Request-Timestamp")
+	timestamp, err := parseTimestamp(t)
+	if err != nil {
+		return 0, err
+	}
+
+	signature := h.Get("X-Slack-Signature")
+	if !strings.HasPrefix(signature, "v0=") {
+		return 0, fmt.Errorf("X-Slack-Signature is missing or invalid")
+	}
+	expected := sign(sha256.New, secret, []byte("v0:"+t+":"), body)
+	if !equalHex(strings.TrimPrefix(signature, "v0="), expected) {
+		return 0, fmt.Errorf("signature mismatched")
+	}
+	return timestamp, nil
+}
+
+func verifyCustom(secret []byte, spec *CustomSpec, h http.Header, body []byte) (int64, error) {
+	var timestamp int64
+	var t string
+	if spec.TimestampHeader != "" {
+		t = h.Get(spec.TimestampHeader)
+		var err error
+		if timestamp, err = parseTimestamp(t); err != nil {
+			return 0, err
+		}
+	}
+
+	signature := h.Get(spec.SignatureHeader)
+	if signature == "" || !strings.HasPrefix(signature, spec.SignaturePrefix) {
+		return 0, fmt.Errorf("%s is missing or invalid", spec.SignatureHeader)
+	}
+	signature = strings.TrimPrefix(signature, spec.SignaturePrefix)
+
+	newHash := sha256.New
+	switch spec.Algorithm {
+	case "sha1":
+		newHash = sha1.New
+	case "sha512":
+		newHash = sha512.New
+	}
+
+	payload := spec.Payload
+	if payload == "" {
+		payload = "{body}"
+	}
+	payload = strings.ReplaceAll(payload, "{timestamp}", t)
+	parts := strings.Split(payload, "{body}")
+	signed := make([][]byte, 0, 2*len(parts)-1)
+	for i, p := range parts {
+		if i > 0 {
+			signed = append(signed, body)
+		}
+		signed = append(signed, []byte(p))
+	}
+	expected := sign(newHash, secret, signed...)
+
+	var matched bool
+	if spec.Encoding == "base64" {
+		decoded, err := base64.StdEncoding.DecodeString(signature)
+		matched = err == nil && hmac.Equal(decoded, expected)
+	} else {
+		matched = equalHex(signature, expected)
+	}
+	if !matched {
+		return 0, fmt.Errorf("signature mismatched")
+	}
+	return timestamp, nil
+}
+
+// Status returns status.
+func (wv *WebhookVerification) Status() interface{} {
+	return &Status{
+		Verified:         atomic.LoadUint64(&wv.verified),
+		InvalidSignature: atomic.LoadUint64(&wv.invalidSignature),
+		Replayed:         atomic.LoadUint64(&wv.replayed),
+	}
+}
+
+// Close closes WebhookVerification.
+func (wv *WebhookVerification) Close() {}
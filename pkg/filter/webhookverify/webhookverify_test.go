@@ -0,0 +1,233 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package webhookverify
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/option"
+	"github.com/megaease/easegress/pkg/tracing"
+)
+
+var testNow = time.Unix(1622541600, 0)
+
+func TestMain(m *testing.M) {
+	tempDir, err := ioutil.TempDir("", "eg-webhookverify-test")
+	if err != nil {
+		panic(err)
+	}
+	absLogDir := filepath.Join(tempDir, "log")
+	os.MkdirAll(absLogDir, 0755)
+	logger.Init(&option.Options{
+		Name:      "webhookverify-for-log",
+		AbsLogDir: absLogDir,
+	})
+	nowFunc = func() time.Time { return testNow }
+
+	code := m.Run()
+
+	logger.Sync()
+	os.RemoveAll(tempDir)
+
+	os.Exit(code)
+}
+
+func newTestFilter(t *testing.T, spec *Spec) *WebhookVerification {
+	pipeSpec, err := httppipeline.NewFilterSpec(
+		&httppipeline.FilterMetaSpec{Name: "webhook", Kind: Kind}, spec)
+	if err != nil {
+		t.Fatalf("new filter spec failed: %v", err)
+	}
+
+	wv := &WebhookVerification{}
+	wv.Init(pipeSpec, nil)
+	return wv
+}
+
+// doRequest returns the result, the status code and the body passed to
+// the following filters.
+func doRequest(wv *WebhookVerification, header http.Header, body string) (string, int, string) {
+	req := httptest.NewRequest(http.MethodPost, "http://example.com/hook", strings.NewReader(body))
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	w := httptest.NewRecorder()
+	ctx := context.New(w, req, tracing.NoopTracing, "no trace")
+	result := wv.handle(ctx)
+	passed, _ := ioutil.ReadAll(ctx.Request().Body())
+	return result, ctx.Response().StatusCode(), string(passed)
+}
+
+func hmacHex(secret, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestGitHub(t *testing.T) {
+	wv := newTestFilter(t, &Spec{Provider: providerGitHub, Secret: "It's a Secret to Everybody"})
+
+	// The example in the GitHub documentation.
+	header := http.Header{"X-Hub-Signature-256": {
+		"sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17"}}
+	result, code, body := doRequest(wv, header, "Hello, World!")
+	if result != "" || code != http.StatusOK || body != "Hello, World!" {
+		t.Errorf("want verified, got %q %d %s", result, code, body)
+	}
+
+	result, code, _ = doRequest(wv, header, "Hello, World?")
+	if result != resultInvalidSignature || code != http.StatusUnauthorized {
+		t.Errorf("want invalid signature, got %q %d", result, code)
+	}
+
+	result, _, _ = doRequest(wv, http.Header{}, "Hello, World!")
+	if result != resultInvalidSignature {
+		t.Errorf("want invalid signature without header, got %q", result)
+	}
+
+	status := wv.Status().(*Status)
+	if status.Verified != 1 || status.InvalidSignature != 2 || status.Replayed != 0 {
+		t.Errorf("unexpected status: %+v", status)
+	}
+}
+
+func TestStripe(t *testing.T) {
+	wv := newTestFilter(t, &Spec{Provider: providerStripe, Secret: "whsec_test"})
+	body := `{"id":"evt_1"}`
+
+	stripeHeader := func(ts int64) http.Header {
+		t := strconv.FormatInt(ts, 10)
+		return http.Header{"Stripe-Signature": {
+			"t=" + t + ",v1=" + hmacHex("whsec_other", t+"."+body) + ",v1=" + hmacHex("whsec_test", t+"."+body)}}
+	}
+
+	result, code, _ := doRequest(wv, stripeHeader(testNow.Unix()-60), body)
+	if result != "" || code != http.StatusOK {
+		t.Errorf("want verified, got %q %d", result, code)
+	}
+
+	result, code, _ = doRequest(wv, stripeHeader(testNow.Unix()-600), body)
+	if result != resultReplayedRequest || code != http.StatusBadRequest {
+		t.Errorf("want replayed request, got %q %d", result, code)
+	}
+
+	// The timestamp is signed, so it can't be refreshed.
+	header := stripeHeader(testNow.Unix() - 600)
+	header.Set("Stripe-Signature", strings.Replace(header.Get("Stripe-Signature"),
+		strconv.FormatInt(testNow.Unix()-600, 10), strconv.FormatInt(testNow.Unix(), 10), 1))
+	result, code, _ = doRequest(wv, header, body)
+	if result != resultInvalidSignature || code != http.StatusUnauthorized {
+		t.Errorf("want invalid signature, got %q %d", result, code)
+	}
+}
+
+func TestSlack(t *testing.T) {
+	wv := newTestFilter(t, &Spec{Provider: providerSlack, Secret: "slack-secret", ReplayWindow: "1m"})
+	body := "token=xyz&command=%2Fweather"
+
+	ts := strconv.FormatInt(testNow.Unix()-30, 10)
+	header := http.Header{
+		"X-Slack-Request-Timestamp": {ts},
+		"X-Slack-Signature":         {"v0=" + hmacHex("slack-secret", "v0:"+ts+":"+body)},
+	}
+	result, code, _ := doRequest(wv, header, body)
+	if result != "" || code != http.StatusOK {
+		t.Errorf("want verified, got %q %d", result, code)
+	}
+
+	ts = strconv.FormatInt(testNow.Unix()-90, 10)
+	header = http.Header{
+		"X-Slack-Request-Timestamp": {ts},
+		"X-Slack-Signature":         {"v0=" + hmacHex("slack-secret", "v0:"+ts+":"+body)},
+	}
+	result, _, _ = doRequest(wv, header, body)
+	if result != resultReplayedRequest {
+		t.Errorf("want replayed request, got %q", result)
+	}
+
+	header.Del("X-Slack-Request-Timestamp")
+	result, _, _ = doRequest(wv, header, body)
+	if result != resultInvalidSignature {
+		t.Errorf("want invalid signature without timestamp, got %q", result)
+	}
+}
+
+func TestCustom(t *testing.T) {
+	wv := newTestFilter(t, &Spec{
+		Provider: providerCustom,
+		Secret:   "custom-secret",
+		Custom: &CustomSpec{
+			SignatureHeader: "X-Signature",
+			SignaturePrefix: "hmac ",
+			TimestampHeader: "X-Timestamp",
+			Payload:         "{timestamp}\n{body}\n{body}",
+			Encoding:        "base64",
+		},
+	})
+	body := "payload"
+
+	ts := strconv.FormatInt(testNow.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte("custom-secret"))
+	mac.Write([]byte(ts + "\n" + body + "\n" + body))
+	header := http.Header{
+		"X-Timestamp": {ts},
+		"X-Signature": {"hmac " + base64.StdEncoding.EncodeToString(mac.Sum(nil))},
+	}
+	result, code, _ := doRequest(wv, header, body)
+	if result != "" || code != http.StatusOK {
+		t.Errorf("want verified, got %q %d", result, code)
+	}
+
+	header.Set("X-Signature", "hmac "+hmacHex("custom-secret", ts+"\n"+body+"\n"+body))
+	result, _, _ = doRequest(wv, header, body)
+	if result != resultInvalidSignature {
+		t.Errorf("want invalid signature for hex encoding, got %q", result)
+	}
+}
+
+func TestBodyTooLarge(t *testing.T) {
+	wv := newTestFilter(t, &Spec{Provider: providerGitHub, Secret: "secret", MaxBodyBytes: 4})
+	result, code, _ := doRequest(wv, http.Header{}, "too large")
+	if result != resultInvalidSignature || code != http.StatusRequestEntityTooLarge {
+		t.Errorf("want body too large, got %q %d", result, code)
+	}
+}
+
+func TestSpecValidate(t *testing.T) {
+	if (Spec{Provider: providerCustom}).Validate() == nil {
+		t.Errorf("want error for custom provider without custom")
+	}
+	if (Spec{Provider: providerGitHub, Custom: &CustomSpec{}}).Validate() == nil {
+		t.Errorf("want error for github provider with custom")
+	}
+}
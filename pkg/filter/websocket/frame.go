@@ -0,0 +1,199 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Opcodes defined by RFC 6455 section 5.2.
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+
+	maxControlPayload = 125
+)
+
+// Close status codes defined by RFC 6455 section 7.4.1.
+const (
+	closeGoingAway      = 1001
+	closeProtocolError  = 1002
+	closeInvalidPayload = 1007
+	closeMessageTooBig  = 1009
+)
+
+type (
+	frame struct {
+		fin     bool
+		opcode  byte
+		payload []byte
+	}
+
+	// protocolError is a violation of RFC 6455 by the peer,
+	// the connection is failed with the code.
+	protocolError struct {
+		code   int
+		reason string
+	}
+)
+
+func (e *protocolError) Error() string {
+	return fmt.Sprintf("websocket protocol error %d: %s", e.code, e.reason)
+}
+
+func isControl(opcode byte) bool {
+	return opcode&0x8 != 0
+}
+
+// readFrame reads a frame, the payload is unmasked if it's masked.
+// The frames from clients must be masked, and must not be from servers.
+func readFrame(r *bufio.Reader, maxPayload int64, masked bool) (*frame, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return nil, err
+	}
+
+	f := &frame{
+		fin:    head[0]&0x80 != 0,
+		opcode: head[0] & 0x0F,
+	}
+	if head[0]&0x70 != 0 {
+		// NOTE: No extension is negotiated, so the RSV bits must be zero.
+		return nil, &protocolError{closeProtocolError, "reserved bits set"}
+	}
+	switch f.opcode {
+	case opContinuation, opText, opBinary, opClose, opPing, opPong:
+	default:
+		return nil, &protocolError{closeProtocolError, fmt.Sprintf("unknown opcode %d", f.opcode)}
+	}
+	if (head[1]&0x80 != 0) != masked {
+		return nil, &protocolError{closeProtocolError, "unexpected masking"}
+	}
+
+	length := int64(head[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return nil, err
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return nil, err
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]))
+		if length < 0 {
+			return nil, &protocolError{closeProtocolError, "invalid payload length"}
+		}
+	}
+
+	if isControl(f.opcode) && (length > maxControlPayload || !f.fin) {
+		return nil, &protocolError{closeProtocolError, "invalid control frame"}
+	}
+	if length > maxPayload {
+		return nil, &protocolError{closeMessageTooBig, "message too big"}
+	}
+
+	var key [4]byte
+	if masked {
+		if _, err := io.ReadFull(r, key[:]); err != nil {
+			return nil, err
+		}
+	}
+
+	f.payload = make([]byte, length)
+	if _, err := io.ReadFull(r, f.payload); err != nil {
+		return nil, err
+	}
+	if masked {
+		maskBytes(key, f.payload)
+	}
+
+	return f, nil
+}
+
+// writeFrame writes the frame, the frames to servers must be masked.
+func writeFrame(w io.Writer, f *frame, masked bool) error {
+	buff := make([]byte, 0, 14+len(f.payload))
+
+	b0 := f.opcode
+	if f.fin {
+		b0 |= 0x80
+	}
+	buff = append(buff, b0)
+
+	var b1 byte
+	if masked {
+		b1 = 0x80
+	}
+	length := len(f.payload)
+	switch {
+	case length <= 125:
+		buff = append(buff, b1|byte(length))
+	case length <= 0xFFFF:
+		buff = append(buff, b1|126, 0, 0)
+		binary.BigEndian.PutUint16(buff[len(buff)-2:], uint16(length))
+	default:
+		buff = append(buff, b1|127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(buff[len(buff)-8:], uint64(length))
+	}
+
+	if !masked {
+		buff = append(buff, f.payload...)
+		_, err := w.Write(buff)
+		return err
+	}
+
+	var key [4]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		return err
+	}
+	buff = append(buff, key[:]...)
+	start := len(buff)
+	buff = append(buff, f.payload...)
+	maskBytes(key, buff[start:])
+
+	_, err := w.Write(buff)
+	return err
+}
+
+func maskBytes(key [4]byte, b []byte) {
+	for i := range b {
+		b[i] ^= key[i&3]
+	}
+}
+
+// closePayload builds the payload of a close frame.
+func closePayload(code int, reason string) []byte {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	if len(reason) > maxControlPayload-2 {
+		reason = reason[:maxControlPayload-2]
+	}
+	return append(payload, reason...)
+}
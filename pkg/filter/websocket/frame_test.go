@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	for _, size := range []int{0, 125, 126, 0xFFFF, 0x10000} {
+		for _, masked := range []bool{true, false} {
+			payload := bytes.Repeat([]byte{'a'}, size)
+			buff := bytes.NewBuffer(nil)
+			err := writeFrame(buff, &frame{fin: true, opcode: opBinary, payload: payload}, masked)
+			if err != nil {
+				t.Fatalf("write frame failed: %v", err)
+			}
+
+			f, err := readFrame(bufio.NewReader(buff), 1<<20, masked)
+			if err != nil {
+				t.Fatalf("size %d masked %v: read frame failed: %v", size, masked, err)
+			}
+			if !f.fin || f.opcode != opBinary || !bytes.Equal(f.payload, payload) {
+				t.Errorf("size %d masked %v: frame mismatch", size, masked)
+			}
+		}
+	}
+}
+
+func TestReadFrameErrors(t *testing.T) {
+	write := func(f *frame, masked bool) *bufio.Reader {
+		buff := bytes.NewBuffer(nil)
+		writeFrame(buff, f, masked)
+		return bufio.NewReader(buff)
+	}
+
+	cases := []struct {
+		name   string
+		r      *bufio.Reader
+		masked bool
+		max    int64
+		code   int
+	}{
+		{"unmasked client frame", write(&frame{fin: true, opcode: opText}, false), true, 10, closeProtocolError},
+		{"masked server frame", write(&frame{fin: true, opcode: opText}, true), false, 10, closeProtocolError},
+		{"too big", write(&frame{fin: true, opcode: opText, payload: make([]byte, 11)}, false), false, 10, closeMessageTooBig},
+		{"fragmented control", write(&frame{opcode: opPing}, false), false, 10, closeProtocolError},
+		{"unknown opcode", write(&frame{fin: true, opcode: 0x3}, false), false, 10, closeProtocolError},
+		{"reserved bits", bufio.NewReader(bytes.NewReader([]byte{0xC1, 0x00})), false, 10, closeProtocolError},
+	}
+
+	for _, c := range cases {
+		_, err := readFrame(c.r, c.max, c.masked)
+		pe, ok := err.(*protocolError)
+		if !ok {
+			t.Errorf("%s: want protocol error, got %v", c.name, err)
+			continue
+		}
+		if pe.code != c.code {
+			t.Errorf("%s: want code %d, got %d", c.name, c.code, pe.code)
+		}
+	}
+}
+
+func TestClosePayload(t *testing.T) {
+	payload := closePayload(closeInvalidPayload, string(bytes.Repeat([]byte{'x'}, 200)))
+	if len(payload) != maxControlPayload {
+		t.Errorf("want %d bytes, got %d", maxControlPayload, len(payload))
+	}
+	if code := binary.BigEndian.Uint16(payload); code != closeInvalidPayload {
+		t.Errorf("want code %d, got %d", closeInvalidPayload, code)
+	}
+}
@@ -0,0 +1,227 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package websocket
+
+import (
+	"bufio"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/megaease/easegress/pkg/logger"
+	librl "github.com/megaease/easegress/pkg/util/ratelimiter"
+)
+
+// closeTimeout bounds the closing handshake after a close frame
+// is sent by either side.
+const closeTimeout = 5 * time.Second
+
+type (
+	// session relays the frames of a WebSocket connection.
+	session struct {
+		wf     *WebSocketFilter
+		client *endpoint
+		server *endpoint
+		rl     *librl.RateLimiter
+
+		closeOnce sync.Once
+	}
+
+	endpoint struct {
+		conn net.Conn
+		r    *bufio.Reader
+		// masked is true for the backend, the frames sent to servers
+		// must be masked and frames from servers must not be.
+		masked bool
+
+		mutex     sync.Mutex
+		closeSent bool
+	}
+)
+
+// write writes the frame, nothing is written after a close frame.
+func (e *endpoint) write(f *frame) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.closeSent {
+		return nil
+	}
+	if f.opcode == opClose {
+		e.closeSent = true
+	}
+	return writeFrame(e.conn, f, e.masked)
+}
+
+func (e *endpoint) name() string {
+	if e.masked {
+		return "server"
+	}
+	return "client"
+}
+
+func (s *session) run() {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		s.relay(s.client, s.server)
+	}()
+	go func() {
+		defer wg.Done()
+		s.relay(s.server, s.client)
+	}()
+	wg.Wait()
+
+	s.client.conn.Close()
+	s.server.conn.Close()
+}
+
+// closing bounds the rest of the closing handshake.
+func (s *session) closing() {
+	s.closeOnce.Do(func() {
+		deadline := time.Now().Add(closeTimeout)
+		s.client.conn.SetDeadline(deadline)
+		s.server.conn.SetDeadline(deadline)
+	})
+}
+
+// abort closes both connections immediately.
+func (s *session) abort() {
+	s.client.conn.Close()
+	s.server.conn.Close()
+}
+
+// fail closes the connection because src violates the protocol,
+// src gets the code and dst is told the proxy is going away.
+func (s *session) fail(src, dst *endpoint, code int, reason string) {
+	logger.Warnf("%s: close websocket connection: %s sent %s",
+		s.wf.pipeSpec.Name(), src.name(), reason)
+
+	src.write(&frame{fin: true, opcode: opClose, payload: closePayload(code, reason)})
+	dst.write(&frame{fin: true, opcode: opClose, payload: closePayload(closeGoingAway, "")})
+	s.closing()
+}
+
+// drain discards the frames from src until its close frame.
+func (s *session) drain(src *endpoint) {
+	for {
+		f, err := readFrame(src.r, s.wf.spec.MaxMessageSize, !src.masked)
+		if err != nil || f.opcode == opClose {
+			return
+		}
+	}
+}
+
+func (s *session) relay(src, dst *endpoint) {
+	fromClient := !src.masked
+	var msg *message
+
+	for {
+		f, err := readFrame(src.r, s.wf.spec.MaxMessageSize, fromClient)
+		if err != nil {
+			if pe, ok := err.(*protocolError); ok {
+				atomic.AddUint64(&s.wf.protocolErrors, 1)
+				// NOTE: The stream is out of sync, so it can't be drained.
+				s.fail(src, dst, pe.code, pe.reason)
+			}
+			s.abort()
+			return
+		}
+
+		if isControl(f.opcode) {
+			if err := dst.write(f); err != nil {
+				s.abort()
+				return
+			}
+			if f.opcode == opClose {
+				s.closing()
+				return
+			}
+			continue
+		}
+
+		if f.opcode == opContinuation {
+			if msg == nil {
+				atomic.AddUint64(&s.wf.protocolErrors, 1)
+				s.fail(src, dst, closeProtocolError, "unexpected continuation frame")
+				s.drain(src)
+				return
+			}
+			if int64(len(msg.payload)+len(f.payload)) > s.wf.spec.MaxMessageSize {
+				s.fail(src, dst, closeMessageTooBig, "message too big")
+				s.drain(src)
+				return
+			}
+			msg.payload = append(msg.payload, f.payload...)
+		} else {
+			if msg != nil {
+				atomic.AddUint64(&s.wf.protocolErrors, 1)
+				s.fail(src, dst, closeProtocolError, "expected continuation frame")
+				s.drain(src)
+				return
+			}
+			msg = &message{opcode: f.opcode, payload: f.payload, fromClient: fromClient}
+		}
+
+		if !f.fin {
+			continue
+		}
+
+		m := msg
+		msg = nil
+		if !s.deliver(m, src, dst) {
+			return
+		}
+	}
+}
+
+// deliver forwards the message to dst, it returns false
+// if the connection is being closed.
+func (s *session) deliver(m *message, src, dst *endpoint) bool {
+	atomic.AddUint64(&s.wf.messages, 1)
+
+	if m.opcode == opText && !utf8.Valid(m.payload) {
+		atomic.AddUint64(&s.wf.invalidUTF8, 1)
+		if s.wf.spec.CloseOnInvalidUTF8 {
+			s.fail(src, dst, closeInvalidPayload, "invalid UTF-8 text message")
+			s.drain(src)
+			return false
+		}
+		logger.Warnf("%s: %s sent invalid UTF-8 text message", s.wf.pipeSpec.Name(), src.name())
+	}
+
+	if m.fromClient && s.rl != nil && !s.rl.WaitPermission() {
+		atomic.AddUint64(&s.wf.rateLimited, 1)
+		return true
+	}
+
+	m, drop := s.wf.onMessage(m)
+	if drop {
+		atomic.AddUint64(&s.wf.dropped, 1)
+		return true
+	}
+
+	if err := dst.write(&frame{fin: true, opcode: m.opcode, payload: m.payload}); err != nil {
+		s.abort()
+		return false
+	}
+	return true
+}
@@ -0,0 +1,469 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package websocket
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+	librl "github.com/megaease/easegress/pkg/util/ratelimiter"
+)
+
+const (
+	// Kind is the kind of WebSocketFilter.
+	Kind = "WebSocketFilter"
+
+	resultUpgradeFailed = "upgradeFailed"
+
+	directionClientToServer = "clientToServer"
+	directionServerToClient = "serverToClient"
+
+	messageTypeText   = "text"
+	messageTypeBinary = "binary"
+
+	actionDrop    = "drop"
+	actionReplace = "replace"
+)
+
+var (
+	results = []string{resultUpgradeFailed}
+)
+
+func init() {
+	httppipeline.Register(&WebSocketFilter{})
+}
+
+type (
+	// WebSocketFilter proxies WebSocket connections to the backend,
+	// and inspects and transforms the messages in both directions.
+	WebSocketFilter struct {
+		super    *supervisor.Supervisor
+		pipeSpec *httppipeline.FilterSpec
+		spec     *Spec
+
+		backend     *url.URL
+		dialTimeout time.Duration
+		rules       []*rule
+
+		// The counters are accessed atomically.
+		activeConnections int64
+		connections       uint64
+		messages          uint64
+		dropped           uint64
+		rateLimited       uint64
+		invalidUTF8       uint64
+		protocolErrors    uint64
+	}
+
+	// Spec describes the WebSocketFilter.
+	Spec struct {
+		// Backend is the address of the WebSocket server, such as
+		// ws://127.0.0.1:8080, the path and query of the request are kept.
+		Backend     string `yaml:"backend" jsonschema:"required,format=uri"`
+		DialTimeout string `yaml:"dialTimeout" jsonschema:"omitempty,format=duration"`
+		// MaxMessageSize bounds the messages reassembled from fragments,
+		// the connection is closed with 1009 if it's exceeded.
+		MaxMessageSize int64 `yaml:"maxMessageSize,omitempty" jsonschema:"omitempty,minimum=1"`
+		// CloseOnInvalidUTF8 closes the connection with 1007 on text
+		// messages which are not valid UTF-8, they are logged and
+		// forwarded otherwise.
+		CloseOnInvalidUTF8 bool `yaml:"closeOnInvalidUTF8"`
+
+		Rules     []*Rule        `yaml:"rules" jsonschema:"omitempty"`
+		RateLimit *RateLimitSpec `yaml:"rateLimit,omitempty" jsonschema:"omitempty"`
+	}
+
+	// Rule matches messages and drops or transforms them,
+	// the rules are applied in order until a message is dropped.
+	Rule struct {
+		Direction   string `yaml:"direction,omitempty" jsonschema:"omitempty,enum=clientToServer,enum=serverToClient"`
+		MessageType string `yaml:"messageType,omitempty" jsonschema:"omitempty,enum=text,enum=binary"`
+		Match       string `yaml:"match" jsonschema:"required,format=regexp"`
+		Action      string `yaml:"action" jsonschema:"required,enum=drop,enum=replace"`
+		// Replacement supports the expansion of regexp.ReplaceAll, such as $1.
+		Replacement string `yaml:"replacement" jsonschema:"omitempty"`
+	}
+
+	// RateLimitSpec limits the messages from the client per connection,
+	// the messages which can't be permitted within timeoutDuration are dropped.
+	RateLimitSpec struct {
+		TimeoutDuration    string `yaml:"timeoutDuration" jsonschema:"omitempty,format=duration"`
+		LimitRefreshPeriod string `yaml:"limitRefreshPeriod" jsonschema:"omitempty,format=duration"`
+		LimitForPeriod     int    `yaml:"limitForPeriod" jsonschema:"omitempty,minimum=1"`
+	}
+
+	// Status is the status of WebSocketFilter.
+	Status struct {
+		ActiveConnections int64  `yaml:"activeConnections"`
+		Connections       uint64 `yaml:"connections"`
+		Messages          uint64 `yaml:"messages"`
+		Dropped           uint64 `yaml:"dropped"`
+		RateLimited       uint64 `yaml:"rateLimited"`
+		InvalidUTF8       uint64 `yaml:"invalidUTF8"`
+		ProtocolErrors    uint64 `yaml:"protocolErrors"`
+	}
+
+	rule struct {
+		*Rule
+		re *regexp.Regexp
+	}
+
+	// message is a complete data message, the fragments are reassembled.
+	message struct {
+		opcode     byte
+		payload    []byte
+		fromClient bool
+	}
+
+	// backendBody closes the backend connection along with the body
+	// of the rejected handshake.
+	backendBody struct {
+		io.ReadCloser
+		conn net.Conn
+	}
+)
+
+// Validate validates Spec.
+func (s Spec) Validate() error {
+	u, err := url.Parse(s.Backend)
+	if err != nil {
+		return fmt.Errorf("invalid backend %s: %v", s.Backend, err)
+	}
+	switch u.Scheme {
+	case "ws", "wss", "http", "https":
+	default:
+		return fmt.Errorf("invalid backend %s: unsupported scheme %s", s.Backend, u.Scheme)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid backend %s: host is required", s.Backend)
+	}
+	if u.Path != "" && u.Path != "/" {
+		return fmt.Errorf("invalid backend %s: path is not supported", s.Backend)
+	}
+
+	for i, r := range s.Rules {
+		if _, err := regexp.Compile(r.Match); err != nil {
+			return fmt.Errorf("rule %d: invalid match %s: %v", i, r.Match, err)
+		}
+	}
+
+	return nil
+}
+
+// Kind returns the kind of WebSocketFilter.
+func (wf *WebSocketFilter) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of WebSocketFilter.
+func (wf *WebSocketFilter) DefaultSpec() interface{} {
+	return &Spec{
+		DialTimeout:    "10s",
+		MaxMessageSize: 1024 * 1024,
+	}
+}
+
+// Description returns the description of WebSocketFilter.
+func (wf *WebSocketFilter) Description() string {
+	return "WebSocketFilter proxies WebSocket connections and inspects the messages."
+}
+
+// Results returns the results of WebSocketFilter.
+func (wf *WebSocketFilter) Results() []string {
+	return results
+}
+
+// Init initializes WebSocketFilter.
+func (wf *WebSocketFilter) Init(pipeSpec *httppipeline.FilterSpec, super *supervisor.Supervisor) {
+	wf.pipeSpec, wf.spec, wf.super = pipeSpec, pipeSpec.FilterSpec().(*Spec), super
+	wf.reload()
+}
+
+// Inherit inherits previous generation of WebSocketFilter.
+func (wf *WebSocketFilter) Inherit(pipeSpec *httppipeline.FilterSpec,
+	previousGeneration httppipeline.Filter, super *supervisor.Supervisor) {
+
+	// NOTE: The established connections keep working with
+	// the previous generation until they are closed.
+	previousGeneration.Close()
+	wf.Init(pipeSpec, super)
+}
+
+func (wf *WebSocketFilter) reload() {
+	wf.backend, _ = url.Parse(wf.spec.Backend)
+
+	wf.dialTimeout = 10 * time.Second
+	if d, err := time.ParseDuration(wf.spec.DialTimeout); err == nil {
+		wf.dialTimeout = d
+	} else if wf.spec.DialTimeout != "" {
+		logger.Errorf("BUG: parse duration %s failed: %v", wf.spec.DialTimeout, err)
+	}
+
+	if wf.spec.MaxMessageSize <= 0 {
+		wf.spec.MaxMessageSize = 1024 * 1024
+	}
+
+	wf.rules = nil
+	for _, r := range wf.spec.Rules {
+		wf.rules = append(wf.rules, &rule{Rule: r, re: regexp.MustCompile(r.Match)})
+	}
+}
+
+func newRateLimiter(spec *RateLimitSpec) *librl.RateLimiter {
+	policy := librl.NewPolicy()
+
+	if spec.LimitForPeriod > 0 {
+		policy.LimitForPeriod = spec.LimitForPeriod
+	}
+	if d, err := time.ParseDuration(spec.TimeoutDuration); err == nil {
+		policy.TimeoutDuration = d
+	}
+	if d, err := time.ParseDuration(spec.LimitRefreshPeriod); err == nil && d > 0 {
+		policy.LimitRefreshPeriod = d
+	}
+
+	return librl.New(policy)
+}
+
+// Handle proxies the WebSocket connection, it returns after the
+// connection is closed. Other requests are passed through.
+func (wf *WebSocketFilter) Handle(ctx context.HTTPContext) (result string) {
+	result = wf.handle(ctx)
+	return ctx.CallNextHandler(result)
+}
+
+// isUpgrade reports whether the request is a WebSocket opening handshake.
+func isUpgrade(r *http.Request) bool {
+	if r.Method != http.MethodGet || !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return false
+	}
+	for _, value := range r.Header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (wf *WebSocketFilter) handle(ctx context.HTTPContext) string {
+	r := ctx.Request().Std()
+	if !isUpgrade(r) {
+		return ""
+	}
+
+	backendConn, err := wf.dial()
+	if err != nil {
+		logger.Errorf("%s: dial backend %s failed: %v", wf.pipeSpec.Name(), wf.spec.Backend, err)
+		ctx.Response().SetStatusCode(http.StatusBadGateway)
+		return resultUpgradeFailed
+	}
+
+	br := bufio.NewReader(backendConn)
+	resp, err := wf.handshake(r, backendConn, br)
+	if err != nil {
+		backendConn.Close()
+		logger.Errorf("%s: handshake with backend %s failed: %v",
+			wf.pipeSpec.Name(), wf.spec.Backend, err)
+		ctx.Response().SetStatusCode(http.StatusBadGateway)
+		return resultUpgradeFailed
+	}
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		ctx.Response().SetStatusCode(resp.StatusCode)
+		ctx.Response().Header().AddFromStd(resp.Header)
+		ctx.Response().SetBody(&backendBody{ReadCloser: resp.Body, conn: backendConn})
+		return resultUpgradeFailed
+	}
+
+	ctx.Response().SetStatusCode(http.StatusSwitchingProtocols)
+	clientConn, clientRW, err := ctx.Response().Hijack()
+	if err != nil {
+		backendConn.Close()
+		logger.Errorf("%s: hijack connection failed: %v", wf.pipeSpec.Name(), err)
+		ctx.Response().SetStatusCode(http.StatusInternalServerError)
+		return resultUpgradeFailed
+	}
+
+	// NOTE: The deadlines of the HTTP server don't apply to WebSocket.
+	clientConn.SetDeadline(time.Time{})
+
+	clientRW.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	resp.Header.Write(clientRW)
+	clientRW.WriteString("\r\n")
+	if err := clientRW.Flush(); err != nil {
+		clientConn.Close()
+		backendConn.Close()
+		return ""
+	}
+
+	s := &session{
+		wf:     wf,
+		client: &endpoint{conn: clientConn, r: clientRW.Reader},
+		server: &endpoint{conn: backendConn, r: br, masked: true},
+	}
+	if wf.spec.RateLimit != nil {
+		s.rl = newRateLimiter(wf.spec.RateLimit)
+	}
+
+	atomic.AddUint64(&wf.connections, 1)
+	atomic.AddInt64(&wf.activeConnections, 1)
+	defer atomic.AddInt64(&wf.activeConnections, -1)
+
+	s.run()
+
+	return ""
+}
+
+func (wf *WebSocketFilter) dial() (net.Conn, error) {
+	host := wf.backend.Host
+	secure := wf.backend.Scheme == "wss" || wf.backend.Scheme == "https"
+	if wf.backend.Port() == "" {
+		if secure {
+			host = net.JoinHostPort(wf.backend.Hostname(), "443")
+		} else {
+			host = net.JoinHostPort(wf.backend.Hostname(), "80")
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: wf.dialTimeout}
+	if secure {
+		return tls.DialWithDialer(dialer, "tcp", host, &tls.Config{
+			ServerName: wf.backend.Hostname(),
+		})
+	}
+	return dialer.Dial("tcp", host)
+}
+
+// handshake forwards the opening handshake to the backend.
+func (wf *WebSocketFilter) handshake(r *http.Request, conn net.Conn, br *bufio.Reader) (*http.Response, error) {
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        &url.URL{Path: r.URL.Path, RawPath: r.URL.RawPath, RawQuery: r.URL.RawQuery},
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     r.Header.Clone(),
+		Host:       wf.backend.Host,
+	}
+	// NOTE: The messages can't be inspected if they are compressed.
+	req.Header.Del("Sec-WebSocket-Extensions")
+
+	conn.SetDeadline(time.Now().Add(wf.dialTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		if !strings.EqualFold(resp.Header.Get("Upgrade"), "websocket") {
+			return nil, fmt.Errorf("unexpected upgrade %q", resp.Header.Get("Upgrade"))
+		}
+		if resp.Header.Get("Sec-WebSocket-Extensions") != "" {
+			return nil, fmt.Errorf("unexpected extensions %q", resp.Header.Get("Sec-WebSocket-Extensions"))
+		}
+	}
+
+	return resp, nil
+}
+
+// onMessage applies the rules to the message, the transformed
+// message is forwarded unless it's dropped.
+func (wf *WebSocketFilter) onMessage(m *message) (transformed *message, drop bool) {
+	for _, r := range wf.rules {
+		if !r.matches(m) {
+			continue
+		}
+
+		switch r.Action {
+		case actionDrop:
+			return m, true
+		case actionReplace:
+			m.payload = r.re.ReplaceAll(m.payload, []byte(r.Replacement))
+		}
+	}
+
+	return m, false
+}
+
+func (r *rule) matches(m *message) bool {
+	switch r.Direction {
+	case directionClientToServer:
+		if !m.fromClient {
+			return false
+		}
+	case directionServerToClient:
+		if m.fromClient {
+			return false
+		}
+	}
+
+	switch r.MessageType {
+	case messageTypeText:
+		if m.opcode != opText {
+			return false
+		}
+	case messageTypeBinary:
+		if m.opcode != opBinary {
+			return false
+		}
+	}
+
+	return r.re.Match(m.payload)
+}
+
+// Status returns status.
+func (wf *WebSocketFilter) Status() interface{} {
+	return &Status{
+		ActiveConnections: atomic.LoadInt64(&wf.activeConnections),
+		Connections:       atomic.LoadUint64(&wf.connections),
+		Messages:          atomic.LoadUint64(&wf.messages),
+		Dropped:           atomic.LoadUint64(&wf.dropped),
+		RateLimited:       atomic.LoadUint64(&wf.rateLimited),
+		InvalidUTF8:       atomic.LoadUint64(&wf.invalidUTF8),
+		ProtocolErrors:    atomic.LoadUint64(&wf.protocolErrors),
+	}
+}
+
+// Close closes WebSocketFilter.
+func (wf *WebSocketFilter) Close() {}
+
+func (b *backendBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.conn.Close()
+	return err
+}
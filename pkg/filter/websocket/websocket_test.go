@@ -0,0 +1,406 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/option"
+	"github.com/megaease/easegress/pkg/tracing"
+)
+
+const testKey = "dGhlIHNhbXBsZSBub25jZQ=="
+
+func TestMain(m *testing.M) {
+	tempDir, err := ioutil.TempDir("", "eg-websocket-test")
+	if err != nil {
+		panic(err)
+	}
+	absLogDir := filepath.Join(tempDir, "log")
+	os.MkdirAll(absLogDir, 0755)
+	logger.Init(&option.Options{
+		Name:      "websocket-for-log",
+		AbsLogDir: absLogDir,
+	})
+
+	code := m.Run()
+
+	logger.Sync()
+	os.RemoveAll(tempDir)
+
+	os.Exit(code)
+}
+
+func acceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// newEchoServer echoes the messages, and responds the close frame.
+func newEchoServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Sec-WebSocket-Extensions") != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.URL.Path == "/forbidden" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\n"+
+			"Connection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+			acceptKey(r.Header.Get("Sec-WebSocket-Key")))
+		rw.Flush()
+
+		for {
+			f, err := readFrame(rw.Reader, 1<<20, true)
+			if err != nil {
+				return
+			}
+			writeFrame(conn, f, false)
+			if f.opcode == opClose {
+				return
+			}
+		}
+	}))
+}
+
+type testClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func newTestFilter(t *testing.T, spec *Spec) *WebSocketFilter {
+	pipeSpec, err := httppipeline.NewFilterSpec(
+		&httppipeline.FilterMetaSpec{Name: "websocket", Kind: Kind}, spec)
+	if err != nil {
+		t.Fatalf("new filter spec failed: %v", err)
+	}
+
+	wf := &WebSocketFilter{}
+	wf.Init(pipeSpec, nil)
+	return wf
+}
+
+// newFrontServer serves the filter, results receives the result of each request.
+func newFrontServer(wf *WebSocketFilter, results chan string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.New(w, r, tracing.NoopTracing, "no trace")
+		result := wf.handle(ctx)
+		ctx.Finish()
+		if results != nil {
+			results <- result
+		}
+	}))
+}
+
+func dialTestClient(t *testing.T, addr, path string) *testClient {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(addr, "http://"))
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: example.com\r\nUpgrade: websocket\r\n"+
+		"Connection: keep-alive, Upgrade\r\nSec-WebSocket-Key: %s\r\nSec-WebSocket-Version: 13\r\n"+
+		"Sec-WebSocket-Extensions: permessage-deflate\r\n\r\n", path, testKey)
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatalf("read handshake response failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("want status 101, got %d", resp.StatusCode)
+	}
+	if accept := resp.Header.Get("Sec-WebSocket-Accept"); accept != acceptKey(testKey) {
+		t.Fatalf("want accept %s, got %s", acceptKey(testKey), accept)
+	}
+
+	return &testClient{conn: conn, r: br}
+}
+
+func (c *testClient) send(t *testing.T, f *frame) {
+	if err := writeFrame(c.conn, f, true); err != nil {
+		t.Fatalf("write frame failed: %v", err)
+	}
+}
+
+func (c *testClient) sendText(t *testing.T, text string) {
+	c.send(t, &frame{fin: true, opcode: opText, payload: []byte(text)})
+}
+
+func (c *testClient) receive(t *testing.T) *frame {
+	f, err := readFrame(c.r, 1<<20, false)
+	if err != nil {
+		t.Fatalf("read frame failed: %v", err)
+	}
+	return f
+}
+
+func (c *testClient) receiveText(t *testing.T, want string) {
+	f := c.receive(t)
+	if f.opcode != opText || string(f.payload) != want {
+		t.Fatalf("want text %q, got opcode %d payload %q", want, f.opcode, f.payload)
+	}
+}
+
+func (c *testClient) receiveClose(t *testing.T, code int) {
+	f := c.receive(t)
+	if f.opcode != opClose {
+		t.Fatalf("want close frame, got opcode %d payload %q", f.opcode, f.payload)
+	}
+	if got := int(binary.BigEndian.Uint16(f.payload)); got != code {
+		t.Fatalf("want close code %d, got %d", code, got)
+	}
+}
+
+func (c *testClient) close(t *testing.T) {
+	c.send(t, &frame{fin: true, opcode: opClose, payload: closePayload(closeGoingAway, "")})
+	c.receiveClose(t, closeGoingAway)
+	c.conn.Close()
+}
+
+func TestValidate(t *testing.T) {
+	valid := []string{"ws://127.0.0.1:8080", "wss://example.com/", "http://example.com"}
+	for _, backend := range valid {
+		if err := (Spec{Backend: backend}).Validate(); err != nil {
+			t.Errorf("backend %s: unexpected error: %v", backend, err)
+		}
+	}
+
+	invalid := []*Spec{
+		{Backend: "ftp://example.com"},
+		{Backend: "ws://"},
+		{Backend: "ws://example.com/chat"},
+		{Backend: "ws://example.com", Rules: []*Rule{{Match: "(", Action: actionDrop}}},
+	}
+	for _, spec := range invalid {
+		if err := spec.Validate(); err == nil {
+			t.Errorf("spec %+v: want error", spec)
+		}
+	}
+}
+
+func TestNonUpgradePassThrough(t *testing.T) {
+	wf := newTestFilter(t, &Spec{Backend: "ws://127.0.0.1:1"})
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	ctx := context.New(httptest.NewRecorder(), req, tracing.NoopTracing, "no trace")
+	if result := wf.handle(ctx); result != "" {
+		t.Errorf("want empty result, got %s", result)
+	}
+	if code := ctx.Response().StatusCode(); code != http.StatusOK {
+		t.Errorf("want status 200, got %d", code)
+	}
+}
+
+func TestEcho(t *testing.T) {
+	backend := newEchoServer()
+	defer backend.Close()
+
+	wf := newTestFilter(t, &Spec{Backend: strings.Replace(backend.URL, "http", "ws", 1)})
+	results := make(chan string, 1)
+	front := newFrontServer(wf, results)
+	defer front.Close()
+
+	c := dialTestClient(t, front.URL, "/chat")
+
+	c.sendText(t, "hello")
+	c.receiveText(t, "hello")
+
+	c.send(t, &frame{fin: true, opcode: opBinary, payload: []byte{0, 1, 2}})
+	if f := c.receive(t); f.opcode != opBinary || string(f.payload) != "\x00\x01\x02" {
+		t.Fatalf("binary message mismatch: %v", f.payload)
+	}
+
+	// A ping between fragments is relayed right away.
+	c.send(t, &frame{opcode: opText, payload: []byte("frag")})
+	c.send(t, &frame{fin: true, opcode: opPing, payload: []byte("p")})
+	c.send(t, &frame{fin: true, opcode: opContinuation, payload: []byte("ments")})
+	if f := c.receive(t); f.opcode != opPing {
+		t.Fatalf("want ping, got opcode %d", f.opcode)
+	}
+	c.receiveText(t, "fragments")
+
+	if status := wf.Status().(*Status); status.ActiveConnections != 1 || status.Connections != 1 {
+		t.Errorf("unexpected status: %+v", status)
+	}
+
+	c.close(t)
+	if result := <-results; result != "" {
+		t.Errorf("want empty result, got %s", result)
+	}
+
+	status := wf.Status().(*Status)
+	if status.ActiveConnections != 0 || status.Messages != 6 {
+		t.Errorf("unexpected status: %+v", status)
+	}
+}
+
+func TestRules(t *testing.T) {
+	backend := newEchoServer()
+	defer backend.Close()
+
+	wf := newTestFilter(t, &Spec{
+		Backend: backend.URL,
+		Rules: []*Rule{
+			{Direction: directionClientToServer, Match: "^secret", Action: actionDrop},
+			{Direction: directionServerToClient, MessageType: messageTypeText,
+				Match: `world(\d)`, Action: actionReplace, Replacement: "easegress$1"},
+			{MessageType: messageTypeBinary, Match: "\x00", Action: actionDrop},
+		},
+	})
+	front := newFrontServer(wf, nil)
+	defer front.Close()
+
+	c := dialTestClient(t, front.URL, "/")
+
+	c.sendText(t, "secret password")
+	c.send(t, &frame{fin: true, opcode: opBinary, payload: []byte{0}})
+	c.sendText(t, "hello world1")
+	c.receiveText(t, "hello easegress1")
+	c.close(t)
+
+	if status := wf.Status().(*Status); status.Dropped != 2 {
+		t.Errorf("want 2 dropped messages, got %d", status.Dropped)
+	}
+}
+
+func TestInvalidUTF8(t *testing.T) {
+	backend := newEchoServer()
+	defer backend.Close()
+
+	wf := newTestFilter(t, &Spec{Backend: backend.URL})
+	front := newFrontServer(wf, nil)
+	defer front.Close()
+
+	c := dialTestClient(t, front.URL, "/")
+	c.sendText(t, "\xff")
+	c.receiveText(t, "\xff")
+	c.close(t)
+
+	wf = newTestFilter(t, &Spec{Backend: backend.URL, CloseOnInvalidUTF8: true})
+	front2 := newFrontServer(wf, nil)
+	defer front2.Close()
+
+	c = dialTestClient(t, front2.URL, "/")
+	c.sendText(t, "\xff")
+	c.receiveClose(t, closeInvalidPayload)
+	c.send(t, &frame{fin: true, opcode: opClose, payload: closePayload(closeInvalidPayload, "")})
+	if _, err := readFrame(c.r, 1<<20, false); err == nil {
+		t.Errorf("want connection closed")
+	}
+
+	if status := wf.Status().(*Status); status.InvalidUTF8 != 1 {
+		t.Errorf("want 1 invalid message, got %d", status.InvalidUTF8)
+	}
+}
+
+func TestMessageTooBig(t *testing.T) {
+	backend := newEchoServer()
+	defer backend.Close()
+
+	wf := newTestFilter(t, &Spec{Backend: backend.URL, MaxMessageSize: 4})
+	front := newFrontServer(wf, nil)
+	defer front.Close()
+
+	c := dialTestClient(t, front.URL, "/")
+	c.send(t, &frame{opcode: opText, payload: []byte("abc")})
+	c.send(t, &frame{fin: true, opcode: opContinuation, payload: []byte("def")})
+	c.receiveClose(t, closeMessageTooBig)
+}
+
+func TestRateLimit(t *testing.T) {
+	backend := newEchoServer()
+	defer backend.Close()
+
+	wf := newTestFilter(t, &Spec{
+		Backend: backend.URL,
+		RateLimit: &RateLimitSpec{
+			TimeoutDuration:    "0s",
+			LimitRefreshPeriod: "1h",
+			LimitForPeriod:     1,
+		},
+	})
+	front := newFrontServer(wf, nil)
+	defer front.Close()
+
+	c := dialTestClient(t, front.URL, "/")
+	c.sendText(t, "1")
+	c.sendText(t, "2")
+	c.sendText(t, "3")
+	c.receiveText(t, "1")
+	c.close(t)
+
+	if status := wf.Status().(*Status); status.RateLimited != 2 {
+		t.Errorf("want 2 rate limited messages, got %d", status.RateLimited)
+	}
+}
+
+func TestUpgradeRejected(t *testing.T) {
+	backend := newEchoServer()
+	defer backend.Close()
+
+	wf := newTestFilter(t, &Spec{Backend: backend.URL})
+	results := make(chan string, 1)
+	front := newFrontServer(wf, results)
+	defer front.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, front.URL+"/forbidden", nil)
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", testKey)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("want status 403, got %d", resp.StatusCode)
+	}
+	if result := <-results; result != resultUpgradeFailed {
+		t.Errorf("want result %s, got %s", resultUpgradeFailed, result)
+	}
+}
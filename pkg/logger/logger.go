@@ -18,6 +18,7 @@
 package logger
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"time"
@@ -61,6 +62,10 @@ var (
 	httpFilterAccessLogger *zap.Logger
 	httpFilterDumpLogger   *zap.Logger
 	restAPILogger          *zap.Logger
+
+	// defaultLevel is the lowest level of defaultLogger, stderrLogger and gressLogger,
+	// which could be changed at runtime.
+	defaultLevel = zap.NewAtomicLevel()
 )
 
 // EtcdClientLoggerConfig generates the config of etcd client logger.
@@ -104,9 +109,9 @@ func defaultEncoderConfig() zapcore.EncoderConfig {
 func initDefault(opt *option.Options) {
 	encoderConfig := defaultEncoderConfig()
 
-	lowestLevel := zap.InfoLevel
+	defaultLevel.SetLevel(zap.InfoLevel)
 	if opt.Debug {
-		lowestLevel = zap.DebugLevel
+		defaultLevel.SetLevel(zap.DebugLevel)
 	}
 
 	lf, err := newLogFile(filepath.Join(opt.AbsLogDir, stdoutFilename), systemLogMaxCacheCount)
@@ -117,17 +122,46 @@ func initDefault(opt *option.Options) {
 	opts := []zap.Option{zap.AddCaller(), zap.AddCallerSkip(1)}
 
 	stderrSyncer := zapcore.AddSync(os.Stderr)
-	stderrCore := zapcore.NewCore(zapcore.NewConsoleEncoder(encoderConfig), stderrSyncer, lowestLevel)
+	stderrCore := zapcore.NewCore(zapcore.NewConsoleEncoder(encoderConfig), stderrSyncer, defaultLevel)
 	stderrLogger = zap.New(stderrCore, opts...).Sugar()
 
 	gatewaySyncer := zapcore.AddSync(lf)
-	gatewayCore := zapcore.NewCore(zapcore.NewConsoleEncoder(encoderConfig), gatewaySyncer, lowestLevel)
+	gatewayCore := zapcore.NewCore(zapcore.NewConsoleEncoder(encoderConfig), gatewaySyncer, defaultLevel)
 	gressLogger = zap.New(gatewayCore, opts...).Sugar()
 
-	defaultCore := zapcore.NewTee(gatewayCore, stderrCore)
+	// NOTE: The ring keeps the latest records in memory for tailing logs
+	// through the admin API.
+	ringCore := newRingCore(defaultLogRing, defaultLevel)
+
+	defaultCore := zapcore.NewTee(gatewayCore, stderrCore, ringCore)
 	defaultLogger = zap.New(defaultCore, opts...).Sugar()
 }
 
+// SetLevel sets the lowest level of the default logger at runtime,
+// the level must be one of debug, info, warn and error.
+func SetLevel(level string) error {
+	var l zapcore.Level
+	err := l.UnmarshalText([]byte(level))
+	if err != nil {
+		return err
+	}
+
+	switch l {
+	case zap.DebugLevel, zap.InfoLevel, zap.WarnLevel, zap.ErrorLevel:
+	default:
+		return fmt.Errorf("unsupported level %s", level)
+	}
+
+	defaultLevel.SetLevel(l)
+
+	return nil
+}
+
+// Level returns the lowest level of the default logger.
+func Level() string {
+	return defaultLevel.Level().String()
+}
+
 func initHTTPFilter(opt *option.Options) {
 	httpFilterAccessLogger = newPlainLogger(opt, filterHTTPAccessFilename, trafficLogMaxCacheCount)
 	httpFilterDumpLogger = newPlainLogger(opt, filterHTTPDumpFilename, trafficLogMaxCacheCount)
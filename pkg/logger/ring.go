@@ -0,0 +1,292 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package logger
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/util/timetool"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// logRingCapacity is the number of the latest records kept in memory.
+	logRingCapacity = 10000
+)
+
+type (
+	// LogRecord is a record of the default logger kept in memory.
+	LogRecord struct {
+		Time    time.Time `yaml:"time"`
+		Level   string    `yaml:"level"`
+		Caller  string    `yaml:"caller"`
+		Message string    `yaml:"message"`
+
+		level zapcore.Level
+	}
+
+	// LogFilter selects log records, the zero value selects all.
+	LogFilter struct {
+		// Level is the lowest level.
+		Level zapcore.Level
+		// Object selects the records mentioning the object name.
+		Object string
+		// Text selects the records containing the text, case-insensitively.
+		Text string
+	}
+
+	// LogSubscription receives the new records selected by its filter.
+	// If the receiver falls behind, the oldest unreceived records
+	// are dropped instead of blocking the logger.
+	LogSubscription struct {
+		ring    *logRing
+		filter  *LogFilter
+		records chan *LogRecord
+		// dropped is accessed atomically.
+		dropped   uint64
+		closeOnce sync.Once
+	}
+
+	// logRing is a fixed size ring buffer of log records,
+	// fanning new records out to the subscriptions.
+	logRing struct {
+		mutex         sync.Mutex
+		records       []*LogRecord
+		next          int
+		full          bool
+		subscriptions map[*LogSubscription]struct{}
+	}
+
+	// ringCore is the zapcore.Core writing to a logRing.
+	ringCore struct {
+		zapcore.LevelEnabler
+		ring *logRing
+	}
+)
+
+var defaultLogRing = newLogRing(logRingCapacity)
+
+// NewLogFilter creates a log filter, the empty level means debug.
+func NewLogFilter(level, object, text string) (*LogFilter, error) {
+	f := &LogFilter{
+		Level:  zapcore.DebugLevel,
+		Object: object,
+		Text:   strings.ToLower(text),
+	}
+
+	if level != "" {
+		err := f.Level.UnmarshalText([]byte(level))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return f, nil
+}
+
+func (f *LogFilter) match(r *LogRecord) bool {
+	if r.level < f.Level {
+		return false
+	}
+	if f.Object != "" && !strings.Contains(r.Message, f.Object) {
+		return false
+	}
+	if f.Text != "" && !strings.Contains(strings.ToLower(r.Message), f.Text) {
+		return false
+	}
+
+	return true
+}
+
+// String returns the record in the format of the log file.
+func (r *LogRecord) String() string {
+	return fmt.Sprintf("%s\t%s\t%s\t%s",
+		r.Time.Format(timetool.RFC3339Milli), r.Level, r.Caller, r.Message)
+}
+
+// TailLogs returns at most the last n records selected by the filter
+// in chronological order.
+func TailLogs(filter *LogFilter, n int) []*LogRecord {
+	return defaultLogRing.tail(filter, n)
+}
+
+// SubscribeLogs returns at most the last n records selected by the filter,
+// and the subscription to the following ones without gaps or duplicates.
+// The subscription buffers up to size records, it must be closed after use.
+func SubscribeLogs(filter *LogFilter, n, size int) ([]*LogRecord, *LogSubscription) {
+	return defaultLogRing.subscribe(filter, n, size)
+}
+
+func newLogRing(capacity int) *logRing {
+	return &logRing{
+		records:       make([]*LogRecord, capacity),
+		subscriptions: make(map[*LogSubscription]struct{}),
+	}
+}
+
+func (r *logRing) append(record *LogRecord) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.records[r.next] = record
+	r.next++
+	if r.next == len(r.records) {
+		r.next, r.full = 0, true
+	}
+
+	for s := range r.subscriptions {
+		if s.filter.match(record) {
+			s.push(record)
+		}
+	}
+}
+
+// tailLocked returns at most the last n records selected by the filter,
+// the caller must hold the mutex.
+func (r *logRing) tailLocked(filter *LogFilter, n int) []*LogRecord {
+	if n <= 0 {
+		return nil
+	}
+
+	count := r.next
+	if r.full {
+		count = len(r.records)
+	}
+
+	var records []*LogRecord
+	for i := 1; i <= count && len(records) < n; i++ {
+		record := r.records[(r.next-i+len(r.records))%len(r.records)]
+		if filter.match(record) {
+			records = append(records, record)
+		}
+	}
+
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+
+	return records
+}
+
+func (r *logRing) tail(filter *LogFilter, n int) []*LogRecord {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.tailLocked(filter, n)
+}
+
+func (r *logRing) subscribe(filter *LogFilter, n, size int) ([]*LogRecord, *LogSubscription) {
+	if size < 1 {
+		size = 1
+	}
+
+	s := &LogSubscription{
+		ring:    r,
+		filter:  filter,
+		records: make(chan *LogRecord, size),
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.subscriptions[s] = struct{}{}
+
+	return r.tailLocked(filter, n), s
+}
+
+func (r *logRing) unsubscribe(s *LogSubscription) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.subscriptions, s)
+}
+
+// push sends the record without blocking, it drops the oldest
+// unreceived record if the buffer is full.
+func (s *LogSubscription) push(record *LogRecord) {
+	for {
+		select {
+		case s.records <- record:
+			return
+		default:
+		}
+
+		select {
+		case <-s.records:
+			atomic.AddUint64(&s.dropped, 1)
+		default:
+		}
+	}
+}
+
+// Records returns the channel of the new records.
+func (s *LogSubscription) Records() <-chan *LogRecord {
+	return s.records
+}
+
+// Dropped returns the number of records dropped for falling behind.
+func (s *LogSubscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Close stops the subscription.
+func (s *LogSubscription) Close() {
+	s.closeOnce.Do(func() {
+		s.ring.unsubscribe(s)
+	})
+}
+
+func newRingCore(ring *logRing, enab zapcore.LevelEnabler) zapcore.Core {
+	return &ringCore{
+		LevelEnabler: enab,
+		ring:         ring,
+	}
+}
+
+func (c *ringCore) With(fields []zapcore.Field) zapcore.Core {
+	// NOTE: The default logger has no fields.
+	return c
+}
+
+func (c *ringCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *ringCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	c.ring.append(&LogRecord{
+		Time:    ent.Time,
+		Level:   ent.Level.CapitalString(),
+		Caller:  ent.Caller.TrimmedPath(),
+		Message: ent.Message,
+		level:   ent.Level,
+	})
+
+	return nil
+}
+
+func (c *ringCore) Sync() error {
+	return nil
+}
@@ -0,0 +1,140 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package logger
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func newTestRingLogger(ring *logRing, level zapcore.Level) *zap.SugaredLogger {
+	return zap.New(newRingCore(ring, level)).Sugar()
+}
+
+func messages(records []*LogRecord) []string {
+	msgs := make([]string, 0, len(records))
+	for _, r := range records {
+		msgs = append(msgs, r.Message)
+	}
+	return msgs
+}
+
+func TestLogRingTail(t *testing.T) {
+	ring := newLogRing(4)
+	l := newTestRingLogger(ring, zapcore.DebugLevel)
+
+	for i := 0; i < 6; i++ {
+		l.Infof("record %d", i)
+	}
+
+	all, _ := NewLogFilter("", "", "")
+	got := fmt.Sprint(messages(ring.tail(all, 10)))
+	if want := "[record 2 record 3 record 4 record 5]"; got != want {
+		t.Fatalf("want %s, got %s", want, got)
+	}
+
+	got = fmt.Sprint(messages(ring.tail(all, 2)))
+	if want := "[record 4 record 5]"; got != want {
+		t.Fatalf("want %s, got %s", want, got)
+	}
+}
+
+func TestLogFilter(t *testing.T) {
+	ring := newLogRing(16)
+	l := newTestRingLogger(ring, zapcore.DebugLevel)
+
+	l.Debugf("pipeline pipeline-demo reloaded")
+	l.Warnf("pipeline pipeline-demo: Upstream Timeout")
+	l.Errorf("pipeline pipeline-other: upstream timeout")
+
+	_, err := NewLogFilter("verbose", "", "")
+	if err == nil {
+		t.Fatalf("want error for unknown level")
+	}
+
+	cases := []struct {
+		level, object, text string
+		want                string
+	}{
+		{"", "", "", "3"},
+		{"warn", "", "", "2"},
+		{"", "pipeline-demo", "", "2"},
+		{"warn", "pipeline-demo", "", "1"},
+		{"", "", "upstream timeout", "2"},
+		{"error", "pipeline-demo", "timeout", "0"},
+	}
+	for _, c := range cases {
+		f, err := NewLogFilter(c.level, c.object, c.text)
+		if err != nil {
+			t.Fatalf("new filter failed: %v", err)
+		}
+		got := fmt.Sprint(len(ring.tail(f, 10)))
+		if got != c.want {
+			t.Errorf("%+v: want %s records, got %s", c, c.want, got)
+		}
+	}
+}
+
+func TestLogSubscription(t *testing.T) {
+	ring := newLogRing(16)
+	l := newTestRingLogger(ring, zapcore.InfoLevel)
+
+	l.Infof("before 0")
+	l.Infof("before 1")
+
+	all, _ := NewLogFilter("", "", "")
+	backlog, s := ring.subscribe(all, 1, 2)
+	defer s.Close()
+	if got, want := fmt.Sprint(messages(backlog)), "[before 1]"; got != want {
+		t.Fatalf("want %s, got %s", want, got)
+	}
+
+	l.Debugf("disabled")
+	for i := 0; i < 5; i++ {
+		l.Infof("after %d", i)
+	}
+
+	// NOTE: The slow receiver keeps the latest records only.
+	var got []string
+	for i := 0; i < 2; i++ {
+		select {
+		case r := <-s.Records():
+			got = append(got, r.Message)
+		case <-time.After(time.Second):
+			t.Fatalf("timeout")
+		}
+	}
+	if want := "[after 3 after 4]"; fmt.Sprint(got) != want {
+		t.Fatalf("want %s, got %s", want, got)
+	}
+	if s.Dropped() != 3 {
+		t.Fatalf("want 3 dropped, got %d", s.Dropped())
+	}
+
+	s.Close()
+	l.Infof("closed")
+	select {
+	case r := <-s.Records():
+		t.Fatalf("want no record after closing, got %s", r.Message)
+	default:
+	}
+}
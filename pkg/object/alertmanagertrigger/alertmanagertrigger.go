@@ -0,0 +1,284 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package alertmanagertrigger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocol"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/tracing"
+)
+
+const (
+	// Category is the category of AlertmanagerTrigger.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of AlertmanagerTrigger.
+	Kind = "AlertmanagerTrigger"
+
+	statusFiring   = "firing"
+	statusResolved = "resolved"
+
+	// AlertStatusHeader is the key of header carrying the alert status
+	// in the requests sent to the triggered pipelines.
+	AlertStatusHeader = "X-Alertmanager-Status"
+)
+
+func init() {
+	supervisor.Register(&AlertmanagerTrigger{})
+}
+
+type (
+	// AlertmanagerTrigger receives Prometheus Alertmanager webhooks,
+	// and fires the configured pipelines on matching alerts.
+	AlertmanagerTrigger struct {
+		super     *supervisor.Supervisor
+		superSpec *supervisor.Spec
+		spec      *Spec
+
+		mutex sync.Mutex
+		// firing holds the fingerprints of the firing alerts which
+		// have fired pipelines, to fire only on status transition.
+		firing   map[string]*Rule
+		fired    uint64
+		resolved uint64
+
+		// fire fires the pipeline with the alert, it's firePipeline if nil.
+		fire func(pipeline string, alert *Alert)
+	}
+
+	// Spec describes AlertmanagerTrigger.
+	Spec struct {
+		Rules []*Rule `yaml:"rules" jsonschema:"required,minItems=1"`
+	}
+
+	// Rule describes which alerts fire which pipelines.
+	Rule struct {
+		AlertName string            `yaml:"alertName" jsonschema:"required"`
+		Labels    map[string]string `yaml:"labels" jsonschema:"omitempty"`
+
+		// FiringPipeline is fired when the alert is firing.
+		FiringPipeline string `yaml:"firingPipeline" jsonschema:"required"`
+		// ResolvedPipeline is fired when the alert is resolved,
+		// to revert the changes made by FiringPipeline.
+		ResolvedPipeline string `yaml:"resolvedPipeline" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of AlertmanagerTrigger.
+	Status struct {
+		Firing   int    `yaml:"firing"`
+		Fired    uint64 `yaml:"fired"`
+		Resolved uint64 `yaml:"resolved"`
+	}
+
+	// Webhook is the payload of Alertmanager webhook.
+	// Reference: https://prometheus.io/docs/alerting/latest/configuration/#webhook_config
+	Webhook struct {
+		Version  string   `json:"version"`
+		GroupKey string   `json:"groupKey"`
+		Status   string   `json:"status"`
+		Receiver string   `json:"receiver"`
+		Alerts   []*Alert `json:"alerts"`
+	}
+
+	// Alert is one alert in Alertmanager webhook.
+	Alert struct {
+		Status       string            `json:"status"`
+		Labels       map[string]string `json:"labels"`
+		Annotations  map[string]string `json:"annotations"`
+		StartsAt     string            `json:"startsAt"`
+		EndsAt       string            `json:"endsAt"`
+		GeneratorURL string            `json:"generatorURL"`
+		Fingerprint  string            `json:"fingerprint"`
+	}
+)
+
+// Validate validates Spec.
+func (spec Spec) Validate() error {
+	for _, rule := range spec.Rules {
+		if _, exists := rule.Labels["alertname"]; exists {
+			return fmt.Errorf("rule of %s: use alertName instead of label alertname", rule.AlertName)
+		}
+	}
+
+	return nil
+}
+
+func (r *Rule) match(alert *Alert) bool {
+	if alert.Labels["alertname"] != r.AlertName {
+		return false
+	}
+
+	for k, v := range r.Labels {
+		if alert.Labels[k] != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Category returns the category of AlertmanagerTrigger.
+func (at *AlertmanagerTrigger) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of AlertmanagerTrigger.
+func (at *AlertmanagerTrigger) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of AlertmanagerTrigger.
+func (at *AlertmanagerTrigger) DefaultSpec() interface{} {
+	return &Spec{}
+}
+
+// Init initializes AlertmanagerTrigger.
+func (at *AlertmanagerTrigger) Init(superSpec *supervisor.Spec, super *supervisor.Supervisor) {
+	at.superSpec, at.spec, at.super = superSpec, superSpec.ObjectSpec().(*Spec), super
+	at.firing = make(map[string]*Rule)
+	at.reload()
+}
+
+// Inherit inherits previous generation of AlertmanagerTrigger.
+func (at *AlertmanagerTrigger) Inherit(superSpec *supervisor.Spec,
+	previousGeneration supervisor.Object, super *supervisor.Supervisor) {
+
+	previousGeneration.Close()
+	at.superSpec, at.spec, at.super = superSpec, superSpec.ObjectSpec().(*Spec), super
+
+	// NOTE: Keep the firing alerts to revert them once resolved.
+	prev := previousGeneration.(*AlertmanagerTrigger)
+	prev.mutex.Lock()
+	at.firing, at.fired, at.resolved = prev.firing, prev.fired, prev.resolved
+	prev.mutex.Unlock()
+
+	at.reload()
+}
+
+func (at *AlertmanagerTrigger) reload() {
+	triggers.Store(at.superSpec.Name(), at)
+	registerAPIs()
+}
+
+// handleWebhook fires the pipelines of the rules matching the alerts.
+func (at *AlertmanagerTrigger) handleWebhook(webhook *Webhook) {
+	at.mutex.Lock()
+	defer at.mutex.Unlock()
+
+	for _, alert := range webhook.Alerts {
+		switch alert.Status {
+		case statusFiring:
+			if _, exists := at.firing[alert.Fingerprint]; exists {
+				continue
+			}
+			for _, rule := range at.spec.Rules {
+				if rule.match(alert) {
+					at.firing[alert.Fingerprint] = rule
+					at.fired++
+					go at.firePipelineFunc()(rule.FiringPipeline, alert)
+					break
+				}
+			}
+		case statusResolved:
+			rule, exists := at.firing[alert.Fingerprint]
+			if !exists {
+				continue
+			}
+			delete(at.firing, alert.Fingerprint)
+			at.resolved++
+			if rule.ResolvedPipeline != "" {
+				go at.firePipelineFunc()(rule.ResolvedPipeline, alert)
+			}
+		default:
+			logger.Warnf("%s: unknown status %s of alert %s",
+				at.superSpec.Name(), alert.Status, alert.Fingerprint)
+		}
+	}
+}
+
+func (at *AlertmanagerTrigger) firePipelineFunc() func(string, *Alert) {
+	if at.fire != nil {
+		return at.fire
+	}
+	return at.firePipeline
+}
+
+// firePipeline sends the alert in json to the pipeline.
+func (at *AlertmanagerTrigger) firePipeline(name string, alert *Alert) {
+	ro, exists := at.super.GetRunningObject(name, supervisor.CategoryPipeline)
+	if !exists {
+		logger.Errorf("%s: pipeline %s not found", at.superSpec.Name(), name)
+		return
+	}
+	handler, ok := ro.Instance().(protocol.HTTPHandler)
+	if !ok {
+		logger.Errorf("%s: %s is not an http handler", at.superSpec.Name(), name)
+		return
+	}
+
+	body, err := json.Marshal(alert)
+	if err != nil {
+		logger.Errorf("BUG: marshal %#v to json failed: %v", alert, err)
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	if err != nil {
+		logger.Errorf("BUG: new request failed: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(AlertStatusHeader, alert.Status)
+
+	w := httptest.NewRecorder()
+	ctx := context.New(w, req, tracing.NoopTracing, "no trace")
+	handler.Handle(ctx)
+	ctx.Finish()
+
+	logger.Infof("%s: alert %s %s fired pipeline %s, status code: %d",
+		at.superSpec.Name(), alert.Labels["alertname"], alert.Status,
+		name, ctx.Response().StatusCode())
+}
+
+// Status returns the status of AlertmanagerTrigger.
+func (at *AlertmanagerTrigger) Status() *supervisor.Status {
+	at.mutex.Lock()
+	defer at.mutex.Unlock()
+
+	return &supervisor.Status{
+		ObjectStatus: &Status{
+			Firing:   len(at.firing),
+			Fired:    at.fired,
+			Resolved: at.resolved,
+		},
+	}
+}
+
+// Close closes AlertmanagerTrigger.
+func (at *AlertmanagerTrigger) Close() {
+	triggers.Delete(at.superSpec.Name())
+}
@@ -0,0 +1,187 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package alertmanagertrigger
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kataras/iris"
+)
+
+type firedPipeline struct {
+	pipeline string
+	alert    *Alert
+}
+
+func newTestTrigger(rules ...*Rule) (*AlertmanagerTrigger, chan *firedPipeline) {
+	fired := make(chan *firedPipeline, 10)
+	at := &AlertmanagerTrigger{
+		spec:   &Spec{Rules: rules},
+		firing: make(map[string]*Rule),
+		fire: func(pipeline string, alert *Alert) {
+			fired <- &firedPipeline{pipeline: pipeline, alert: alert}
+		},
+	}
+	return at, fired
+}
+
+func newTestAlert(status, fingerprint string, labels map[string]string) *Alert {
+	return &Alert{Status: status, Fingerprint: fingerprint, Labels: labels}
+}
+
+func assertFired(t *testing.T, fired chan *firedPipeline, pipeline, fingerprint string) {
+	t.Helper()
+	select {
+	case fp := <-fired:
+		if fp.pipeline != pipeline || fp.alert.Fingerprint != fingerprint {
+			t.Errorf("want %s fired by %s, got %s by %s",
+				pipeline, fingerprint, fp.pipeline, fp.alert.Fingerprint)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("want %s fired by %s", pipeline, fingerprint)
+	}
+}
+
+func assertNotFired(t *testing.T, fired chan *firedPipeline) {
+	t.Helper()
+	select {
+	case fp := <-fired:
+		t.Errorf("want nothing fired, got %s by %s", fp.pipeline, fp.alert.Fingerprint)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestRuleMatch(t *testing.T) {
+	rule := &Rule{
+		AlertName: "HighLatency",
+		Labels:    map[string]string{"service": "order"},
+	}
+
+	for _, c := range []struct {
+		labels map[string]string
+		want   bool
+	}{
+		{map[string]string{"alertname": "HighLatency", "service": "order"}, true},
+		{map[string]string{"alertname": "HighLatency", "service": "order", "severity": "page"}, true},
+		{map[string]string{"alertname": "HighLatency", "service": "payment"}, false},
+		{map[string]string{"alertname": "HighLatency"}, false},
+		{map[string]string{"alertname": "HighErrorRate", "service": "order"}, false},
+	} {
+		if got := rule.match(&Alert{Labels: c.labels}); got != c.want {
+			t.Errorf("%v: want %v, got %v", c.labels, c.want, got)
+		}
+	}
+}
+
+func TestSpecValidate(t *testing.T) {
+	spec := Spec{Rules: []*Rule{{AlertName: "HighLatency", FiringPipeline: "degrade"}}}
+	if err := spec.Validate(); err != nil {
+		t.Errorf("want valid spec, got %v", err)
+	}
+
+	spec.Rules[0].Labels = map[string]string{"alertname": "HighLatency"}
+	if err := spec.Validate(); err == nil {
+		t.Errorf("want error for label alertname")
+	}
+}
+
+func TestHandleWebhook(t *testing.T) {
+	at, fired := newTestTrigger(
+		&Rule{
+			AlertName:        "HighLatency",
+			Labels:           map[string]string{"service": "order"},
+			FiringPipeline:   "degrade-order",
+			ResolvedPipeline: "restore-order",
+		},
+		&Rule{
+			AlertName:      "HighLatency",
+			FiringPipeline: "degrade-all",
+		},
+	)
+	orderLabels := map[string]string{"alertname": "HighLatency", "service": "order"}
+	paymentLabels := map[string]string{"alertname": "HighLatency", "service": "payment"}
+
+	// NOTE: The first matching rule wins.
+	at.handleWebhook(&Webhook{Alerts: []*Alert{newTestAlert(statusFiring, "a1", orderLabels)}})
+	assertFired(t, fired, "degrade-order", "a1")
+
+	// NOTE: It fires only on status transition.
+	at.handleWebhook(&Webhook{Alerts: []*Alert{newTestAlert(statusFiring, "a1", orderLabels)}})
+	assertNotFired(t, fired)
+
+	at.handleWebhook(&Webhook{Alerts: []*Alert{newTestAlert(statusFiring, "a2", paymentLabels)}})
+	assertFired(t, fired, "degrade-all", "a2")
+
+	at.handleWebhook(&Webhook{Alerts: []*Alert{
+		newTestAlert(statusFiring, "a3", map[string]string{"alertname": "HighErrorRate"}),
+	}})
+	assertNotFired(t, fired)
+
+	at.handleWebhook(&Webhook{Alerts: []*Alert{newTestAlert(statusResolved, "a1", orderLabels)}})
+	assertFired(t, fired, "restore-order", "a1")
+
+	// NOTE: The rule of a2 has no resolved pipeline.
+	at.handleWebhook(&Webhook{Alerts: []*Alert{
+		newTestAlert(statusResolved, "a2", paymentLabels),
+		newTestAlert(statusResolved, "a1", orderLabels),
+	}})
+	assertNotFired(t, fired)
+
+	status := at.Status().ObjectStatus.(*Status)
+	if status.Firing != 0 || status.Fired != 2 || status.Resolved != 2 {
+		t.Errorf("want firing 0, fired 2, resolved 2, got %+v", status)
+	}
+}
+
+func TestHandleWebhookAPI(t *testing.T) {
+	at, fired := newTestTrigger(&Rule{AlertName: "HighLatency", FiringPipeline: "degrade"})
+	triggers.Store("demo", at)
+	defer triggers.Delete("demo")
+
+	app := iris.New()
+	app.Post(APIPath, handleWebhook)
+	if err := app.Build(); err != nil {
+		t.Fatalf("build app failed: %v", err)
+	}
+
+	post := func(name, body string) int {
+		r := httptest.NewRequest(http.MethodPost, "/alertmanagertriggers/"+name+"/webhook",
+			strings.NewReader(body))
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	body := `{"status": "firing", "alerts": [{"status": "firing",
+		"labels": {"alertname": "HighLatency"}, "fingerprint": "a1"}]}`
+	if code := post("demo", body); code != http.StatusOK {
+		t.Fatalf("want %d, got %d", http.StatusOK, code)
+	}
+	assertFired(t, fired, "degrade", "a1")
+
+	if code := post("unknown", body); code != http.StatusNotFound {
+		t.Errorf("unknown trigger: want %d, got %d", http.StatusNotFound, code)
+	}
+	if code := post("demo", "{"); code != http.StatusBadRequest {
+		t.Errorf("bad body: want %d, got %d", http.StatusBadRequest, code)
+	}
+	assertNotFired(t, fired)
+}
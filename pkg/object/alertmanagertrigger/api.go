@@ -0,0 +1,69 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package alertmanagertrigger
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/megaease/easegress/pkg/api"
+
+	"github.com/kataras/iris"
+)
+
+const (
+	// APIPath is the path of Alertmanager webhook API.
+	APIPath = "/alertmanagertriggers/{name:string}/webhook"
+)
+
+var (
+	registerAPIsOnce sync.Once
+
+	// triggers holds the running AlertmanagerTriggers keyed by name.
+	triggers sync.Map
+)
+
+// registerAPIs registers APIs only once, the webhook
+// is dispatched to the trigger by the name in path.
+func registerAPIs() {
+	registerAPIsOnce.Do(func() {
+		api.GlobalServer.RegisterAPIs([]*api.APIEntry{
+			{Path: APIPath, Method: "POST", Handler: handleWebhook},
+		})
+	})
+}
+
+func handleWebhook(ctx iris.Context) {
+	name := ctx.Params().Get("name")
+	value, exists := triggers.Load(name)
+	if !exists {
+		api.HandleAPIError(ctx, http.StatusNotFound, fmt.Errorf("%s %s not found", Kind, name))
+		return
+	}
+
+	webhook := &Webhook{}
+	err := json.NewDecoder(ctx.Request().Body).Decode(webhook)
+	if err != nil {
+		api.HandleAPIError(ctx, http.StatusBadRequest, fmt.Errorf("decode webhook failed: %v", err))
+		return
+	}
+
+	value.(*AlertmanagerTrigger).handleWebhook(webhook)
+}
@@ -0,0 +1,193 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auditlog
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/api"
+
+	"github.com/kataras/iris"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// APIPath is the path of audit log API.
+	APIPath = "/auditlog"
+
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+var (
+	registerAPIsOnce sync.Once
+
+	globalAuditLogMutex sync.RWMutex
+	globalAuditLog      *AuditLog
+)
+
+type (
+	// QueryResult is the result of querying audit log.
+	QueryResult struct {
+		Total    int       `yaml:"total"`
+		Page     int       `yaml:"page"`
+		PageSize int       `yaml:"pageSize"`
+		Records  []*Record `yaml:"records"`
+	}
+)
+
+func setGlobalAuditLog(al *AuditLog) {
+	globalAuditLogMutex.Lock()
+	defer globalAuditLogMutex.Unlock()
+	globalAuditLog = al
+}
+
+func clearGlobalAuditLog(al *AuditLog) {
+	globalAuditLogMutex.Lock()
+	defer globalAuditLogMutex.Unlock()
+	if globalAuditLog == al {
+		globalAuditLog = nil
+	}
+}
+
+func getGlobalAuditLog() *AuditLog {
+	globalAuditLogMutex.RLock()
+	defer globalAuditLogMutex.RUnlock()
+	return globalAuditLog
+}
+
+// registerAPIs registers APIs only once, because the APIs
+// are served by the running generation of AuditLog.
+func registerAPIs() {
+	registerAPIsOnce.Do(func() {
+		api.GlobalServer.RegisterAPIs([]*api.APIEntry{
+			{Path: APIPath, Method: "GET", Handler: queryAuditLog},
+		})
+	})
+}
+
+func parseTime(ctx iris.Context, key string) (time.Time, error) {
+	value := ctx.URLParam(key)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s: %v", key, err)
+	}
+
+	return t, nil
+}
+
+func parsePositiveInt(ctx iris.Context, key string, defaultValue int) (int, error) {
+	value := ctx.URLParam(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil || i <= 0 {
+		return 0, fmt.Errorf("invalid %s: %s", key, value)
+	}
+
+	return i, nil
+}
+
+func queryAuditLog(ctx iris.Context) {
+	al := getGlobalAuditLog()
+	if al == nil {
+		api.HandleAPIError(ctx, http.StatusNotFound, fmt.Errorf("no running %s", Kind))
+		return
+	}
+
+	from, err := parseTime(ctx, "from")
+	if err != nil {
+		api.HandleAPIError(ctx, http.StatusBadRequest, err)
+		return
+	}
+	to, err := parseTime(ctx, "to")
+	if err != nil {
+		api.HandleAPIError(ctx, http.StatusBadRequest, err)
+		return
+	}
+	page, err := parsePositiveInt(ctx, "page", 1)
+	if err != nil {
+		api.HandleAPIError(ctx, http.StatusBadRequest, err)
+		return
+	}
+	pageSize, err := parsePositiveInt(ctx, "pageSize", defaultPageSize)
+	if err != nil {
+		api.HandleAPIError(ctx, http.StatusBadRequest, err)
+		return
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+
+	result := al.query(from, to, ctx.URLParam("object"), page, pageSize)
+
+	buff, err := yaml.Marshal(result)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", result, err))
+	}
+
+	ctx.Header("Content-Type", "text/vnd.yaml")
+	ctx.Write(buff)
+}
+
+func (al *AuditLog) query(from, to time.Time, object string, page, pageSize int) *QueryResult {
+	al.recordsMutex.RLock()
+	defer al.recordsMutex.RUnlock()
+
+	matched := []*Record{}
+	for _, r := range al.records {
+		if !from.IsZero() && r.time.Before(from) {
+			continue
+		}
+		if !to.IsZero() && r.time.After(to) {
+			continue
+		}
+		if object != "" && r.Object != object {
+			continue
+		}
+		matched = append(matched, r)
+	}
+
+	result := &QueryResult{
+		Total:    len(matched),
+		Page:     page,
+		PageSize: pageSize,
+		Records:  []*Record{},
+	}
+
+	start := (page - 1) * pageSize
+	if start < len(matched) {
+		end := start + pageSize
+		if end > len(matched) {
+			end = len(matched)
+		}
+		result.Records = matched[start:end]
+	}
+
+	return result
+}
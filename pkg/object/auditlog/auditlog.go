@@ -0,0 +1,315 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auditlog
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/api"
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/supervisor"
+
+	"go.etcd.io/etcd/clientv3"
+	"go.etcd.io/etcd/mvcc/mvccpb"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// Category is the category of AuditLog.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of AuditLog.
+	Kind = "AuditLog"
+
+	operationPut    = "PUT"
+	operationDelete = "DELETE"
+)
+
+func init() {
+	supervisor.Register(&AuditLog{})
+}
+
+type (
+	// AuditLog watches the key space of the cluster,
+	// and records every change of it for auditing.
+	AuditLog struct {
+		super     *supervisor.Supervisor
+		superSpec *supervisor.Spec
+		spec      *Spec
+		layout    *cluster.Layout
+
+		// snapshot holds the latest values to get the before-value of events.
+		snapshot map[string]string
+
+		recordsMutex sync.RWMutex
+		// sorted by revision in ascending order
+		records []*Record
+
+		done chan struct{}
+	}
+
+	// Spec describes AuditLog.
+	Spec struct {
+		Prefix          string   `yaml:"prefix" jsonschema:"required"`
+		ExcludePrefixes []string `yaml:"excludePrefixes" jsonschema:"omitempty,uniqueItems=true"`
+		MaxRecords      int      `yaml:"maxRecords" jsonschema:"required,minimum=1"`
+	}
+
+	// Record is one change of the cluster key space.
+	Record struct {
+		Time       string `yaml:"time"`
+		Revision   int64  `yaml:"revision"`
+		Key        string `yaml:"key"`
+		Object     string `yaml:"object,omitempty"`
+		Operation  string `yaml:"operation"`
+		Before     string `yaml:"before,omitempty"`
+		After      string `yaml:"after,omitempty"`
+		RemoteAddr string `yaml:"remoteAddr,omitempty"`
+
+		time time.Time
+	}
+
+	// Status is the status of AuditLog.
+	Status struct {
+		Records int `yaml:"records"`
+	}
+)
+
+// Category returns the category of AuditLog.
+func (al *AuditLog) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of AuditLog.
+func (al *AuditLog) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of AuditLog.
+func (al *AuditLog) DefaultSpec() interface{} {
+	return &Spec{
+		Prefix: "/",
+		// NOTE: Status and leases are changed frequently by members themselves.
+		ExcludePrefixes: []string{"/status/", "/leases/"},
+		MaxRecords:      10000,
+	}
+}
+
+// Init initializes AuditLog.
+func (al *AuditLog) Init(superSpec *supervisor.Spec, super *supervisor.Supervisor) {
+	al.superSpec, al.spec, al.super = superSpec, superSpec.ObjectSpec().(*Spec), super
+	al.reload(nil)
+}
+
+// Inherit inherits previous generation of AuditLog.
+func (al *AuditLog) Inherit(superSpec *supervisor.Spec,
+	previousGeneration supervisor.Object, super *supervisor.Supervisor) {
+
+	previousGeneration.Close()
+	al.superSpec, al.spec, al.super = superSpec, superSpec.ObjectSpec().(*Spec), super
+	al.reload(previousGeneration.(*AuditLog))
+}
+
+func (al *AuditLog) reload(previousGeneration *AuditLog) {
+	if previousGeneration != nil {
+		previousGeneration.recordsMutex.RLock()
+		al.records = previousGeneration.records
+		previousGeneration.recordsMutex.RUnlock()
+	}
+
+	al.layout = al.super.Cluster().Layout()
+	al.done = make(chan struct{})
+	setGlobalAuditLog(al)
+	registerAPIs()
+
+	go al.run()
+}
+
+func (al *AuditLog) run() {
+	c := al.super.Cluster()
+
+	watcher, err := c.Watcher()
+	if err != nil {
+		logger.Errorf("%s get watcher failed: %v", al.superSpec.Name(), err)
+		return
+	}
+	defer watcher.Close()
+
+	// NOTE: Watch before getting the snapshot to lose no events.
+	eventsChan, err := watcher.WatchRawPrefixEvents(al.spec.Prefix)
+	if err != nil {
+		logger.Errorf("%s watch prefix %s failed: %v", al.superSpec.Name(), al.spec.Prefix, err)
+		return
+	}
+
+	al.snapshot, err = c.GetPrefix(al.spec.Prefix)
+	if err != nil {
+		logger.Errorf("%s get prefix %s failed: %v", al.superSpec.Name(), al.spec.Prefix, err)
+		return
+	}
+
+	for {
+		select {
+		case <-al.done:
+			return
+		case events, ok := <-eventsChan:
+			if !ok {
+				return
+			}
+			al.handleEvents(events)
+		}
+	}
+}
+
+func (al *AuditLog) excluded(key string) bool {
+	if strings.HasPrefix(key, al.layout.AuditObjectPrefix()) {
+		return true
+	}
+
+	for _, prefix := range al.spec.ExcludePrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// handleEvents records the events of one watch response, which are
+// sorted by revision. The admin API writes the audit metadata of an object
+// in the same transaction as the object, so the metadata is taken from
+// the events of the same revision instead of reading the latest one.
+func (al *AuditLog) handleEvents(events []*clientv3.Event) {
+	for start := 0; start < len(events); {
+		end := start + 1
+		revision := events[start].Kv.ModRevision
+		for end < len(events) && events[end].Kv.ModRevision == revision {
+			end++
+		}
+
+		metas := al.auditMetas(events[start:end])
+		for _, event := range events[start:end] {
+			al.handleEvent(event, metas)
+		}
+
+		start = end
+	}
+}
+
+// auditMetas returns the audit metadata written in the events, keyed by object name.
+func (al *AuditLog) auditMetas(events []*clientv3.Event) map[string]*api.AuditMeta {
+	metas := map[string]*api.AuditMeta{}
+	prefix := al.layout.AuditObjectPrefix()
+	for _, event := range events {
+		key := string(event.Kv.Key)
+		if event.Type != mvccpb.PUT || !strings.HasPrefix(key, prefix) {
+			continue
+		}
+
+		meta := &api.AuditMeta{}
+		err := yaml.Unmarshal(event.Kv.Value, meta)
+		if err != nil {
+			logger.Errorf("%s unmarshal %s to yaml failed: %v",
+				al.superSpec.Name(), event.Kv.Value, err)
+			continue
+		}
+		metas[strings.TrimPrefix(key, prefix)] = meta
+	}
+
+	return metas
+}
+
+func (al *AuditLog) handleEvent(event *clientv3.Event, metas map[string]*api.AuditMeta) {
+	key := string(event.Kv.Key)
+	if al.excluded(key) {
+		return
+	}
+
+	record := &Record{
+		Key:      key,
+		Revision: event.Kv.ModRevision,
+		Object:   objectName(al.layout, key),
+		Before:   al.snapshot[key],
+	}
+
+	switch event.Type {
+	case mvccpb.PUT:
+		record.Operation = operationPut
+		record.After = string(event.Kv.Value)
+		al.snapshot[key] = record.After
+	case mvccpb.DELETE:
+		record.Operation = operationDelete
+		delete(al.snapshot, key)
+	default:
+		logger.Errorf("BUG: %s received unknown event type %v", al.superSpec.Name(), event.Type)
+		return
+	}
+
+	// NOTE: etcd keeps no wall-clock time of revisions, so the time of
+	// the admin request is the closest one to the commit time. Changes not
+	// made by the admin API fall back to the time they are observed.
+	record.time = time.Now()
+	if meta := metas[record.Object]; record.Object != "" && meta != nil {
+		record.RemoteAddr = meta.RemoteAddr
+		t, err := time.Parse(time.RFC3339, meta.Time)
+		if err == nil {
+			record.time = t
+		}
+	}
+	record.Time = record.time.Format(time.RFC3339)
+
+	logger.Infof("%s: %s %s by %s, before: %q, after: %q", al.superSpec.Name(),
+		record.Operation, record.Key, record.RemoteAddr, record.Before, record.After)
+
+	al.recordsMutex.Lock()
+	defer al.recordsMutex.Unlock()
+
+	al.records = append(al.records, record)
+	if len(al.records) > al.spec.MaxRecords {
+		al.records = al.records[len(al.records)-al.spec.MaxRecords:]
+	}
+}
+
+func objectName(layout *cluster.Layout, key string) string {
+	for _, prefix := range []string{layout.ConfigObjectPrefix(), layout.StatusObjectsPrefix()} {
+		if strings.HasPrefix(key, prefix) {
+			return strings.SplitN(strings.TrimPrefix(key, prefix), "/", 2)[0]
+		}
+	}
+
+	return ""
+}
+
+// Status returns the status of AuditLog.
+func (al *AuditLog) Status() *supervisor.Status {
+	al.recordsMutex.RLock()
+	defer al.recordsMutex.RUnlock()
+
+	return &supervisor.Status{
+		ObjectStatus: &Status{Records: len(al.records)},
+	}
+}
+
+// Close closes AuditLog.
+func (al *AuditLog) Close() {
+	close(al.done)
+	clearGlobalAuditLog(al)
+}
@@ -0,0 +1,157 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auditlog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
+	"github.com/megaease/easegress/pkg/supervisor"
+
+	"go.etcd.io/etcd/clientv3"
+	"go.etcd.io/etcd/mvcc/mvccpb"
+)
+
+func TestMain(m *testing.M) {
+	tempDir, err := ioutil.TempDir("", "eg-auditlog-test")
+	if err != nil {
+		panic(err)
+	}
+	absLogDir := filepath.Join(tempDir, "log")
+	os.MkdirAll(absLogDir, 0755)
+	logger.Init(&option.Options{
+		Name:      "auditlog-for-log",
+		AbsLogDir: absLogDir,
+	})
+
+	code := m.Run()
+
+	logger.Sync()
+	os.RemoveAll(tempDir)
+
+	os.Exit(code)
+}
+
+func newTestAuditLog(t *testing.T) *AuditLog {
+	superSpec, err := supervisor.NewSpec(`
+name: audit-log
+kind: AuditLog
+prefix: /
+maxRecords: 10
+`)
+	if err != nil {
+		t.Fatalf("new spec failed: %v", err)
+	}
+
+	return &AuditLog{
+		superSpec: superSpec,
+		spec:      superSpec.ObjectSpec().(*Spec),
+		layout:    &cluster.Layout{},
+		snapshot:  map[string]string{},
+	}
+}
+
+func putEvent(key, value string, revision int64) *clientv3.Event {
+	return &clientv3.Event{
+		Type: mvccpb.PUT,
+		Kv:   &mvccpb.KeyValue{Key: []byte(key), Value: []byte(value), ModRevision: revision},
+	}
+}
+
+func deleteEvent(key string, revision int64) *clientv3.Event {
+	return &clientv3.Event{
+		Type: mvccpb.DELETE,
+		Kv:   &mvccpb.KeyValue{Key: []byte(key), ModRevision: revision},
+	}
+}
+
+func TestHandleEvents(t *testing.T) {
+	al := newTestAuditLog(t)
+	layout := al.layout
+	al.snapshot[layout.ConfigObjectKey("demo-2")] = "name: demo-2"
+
+	al.handleEvents([]*clientv3.Event{
+		putEvent(layout.ConfigObjectKey("demo-1"), "name: demo-1", 5),
+		putEvent(layout.AuditObjectKey("demo-1"), "remoteAddr: 10.0.0.1\ntime: 2021-06-01T08:00:00Z\n", 5),
+		putEvent(layout.ConfigObjectKey("demo-3"), "name: demo-3", 6),
+		deleteEvent(layout.ConfigObjectKey("demo-2"), 7),
+		putEvent(layout.AuditObjectKey("demo-2"), "remoteAddr: 10.0.0.2\ntime: 2021-06-01T09:00:00Z\n", 7),
+		putEvent("/status/members/eg-1", "running", 8),
+		// NOTE: Metadata of a later revision must not be attributed to demo-3.
+		putEvent(layout.AuditObjectKey("demo-3"), "remoteAddr: 10.0.0.3\n", 9),
+	})
+
+	want := []struct {
+		key        string
+		operation  string
+		revision   int64
+		remoteAddr string
+		time       string
+		before     string
+	}{
+		{layout.ConfigObjectKey("demo-1"), operationPut, 5, "10.0.0.1", "2021-06-01T08:00:00Z", ""},
+		{layout.ConfigObjectKey("demo-3"), operationPut, 6, "", "", ""},
+		{layout.ConfigObjectKey("demo-2"), operationDelete, 7, "10.0.0.2", "2021-06-01T09:00:00Z", "name: demo-2"},
+	}
+
+	if len(al.records) != len(want) {
+		t.Fatalf("want %d records, got %d", len(want), len(al.records))
+	}
+	for i, w := range want {
+		r := al.records[i]
+		if r.Key != w.key || r.Operation != w.operation || r.Revision != w.revision {
+			t.Errorf("record %d: want %s %s at %d, got %s %s at %d",
+				i, w.operation, w.key, w.revision, r.Operation, r.Key, r.Revision)
+		}
+		if r.RemoteAddr != w.remoteAddr {
+			t.Errorf("record %d: want remote address %q, got %q", i, w.remoteAddr, r.RemoteAddr)
+		}
+		if w.time != "" && r.Time != w.time {
+			t.Errorf("record %d: want time %s, got %s", i, w.time, r.Time)
+		}
+		if r.Before != w.before {
+			t.Errorf("record %d: want before %q, got %q", i, w.before, r.Before)
+		}
+	}
+
+	if _, exists := al.snapshot[layout.ConfigObjectKey("demo-2")]; exists {
+		t.Errorf("want demo-2 removed from snapshot")
+	}
+}
+
+func TestHandleEventsMaxRecords(t *testing.T) {
+	al := newTestAuditLog(t)
+
+	events := []*clientv3.Event{}
+	for i := int64(1); i <= 15; i++ {
+		events = append(events, putEvent(al.layout.ConfigObjectKey("demo"), "name: demo", i))
+	}
+	al.handleEvents(events)
+
+	if len(al.records) != al.spec.MaxRecords {
+		t.Fatalf("want %d records, got %d", al.spec.MaxRecords, len(al.records))
+	}
+	if al.records[0].Revision != 6 {
+		t.Errorf("want oldest revision 6, got %d", al.records[0].Revision)
+	}
+}
@@ -0,0 +1,347 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package autoscalehint pre-scales the upstream workloads by the load
+// of the pipeline.
+package autoscalehint
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	// Category is the category of AutoscaleHint.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of AutoscaleHint.
+	Kind = "AutoscaleHint"
+
+	sampleInterval = 5 * time.Second
+)
+
+func init() {
+	supervisor.Register(&AutoscaleHint{})
+}
+
+type (
+	// AutoscaleHint watches the RPS of the pipeline, and raises the
+	// minimum replicas of the HPA or KEDA ScaledObject once the RPS,
+	// current or predicted, exceeds the threshold.
+	AutoscaleHint struct {
+		super     *supervisor.Supervisor
+		superSpec *supervisor.Spec
+		spec      *Spec
+
+		window           *window
+		predictiveWindow time.Duration
+		cooldownPeriod   time.Duration
+		scaler           *scaler
+
+		lastHintTime time.Time
+		lastReplicas int
+
+		statusMutex sync.Mutex
+		status      *Status
+
+		// requestCount returns the request count of the pipeline,
+		// it's pipelineRequestCount if nil.
+		requestCount func() (uint64, error)
+
+		ctx    context.Context
+		cancel context.CancelFunc
+		done   chan struct{}
+	}
+
+	// Spec describes AutoscaleHint.
+	Spec struct {
+		Pipeline string `yaml:"pipeline" jsonschema:"required"`
+		// Threshold is the RPS of the pipeline to pre-scale.
+		Threshold float64 `yaml:"threshold" jsonschema:"required,exclusiveMinimum=0"`
+		// Window is the sliding window to calculate the RPS.
+		Window string `yaml:"window" jsonschema:"omitempty,format=duration"`
+		// PredictiveWindow extrapolates the trend of the RPS forward,
+		// the hint is sent if either the current or the predicted
+		// RPS exceeds the threshold.
+		PredictiveWindow string `yaml:"predictiveWindow" jsonschema:"omitempty,format=duration"`
+		// CooldownPeriod is the minimum interval between hints.
+		CooldownPeriod string `yaml:"cooldownPeriod" jsonschema:"omitempty,format=duration"`
+
+		// RPSPerReplica is the capacity of one replica, the hinted
+		// replicas are the RPS divided by it, between MinReplicas and
+		// MaxReplicas. MinReplicas is restored once the RPS falls below
+		// the threshold.
+		RPSPerReplica float64 `yaml:"rpsPerReplica" jsonschema:"required,exclusiveMinimum=0"`
+		MinReplicas   int     `yaml:"minReplicas" jsonschema:"omitempty,minimum=1"`
+		MaxReplicas   int     `yaml:"maxReplicas" jsonschema:"required,minimum=1"`
+
+		Target *TargetSpec `yaml:"target" jsonschema:"required"`
+	}
+
+	// Status is the status of AutoscaleHint.
+	Status struct {
+		Health       string  `yaml:"health"`
+		RPS          float64 `yaml:"rps"`
+		PredictedRPS float64 `yaml:"predictedRPS"`
+
+		ScaleHintSentTotal uint64 `yaml:"scaleHintSentTotal"`
+		LastReplicas       int    `yaml:"lastReplicas,omitempty"`
+		LastHintTime       string `yaml:"lastHintTime,omitempty"`
+		LastError          string `yaml:"lastError,omitempty"`
+	}
+
+	// requestCounter is implemented by HTTPPipeline.
+	requestCounter interface {
+		RequestCount() uint64
+	}
+)
+
+// Validate validates Spec.
+func (s Spec) Validate() error {
+	window, err := time.ParseDuration(s.Window)
+	if err != nil {
+		return fmt.Errorf("invalid window %s: %v", s.Window, err)
+	}
+	if window < 2*sampleInterval {
+		return fmt.Errorf("window %s is less than %s", s.Window, 2*sampleInterval)
+	}
+
+	if s.PredictiveWindow != "" {
+		_, err := time.ParseDuration(s.PredictiveWindow)
+		if err != nil {
+			return fmt.Errorf("invalid predictiveWindow %s: %v", s.PredictiveWindow, err)
+		}
+	}
+
+	_, err = time.ParseDuration(s.CooldownPeriod)
+	if err != nil {
+		return fmt.Errorf("invalid cooldownPeriod %s: %v", s.CooldownPeriod, err)
+	}
+
+	if s.MinReplicas > s.MaxReplicas {
+		return fmt.Errorf("minReplicas %d is greater than maxReplicas %d",
+			s.MinReplicas, s.MaxReplicas)
+	}
+
+	return nil
+}
+
+// replicas returns the replicas to serve the RPS.
+func (s *Spec) replicas(rps float64) int {
+	replicas := int(math.Ceil(rps / s.RPSPerReplica))
+	if replicas < s.MinReplicas {
+		return s.MinReplicas
+	}
+	if replicas > s.MaxReplicas {
+		return s.MaxReplicas
+	}
+	return replicas
+}
+
+// Category returns the category of AutoscaleHint.
+func (ah *AutoscaleHint) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of AutoscaleHint.
+func (ah *AutoscaleHint) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of AutoscaleHint.
+func (ah *AutoscaleHint) DefaultSpec() interface{} {
+	return &Spec{
+		Window:         "1m",
+		CooldownPeriod: "5m",
+		MinReplicas:    1,
+	}
+}
+
+// Init initializes AutoscaleHint.
+func (ah *AutoscaleHint) Init(superSpec *supervisor.Spec, super *supervisor.Supervisor) {
+	ah.superSpec, ah.spec, ah.super = superSpec, superSpec.ObjectSpec().(*Spec), super
+	ah.reload()
+}
+
+// Inherit inherits previous generation of AutoscaleHint.
+func (ah *AutoscaleHint) Inherit(superSpec *supervisor.Spec,
+	previousGeneration supervisor.Object, super *supervisor.Supervisor) {
+
+	previousGeneration.Close()
+
+	// NOTE: Keep the last hint to respect the cooldown period,
+	// and to restore the minimum replicas later.
+	prev := previousGeneration.(*AutoscaleHint)
+	ah.lastHintTime, ah.lastReplicas = prev.lastHintTime, prev.lastReplicas
+
+	ah.Init(superSpec, super)
+
+	prevStatus := prev.getStatus()
+	ah.statusMutex.Lock()
+	ah.status.ScaleHintSentTotal = prevStatus.ScaleHintSentTotal
+	ah.status.LastReplicas = prevStatus.LastReplicas
+	ah.status.LastHintTime = prevStatus.LastHintTime
+	ah.statusMutex.Unlock()
+}
+
+func (ah *AutoscaleHint) reload() {
+	ah.status = &Status{Health: "initializing"}
+	ah.ctx, ah.cancel = context.WithCancel(context.Background())
+	ah.done = make(chan struct{})
+
+	// NOTE: The spec has been validated.
+	window, _ := time.ParseDuration(ah.spec.Window)
+	ah.window = newWindow(window)
+	if ah.spec.PredictiveWindow != "" {
+		ah.predictiveWindow, _ = time.ParseDuration(ah.spec.PredictiveWindow)
+	}
+	ah.cooldownPeriod, _ = time.ParseDuration(ah.spec.CooldownPeriod)
+
+	scaler, err := newScaler(ah.spec.Target)
+	if err != nil {
+		logger.Errorf("%s: create scaler failed: %v", ah.superSpec.Name(), err)
+		ah.status.Health = err.Error()
+		close(ah.done)
+		return
+	}
+	ah.scaler = scaler
+
+	go ah.run()
+}
+
+func (ah *AutoscaleHint) run() {
+	defer close(ah.done)
+
+	ticker := time.NewTicker(sampleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ah.ctx.Done():
+			return
+		case now := <-ticker.C:
+			ah.tick(now)
+		}
+	}
+}
+
+func (ah *AutoscaleHint) requestCountFunc() func() (uint64, error) {
+	if ah.requestCount != nil {
+		return ah.requestCount
+	}
+	return ah.pipelineRequestCount
+}
+
+func (ah *AutoscaleHint) pipelineRequestCount() (uint64, error) {
+	ro, exists := ah.super.GetRunningObject(ah.spec.Pipeline, supervisor.CategoryPipeline)
+	if !exists {
+		return 0, fmt.Errorf("pipeline %s not found", ah.spec.Pipeline)
+	}
+
+	counter, ok := ro.Instance().(requestCounter)
+	if !ok {
+		return 0, fmt.Errorf("%s doesn't count requests", ah.spec.Pipeline)
+	}
+
+	return counter.RequestCount(), nil
+}
+
+// tick samples the request count, and sends the hint if needed.
+func (ah *AutoscaleHint) tick(now time.Time) {
+	count, err := ah.requestCountFunc()()
+	if err != nil {
+		ah.updateStatus(func(s *Status) { s.Health = err.Error() })
+		return
+	}
+
+	ah.window.add(now, count)
+	rps, predicted := ah.window.rps(), ah.window.predict(ah.predictiveWindow)
+	ah.updateStatus(func(s *Status) {
+		s.Health, s.RPS, s.PredictedRPS = "ready", rps, predicted
+	})
+
+	replicas := ah.spec.MinReplicas
+	if load := math.Max(rps, predicted); load >= ah.spec.Threshold {
+		replicas = ah.spec.replicas(load)
+		// NOTE: Never lower the replicas while above the threshold.
+		if replicas <= ah.lastReplicas {
+			return
+		}
+	} else if ah.lastReplicas == 0 || ah.lastReplicas == ah.spec.MinReplicas {
+		return
+	}
+
+	if !ah.lastHintTime.IsZero() && now.Sub(ah.lastHintTime) < ah.cooldownPeriod {
+		return
+	}
+
+	err = ah.scaler.scale(ah.ctx, replicas)
+	if err != nil {
+		logger.Errorf("%s: scale %s %s/%s to %d replicas failed: %v",
+			ah.superSpec.Name(), ah.spec.Target.Kind, ah.spec.Target.Namespace,
+			ah.spec.Target.Name, replicas, err)
+		ah.updateStatus(func(s *Status) { s.LastError = err.Error() })
+		return
+	}
+
+	logger.Infof("%s: scaled %s %s/%s to %d minimum replicas, rps: %.2f, predicted rps: %.2f",
+		ah.superSpec.Name(), ah.spec.Target.Kind, ah.spec.Target.Namespace,
+		ah.spec.Target.Name, replicas, rps, predicted)
+
+	ah.lastHintTime, ah.lastReplicas = now, replicas
+	ah.updateStatus(func(s *Status) {
+		s.ScaleHintSentTotal++
+		s.LastReplicas = replicas
+		s.LastHintTime = now.Format(time.RFC3339)
+		s.LastError = ""
+	})
+}
+
+func (ah *AutoscaleHint) updateStatus(fn func(s *Status)) {
+	ah.statusMutex.Lock()
+	defer ah.statusMutex.Unlock()
+
+	status := *ah.status
+	fn(&status)
+	ah.status = &status
+}
+
+func (ah *AutoscaleHint) getStatus() *Status {
+	ah.statusMutex.Lock()
+	defer ah.statusMutex.Unlock()
+
+	return ah.status
+}
+
+// Status returns the status of AutoscaleHint.
+func (ah *AutoscaleHint) Status() *supervisor.Status {
+	return &supervisor.Status{
+		ObjectStatus: ah.getStatus(),
+	}
+}
+
+// Close closes AutoscaleHint.
+func (ah *AutoscaleHint) Close() {
+	ah.cancel()
+	<-ah.done
+}
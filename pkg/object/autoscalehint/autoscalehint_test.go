@@ -0,0 +1,215 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package autoscalehint
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+func TestMain(m *testing.M) {
+	tempDir, err := ioutil.TempDir("", "eg-autoscalehint-test")
+	if err != nil {
+		panic(err)
+	}
+	absLogDir := filepath.Join(tempDir, "log")
+	os.MkdirAll(absLogDir, 0755)
+	logger.Init(&option.Options{
+		Name:      "autoscalehint-for-log",
+		AbsLogDir: absLogDir,
+	})
+
+	code := m.Run()
+
+	logger.Sync()
+	os.RemoveAll(tempDir)
+
+	os.Exit(code)
+}
+
+func TestSpecDefaults(t *testing.T) {
+	superSpec, err := supervisor.NewSpec(`
+name: autoscale-hint
+kind: AutoscaleHint
+pipeline: pipeline-demo
+threshold: 100
+rpsPerReplica: 30
+maxReplicas: 5
+target:
+  kind: HorizontalPodAutoscaler
+  apiServer: https://kubernetes.default.svc
+  namespace: default
+  name: demo`)
+	if err != nil {
+		t.Fatalf("new spec failed: %v", err)
+	}
+
+	spec := superSpec.ObjectSpec().(*Spec)
+	if spec.Window != "1m" || spec.CooldownPeriod != "5m" || spec.MinReplicas != 1 {
+		t.Errorf("want default window, cooldown period and min replicas, got %+v", spec)
+	}
+}
+
+func TestWindow(t *testing.T) {
+	w := newWindow(20 * time.Second)
+	start := time.Now()
+
+	// NOTE: The RPS grows 10, 20, 30, 40 in every 5s.
+	counts := []uint64{0, 50, 150, 300, 500}
+	for i, count := range counts {
+		w.add(start.Add(time.Duration(i)*5*time.Second), count)
+	}
+
+	if rps := w.rps(); rps != 25 {
+		t.Errorf("want rps 25, got %v", rps)
+	}
+	if rps := w.predict(0); rps != 25 {
+		t.Errorf("want rps 25 without predictive window, got %v", rps)
+	}
+	// NOTE: The last interval is centered at 17.5s, so the RPS at
+	// 30s is 40 + 12.5 * 2.
+	if rps := w.predict(10 * time.Second); math.Abs(rps-65) > 1e-9 {
+		t.Errorf("want predicted rps 65, got %v", rps)
+	}
+
+	w.add(start.Add(25*time.Second), 700)
+	if len(w.samples) != 5 {
+		t.Errorf("want 5 samples in window, got %d", len(w.samples))
+	}
+
+	// NOTE: The count restarts once the pipeline is updated.
+	w.add(start.Add(30*time.Second), 10)
+	if len(w.samples) != 1 || w.rps() != 0 {
+		t.Errorf("want window reset, got %d samples", len(w.samples))
+	}
+}
+
+func TestTick(t *testing.T) {
+	patches := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Method != http.MethodPatch || r.Header.Get("Authorization") != "Bearer test-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		patches <- r.URL.Path + " " + string(body)
+	}))
+	defer server.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	ioutil.WriteFile(tokenFile, []byte("test-token\n"), 0600)
+
+	superSpec, err := supervisor.NewSpec(`
+name: autoscale-hint
+kind: AutoscaleHint
+pipeline: pipeline-demo
+threshold: 100
+window: 20s
+cooldownPeriod: 10s
+rpsPerReplica: 30
+minReplicas: 2
+maxReplicas: 5
+target:
+  kind: ScaledObject
+  apiServer: ` + server.URL + `
+  namespace: default
+  name: demo
+  tokenFile: ` + tokenFile)
+	if err != nil {
+		t.Fatalf("new spec failed: %v", err)
+	}
+
+	var count uint64
+	ah := &AutoscaleHint{superSpec: superSpec, spec: superSpec.ObjectSpec().(*Spec)}
+	ah.requestCount = func() (uint64, error) { return count, nil }
+	ah.reload()
+	ah.Close()
+
+	assertPatch := func(want string) {
+		t.Helper()
+		select {
+		case got := <-patches:
+			if got != want {
+				t.Errorf("want patch %s, got %s", want, got)
+			}
+		default:
+			t.Errorf("want patch %s", want)
+		}
+	}
+	assertNoPatch := func() {
+		t.Helper()
+		select {
+		case got := <-patches:
+			t.Errorf("want no patch, got %s", got)
+		default:
+		}
+	}
+
+	// NOTE: Restart the context closed above to call tick directly.
+	ah.ctx, ah.cancel = context.WithCancel(context.Background())
+	defer ah.cancel()
+
+	now := time.Now()
+	tick := func(rps uint64) {
+		now = now.Add(sampleInterval)
+		count += rps * uint64(sampleInterval/time.Second)
+		ah.tick(now)
+	}
+
+	tick(50)
+	tick(50)
+	assertNoPatch()
+
+	tick(170)
+	assertPatch(`/apis/keda.sh/v1alpha1/namespaces/default/scaledobjects/demo {"spec":{"minReplicaCount":4}}`)
+
+	// NOTE: Respect the cooldown period.
+	tick(500)
+	assertNoPatch()
+
+	tick(500)
+	assertPatch(`/apis/keda.sh/v1alpha1/namespaces/default/scaledobjects/demo {"spec":{"minReplicaCount":5}}`)
+
+	// NOTE: Restore the minimum replicas once the high load
+	// slides out of the window.
+	for i := 0; i < 3; i++ {
+		tick(0)
+	}
+	assertNoPatch()
+	tick(0)
+	assertPatch(`/apis/keda.sh/v1alpha1/namespaces/default/scaledobjects/demo {"spec":{"minReplicaCount":2}}`)
+
+	tick(0)
+	assertNoPatch()
+
+	status := ah.getStatus()
+	if status.ScaleHintSentTotal != 3 || status.LastReplicas != 2 {
+		t.Errorf("want 3 hints sent with 2 replicas, got %+v", status)
+	}
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package autoscalehint
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/megaease/easegress/pkg/util/k8sclient"
+)
+
+const (
+	kindHPA          = "HorizontalPodAutoscaler"
+	kindScaledObject = "ScaledObject"
+
+	scaleTimeout = 10 * time.Second
+)
+
+type (
+	// TargetSpec describes the HPA or the KEDA ScaledObject to pre-scale.
+	TargetSpec struct {
+		Kind      string `yaml:"kind" jsonschema:"required,enum=HorizontalPodAutoscaler,enum=ScaledObject"`
+		Namespace string `yaml:"namespace" jsonschema:"required"`
+		Name      string `yaml:"name" jsonschema:"required"`
+
+		k8sclient.Spec `yaml:",inline"`
+	}
+
+	// scaler patches the minimum replicas of the target
+	// through the Kubernetes API server.
+	scaler struct {
+		spec   *TargetSpec
+		client *k8sclient.Client
+	}
+)
+
+func newScaler(spec *TargetSpec) (*scaler, error) {
+	client, err := k8sclient.New(&spec.Spec, scaleTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return &scaler{spec: spec, client: client}, nil
+}
+
+// pathAndField returns the API path of the target and the field of the
+// minimum replicas, which is minReplicas of HPA, and minReplicaCount
+// of ScaledObject.
+func (s *scaler) pathAndField() (string, string) {
+	switch s.spec.Kind {
+	case kindScaledObject:
+		return fmt.Sprintf("/apis/keda.sh/v1alpha1/namespaces/%s/scaledobjects/%s",
+			s.spec.Namespace, s.spec.Name), "minReplicaCount"
+	default:
+		return fmt.Sprintf("/apis/autoscaling/v1/namespaces/%s/horizontalpodautoscalers/%s",
+			s.spec.Namespace, s.spec.Name), "minReplicas"
+	}
+}
+
+// scale sets the minimum replicas of the target, so the workload
+// is scaled out before the load arrives.
+func (s *scaler) scale(ctx context.Context, replicas int) error {
+	path, field := s.pathAndField()
+	body := fmt.Sprintf(`{"spec":{"%s":%d}}`, field, replicas)
+
+	_, err := s.client.Do(ctx, http.MethodPatch, path, "application/merge-patch+json", []byte(body))
+	if err != nil {
+		return fmt.Errorf("patch %s %s/%s failed: %v", s.spec.Kind,
+			s.spec.Namespace, s.spec.Name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package autoscalehint
+
+import (
+	"time"
+)
+
+type (
+	// window is the sliding window of the request counts of the pipeline.
+	window struct {
+		size    time.Duration
+		samples []*sample
+	}
+
+	sample struct {
+		time  time.Time
+		count uint64
+	}
+)
+
+func newWindow(size time.Duration) *window {
+	return &window{size: size}
+}
+
+// add adds the sample, and drops the ones out of the window.
+func (w *window) add(t time.Time, count uint64) {
+	// NOTE: The count restarts from zero once the pipeline is updated.
+	if len(w.samples) > 0 && count < w.samples[len(w.samples)-1].count {
+		w.samples = nil
+	}
+
+	w.samples = append(w.samples, &sample{time: t, count: count})
+
+	i := 0
+	for i < len(w.samples)-1 && t.Sub(w.samples[i].time) > w.size {
+		i++
+	}
+	w.samples = w.samples[i:]
+}
+
+// rps returns the average RPS over the window.
+func (w *window) rps() float64 {
+	if len(w.samples) < 2 {
+		return 0
+	}
+
+	first, last := w.samples[0], w.samples[len(w.samples)-1]
+	seconds := last.time.Sub(first.time).Seconds()
+	if seconds <= 0 {
+		return 0
+	}
+
+	return float64(last.count-first.count) / seconds
+}
+
+// predict extrapolates the RPS ahead of the last sample, by the linear
+// trend of the RPS of every interval in the window. It returns the
+// average RPS if there are not enough samples for a trend.
+func (w *window) predict(ahead time.Duration) float64 {
+	if len(w.samples) < 3 || ahead <= 0 {
+		return w.rps()
+	}
+
+	// NOTE: The x is the seconds from the first sample to the middle
+	// of the interval, and the y is the RPS of the interval.
+	first := w.samples[0].time
+	var n, sumX, sumY, sumXY, sumXX float64
+	for i := 1; i < len(w.samples); i++ {
+		prev, curr := w.samples[i-1], w.samples[i]
+		seconds := curr.time.Sub(prev.time).Seconds()
+		if seconds <= 0 {
+			continue
+		}
+
+		x := prev.time.Sub(first).Seconds() + seconds/2
+		y := float64(curr.count-prev.count) / seconds
+		n++
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+
+	denominator := n*sumXX - sumX*sumX
+	if n < 2 || denominator == 0 {
+		return w.rps()
+	}
+
+	slope := (n*sumXY - sumX*sumY) / denominator
+	intercept := (sumY - slope*sumX) / n
+	x := w.samples[len(w.samples)-1].time.Sub(first).Seconds() + ahead.Seconds()
+
+	predicted := intercept + slope*x
+	if predicted < 0 {
+		return 0
+	}
+
+	return predicted
+}
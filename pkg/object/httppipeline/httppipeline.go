@@ -20,13 +20,16 @@ package httppipeline
 import (
 	"bytes"
 	"fmt"
+	"net/http"
 	"reflect"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/megaease/easegress/pkg/context"
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/auditevent"
 	"github.com/megaease/easegress/pkg/util/stringtool"
 
 	yaml "gopkg.in/yaml.v2"
@@ -56,6 +59,16 @@ type (
 
 		runningFilters []*runningFilter
 		ht             *context.HTTPTemplate
+		sandbox        *sandbox
+
+		liveUpdateMutex sync.Mutex
+		// liveUpdate stores *liveUpdate, the running or the last one.
+		liveUpdate atomic.Value
+		// rollout stores *rollout, the one from the previous generation.
+		rollout atomic.Value
+
+		// requests is accessed atomically.
+		requests uint64
 	}
 
 	runningFilter struct {
@@ -69,6 +82,9 @@ type (
 	Spec struct {
 		Flow    []Flow                   `yaml:"flow" jsonschema:"omitempty"`
 		Filters []map[string]interface{} `yaml:"filters" jsonschema:"-"`
+		Sandbox *SandboxSpec             `yaml:"sandbox,omitempty" jsonschema:"omitempty"`
+
+		ProgressiveRollout *ProgressiveRolloutSpec `yaml:"progressiveRollout,omitempty" jsonschema:"omitempty"`
 	}
 
 	// Flow controls the flow of pipeline.
@@ -82,11 +98,19 @@ type (
 		Health string `yaml:"health"`
 
 		Filters map[string]interface{} `yaml:"filters"`
+
+		LiveUpdate *LiveUpdateStatus `yaml:"liveUpdate,omitempty"`
+
+		Sandbox *SandboxStatus `yaml:"sandbox,omitempty"`
+
+		Rollout *RolloutStatus `yaml:"rollout,omitempty"`
 	}
 
 	// PipelineContext contains the context of the HTTPPipeline.
 	PipelineContext struct {
 		FilterStats *FilterStat
+
+		pipeline *HTTPPipeline
 	}
 
 	// FilterStat records the statistics of the running filter.
@@ -151,6 +175,11 @@ var (
 	runningContexts sync.Map = sync.Map{}
 )
 
+// Pipeline returns the HTTPPipeline handling the context.
+func (ctx *PipelineContext) Pipeline() *HTTPPipeline {
+	return ctx.pipeline
+}
+
 func newAndSetPipelineContext(ctx context.HTTPContext) *PipelineContext {
 	pipeCtx := &PipelineContext{}
 
@@ -300,6 +329,20 @@ func (s Spec) Validate(config []byte) (err error) {
 		labelsValid[f.Filter] = struct{}{}
 	}
 
+	if s.Sandbox != nil {
+		errPrefix = "sandbox"
+		if err := s.Sandbox.validate(); err != nil {
+			panic(err)
+		}
+	}
+
+	if s.ProgressiveRollout != nil {
+		errPrefix = "progressiveRollout"
+		if err := s.ProgressiveRollout.validate(); err != nil {
+			panic(err)
+		}
+	}
+
 	return nil
 }
 
@@ -329,7 +372,19 @@ func (hp *HTTPPipeline) Inherit(superSpec *supervisor.Spec,
 	previousGeneration supervisor.Object, super *supervisor.Supervisor) {
 
 	hp.superSpec, hp.spec, hp.super = superSpec, superSpec.ObjectSpec().(*Spec), super
-	hp.reload(previousGeneration.(*HTTPPipeline))
+	prev := hp.inheritRollout(previousGeneration.(*HTTPPipeline))
+
+	// NOTE: The previous generation keeps running during the rollout,
+	// so the filters are created instead of inherited.
+	if hp.spec.ProgressiveRollout != nil && len(hp.spec.ProgressiveRollout.Steps) > 1 {
+		hp.reload(nil)
+		hp.inheritLiveUpdate(prev)
+		hp.startRollout(prev)
+		return
+	}
+
+	hp.reload(prev)
+	hp.inheritLiveUpdate(prev)
 
 	// NOTE: It's filters' responsibility to inherit and clean their resources.
 	// previousGeneration.Close()
@@ -343,6 +398,7 @@ func (hp *HTTPPipeline) reload(previousGeneration *HTTPPipeline) {
 			if err != nil {
 				panic(err)
 			}
+			spec.pipeline = hp.superSpec.Name()
 
 			runningFilters = append(runningFilters, &runningFilter{
 				spec: spec,
@@ -364,6 +420,7 @@ func (hp *HTTPPipeline) reload(previousGeneration *HTTPPipeline) {
 			if spec == nil {
 				panic(fmt.Errorf("flow filter %s not found in filters", f.Filter))
 			}
+			spec.pipeline = hp.superSpec.Name()
 
 			runningFilters = append(runningFilters, &runningFilter{
 				spec:   spec,
@@ -411,6 +468,10 @@ func (hp *HTTPPipeline) reload(previousGeneration *HTTPPipeline) {
 	}
 
 	hp.runningFilters = runningFilters
+
+	if hp.spec.Sandbox != nil {
+		hp.sandbox = newSandbox(hp.spec.Sandbox)
+	}
 }
 
 func (hp *HTTPPipeline) getNextFilterIndex(index int, result string) int {
@@ -448,14 +509,42 @@ func (hp *HTTPPipeline) getNextFilterIndex(index int, result string) int {
 }
 
 func (hp *HTTPPipeline) Handle(ctx context.HTTPContext) {
+	if hp.handleRollout(ctx) {
+		return
+	}
+
+	atomic.AddUint64(&hp.requests, 1)
+	start := time.Now()
+
+	if hp.sandbox != nil {
+		leave, err := hp.sandbox.enter(ctx)
+		if err != nil {
+			ctx.Response().SetStatusCode(http.StatusServiceUnavailable)
+			ctx.AddTag(stringtool.Cat("sandbox: ", err.Error()))
+			return
+		}
+		defer leave()
+	}
+
 	pipeCtx := newAndSetPipelineContext(ctx)
+	pipeCtx.pipeline = hp
 	defer deletePipelineContext(ctx)
 	ctx.SetTemplate(hp.ht)
 
 	filterIndex := -1
 	filterStat := &FilterStat{}
 
+	// compareShadow is set when the filter is shadowed by its live update,
+	// and is called with the own result of the filter.
+	var compareShadow func(result string)
+
 	handle := func(lastResult string) string {
+		// NOTE: The last filter calls the next handler with its own result.
+		if compareShadow != nil {
+			compareShadow(lastResult)
+			compareShadow = nil
+		}
+
 		// Filters are called recursively as a stack, so we need to save current
 		// state and restore it before return
 		lastIndex := filterIndex
@@ -482,9 +571,19 @@ func (hp *HTTPPipeline) Handle(ctx context.HTTPContext) {
 
 		filterStat = &FilterStat{Name: name, Kind: filter.spec.Kind()}
 
+		if lu := hp.shadowed(ctx, name); lu != nil {
+			compareShadow = lu.startShadow(ctx)
+		}
+
 		startTime := time.Now()
 		result := filter.filter.Handle(ctx)
 
+		// NOTE: The filter didn't call the next handler.
+		if compareShadow != nil {
+			compareShadow(result)
+			compareShadow = nil
+		}
+
 		filterStat.Duration = time.Since(startTime)
 		filterStat.Result = result
 
@@ -504,6 +603,45 @@ func (hp *HTTPPipeline) Handle(ctx context.HTTPContext) {
 		pipeCtx.FilterStats = filterStat.Next[0]
 	}
 	ctx.AddTag(stringtool.Cat("pipeline: ", pipeCtx.log()))
+
+	if auditevent.Enabled() {
+		hp.publishRequestCompleted(ctx, pipeCtx.FilterStats, time.Since(start))
+	}
+}
+
+// publishRequestCompleted publishes the audit event of the request,
+// with the filter producing the result of the pipeline. As the result is
+// passed back through the calling filters, it is the deepest one returning it.
+func (hp *HTTPPipeline) publishRequestCompleted(ctx context.HTTPContext,
+	stat *FilterStat, latency time.Duration) {
+
+	e := &auditevent.Event{
+		Time:       time.Now(),
+		Type:       auditevent.TypeRequestCompleted,
+		Object:     hp.superSpec.Name(),
+		StatusCode: ctx.Response().StatusCode(),
+		Latency:    latency,
+	}
+	if id, ok := ctx.Get(context.VarRequestID); ok {
+		e.RequestID, _ = id.(string)
+	}
+	if ip, ok := ctx.Get(context.VarClientIP); ok {
+		e.SourceIP, _ = ip.(string)
+	}
+
+	for stat != nil {
+		e.Filter, e.Result = stat.Name, stat.Result
+		if len(stat.Next) == 0 {
+			break
+		}
+		next := stat.Next[len(stat.Next)-1]
+		if stat.Result != "" && next.Result != stat.Result {
+			break
+		}
+		stat = next
+	}
+
+	auditevent.Publish(e)
 }
 
 func (hp *HTTPPipeline) getRunningFilter(name string) *runningFilter {
@@ -516,16 +654,44 @@ func (hp *HTTPPipeline) getRunningFilter(name string) *runningFilter {
 	return nil
 }
 
+// RunningFilters returns the running filters in order.
+func (hp *HTTPPipeline) RunningFilters() []Filter {
+	serving := hp.servingGeneration()
+	filters := make([]Filter, 0, len(serving.runningFilters))
+	for _, runningFilter := range serving.runningFilters {
+		filters = append(filters, runningFilter.filter)
+	}
+
+	return filters
+}
+
+// RequestCount returns the count of requests handled by this generation.
+func (hp *HTTPPipeline) RequestCount() uint64 {
+	return atomic.LoadUint64(&hp.requests)
+}
+
 // Status returns Status genreated by Runtime.
 func (hp *HTTPPipeline) Status() *supervisor.Status {
 	s := &Status{
 		Filters: make(map[string]interface{}),
 	}
 
-	for _, runningFilter := range hp.runningFilters {
+	for _, runningFilter := range hp.servingGeneration().runningFilters {
 		s.Filters[runningFilter.spec.Name()] = runningFilter.filter.Status()
 	}
 
+	if lu := hp.getLiveUpdate(); lu != nil {
+		s.LiveUpdate = lu.status()
+	}
+
+	if hp.sandbox != nil {
+		s.Sandbox = hp.sandbox.status()
+	}
+
+	if ro := hp.getRollout(); ro != nil {
+		s.Rollout = ro.status()
+	}
+
 	return &supervisor.Status{
 		ObjectStatus: s,
 	}
@@ -533,6 +699,23 @@ func (hp *HTTPPipeline) Status() *supervisor.Status {
 
 // Close closes HTTPPipeline.
 func (hp *HTTPPipeline) Close() {
+	if lu := hp.getLiveUpdate(); lu != nil {
+		lu.abort("pipeline closed")
+	}
+
+	if ro := hp.getRollout(); ro != nil {
+		ro.finish(RolloutAborted, "pipeline closed")
+		ro.closePrevious()
+		// NOTE: The filters have been closed once rolled back.
+		if ro.rolledBack() {
+			return
+		}
+	}
+
+	hp.closeFilters()
+}
+
+func (hp *HTTPPipeline) closeFilters() {
 	for _, runningFilter := range hp.runningFilters {
 		runningFilter.filter.Close()
 	}
@@ -0,0 +1,77 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httppipeline
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/auditevent"
+)
+
+func TestPublishRequestCompleted(t *testing.T) {
+	superSpec, err := supervisor.NewSpec(`
+name: audit-pipeline
+kind: HTTPPipeline
+flow:
+- filter: first
+- filter: second
+filters:
+- name: first
+  kind: LiveUpdateTestFilter
+- name: second
+  kind: LiveUpdateTestFilter
+  result: mismatched
+`)
+	if err != nil {
+		t.Fatalf("new spec failed: %v", err)
+	}
+	hp := &HTTPPipeline{}
+	hp.Init(superSpec, nil)
+	defer hp.Close()
+
+	if name := hp.runningFilters[0].spec.Pipeline(); name != "audit-pipeline" {
+		t.Errorf("want pipeline audit-pipeline, got %s", name)
+	}
+
+	s := auditevent.Subscribe(1)
+	defer s.Close()
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	req.Header.Set("X-Request-Id", "req-1")
+	req.RemoteAddr = "10.0.0.1:1234"
+	ctx := context.New(httptest.NewRecorder(), req, tracing.NoopTracing, "no trace")
+	hp.Handle(ctx)
+	receiveLiveUpdateTestRequest(t)
+	receiveLiveUpdateTestRequest(t)
+
+	e := <-s.Events()
+	if e.Type != auditevent.TypeRequestCompleted || e.Object != "audit-pipeline" {
+		t.Errorf("unexpected event: %+v", e)
+	}
+	if e.Filter != "second" || e.Result != "mismatched" || e.StatusCode != http.StatusOK {
+		t.Errorf("unexpected result: %+v", e)
+	}
+	if e.RequestID != "req-1" || e.SourceIP != "10.0.0.1" || e.Latency <= 0 {
+		t.Errorf("unexpected request: %+v", e)
+	}
+}
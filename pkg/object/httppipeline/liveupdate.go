@@ -0,0 +1,394 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httppipeline
+
+import (
+	stdcontext "context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/httpfilter"
+	"github.com/megaease/easegress/pkg/util/masterslavereader"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// LiveUpdateRunning means the new filter is running in shadow mode.
+	LiveUpdateRunning = "running"
+	// LiveUpdatePromoted means the new filter config has been applied.
+	LiveUpdatePromoted = "promoted"
+	// LiveUpdateAborted means the old filter config is kept.
+	LiveUpdateAborted = "aborted"
+
+	// LiveUpdateShadowHeader marks the requests shadowed to the new filter
+	// config, so backends are able to skip their side effects.
+	LiveUpdateShadowHeader = "X-Easegress-Shadow"
+
+	defaultLiveUpdateMinSamples = 100
+)
+
+var (
+	// ErrFilterNotFound is the error of live updating a non-existent filter.
+	ErrFilterNotFound = fmt.Errorf("filter not found")
+	// ErrLiveUpdateRunning is the error of starting a live update while one is running.
+	ErrLiveUpdateRunning = fmt.Errorf("another live update is running")
+)
+
+type (
+	// LiveUpdateSpec describes the live update of one filter. The new config
+	// runs alongside the old one on the requests picked by the shadow filter,
+	// it's promoted if the results match within the window.
+	LiveUpdateSpec struct {
+		Filter map[string]interface{} `yaml:"filter" jsonschema:"-"`
+		Shadow *httpfilter.Spec       `yaml:"shadow" jsonschema:"required"`
+		Window string                 `yaml:"window" jsonschema:"required,format=duration"`
+		// MinSamples is the minimum number of shadowed requests to promote.
+		MinSamples uint64 `yaml:"minSamples" jsonschema:"omitempty,minimum=1"`
+		// MaxDivergence is the max ratio of results mismatching, 0 means none allowed.
+		MaxDivergence float64 `yaml:"maxDivergence" jsonschema:"omitempty,minimum=0,maximum=1"`
+	}
+
+	// LiveUpdateStatus is the status of the live update.
+	LiveUpdateStatus struct {
+		Filter      string `yaml:"filter"`
+		State       string `yaml:"state"`
+		Samples     uint64 `yaml:"samples"`
+		Divergences uint64 `yaml:"divergences"`
+		Message     string `yaml:"message,omitempty"`
+	}
+
+	// PromoteFunc applies the pipeline spec with the new filter config.
+	PromoteFunc func(spec *supervisor.Spec) error
+
+	liveUpdate struct {
+		spec       *LiveUpdateSpec
+		filterSpec *FilterSpec
+		candidate  Filter
+		shadow     *httpfilter.HTTPFilter
+		ht         *context.HTTPTemplate
+
+		samples     uint64
+		divergences uint64
+
+		mutex   sync.Mutex
+		state   string
+		message string
+		done    chan struct{}
+	}
+)
+
+// Validate validates LiveUpdateSpec.
+func (s LiveUpdateSpec) Validate() error {
+	if len(s.Filter) == 0 {
+		return fmt.Errorf("filter is required")
+	}
+
+	return nil
+}
+
+// StartLiveUpdate starts the live update of the filter, the promote is
+// called with the new pipeline spec once the new config is verified.
+// NOTE: The new filter runs in the background like the mirror pool of Proxy,
+// its requests are marked by LiveUpdateShadowHeader and its responses are
+// discarded, so it must not be used on backends unaware of the header.
+func (hp *HTTPPipeline) StartLiveUpdate(filterName string,
+	spec *LiveUpdateSpec, promote PromoteFunc) (*LiveUpdateStatus, error) {
+
+	rf := hp.getRunningFilter(filterName)
+	if rf == nil {
+		return nil, ErrFilterNotFound
+	}
+
+	filterSpec, err := newFilterSpecInternal(spec.Filter)
+	if err != nil {
+		return nil, err
+	}
+	filterSpec.pipeline = hp.superSpec.Name()
+	if filterSpec.Name() != filterName {
+		return nil, fmt.Errorf("inconsistent filter name in url and spec")
+	}
+	if filterSpec.Kind() != rf.spec.Kind() {
+		return nil, fmt.Errorf("different kinds: %s, %s", rf.spec.Kind(), filterSpec.Kind())
+	}
+
+	window, err := time.ParseDuration(spec.Window)
+	if err != nil {
+		return nil, fmt.Errorf("invalid window %s: %v", spec.Window, err)
+	}
+
+	pipelineSpec, err := hp.specWithFilter(filterSpec)
+	if err != nil {
+		return nil, err
+	}
+
+	if spec.MinSamples == 0 {
+		spec.MinSamples = defaultLiveUpdateMinSamples
+	}
+
+	hp.liveUpdateMutex.Lock()
+	defer hp.liveUpdateMutex.Unlock()
+
+	if prev := hp.getLiveUpdate(); prev != nil && prev.running() {
+		return nil, ErrLiveUpdateRunning
+	}
+
+	candidate := reflect.New(reflect.TypeOf(filterSpec.RootFilter()).Elem()).Interface().(Filter)
+	candidate.Init(filterSpec, hp.super)
+
+	lu := &liveUpdate{
+		spec:       spec,
+		filterSpec: filterSpec,
+		candidate:  candidate,
+		shadow:     httpfilter.New(spec.Shadow),
+		ht:         hp.ht,
+		state:      LiveUpdateRunning,
+		done:       make(chan struct{}),
+	}
+	hp.liveUpdate.Store(lu)
+
+	go lu.run(hp.superSpec.Name(), window, pipelineSpec, promote)
+
+	return lu.status(), nil
+}
+
+// specWithFilter returns the pipeline spec with the filter replaced.
+func (hp *HTTPPipeline) specWithFilter(filterSpec *FilterSpec) (*supervisor.Spec, error) {
+	var whole map[string]interface{}
+	err := yaml.Unmarshal([]byte(hp.superSpec.YAMLConfig()), &whole)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal pipeline spec failed: %v", err)
+	}
+
+	var filter map[string]interface{}
+	err = yaml.Unmarshal([]byte(filterSpec.YAMLConfig()), &filter)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal filter spec failed: %v", err)
+	}
+
+	filters := make([]map[string]interface{}, 0, len(hp.spec.Filters))
+	for _, f := range hp.spec.Filters {
+		if f["name"] == filterSpec.Name() {
+			f = filter
+		}
+		filters = append(filters, f)
+	}
+	whole["filters"] = filters
+
+	buff, err := yaml.Marshal(whole)
+	if err != nil {
+		return nil, fmt.Errorf("marshal %#v to yaml failed: %v", whole, err)
+	}
+
+	return supervisor.NewSpec(string(buff))
+}
+
+func (hp *HTTPPipeline) getLiveUpdate() *liveUpdate {
+	lu, _ := hp.liveUpdate.Load().(*liveUpdate)
+	return lu
+}
+
+// inheritLiveUpdate aborts the running live update of the previous
+// generation, since the shadowed filter config has gone.
+func (hp *HTTPPipeline) inheritLiveUpdate(previousGeneration *HTTPPipeline) {
+	lu := previousGeneration.getLiveUpdate()
+	if lu == nil {
+		return
+	}
+
+	lu.abort("pipeline updated")
+	hp.liveUpdate.Store(lu)
+}
+
+// shadowed returns the running live update of the filter
+// if the request is picked to be shadowed.
+func (hp *HTTPPipeline) shadowed(ctx context.HTTPContext, filterName string) *liveUpdate {
+	lu := hp.getLiveUpdate()
+	if lu == nil || lu.filterSpec.Name() != filterName || !lu.running() {
+		return nil
+	}
+
+	if !lu.shadow.Filter(ctx) {
+		return nil
+	}
+
+	return lu
+}
+
+func (lu *liveUpdate) running() bool {
+	select {
+	case <-lu.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// startShadow runs the new filter in the background on a copy of the
+// request, whose body is teed from the one read by the old filter.
+// It returns the function comparing the result of the old filter,
+// which never waits for the shadow.
+func (lu *liveUpdate) startShadow(ctx context.HTTPContext) func(result string) {
+	// NOTE: The shadow outlives the request, so it can't share its context.
+	req := ctx.Request().Std().Clone(stdcontext.Background())
+	req.Header.Set(LiveUpdateShadowHeader, "true")
+
+	master, slave := masterslavereader.New(ctx.Request().Body())
+	ctx.Request().SetBody(master)
+	req.Body = ioutil.NopCloser(slave)
+	// NOTE: Close the master once the request finished,
+	// so the slave ends even if the body isn't read to the end.
+	ctx.OnFinish(func() {
+		master.Close()
+	})
+
+	shadowResult := make(chan string, 1)
+	go func() {
+		shadowResult <- lu.handleShadow(req, slave)
+	}()
+
+	return func(result string) {
+		// NOTE: Receive the shadow result in the goroutine,
+		// the arguments of go statement are evaluated in place.
+		go func() {
+			lu.compare(result, <-shadowResult)
+		}()
+	}
+}
+
+// handleShadow runs the new filter with the response discarded,
+// the next handlers are not called, so the result is its own one.
+func (lu *liveUpdate) handleShadow(req *http.Request, body io.Reader) (result string) {
+	shadowCtx := context.New(httptest.NewRecorder(), req, tracing.NoopTracing, "no trace")
+	shadowCtx.SetTemplate(lu.ht)
+	shadowCtx.SetHandlerCaller(func(lastResult string) string {
+		return lastResult
+	})
+
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Errorf("live update of filter %s panic: %v", lu.filterSpec.Name(), err)
+			result = fmt.Sprintf("panic: %v", err)
+		}
+		shadowCtx.Finish()
+
+		// NOTE: Drain the body, otherwise the old filter
+		// blocks on reading it once the buffer is full.
+		io.Copy(ioutil.Discard, body)
+	}()
+
+	return lu.candidate.Handle(shadowCtx)
+}
+
+func (lu *liveUpdate) compare(result, shadowResult string) {
+	if !lu.running() {
+		return
+	}
+
+	samples := atomic.AddUint64(&lu.samples, 1)
+	divergences := atomic.LoadUint64(&lu.divergences)
+	if result != shadowResult {
+		divergences = atomic.AddUint64(&lu.divergences, 1)
+	}
+
+	if samples >= lu.spec.MinSamples &&
+		float64(divergences)/float64(samples) > lu.spec.MaxDivergence {
+		lu.abort(fmt.Sprintf("divergence %d/%d exceeds %g",
+			divergences, samples, lu.spec.MaxDivergence))
+	}
+}
+
+func (lu *liveUpdate) run(pipelineName string, window time.Duration,
+	pipelineSpec *supervisor.Spec, promote PromoteFunc) {
+
+	defer lu.candidate.Close()
+
+	select {
+	case <-lu.done:
+		logger.Warnf("live update of %s/%s aborted: %s",
+			pipelineName, lu.filterSpec.Name(), lu.status().Message)
+		return
+	case <-time.After(window):
+	}
+
+	samples := atomic.LoadUint64(&lu.samples)
+	if samples < lu.spec.MinSamples {
+		lu.abort(fmt.Sprintf("not enough samples %d/%d", samples, lu.spec.MinSamples))
+		return
+	}
+
+	if !lu.finish(LiveUpdatePromoted, "") {
+		return
+	}
+
+	err := promote(pipelineSpec)
+	if err != nil {
+		lu.mutex.Lock()
+		lu.state, lu.message = LiveUpdateAborted, fmt.Sprintf("promote failed: %v", err)
+		lu.mutex.Unlock()
+		logger.Errorf("live update of %s/%s: promote failed: %v",
+			pipelineName, lu.filterSpec.Name(), err)
+		return
+	}
+
+	logger.Infof("live update of %s/%s promoted", pipelineName, lu.filterSpec.Name())
+}
+
+func (lu *liveUpdate) abort(message string) {
+	lu.finish(LiveUpdateAborted, message)
+}
+
+// finish transits the running state to the final one,
+// it returns false if it has been finished.
+func (lu *liveUpdate) finish(state, message string) bool {
+	lu.mutex.Lock()
+	defer lu.mutex.Unlock()
+
+	if lu.state != LiveUpdateRunning {
+		return false
+	}
+
+	lu.state, lu.message = state, message
+	close(lu.done)
+
+	return true
+}
+
+func (lu *liveUpdate) status() *LiveUpdateStatus {
+	lu.mutex.Lock()
+	defer lu.mutex.Unlock()
+
+	return &LiveUpdateStatus{
+		Filter:      lu.filterSpec.Name(),
+		State:       lu.state,
+		Samples:     atomic.LoadUint64(&lu.samples),
+		Divergences: atomic.LoadUint64(&lu.divergences),
+		Message:     lu.message,
+	}
+}
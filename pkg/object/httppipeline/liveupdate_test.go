@@ -0,0 +1,242 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httppipeline
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/httpfilter"
+)
+
+type (
+	liveUpdateTestFilter struct {
+		spec *liveUpdateTestSpec
+	}
+
+	liveUpdateTestSpec struct {
+		Result string `yaml:"result" jsonschema:"omitempty"`
+		// Block blocks the filter until liveUpdateTestRelease is closed.
+		Block bool `yaml:"block" jsonschema:"omitempty"`
+	}
+
+	// liveUpdateTestRequest is the request seen by liveUpdateTestFilter.
+	liveUpdateTestRequest struct {
+		result string
+		shadow string
+		body   string
+	}
+)
+
+var (
+	liveUpdateTestRequests = make(chan *liveUpdateTestRequest, 10)
+	liveUpdateTestRelease  = make(chan struct{})
+)
+
+func init() {
+	Register(&liveUpdateTestFilter{})
+}
+
+func (f *liveUpdateTestFilter) Kind() string             { return "LiveUpdateTestFilter" }
+func (f *liveUpdateTestFilter) DefaultSpec() interface{} { return &liveUpdateTestSpec{} }
+func (f *liveUpdateTestFilter) Description() string      { return "" }
+func (f *liveUpdateTestFilter) Results() []string        { return []string{"mismatched"} }
+func (f *liveUpdateTestFilter) Status() interface{}      { return nil }
+func (f *liveUpdateTestFilter) Close()                   {}
+func (f *liveUpdateTestFilter) Init(filterSpec *FilterSpec, super *supervisor.Supervisor) {
+	f.spec = filterSpec.FilterSpec().(*liveUpdateTestSpec)
+}
+func (f *liveUpdateTestFilter) Inherit(filterSpec *FilterSpec,
+	previousGeneration Filter, super *supervisor.Supervisor) {
+	f.Init(filterSpec, super)
+}
+
+func (f *liveUpdateTestFilter) Handle(ctx context.HTTPContext) string {
+	body, _ := ioutil.ReadAll(ctx.Request().Body())
+	if f.spec.Block {
+		<-liveUpdateTestRelease
+	}
+
+	liveUpdateTestRequests <- &liveUpdateTestRequest{
+		result: f.spec.Result,
+		shadow: ctx.Request().Header().Get(LiveUpdateShadowHeader),
+		body:   string(body),
+	}
+
+	return ctx.CallNextHandler(f.spec.Result)
+}
+
+func TestMain(m *testing.M) {
+	tempDir, err := ioutil.TempDir("", "eg-httppipeline-test")
+	if err != nil {
+		panic(err)
+	}
+	absLogDir := filepath.Join(tempDir, "log")
+	os.MkdirAll(absLogDir, 0755)
+	logger.Init(&option.Options{
+		Name:      "httppipeline-for-log",
+		AbsLogDir: absLogDir,
+	})
+
+	code := m.Run()
+
+	logger.Sync()
+	os.RemoveAll(tempDir)
+
+	os.Exit(code)
+}
+
+func newLiveUpdateTestPipeline(t *testing.T) *HTTPPipeline {
+	superSpec, err := supervisor.NewSpec(`
+name: pipeline
+kind: HTTPPipeline
+filters:
+- name: filter
+  kind: LiveUpdateTestFilter
+`)
+	if err != nil {
+		t.Fatalf("new spec failed: %v", err)
+	}
+
+	hp := &HTTPPipeline{}
+	hp.Init(superSpec, nil)
+	return hp
+}
+
+func receiveLiveUpdateTestRequest(t *testing.T) *liveUpdateTestRequest {
+	select {
+	case r := <-liveUpdateTestRequests:
+		return r
+	case <-time.After(3 * time.Second):
+		t.Fatalf("want a request handled, got none")
+		return nil
+	}
+}
+
+func TestLiveUpdateShadow(t *testing.T) {
+	hp := newLiveUpdateTestPipeline(t)
+	defer hp.Close()
+
+	_, err := hp.StartLiveUpdate("filter", &LiveUpdateSpec{
+		Filter: map[string]interface{}{
+			"name":   "filter",
+			"kind":   "LiveUpdateTestFilter",
+			"result": "mismatched",
+			"block":  true,
+		},
+		Shadow: &httpfilter.Spec{
+			Probability: &httpfilter.Probability{PerMill: 1000, Policy: "random"},
+		},
+		Window:     "1h",
+		MinSamples: 10,
+	}, func(spec *supervisor.Spec) error {
+		t.Errorf("want no promotion")
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("start live update failed: %v", err)
+	}
+
+	ctx := newSandboxTestContext("hello", 5)
+	hp.Handle(ctx)
+	ctx.Finish()
+
+	// NOTE: The shadow is still blocked, so the request has been
+	// handled by the old filter without waiting for it.
+	r := receiveLiveUpdateTestRequest(t)
+	if r.result != "" || r.shadow != "" || r.body != "hello" {
+		t.Errorf("old filter: want the original request, got %+v", r)
+	}
+	if samples := hp.getLiveUpdate().status().Samples; samples != 0 {
+		t.Errorf("want no sample before the shadow finished, got %d", samples)
+	}
+
+	close(liveUpdateTestRelease)
+	r = receiveLiveUpdateTestRequest(t)
+	if r.result != "mismatched" || r.shadow != "true" || r.body != "hello" {
+		t.Errorf("new filter: want the shadowed request with body, got %+v", r)
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		status := hp.getLiveUpdate().status()
+		if status.Samples == 1 && status.Divergences == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("want 1 divergent sample, got %+v", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestLiveUpdateAbortOnDivergence(t *testing.T) {
+	hp := newLiveUpdateTestPipeline(t)
+	defer hp.Close()
+
+	_, err := hp.StartLiveUpdate("filter", &LiveUpdateSpec{
+		Filter: map[string]interface{}{
+			"name": "filter",
+			"kind": "LiveUpdateTestFilter",
+		},
+		Shadow: &httpfilter.Spec{
+			Probability: &httpfilter.Probability{PerMill: 1000, Policy: "random"},
+		},
+		Window: "1h",
+	}, nil)
+	if err != nil {
+		t.Fatalf("start live update failed: %v", err)
+	}
+
+	_, err = hp.StartLiveUpdate("filter", &LiveUpdateSpec{
+		Filter: map[string]interface{}{"name": "filter", "kind": "LiveUpdateTestFilter"},
+		Window: "1h",
+	}, nil)
+	if err != ErrLiveUpdateRunning {
+		t.Errorf("want %v, got %v", ErrLiveUpdateRunning, err)
+	}
+
+	_, err = hp.StartLiveUpdate("absent", &LiveUpdateSpec{
+		Filter: map[string]interface{}{"name": "absent", "kind": "LiveUpdateTestFilter"},
+		Window: "1h",
+	}, nil)
+	if err != ErrFilterNotFound {
+		t.Errorf("want %v, got %v", ErrFilterNotFound, err)
+	}
+
+	lu := hp.getLiveUpdate()
+	lu.spec.MinSamples = 2
+	lu.compare("", "")
+	lu.compare("", "mismatched")
+	status := lu.status()
+	if status.State != LiveUpdateAborted || status.Samples != 2 || status.Divergences != 1 {
+		t.Errorf("want aborted after 1/2 divergence, got %+v", status)
+	}
+
+	lu.compare("", "mismatched")
+	if samples := lu.status().Samples; samples != 2 {
+		t.Errorf("want no samples after aborted, got %d", samples)
+	}
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httppipeline
+
+import (
+	"fmt"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/supervisor"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// HandleWithOverride handles the context by a temporary generation of the
+// pipeline, whose spec is merged with the partial spec in override.
+// The temporary generation is closed once the context finished.
+func (hp *HTTPPipeline) HandleWithOverride(ctx context.HTTPContext, override []byte) error {
+	spec, err := hp.specWithOverride(override)
+	if err != nil {
+		return err
+	}
+
+	overridden := &HTTPPipeline{}
+	overridden.Init(spec, hp.super)
+	ctx.OnFinish(overridden.Close)
+
+	// NOTE: The temporary generation replaces the pipeline context
+	// and the template, restore them for the rest of this generation.
+	if pipeCtx, ok := GetPipelineContext(ctx); ok {
+		defer runningContexts.Store(ctx, pipeCtx)
+	}
+	defer ctx.SetTemplate(hp.ht)
+
+	overridden.Handle(ctx)
+
+	return nil
+}
+
+// specWithOverride returns the pipeline spec merged with the partial spec.
+// Filters in the partial spec are merged with the ones of the same names,
+// maps are merged recursively and the other values are replaced.
+func (hp *HTTPPipeline) specWithOverride(override []byte) (*supervisor.Spec, error) {
+	var whole map[interface{}]interface{}
+	err := yaml.Unmarshal([]byte(hp.superSpec.YAMLConfig()), &whole)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal pipeline spec failed: %v", err)
+	}
+
+	var partial map[interface{}]interface{}
+	err = yaml.Unmarshal(override, &partial)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal override spec failed: %v", err)
+	}
+
+	// NOTE: The identity of the pipeline can't be overridden.
+	delete(partial, "name")
+	delete(partial, "kind")
+
+	filters, _ := whole["filters"].([]interface{})
+	overrideFilters, ok := partial["filters"].([]interface{})
+	if !ok && partial["filters"] != nil {
+		return nil, fmt.Errorf("filters of override spec must be a list")
+	}
+	delete(partial, "filters")
+
+	for _, of := range overrideFilters {
+		name, _ := mapValue(of)["name"].(string)
+		index := -1
+		for i, f := range filters {
+			if mapValue(f)["name"] == name {
+				index = i
+				break
+			}
+		}
+		if index == -1 {
+			return nil, fmt.Errorf("filter %s not found", name)
+		}
+		filters[index] = mergeOverride(filters[index], of)
+	}
+
+	whole = mergeOverride(whole, partial).(map[interface{}]interface{})
+
+	buff, err := yaml.Marshal(whole)
+	if err != nil {
+		return nil, fmt.Errorf("marshal %#v to yaml failed: %v", whole, err)
+	}
+
+	return supervisor.NewSpec(string(buff))
+}
+
+func mapValue(value interface{}) map[interface{}]interface{} {
+	m, _ := value.(map[interface{}]interface{})
+	return m
+}
+
+// mergeOverride merges override into value, maps are merged recursively
+// and the other values are replaced.
+func mergeOverride(value, override interface{}) interface{} {
+	v, ok := value.(map[interface{}]interface{})
+	if !ok {
+		return override
+	}
+	o, ok := override.(map[interface{}]interface{})
+	if !ok {
+		return override
+	}
+
+	for key, ov := range o {
+		v[key] = mergeOverride(v[key], ov)
+	}
+
+	return v
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httppipeline
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/tracing"
+)
+
+func TestSpecWithOverride(t *testing.T) {
+	hp := newLiveUpdateTestPipeline(t)
+	defer hp.Close()
+
+	spec, err := hp.specWithOverride([]byte(`
+name: other
+filters:
+- name: filter
+  result: mismatched
+`))
+	if err != nil {
+		t.Fatalf("override failed: %v", err)
+	}
+	if spec.Name() != "pipeline" {
+		t.Errorf("want name pipeline, got %s", spec.Name())
+	}
+	filters := spec.ObjectSpec().(*Spec).Filters
+	if filters[0]["kind"] != "LiveUpdateTestFilter" || filters[0]["result"] != "mismatched" {
+		t.Errorf("want filter merged, got %v", filters[0])
+	}
+	if hp.spec.Filters[0]["result"] != nil {
+		t.Errorf("want the running spec untouched, got %v", hp.spec.Filters[0])
+	}
+
+	for _, override := range []string{
+		"filters:\n- name: unknown\n  result: mismatched\n",
+		"filters:\n- name: filter\n  kind: Unknown\n",
+		"filters: filter\n",
+		"{",
+	} {
+		if _, err := hp.specWithOverride([]byte(override)); err == nil {
+			t.Errorf("want error for override %q", override)
+		}
+	}
+}
+
+func TestHandleWithOverride(t *testing.T) {
+	hp := newLiveUpdateTestPipeline(t)
+	defer hp.Close()
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader("body"))
+	ctx := context.New(httptest.NewRecorder(), req, tracing.NoopTracing, "no trace")
+	pipeCtx := newAndSetPipelineContext(ctx)
+	defer deletePipelineContext(ctx)
+
+	err := hp.HandleWithOverride(ctx, []byte("filters:\n- name: filter\n  result: mismatched\n"))
+	if err != nil {
+		t.Fatalf("override failed: %v", err)
+	}
+	r := receiveLiveUpdateTestRequest(t)
+	if r.result != "mismatched" || r.body != "body" {
+		t.Errorf("want handled by the overridden filter, got %+v", r)
+	}
+	if got, _ := GetPipelineContext(ctx); got != pipeCtx {
+		t.Errorf("want the pipeline context restored")
+	}
+	ctx.Finish()
+}
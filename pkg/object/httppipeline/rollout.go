@@ -0,0 +1,456 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httppipeline
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const (
+	// RolloutRunning means the traffic is being shifted to the new version.
+	RolloutRunning = "running"
+	// RolloutPaused means the traffic stays at the current step.
+	RolloutPaused = "paused"
+	// RolloutCompleted means the new version takes all traffic.
+	RolloutCompleted = "completed"
+	// RolloutRolledBack means the old version takes all traffic back.
+	RolloutRolledBack = "rolledBack"
+	// RolloutAborted means the pipeline was updated or closed during the rollout.
+	RolloutAborted = "aborted"
+
+	// rolloutScale is the scale of weights, in basis points.
+	rolloutScale = 10000
+)
+
+// ErrRolloutNotRunning is the error of pausing or resuming a finished rollout.
+var ErrRolloutNotRunning = fmt.Errorf("no rollout running")
+
+type (
+	// ProgressiveRolloutSpec describes the progressive rollout of a new
+	// pipeline spec. The old and new versions run side by side, the traffic
+	// is shifted to the new one by steps, and it's shifted back if the error
+	// rate of the new version exceeds the one of the old version too much.
+	ProgressiveRolloutSpec struct {
+		// Steps are the ascending percentages of traffic, e.g. 10%, the last one must be 100%.
+		Steps        []string `yaml:"steps" jsonschema:"required,minItems=1"`
+		StepInterval string   `yaml:"stepInterval" jsonschema:"required,format=duration"`
+		// ErrorRateThreshold is the max percentage the error rate of the new
+		// version exceeds the old one by, responses of 5xx are errors.
+		ErrorRateThreshold string `yaml:"errorRateThreshold" jsonschema:"omitempty"`
+		// MinSamples is the minimum number of requests to the new version
+		// to leave a step, the step is prolonged until it's reached.
+		MinSamples uint64 `yaml:"minSamples" jsonschema:"omitempty"`
+	}
+
+	// RolloutStatus is the status of the progressive rollout.
+	RolloutStatus struct {
+		State      string `yaml:"state"`
+		Step       int    `yaml:"step"`
+		Percentage string `yaml:"percentage"`
+
+		// The requests and errors of the current step.
+		NewRequests uint64 `yaml:"newRequests"`
+		NewErrors   uint64 `yaml:"newErrors"`
+		OldRequests uint64 `yaml:"oldRequests"`
+		OldErrors   uint64 `yaml:"oldErrors"`
+
+		Message string `yaml:"message,omitempty"`
+
+		// RunningPrevious is true once rolled back, the previous spec
+		// keeps running instead of the stored one until the pipeline
+		// is updated again.
+		RunningPrevious bool `yaml:"runningPrevious,omitempty"`
+	}
+
+	rollout struct {
+		spec      *ProgressiveRolloutSpec
+		steps     []uint64
+		interval  time.Duration
+		threshold float64
+		// previous is the old version, closed once the rollout finished
+		// unless it takes all traffic back.
+		previous *HTTPPipeline
+		// closeNew closes the filters of the new version once rolled back.
+		closeNew func()
+
+		// weight is the basis points of traffic to the new version, accessed atomically.
+		weight uint64
+		// The counters are accessed atomically, and reset on every step.
+		newRequests, newErrors uint64
+		oldRequests, oldErrors uint64
+
+		mutex          sync.Mutex
+		step           int
+		state          string
+		message        string
+		previousClosed bool
+		wake           chan struct{}
+		done           chan struct{}
+	}
+)
+
+// parsePercent parses percentages like 12.5% to ratios.
+func parsePercent(s string) (float64, error) {
+	if !strings.HasSuffix(s, "%") {
+		return 0, fmt.Errorf("invalid percentage %s: %% is required", s)
+	}
+
+	f, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid percentage %s: %v", s, err)
+	}
+	if f < 0 || f > 100 {
+		return 0, fmt.Errorf("invalid percentage %s: out of range [0%%, 100%%]", s)
+	}
+
+	return f / 100, nil
+}
+
+func formatPercent(weight uint64) string {
+	return strconv.FormatFloat(float64(weight)*100/rolloutScale, 'f', -1, 64) + "%"
+}
+
+// steps returns the weights of steps.
+func (s *ProgressiveRolloutSpec) steps() ([]uint64, error) {
+	steps := make([]uint64, 0, len(s.Steps))
+	for _, step := range s.Steps {
+		ratio, err := parsePercent(step)
+		if err != nil {
+			return nil, err
+		}
+
+		weight := uint64(ratio*rolloutScale + 0.5)
+		if weight == 0 {
+			return nil, fmt.Errorf("step %s: must be greater than 0%%", step)
+		}
+		if len(steps) > 0 && weight <= steps[len(steps)-1] {
+			return nil, fmt.Errorf("step %s: steps must be ascending", step)
+		}
+		steps = append(steps, weight)
+	}
+
+	if steps[len(steps)-1] != rolloutScale {
+		return nil, fmt.Errorf("the last step must be 100%%")
+	}
+
+	return steps, nil
+}
+
+func (s *ProgressiveRolloutSpec) threshold() (float64, error) {
+	if s.ErrorRateThreshold == "" {
+		return 0, nil
+	}
+
+	return parsePercent(s.ErrorRateThreshold)
+}
+
+func (s *ProgressiveRolloutSpec) validate() error {
+	if _, err := s.steps(); err != nil {
+		return err
+	}
+
+	if _, err := s.threshold(); err != nil {
+		return fmt.Errorf("errorRateThreshold: %v", err)
+	}
+
+	return nil
+}
+
+func newRollout(spec *ProgressiveRolloutSpec, previous *HTTPPipeline) *rollout {
+	// NOTE: The spec has been validated.
+	steps, _ := spec.steps()
+	threshold, _ := spec.threshold()
+	interval, _ := time.ParseDuration(spec.StepInterval)
+
+	return &rollout{
+		spec:      spec,
+		steps:     steps,
+		interval:  interval,
+		threshold: threshold,
+		previous:  previous,
+		weight:    steps[0],
+		state:     RolloutRunning,
+		wake:      make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+}
+
+func (hp *HTTPPipeline) getRollout() *rollout {
+	ro, _ := hp.rollout.Load().(*rollout)
+	return ro
+}
+
+// inheritRollout takes over the previous generation, its unfinished
+// rollout is aborted and the version older than it is closed. It returns
+// the generation to inherit, which is the older version if the rollout
+// has been rolled back, as it's the one running.
+func (hp *HTTPPipeline) inheritRollout(previousGeneration *HTTPPipeline) *HTTPPipeline {
+	ro := previousGeneration.getRollout()
+	if ro == nil {
+		return previousGeneration
+	}
+
+	ro.finish(RolloutAborted, "pipeline updated")
+	if ro.rolledBack() {
+		return ro.previous
+	}
+
+	ro.closePrevious()
+	previousGeneration.rollout.Store((*rollout)(nil))
+
+	return previousGeneration
+}
+
+// servingGeneration returns the generation handling the requests,
+// which is the previous one if the rollout has been rolled back.
+func (hp *HTTPPipeline) servingGeneration() *HTTPPipeline {
+	if ro := hp.getRollout(); ro != nil && ro.rolledBack() {
+		return ro.previous
+	}
+
+	return hp
+}
+
+// startRollout runs the previous generation alongside this one.
+func (hp *HTTPPipeline) startRollout(previousGeneration *HTTPPipeline) {
+	ro := newRollout(hp.spec.ProgressiveRollout, previousGeneration)
+	ro.closeNew = hp.closeFilters
+	hp.rollout.Store(ro)
+
+	go ro.run(hp.superSpec.Name())
+}
+
+// handleRollout dispatches the request to the old version or the new one,
+// it returns false if the new version should handle it.
+func (hp *HTTPPipeline) handleRollout(ctx context.HTTPContext) bool {
+	ro := hp.getRollout()
+	if ro == nil {
+		return false
+	}
+
+	weight := atomic.LoadUint64(&ro.weight)
+	if weight == rolloutScale || uint64(rand.Intn(rolloutScale)) < weight {
+		ctx.OnFinish(func() {
+			ro.record(ctx, &ro.newRequests, &ro.newErrors)
+		})
+		return false
+	}
+
+	ctx.OnFinish(func() {
+		ro.record(ctx, &ro.oldRequests, &ro.oldErrors)
+	})
+	ro.previous.Handle(ctx)
+
+	return true
+}
+
+func (ro *rollout) record(ctx context.HTTPContext, requests, errors *uint64) {
+	atomic.AddUint64(requests, 1)
+	if ctx.Response().StatusCode() >= 500 {
+		atomic.AddUint64(errors, 1)
+	}
+}
+
+func (ro *rollout) run(pipelineName string) {
+	for {
+		ro.mutex.Lock()
+		state := ro.state
+		ro.mutex.Unlock()
+
+		var timeout <-chan time.Time
+		if state == RolloutRunning {
+			timeout = time.After(ro.interval)
+		}
+
+		select {
+		case <-ro.done:
+			logger.Infof("rollout of %s finished: %s", pipelineName, ro.status().State)
+			return
+		case <-ro.wake:
+			// NOTE: The step restarts once resumed.
+		case <-timeout:
+			ro.nextStep(pipelineName)
+		}
+	}
+}
+
+// nextStep judges the error rates of the current step,
+// and moves to the next step or rolls back.
+func (ro *rollout) nextStep(pipelineName string) {
+	newRequests := atomic.LoadUint64(&ro.newRequests)
+	newErrors := atomic.LoadUint64(&ro.newErrors)
+	oldRequests := atomic.LoadUint64(&ro.oldRequests)
+	oldErrors := atomic.LoadUint64(&ro.oldErrors)
+
+	if newRequests < ro.spec.MinSamples {
+		logger.Infof("rollout of %s: step prolonged for not enough samples %d/%d",
+			pipelineName, newRequests, ro.spec.MinSamples)
+		return
+	}
+
+	rate := func(errors, requests uint64) float64 {
+		if requests == 0 {
+			return 0
+		}
+		return float64(errors) / float64(requests)
+	}
+
+	newRate, oldRate := rate(newErrors, newRequests), rate(oldErrors, oldRequests)
+	if newRate-oldRate > ro.threshold {
+		message := fmt.Sprintf("error rate %d/%d of the new version exceeds %d/%d of the old one",
+			newErrors, newRequests, oldErrors, oldRequests)
+		if ro.finish(RolloutRolledBack, message) {
+			atomic.StoreUint64(&ro.weight, 0)
+			logger.Warnf("rollout of %s rolled back: %s, the previous spec keeps running "+
+				"instead of the stored one until the pipeline is updated", pipelineName, message)
+			ro.closeNew()
+		}
+		return
+	}
+
+	ro.mutex.Lock()
+	defer ro.mutex.Unlock()
+
+	if ro.state != RolloutRunning {
+		return
+	}
+
+	ro.step++
+	atomic.StoreUint64(&ro.weight, ro.steps[ro.step])
+	for _, counter := range []*uint64{&ro.newRequests, &ro.newErrors, &ro.oldRequests, &ro.oldErrors} {
+		atomic.StoreUint64(counter, 0)
+	}
+
+	if ro.step == len(ro.steps)-1 {
+		ro.state = RolloutCompleted
+		close(ro.done)
+		go ro.closePrevious()
+		return
+	}
+
+	logger.Infof("rollout of %s: shift %s traffic to the new version",
+		pipelineName, formatPercent(ro.steps[ro.step]))
+}
+
+// setPaused pauses or resumes the unfinished rollout.
+func (ro *rollout) setPaused(paused bool) error {
+	ro.mutex.Lock()
+	defer ro.mutex.Unlock()
+
+	if ro.state != RolloutRunning && ro.state != RolloutPaused {
+		return ErrRolloutNotRunning
+	}
+
+	if paused {
+		ro.state = RolloutPaused
+	} else {
+		ro.state = RolloutRunning
+	}
+
+	select {
+	case ro.wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// finish transits the unfinished state to the final one,
+// it returns false if it has been finished.
+func (ro *rollout) finish(state, message string) bool {
+	ro.mutex.Lock()
+	defer ro.mutex.Unlock()
+
+	if ro.state != RolloutRunning && ro.state != RolloutPaused {
+		return false
+	}
+
+	ro.state, ro.message = state, message
+	close(ro.done)
+
+	return true
+}
+
+func (ro *rollout) rolledBack() bool {
+	ro.mutex.Lock()
+	defer ro.mutex.Unlock()
+
+	return ro.state == RolloutRolledBack
+}
+
+func (ro *rollout) closePrevious() {
+	ro.mutex.Lock()
+	if ro.previousClosed {
+		ro.mutex.Unlock()
+		return
+	}
+	ro.previousClosed = true
+	ro.mutex.Unlock()
+
+	ro.previous.Close()
+}
+
+func (ro *rollout) status() *RolloutStatus {
+	ro.mutex.Lock()
+	defer ro.mutex.Unlock()
+
+	return &RolloutStatus{
+		State:       ro.state,
+		Step:        ro.step + 1,
+		Percentage:  formatPercent(atomic.LoadUint64(&ro.weight)),
+		NewRequests: atomic.LoadUint64(&ro.newRequests),
+		NewErrors:   atomic.LoadUint64(&ro.newErrors),
+		OldRequests: atomic.LoadUint64(&ro.oldRequests),
+		OldErrors:   atomic.LoadUint64(&ro.oldErrors),
+		Message:     ro.message,
+
+		RunningPrevious: ro.state == RolloutRolledBack,
+	}
+}
+
+// PauseRollout keeps the traffic at the current step of the rollout.
+func (hp *HTTPPipeline) PauseRollout() (*RolloutStatus, error) {
+	return hp.setRolloutPaused(true)
+}
+
+// ResumeRollout resumes the paused rollout, the current step restarts.
+func (hp *HTTPPipeline) ResumeRollout() (*RolloutStatus, error) {
+	return hp.setRolloutPaused(false)
+}
+
+func (hp *HTTPPipeline) setRolloutPaused(paused bool) (*RolloutStatus, error) {
+	ro := hp.getRollout()
+	if ro == nil {
+		return nil, ErrRolloutNotRunning
+	}
+
+	if err := ro.setPaused(paused); err != nil {
+		return nil, err
+	}
+
+	return ro.status(), nil
+}
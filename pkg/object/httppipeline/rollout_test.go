@@ -0,0 +1,294 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httppipeline
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/tracing"
+)
+
+type (
+	rolloutTestFilter struct {
+		spec   *rolloutTestSpec
+		closed int32
+	}
+
+	rolloutTestSpec struct {
+		Version int `yaml:"version" jsonschema:"omitempty"`
+		Code    int `yaml:"code" jsonschema:"omitempty"`
+	}
+)
+
+func init() {
+	Register(&rolloutTestFilter{})
+}
+
+func (f *rolloutTestFilter) Kind() string             { return "RolloutTestFilter" }
+func (f *rolloutTestFilter) DefaultSpec() interface{} { return &rolloutTestSpec{} }
+func (f *rolloutTestFilter) Description() string      { return "" }
+func (f *rolloutTestFilter) Results() []string        { return nil }
+func (f *rolloutTestFilter) Status() interface{}      { return nil }
+func (f *rolloutTestFilter) Close()                   { atomic.AddInt32(&f.closed, 1) }
+func (f *rolloutTestFilter) Init(filterSpec *FilterSpec, super *supervisor.Supervisor) {
+	f.spec = filterSpec.FilterSpec().(*rolloutTestSpec)
+}
+func (f *rolloutTestFilter) Inherit(filterSpec *FilterSpec,
+	previousGeneration Filter, super *supervisor.Supervisor) {
+	f.Init(filterSpec, super)
+}
+
+func (f *rolloutTestFilter) Handle(ctx context.HTTPContext) string {
+	ctx.Response().Header().Set("X-Version", strconv.Itoa(f.spec.Version))
+	if f.spec.Code != 0 {
+		ctx.Response().SetStatusCode(f.spec.Code)
+	}
+	return ctx.CallNextHandler("")
+}
+
+func newRolloutTestSpec(t *testing.T, version, code int, rollout string) *supervisor.Spec {
+	superSpec, err := supervisor.NewSpec(`
+name: pipeline
+kind: HTTPPipeline
+filters:
+- name: filter
+  kind: RolloutTestFilter
+  version: ` + strconv.Itoa(version) + `
+  code: ` + strconv.Itoa(code) + `
+` + rollout)
+	if err != nil {
+		t.Fatalf("new spec failed: %v", err)
+	}
+	return superSpec
+}
+
+// newRolloutTestPipeline returns the new version rolled out from the old one.
+func newRolloutTestPipeline(t *testing.T, newCode int, rollout string) *HTTPPipeline {
+	old := &HTTPPipeline{}
+	old.Init(newRolloutTestSpec(t, 1, http.StatusOK, ""), nil)
+
+	hp := &HTTPPipeline{}
+	hp.Inherit(newRolloutTestSpec(t, 2, newCode, rollout), old, nil)
+	return hp
+}
+
+// handleRolloutTest returns the version handling the request.
+func handleRolloutTest(hp *HTTPPipeline) string {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	ctx := context.New(httptest.NewRecorder(), req, tracing.NoopTracing, "no trace")
+	hp.Handle(ctx)
+	version := ctx.Response().Header().Get("X-Version")
+	ctx.Finish()
+	return version
+}
+
+// closedRolloutTest returns the times the filter of the version is closed,
+// it waits for want at most 1 second as the rollback closes it asynchronously.
+func closedRolloutTest(hp *HTTPPipeline, want int32) int32 {
+	f := hp.runningFilters[0].filter.(*rolloutTestFilter)
+	for i := 0; i < 100 && atomic.LoadInt32(&f.closed) < want; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return atomic.LoadInt32(&f.closed)
+}
+
+func waitRolloutState(t *testing.T, hp *HTTPPipeline, state string) *RolloutStatus {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		status := hp.getRollout().status()
+		if status.State == state {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("want rollout %s, got %+v", state, status)
+		}
+		handleRolloutTest(hp)
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestProgressiveRolloutSpec(t *testing.T) {
+	for _, c := range []struct {
+		steps     []string
+		threshold string
+		valid     bool
+	}{
+		{[]string{"10%", "30%", "100%"}, "1%", true},
+		{[]string{"12.5%", "100%"}, "", true},
+		{[]string{"100%"}, "", true},
+		{[]string{"10", "100%"}, "", false},
+		{[]string{"30%", "10%", "100%"}, "", false},
+		{[]string{"0%", "100%"}, "", false},
+		{[]string{"10%", "60%"}, "", false},
+		{[]string{"10%", "100%"}, "101%", false},
+	} {
+		spec := &ProgressiveRolloutSpec{Steps: c.steps, ErrorRateThreshold: c.threshold}
+		if err := spec.validate(); (err == nil) != c.valid {
+			t.Errorf("%v %s: want valid %v, got %v", c.steps, c.threshold, c.valid, err)
+		}
+	}
+}
+
+func TestRolloutCompleted(t *testing.T) {
+	hp := newRolloutTestPipeline(t, http.StatusOK, `
+progressiveRollout:
+  steps: [50%, 100%]
+  stepInterval: 100ms
+`)
+	defer hp.Close()
+
+	versions := map[string]int{}
+	for i := 0; i < 200; i++ {
+		versions[handleRolloutTest(hp)]++
+	}
+	if versions["1"] == 0 || versions["2"] == 0 {
+		t.Errorf("want both versions handling requests, got %v", versions)
+	}
+
+	status := waitRolloutState(t, hp, RolloutCompleted)
+	if status.Percentage != "100%" {
+		t.Errorf("want 100%%, got %+v", status)
+	}
+	for i := 0; i < 10; i++ {
+		if version := handleRolloutTest(hp); version != "2" {
+			t.Fatalf("want version 2 after rollout, got %s", version)
+		}
+	}
+}
+
+func TestRolloutRolledBack(t *testing.T) {
+	hp := newRolloutTestPipeline(t, http.StatusInternalServerError, `
+progressiveRollout:
+  steps: [50%, 100%]
+  stepInterval: 100ms
+  errorRateThreshold: 1%
+`)
+	defer hp.Close()
+
+	status := waitRolloutState(t, hp, RolloutRolledBack)
+	if status.Percentage != "0%" || status.Message == "" {
+		t.Errorf("want rolled back to 0%% with message, got %+v", status)
+	}
+	for i := 0; i < 10; i++ {
+		if version := handleRolloutTest(hp); version != "1" {
+			t.Fatalf("want version 1 after rollback, got %s", version)
+		}
+	}
+
+	if _, err := hp.PauseRollout(); err != ErrRolloutNotRunning {
+		t.Errorf("want %v, got %v", ErrRolloutNotRunning, err)
+	}
+
+	// NOTE: The new version is closed, and the old one keeps running.
+	if !status.RunningPrevious {
+		t.Errorf("want running previous spec, got %+v", status)
+	}
+	old := hp.getRollout().previous
+	if closedRolloutTest(hp, 1) != 1 || closedRolloutTest(old, 0) != 0 {
+		t.Errorf("want only new version closed")
+	}
+	if filters := hp.RunningFilters(); filters[0] != old.runningFilters[0].filter {
+		t.Errorf("want running filters of the old version")
+	}
+
+	// NOTE: The next generation inherits the old version.
+	next := &HTTPPipeline{}
+	next.Inherit(newRolloutTestSpec(t, 3, http.StatusOK, ""), hp, nil)
+	if version := handleRolloutTest(next); version != "3" {
+		t.Fatalf("want version 3, got %s", version)
+	}
+	next.Close()
+	if closedRolloutTest(hp, 1) != 1 || closedRolloutTest(old, 0) != 0 || closedRolloutTest(next, 1) != 1 {
+		t.Errorf("want every version closed once")
+	}
+}
+
+func TestRolloutRolledBackClosed(t *testing.T) {
+	hp := newRolloutTestPipeline(t, http.StatusInternalServerError, `
+progressiveRollout:
+  steps: [50%, 100%]
+  stepInterval: 100ms
+  errorRateThreshold: 1%
+`)
+
+	waitRolloutState(t, hp, RolloutRolledBack)
+	old := hp.getRollout().previous
+	hp.Close()
+
+	for _, p := range []*HTTPPipeline{hp, old} {
+		if closed := closedRolloutTest(p, 1); closed != 1 {
+			t.Errorf("want closed once, got %d", closed)
+		}
+	}
+}
+
+func TestRolloutPauseResume(t *testing.T) {
+	hp := newRolloutTestPipeline(t, http.StatusOK, `
+progressiveRollout:
+  steps: [10%, 100%]
+  stepInterval: 50ms
+`)
+	defer hp.Close()
+
+	status, err := hp.PauseRollout()
+	if err != nil || status.State != RolloutPaused {
+		t.Fatalf("want paused, got %+v: %v", status, err)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	status = hp.Status().ObjectStatus.(*Status).Rollout
+	if status.State != RolloutPaused || status.Step != 1 || status.Percentage != "10%" {
+		t.Errorf("want paused at step 1, got %+v", status)
+	}
+
+	status, err = hp.ResumeRollout()
+	if err != nil || status.State != RolloutRunning {
+		t.Fatalf("want running, got %+v: %v", status, err)
+	}
+	waitRolloutState(t, hp, RolloutCompleted)
+}
+
+func TestRolloutAbortedByUpdate(t *testing.T) {
+	hp := newRolloutTestPipeline(t, http.StatusOK, `
+progressiveRollout:
+  steps: [50%, 100%]
+  stepInterval: 1h
+`)
+	ro := hp.getRollout()
+
+	next := &HTTPPipeline{}
+	next.Inherit(newRolloutTestSpec(t, 3, http.StatusOK, ""), hp, nil)
+	defer next.Close()
+
+	if status := ro.status(); status.State != RolloutAborted {
+		t.Errorf("want aborted, got %+v", status)
+	}
+	for i := 0; i < 10; i++ {
+		if version := handleRolloutTest(next); version != "3" {
+			t.Fatalf("want version 3, got %s", version)
+		}
+	}
+}
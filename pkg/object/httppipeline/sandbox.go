@@ -0,0 +1,333 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httppipeline
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+
+	"golang.org/x/sync/semaphore"
+)
+
+const (
+	defaultSandboxBaseBackoff = 100 * time.Millisecond
+	defaultSandboxMaxBackoff  = 30 * time.Second
+)
+
+var (
+	errSandboxConcurrency = fmt.Errorf("concurrency quota exceeded")
+	errSandboxBody        = fmt.Errorf("buffered body quota exceeded")
+	errSandboxBackoff     = fmt.Errorf("backing off after exceeding quotas")
+)
+
+type (
+	// SandboxSpec describes the resource quotas of one pipeline, it isolates
+	// the pipelines of different tenants sharing the same instance.
+	SandboxSpec struct {
+		// MaxConcurrency is the max number of requests handled at the same time.
+		MaxConcurrency int64 `yaml:"maxConcurrency" jsonschema:"omitempty,minimum=1"`
+		// MaxBufferedBodyBytes is the max total size of the request bodies
+		// held by the in-flight requests.
+		MaxBufferedBodyBytes int64 `yaml:"maxBufferedBodyBytes" jsonschema:"omitempty,minimum=1"`
+		// CPUQuota is the max CPU time spent on one request, it's only
+		// enforced on Linux.
+		CPUQuota string `yaml:"cpuQuota" jsonschema:"omitempty,format=duration"`
+		// BaseBackoff is the backoff after the first violation,
+		// it doubles on every consecutive one up to MaxBackoff.
+		BaseBackoff string `yaml:"baseBackoff" jsonschema:"omitempty,format=duration"`
+		MaxBackoff  string `yaml:"maxBackoff" jsonschema:"omitempty,format=duration"`
+	}
+
+	// SandboxStatus is the status of the sandbox.
+	SandboxStatus struct {
+		InFlight          int64  `yaml:"inFlight"`
+		BufferedBodyBytes int64  `yaml:"bufferedBodyBytes"`
+		Violations        uint64 `yaml:"violations"`
+		Rejections        uint64 `yaml:"rejections"`
+		BackoffUntil      string `yaml:"backoffUntil,omitempty"`
+	}
+
+	sandbox struct {
+		spec        *SandboxSpec
+		sem         *semaphore.Weighted
+		cpuQuota    time.Duration
+		baseBackoff time.Duration
+		maxBackoff  time.Duration
+
+		inFlight      int64
+		bufferedBytes int64
+		violations    uint64
+		rejections    uint64
+
+		mutex        sync.Mutex
+		consecutive  uint
+		backoffUntil time.Time
+	}
+
+	// sandboxBodyReader charges the request body of unknown length
+	// to the sandbox while it's being read.
+	sandboxBodyReader struct {
+		sb     *sandbox
+		reader io.Reader
+
+		mutex    sync.Mutex
+		charged  int64
+		exceeded bool
+		closed   bool
+	}
+)
+
+func (spec *SandboxSpec) validate() error {
+	var err error
+	durations := make(map[string]time.Duration)
+	for name, value := range map[string]string{
+		"cpuQuota":    spec.CPUQuota,
+		"baseBackoff": spec.BaseBackoff,
+		"maxBackoff":  spec.MaxBackoff,
+	} {
+		if value == "" {
+			continue
+		}
+		durations[name], err = time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s %s: %v", name, value, err)
+		}
+		if durations[name] <= 0 {
+			return fmt.Errorf("%s must be positive", name)
+		}
+	}
+
+	if spec.BaseBackoff != "" && spec.MaxBackoff != "" &&
+		durations["baseBackoff"] > durations["maxBackoff"] {
+		return fmt.Errorf("baseBackoff %s is greater than maxBackoff %s",
+			spec.BaseBackoff, spec.MaxBackoff)
+	}
+
+	return nil
+}
+
+func newSandbox(spec *SandboxSpec) *sandbox {
+	sb := &sandbox{
+		spec:        spec,
+		baseBackoff: defaultSandboxBaseBackoff,
+		maxBackoff:  defaultSandboxMaxBackoff,
+	}
+
+	if spec.MaxConcurrency > 0 {
+		sb.sem = semaphore.NewWeighted(spec.MaxConcurrency)
+	}
+
+	// NOTE: The durations have been checked in validation.
+	if spec.CPUQuota != "" {
+		sb.cpuQuota, _ = time.ParseDuration(spec.CPUQuota)
+	}
+	if spec.BaseBackoff != "" {
+		sb.baseBackoff, _ = time.ParseDuration(spec.BaseBackoff)
+	}
+	if spec.MaxBackoff != "" {
+		sb.maxBackoff, _ = time.ParseDuration(spec.MaxBackoff)
+	}
+	if sb.baseBackoff > sb.maxBackoff {
+		sb.baseBackoff = sb.maxBackoff
+	}
+
+	return sb
+}
+
+// enter admits the request into the sandbox, the returned leave must be
+// called in the same goroutine after the request has been handled.
+func (sb *sandbox) enter(ctx context.HTTPContext) (leave func(), err error) {
+	if sb.backingOff() {
+		atomic.AddUint64(&sb.rejections, 1)
+		return nil, errSandboxBackoff
+	}
+
+	if sb.sem != nil && !sb.sem.TryAcquire(1) {
+		sb.reject()
+		return nil, errSandboxConcurrency
+	}
+
+	var charged int64
+	var br *sandboxBodyReader
+	if sb.spec.MaxBufferedBodyBytes > 0 {
+		if cl := ctx.Request().Std().ContentLength; cl > 0 {
+			if !sb.charge(cl) {
+				if sb.sem != nil {
+					sb.sem.Release(1)
+				}
+				sb.reject()
+				return nil, errSandboxBody
+			}
+			charged = cl
+		} else if cl < 0 {
+			br = &sandboxBodyReader{sb: sb, reader: ctx.Request().Body()}
+			ctx.Request().SetBody(br)
+		}
+	}
+
+	// NOTE: setitimer(2) accounts CPU time of the whole process and
+	// its signals land on arbitrary threads, so the CPU time is accounted
+	// on the OS thread which the handling goroutine is locked to.
+	// The time spent in goroutines spawned by filters is not counted.
+	var cpuStart time.Duration
+	cpuAccounting := false
+	if sb.cpuQuota > 0 {
+		runtime.LockOSThread()
+		cpuStart, cpuAccounting = threadCPUTime()
+	}
+
+	atomic.AddInt64(&sb.inFlight, 1)
+
+	return func() {
+		atomic.AddInt64(&sb.inFlight, -1)
+
+		exceeded := false
+		if sb.cpuQuota > 0 {
+			if cpuEnd, ok := threadCPUTime(); ok && cpuAccounting {
+				if cpuTime := cpuEnd - cpuStart; cpuTime > sb.cpuQuota {
+					logger.Warnf("cpu time %v exceeds quota %v", cpuTime, sb.cpuQuota)
+					exceeded = true
+				}
+			}
+			runtime.UnlockOSThread()
+		}
+
+		if br != nil {
+			n, bodyExceeded := br.close()
+			charged += n
+			exceeded = exceeded || bodyExceeded
+		}
+		sb.release(charged)
+
+		if sb.sem != nil {
+			sb.sem.Release(1)
+		}
+
+		if exceeded {
+			sb.violate()
+		} else {
+			sb.succeed()
+		}
+	}, nil
+}
+
+func (sb *sandbox) charge(n int64) bool {
+	if atomic.AddInt64(&sb.bufferedBytes, n) > sb.spec.MaxBufferedBodyBytes {
+		atomic.AddInt64(&sb.bufferedBytes, -n)
+		return false
+	}
+	return true
+}
+
+func (sb *sandbox) release(n int64) {
+	atomic.AddInt64(&sb.bufferedBytes, -n)
+}
+
+func (sb *sandbox) backingOff() bool {
+	sb.mutex.Lock()
+	defer sb.mutex.Unlock()
+
+	return time.Now().Before(sb.backoffUntil)
+}
+
+func (sb *sandbox) reject() {
+	atomic.AddUint64(&sb.rejections, 1)
+	sb.violate()
+}
+
+// violate starts the backoff, which doubles on consecutive violations.
+func (sb *sandbox) violate() {
+	atomic.AddUint64(&sb.violations, 1)
+
+	sb.mutex.Lock()
+	defer sb.mutex.Unlock()
+
+	backoff := sb.baseBackoff
+	for i := uint(0); i < sb.consecutive && backoff < sb.maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > sb.maxBackoff {
+		backoff = sb.maxBackoff
+	}
+	sb.consecutive++
+
+	sb.backoffUntil = time.Now().Add(backoff)
+}
+
+func (sb *sandbox) succeed() {
+	sb.mutex.Lock()
+	defer sb.mutex.Unlock()
+
+	sb.consecutive = 0
+}
+
+func (sb *sandbox) status() *SandboxStatus {
+	s := &SandboxStatus{
+		InFlight:          atomic.LoadInt64(&sb.inFlight),
+		BufferedBodyBytes: atomic.LoadInt64(&sb.bufferedBytes),
+		Violations:        atomic.LoadUint64(&sb.violations),
+		Rejections:        atomic.LoadUint64(&sb.rejections),
+	}
+
+	sb.mutex.Lock()
+	defer sb.mutex.Unlock()
+
+	if time.Now().Before(sb.backoffUntil) {
+		s.BackoffUntil = sb.backoffUntil.Format(time.RFC3339Nano)
+	}
+
+	return s
+}
+
+func (br *sandboxBodyReader) Read(p []byte) (int, error) {
+	n, err := br.reader.Read(p)
+	if n <= 0 {
+		return n, err
+	}
+
+	br.mutex.Lock()
+	defer br.mutex.Unlock()
+
+	// NOTE: The body may be read by the transport after the request left.
+	if br.closed {
+		return n, err
+	}
+
+	if br.exceeded || !br.sb.charge(int64(n)) {
+		br.exceeded = true
+		return 0, errSandboxBody
+	}
+	br.charged += int64(n)
+
+	return n, err
+}
+
+func (br *sandboxBodyReader) close() (charged int64, exceeded bool) {
+	br.mutex.Lock()
+	defer br.mutex.Unlock()
+
+	br.closed = true
+	return br.charged, br.exceeded
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httppipeline
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/tracing"
+)
+
+func newSandboxTestContext(body string, contentLength int64) context.HTTPContext {
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	req.ContentLength = contentLength
+	return context.New(httptest.NewRecorder(), req, tracing.NoopTracing, "no trace")
+}
+
+func TestSandboxConcurrencyBackoff(t *testing.T) {
+	sb := newSandbox(&SandboxSpec{
+		MaxConcurrency: 1,
+		BaseBackoff:    "50ms",
+		MaxBackoff:     "80ms",
+	})
+
+	leave, err := sb.enter(newSandboxTestContext("", 0))
+	if err != nil {
+		t.Fatalf("first request: want admitted, got %v", err)
+	}
+
+	if _, err := sb.enter(newSandboxTestContext("", 0)); err != errSandboxConcurrency {
+		t.Errorf("concurrent request: want %v, got %v", errSandboxConcurrency, err)
+	}
+	leave()
+
+	if _, err := sb.enter(newSandboxTestContext("", 0)); err != errSandboxBackoff {
+		t.Errorf("request in backoff: want %v, got %v", errSandboxBackoff, err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	leave, err = sb.enter(newSandboxTestContext("", 0))
+	if err != nil {
+		t.Fatalf("request after backoff: want admitted, got %v", err)
+	}
+	leave()
+
+	// NOTE: The successful request resets the backoff to the base one,
+	// while consecutive violations double it up to the max one.
+	sb.violate()
+	sb.violate()
+	sb.violate()
+	backoff := time.Until(sb.backoffUntil)
+	if backoff <= 50*time.Millisecond || backoff > 80*time.Millisecond {
+		t.Errorf("want backoff capped at 80ms, got %v", backoff)
+	}
+
+	status := sb.status()
+	if status.Violations != 4 || status.Rejections != 2 || status.BackoffUntil == "" {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
+
+func TestSandboxBufferedBodyQuota(t *testing.T) {
+	sb := newSandbox(&SandboxSpec{MaxBufferedBodyBytes: 8})
+
+	if _, err := sb.enter(newSandboxTestContext("0123456789", 10)); err != errSandboxBody {
+		t.Errorf("known length: want %v, got %v", errSandboxBody, err)
+	}
+	sb.succeed()
+	sb.backoffUntil = time.Time{}
+
+	ctx := newSandboxTestContext("0123456789", -1)
+	leave, err := sb.enter(ctx)
+	if err != nil {
+		t.Fatalf("unknown length: want admitted, got %v", err)
+	}
+	if _, err := ioutil.ReadAll(ctx.Request().Body()); err != errSandboxBody {
+		t.Errorf("unknown length: want %v on reading, got %v", errSandboxBody, err)
+	}
+	leave()
+
+	status := sb.status()
+	if status.BufferedBodyBytes != 0 || status.InFlight != 0 {
+		t.Errorf("want all released, got %+v", status)
+	}
+	if status.Violations != 2 {
+		t.Errorf("want 2 violations, got %d", status.Violations)
+	}
+}
@@ -31,6 +31,7 @@ type (
 		meta       *FilterMetaSpec
 		filterSpec interface{}
 		rootFilter Filter
+		pipeline   string
 	}
 
 	// FilterMetaSpec is metadata for all specs.
@@ -112,6 +113,12 @@ func (s *FilterSpec) FilterSpec() interface{} {
 	return s.filterSpec
 }
 
+// Pipeline returns the name of the pipeline running the filter,
+// it's empty if the filter is not run by a pipeline.
+func (s *FilterSpec) Pipeline() string {
+	return s.pipeline
+}
+
 // RootFilter returns the root filter of the filter spec.
 func (s *FilterSpec) RootFilter() Filter {
 	return s.rootFilter
@@ -0,0 +1,218 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxTrackedIPs = 65536
+
+	// connRateLimitSweepInterval bounds the sweeping frequency
+	// once the tracked IPs reach the max.
+	connRateLimitSweepInterval = time.Second
+)
+
+type (
+	// ConnectionRateLimitSpec limits the rate of new connections per
+	// source IP by the token bucket.
+	ConnectionRateLimitSpec struct {
+		RPS int `yaml:"rps" jsonschema:"required,minimum=1"`
+		// Burst is the bucket size, it's rps if zero.
+		Burst int `yaml:"burst" jsonschema:"omitempty,minimum=1"`
+		// MaxTrackedIPs caps the memory of buckets, the IPs beyond it
+		// are not limited. It's 65536 if zero.
+		MaxTrackedIPs int `yaml:"maxTrackedIPs" jsonschema:"omitempty,minimum=1"`
+	}
+
+	// ConnectionRateLimitStatus is the status of the connection rate limit.
+	ConnectionRateLimitStatus struct {
+		// LimitedIPs is the number of IPs being limited.
+		LimitedIPs int `yaml:"limitedIPs"`
+		// Dropped is the total number of dropped connections.
+		Dropped uint64 `yaml:"dropped"`
+	}
+
+	// connRateLimiter is disabled if rate is zero.
+	connRateLimiter struct {
+		mutex     sync.Mutex
+		spec      *ConnectionRateLimitSpec
+		rate      float64
+		burst     float64
+		maxIPs    int
+		buckets   map[string]*ipBucket
+		lastSweep time.Time
+		dropped   uint64
+	}
+
+	ipBucket struct {
+		tokens float64
+		last   time.Time
+		// limited reports whether the last connection was dropped.
+		limited bool
+	}
+
+	// connRateLimitListener closes the connections exceeding the rate
+	// with RST right after accepting them.
+	connRateLimitListener struct {
+		net.Listener
+		limiter *connRateLimiter
+	}
+)
+
+func newConnRateLimiter() *connRateLimiter {
+	return &connRateLimiter{buckets: make(map[string]*ipBucket)}
+}
+
+// setSpec updates the limit, the buckets are reset if it changes,
+// nil means disabled.
+func (l *connRateLimiter) setSpec(spec *ConnectionRateLimitSpec) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if spec != nil && l.spec != nil && *spec == *l.spec {
+		return
+	}
+
+	l.spec = spec
+	l.buckets = make(map[string]*ipBucket)
+	l.rate, l.burst, l.maxIPs = 0, 0, 0
+	if spec == nil {
+		return
+	}
+
+	l.rate = float64(spec.RPS)
+	l.burst = float64(spec.Burst)
+	if spec.Burst == 0 {
+		l.burst = l.rate
+	}
+	l.maxIPs = spec.MaxTrackedIPs
+	if l.maxIPs == 0 {
+		l.maxIPs = defaultMaxTrackedIPs
+	}
+}
+
+func (l *connRateLimiter) refill(b *ipBucket, now time.Time) float64 {
+	return math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+}
+
+// allow reports whether a new connection from the ip is permitted.
+func (l *connRateLimiter) allow(ip string, now time.Time) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.rate == 0 {
+		return true
+	}
+
+	b := l.buckets[ip]
+	if b == nil {
+		if len(l.buckets) >= l.maxIPs {
+			l.sweep(now)
+		}
+		// NOTE: Fail open rather than rejecting the IPs never seen.
+		if len(l.buckets) >= l.maxIPs {
+			return true
+		}
+		b = &ipBucket{tokens: l.burst, last: now}
+		l.buckets[ip] = b
+	}
+
+	b.tokens, b.last = l.refill(b, now), now
+	if b.tokens >= 1 {
+		b.tokens--
+		b.limited = false
+		return true
+	}
+
+	b.limited = true
+	l.dropped++
+	return false
+}
+
+// sweep removes the buckets which are full, they're the same as new ones.
+func (l *connRateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < connRateLimitSweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for ip, b := range l.buckets {
+		if l.refill(b, now) >= l.burst {
+			delete(l.buckets, ip)
+		}
+	}
+}
+
+func (l *connRateLimiter) status(now time.Time) *ConnectionRateLimitStatus {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.rate == 0 {
+		return nil
+	}
+
+	s := &ConnectionRateLimitStatus{Dropped: l.dropped}
+	for _, b := range l.buckets {
+		if b.limited && l.refill(b, now) < 1 {
+			s.LimitedIPs++
+		}
+	}
+
+	return s
+}
+
+func newConnRateLimitListener(listener net.Listener, limiter *connRateLimiter) net.Listener {
+	return &connRateLimitListener{
+		Listener: listener,
+		limiter:  limiter,
+	}
+}
+
+func remoteIP(conn net.Conn) string {
+	addr := conn.RemoteAddr().String()
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// Accept accepts the next connection within the rate.
+func (l *connRateLimitListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		if l.limiter.allow(remoteIP(conn), time.Now()) {
+			return conn, nil
+		}
+
+		// NOTE: Zero linger makes Close send RST instead of FIN.
+		if lc, ok := conn.(interface{ SetLinger(sec int) error }); ok {
+			lc.SetLinger(0)
+		}
+		conn.Close()
+	}
+}
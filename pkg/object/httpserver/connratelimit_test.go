@@ -0,0 +1,134 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestConnRateLimiter(t *testing.T) {
+	l := newConnRateLimiter()
+	now := time.Now()
+
+	if !l.allow("10.0.0.1", now) || l.status(now) != nil {
+		t.Fatalf("want disabled limiter allowing all")
+	}
+
+	l.setSpec(&ConnectionRateLimitSpec{RPS: 2, Burst: 3, MaxTrackedIPs: 2})
+	for i := 0; i < 3; i++ {
+		if !l.allow("10.0.0.1", now) {
+			t.Fatalf("connection %d: want allowed within burst", i)
+		}
+	}
+	if l.allow("10.0.0.1", now) {
+		t.Fatalf("want dropped over burst")
+	}
+	if !l.allow("10.0.0.2", now) {
+		t.Fatalf("want other ip allowed")
+	}
+
+	status := l.status(now)
+	if status.LimitedIPs != 1 || status.Dropped != 1 {
+		t.Fatalf("want 1 limited ip and 1 dropped, got %+v", status)
+	}
+
+	// NOTE: 2 rps refills one token in 500ms.
+	now = now.Add(500 * time.Millisecond)
+	if l.status(now).LimitedIPs != 0 {
+		t.Fatalf("want no limited ip after refilling")
+	}
+	if !l.allow("10.0.0.1", now) {
+		t.Fatalf("want allowed after refilling")
+	}
+
+	// NOTE: Fail open beyond the max tracked IPs.
+	if !l.allow("10.0.0.3", now) || len(l.buckets) != 2 {
+		t.Fatalf("want untracked ip allowed, got %d buckets", len(l.buckets))
+	}
+
+	// NOTE: The full buckets are swept for new IPs.
+	now = now.Add(10 * time.Second)
+	if !l.allow("10.0.0.3", now) || l.buckets["10.0.0.3"] == nil {
+		t.Fatalf("want new ip tracked after sweeping")
+	}
+
+	l.setSpec(nil)
+	if l.status(now) != nil || len(l.buckets) != 0 {
+		t.Fatalf("want limiter disabled")
+	}
+}
+
+func TestConnRateLimitListener(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	limiter := newConnRateLimiter()
+	limiter.setSpec(&ConnectionRateLimitSpec{RPS: 1, Burst: 1})
+	rl := newConnRateLimitListener(ln, limiter)
+	defer rl.Close()
+
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for {
+			conn, err := rl.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+
+	first, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer first.Close()
+	select {
+	case conn := <-accepted:
+		defer conn.Close()
+	case <-time.After(time.Second):
+		t.Fatalf("first connection not accepted")
+	}
+
+	second, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer second.Close()
+
+	second.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = second.Read(make([]byte, 1))
+	if err == nil {
+		t.Fatalf("want second connection closed")
+	}
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		t.Fatalf("want second connection closed, got timeout")
+	}
+
+	select {
+	case <-accepted:
+		t.Fatalf("want second connection not passed to the server")
+	default:
+	}
+	if got := limiter.status(time.Now()).Dropped; got != 1 {
+		t.Fatalf("want 1 dropped, got %d", got)
+	}
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"math"
+	"math/rand"
+	"net/http"
+	"sync/atomic"
+)
+
+// drainHandler refuses the new requests once the server starts draining,
+// so the requests arriving on a still-open keep-alive connection after
+// Close are not served while the in-flight ones finish.
+type drainHandler struct {
+	handler http.Handler
+
+	// draining is accessed atomically.
+	draining int32
+
+	// closeRatio is the bits of the share of the responses closing
+	// the connection, it's accessed atomically and nil means zero.
+	closeRatio *uint64
+}
+
+func newDrainHandler(handler http.Handler) *drainHandler {
+	return &drainHandler{handler: handler}
+}
+
+func (h *drainHandler) drain() {
+	atomic.StoreInt32(&h.draining, 1)
+}
+
+func (h *drainHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(&h.draining) == 1 {
+		// NOTE: net/http closes the connection after the response
+		// if the handler sets "Connection: close".
+		w.Header().Set("Connection", "close")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	if h.closeRatio != nil {
+		ratio := math.Float64frombits(atomic.LoadUint64(h.closeRatio))
+		if ratio > 0 && rand.Float64() < ratio {
+			w.Header().Set("Connection", "close")
+		}
+	}
+
+	h.handler.ServeHTTP(w, r)
+}
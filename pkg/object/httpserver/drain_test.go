@@ -0,0 +1,106 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"bufio"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDrainHandler(t *testing.T) {
+	h := newDrainHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(conn)
+
+	get := func() *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		err := req.Write(conn)
+		if err != nil {
+			t.Fatalf("write request failed: %v", err)
+		}
+		resp, err := http.ReadResponse(reader, req)
+		if err != nil {
+			t.Fatalf("read response failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	resp := get()
+	if resp.StatusCode != http.StatusOK || resp.Close {
+		t.Fatalf("want 200 on a kept-alive connection, got %d, close %v",
+			resp.StatusCode, resp.Close)
+	}
+
+	h.drain()
+
+	// NOTE: The second request reuses the same connection.
+	resp = get()
+	if resp.StatusCode != http.StatusServiceUnavailable || !resp.Close {
+		t.Fatalf("want 503 with connection close, got %d, close %v",
+			resp.StatusCode, resp.Close)
+	}
+
+	_, err = reader.ReadByte()
+	if err == nil {
+		t.Fatalf("want connection closed after draining")
+	}
+}
+
+func TestDrainHandlerCloseRatio(t *testing.T) {
+	h := newDrainHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	closeRatio := math.Float64bits(0)
+	h.closeRatio = &closeRatio
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	get := func() *http.Response {
+		resp, err := http.Get(server.URL)
+		if err != nil {
+			t.Fatalf("get failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	if resp := get(); resp.Close {
+		t.Fatalf("want connection kept alive with weight 1")
+	}
+
+	atomic.StoreUint64(&closeRatio, math.Float64bits(1))
+	if resp := get(); resp.StatusCode != http.StatusOK || !resp.Close {
+		t.Fatalf("want 200 with connection close with weight 0, got %d, close %v",
+			resp.StatusCode, resp.Close)
+	}
+}
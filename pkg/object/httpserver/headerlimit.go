@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/megaease/easegress/pkg/context"
+)
+
+// headerBytes estimates the size of the request line and headers
+// in the wire format of HTTP/1.1.
+func headerBytes(r *http.Request) int {
+	// NOTE: "METHOD URI PROTO\r\n" and "Host: host\r\n".
+	size := len(r.Method) + len(r.RequestURI) + len(r.Proto) + 4
+	if r.Host != "" {
+		size += len("Host: ") + len(r.Host) + 2
+	}
+
+	for name, values := range r.Header {
+		// NOTE: Host is counted above by r.Host.
+		if name == "Host" {
+			continue
+		}
+		for _, value := range values {
+			size += len(name) + len(": ") + len(value) + 2
+		}
+	}
+
+	return size
+}
+
+// headerCount returns the count of the header names, the Host set to
+// the header by context.New is excluded, since net/http removes it
+// from the header of the received request.
+func headerCount(r *http.Request) int {
+	count := len(r.Header)
+	if _, exists := r.Header["Host"]; exists {
+		count--
+	}
+
+	return count
+}
+
+// checkHeaderLimits responds with 431 and returns false if the request
+// exceeds the limits of headers.
+// NOTE: net/http reads up to MaxHeaderBytes plus 4096 bytes of slack,
+// the requests over it are rejected before reaching here, so it checks
+// the exact limit in the meantime.
+func (m *mux) checkHeaderLimits(spec *Spec, ctx context.HTTPContext) bool {
+	stdr := ctx.Request().Std()
+
+	var reason string
+	if count := headerCount(stdr); spec.MaxHeaderCount > 0 && count > spec.MaxHeaderCount {
+		reason = fmt.Sprintf("header count %d exceeds %d", count, spec.MaxHeaderCount)
+	} else if spec.MaxHeaderBytes > 0 {
+		if size := headerBytes(stdr); size > spec.MaxHeaderBytes {
+			reason = fmt.Sprintf("header size %dB exceeds %dB", size, spec.MaxHeaderBytes)
+		}
+	}
+
+	if reason == "" {
+		return true
+	}
+
+	atomic.AddUint64(&m.headerRejected, 1)
+	ctx.AddTag(reason)
+	ctx.Response().SetStatusCode(http.StatusRequestHeaderFieldsTooLarge)
+
+	return false
+}
+
+func (m *mux) headerRejectedCount() uint64 {
+	return atomic.LoadUint64(&m.headerRejected)
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/tracing"
+)
+
+func TestCheckHeaderLimits(t *testing.T) {
+	m := &mux{}
+
+	newCtx := func(headers int) context.HTTPContext {
+		r := httptest.NewRequest(http.MethodGet, "/pets", nil)
+		for i := 0; i < headers; i++ {
+			r.Header.Set("X-Test-"+strconv.Itoa(i), "value")
+		}
+		return context.New(httptest.NewRecorder(), r, tracing.NoopTracing, "test")
+	}
+
+	spec := &Spec{MaxHeaderCount: 3}
+	if !m.checkHeaderLimits(spec, newCtx(3)) {
+		t.Fatalf("want 3 headers passed")
+	}
+
+	ctx := newCtx(4)
+	if m.checkHeaderLimits(spec, ctx) {
+		t.Fatalf("want 4 headers rejected")
+	}
+	if code := ctx.Response().StatusCode(); code != http.StatusRequestHeaderFieldsTooLarge {
+		t.Fatalf("want %d, got %d", http.StatusRequestHeaderFieldsTooLarge, code)
+	}
+
+	// NOTE: The values of the same name count once.
+	ctx = newCtx(3)
+	ctx.Request().Std().Header.Add("X-Test-0", "another")
+	if !m.checkHeaderLimits(spec, ctx) {
+		t.Fatalf("want repeated header name counted once")
+	}
+
+	ctx = newCtx(0)
+	spec = &Spec{MaxHeaderBytes: headerBytes(ctx.Request().Std())}
+	if !m.checkHeaderLimits(spec, ctx) {
+		t.Fatalf("want the header of exact size passed")
+	}
+	ctx.Request().Std().Header.Set("Cookie", "a=b")
+	if m.checkHeaderLimits(spec, ctx) {
+		t.Fatalf("want the oversized header rejected")
+	}
+
+	if got := m.headerRejectedCount(); got != 2 {
+		t.Fatalf("want 2 rejected, got %d", got)
+	}
+}
+
+func TestHeaderBytes(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/a", nil)
+	r.Host = "h"
+	r.Header = http.Header{"K": {"v"}}
+	// "GET /a HTTP/1.1\r\n" + "Host: h\r\n" + "K: v\r\n"
+	if got, want := headerBytes(r), 17+9+6; got != want {
+		t.Fatalf("want %d, got %d", want, got)
+	}
+}
@@ -18,6 +18,8 @@
 package httpserver
 
 import (
+	"math"
+	"sync/atomic"
 	"time"
 
 	"github.com/megaease/easegress/pkg/logger"
@@ -123,6 +125,15 @@ func (hs *HTTPServer) Close() {
 	hs.runtime.Close()
 }
 
+// SetWeight sets the share of the responses keeping the connections
+// alive, the others close the connections, so the clients reconnect and
+// the load balancer in front moves them to the other instances gradually.
+// The weight is 1 by default, and 0 closes the connection after every
+// response.
+func (hs *HTTPServer) SetWeight(weight float64) {
+	atomic.StoreUint64(&hs.runtime.closeRatio, math.Float64bits(1-weight))
+}
+
 // InjectMuxMapper inject a new mux mapper to route, it will cover the default map of supervisor.
 func (hs *HTTPServer) InjectMuxMapper(mapper MuxMapper) {
 	hs.runtime.SetMuxMapper(mapper)
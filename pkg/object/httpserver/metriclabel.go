@@ -0,0 +1,144 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/util/httpstat"
+)
+
+// otherLabelValue is the label value of the values out of allowedValues.
+const otherLabelValue = "other"
+
+type (
+	// MetricLabelSpec labels the request metrics by the value of the
+	// header. The values out of AllowedValues, including the empty one,
+	// are labeled as other, so the cardinality of the label is bounded.
+	MetricLabelSpec struct {
+		Header        string   `yaml:"header" jsonschema:"required"`
+		Label         string   `yaml:"label" jsonschema:"required"`
+		AllowedValues []string `yaml:"allowedValues" jsonschema:"required,minItems=1,uniqueItems=true"`
+	}
+
+	// MetricLabelStatus is the request metrics keyed by label and value.
+	MetricLabelStatus map[string]map[string]*httpstat.Status
+
+	metricLabel struct {
+		spec    *MetricLabelSpec
+		allowed map[string]struct{}
+	}
+
+	// labelStats records the metrics of the labels, which are kept
+	// across reloading, like the metrics of the whole server.
+	labelStats struct {
+		mutex sync.Mutex
+		// stats is keyed by label and value.
+		stats map[string]map[string]*httpstat.HTTPStat
+	}
+)
+
+func validateMetricLabels(specs []*MetricLabelSpec) error {
+	labels := make(map[string]struct{})
+	for _, spec := range specs {
+		if _, exists := labels[spec.Label]; exists {
+			return fmt.Errorf("metric label %s is duplicated", spec.Label)
+		}
+		labels[spec.Label] = struct{}{}
+	}
+
+	return nil
+}
+
+func newMetricLabels(specs []*MetricLabelSpec) []*metricLabel {
+	labels := make([]*metricLabel, 0, len(specs))
+	for _, spec := range specs {
+		label := &metricLabel{spec: spec, allowed: make(map[string]struct{})}
+		for _, value := range spec.AllowedValues {
+			label.allowed[value] = struct{}{}
+		}
+		labels = append(labels, label)
+	}
+
+	return labels
+}
+
+func (l *metricLabel) value(ctx context.HTTPContext) string {
+	value := ctx.Request().Header().Get(l.spec.Header)
+	if _, exists := l.allowed[value]; exists {
+		return value
+	}
+	return otherLabelValue
+}
+
+func newLabelStats() *labelStats {
+	return &labelStats{
+		stats: make(map[string]map[string]*httpstat.HTTPStat),
+	}
+}
+
+func (ls *labelStats) stat(labels []*metricLabel, ctx context.HTTPContext) {
+	if len(labels) == 0 {
+		return
+	}
+
+	metric := ctx.StatMetric()
+	for _, label := range labels {
+		ls.getHTTPStat(label.spec.Label, label.value(ctx)).Stat(metric)
+	}
+}
+
+func (ls *labelStats) getHTTPStat(label, value string) *httpstat.HTTPStat {
+	ls.mutex.Lock()
+	defer ls.mutex.Unlock()
+
+	values, exists := ls.stats[label]
+	if !exists {
+		values = make(map[string]*httpstat.HTTPStat)
+		ls.stats[label] = values
+	}
+
+	httpStat, exists := values[value]
+	if !exists {
+		httpStat = httpstat.New()
+		values[value] = httpStat
+	}
+
+	return httpStat
+}
+
+func (ls *labelStats) status() MetricLabelStatus {
+	ls.mutex.Lock()
+	defer ls.mutex.Unlock()
+
+	if len(ls.stats) == 0 {
+		return nil
+	}
+
+	status := make(MetricLabelStatus, len(ls.stats))
+	for label, values := range ls.stats {
+		status[label] = make(map[string]*httpstat.Status, len(values))
+		for value, httpStat := range values {
+			status[label][value] = httpStat.Status()
+		}
+	}
+
+	return status
+}
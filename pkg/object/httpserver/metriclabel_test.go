@@ -0,0 +1,79 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/httpstat"
+	"github.com/megaease/easegress/pkg/util/topn"
+)
+
+func TestMetricLabels(t *testing.T) {
+	superSpec, err := supervisor.NewSpec(`
+name: server
+kind: HTTPServer
+port: 10080
+keepAlive: true
+https: false
+metricLabels:
+- header: X-Tenant
+  label: tenant
+  allowedValues: [megaease, easestack]
+`)
+	if err != nil {
+		t.Fatalf("new spec failed: %v", err)
+	}
+
+	m := newMux(httpstat.New(), topn.New(topNum), nil)
+	m.reloadRules(superSpec, nil)
+
+	for _, tenant := range []string{"megaease", "megaease", "easestack", "unknown", ""} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tenant != "" {
+			r.Header.Set("X-Tenant", tenant)
+		}
+		m.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	status := m.labelStats.status()["tenant"]
+	for value, want := range map[string]uint64{"megaease": 2, "easestack": 1, "other": 2} {
+		if got := status[value]; got == nil || got.Count != want {
+			t.Errorf("tenant %s: want count %d, got %+v", value, want, got)
+		}
+	}
+	if _, exists := status["unknown"]; exists {
+		t.Errorf("want unknown tenant labeled as other")
+	}
+}
+
+func TestValidateMetricLabels(t *testing.T) {
+	specs := []*MetricLabelSpec{
+		{Header: "X-Tenant", Label: "tenant", AllowedValues: []string{"a"}},
+		{Header: "X-Org", Label: "tenant", AllowedValues: []string{"b"}},
+	}
+	if err := validateMetricLabels(specs); err == nil {
+		t.Errorf("want error for duplicated labels")
+	}
+	if err := validateMetricLabels(specs[:1]); err != nil {
+		t.Errorf("want valid labels, got %v", err)
+	}
+}
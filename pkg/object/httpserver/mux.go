@@ -34,6 +34,8 @@ import (
 	"github.com/megaease/easegress/pkg/util/ipfilter"
 	"github.com/megaease/easegress/pkg/util/stringtool"
 	"github.com/megaease/easegress/pkg/util/topn"
+
+	opentracingext "github.com/opentracing/opentracing-go/ext"
 )
 
 type (
@@ -44,6 +46,11 @@ type (
 		rules       atomic.Value // *muxRules
 		muxMapper   MuxMapper    // MuxMapper
 		mapperMutex sync.RWMutex
+
+		// headerRejected is accessed atomically.
+		headerRejected uint64
+
+		labelStats *labelStats
 	}
 
 	muxRules struct {
@@ -56,6 +63,7 @@ type (
 		tracer       *tracing.Tracing
 		ipFilter     *ipfilter.IPFilter
 		ipFilterChan *ipfilter.IPFilters
+		metricLabels []*metricLabel
 
 		rules []*muxRule
 	}
@@ -278,8 +286,9 @@ func (mp *muxPath) matchHeaders(ctx context.HTTPContext) (ci *cacheItem, ok bool
 
 func newMux(httpStat *httpstat.HTTPStat, topN *topn.TopN, mapper MuxMapper) *mux {
 	m := &mux{
-		httpStat: httpStat,
-		topN:     topN,
+		httpStat:   httpStat,
+		topN:       topN,
+		labelStats: newLabelStats(),
 	}
 
 	m.rules.Store(&muxRules{spec: &Spec{}, tracer: tracing.NoopTracing})
@@ -324,6 +333,7 @@ func (m *mux) reloadRules(superSpec *supervisor.Spec, super *supervisor.Supervis
 		spec:         spec,
 		ipFilter:     newIPFilter(spec.IPFilter),
 		ipFilterChan: newIPFilterChain(nil, spec.IPFilter),
+		metricLabels: newMetricLabels(spec.MetricLabels),
 		rules:        make([]*muxRule, len(spec.Rules)),
 		tracer:       tracer,
 	}
@@ -354,17 +364,34 @@ func (m *mux) reloadRules(superSpec *supervisor.Spec, super *supervisor.Supervis
 	m.rules.Store(rules)
 }
 
+// setSpanTags tags the span of the request by the conventions of OpenTracing.
+func setSpanTags(ctx context.HTTPContext) {
+	span, code := ctx.Span(), ctx.Response().StatusCode()
+	span.SetTag(string(opentracingext.HTTPMethod), ctx.Request().Method())
+	span.SetTag(string(opentracingext.HTTPUrl), ctx.Request().Path())
+	span.SetTag(string(opentracingext.HTTPStatusCode), code)
+	if code >= 500 {
+		span.SetTag(string(opentracingext.Error), true)
+	}
+}
+
 func (m *mux) ServeHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 	rules := m.rules.Load().(*muxRules)
 
 	ctx := context.New(stdw, stdr, rules.tracer, rules.superSpec.Name())
 	defer ctx.Finish()
 	ctx.OnFinish(func() {
+		setSpanTags(ctx)
 		ctx.Span().Finish()
 		m.httpStat.Stat(ctx.StatMetric())
 		m.topN.Stat(ctx)
+		m.labelStats.stat(rules.metricLabels, ctx)
 	})
 
+	if !m.checkHeaderLimits(rules.spec, ctx) {
+		return
+	}
+
 	ci := rules.getCacheItem(ctx)
 	if ci != nil {
 		m.handleRequestWithCache(rules, ctx, ci)
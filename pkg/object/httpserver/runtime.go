@@ -19,6 +19,7 @@ package httpserver
 
 import (
 	"fmt"
+	"net"
 	"net/http"
 	"reflect"
 	"sync/atomic"
@@ -73,6 +74,7 @@ type (
 		server    *http.Server
 		server3   *http3.Server
 		mux       *mux
+		drainer   *drainHandler
 		startNum  uint64
 		eventChan chan interface{}
 
@@ -83,6 +85,13 @@ type (
 		httpStat      *httpstat.HTTPStat
 		topN          *topn.TopN
 		limitListener *LimitListener
+
+		// connRateLimiter outlives the servers, so the limit
+		// is kept across restarts.
+		connRateLimiter *connRateLimiter
+
+		// closeRatio outlives the servers too, see SetWeight.
+		closeRatio uint64
 	}
 
 	// Status contains all status gernerated by runtime, for displaying to users.
@@ -94,6 +103,15 @@ type (
 
 		*httpstat.Status
 		TopN *topn.Status `yaml:"topN"`
+
+		MetricLabels MetricLabelStatus `yaml:"metricLabels,omitempty"`
+
+		// HeaderRejected counts the requests rejected with 431 for
+		// exceeding maxHeaderBytes or maxHeaderCount, which are also
+		// counted in the 4xx above.
+		HeaderRejected uint64 `yaml:"headerRejected"`
+
+		ConnectionRateLimit *ConnectionRateLimitStatus `yaml:"connectionRateLimit,omitempty"`
 	}
 )
 
@@ -103,6 +121,8 @@ func newRuntime(super *supervisor.Supervisor) *runtime {
 		eventChan: make(chan interface{}, 10),
 		httpStat:  httpstat.New(),
 		topN:      topn.New(topNum),
+
+		connRateLimiter: newConnRateLimiter(),
 	}
 
 	// default mapper is the supervisor warpper
@@ -136,6 +156,12 @@ func (r *runtime) Status() *Status {
 		Error:  r.getError().Error(),
 		Status: r.httpStat.Status(),
 		TopN:   r.topN.Status(),
+
+		MetricLabels: r.mux.labelStats.status(),
+
+		HeaderRejected: r.mux.headerRejectedCount(),
+
+		ConnectionRateLimit: r.connRateLimiter.status(time.Now()),
 	}
 }
 
@@ -181,6 +207,9 @@ func (r *runtime) reload(nextSuperSpec *supervisor.Spec, super *supervisor.Super
 	if nextSpec != nil && r.limitListener != nil {
 		r.limitListener.SetMaxConnection(nextSpec.MaxConnections)
 	}
+	if nextSpec != nil {
+		r.connRateLimiter.setSpec(nextSpec.ConnectionRateLimit)
+	}
 
 	// NOTE: Due to the mechanism of supervisor,
 	// nextSpec must not be nil, just defensive programming here.
@@ -239,6 +268,8 @@ func (r *runtime) needRestartServer(nextSpec *Spec) bool {
 	x.MaxConnections, y.MaxConnections = 0, 0
 	x.CacheSize, y.CacheSize = 0, 0
 	x.XForwardedFor, y.XForwardedFor = false, false
+	x.MaxHeaderCount, y.MaxHeaderCount = 0, 0
+	x.ConnectionRateLimit, y.ConnectionRateLimit = nil, nil
 	x.Tracing, y.Tracing = nil, nil
 	x.IPFilter, y.IPFilter = nil, nil
 	x.Rules, y.Rules = nil, nil
@@ -259,10 +290,14 @@ func (r *runtime) startServer() {
 		}
 	}
 
+	r.drainer = newDrainHandler(r.mux)
+	r.drainer.closeRatio = &r.closeRatio
 	srv := &http.Server{
 		Addr:        fmt.Sprintf(":%d", r.spec.Port),
-		Handler:     r.mux,
+		Handler:     r.drainer,
 		IdleTimeout: keepAliveTimeout,
+		// NOTE: Zero means http.DefaultMaxHeaderBytes.
+		MaxHeaderBytes: r.spec.MaxHeaderBytes,
 	}
 	srv.SetKeepAlivesEnabled(r.spec.KeepAlive)
 
@@ -290,10 +325,45 @@ func (r *runtime) startServer() {
 			return
 		}
 
+		listener = newConnRateLimitListener(listener, r.connRateLimiter)
 		limitListener := NewLimitListener(listener, r.spec.MaxConnections)
 		r.limitListener = limitListener
-		go r.runHTTP1And2Server(limitListener, r.spec.HTTPS, r.startNum)
+		serveListener, serveTLS := r.newServeListener(limitListener)
+		go r.runHTTP1And2Server(serveListener, serveTLS, r.startNum)
+	}
+}
+
+// newServeListener wraps the listener with the TLS handshake limit if needed,
+// the bool reports whether it needs to be served by http.Server.ServeTLS.
+func (r *runtime) newServeListener(limitListener *LimitListener) (net.Listener, bool) {
+	if !r.spec.HTTPS {
+		return limitListener, false
+	}
+
+	if r.spec.MaxTLSHandshakes == 0 {
+		return limitListener, true
+	}
+
+	var queueTimeout time.Duration
+	if r.spec.TLSHandshakeQueueTimeout != "" {
+		t, err := time.ParseDuration(r.spec.TLSHandshakeQueueTimeout)
+		if err != nil {
+			logger.Errorf("BUG: parse duration %s failed: %v",
+				r.spec.TLSHandshakeQueueTimeout, err)
+		} else {
+			queueTimeout = t
+		}
 	}
+
+	// NOTE: The listener does handshakes on its own, so the server
+	// serves it as plain, and the TLS config of the server is only
+	// for setting up HTTP/2.
+	tlsConfig := r.server.TLSConfig.Clone()
+	tlsConfig.NextProtos = []string{"h2", "http/1.1"}
+	r.server.TLSConfig.NextProtos = tlsConfig.NextProtos
+
+	return newTLSHandshakeListener(limitListener, tlsConfig,
+		r.spec.MaxTLSHandshakes, queueTimeout), false
 }
 
 func (r *runtime) runHTTP3Server(startNum uint64) {
@@ -306,12 +376,12 @@ func (r *runtime) runHTTP3Server(startNum uint64) {
 	}
 }
 
-func (r *runtime) runHTTP1And2Server(limitListener *LimitListener, https bool, startNum uint64) {
+func (r *runtime) runHTTP1And2Server(listener net.Listener, serveTLS bool, startNum uint64) {
 	var err error
-	if https {
-		err = r.server.ServeTLS(limitListener, "", "")
+	if serveTLS {
+		err = r.server.ServeTLS(listener, "", "")
 	} else {
-		err = r.server.Serve(limitListener)
+		err = r.server.Serve(listener)
 	}
 	if err != http.ErrServerClosed {
 		r.eventChan <- &eventServeFailed{
@@ -326,6 +396,8 @@ func (r *runtime) closeServer() {
 		return
 	}
 
+	r.drainer.drain()
+
 	if r.server3 != nil {
 		err := r.server3.Close()
 		if err != nil {
@@ -42,6 +42,28 @@ type (
 		XForwardedFor    bool          `yaml:"xForwardedFor" jsonschema:"omitempty"`
 		Tracing          *tracing.Spec `yaml:"tracing" jsonschema:"omitempty"`
 
+		// MaxTLSHandshakes limits the concurrent TLS handshakes in progress,
+		// the excess ones are queued for at most TLSHandshakeQueueTimeout.
+		MaxTLSHandshakes         uint32 `yaml:"maxTLSHandshakes" jsonschema:"omitempty,minimum=1"`
+		TLSHandshakeQueueTimeout string `yaml:"tlsHandshakeQueueTimeout" jsonschema:"omitempty,format=duration"`
+
+		// MaxHeaderBytes is http.Server.MaxHeaderBytes, zero means its
+		// default 1MB. net/http rejects the requests over it plus 4KB of
+		// slack with 431 before they reach the mux, so only the ones within
+		// the slack are rejected and counted in headerRejected of status.
+		// MaxHeaderCount limits the distinct header names, zero means
+		// unlimited, the requests exceeding it get 431 too.
+		MaxHeaderBytes int `yaml:"maxHeaderBytes" jsonschema:"omitempty,minimum=1"`
+		MaxHeaderCount int `yaml:"maxHeaderCount" jsonschema:"omitempty,minimum=1"`
+
+		// ConnectionRateLimit limits the rate of new connections per
+		// source IP, it's not supported when http3 enabled.
+		ConnectionRateLimit *ConnectionRateLimitSpec `yaml:"connectionRateLimit,omitempty" jsonschema:"omitempty"`
+
+		// MetricLabels labels the request metrics by the headers,
+		// the metrics of each label are in metricLabels of status.
+		MetricLabels []*MetricLabelSpec `yaml:"metricLabels,omitempty" jsonschema:"omitempty"`
+
 		IPFilter *ipfilter.Spec `yaml:"ipFilter,omitempty" jsonschema:"omitempty"`
 		Rules    []Rule         `yaml:"rules" jsonschema:"omitempty"`
 	}
@@ -105,6 +127,24 @@ func (spec *Spec) Validate() error {
 		}
 	}
 
+	if spec.ConnectionRateLimit != nil && spec.HTTP3 {
+		return fmt.Errorf("connectionRateLimit is not supported when http3 enabled")
+	}
+
+	err := validateMetricLabels(spec.MetricLabels)
+	if err != nil {
+		return err
+	}
+
+	if spec.MaxTLSHandshakes > 0 {
+		if !spec.HTTPS {
+			return fmt.Errorf("https is disabled when maxTLSHandshakes set")
+		}
+		if spec.HTTP3 {
+			return fmt.Errorf("maxTLSHandshakes is not supported when http3 enabled")
+		}
+	}
+
 	return nil
 }
 
@@ -0,0 +1,165 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package httpserver
+
+import (
+	"crypto/tls"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const (
+	defaultTLSHandshakeTimeout = 10 * time.Second
+)
+
+type (
+	// tlsHandshakeListener is the Listener doing TLS handshakes in background,
+	// at most cap(slots) of them are in progress at the same time.
+	// The excess ones are queued, and rejected if they wait longer
+	// than queueTimeout, zero queueTimeout means waiting until a slot is free.
+	tlsHandshakeListener struct {
+		net.Listener
+		config           *tls.Config
+		slots            chan struct{}
+		queueTimeout     time.Duration
+		handshakeTimeout time.Duration
+
+		accepted  chan *acceptResult
+		closeOnce sync.Once
+		done      chan struct{}
+	}
+
+	acceptResult struct {
+		conn net.Conn
+		err  error
+	}
+)
+
+// newTLSHandshakeListener returns a Listener that returns *tls.Conn
+// finishing handshakes, so it must be served by http.Server.Serve.
+// The config must not be modified after, since handshakes start at once.
+func newTLSHandshakeListener(l net.Listener, config *tls.Config,
+	maxHandshakes uint32, queueTimeout time.Duration) *tlsHandshakeListener {
+
+	hl := &tlsHandshakeListener{
+		Listener:         l,
+		config:           config,
+		slots:            make(chan struct{}, maxHandshakes),
+		queueTimeout:     queueTimeout,
+		handshakeTimeout: defaultTLSHandshakeTimeout,
+		accepted:         make(chan *acceptResult),
+		done:             make(chan struct{}),
+	}
+
+	go hl.acceptLoop()
+
+	return hl
+}
+
+func (hl *tlsHandshakeListener) acceptLoop() {
+	for {
+		conn, err := hl.Listener.Accept()
+		if err != nil {
+			// NOTE: The backoff of temporary errors is up to the caller.
+			if !hl.deliver(&acceptResult{err: err}) {
+				return
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return
+		}
+
+		go hl.handshake(conn)
+	}
+}
+
+func (hl *tlsHandshakeListener) deliver(result *acceptResult) bool {
+	select {
+	case hl.accepted <- result:
+		return true
+	case <-hl.done:
+		return false
+	}
+}
+
+func (hl *tlsHandshakeListener) acquire() bool {
+	var timeout <-chan time.Time
+	if hl.queueTimeout > 0 {
+		timer := time.NewTimer(hl.queueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case hl.slots <- struct{}{}:
+		return true
+	case <-timeout:
+		return false
+	case <-hl.done:
+		return false
+	}
+}
+
+func (hl *tlsHandshakeListener) release() {
+	<-hl.slots
+}
+
+func (hl *tlsHandshakeListener) handshake(conn net.Conn) {
+	if !hl.acquire() {
+		logger.Debugf("reject tls handshake from %s: too many handshakes in progress",
+			conn.RemoteAddr())
+		conn.Close()
+		return
+	}
+
+	tlsConn := tls.Server(conn, hl.config)
+	tlsConn.SetDeadline(time.Now().Add(hl.handshakeTimeout))
+	err := tlsConn.Handshake()
+	hl.release()
+	if err != nil {
+		logger.Debugf("tls handshake from %s failed: %v", conn.RemoteAddr(), err)
+		tlsConn.Close()
+		return
+	}
+	tlsConn.SetDeadline(time.Time{})
+
+	if !hl.deliver(&acceptResult{conn: tlsConn}) {
+		tlsConn.Close()
+	}
+}
+
+// Accept returns the next connection which finished the handshake.
+func (hl *tlsHandshakeListener) Accept() (net.Conn, error) {
+	select {
+	case result := <-hl.accepted:
+		return result.conn, result.err
+	case <-hl.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close closes the listener, the connections still in handshake
+// are closed once they finish.
+func (hl *tlsHandshakeListener) Close() error {
+	err := hl.Listener.Close()
+	hl.closeOnce.Do(func() { close(hl.done) })
+	return err
+}
@@ -0,0 +1,209 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package httpserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
+)
+
+func TestMain(m *testing.M) {
+	tempDir, err := ioutil.TempDir("", "eg-httpserver-test")
+	if err != nil {
+		panic(err)
+	}
+	absLogDir := filepath.Join(tempDir, "log")
+	os.MkdirAll(absLogDir, 0755)
+	logger.Init(&option.Options{
+		Name:      "httpserver-for-log",
+		AbsLogDir: absLogDir,
+	})
+
+	code := m.Run()
+
+	logger.Sync()
+	os.RemoveAll(tempDir)
+
+	os.Exit(code)
+}
+
+func newTestCertificate(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key failed: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate failed: %v", err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestTLSHandshakeLimit(t *testing.T) {
+	const maxHandshakes, clients = 3, 30
+
+	cert := newTestCertificate(t)
+
+	var inProgress, maxInProgress int32
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		// NOTE: It's called in the middle of the handshake,
+		// slow it down to make the handshakes overlap.
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			n := atomic.AddInt32(&inProgress, 1)
+			defer atomic.AddInt32(&inProgress, -1)
+			for {
+				max := atomic.LoadInt32(&maxInProgress)
+				if n <= max || atomic.CompareAndSwapInt32(&maxInProgress, max, n) {
+					break
+				}
+			}
+			time.Sleep(50 * time.Millisecond)
+			return nil, nil
+		},
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	hl := newTLSHandshakeListener(ln, config, maxHandshakes, 0)
+	defer hl.Close()
+
+	go func() {
+		for {
+			conn, err := hl.Accept()
+			if err != nil {
+				return
+			}
+			if _, ok := conn.(*tls.Conn); !ok {
+				t.Errorf("want *tls.Conn, got %T", conn)
+			}
+			conn.Close()
+		}
+	}()
+
+	var wg sync.WaitGroup
+	var failed int32
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+			if err != nil {
+				atomic.AddInt32(&failed, 1)
+				return
+			}
+			conn.Close()
+		}()
+	}
+	wg.Wait()
+
+	if failed != 0 {
+		t.Errorf("want all handshakes queued and succeeded, %d failed", failed)
+	}
+	if maxInProgress > maxHandshakes {
+		t.Errorf("want at most %d handshakes in progress, got %d", maxHandshakes, maxInProgress)
+	}
+	if maxInProgress < maxHandshakes {
+		t.Errorf("want handshakes overlapped up to %d, got %d", maxHandshakes, maxInProgress)
+	}
+}
+
+func TestTLSHandshakeQueueTimeout(t *testing.T) {
+	cert := newTestCertificate(t)
+
+	release := make(chan struct{})
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			<-release
+			return nil, nil
+		},
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	hl := newTLSHandshakeListener(ln, config, 1, 50*time.Millisecond)
+	defer hl.Close()
+
+	go func() {
+		for {
+			conn, err := hl.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	dial := func(result chan error) {
+		conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+		if err == nil {
+			conn.Close()
+		}
+		result <- err
+	}
+
+	// NOTE: The first one holds the only slot until released.
+	first := make(chan error, 1)
+	go dial(first)
+	time.Sleep(20 * time.Millisecond)
+
+	second := make(chan error, 1)
+	go dial(second)
+	select {
+	case err := <-second:
+		if err == nil {
+			t.Errorf("want the queued handshake rejected, got succeeded")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("queued handshake not rejected")
+	}
+
+	close(release)
+	if err := <-first; err != nil {
+		t.Errorf("want the first handshake succeeded, got %v", err)
+	}
+}
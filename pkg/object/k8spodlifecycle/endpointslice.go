@@ -0,0 +1,137 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package k8spodlifecycle
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/megaease/easegress/pkg/util/k8sclient"
+)
+
+const (
+	serviceNameLabel = "kubernetes.io/service-name"
+
+	apiTimeout = 10 * time.Second
+)
+
+type (
+	// endpointSliceClient marks the endpoints of the pod terminating
+	// through the EndpointSlice API of the Kubernetes API server.
+	endpointSliceClient struct {
+		spec   *Spec
+		client *k8sclient.Client
+	}
+
+	endpointSliceList struct {
+		Items []*endpointSlice `json:"items"`
+	}
+
+	endpointSlice struct {
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+		Endpoints []*endpoint `json:"endpoints"`
+	}
+
+	endpoint struct {
+		TargetRef *struct {
+			Kind string `json:"kind"`
+			Name string `json:"name"`
+		} `json:"targetRef"`
+	}
+
+	jsonPatch struct {
+		Op    string      `json:"op"`
+		Path  string      `json:"path"`
+		Value interface{} `json:"value"`
+	}
+
+	endpointConditions struct {
+		Ready       bool `json:"ready"`
+		Serving     bool `json:"serving"`
+		Terminating bool `json:"terminating"`
+	}
+)
+
+func newEndpointSliceClient(spec *Spec) (*endpointSliceClient, error) {
+	client, err := k8sclient.New(&spec.Spec, apiTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return &endpointSliceClient{spec: spec, client: client}, nil
+}
+
+func (c *endpointSliceClient) slicesPath() string {
+	return fmt.Sprintf("/apis/discovery.k8s.io/v1/namespaces/%s/endpointslices", c.spec.Namespace)
+}
+
+// markTerminating marks the endpoints of the pod in the EndpointSlices of
+// the service not ready and terminating, it returns the names of the
+// patched slices. There are several of them for the dual-stack services.
+func (c *endpointSliceClient) markTerminating(ctx context.Context) ([]string, error) {
+	query := url.Values{"labelSelector": {serviceNameLabel + "=" + c.spec.ServiceName}}
+	body, err := c.client.Do(ctx, http.MethodGet, c.slicesPath()+"?"+query.Encode(), "", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &endpointSliceList{}
+	err = json.Unmarshal(body, list)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal endpoint slices failed: %v", err)
+	}
+
+	patched := []string{}
+	for _, slice := range list.Items {
+		for i, ep := range slice.Endpoints {
+			if ep.TargetRef == nil || ep.TargetRef.Kind != "Pod" || ep.TargetRef.Name != c.spec.PodName {
+				continue
+			}
+
+			// NOTE: The test fails the patch if the endpoints
+			// have been changed since listed.
+			patch, _ := json.Marshal([]*jsonPatch{
+				{Op: "test", Path: fmt.Sprintf("/endpoints/%d/targetRef/name", i), Value: c.spec.PodName},
+				{Op: "replace", Path: fmt.Sprintf("/endpoints/%d/conditions", i), Value: &endpointConditions{
+					Ready:       false,
+					Serving:     true,
+					Terminating: true,
+				}},
+			})
+			_, err := c.client.Do(ctx, http.MethodPatch, c.slicesPath()+"/"+slice.Metadata.Name,
+				"application/json-patch+json", patch)
+			if err != nil {
+				return patched, err
+			}
+			patched = append(patched, slice.Metadata.Name)
+		}
+	}
+
+	if len(patched) == 0 {
+		return nil, fmt.Errorf("pod %s not found in endpoint slices of service %s",
+			c.spec.PodName, c.spec.ServiceName)
+	}
+
+	return patched, nil
+}
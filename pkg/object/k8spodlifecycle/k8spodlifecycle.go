@@ -0,0 +1,290 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package k8spodlifecycle drains the traffic of the Easegress pod
+// in Kubernetes before it's terminated.
+package k8spodlifecycle
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/k8sclient"
+)
+
+const (
+	// Category is the category of KubernetesPodLifecycle.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of KubernetesPodLifecycle.
+	Kind = "KubernetesPodLifecycle"
+
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+	// drainSteps is the number of steps lowering the weight to zero.
+	drainSteps = 10
+
+	stateRunning  = "running"
+	stateDraining = "draining"
+	stateDrained  = "drained"
+)
+
+func init() {
+	supervisor.Register(&KubernetesPodLifecycle{})
+}
+
+type (
+	// KubernetesPodLifecycle drains the traffic once Easegress receives
+	// SIGTERM. It marks the endpoints of the pod terminating in the
+	// EndpointSlices of the service, so the other load balancers stop
+	// picking it, and lowers the weight of the HTTP servers to zero
+	// within DrainInterval, so the clients on the kept-alive connections
+	// reconnect to the other pods. The servers are closed after that.
+	KubernetesPodLifecycle struct {
+		super     *supervisor.Supervisor
+		superSpec *supervisor.Spec
+		spec      *Spec
+
+		client *endpointSliceClient
+
+		statusMutex sync.Mutex
+		status      *Status
+
+		// setWeight sets the weight of all HTTP servers,
+		// it's setServersWeight if nil.
+		setWeight func(weight float64)
+
+		ctx    context.Context
+		cancel context.CancelFunc
+	}
+
+	// Spec describes KubernetesPodLifecycle.
+	Spec struct {
+		// ServiceName is the service whose EndpointSlices contain the pod.
+		ServiceName string `yaml:"serviceName" jsonschema:"required"`
+		// Namespace is the namespace of the service account if empty.
+		Namespace string `yaml:"namespace" jsonschema:"omitempty"`
+		// PodName is the hostname if empty, which is the pod name
+		// unless the hostname of the pod is set.
+		PodName string `yaml:"podName" jsonschema:"omitempty"`
+
+		k8sclient.Spec `yaml:",inline"`
+
+		// DrainInterval is the time to lower the weight to zero, it
+		// should be less than terminationGracePeriodSeconds of the pod.
+		DrainInterval string `yaml:"drainInterval" jsonschema:"required,format=duration"`
+	}
+
+	// Status is the status of KubernetesPodLifecycle.
+	Status struct {
+		State   string  `yaml:"state"`
+		PodName string  `yaml:"podName"`
+		Weight  float64 `yaml:"weight"`
+		// TerminatingSlices are the EndpointSlices marking the pod terminating.
+		TerminatingSlices []string `yaml:"terminatingSlices,omitempty"`
+		Error             string   `yaml:"error,omitempty"`
+	}
+
+	// weightSetter is implemented by HTTPServer.
+	weightSetter interface {
+		SetWeight(weight float64)
+	}
+)
+
+// Validate validates Spec.
+func (s Spec) Validate() error {
+	interval, err := time.ParseDuration(s.DrainInterval)
+	if err != nil || interval <= 0 {
+		return fmt.Errorf("invalid drainInterval %s", s.DrainInterval)
+	}
+
+	return nil
+}
+
+// Category returns the category of KubernetesPodLifecycle.
+func (pl *KubernetesPodLifecycle) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of KubernetesPodLifecycle.
+func (pl *KubernetesPodLifecycle) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of KubernetesPodLifecycle.
+func (pl *KubernetesPodLifecycle) DefaultSpec() interface{} {
+	return &Spec{
+		Spec: k8sclient.Spec{
+			APIServer: "https://kubernetes.default.svc",
+			TokenFile: filepath.Join(serviceAccountDir, "token"),
+			CAFile:    filepath.Join(serviceAccountDir, "ca.crt"),
+		},
+		DrainInterval: "20s",
+	}
+}
+
+// Init initializes KubernetesPodLifecycle.
+func (pl *KubernetesPodLifecycle) Init(superSpec *supervisor.Spec, super *supervisor.Supervisor) {
+	pl.superSpec, pl.super = superSpec, super
+
+	// NOTE: The spec is shared by all members, so the pod
+	// is resolved by each member on its own.
+	spec := *superSpec.ObjectSpec().(*Spec)
+	pl.spec = &spec
+	pl.reload()
+}
+
+// Inherit inherits previous generation of KubernetesPodLifecycle.
+func (pl *KubernetesPodLifecycle) Inherit(superSpec *supervisor.Spec,
+	previousGeneration supervisor.Object, super *supervisor.Supervisor) {
+
+	previousGeneration.Close()
+	pl.Init(superSpec, super)
+}
+
+func (pl *KubernetesPodLifecycle) reload() {
+	pl.status = &Status{State: stateRunning, Weight: 1}
+	pl.ctx, pl.cancel = context.WithCancel(context.Background())
+
+	err := pl.resolvePod()
+	if err == nil {
+		pl.status.PodName = pl.spec.PodName
+		pl.client, err = newEndpointSliceClient(pl.spec)
+	}
+	if err != nil {
+		logger.Errorf("%s: %v", pl.superSpec.Name(), err)
+		pl.status.Error = err.Error()
+	}
+}
+
+func (pl *KubernetesPodLifecycle) resolvePod() error {
+	if pl.spec.Namespace == "" {
+		path := filepath.Join(serviceAccountDir, "namespace")
+		namespace, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("read namespace from %s failed: %v", path, err)
+		}
+		pl.spec.Namespace = strings.TrimSpace(string(namespace))
+	}
+
+	if pl.spec.PodName == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("get hostname failed: %v", err)
+		}
+		pl.spec.PodName = hostname
+	}
+
+	return nil
+}
+
+// Drain marks the pod terminating, and lowers the weight of
+// the HTTP servers to zero within DrainInterval.
+func (pl *KubernetesPodLifecycle) Drain() {
+	pl.updateStatus(func(s *Status) { s.State = stateDraining })
+	logger.Infof("%s: draining pod %s", pl.superSpec.Name(), pl.spec.PodName)
+
+	// NOTE: Keep lowering the weight even if it failed to mark the pod,
+	// the clients reconnecting to it are fewer after all.
+	if pl.client != nil {
+		ctx, cancel := context.WithTimeout(pl.ctx, apiTimeout)
+		slices, err := pl.client.markTerminating(ctx)
+		cancel()
+		if err != nil {
+			logger.Errorf("%s: mark pod %s terminating failed: %v",
+				pl.superSpec.Name(), pl.spec.PodName, err)
+		}
+		pl.updateStatus(func(s *Status) {
+			s.TerminatingSlices = slices
+			if err != nil {
+				s.Error = err.Error()
+			}
+		})
+	}
+
+	// NOTE: The spec has been validated.
+	interval, _ := time.ParseDuration(pl.spec.DrainInterval)
+	ticker := time.NewTicker(interval / drainSteps)
+	defer ticker.Stop()
+
+	for step := 1; step <= drainSteps; step++ {
+		select {
+		case <-pl.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		weight := 1 - float64(step)/drainSteps
+		pl.setWeightFunc()(weight)
+		pl.updateStatus(func(s *Status) { s.Weight = weight })
+	}
+
+	pl.updateStatus(func(s *Status) { s.State = stateDrained })
+	logger.Infof("%s: drained pod %s", pl.superSpec.Name(), pl.spec.PodName)
+}
+
+func (pl *KubernetesPodLifecycle) setWeightFunc() func(weight float64) {
+	if pl.setWeight != nil {
+		return pl.setWeight
+	}
+	return pl.setServersWeight
+}
+
+func (pl *KubernetesPodLifecycle) setServersWeight(weight float64) {
+	pl.super.WalkRunningObjects(func(ro *supervisor.RunningObject) bool {
+		if setter, ok := ro.Instance().(weightSetter); ok {
+			setter.SetWeight(weight)
+		}
+		return true
+	}, supervisor.CategoryTrafficGate)
+}
+
+func (pl *KubernetesPodLifecycle) updateStatus(fn func(s *Status)) {
+	pl.statusMutex.Lock()
+	defer pl.statusMutex.Unlock()
+
+	status := *pl.status
+	fn(&status)
+	pl.status = &status
+}
+
+func (pl *KubernetesPodLifecycle) getStatus() *Status {
+	pl.statusMutex.Lock()
+	defer pl.statusMutex.Unlock()
+
+	return pl.status
+}
+
+// Status returns the status of KubernetesPodLifecycle.
+func (pl *KubernetesPodLifecycle) Status() *supervisor.Status {
+	return &supervisor.Status{
+		ObjectStatus: pl.getStatus(),
+	}
+}
+
+// Close closes KubernetesPodLifecycle.
+func (pl *KubernetesPodLifecycle) Close() {
+	pl.cancel()
+}
@@ -0,0 +1,162 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package k8spodlifecycle
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+func TestMain(m *testing.M) {
+	tempDir, err := ioutil.TempDir("", "eg-k8spodlifecycle-test")
+	if err != nil {
+		panic(err)
+	}
+	absLogDir := filepath.Join(tempDir, "log")
+	os.MkdirAll(absLogDir, 0755)
+	logger.Init(&option.Options{
+		Name:      "k8spodlifecycle-for-log",
+		AbsLogDir: absLogDir,
+	})
+
+	code := m.Run()
+
+	logger.Sync()
+	os.RemoveAll(tempDir)
+
+	os.Exit(code)
+}
+
+const testEndpointSlices = `{"items": [
+	{"metadata": {"name": "demo-v4"}, "endpoints": [
+		{"addresses": ["10.0.0.1"], "targetRef": {"kind": "Pod", "name": "pod-b"}},
+		{"addresses": ["10.0.0.2"], "targetRef": {"kind": "Pod", "name": "pod-a"}}
+	]},
+	{"metadata": {"name": "demo-v6"}, "endpoints": [
+		{"addresses": ["fd00::2"], "targetRef": {"kind": "Pod", "name": "pod-a"}}
+	]}
+]}`
+
+func newTestPodLifecycle(t *testing.T, apiServer string) *KubernetesPodLifecycle {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	ioutil.WriteFile(tokenFile, []byte("test-token\n"), 0600)
+
+	superSpec, err := supervisor.NewSpec(`
+name: pod-lifecycle
+kind: KubernetesPodLifecycle
+serviceName: demo
+namespace: default
+podName: pod-a
+apiServer: ` + apiServer + `
+tokenFile: ` + tokenFile + `
+caFile: ""
+drainInterval: 100ms`)
+	if err != nil {
+		t.Fatalf("new spec failed: %v", err)
+	}
+
+	pl := &KubernetesPodLifecycle{}
+	pl.Init(superSpec, nil)
+	return pl
+}
+
+func TestDrain(t *testing.T) {
+	patches := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			if r.URL.Path != "/apis/discovery.k8s.io/v1/namespaces/default/endpointslices" ||
+				r.URL.Query().Get("labelSelector") != "kubernetes.io/service-name=demo" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write([]byte(testEndpointSlices))
+		case http.MethodPatch:
+			body, _ := ioutil.ReadAll(r.Body)
+			patches <- r.URL.Path + " " + string(body)
+			w.Write([]byte("{}"))
+		}
+	}))
+	defer server.Close()
+
+	pl := newTestPodLifecycle(t, server.URL)
+	defer pl.Close()
+
+	weights := []float64{}
+	pl.setWeight = func(weight float64) { weights = append(weights, weight) }
+	pl.Drain()
+
+	for _, want := range []string{
+		`/apis/discovery.k8s.io/v1/namespaces/default/endpointslices/demo-v4 [` +
+			`{"op":"test","path":"/endpoints/1/targetRef/name","value":"pod-a"},` +
+			`{"op":"replace","path":"/endpoints/1/conditions","value":{"ready":false,"serving":true,"terminating":true}}]`,
+		`/apis/discovery.k8s.io/v1/namespaces/default/endpointslices/demo-v6 [` +
+			`{"op":"test","path":"/endpoints/0/targetRef/name","value":"pod-a"},` +
+			`{"op":"replace","path":"/endpoints/0/conditions","value":{"ready":false,"serving":true,"terminating":true}}]`,
+	} {
+		select {
+		case got := <-patches:
+			if got != want {
+				t.Errorf("want patch %s, got %s", want, got)
+			}
+		default:
+			t.Errorf("want patch %s", want)
+		}
+	}
+
+	if len(weights) != drainSteps || weights[0] != 0.9 || weights[drainSteps-1] != 0 {
+		t.Errorf("want weights lowered to 0 in %d steps, got %v", drainSteps, weights)
+	}
+
+	status := pl.getStatus()
+	if status.State != stateDrained || status.Weight != 0 || len(status.TerminatingSlices) != 2 || status.Error != "" {
+		t.Errorf("want drained status, got %+v", status)
+	}
+}
+
+func TestDrainWithoutAPIServer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"items": []}`))
+	}))
+	defer server.Close()
+
+	pl := newTestPodLifecycle(t, server.URL)
+	defer pl.Close()
+
+	var weight float64 = 1
+	pl.setWeight = func(w float64) { weight = w }
+	pl.Drain()
+
+	// NOTE: The weight is lowered anyway.
+	status := pl.getStatus()
+	if weight != 0 || status.State != stateDrained || status.Error == "" {
+		t.Errorf("want drained with error, got weight %v, status %+v", weight, status)
+	}
+}
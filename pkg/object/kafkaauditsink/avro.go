@@ -0,0 +1,141 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafkaauditsink
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/pkg/util/auditevent"
+)
+
+const (
+	// eventSchema is the Avro schema of the audit events,
+	// the fields are encoded in this order.
+	eventSchema = `{"type":"record","name":"PipelineAuditEvent","namespace":"com.megaease.easegress",` +
+		`"fields":[` +
+		`{"name":"timestamp","type":{"type":"long","logicalType":"timestamp-millis"}},` +
+		`{"name":"type","type":"string"},` +
+		`{"name":"object","type":"string"},` +
+		`{"name":"filter","type":"string"},` +
+		`{"name":"result","type":"string"},` +
+		`{"name":"statusCode","type":"int"},` +
+		`{"name":"latencyMicros","type":"long"},` +
+		`{"name":"requestID","type":"string"},` +
+		`{"name":"sourceIP","type":"string"}]}`
+
+	// magicByte leads the Confluent wire format, followed by
+	// the 4-byte schema ID and the Avro binary encoding.
+	magicByte = 0x0
+
+	schemaRegistryContentType = "application/vnd.schemaregistry.v1+json"
+)
+
+type schemaRegistry struct {
+	spec   *SchemaRegistrySpec
+	client *http.Client
+}
+
+func newSchemaRegistry(spec *SchemaRegistrySpec) *schemaRegistry {
+	return &schemaRegistry{
+		spec:   spec,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// register registers the schema under the subject, it returns the
+// ID of the existing schema if it has been registered.
+func (sr *schemaRegistry) register(subject, schema string) (int32, error) {
+	body, err := json.Marshal(map[string]string{"schema": schema})
+	if err != nil {
+		return 0, err
+	}
+
+	u := strings.TrimSuffix(sr.spec.URL, "/") + "/subjects/" + url.PathEscape(subject) + "/versions"
+	req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", schemaRegistryContentType)
+	if sr.spec.Username != "" {
+		req.SetBasicAuth(sr.spec.Username, sr.spec.Password)
+	}
+
+	resp, err := sr.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("register schema of %s failed: status %d: %s",
+			subject, resp.StatusCode, respBody)
+	}
+
+	result := struct {
+		ID int32 `json:"id"`
+	}{}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return 0, fmt.Errorf("unmarshal %s failed: %v", respBody, err)
+	}
+
+	return result.ID, nil
+}
+
+// encodeEvent encodes the event by eventSchema in the Confluent wire format.
+func encodeEvent(schemaID int32, e *auditevent.Event) []byte {
+	buff := make([]byte, 5, 128)
+	buff[0] = magicByte
+	binary.BigEndian.PutUint32(buff[1:], uint32(schemaID))
+
+	buff = appendLong(buff, e.Time.UnixNano()/int64(time.Millisecond))
+	buff = appendString(buff, e.Type)
+	buff = appendString(buff, e.Object)
+	buff = appendString(buff, e.Filter)
+	buff = appendString(buff, e.Result)
+	buff = appendLong(buff, int64(e.StatusCode))
+	buff = appendLong(buff, e.Latency.Microseconds())
+	buff = appendString(buff, e.RequestID)
+	buff = appendString(buff, e.SourceIP)
+
+	return buff
+}
+
+// appendLong appends the zig-zag variable-length encoding of Avro int and long.
+func appendLong(buff []byte, n int64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	size := binary.PutVarint(tmp[:], n)
+	return append(buff, tmp[:size]...)
+}
+
+func appendString(buff []byte, s string) []byte {
+	buff = appendLong(buff, int64(len(s)))
+	return append(buff, s...)
+}
@@ -0,0 +1,417 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafkaauditsink
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/auditevent"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+
+	"github.com/Shopify/sarama"
+)
+
+const (
+	// Category is the category of KafkaAuditSink.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of KafkaAuditSink.
+	Kind = "KafkaAuditSink"
+
+	// deadLetterSuffix is appended to the topic for the dead letters.
+	deadLetterSuffix = ".dlq"
+	// deadLetterErrorHeader carries the error of the dead letter.
+	deadLetterErrorHeader = "error"
+
+	// registerRetryInterval throttles the schema registrations after failures.
+	registerRetryInterval = 10 * time.Second
+)
+
+func init() {
+	supervisor.Register(&KafkaAuditSink{})
+}
+
+type (
+	// KafkaAuditSink writes the audit events of pipelines to Kafka,
+	// encoded by Avro with the schema in the Confluent Schema Registry.
+	KafkaAuditSink struct {
+		super     *supervisor.Supervisor
+		superSpec *supervisor.Spec
+		spec      *Spec
+
+		subscription *auditevent.Subscription
+		registry     *schemaRegistry
+		deadLetters  chan *sarama.ProducerMessage
+		done         chan struct{}
+		wg           sync.WaitGroup
+
+		// producer is sarama.AsyncProducer.
+		producer      atomic.Value
+		producerMutex sync.Mutex
+		// newProducer creates the producer, it's sarama.NewAsyncProducer if nil.
+		newProducer func(brokers []string, config *sarama.Config) (sarama.AsyncProducer, error)
+
+		// schemaID is the registered ID, registration is retried
+		// after registerRetryInterval on failures.
+		schemaID        int32
+		schemaErr       error
+		lastRegistering time.Time
+
+		// The counters are accessed atomically.
+		sent             uint64
+		failed           uint64
+		deadLettered     uint64
+		deadLetterFailed uint64
+		dropped          uint64
+	}
+
+	// Spec describes KafkaAuditSink.
+	Spec struct {
+		Brokers []string `yaml:"brokers" jsonschema:"required,uniqueItems=true"`
+		Topic   string   `yaml:"topic" jsonschema:"required"`
+
+		SchemaRegistry *SchemaRegistrySpec `yaml:"schemaRegistry" jsonschema:"required"`
+
+		// Pipelines selects the events of the pipelines, all if empty.
+		Pipelines []string `yaml:"pipelines" jsonschema:"omitempty,uniqueItems=true"`
+		// EventTypes selects the types of events, all if empty.
+		EventTypes []string `yaml:"eventTypes" jsonschema:"omitempty,uniqueItems=true"`
+
+		// Linger is how long the messages wait to be batched, like linger.ms.
+		Linger string `yaml:"linger" jsonschema:"omitempty,format=duration"`
+		// BatchSize is the bytes of messages to flush a batch, like batch.size.
+		BatchSize int `yaml:"batchSize" jsonschema:"omitempty,minimum=1"`
+		// BufferSize is the number of events buffered, the new events
+		// are dropped if the producer falls behind.
+		BufferSize int `yaml:"bufferSize" jsonschema:"omitempty,minimum=1"`
+	}
+
+	// SchemaRegistrySpec is the spec of the Confluent Schema Registry.
+	SchemaRegistrySpec struct {
+		URL      string `yaml:"url" jsonschema:"required,format=uri"`
+		Username string `yaml:"username" jsonschema:"omitempty"`
+		Password string `yaml:"password" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of KafkaAuditSink.
+	Status struct {
+		Health           string `yaml:"health"`
+		SchemaID         int32  `yaml:"schemaID"`
+		Sent             uint64 `yaml:"sent"`
+		Failed           uint64 `yaml:"failed"`
+		DeadLettered     uint64 `yaml:"deadLettered"`
+		DeadLetterFailed uint64 `yaml:"deadLetterFailed"`
+		Dropped          uint64 `yaml:"dropped"`
+	}
+)
+
+// Validate validates Spec.
+func (spec Spec) Validate() error {
+	for _, t := range spec.EventTypes {
+		switch t {
+		case auditevent.TypeRequestCompleted, auditevent.TypeCircuitBreakerTransited:
+		default:
+			return fmt.Errorf("unknown event type %s", t)
+		}
+	}
+
+	return nil
+}
+
+// Category returns the category of KafkaAuditSink.
+func (kas *KafkaAuditSink) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of KafkaAuditSink.
+func (kas *KafkaAuditSink) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of KafkaAuditSink.
+func (kas *KafkaAuditSink) DefaultSpec() interface{} {
+	return &Spec{
+		Linger:     "5ms",
+		BatchSize:  16384,
+		BufferSize: 10000,
+	}
+}
+
+// Init initializes KafkaAuditSink.
+func (kas *KafkaAuditSink) Init(superSpec *supervisor.Spec, super *supervisor.Supervisor) {
+	kas.superSpec, kas.spec, kas.super = superSpec, superSpec.ObjectSpec().(*Spec), super
+	kas.reload()
+}
+
+// Inherit inherits previous generation of KafkaAuditSink.
+func (kas *KafkaAuditSink) Inherit(superSpec *supervisor.Spec,
+	previousGeneration supervisor.Object, super *supervisor.Supervisor) {
+
+	previousGeneration.Close()
+	kas.Init(superSpec, super)
+}
+
+func (kas *KafkaAuditSink) reload() {
+	if kas.spec.BufferSize <= 0 {
+		kas.spec.BufferSize = 10000
+	}
+
+	kas.registry = newSchemaRegistry(kas.spec.SchemaRegistry)
+	kas.deadLetters = make(chan *sarama.ProducerMessage, kas.spec.BufferSize)
+	kas.done = make(chan struct{})
+	kas.subscription = auditevent.Subscribe(kas.spec.BufferSize)
+
+	_, err := kas.getProducer()
+	if err != nil {
+		logger.Errorf("%s get kafka producer failed: %v", kas.superSpec.Name(), err)
+	}
+
+	kas.wg.Add(2)
+	go kas.run()
+	go kas.runDeadLetters()
+}
+
+func (kas *KafkaAuditSink) deadLetterTopic() string {
+	return kas.spec.Topic + deadLetterSuffix
+}
+
+func (kas *KafkaAuditSink) getProducer() (sarama.AsyncProducer, error) {
+	producer := kas.producer.Load()
+	if producer != nil {
+		return producer.(sarama.AsyncProducer), nil
+	}
+
+	kas.producerMutex.Lock()
+	defer kas.producerMutex.Unlock()
+
+	if producer := kas.producer.Load(); producer != nil {
+		return producer.(sarama.AsyncProducer), nil
+	}
+
+	config := sarama.NewConfig()
+	config.ClientID = kas.superSpec.Name()
+	// NOTE: Headers of the dead letters need Kafka 0.11.
+	config.Version = sarama.V0_11_0_0
+	config.Producer.Return.Successes = true
+	config.Producer.Flush.Bytes = kas.spec.BatchSize
+	if d, err := time.ParseDuration(kas.spec.Linger); err == nil {
+		config.Producer.Flush.Frequency = d
+	}
+
+	newProducer := kas.newProducer
+	if newProducer == nil {
+		newProducer = sarama.NewAsyncProducer
+	}
+	p, err := newProducer(kas.spec.Brokers, config)
+	if err != nil {
+		return nil, fmt.Errorf("start sarama producer failed(brokers: %v): %v",
+			kas.spec.Brokers, err)
+	}
+
+	go kas.handleSuccesses(p)
+	go kas.handleErrors(p)
+
+	kas.producer.Store(p)
+	logger.Infof("%s build kafka producer successfully", kas.superSpec.Name())
+
+	return p, nil
+}
+
+// getSchemaID returns the ID of eventSchema, it's only called by run.
+func (kas *KafkaAuditSink) getSchemaID() (int32, error) {
+	if kas.schemaID != 0 {
+		return kas.schemaID, nil
+	}
+	if time.Since(kas.lastRegistering) < registerRetryInterval {
+		return 0, kas.schemaErr
+	}
+
+	kas.lastRegistering = time.Now()
+	id, err := kas.registry.register(kas.spec.Topic+"-value", eventSchema)
+	if err != nil {
+		kas.schemaErr = err
+		logger.Errorf("%s register schema failed: %v", kas.superSpec.Name(), err)
+		return 0, err
+	}
+
+	atomic.StoreInt32(&kas.schemaID, id)
+	return id, nil
+}
+
+func (kas *KafkaAuditSink) selects(e *auditevent.Event) bool {
+	if len(kas.spec.Pipelines) > 0 && !stringtool.StrInSlice(e.Object, kas.spec.Pipelines) {
+		return false
+	}
+	if len(kas.spec.EventTypes) > 0 && !stringtool.StrInSlice(e.Type, kas.spec.EventTypes) {
+		return false
+	}
+	return true
+}
+
+func (kas *KafkaAuditSink) run() {
+	defer kas.wg.Done()
+
+	for {
+		select {
+		case <-kas.done:
+			return
+		case e, ok := <-kas.subscription.Events():
+			if !ok {
+				return
+			}
+			if kas.selects(e) {
+				kas.send(e)
+			}
+		}
+	}
+}
+
+func (kas *KafkaAuditSink) send(e *auditevent.Event) {
+	producer, err := kas.getProducer()
+	if err != nil {
+		atomic.AddUint64(&kas.dropped, 1)
+		return
+	}
+	schemaID, err := kas.getSchemaID()
+	if err != nil {
+		atomic.AddUint64(&kas.dropped, 1)
+		return
+	}
+
+	msg := &sarama.ProducerMessage{
+		Topic: kas.spec.Topic,
+		// NOTE: The events of a pipeline are kept in order in a partition.
+		Key:   sarama.StringEncoder(e.Object),
+		Value: sarama.ByteEncoder(encodeEvent(schemaID, e)),
+	}
+
+	select {
+	case producer.Input() <- msg:
+	case <-kas.done:
+	}
+}
+
+// runDeadLetters sends the dead letters, apart from handleErrors
+// to not block the producer returning errors.
+func (kas *KafkaAuditSink) runDeadLetters() {
+	defer kas.wg.Done()
+
+	for {
+		select {
+		case <-kas.done:
+			return
+		case msg := <-kas.deadLetters:
+			producer, err := kas.getProducer()
+			if err != nil {
+				atomic.AddUint64(&kas.deadLetterFailed, 1)
+				continue
+			}
+			select {
+			case producer.Input() <- msg:
+			case <-kas.done:
+				return
+			}
+		}
+	}
+}
+
+func (kas *KafkaAuditSink) handleSuccesses(producer sarama.AsyncProducer) {
+	for msg := range producer.Successes() {
+		if msg.Topic == kas.spec.Topic {
+			atomic.AddUint64(&kas.sent, 1)
+		} else {
+			atomic.AddUint64(&kas.deadLettered, 1)
+		}
+	}
+}
+
+func (kas *KafkaAuditSink) handleErrors(producer sarama.AsyncProducer) {
+	for err := range producer.Errors() {
+		if err.Msg.Topic != kas.spec.Topic {
+			atomic.AddUint64(&kas.deadLetterFailed, 1)
+			logger.Errorf("%s produce dead letter to %s failed: %v",
+				kas.superSpec.Name(), err.Msg.Topic, err.Err)
+			continue
+		}
+
+		atomic.AddUint64(&kas.failed, 1)
+		msg := &sarama.ProducerMessage{
+			Topic: kas.deadLetterTopic(),
+			Key:   err.Msg.Key,
+			Value: err.Msg.Value,
+			Headers: []sarama.RecordHeader{{
+				Key:   []byte(deadLetterErrorHeader),
+				Value: []byte(err.Err.Error()),
+			}},
+		}
+
+		select {
+		case kas.deadLetters <- msg:
+		default:
+			atomic.AddUint64(&kas.deadLetterFailed, 1)
+			logger.Errorf("%s dead letter dropped: too many dead letters", kas.superSpec.Name())
+		}
+	}
+}
+
+// Status returns status of KafkaAuditSink.
+func (kas *KafkaAuditSink) Status() *supervisor.Status {
+	s := &Status{
+		SchemaID:         atomic.LoadInt32(&kas.schemaID),
+		Sent:             atomic.LoadUint64(&kas.sent),
+		Failed:           atomic.LoadUint64(&kas.failed),
+		DeadLettered:     atomic.LoadUint64(&kas.deadLettered),
+		DeadLetterFailed: atomic.LoadUint64(&kas.deadLetterFailed),
+		Dropped:          atomic.LoadUint64(&kas.dropped) + kas.subscription.Dropped(),
+	}
+
+	_, err := kas.getProducer()
+	if err != nil {
+		s.Health = err.Error()
+	} else {
+		s.Health = "ready"
+	}
+
+	return &supervisor.Status{ObjectStatus: s}
+}
+
+// Close closes KafkaAuditSink.
+func (kas *KafkaAuditSink) Close() {
+	// NOTE: Stop sending before closing the producer,
+	// which flushes the buffered messages.
+	close(kas.done)
+	kas.subscription.Close()
+	kas.wg.Wait()
+
+	kas.producerMutex.Lock()
+	defer kas.producerMutex.Unlock()
+
+	value := kas.producer.Load()
+	if value == nil {
+		return
+	}
+	err := value.(sarama.AsyncProducer).Close()
+	if err != nil {
+		logger.Errorf("%s close kafka producer failed: %v", kas.superSpec.Name(), err)
+	}
+}
@@ -0,0 +1,281 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafkaauditsink
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/auditevent"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+)
+
+func TestMain(m *testing.M) {
+	tempDir, err := ioutil.TempDir("", "eg-kafkaauditsink-test")
+	if err != nil {
+		panic(err)
+	}
+	absLogDir := filepath.Join(tempDir, "log")
+	os.MkdirAll(absLogDir, 0755)
+	logger.Init(&option.Options{
+		Name:      "kafkaauditsink-for-log",
+		AbsLogDir: absLogDir,
+	})
+
+	code := m.Run()
+
+	logger.Sync()
+	os.RemoveAll(tempDir)
+
+	os.Exit(code)
+}
+
+// avroReader decodes the Avro binary encoding for the tests.
+type avroReader struct {
+	buff []byte
+}
+
+func (r *avroReader) long() int64 {
+	n, size := binary.Varint(r.buff)
+	r.buff = r.buff[size:]
+	return n
+}
+
+func (r *avroReader) string() string {
+	size := r.long()
+	s := string(r.buff[:size])
+	r.buff = r.buff[size:]
+	return s
+}
+
+func decodeEvent(t *testing.T, buff []byte) (int32, *auditevent.Event) {
+	t.Helper()
+	if len(buff) < 5 || buff[0] != magicByte {
+		t.Fatalf("invalid wire format: %v", buff)
+	}
+
+	r := &avroReader{buff: buff[5:]}
+	e := &auditevent.Event{
+		Time:       time.Unix(0, r.long()*int64(time.Millisecond)),
+		Type:       r.string(),
+		Object:     r.string(),
+		Filter:     r.string(),
+		Result:     r.string(),
+		StatusCode: int(r.long()),
+		Latency:    time.Duration(r.long()) * time.Microsecond,
+		RequestID:  r.string(),
+		SourceIP:   r.string(),
+	}
+	if len(r.buff) != 0 {
+		t.Fatalf("%d bytes left", len(r.buff))
+	}
+
+	return int32(binary.BigEndian.Uint32(buff[1:5])), e
+}
+
+func TestEncodeEvent(t *testing.T) {
+	if !json.Valid([]byte(eventSchema)) {
+		t.Fatalf("invalid schema: %s", eventSchema)
+	}
+
+	e := &auditevent.Event{
+		Time:       time.Unix(1600000000, 123000000),
+		Type:       auditevent.TypeRequestCompleted,
+		Object:     "pipeline-demo",
+		Filter:     "rate-limiter",
+		Result:     "rateLimited",
+		StatusCode: 429,
+		Latency:    1500 * time.Microsecond,
+		RequestID:  "f00",
+		SourceIP:   "10.0.0.1",
+	}
+
+	buff := encodeEvent(7, e)
+	id, got := decodeEvent(t, buff)
+	if id != 7 {
+		t.Errorf("want schema ID 7, got %d", id)
+	}
+	if !got.Time.Equal(e.Time) {
+		t.Errorf("want time %v, got %v", e.Time, got.Time)
+	}
+	got.Time = e.Time
+	if *got != *e {
+		t.Errorf("want %+v, got %+v", e, got)
+	}
+
+	// 429 is encoded by zig-zag as 858, which is 0xda 0x06.
+	if enc := appendLong(nil, 429); len(enc) != 2 || enc[0] != 0xda || enc[1] != 0x06 {
+		t.Errorf("want zig-zag encoding da06, got %x", enc)
+	}
+	if enc := appendLong(nil, -1); len(enc) != 1 || enc[0] != 0x01 {
+		t.Errorf("want zig-zag encoding 01, got %x", enc)
+	}
+}
+
+func newTestRegistry(t *testing.T, id int32, registered *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(registered, 1)
+
+		if r.Method != http.MethodPost || r.URL.Path != "/subjects/audit-value/versions" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if ct := r.Header.Get("Content-Type"); ct != schemaRegistryContentType {
+			t.Errorf("unexpected content type %s", ct)
+		}
+		if user, pass, _ := r.BasicAuth(); user != "user" || pass != "pass" {
+			t.Errorf("unexpected basic auth %s:%s", user, pass)
+		}
+
+		body := map[string]string{}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["schema"] != eventSchema {
+			t.Errorf("unexpected schema %s", body["schema"])
+		}
+
+		json.NewEncoder(w).Encode(map[string]int32{"id": id})
+	}))
+}
+
+func TestRegisterSchema(t *testing.T) {
+	var registered int32
+	server := newTestRegistry(t, 42, &registered)
+	defer server.Close()
+
+	sr := newSchemaRegistry(&SchemaRegistrySpec{URL: server.URL + "/", Username: "user", Password: "pass"})
+	id, err := sr.register("audit-value", eventSchema)
+	if err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	if id != 42 {
+		t.Errorf("want ID 42, got %d", id)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+	}))
+	defer failing.Close()
+
+	sr = newSchemaRegistry(&SchemaRegistrySpec{URL: failing.URL})
+	if _, err := sr.register("audit-value", eventSchema); err == nil {
+		t.Errorf("want error")
+	}
+}
+
+func TestSpecValidate(t *testing.T) {
+	if err := (Spec{EventTypes: []string{auditevent.TypeRequestCompleted}}).Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := (Spec{EventTypes: []string{"unknown"}}).Validate(); err == nil {
+		t.Errorf("want error")
+	}
+}
+
+func waitStatus(t *testing.T, kas *KafkaAuditSink, fn func(s *Status) bool) *Status {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		s := kas.Status().ObjectStatus.(*Status)
+		if fn(s) {
+			return s
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	s := kas.Status().ObjectStatus.(*Status)
+	t.Fatalf("unexpected status: %+v", s)
+	return s
+}
+
+func TestKafkaAuditSink(t *testing.T) {
+	var registered int32
+	registry := newTestRegistry(t, 3, &registered)
+	defer registry.Close()
+
+	superSpec, err := supervisor.NewSpec(`
+name: kafka-audit-sink
+kind: KafkaAuditSink
+brokers: [127.0.0.1:9092]
+topic: audit
+schemaRegistry:
+  url: ` + registry.URL + `
+  username: user
+  password: pass
+pipelines: [pipeline-demo]
+`)
+	if err != nil {
+		t.Fatalf("new spec failed: %v", err)
+	}
+
+	var producer *mocks.AsyncProducer
+	kas := &KafkaAuditSink{
+		newProducer: func(brokers []string, config *sarama.Config) (sarama.AsyncProducer, error) {
+			if config.Producer.Flush.Frequency != 5*time.Millisecond || config.Producer.Flush.Bytes != 16384 {
+				t.Errorf("unexpected flush config: %+v", config.Producer.Flush)
+			}
+			producer = mocks.NewAsyncProducer(t, config)
+			producer.ExpectInputWithCheckerFunctionAndSucceed(func(val []byte) error {
+				id, e := decodeEvent(t, val)
+				if id != 3 || e.Object != "pipeline-demo" || e.RequestID != "1" {
+					return errors.New("unexpected event")
+				}
+				return nil
+			})
+			producer.ExpectInputAndFail(errors.New("broker down"))
+			// The dead letter of the failed one.
+			producer.ExpectInputWithCheckerFunctionAndSucceed(func(val []byte) error {
+				if _, e := decodeEvent(t, val); e.RequestID != "2" {
+					return errors.New("unexpected dead letter")
+				}
+				return nil
+			})
+			return producer, nil
+		},
+	}
+	kas.Init(superSpec, nil)
+
+	auditevent.Publish(&auditevent.Event{Type: auditevent.TypeRequestCompleted, Object: "pipeline-demo", RequestID: "1"})
+	auditevent.Publish(&auditevent.Event{Type: auditevent.TypeRequestCompleted, Object: "other-pipeline", RequestID: "x"})
+	auditevent.Publish(&auditevent.Event{Type: auditevent.TypeCircuitBreakerTransited, Object: "pipeline-demo", RequestID: "2"})
+
+	s := waitStatus(t, kas, func(s *Status) bool {
+		return s.Sent == 1 && s.Failed == 1 && s.DeadLettered == 1
+	})
+	if s.SchemaID != 3 || s.Health != "ready" || s.Dropped != 0 || s.DeadLetterFailed != 0 {
+		t.Errorf("unexpected status: %+v", s)
+	}
+	if registered != 1 {
+		t.Errorf("want schema registered once, got %d", registered)
+	}
+
+	kas.Close()
+	if auditevent.Enabled() {
+		t.Errorf("want subscription closed")
+	}
+}
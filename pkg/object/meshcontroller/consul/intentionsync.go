@@ -0,0 +1,502 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package consul integrates the mesh with Consul Connect.
+package consul
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/meshcontroller/layout"
+	"github.com/megaease/easegress/pkg/object/meshcontroller/spec"
+	"github.com/megaease/easegress/pkg/object/meshcontroller/storage"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/ipfilter"
+
+	"github.com/hashicorp/consul/api"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// Category is the category of ConsulIntentionSync.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of ConsulIntentionSync.
+	Kind = "ConsulIntentionSync"
+
+	wildcard = "*"
+)
+
+func init() {
+	supervisor.Register(&ConsulIntentionSync{})
+}
+
+type (
+	// ConsulIntentionSync watches Consul intentions and translates them
+	// into the ip filters of the ingress of mesh services.
+	ConsulIntentionSync struct {
+		super     *supervisor.Supervisor
+		superSpec *supervisor.Spec
+		spec      *Spec
+
+		client *api.Client
+		store  storage.Storage
+
+		statusMutex sync.Mutex
+		status      *Status
+		// managed contains services whose ip filters are maintained by the sync.
+		managed map[string]struct{}
+
+		ctx    context.Context
+		cancel context.CancelFunc
+		done   chan struct{}
+	}
+
+	// Spec describes the ConsulIntentionSync.
+	Spec struct {
+		Address    string `yaml:"address" jsonschema:"required"`
+		Scheme     string `yaml:"scheme" jsonschema:"omitempty,enum=http,enum=https"`
+		Datacenter string `yaml:"datacenter" jsonschema:"omitempty"`
+		Token      string `yaml:"token" jsonschema:"omitempty"`
+		Namespace  string `yaml:"namespace" jsonschema:"omitempty"`
+		// SyncInterval is the max wait time of one blocking query,
+		// service addresses are refreshed at least at this interval.
+		SyncInterval string `yaml:"syncInterval" jsonschema:"required,format=duration"`
+
+		// MeshControllerName is the name of the MeshController whose
+		// services are updated.
+		MeshControllerName string `yaml:"meshControllerName" jsonschema:"required"`
+		// BlockByDefault is used for the destination without any
+		// intention from the wildcard source.
+		BlockByDefault bool `yaml:"blockByDefault" jsonschema:"omitempty"`
+		// ServiceCIDRs overrides the source addresses of the services,
+		// which are the addresses registered in Consul catalog by default.
+		ServiceCIDRs map[string][]string `yaml:"serviceCIDRs" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of ConsulIntentionSync.
+	Status struct {
+		Health         string   `yaml:"health"`
+		LastSyncTime   string   `yaml:"lastSyncTime,omitempty"`
+		Intentions     int      `yaml:"intentions"`
+		SyncedServices []string `yaml:"syncedServices"`
+	}
+)
+
+// Validate validates Spec.
+func (s Spec) Validate() error {
+	for service, cidrs := range s.ServiceCIDRs {
+		for _, cidr := range cidrs {
+			if net.ParseIP(cidr) != nil {
+				continue
+			}
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				return fmt.Errorf("service %s: invalid ip or cidr %s", service, cidr)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Category returns the category of ConsulIntentionSync.
+func (cis *ConsulIntentionSync) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of ConsulIntentionSync.
+func (cis *ConsulIntentionSync) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of ConsulIntentionSync.
+func (cis *ConsulIntentionSync) DefaultSpec() interface{} {
+	return &Spec{
+		Address:      "127.0.0.1:8500",
+		Scheme:       "http",
+		SyncInterval: "10s",
+	}
+}
+
+// Init initilizes ConsulIntentionSync.
+func (cis *ConsulIntentionSync) Init(superSpec *supervisor.Spec, super *supervisor.Supervisor) {
+	cis.superSpec, cis.spec, cis.super = superSpec, superSpec.ObjectSpec().(*Spec), super
+	cis.reload()
+}
+
+// Inherit inherits previous generation of ConsulIntentionSync.
+func (cis *ConsulIntentionSync) Inherit(superSpec *supervisor.Spec,
+	previousGeneration supervisor.Object, super *supervisor.Supervisor) {
+
+	previousGeneration.Close()
+	cis.Init(superSpec, super)
+}
+
+func (cis *ConsulIntentionSync) reload() {
+	cis.status = &Status{Health: "initializing"}
+	cis.managed = make(map[string]struct{})
+	cis.ctx, cis.cancel = context.WithCancel(context.Background())
+	cis.done = make(chan struct{})
+
+	config := api.DefaultConfig()
+	config.Address = cis.spec.Address
+	if cis.spec.Scheme != "" {
+		config.Scheme = cis.spec.Scheme
+	}
+	if cis.spec.Datacenter != "" {
+		config.Datacenter = cis.spec.Datacenter
+	}
+	if cis.spec.Token != "" {
+		config.Token = cis.spec.Token
+	}
+	if cis.spec.Namespace != "" {
+		config.Namespace = cis.spec.Namespace
+	}
+
+	client, err := api.NewClient(config)
+	if err != nil {
+		logger.Errorf("%s create consul client failed: %v", cis.superSpec.Name(), err)
+		cis.setHealth(err.Error())
+		close(cis.done)
+		return
+	}
+	cis.client = client
+
+	cis.store = storage.New(cis.spec.MeshControllerName, cis.super.Cluster())
+
+	go cis.run()
+}
+
+func (cis *ConsulIntentionSync) run() {
+	defer close(cis.done)
+
+	syncInterval, err := time.ParseDuration(cis.spec.SyncInterval)
+	if err != nil {
+		logger.Errorf("BUG: parse duration %s failed: %v",
+			cis.spec.SyncInterval, err)
+		return
+	}
+
+	var index uint64
+	for {
+		q := &api.QueryOptions{
+			Namespace:  cis.spec.Namespace,
+			Datacenter: cis.spec.Datacenter,
+			WaitIndex:  index,
+			WaitTime:   syncInterval,
+		}
+		intentions, meta, err := cis.client.Connect().Intentions(q.WithContext(cis.ctx))
+		if cis.ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			logger.Errorf("%s watch intentions failed: %v", cis.superSpec.Name(), err)
+			cis.setHealth(err.Error())
+			select {
+			case <-cis.ctx.Done():
+				return
+			case <-time.After(syncInterval):
+			}
+			continue
+		}
+
+		// NOTE: The index must be reset if it goes backwards.
+		// Reference: https://www.consul.io/api-docs/features/blocking
+		index = meta.LastIndex
+		if index < q.WaitIndex {
+			index = 0
+		}
+
+		// NOTE: It syncs on timeouts of the blocking query too,
+		// for picking up changes of service addresses and mesh services.
+		cis.sync(intentions)
+	}
+}
+
+func (cis *ConsulIntentionSync) sync(intentions []*api.Intention) {
+	err := cis.store.Lock()
+	if err != nil {
+		logger.Errorf("%s lock mesh storage failed: %v", cis.superSpec.Name(), err)
+		cis.setHealth(err.Error())
+		return
+	}
+	defer func() {
+		if err := cis.store.Unlock(); err != nil {
+			logger.Errorf("%s unlock mesh storage failed: %v", cis.superSpec.Name(), err)
+		}
+	}()
+
+	services, err := cis.listServiceSpecs()
+	if err != nil {
+		logger.Errorf("%s list mesh services failed: %v", cis.superSpec.Name(), err)
+		cis.setHealth(err.Error())
+		return
+	}
+
+	serviceNames := make([]string, 0, len(services))
+	for name := range services {
+		serviceNames = append(serviceNames, name)
+	}
+
+	filters := translateIntentions(intentions, serviceNames, cis.spec.BlockByDefault, cis.sourceCIDRs())
+
+	// NOTE: The services not targeted by intentions anymore are released.
+	for name := range cis.managed {
+		if _, exists := filters[name]; !exists {
+			filters[name] = nil
+		}
+	}
+
+	managed := make(map[string]struct{})
+	for name, filter := range filters {
+		service, exists := services[name]
+		if !exists {
+			continue
+		}
+		if filter != nil {
+			managed[name] = struct{}{}
+		}
+		if ipFilterEqual(service.IPFilter, filter) {
+			continue
+		}
+
+		service.IPFilter = filter
+		err := cis.putServiceSpec(service)
+		if err != nil {
+			logger.Errorf("%s update ip filter of service %s failed: %v",
+				cis.superSpec.Name(), name, err)
+			managed[name] = struct{}{} // retry releasing it next time
+			continue
+		}
+		logger.Infof("%s updated ip filter of service %s: %+v",
+			cis.superSpec.Name(), name, filter)
+	}
+	cis.managed = managed
+
+	syncedServices := make([]string, 0, len(managed))
+	for name := range managed {
+		syncedServices = append(syncedServices, name)
+	}
+	sort.Strings(syncedServices)
+
+	cis.statusMutex.Lock()
+	cis.status = &Status{
+		Health:         "ready",
+		LastSyncTime:   time.Now().Format(time.RFC3339),
+		Intentions:     len(intentions),
+		SyncedServices: syncedServices,
+	}
+	cis.statusMutex.Unlock()
+}
+
+func (cis *ConsulIntentionSync) listServiceSpecs() (map[string]*spec.Service, error) {
+	kvs, err := cis.store.GetPrefix(layout.ServiceSpecPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	services := make(map[string]*spec.Service)
+	for _, v := range kvs {
+		service := &spec.Service{}
+		err := yaml.Unmarshal([]byte(v), service)
+		if err != nil {
+			logger.Errorf("BUG: unmarshal %s to yaml failed: %v", v, err)
+			continue
+		}
+		services[service.Name] = service
+	}
+
+	return services, nil
+}
+
+func (cis *ConsulIntentionSync) putServiceSpec(service *spec.Service) error {
+	buff, err := yaml.Marshal(service)
+	if err != nil {
+		panic(fmt.Errorf("BUG: marshal %#v to yaml failed: %v", service, err))
+	}
+
+	return cis.store.Put(layout.ServiceSpecKey(service.Name), string(buff))
+}
+
+// sourceCIDRs returns the function looking up the addresses of the
+// source service, the catalog is queried once per service in one sync.
+func (cis *ConsulIntentionSync) sourceCIDRs() func(service string) []string {
+	cache := make(map[string][]string)
+
+	return func(service string) []string {
+		if cidrs, exists := cis.spec.ServiceCIDRs[service]; exists {
+			return cidrs
+		}
+		if cidrs, exists := cache[service]; exists {
+			return cidrs
+		}
+
+		q := &api.QueryOptions{
+			Namespace:  cis.spec.Namespace,
+			Datacenter: cis.spec.Datacenter,
+		}
+		catalogServices, _, err := cis.client.Catalog().Service(service, "", q.WithContext(cis.ctx))
+		if err != nil {
+			logger.Errorf("%s pull catalog service %s failed: %v",
+				cis.superSpec.Name(), service, err)
+			return nil
+		}
+
+		var cidrs []string
+		for _, cs := range catalogServices {
+			ip := cs.ServiceAddress
+			if ip == "" {
+				ip = cs.Address
+			}
+			if net.ParseIP(ip) == nil {
+				logger.Warnf("%s skip non-ip address %s of service %s",
+					cis.superSpec.Name(), ip, service)
+				continue
+			}
+			cidrs = append(cidrs, ip)
+		}
+		cache[service] = cidrs
+
+		return cidrs
+	}
+}
+
+// translateIntentions translates intentions into ip filters of the
+// destination services. As Consul does, the intention with the higher
+// precedence wins for the same source, and the one from the wildcard
+// source decides the default.
+func translateIntentions(intentions []*api.Intention, services []string,
+	blockByDefault bool, cidrsOf func(service string) []string) map[string]*ipfilter.Spec {
+
+	sorted := make([]*api.Intention, len(intentions))
+	copy(sorted, intentions)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Precedence > sorted[j].Precedence
+	})
+
+	filters := make(map[string]*ipfilter.Spec)
+	for _, service := range services {
+		filter := &ipfilter.Spec{BlockByDefault: blockByDefault}
+		decided := make(map[string]struct{})
+		defaultDecided, targeted := false, false
+
+		for _, intention := range sorted {
+			if intention.DestinationName != service && intention.DestinationName != wildcard {
+				continue
+			}
+			if intention.SourceType != "" && intention.SourceType != api.IntentionSourceConsul {
+				continue
+			}
+			targeted = true
+
+			deny := intention.Action == api.IntentionActionDeny
+			if intention.SourceName == wildcard {
+				if !defaultDecided {
+					filter.BlockByDefault, defaultDecided = deny, true
+				}
+				continue
+			}
+
+			if _, exists := decided[intention.SourceName]; exists {
+				continue
+			}
+			decided[intention.SourceName] = struct{}{}
+
+			cidrs := cidrsOf(intention.SourceName)
+			if deny {
+				filter.BlockIPs = append(filter.BlockIPs, cidrs...)
+			} else {
+				filter.AllowIPs = append(filter.AllowIPs, cidrs...)
+			}
+		}
+
+		if !targeted {
+			continue
+		}
+
+		filter.AllowIPs = uniqueSorted(filter.AllowIPs)
+		filter.BlockIPs = uniqueSorted(filter.BlockIPs)
+		filters[service] = filter
+	}
+
+	return filters
+}
+
+// ipFilterEqual compares the ip filters in yaml, since the empty lists
+// are unmarshaled from the storage as non-nil ones.
+func ipFilterEqual(a, b *ipfilter.Spec) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	buffA, errA := yaml.Marshal(a)
+	buffB, errB := yaml.Marshal(b)
+
+	return errA == nil && errB == nil && string(buffA) == string(buffB)
+}
+
+func uniqueSorted(items []string) []string {
+	if len(items) == 0 {
+		return nil
+	}
+
+	set := make(map[string]struct{})
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		if _, exists := set[item]; exists {
+			continue
+		}
+		set[item] = struct{}{}
+		result = append(result, item)
+	}
+	sort.Strings(result)
+
+	return result
+}
+
+func (cis *ConsulIntentionSync) setHealth(health string) {
+	cis.statusMutex.Lock()
+	defer cis.statusMutex.Unlock()
+
+	status := *cis.status
+	status.Health = health
+	cis.status = &status
+}
+
+// Status returns status of ConsulIntentionSync.
+func (cis *ConsulIntentionSync) Status() *supervisor.Status {
+	cis.statusMutex.Lock()
+	status := cis.status
+	cis.statusMutex.Unlock()
+
+	return &supervisor.Status{
+		ObjectStatus: status,
+	}
+}
+
+// Close closes ConsulIntentionSync.
+func (cis *ConsulIntentionSync) Close() {
+	cis.cancel()
+	<-cis.done
+}
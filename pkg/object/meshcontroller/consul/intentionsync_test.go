@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package consul
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/util/ipfilter"
+
+	"github.com/hashicorp/consul/api"
+)
+
+func TestTranslateIntentions(t *testing.T) {
+	cidrs := map[string][]string{
+		"order":   {"10.0.1.0/24"},
+		"payment": {"10.0.2.0/24", "10.0.1.0/24"},
+		"crawler": {"10.0.9.9"},
+	}
+	cidrsOf := func(service string) []string {
+		return cidrs[service]
+	}
+
+	intentions := []*api.Intention{
+		{SourceName: "order", DestinationName: "delivery", Action: api.IntentionActionAllow, Precedence: 9},
+		{SourceName: "payment", DestinationName: "delivery", Action: api.IntentionActionAllow, Precedence: 9},
+		{SourceName: "crawler", DestinationName: "*", Action: api.IntentionActionDeny, Precedence: 6},
+		// NOTE: It's overridden by the one with the higher precedence.
+		{SourceName: "crawler", DestinationName: "delivery", Action: api.IntentionActionAllow, Precedence: 5},
+		{SourceName: "*", DestinationName: "catalog", Action: api.IntentionActionAllow, Precedence: 8},
+		{SourceName: "*", DestinationName: "*", Action: api.IntentionActionDeny, Precedence: 1},
+		{SourceName: "order", DestinationName: "unknown", Action: api.IntentionActionAllow, Precedence: 9},
+	}
+
+	got := translateIntentions(intentions, []string{"delivery", "catalog"}, false, cidrsOf)
+	want := map[string]*ipfilter.Spec{
+		"delivery": {
+			BlockByDefault: true,
+			AllowIPs:       []string{"10.0.1.0/24", "10.0.2.0/24"},
+			BlockIPs:       []string{"10.0.9.9"},
+		},
+		"catalog": {
+			BlockByDefault: false,
+			BlockIPs:       []string{"10.0.9.9"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %+v, got %+v", want, got)
+	}
+
+	got = translateIntentions(intentions[:2], []string{"delivery", "catalog"}, true, cidrsOf)
+	if _, exists := got["catalog"]; exists {
+		t.Errorf("want no filter for the service without intentions, got %+v", got["catalog"])
+	}
+	if filter := got["delivery"]; filter == nil || !filter.BlockByDefault {
+		t.Errorf("want blocking by default from the spec, got %+v", filter)
+	}
+}
+
+func TestIPFilterEqual(t *testing.T) {
+	a := &ipfilter.Spec{BlockByDefault: true}
+	b := &ipfilter.Spec{BlockByDefault: true, AllowIPs: []string{}}
+	if !ipFilterEqual(a, b) {
+		t.Errorf("want nil and empty lists equal")
+	}
+	if ipFilterEqual(a, nil) {
+		t.Errorf("want non-nil and nil filters unequal")
+	}
+}
@@ -58,6 +58,9 @@ const (
 
 	// ServiceCircuitBreaker is the path of service resilience's circuritBreaker part.
 	ServiceCircuitBreaker GJSONPath = "resilience.circuitBreaker"
+
+	// ServiceIPFilter is the path of service ip filter.
+	ServiceIPFilter GJSONPath = "ipFilter"
 )
 
 type (
@@ -46,20 +46,35 @@ func (m *Master) readIngressName(ctx iris.Context) (string, error) {
 }
 
 func (m *Master) listIngresses(ctx iris.Context) {
+	r := api.ReadPagination(ctx)
+	if r == nil {
+		return
+	}
+
 	specs := m.service.ListIngressSpecs()
 
 	sort.Sort(ingressesByOrder(specs))
-	var apiSpecs []*v1alpha1.Ingress
+
+	names := make([]string, 0, len(specs))
 	for _, v := range specs {
-		ingress := &v1alpha1.Ingress{}
-		err := m.convertSpecToPB(v, ingress)
-		if err != nil {
-			logger.Errorf("convert spec %#v to pb spec failed: %v", v, err)
-			continue
+		names = append(names, v.Name)
+	}
+
+	page := api.NewPage(r, names, func(start, end int) interface{} {
+		var apiSpecs []*v1alpha1.Ingress
+		for _, v := range specs[start:end] {
+			ingress := &v1alpha1.Ingress{}
+			err := m.convertSpecToPB(v, ingress)
+			if err != nil {
+				logger.Errorf("convert spec %#v to pb spec failed: %v", v, err)
+				continue
+			}
+			apiSpecs = append(apiSpecs, ingress)
 		}
-		apiSpecs = append(apiSpecs, ingress)
-	}
-	buff, err := json.Marshal(apiSpecs)
+		return apiSpecs
+	}, nil)
+
+	buff, err := json.Marshal(page)
 	if err != nil {
 		panic(fmt.Errorf("marshal %#v to json failed: %v", specs, err))
 	}
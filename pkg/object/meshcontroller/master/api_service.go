@@ -48,22 +48,35 @@ func (m *Master) readServiceName(ctx iris.Context) (string, error) {
 }
 
 func (m *Master) listServices(ctx iris.Context) {
+	r := api.ReadPagination(ctx)
+	if r == nil {
+		return
+	}
+
 	specs := m.service.ListServiceSpecs()
 
 	sort.Sort(servicesByOrder(specs))
 
-	var apiSpecs []*v1alpha1.Service
+	names := make([]string, 0, len(specs))
 	for _, v := range specs {
-		service := &v1alpha1.Service{}
-		err := m.convertSpecToPB(v, service)
-		if err != nil {
-			logger.Errorf("convert spec %#v to pb spec failed: %v", v, err)
-			continue
-		}
-		apiSpecs = append(apiSpecs, service)
+		names = append(names, v.Name)
 	}
 
-	buff, err := json.Marshal(apiSpecs)
+	page := api.NewPage(r, names, func(start, end int) interface{} {
+		var apiSpecs []*v1alpha1.Service
+		for _, v := range specs[start:end] {
+			service := &v1alpha1.Service{}
+			err := m.convertSpecToPB(v, service)
+			if err != nil {
+				logger.Errorf("convert spec %#v to pb spec failed: %v", v, err)
+				continue
+			}
+			apiSpecs = append(apiSpecs, service)
+		}
+		return apiSpecs
+	}, nil)
+
+	buff, err := json.Marshal(page)
 	if err != nil {
 		panic(fmt.Errorf("marshal %#v to json failed: %v", specs, err))
 	}
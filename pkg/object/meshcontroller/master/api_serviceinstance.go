@@ -32,11 +32,17 @@ import (
 type serviceInstancesByOrder []*spec.ServiceInstanceSpec
 
 func (s serviceInstancesByOrder) Less(i, j int) bool {
-	return s[i].ServiceName < s[j].ServiceName || s[i].InstanceID < s[j].InstanceID
+	return serviceInstanceName(s[i]) < serviceInstanceName(s[j])
 }
 func (s serviceInstancesByOrder) Len() int      { return len(s) }
 func (s serviceInstancesByOrder) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
 
+// serviceInstanceName is the name of the instance in the cursor of the
+// paginated listing.
+func serviceInstanceName(instance *spec.ServiceInstanceSpec) string {
+	return instance.ServiceName + "/" + instance.InstanceID
+}
+
 func (m *Master) readServiceInstanceInfo(ctx iris.Context) (string, string, error) {
 	serviceName := ctx.Params().Get("serviceName")
 	if serviceName == "" {
@@ -52,11 +58,25 @@ func (m *Master) readServiceInstanceInfo(ctx iris.Context) (string, string, erro
 }
 
 func (m *Master) listServiceInstanceSpecs(ctx iris.Context) {
+	r := api.ReadPagination(ctx)
+	if r == nil {
+		return
+	}
+
 	specs := m.service.ListAllServiceInstanceSpecs()
 
 	sort.Sort(serviceInstancesByOrder(specs))
 
-	buff, err := yaml.Marshal(specs)
+	names := make([]string, 0, len(specs))
+	for _, v := range specs {
+		names = append(names, serviceInstanceName(v))
+	}
+
+	page := api.NewPage(r, names, func(start, end int) interface{} {
+		return specs[start:end]
+	}, nil)
+
+	buff, err := yaml.Marshal(page)
 	if err != nil {
 		panic(fmt.Errorf("marshal %#v to yaml failed: %v", specs, err))
 	}
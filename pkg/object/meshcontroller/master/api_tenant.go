@@ -47,22 +47,35 @@ func (m *Master) readTenantName(ctx iris.Context) (string, error) {
 }
 
 func (m *Master) listTenants(ctx iris.Context) {
+	r := api.ReadPagination(ctx)
+	if r == nil {
+		return
+	}
+
 	specs := m.service.ListTenantSpecs()
 
 	sort.Sort(tenantsByOrder(specs))
 
-	var apiSpecs []*v1alpha1.Tenant
+	names := make([]string, 0, len(specs))
 	for _, v := range specs {
-		tenant := &v1alpha1.Tenant{}
-		err := m.convertSpecToPB(v, &tenant)
-		if err != nil {
-			logger.Errorf("convert spec %#v to pb spec failed: %v", v, err)
-			continue
+		names = append(names, v.Name)
+	}
+
+	page := api.NewPage(r, names, func(start, end int) interface{} {
+		var apiSpecs []*v1alpha1.Tenant
+		for _, v := range specs[start:end] {
+			tenant := &v1alpha1.Tenant{}
+			err := m.convertSpecToPB(v, &tenant)
+			if err != nil {
+				logger.Errorf("convert spec %#v to pb spec failed: %v", v, err)
+				continue
+			}
+			apiSpecs = append(apiSpecs, tenant)
 		}
-		apiSpecs = append(apiSpecs, tenant)
-	}
+		return apiSpecs
+	}, nil)
 
-	buff, err := json.Marshal(apiSpecs)
+	buff, err := json.Marshal(page)
 	if err != nil {
 		panic(fmt.Errorf("marshal %#v to json failed: %v", specs, err))
 	}
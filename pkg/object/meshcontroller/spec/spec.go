@@ -30,8 +30,11 @@ import (
 	"github.com/megaease/easegress/pkg/object/httppipeline"
 	"github.com/megaease/easegress/pkg/supervisor"
 	"github.com/megaease/easegress/pkg/util/httpfilter"
+	"github.com/megaease/easegress/pkg/util/ipfilter"
 	"github.com/megaease/easegress/pkg/util/urlrule"
 
+	yamljsontool "github.com/ghodss/yaml"
+	loadjs "github.com/xeipuuv/gojsonschema"
 	"gopkg.in/yaml.v2"
 )
 
@@ -89,6 +92,38 @@ type (
 
 		// IngressPort is the port for http server in mesh ingress
 		IngressPort int `yaml:"ingressPort" jsonschema:"omitempty"`
+
+		// APISchemas are the schemas of requests/responses of worker's API server.
+		APISchemas []*APISchema `yaml:"apiSchemas" jsonschema:"omitempty"`
+
+		// MaxBufferedBodyBytes is the memory budget of bodies buffered by
+		// all in-flight requests of worker's API server, 0 means unlimited.
+		// Requests needing buffering get 503 when it's exceeded, while
+		// responses are streamed without validation.
+		MaxBufferedBodyBytes int64 `yaml:"maxBufferedBodyBytes" jsonschema:"omitempty,minimum=0"`
+
+		// AllowedUserAgentPrefixes is the allowlist of User-Agent prefixes
+		// of worker's API server, requests not matching any get 403.
+		// It's disabled if empty, and the liveness checks HEAD / and HEAD /apis are exempt.
+		AllowedUserAgentPrefixes []string `yaml:"allowedUserAgentPrefixes" jsonschema:"omitempty,uniqueItems=true"`
+
+		// AllowedHosts is the allowlist of Host headers of worker's API
+		// server against DNS rebinding, requests not matching any get 400.
+		// The one without port allows any port, it's disabled if empty.
+		AllowedHosts []string `yaml:"allowedHosts" jsonschema:"omitempty,uniqueItems=true"`
+
+		// DebugToken is the bearer token of debug APIs of worker's API
+		// server, such as the self-test, they're disabled if empty.
+		DebugToken string `yaml:"debugToken" jsonschema:"omitempty"`
+	}
+
+	// APISchema is the JSON schemas in json/yaml format of one route,
+	// the empty one means no validation.
+	APISchema struct {
+		Path           string `yaml:"path" jsonschema:"required"`
+		Method         string `yaml:"method" jsonschema:"required"`
+		RequestSchema  string `yaml:"requestSchema" jsonschema:"omitempty"`
+		ResponseSchema string `yaml:"responseSchema" jsonschema:"omitempty"`
 	}
 
 	// Service contains the information of service.
@@ -96,11 +131,26 @@ type (
 		Name           string `yaml:"name" jsonschema:"required"`
 		RegisterTenant string `yaml:"registerTenant" jsonschema:"required"`
 
-		Resilience    *Resilience    `yaml:"resilience" jsonschema:"omitempty"`
-		Canary        *Canary        `yaml:"canary" jsonschema:"omitempty"`
-		LoadBalance   *LoadBalance   `yaml:"loadBalance" jsonschema:"omitempty"`
-		Sidecar       *Sidecar       `yaml:"sidecar" jsonschema:"omitempty"`
-		Observability *Observability `yaml:"observability" jsonschema:"omitempty"`
+		Resilience        *Resilience        `yaml:"resilience" jsonschema:"omitempty"`
+		Canary            *Canary            `yaml:"canary" jsonschema:"omitempty"`
+		LoadBalance       *LoadBalance       `yaml:"loadBalance" jsonschema:"omitempty"`
+		Sidecar           *Sidecar           `yaml:"sidecar" jsonschema:"omitempty"`
+		Observability     *Observability     `yaml:"observability" jsonschema:"omitempty"`
+		HeaderPropagation *HeaderPropagation `yaml:"headerPropagation" jsonschema:"omitempty"`
+
+		// IPFilter filters the ingress traffic of the service by the client IP,
+		// it's maintained by ConsulIntentionSync if intentions are synchronized.
+		IPFilter *ipfilter.Spec `yaml:"ipFilter,omitempty" jsonschema:"omitempty"`
+	}
+
+	// HeaderPropagation is the spec of headers propagated from inbound
+	// requests to outbound requests, such as B3/W3C/Jaeger trace headers.
+	// A header pattern ending with '*' matches all headers with that prefix,
+	// e.g. x-b3-*. The ingress strips them from the requests to the service,
+	// and the egress sets them into the outbound calls carrying the same
+	// X-Request-Id as the inbound request being served.
+	HeaderPropagation struct {
+		Headers []string `yaml:"headers" jsonschema:"required,minItems=1,uniqueItems=true"`
 	}
 
 	// Resilience is the spec of service resilience.
@@ -275,9 +325,45 @@ func (a Admin) Validate() error {
 		return fmt.Errorf("unsupported registry center type: %s", a.RegistryType)
 	}
 
+	for _, as := range a.APISchemas {
+		_, _, err := as.Compile()
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// Compile compiles the request and response schemas,
+// the empty one is compiled to nil.
+func (as *APISchema) Compile() (request, response *loadjs.Schema, err error) {
+	request, err = newJSONSchema(as.RequestSchema)
+	if err != nil {
+		return nil, nil, fmt.Errorf("compile request schema of %s %s failed: %v", as.Method, as.Path, err)
+	}
+
+	response, err = newJSONSchema(as.ResponseSchema)
+	if err != nil {
+		return nil, nil, fmt.Errorf("compile response schema of %s %s failed: %v", as.Method, as.Path, err)
+	}
+
+	return request, response, nil
+}
+
+func newJSONSchema(schema string) (*loadjs.Schema, error) {
+	if schema == "" {
+		return nil, nil
+	}
+
+	jsonBuff, err := yamljsontool.YAMLToJSON([]byte(schema))
+	if err != nil {
+		return nil, fmt.Errorf("transform %s to json failed: %v", schema, err)
+	}
+
+	return loadjs.NewSchema(loadjs.NewBytesLoader(jsonBuff))
+}
+
 func newPipelineSpecBuilder(name string) *pipelineSpecBuilder {
 	return &pipelineSpecBuilder{
 		Kind: httppipeline.Kind,
@@ -537,6 +623,14 @@ rules:
 	pipelineName := fmt.Sprintf("mesh-ingress-pipeline-%s", s.Name)
 	yamlConfig := fmt.Sprintf(ingressHTTPServerFormat, name, s.Sidecar.IngressPort, pipelineName)
 
+	if s.IPFilter != nil {
+		buff, err := yaml.Marshal(map[string]interface{}{"ipFilter": s.IPFilter})
+		if err != nil {
+			return nil, fmt.Errorf("marshal ip filter %#v to yaml failed: %v", s.IPFilter, err)
+		}
+		yamlConfig += "\n" + string(buff)
+	}
+
 	superSpec, err := supervisor.NewSpec(yamlConfig)
 	if err != nil {
 		logger.Errorf("new spec for %s failed: %v", yamlConfig, err)
@@ -546,3 +546,28 @@ func TestSideCarEgressResiliencePipelineSpec(t *testing.T) {
 	superSpec, _ := s.SideCarEgressPipelineSpec(instanceSpecs)
 	fmt.Println(superSpec.YAMLConfig())
 }
+
+func TestAdminValidateAPISchemas(t *testing.T) {
+	a := Admin{
+		RegistryType: RegistryTypeEureka,
+		APISchemas: []*APISchema{
+			{
+				Path:          "/apps",
+				Method:        "POST",
+				RequestSchema: "type: object\nrequired: [name]",
+			},
+		},
+	}
+	if err := a.Validate(); err != nil {
+		t.Fatalf("want valid schemas, got %v", err)
+	}
+
+	a.APISchemas = append(a.APISchemas, &APISchema{
+		Path:           "/apps",
+		Method:         "GET",
+		ResponseSchema: "type: 1",
+	})
+	if err := a.Validate(); err == nil {
+		t.Errorf("want error for invalid response schema")
+	}
+}
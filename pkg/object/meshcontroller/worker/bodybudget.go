@@ -0,0 +1,102 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+var errBodyBudgetExceeded = fmt.Errorf("body buffering budget exceeded")
+
+type (
+	// bodyBudget limits the bytes of bodies buffered in memory
+	// by all in-flight requests, zero max means unlimited.
+	bodyBudget struct {
+		max  int64
+		used int64
+	}
+
+	// budgetReader reserves the budget for the bytes read,
+	// the caller must release the reserved bytes after using them.
+	budgetReader struct {
+		r        io.Reader
+		budget   *bodyBudget
+		reserved int64
+	}
+)
+
+func (b *bodyBudget) setMax(max int64) {
+	atomic.StoreInt64(&b.max, max)
+}
+
+// reserve reserves n bytes, it returns false if exceeding the max.
+func (b *bodyBudget) reserve(n int64) bool {
+	max := atomic.LoadInt64(&b.max)
+	if max <= 0 {
+		b.charge(n)
+		return true
+	}
+
+	for {
+		used := atomic.LoadInt64(&b.used)
+		if used+n > max {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&b.used, used, used+n) {
+			return true
+		}
+	}
+}
+
+// charge accounts n bytes already buffered regardless of the max.
+func (b *bodyBudget) charge(n int64) {
+	atomic.AddInt64(&b.used, n)
+}
+
+func (b *bodyBudget) release(n int64) {
+	atomic.AddInt64(&b.used, -n)
+}
+
+// exhausted reports whether there is no budget left.
+func (b *bodyBudget) exhausted() bool {
+	max := atomic.LoadInt64(&b.max)
+	return max > 0 && atomic.LoadInt64(&b.used) >= max
+}
+
+func (b *bodyBudget) newReader(r io.Reader) *budgetReader {
+	return &budgetReader{r: r, budget: b}
+}
+
+func (br *budgetReader) Read(p []byte) (int, error) {
+	n, err := br.r.Read(p)
+	if n > 0 {
+		if !br.budget.reserve(int64(n)) {
+			return 0, errBodyBudgetExceeded
+		}
+		br.reserved += int64(n)
+	}
+
+	return n, err
+}
+
+func (br *budgetReader) release() {
+	br.budget.release(br.reserved)
+	br.reserved = 0
+}
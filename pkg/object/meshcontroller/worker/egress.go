@@ -45,19 +45,25 @@ type (
 		service     *service.Service
 		mutex       sync.RWMutex
 		watch       chan<- string
+
+		// propagator is nil if the service has no HeaderPropagation policy.
+		propagator   *headerPropagator
+		propagations *propagationStore
 	}
 )
 
 // NewEgressServer creates a initialized egress server
 func NewEgressServer(superSpec *supervisor.Spec, super *supervisor.Supervisor,
-	serviceName string, service *service.Service, watch chan<- string) *EgressServer {
+	serviceName string, service *service.Service, watch chan<- string,
+	propagations *propagationStore) *EgressServer {
 
 	return &EgressServer{
-		pipelines:   make(map[string]*httppipeline.HTTPPipeline),
-		serviceName: serviceName,
-		service:     service,
-		super:       super,
-		watch:       watch,
+		pipelines:    make(map[string]*httppipeline.HTTPPipeline),
+		serviceName:  serviceName,
+		service:      service,
+		super:        super,
+		watch:        watch,
+		propagations: propagations,
 	}
 }
 
@@ -78,6 +84,8 @@ func (egs *EgressServer) CreateEgress(service *spec.Service) error {
 		return nil
 	}
 
+	egs.propagator = newHeaderPropagator(service.Name, service.HeaderPropagation, egs.propagations)
+
 	superSpec, err := service.SideCarEgressHTTPServerSpec()
 	if err != nil {
 		return err
@@ -195,6 +203,14 @@ func (egs *EgressServer) Handle(ctx context.HTTPContext) {
 		}
 		return
 	}
+
+	egs.mutex.RLock()
+	propagator := egs.propagator
+	egs.mutex.RUnlock()
+	if propagator != nil {
+		propagator.outbound(ctx)
+	}
+
 	pipeline.Handle(ctx)
 	logger.Infof("hanlde service name:%s finished, status code: %d", serviceName, ctx.Response().StatusCode())
 }
@@ -0,0 +1,207 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/megaease/easegress/pkg/common"
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/meshcontroller/spec"
+	"github.com/megaease/easegress/pkg/protocol"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+)
+
+// requestIDHeader correlates the outbound calls of the service
+// with the inbound request being served.
+const requestIDHeader = "X-Request-Id"
+
+type (
+	// headerPropagator propagates the headers matching the HeaderPropagation
+	// policy of the service, such as B3/W3C/Jaeger trace headers.
+	headerPropagator struct {
+		serviceName string
+		// names are the canonical header names without wildcard.
+		names []string
+		// prefixes are the canonical prefixes of the wildcard patterns.
+		prefixes []string
+
+		store *propagationStore
+	}
+
+	// propagationStore holds the headers captured from the inbound
+	// requests in flight, keyed by their request ids. It's shared by
+	// the ingress and the egress of the worker.
+	propagationStore struct {
+		mutex   sync.Mutex
+		headers map[string]http.Header
+	}
+
+	// propagationHandler wraps the ingress handler to capture
+	// the headers before handing the request over to it.
+	propagationHandler struct {
+		handler    protocol.HTTPHandler
+		propagator *headerPropagator
+	}
+)
+
+func newPropagationStore() *propagationStore {
+	return &propagationStore{headers: make(map[string]http.Header)}
+}
+
+// put stores the headers, it returns false if the id is in use.
+func (ps *propagationStore) put(id string, h http.Header) bool {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	if _, exists := ps.headers[id]; exists {
+		return false
+	}
+	ps.headers[id] = h
+	return true
+}
+
+func (ps *propagationStore) get(id string) http.Header {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	return ps.headers[id]
+}
+
+func (ps *propagationStore) delete(id string) {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	delete(ps.headers, id)
+}
+
+func newHeaderPropagator(serviceName string, hp *spec.HeaderPropagation,
+	store *propagationStore) *headerPropagator {
+
+	if hp == nil || len(hp.Headers) == 0 {
+		return nil
+	}
+
+	p := &headerPropagator{serviceName: serviceName, store: store}
+	for _, pattern := range hp.Headers {
+		if strings.HasSuffix(pattern, "*") {
+			prefix := http.CanonicalHeaderKey(strings.TrimSuffix(pattern, "*"))
+			p.prefixes = append(p.prefixes, prefix)
+			continue
+		}
+		p.names = append(p.names, http.CanonicalHeaderKey(pattern))
+	}
+
+	return p
+}
+
+func (p *headerPropagator) match(key string) bool {
+	key = http.CanonicalHeaderKey(key)
+	for _, name := range p.names {
+		if key == name {
+			return true
+		}
+	}
+	for _, prefix := range p.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// capture strips all headers matching the policy from h, and returns
+// the first value of each of them. Extra values supplied by the client
+// are dropped, so they can't be injected into the propagation.
+func (p *headerPropagator) capture(h *httpheader.HTTPHeader) http.Header {
+	captured := http.Header{}
+	h.VisitAll(func(key, value string) {
+		if p.match(key) && captured.Get(key) == "" {
+			captured.Set(key, value)
+		}
+	})
+
+	for key := range captured {
+		h.Del(key)
+	}
+
+	return captured
+}
+
+// warnAbsent logs a warning for every header without wildcard
+// which is absent in the captured headers.
+func (p *headerPropagator) warnAbsent(ctx context.HTTPContext, captured http.Header) {
+	for _, name := range p.names {
+		if captured.Get(name) == "" {
+			logger.Warnf("service %s: propagation header %s is absent in inbound request %s %s",
+				p.serviceName, name, ctx.Request().Method(), ctx.Request().Path())
+		}
+	}
+}
+
+// inbound strips the headers matching the policy from the inbound request,
+// so the client can't inject them into the service. The captured ones are
+// kept until the request finishes, for the outbound calls of the service
+// carrying the same request id, which is set into the request.
+func (p *headerPropagator) inbound(ctx context.HTTPContext) {
+	h := ctx.Request().Header()
+	captured := p.capture(h)
+	p.warnAbsent(ctx, captured)
+
+	id := captured.Get(requestIDHeader)
+	if id == "" {
+		id = h.Get(requestIDHeader)
+	}
+	// NOTE: A new id is used if the client reuses the one in flight,
+	// so it can't take over the headers of another request.
+	if id == "" || !p.store.put(id, captured) {
+		var err error
+		id, err = common.UUID()
+		if err != nil {
+			logger.Errorf("service %s: generate request id failed: %v", p.serviceName, err)
+			return
+		}
+		p.store.put(id, captured)
+	}
+	h.Set(requestIDHeader, id)
+
+	ctx.OnFinish(func() {
+		p.store.delete(id)
+	})
+}
+
+// outbound sets the headers captured from the inbound request with the
+// same request id into the outbound request, which override the ones
+// supplied by the service. The outbound request is left untouched if
+// it isn't made on behalf of any inbound request.
+func (p *headerPropagator) outbound(ctx context.HTTPContext) {
+	h := ctx.Request().Header()
+	captured := p.store.get(h.Get(requestIDHeader))
+	for key, values := range captured {
+		h.Set(key, values[0])
+	}
+}
+
+// Handle captures the headers and hands over the request to the wrapped handler.
+func (ph *propagationHandler) Handle(ctx context.HTTPContext) {
+	ph.propagator.inbound(ctx)
+	ph.handler.Handle(ctx)
+}
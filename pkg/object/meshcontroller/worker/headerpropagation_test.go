@@ -0,0 +1,150 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package worker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/object/meshcontroller/spec"
+	"github.com/megaease/easegress/pkg/tracing"
+)
+
+type testHTTPHandler func(ctx context.HTTPContext)
+
+func (h testHTTPHandler) Handle(ctx context.HTTPContext) {
+	h(ctx)
+}
+
+func newPropagationTestContext(header http.Header) context.HTTPContext {
+	req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	for key, values := range header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	return context.New(httptest.NewRecorder(), req, tracing.NoopTracing, "no trace")
+}
+
+func TestHeaderPropagation(t *testing.T) {
+	store := newPropagationStore()
+	hp := &spec.HeaderPropagation{Headers: []string{"x-b3-*", "traceparent"}}
+	ingress := newHeaderPropagator("order", hp, store)
+	egress := newHeaderPropagator("order", hp, store)
+
+	// NOTE: The service makes an outbound call while serving the inbound
+	// request, which carries the request id only.
+	var outbound http.Header
+	handler := &propagationHandler{
+		propagator: ingress,
+		handler: testHTTPHandler(func(ctx context.HTTPContext) {
+			h := ctx.Request().Header()
+			for _, key := range []string{"X-B3-Traceid", "X-B3-Spanid", "Traceparent"} {
+				if v := h.Get(key); v != "" {
+					t.Errorf("want %s stripped from the request to service, got %s", key, v)
+				}
+			}
+			id := h.Get(requestIDHeader)
+			if id == "" {
+				t.Fatalf("want request id set")
+			}
+
+			outCtx := newPropagationTestContext(http.Header{
+				requestIDHeader: {id},
+				"Traceparent":   {"service-supplied"},
+				"X-Custom":      {"kept"},
+			})
+			egress.outbound(outCtx)
+			outbound = outCtx.Request().Header().Std()
+		}),
+	}
+
+	inCtx := newPropagationTestContext(http.Header{
+		"X-B3-Traceid": {"trace-1", "injected"},
+		"X-B3-Spanid":  {"span-1"},
+		"Traceparent":  {"00-trace-1-span-1-01"},
+	})
+	handler.Handle(inCtx)
+
+	for key, want := range map[string]string{
+		"X-B3-Traceid": "trace-1",
+		"X-B3-Spanid":  "span-1",
+		"Traceparent":  "00-trace-1-span-1-01",
+		"X-Custom":     "kept",
+	} {
+		if got := outbound[key]; len(got) != 1 || got[0] != want {
+			t.Errorf("outbound %s: want [%s], got %v", key, want, got)
+		}
+	}
+
+	inCtx.Finish()
+	if n := len(store.headers); n != 0 {
+		t.Errorf("want captured headers released after the inbound request, got %d", n)
+	}
+}
+
+func TestHeaderPropagationWithoutInbound(t *testing.T) {
+	store := newPropagationStore()
+	egress := newHeaderPropagator("order",
+		&spec.HeaderPropagation{Headers: []string{"traceparent"}}, store)
+
+	ctx := newPropagationTestContext(http.Header{
+		requestIDHeader: {"unknown"},
+		"Traceparent":   {"service-supplied"},
+	})
+	egress.outbound(ctx)
+	if got := ctx.Request().Header().Get("Traceparent"); got != "service-supplied" {
+		t.Errorf("want service-supplied header kept, got %s", got)
+	}
+}
+
+func TestHeaderPropagationRequestIDReused(t *testing.T) {
+	store := newPropagationStore()
+	ingress := newHeaderPropagator("order",
+		&spec.HeaderPropagation{Headers: []string{"traceparent"}}, store)
+
+	first := newPropagationTestContext(http.Header{
+		requestIDHeader: {"req-1"},
+		"Traceparent":   {"first"},
+	})
+	ingress.inbound(first)
+	if id := first.Request().Header().Get(requestIDHeader); id != "req-1" {
+		t.Fatalf("want request id req-1 kept, got %s", id)
+	}
+
+	// NOTE: The client can't take over the headers of the request in flight.
+	second := newPropagationTestContext(http.Header{
+		requestIDHeader: {"req-1"},
+		"Traceparent":   {"second"},
+	})
+	ingress.inbound(second)
+	id := second.Request().Header().Get(requestIDHeader)
+	if id == "req-1" || id == "" {
+		t.Fatalf("want a new request id, got %q", id)
+	}
+	if got := store.get("req-1").Get("Traceparent"); got != "first" {
+		t.Errorf("want headers of req-1 untouched, got %s", got)
+	}
+	if got := store.get(id).Get("Traceparent"); got != "second" {
+		t.Errorf("want headers of %s captured, got %s", id, got)
+	}
+
+	first.Finish()
+	second.Finish()
+}
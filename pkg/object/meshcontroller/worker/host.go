@@ -0,0 +1,64 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	iriscontext "github.com/kataras/iris/context"
+)
+
+// setAllowedHosts sets the allowlist of Host headers against DNS rebinding,
+// the entry without port allows any port. The empty one means all Hosts
+// are allowed.
+func (s *apiServer) setAllowedHosts(hosts []string) {
+	allowed := make(map[string]struct{}, len(hosts))
+	for _, host := range hosts {
+		allowed[strings.ToLower(host)] = struct{}{}
+	}
+	s.allowedHosts.Store(allowed)
+}
+
+func (s *apiServer) newHostChecker() func(iriscontext.Context) {
+	return func(ctx iriscontext.Context) {
+		allowed, _ := s.allowedHosts.Load().(map[string]struct{})
+		if len(allowed) == 0 {
+			ctx.Next()
+			return
+		}
+
+		host := strings.ToLower(ctx.Request().Host)
+		if _, exists := allowed[host]; exists && host != "" {
+			ctx.Next()
+			return
+		}
+
+		if hostname, _, err := net.SplitHostPort(host); err == nil {
+			if _, exists := allowed[hostname]; exists {
+				ctx.Next()
+				return
+			}
+		}
+
+		handleAPIError(ctx, http.StatusBadRequest,
+			fmt.Errorf("host %q is not allowed", host))
+	}
+}
@@ -48,17 +48,24 @@ type (
 		// in mesh and hand over to local Java business process
 		pipelines  map[string]*httppipeline.HTTPPipeline
 		httpServer *httpserver.HTTPServer
+
+		// propagator is nil if the service has no HeaderPropagation policy.
+		propagator   *headerPropagator
+		propagations *propagationStore
 	}
 )
 
 // NewIngressServer creates a initialized ingress server
-func NewIngressServer(super *supervisor.Supervisor, serviceName string) *IngressServer {
+func NewIngressServer(super *supervisor.Supervisor, serviceName string,
+	propagations *propagationStore) *IngressServer {
+
 	return &IngressServer{
-		super:       super,
-		pipelines:   make(map[string]*httppipeline.HTTPPipeline),
-		httpServer:  nil,
-		serviceName: serviceName,
-		mutex:       sync.RWMutex{},
+		super:        super,
+		pipelines:    make(map[string]*httppipeline.HTTPPipeline),
+		httpServer:   nil,
+		serviceName:  serviceName,
+		mutex:        sync.RWMutex{},
+		propagations: propagations,
 	}
 }
 
@@ -68,7 +75,18 @@ func (ings *IngressServer) Get(name string) (protocol.HTTPHandler, bool) {
 	defer ings.mutex.RUnlock()
 
 	p, ok := ings.pipelines[name]
-	return p, ok
+	if !ok {
+		return nil, false
+	}
+
+	if ings.propagator != nil {
+		return &propagationHandler{
+			handler:    p,
+			propagator: ings.propagator,
+		}, true
+	}
+
+	return p, true
 }
 
 // Ready checks ingress's pipeline and HTTPServer are created or not
@@ -90,6 +108,8 @@ func (ings *IngressServer) CreateIngress(service *spec.Service, port uint32) err
 	ings.mutex.Lock()
 	defer ings.mutex.Unlock()
 
+	ings.propagator = newHeaderPropagator(service.Name, service.HeaderPropagation, ings.propagations)
+
 	if _, ok := ings.pipelines[service.IngressPipelineName()]; !ok {
 		superSpec, err := service.SideCarIngressPipelineSpec(port)
 		if err != nil {
@@ -143,6 +163,29 @@ func (ings *IngressServer) UpdatePipeline(newSpec string) error {
 	return err
 }
 
+// UpdateHTTPServer accepts the new service spec, and uses it to update
+// ingress's HTTPServer with inheritance, such as for its ip filter.
+func (ings *IngressServer) UpdateHTTPServer(service *spec.Service) error {
+	ings.mutex.Lock()
+	defer ings.mutex.Unlock()
+
+	if ings.httpServer == nil {
+		return fmt.Errorf("can't find service: %s's ingress http server", ings.serviceName)
+	}
+
+	superSpec, err := service.SideCarIngressHTTPServerSpec()
+	if err != nil {
+		return err
+	}
+
+	// NOTE: The mux mapper is kept in the inherited runtime.
+	var newHTTPServer httpserver.HTTPServer
+	newHTTPServer.Inherit(superSpec, ings.httpServer, ings.super)
+	ings.httpServer = &newHTTPServer
+
+	return nil
+}
+
 // Close closes the Ingress HTTPServer and Pipeline
 func (ings *IngressServer) Close() {
 	ings.mutex.Lock()
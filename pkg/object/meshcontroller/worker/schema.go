@@ -0,0 +1,157 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/meshcontroller/spec"
+
+	yamljsontool "github.com/ghodss/yaml"
+	iriscontext "github.com/kataras/iris/context"
+	loadjs "github.com/xeipuuv/gojsonschema"
+)
+
+type (
+	routeSchema struct {
+		request  *loadjs.Schema
+		response *loadjs.Schema
+	}
+)
+
+func routeKey(method, path string) string {
+	return method + " " + path
+}
+
+func validateJSON(schema *loadjs.Schema, body []byte) error {
+	// NOTE: YAMLToJSON accepts json too.
+	jsonBuff, err := yamljsontool.YAMLToJSON(body)
+	if err != nil {
+		return fmt.Errorf("transform body to json failed: %v", err)
+	}
+
+	result, err := schema.Validate(loadjs.NewBytesLoader(jsonBuff))
+	if err != nil {
+		return err
+	}
+
+	if !result.Valid() {
+		errs := make([]string, 0, len(result.Errors()))
+		for _, e := range result.Errors() {
+			errs = append(errs, e.String())
+		}
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// reloadSchemas compiles the schemas declared in the spec,
+// and replaces the old ones as a whole.
+func (s *apiServer) reloadSchemas(apiSchemas []*spec.APISchema) error {
+	schemas := make(map[string]*routeSchema)
+	for _, as := range apiSchemas {
+		request, response, err := as.Compile()
+		if err != nil {
+			return err
+		}
+
+		schemas[routeKey(as.Method, as.Path)] = &routeSchema{
+			request:  request,
+			response: response,
+		}
+	}
+
+	s.schemas.Store(schemas)
+
+	return nil
+}
+
+func (s *apiServer) newSchemaValidator() func(iriscontext.Context) {
+	return func(ctx iriscontext.Context) {
+		route := ctx.GetCurrentRoute()
+		if route == nil {
+			ctx.Next()
+			return
+		}
+
+		schemas := s.schemas.Load().(map[string]*routeSchema)
+		rs, exists := schemas[routeKey(route.Method(), route.Path())]
+		if !exists {
+			ctx.Next()
+			return
+		}
+
+		if rs.request != nil {
+			br := s.bodyBudget.newReader(ctx.Request().Body)
+			defer br.release()
+			body, err := ioutil.ReadAll(br)
+			if err == errBodyBudgetExceeded {
+				handleAPIError(ctx, http.StatusServiceUnavailable, err)
+				return
+			}
+			if err != nil {
+				handleAPIError(ctx, http.StatusBadRequest, fmt.Errorf("read body failed: %v", err))
+				return
+			}
+			ctx.Request().Body = ioutil.NopCloser(bytes.NewReader(body))
+
+			err = validateJSON(rs.request, body)
+			if err != nil {
+				handleAPIError(ctx, http.StatusBadRequest, fmt.Errorf("invalid request: %v", err))
+				return
+			}
+		}
+
+		if rs.response == nil {
+			ctx.Next()
+			return
+		}
+
+		// NOTE: Fall back to streaming without validation,
+		// since the size of the response is unknown in advance.
+		if s.bodyBudget.exhausted() {
+			logger.Warnf("skip validating response of %s %s: %v",
+				route.Method(), route.Path(), errBodyBudgetExceeded)
+			ctx.Next()
+			return
+		}
+
+		ctx.Record()
+		ctx.Next()
+
+		recorder, ok := ctx.IsRecording()
+		if !ok {
+			return
+		}
+		respSize := int64(len(recorder.Body()))
+		s.bodyBudget.charge(respSize)
+		defer s.bodyBudget.release(respSize)
+		err := validateJSON(rs.response, recorder.Body())
+		if err != nil {
+			logger.Errorf("invalid response of %s %s: %v", route.Method(), route.Path(), err)
+			recorder.ResetBody()
+			handleAPIError(ctx, http.StatusInternalServerError, fmt.Errorf("invalid response: %v", err))
+		}
+	}
+}
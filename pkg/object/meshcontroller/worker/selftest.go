@@ -0,0 +1,154 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/kataras/iris"
+	iriscontext "github.com/kataras/iris/context"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	debugPrefix = "/debug"
+	// selfTestPath is the path of the self-test of GET routes.
+	selfTestPath = debugPrefix + "/selftest"
+
+	// selfTestRouteTimeout bounds each internal request of the self-test.
+	selfTestRouteTimeout = 5 * time.Second
+
+	selfTestStatusOK      = "ok"
+	selfTestStatusFailed  = "failed"
+	selfTestStatusSkipped = "skipped"
+)
+
+type (
+	// SelfTestReport is the summary of the self-test.
+	SelfTestReport struct {
+		OK     bool             `yaml:"ok"`
+		Routes []*SelfTestRoute `yaml:"routes"`
+	}
+
+	// SelfTestRoute is the self-test result of a route.
+	SelfTestRoute struct {
+		Path       string `yaml:"path"`
+		Status     string `yaml:"status"`
+		StatusCode int    `yaml:"statusCode,omitempty"`
+		Duration   string `yaml:"duration,omitempty"`
+	}
+)
+
+// setDebugToken sets the bearer token of debug APIs,
+// the empty one disables them.
+func (s *apiServer) setDebugToken(token string) {
+	s.debugToken.Store(token)
+}
+
+func (s *apiServer) addDebugAPIs() {
+	debugAPIs := []*apiEntry{
+		{
+			Path:    selfTestPath,
+			Method:  "POST",
+			Handler: s.debugAuth(s.selfTest),
+		},
+	}
+
+	s.registerAPIs(debugAPIs)
+}
+
+// debugAuth wraps the handler of debug APIs to check the bearer token,
+// all debug APIs are disabled if there is no token configured.
+func (s *apiServer) debugAuth(handler iris.Handler) iris.Handler {
+	return func(ctx iris.Context) {
+		debugToken, _ := s.debugToken.Load().(string)
+		if debugToken == "" {
+			handleAPIError(ctx, http.StatusForbidden, fmt.Errorf("debug apis are disabled"))
+			return
+		}
+
+		token := strings.TrimPrefix(ctx.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(debugToken)) != 1 {
+			handleAPIError(ctx, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+			return
+		}
+
+		handler(ctx)
+	}
+}
+
+// selfTest issues internal requests to all registered GET routes through
+// the whole handler chain without network, the routes with parameters
+// are skipped. A route fails if it responds with 5xx.
+func (s *apiServer) selfTest(ctx iriscontext.Context) {
+	s.apisMutex.Lock()
+	apis := s.apis
+	s.apisMutex.Unlock()
+
+	report := &SelfTestReport{OK: true}
+	for _, api := range apis {
+		if api.Method != http.MethodGet {
+			continue
+		}
+
+		route := &SelfTestRoute{Path: api.Path}
+		report.Routes = append(report.Routes, route)
+		if strings.ContainsAny(api.Path, "{:*") {
+			route.Status = selfTestStatusSkipped
+			continue
+		}
+
+		startTime := time.Now()
+		route.StatusCode = s.selfTestRoute(ctx, api.Path)
+		route.Duration = time.Since(startTime).String()
+		route.Status = selfTestStatusOK
+		if route.StatusCode >= http.StatusInternalServerError {
+			route.Status = selfTestStatusFailed
+			report.OK = false
+		}
+	}
+
+	buff, err := yaml.Marshal(report)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", report, err))
+	}
+
+	ctx.Header("Content-Type", "text/vnd.yaml")
+	ctx.Write(buff)
+}
+
+func (s *apiServer) selfTestRoute(ctx iriscontext.Context, path string) int {
+	reqCtx, cancel := context.WithTimeout(ctx.Request().Context(), selfTestRouteTimeout)
+	defer cancel()
+
+	// NOTE: Inherit the headers passing the guards, but not the token.
+	req := httptest.NewRequest(http.MethodGet, path, nil).WithContext(reqCtx)
+	req.Host = ctx.Request().Host
+	req.Header.Set("User-Agent", ctx.GetHeader("User-Agent"))
+
+	w := httptest.NewRecorder()
+	s.app.ServeHTTP(w, req)
+
+	return w.Code
+}
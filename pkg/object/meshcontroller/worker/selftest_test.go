@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kataras/iris"
+	"gopkg.in/yaml.v2"
+)
+
+func TestSelfTest(t *testing.T) {
+	s := newTestAPIServer(t, []*apiEntry{
+		{
+			Path:    "/healthy",
+			Method:  "GET",
+			Handler: func(ctx iris.Context) {},
+		},
+		{
+			Path:   "/broken",
+			Method: "GET",
+			Handler: func(ctx iris.Context) {
+				ctx.StatusCode(http.StatusInternalServerError)
+			},
+		},
+		{
+			Path:    "/items/{id}",
+			Method:  "GET",
+			Handler: func(ctx iris.Context) {},
+		},
+		{
+			Path:   "/items",
+			Method: "POST",
+			Handler: func(ctx iris.Context) {
+				t.Errorf("self-test issued non-GET request")
+			},
+		},
+	})
+
+	selfTest := func(token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, selfTestPath, nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		return serveTestRequest(s, r)
+	}
+
+	if w := selfTest("secret"); w.Code != http.StatusForbidden {
+		t.Fatalf("disabled: want %d, got %d", http.StatusForbidden, w.Code)
+	}
+
+	s.setDebugToken("secret")
+	if w := selfTest("wrong"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong token: want %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	w := selfTest("secret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("want %d, got %d", http.StatusOK, w.Code)
+	}
+
+	report := &SelfTestReport{}
+	err := yaml.Unmarshal(w.Body.Bytes(), report)
+	if err != nil {
+		t.Fatalf("unmarshal %s failed: %v", w.Body.String(), err)
+	}
+	if report.OK {
+		t.Errorf("want not ok with a broken route")
+	}
+
+	want := map[string]string{
+		indexPath:     selfTestStatusOK,
+		listAPIsPath:  selfTestStatusOK,
+		"/healthy":    selfTestStatusOK,
+		"/broken":     selfTestStatusFailed,
+		"/items/{id}": selfTestStatusSkipped,
+	}
+	got := map[string]string{}
+	for _, route := range report.Routes {
+		got[route.Path] = route.Status
+	}
+	for path, status := range want {
+		if got[path] != status {
+			t.Errorf("%s: want %s, got %s", path, status, got[path])
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("want %d routes, got %v", len(want), got)
+	}
+}
@@ -19,14 +19,19 @@ package worker
 
 import (
 	"context"
+	"crypto/sha256"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"os"
 	"runtime/debug"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/sampler"
 
 	"github.com/kataras/iris"
 	iriscontext "github.com/kataras/iris/context"
@@ -35,16 +40,90 @@ import (
 
 const (
 	defaultServerIP = "127.0.0.1"
+
+	// indexPath is the landing path for humans.
+	indexPath = "/"
+	// listAPIsPath is the stable path of the machine-readable listing.
+	listAPIsPath = "/apis"
 )
 
 type (
 	apiServer struct {
 		app       *iris.Application
-		apisMutex sync.RWMutex
-		apis      []*apiEntry
-		port      int
+		apisMutex sync.Mutex
+		// apisMutexWait samples the time waiting for apisMutex
+		// in the registration.
+		apisMutexWait *sampler.DurationSampler
+		apis          []*apiEntry
+		// apisListing stores the immutable *apisListing,
+		// so that listAPIs won't wait for the registration.
+		apisListing atomic.Value
+		port        int
+
+		// batchDepth is the depth of nested batches guarded by apisMutex,
+		// the router is refreshed once the outermost batch ends.
+		batchDepth int
+		// batchDirty reports whether any registration in the batch
+		// is waiting for the refresh.
+		batchDirty bool
+		// routerRefreshes counts the refreshes of the router.
+		routerRefreshes uint64
+
+		// schemas is map[string]*routeSchema keyed by
+		// method and path of the route.
+		schemas atomic.Value
+
+		// userAgentPrefixes is the []string allowlist of User-Agent
+		// prefixes, empty means all allowed.
+		userAgentPrefixes atomic.Value
+
+		// allowedHosts is the map[string]struct{} allowlist of Host
+		// headers, empty means all allowed.
+		allowedHosts atomic.Value
+
+		// bodyBudget limits the memory of the bodies buffered
+		// for the schema validation across all requests.
+		bodyBudget bodyBudget
+
+		readyMutex     sync.Mutex
+		boundAddr      *net.TCPAddr
+		readyCallbacks []func(addr *net.TCPAddr)
+
+		// indexHandler serves the index, it's the listing by default.
+		indexHandler iris.Handler
+		// indexHeadHandler serves HEAD on the index, it's the headers
+		// of the listing by default.
+		indexHeadHandler iris.Handler
+
+		// drainTimeout bounds draining the in-flight requests in Close,
+		// zero means no limit.
+		drainTimeout time.Duration
+		// signals trigger Close, empty means not handled.
+		signals         []os.Signal
+		signalChan      chan os.Signal
+		signalDone      chan struct{}
+		stopSignalsOnce sync.Once
+
+		// debugToken is the string bearer token of debug APIs,
+		// empty means they're disabled.
+		debugToken atomic.Value
+
+		// readBufferSize and writeBufferSize are the socket buffer
+		// sizes of accepted connections, zero means the system default.
+		readBufferSize  int
+		writeBufferSize int
+	}
+
+	// apisListing is the listing of apis in yaml with its validators.
+	apisListing struct {
+		body         []byte
+		etag         string
+		lastModified time.Time
 	}
 
+	// APIServerOption customizes the API server.
+	APIServerOption func(s *apiServer)
+
 	apiEntry struct {
 		Path    string       `yaml:"path"`
 		Method  string       `yaml:"method"`
@@ -55,15 +134,58 @@ type (
 		Code    int    `yaml:"code"`
 		Message string `yaml:"message"`
 	}
+
+	// APIServerStatus is the status of the API server.
+	APIServerStatus struct {
+		RouteMutexWait *DurationStatus `yaml:"routeMutexWait"`
+	}
+
+	// DurationStatus is the histogram of durations in millisecond.
+	DurationStatus struct {
+		Count float64 `yaml:"count"`
+		P50   float64 `yaml:"p50"`
+		P95   float64 `yaml:"p95"`
+		P99   float64 `yaml:"p99"`
+	}
 )
 
+// WithIndexHandler serves the index with a custom handler,
+// such as a landing page for humans, the listing is still at /apis.
+func WithIndexHandler(handler iris.Handler) APIServerOption {
+	return func(s *apiServer) {
+		s.indexHandler = handler
+	}
+}
+
+// WithIndexHeadHandler serves HEAD on the index with a custom handler.
+// The custom index handler is used if it's not set, whose body is
+// dropped by the http server.
+func WithIndexHeadHandler(handler iris.Handler) APIServerOption {
+	return func(s *apiServer) {
+		s.indexHeadHandler = handler
+	}
+}
+
 // NewAPIServer creates a initialed API server.
-func NewAPIServer(port int) *apiServer {
+func NewAPIServer(port int, opts ...APIServerOption) *apiServer {
 	app := iris.New()
 
 	s := &apiServer{
-		app:  app,
-		port: port,
+		app:           app,
+		port:          port,
+		apisMutexWait: sampler.NewDurationSampler(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.indexHandler == nil {
+		s.indexHandler = s.listAPIs
+		if s.indexHeadHandler == nil {
+			s.indexHeadHandler = s.headAPIs
+		}
+	}
+	if s.indexHeadHandler == nil {
+		s.indexHeadHandler = s.indexHandler
 	}
 
 	// NOTE: Fix trailing slash problem.
@@ -78,19 +200,78 @@ func NewAPIServer(port int) *apiServer {
 		next(w, r)
 	})
 
+	s.schemas.Store(map[string]*routeSchema{})
+
 	app.Use(newRecoverer())
+	app.Use(s.newHostChecker())
+	app.Use(s.newUserAgentChecker())
+	app.Use(s.newSchemaValidator())
 	app.Logger().SetOutput(ioutil.Discard)
-	s.addListAPI()
+	s.batchRegister(func() {
+		s.addIndexAPI()
+		s.addListAPI()
+		s.addDebugAPIs()
+	})
+	s.handleSignals()
 
 	return s
 }
 
+// setMaxBufferedBodyBytes sets the budget of the buffered bodies,
+// zero means unlimited.
+func (s *apiServer) setMaxBufferedBodyBytes(max int64) {
+	s.bodyBudget.setMax(max)
+}
+
+// onReady adds a callback called with the bound address once the server
+// is listening, such as readiness and service registration hooks.
+// It's the only way to get the resolved port when binding to port 0.
+func (s *apiServer) onReady(fn func(addr *net.TCPAddr)) {
+	s.readyMutex.Lock()
+	defer s.readyMutex.Unlock()
+
+	if s.boundAddr != nil {
+		fn(s.boundAddr)
+		return
+	}
+	s.readyCallbacks = append(s.readyCallbacks, fn)
+}
+
+// BoundAddr returns the bound address, nil means not listening yet.
+func (s *apiServer) BoundAddr() *net.TCPAddr {
+	s.readyMutex.Lock()
+	defer s.readyMutex.Unlock()
+
+	return s.boundAddr
+}
+
+func (s *apiServer) ready(addr *net.TCPAddr) {
+	s.readyMutex.Lock()
+	s.boundAddr = addr
+	callbacks := s.readyCallbacks
+	s.readyCallbacks = nil
+	s.readyMutex.Unlock()
+
+	for _, fn := range callbacks {
+		fn(addr)
+	}
+}
+
 // Run calls iris app for servering RESTful APIs.
 func (s *apiServer) run() {
 	addr := fmt.Sprintf("%s:%d", defaultServerIP, s.port)
-	logger.Infof("worker api server running in %s", addr)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		logger.Errorf("listen %s for worker api app failed: %v", addr, err)
+		os.Exit(1)
+	}
 
-	err := s.app.Run(iris.Addr(addr))
+	// NOTE: Resolve the port eagerly, it's a random one if s.port is 0.
+	boundAddr := ln.Addr().(*net.TCPAddr)
+	logger.Infof("worker api server running in %s", boundAddr)
+	s.ready(boundAddr)
+
+	err = s.app.Run(iris.Listener(s.wrapListener(ln)))
 	if err == iris.ErrServerClosed {
 		return
 	}
@@ -100,40 +281,117 @@ func (s *apiServer) run() {
 	}
 }
 
+func (s *apiServer) addIndexAPI() {
+	indexAPIs := []*apiEntry{
+		{
+			Path:    indexPath,
+			Method:  "GET",
+			Handler: s.indexHandler,
+		},
+		{
+			Path:    indexPath,
+			Method:  "HEAD",
+			Handler: s.indexHeadHandler,
+		},
+	}
+
+	s.registerAPIs(indexAPIs)
+}
+
 func (s *apiServer) addListAPI() {
 	listAPIs := []*apiEntry{
 		{
-			Path:    "/",
+			Path:    listAPIsPath,
 			Method:  "GET",
 			Handler: s.listAPIs,
 		},
+		{
+			Path:    listAPIsPath,
+			Method:  "HEAD",
+			Handler: s.headAPIs,
+		},
 	}
 
 	s.registerAPIs(listAPIs)
 }
 
 func (s *apiServer) listAPIs(ctx iriscontext.Context) {
-	s.apisMutex.RLock()
-	defer s.apisMutex.RUnlock()
+	listing := s.writeListingHeaders(ctx)
+	ctx.Write(listing.body)
+}
 
-	buff, err := yaml.Marshal(s.apis)
-	if err != nil {
-		panic(fmt.Errorf("marshal %#v to yaml failed: %v", s.apis, err))
-	}
+// headAPIs serves the same headers as listAPIs without the body,
+// it's a cheap liveness check for monitoring tools.
+func (s *apiServer) headAPIs(ctx iriscontext.Context) {
+	s.writeListingHeaders(ctx)
+}
+
+func (s *apiServer) writeListingHeaders(ctx iriscontext.Context) *apisListing {
+	listing := s.apisListing.Load().(*apisListing)
 
 	ctx.Header("Content-Type", "text/vnd.yaml")
-	ctx.Write(buff)
+	ctx.Header("ETag", listing.etag)
+	ctx.Header("Last-Modified", listing.lastModified.UTC().Format(http.TimeFormat))
+
+	return listing
+}
+
+func (s *apiServer) status() *APIServerStatus {
+	return &APIServerStatus{
+		RouteMutexWait: &DurationStatus{
+			Count: s.apisMutexWait.Count(),
+			P50:   s.apisMutexWait.P50(),
+			P95:   s.apisMutexWait.P95(),
+			P99:   s.apisMutexWait.P99(),
+		},
+	}
 }
 
 func (s *apiServer) Close() {
-	s.app.Shutdown(context.Background())
+	s.stopHandlingSignals()
+
+	ctx := context.Background()
+	if s.drainTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.drainTimeout)
+		defer cancel()
+	}
+	s.app.Shutdown(ctx)
+}
+
+// batchRegister calls fn and coalesces the router refreshes of all
+// registrations during it, including the ones from other goroutines,
+// into a single one at the end of the outermost batch.
+func (s *apiServer) batchRegister(fn func()) {
+	s.apisMutex.Lock()
+	s.batchDepth++
+	s.apisMutex.Unlock()
+
+	defer func() {
+		s.apisMutex.Lock()
+		defer s.apisMutex.Unlock()
+
+		s.batchDepth--
+		if s.batchDepth == 0 && s.batchDirty {
+			s.refreshRouterLocked()
+		}
+	}()
+
+	fn()
 }
 
 func (s *apiServer) registerAPIs(apis []*apiEntry) {
+	startTime := time.Now()
 	s.apisMutex.Lock()
 	defer s.apisMutex.Unlock()
+	s.apisMutexWait.Update(time.Since(startTime))
 
-	s.apis = append(s.apis, apis...)
+	// NOTE: Copy on write, the listing must not share the array
+	// with the one being appended.
+	newAPIs := make([]*apiEntry, 0, len(s.apis)+len(apis))
+	newAPIs = append(newAPIs, s.apis...)
+	newAPIs = append(newAPIs, apis...)
+	s.apis = newAPIs
 
 	for _, api := range apis {
 		logger.Infof("api method: %s, path: %s, handler %#v", api.Method, api.Path, api.Handler)
@@ -159,7 +417,32 @@ func (s *apiServer) registerAPIs(apis []*apiEntry) {
 		}
 	}
 
+	if s.batchDepth > 0 {
+		s.batchDirty = true
+		return
+	}
+
+	s.refreshRouterLocked()
+}
+
+// refreshRouterLocked refreshes the router and publishes the listing,
+// the caller must hold apisMutex.
+func (s *apiServer) refreshRouterLocked() {
+	buff, err := yaml.Marshal(s.apis)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", s.apis, err))
+	}
+
 	s.app.RefreshRouter()
+	atomic.AddUint64(&s.routerRefreshes, 1)
+	s.batchDirty = false
+
+	// NOTE: Publish the listing after the routes are ready.
+	s.apisListing.Store(&apisListing{
+		body:         buff,
+		etag:         fmt.Sprintf(`"%x"`, sha256.Sum256(buff)),
+		lastModified: time.Now(),
+	})
 }
 
 func handleAPIError(ctx iris.Context, code int, err error) {
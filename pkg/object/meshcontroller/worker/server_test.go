@@ -0,0 +1,542 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/meshcontroller/spec"
+	"github.com/megaease/easegress/pkg/option"
+
+	"github.com/kataras/iris"
+)
+
+func TestMain(m *testing.M) {
+	tempDir, err := ioutil.TempDir("", "eg-worker-test")
+	if err != nil {
+		panic(err)
+	}
+	absLogDir := filepath.Join(tempDir, "log")
+	os.MkdirAll(absLogDir, 0755)
+	logger.Init(&option.Options{
+		Name:      "worker-for-log",
+		AbsLogDir: absLogDir,
+	})
+
+	code := m.Run()
+
+	logger.Sync()
+	os.RemoveAll(tempDir)
+
+	os.Exit(code)
+}
+
+func newTestAPIServer(t *testing.T, apis []*apiEntry) *apiServer {
+	s := NewAPIServer(0)
+	s.registerAPIs(apis)
+	err := s.app.Build()
+	if err != nil {
+		t.Fatalf("build app failed: %v", err)
+	}
+
+	return s
+}
+
+func serveTestRequest(s *apiServer, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.app.ServeHTTP(w, r)
+	return w
+}
+
+func TestSchemaValidation(t *testing.T) {
+	s := newTestAPIServer(t, []*apiEntry{
+		{
+			Path:   "/apps/{appName:string}",
+			Method: "POST",
+			Handler: func(ctx iris.Context) {
+				ctx.Write([]byte(`{"status": "UP"}`))
+			},
+		},
+	})
+
+	post := func(body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/apps/order", strings.NewReader(body))
+		return serveTestRequest(s, r)
+	}
+
+	invalidBody := `{"instance": "not-an-object"}`
+	if w := post(invalidBody); w.Code != http.StatusOK {
+		t.Fatalf("no schema: want %d, got %d", http.StatusOK, w.Code)
+	}
+
+	err := s.reloadSchemas([]*spec.APISchema{
+		{
+			Path:   "/apps/{appName:string}",
+			Method: "POST",
+			RequestSchema: `
+type: object
+required: [instance]
+properties:
+  instance:
+    type: object
+`,
+			ResponseSchema: `
+type: object
+required: [status]
+`,
+		},
+	})
+	if err != nil {
+		t.Fatalf("reload schemas failed: %v", err)
+	}
+
+	if w := post(invalidBody); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid request: want %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	w := post(`{"instance": {"app": "order"}}`)
+	if w.Code != http.StatusOK {
+		t.Errorf("valid request: want %d, got %d", http.StatusOK, w.Code)
+	}
+	if w.Body.String() != `{"status": "UP"}` {
+		t.Errorf("valid request: unexpected body %s", w.Body.String())
+	}
+
+	err = s.reloadSchemas([]*spec.APISchema{
+		{
+			Path:           "/apps/{appName:string}",
+			Method:         "POST",
+			ResponseSchema: `{"type": "object", "required": ["instanceId"]}`,
+		},
+	})
+	if err != nil {
+		t.Fatalf("reload schemas failed: %v", err)
+	}
+
+	if w := post(invalidBody); w.Code != http.StatusInternalServerError {
+		t.Errorf("invalid response: want %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+}
+
+func TestBodyBudget(t *testing.T) {
+	block := make(chan struct{})
+	s := newTestAPIServer(t, []*apiEntry{
+		{
+			Path:   "/slow",
+			Method: "POST",
+			Handler: func(ctx iris.Context) {
+				<-block
+				ctx.Write([]byte(`{}`))
+			},
+		},
+		{
+			Path:   "/fast",
+			Method: "POST",
+			Handler: func(ctx iris.Context) {
+				ctx.Write([]byte(`{"status": "UP"}`))
+			},
+		},
+		{
+			Path:   "/status",
+			Method: "GET",
+			Handler: func(ctx iris.Context) {
+				ctx.Write([]byte(`{"status": "UP"}`))
+			},
+		},
+	})
+
+	body := `{"instance": {"app": "order"}}`
+	s.setMaxBufferedBodyBytes(int64(len(body)))
+	err := s.reloadSchemas([]*spec.APISchema{
+		{Path: "/slow", Method: "POST", RequestSchema: `{"type": "object"}`},
+		{Path: "/fast", Method: "POST", RequestSchema: `{"type": "object"}`},
+		{Path: "/status", Method: "GET", ResponseSchema: `{"type": "object", "required": ["instanceId"]}`},
+	})
+	if err != nil {
+		t.Fatalf("reload schemas failed: %v", err)
+	}
+
+	post := func(path string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		return serveTestRequest(s, r)
+	}
+
+	// NOTE: The slow request holds the whole budget until unblocked.
+	slowDone := make(chan *httptest.ResponseRecorder)
+	go func() {
+		slowDone <- post("/slow")
+	}()
+	for i := 0; !s.bodyBudget.exhausted(); i++ {
+		if i == 100 {
+			t.Fatalf("slow request didn't saturate the budget")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if w := post("/fast"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("saturated request: want %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+
+	w := serveTestRequest(s, httptest.NewRequest(http.MethodGet, "/status", nil))
+	if w.Code != http.StatusOK || w.Body.String() != `{"status": "UP"}` {
+		t.Errorf("saturated response: want streamed %d, got %d %s",
+			http.StatusOK, w.Code, w.Body.String())
+	}
+
+	close(block)
+	if w := <-slowDone; w.Code != http.StatusOK {
+		t.Errorf("slow request: want %d, got %d", http.StatusOK, w.Code)
+	}
+
+	if w := post("/fast"); w.Code != http.StatusOK {
+		t.Errorf("released request: want %d, got %d", http.StatusOK, w.Code)
+	}
+	w = serveTestRequest(s, httptest.NewRequest(http.MethodGet, "/status", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("released response: want %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+}
+
+func TestIndexSeparateFromListing(t *testing.T) {
+	get := func(s *apiServer, path string) *httptest.ResponseRecorder {
+		return serveTestRequest(s, httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	s := newTestAPIServer(t, nil)
+	index, listing := get(s, "/"), get(s, "/apis")
+	if index.Body.String() != listing.Body.String() {
+		t.Errorf("default index: want the listing %q, got %q", listing.Body.String(), index.Body.String())
+	}
+
+	landing := "Welcome to the worker API server, see /apis for the listing.\n"
+	s = NewAPIServer(0, WithIndexHandler(func(ctx iris.Context) {
+		ctx.Header("Content-Type", "text/plain")
+		ctx.WriteString(landing)
+	}))
+	err := s.app.Build()
+	if err != nil {
+		t.Fatalf("build app failed: %v", err)
+	}
+
+	w := get(s, "/")
+	if w.Code != http.StatusOK || w.Body.String() != landing {
+		t.Errorf("custom index: want %d %q, got %d %q", http.StatusOK, landing, w.Code, w.Body.String())
+	}
+
+	w = get(s, "/apis")
+	if w.Code != http.StatusOK {
+		t.Fatalf("listing: want %d, got %d", http.StatusOK, w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/vnd.yaml" {
+		t.Errorf("listing: want content type text/vnd.yaml, got %s", ct)
+	}
+	for _, path := range []string{"path: /\n", "path: /apis\n"} {
+		if !strings.Contains(w.Body.String(), path) {
+			t.Errorf("listing: want %q in %q", path, w.Body.String())
+		}
+	}
+}
+
+func TestHeadListing(t *testing.T) {
+	s := newTestAPIServer(t, nil)
+
+	get := serveTestRequest(s, httptest.NewRequest(http.MethodGet, "/", nil))
+	head := serveTestRequest(s, httptest.NewRequest(http.MethodHead, "/", nil))
+
+	if head.Code != http.StatusOK {
+		t.Fatalf("want %d, got %d", http.StatusOK, head.Code)
+	}
+	if head.Body.Len() != 0 {
+		t.Errorf("want no body, got %q", head.Body.String())
+	}
+	for _, key := range []string{"ETag", "Last-Modified", "Content-Type"} {
+		want := get.Header().Get(key)
+		if want == "" {
+			t.Errorf("GET: want header %s, got none", key)
+		}
+		if got := head.Header().Get(key); got != want {
+			t.Errorf("HEAD: want header %s %q, got %q", key, want, got)
+		}
+	}
+
+	head = serveTestRequest(s, httptest.NewRequest(http.MethodHead, "/apis", nil))
+	if head.Code != http.StatusOK || head.Body.Len() != 0 {
+		t.Errorf("HEAD /apis: want %d without body, got %d %q",
+			http.StatusOK, head.Code, head.Body.String())
+	}
+}
+
+func TestUserAgentAllowlist(t *testing.T) {
+	s := newTestAPIServer(t, []*apiEntry{
+		{
+			Path:   "/apps",
+			Method: "GET",
+			Handler: func(ctx iris.Context) {
+				ctx.Write([]byte(`{"status": "UP"}`))
+			},
+		},
+	})
+	s.setAllowedUserAgentPrefixes([]string{"EaseMesh-Agent/", "easegress-client/"})
+
+	request := func(method, path, userAgent string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, nil)
+		r.Header.Set("User-Agent", userAgent)
+		return serveTestRequest(s, r)
+	}
+
+	if w := request(http.MethodGet, "/apps", "EaseMesh-Agent/1.0.2"); w.Code != http.StatusOK {
+		t.Errorf("allowed user agent: want %d, got %d", http.StatusOK, w.Code)
+	}
+	if w := request(http.MethodGet, "/apps", "masscan/1.3"); w.Code != http.StatusForbidden {
+		t.Errorf("disallowed user agent: want %d, got %d", http.StatusForbidden, w.Code)
+	}
+	for _, path := range []string{indexPath, listAPIsPath} {
+		for _, userAgent := range []string{"kube-probe/1.21", "ELB-HealthChecker/2.0", ""} {
+			if w := request(http.MethodHead, path, userAgent); w.Code != http.StatusOK {
+				t.Errorf("liveness check %s by %q: want %d, got %d",
+					path, userAgent, http.StatusOK, w.Code)
+			}
+		}
+	}
+	for _, path := range []string{indexPath, listAPIsPath} {
+		if w := request(http.MethodGet, path, "masscan/1.3"); w.Code != http.StatusForbidden {
+			t.Errorf("listing %s: want %d, got %d", path, http.StatusForbidden, w.Code)
+		}
+	}
+}
+
+func TestHostAllowlist(t *testing.T) {
+	s := newTestAPIServer(t, []*apiEntry{
+		{
+			Path:   "/apps",
+			Method: "GET",
+			Handler: func(ctx iris.Context) {
+				ctx.Write([]byte(`{"status": "UP"}`))
+			},
+		},
+	})
+	s.setAllowedHosts([]string{"localhost", "127.0.0.1:13009"})
+
+	get := func(host string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/apps", nil)
+		r.Host = host
+		return serveTestRequest(s, r)
+	}
+
+	for _, host := range []string{"localhost:13009", "LOCALHOST", "127.0.0.1:13009"} {
+		if w := get(host); w.Code != http.StatusOK {
+			t.Errorf("allowed host %s: want %d, got %d", host, http.StatusOK, w.Code)
+		}
+	}
+	for _, host := range []string{"attacker.example.com", "127.0.0.1:8080", ""} {
+		if w := get(host); w.Code != http.StatusBadRequest {
+			t.Errorf("spoofed host %q: want %d, got %d", host, http.StatusBadRequest, w.Code)
+		}
+	}
+
+	s.setAllowedHosts(nil)
+	if w := get("attacker.example.com"); w.Code != http.StatusOK {
+		t.Errorf("disabled allowlist: want %d, got %d", http.StatusOK, w.Code)
+	}
+}
+
+func TestReadyWithRandomPort(t *testing.T) {
+	s := NewAPIServer(0)
+	defer s.Close()
+
+	ports := make(chan int, 1)
+	s.onReady(func(addr *net.TCPAddr) {
+		ports <- addr.Port
+	})
+
+	go s.run()
+
+	select {
+	case port := <-ports:
+		if port == 0 {
+			t.Fatalf("ready callback got port 0")
+		}
+		if boundAddr := s.BoundAddr(); boundAddr == nil || boundAddr.Port != port {
+			t.Errorf("want bound port %d, got %v", port, boundAddr)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("ready callback not called")
+	}
+
+	// NOTE: Callbacks added after being ready are called immediately.
+	called := false
+	s.onReady(func(addr *net.TCPAddr) {
+		called = addr.Port != 0
+	})
+	if !called {
+		t.Errorf("ready callback added after being ready not called")
+	}
+}
+
+func TestRouteMutexWait(t *testing.T) {
+	s := newTestAPIServer(t, nil)
+	before := s.status().RouteMutexWait.Count
+
+	// NOTE: Hold the mutex to make the registration wait.
+	s.apisMutex.Lock()
+	registered := make(chan struct{})
+	go func() {
+		s.registerAPIs([]*apiEntry{
+			{
+				Path:    "/contention",
+				Method:  "GET",
+				Handler: func(ctx iris.Context) {},
+			},
+		})
+		close(registered)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	s.apisMutex.Unlock()
+	<-registered
+
+	wait := s.status().RouteMutexWait
+	if wait.Count != before+1 {
+		t.Errorf("want %v samples, got %v", before+1, wait.Count)
+	}
+	if wait.P99 <= 0 {
+		t.Errorf("want nonzero wait time, got %vms", wait.P99)
+	}
+}
+
+// BenchmarkListAPIsDuringRegistration measures listAPIs while
+// registrations are churning, it never waits for the registration.
+func BenchmarkListAPIsDuringRegistration(b *testing.B) {
+	s := NewAPIServer(0)
+	err := s.app.Build()
+	if err != nil {
+		b.Fatalf("build app failed: %v", err)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			s.registerAPIs([]*apiEntry{
+				{
+					Path:    fmt.Sprintf("/churn/%d", i),
+					Method:  "GET",
+					Handler: func(ctx iris.Context) {},
+				},
+			})
+		}
+	}()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w := serveTestRequest(s, httptest.NewRequest(http.MethodGet, "/apis", nil))
+		if w.Code != http.StatusOK {
+			b.Fatalf("want %d, got %d", http.StatusOK, w.Code)
+		}
+	}
+}
+
+func TestBatchRegistration(t *testing.T) {
+	s := newTestAPIServer(t, nil)
+
+	before := atomic.LoadUint64(&s.routerRefreshes)
+	s.batchRegister(func() {
+		for i := 0; i < 3; i++ {
+			s.registerAPIs([]*apiEntry{
+				{
+					Path:    fmt.Sprintf("/batch/%d", i),
+					Method:  "GET",
+					Handler: func(ctx iris.Context) {},
+				},
+			})
+		}
+		s.batchRegister(func() {
+			s.registerAPIs([]*apiEntry{
+				{
+					Path:    "/batch/nested",
+					Method:  "GET",
+					Handler: func(ctx iris.Context) {},
+				},
+			})
+		})
+	})
+	if got := atomic.LoadUint64(&s.routerRefreshes) - before; got != 1 {
+		t.Fatalf("want 1 refresh, got %d", got)
+	}
+
+	for i := 0; i < 3; i++ {
+		w := serveTestRequest(s, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/batch/%d", i), nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("want %d, got %d", http.StatusOK, w.Code)
+		}
+	}
+	w := serveTestRequest(s, httptest.NewRequest(http.MethodGet, "/apis", nil))
+	if !strings.Contains(w.Body.String(), "/batch/2") {
+		t.Fatalf("listing misses /batch/2: %s", w.Body.String())
+	}
+
+	before = atomic.LoadUint64(&s.routerRefreshes)
+	s.batchRegister(func() {})
+	if got := atomic.LoadUint64(&s.routerRefreshes) - before; got != 0 {
+		t.Fatalf("want no refresh for an empty batch, got %d", got)
+	}
+}
+
+// BenchmarkBatchRegistration measures several registrations in a batch,
+// it refreshes the router only once per batch.
+func BenchmarkBatchRegistration(b *testing.B) {
+	s := NewAPIServer(0)
+	err := s.app.Build()
+	if err != nil {
+		b.Fatalf("build app failed: %v", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		before := atomic.LoadUint64(&s.routerRefreshes)
+		s.batchRegister(func() {
+			for j := 0; j < 8; j++ {
+				s.registerAPIs([]*apiEntry{
+					{
+						Path:    fmt.Sprintf("/batch/%d/%d", i, j),
+						Method:  "GET",
+						Handler: func(ctx iris.Context) {},
+					},
+				})
+			}
+		})
+		if got := atomic.LoadUint64(&s.routerRefreshes) - before; got != 1 {
+			b.Fatalf("want 1 refresh, got %d", got)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+// WithHandleSignals makes the server close itself gracefully on the
+// signals, which are SIGTERM and SIGINT by default. The in-flight requests
+// are drained within drainTimeout, zero means no limit. The signals are no
+// longer handled after the server is closed.
+func WithHandleSignals(drainTimeout time.Duration, signals ...os.Signal) APIServerOption {
+	return func(s *apiServer) {
+		if len(signals) == 0 {
+			signals = []os.Signal{syscall.SIGTERM, os.Interrupt}
+		}
+		s.drainTimeout = drainTimeout
+		s.signals = signals
+	}
+}
+
+func (s *apiServer) handleSignals() {
+	if len(s.signals) == 0 {
+		return
+	}
+
+	s.signalChan = make(chan os.Signal, 1)
+	s.signalDone = make(chan struct{})
+	signal.Notify(s.signalChan, s.signals...)
+
+	go func() {
+		select {
+		case sig := <-s.signalChan:
+			logger.Infof("worker api server received signal %v, draining", sig)
+			s.Close()
+		case <-s.signalDone:
+		}
+	}()
+}
+
+// stopHandlingSignals restores the signals to the previous behavior,
+// it's safe to be called more than once.
+func (s *apiServer) stopHandlingSignals() {
+	if s.signalDone == nil {
+		return
+	}
+
+	s.stopSignalsOnce.Do(func() {
+		signal.Stop(s.signalChan)
+		close(s.signalDone)
+	})
+}
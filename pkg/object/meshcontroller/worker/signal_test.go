@@ -0,0 +1,139 @@
+//go:build !windows
+// +build !windows
+
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/kataras/iris"
+)
+
+func TestHandleSignals(t *testing.T) {
+	// NOTE: Use SIGUSR1 to avoid interfering with the test runner.
+	s := NewAPIServer(0, WithHandleSignals(5*time.Second, syscall.SIGUSR1))
+	started := make(chan struct{})
+	s.registerAPIs([]*apiEntry{
+		{
+			Path:   "/slow",
+			Method: "GET",
+			Handler: func(ctx iris.Context) {
+				close(started)
+				time.Sleep(200 * time.Millisecond)
+				ctx.Write([]byte("done"))
+			},
+		},
+	})
+
+	addrs := make(chan *net.TCPAddr, 1)
+	s.onReady(func(addr *net.TCPAddr) {
+		addrs <- addr
+	})
+	stopped := make(chan struct{})
+	go func() {
+		s.run()
+		close(stopped)
+	}()
+
+	var addr *net.TCPAddr
+	select {
+	case addr = <-addrs:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("server not ready")
+	}
+	url := fmt.Sprintf("http://%s/slow", addr)
+
+	type result struct {
+		body string
+		err  error
+	}
+	results := make(chan result, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err != nil {
+			results <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		results <- result{body: string(body), err: err}
+	}()
+
+	<-started
+	err := syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+	if err != nil {
+		t.Fatalf("send signal failed: %v", err)
+	}
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("server not closed by signal")
+	}
+
+	select {
+	case r := <-results:
+		if r.err != nil || r.body != "done" {
+			t.Fatalf("in-flight request: want done, got %q, %v", r.body, r.err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("in-flight request not drained")
+	}
+
+	client := &http.Client{Timeout: time.Second}
+	if resp, err := client.Get(url); err == nil {
+		resp.Body.Close()
+		t.Fatalf("want request refused after draining")
+	}
+
+	select {
+	case <-s.signalDone:
+	default:
+		t.Fatalf("want signals no longer handled after closed")
+	}
+}
+
+func TestHandleSignalsRemovedOnClose(t *testing.T) {
+	s := NewAPIServer(0, WithHandleSignals(time.Second))
+	if len(s.signals) != 2 {
+		t.Fatalf("want SIGTERM and SIGINT by default, got %v", s.signals)
+	}
+
+	s.Close()
+	// NOTE: Closing twice must not panic on the closed channel.
+	s.Close()
+
+	select {
+	case <-s.signalDone:
+	default:
+		t.Fatalf("want signals no longer handled after closed")
+	}
+
+	if NewAPIServer(0).signalDone != nil {
+		t.Fatalf("want signals not handled by default")
+	}
+}
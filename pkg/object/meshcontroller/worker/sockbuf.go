@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"net"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+type (
+	// socketBufferListener sets the socket buffer sizes of the accepted
+	// connections, zero means the system default.
+	socketBufferListener struct {
+		net.Listener
+		readBufferSize  int
+		writeBufferSize int
+	}
+)
+
+// WithSocketBufferSizes sets the socket read/write buffer sizes in bytes of
+// the accepted connections, such as larger write buffer for streaming
+// over high-latency links, zero means the system default.
+// NOTE: The kernel may adjust the sizes, such as doubling them in Linux.
+func WithSocketBufferSizes(readBufferSize, writeBufferSize int) APIServerOption {
+	return func(s *apiServer) {
+		s.readBufferSize = readBufferSize
+		s.writeBufferSize = writeBufferSize
+	}
+}
+
+func (s *apiServer) wrapListener(ln net.Listener) net.Listener {
+	if s.readBufferSize <= 0 && s.writeBufferSize <= 0 {
+		return ln
+	}
+
+	return &socketBufferListener{
+		Listener:        ln,
+		readBufferSize:  s.readBufferSize,
+		writeBufferSize: s.writeBufferSize,
+	}
+}
+
+func (l *socketBufferListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return conn, nil
+	}
+
+	// NOTE: The connection is still usable with the default sizes.
+	if l.readBufferSize > 0 {
+		if err := tcpConn.SetReadBuffer(l.readBufferSize); err != nil {
+			logger.Warnf("set read buffer size of %s to %d failed: %v",
+				conn.RemoteAddr(), l.readBufferSize, err)
+		}
+	}
+	if l.writeBufferSize > 0 {
+		if err := tcpConn.SetWriteBuffer(l.writeBufferSize); err != nil {
+			logger.Warnf("set write buffer size of %s to %d failed: %v",
+				conn.RemoteAddr(), l.writeBufferSize, err)
+		}
+	}
+
+	return conn, nil
+}
@@ -0,0 +1,92 @@
+//go:build !windows
+// +build !windows
+
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"net"
+	"syscall"
+	"testing"
+)
+
+func socketBufferSize(t *testing.T, conn net.Conn, opt int) int {
+	rawConn, err := conn.(*net.TCPConn).SyscallConn()
+	if err != nil {
+		t.Skipf("raw connection unsupported: %v", err)
+	}
+
+	var size int
+	var sockErr error
+	err = rawConn.Control(func(fd uintptr) {
+		size, sockErr = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, opt)
+	})
+	if err != nil || sockErr != nil {
+		t.Skipf("get socket option unsupported: %v, %v", err, sockErr)
+	}
+
+	return size
+}
+
+func TestSocketBufferSizes(t *testing.T) {
+	const readBufferSize, writeBufferSize = 96 * 1024, 64 * 1024
+
+	s := &apiServer{}
+	WithSocketBufferSizes(readBufferSize, writeBufferSize)(s)
+
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	ln := s.wrapListener(inner)
+	defer ln.Close()
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer client.Close()
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("accept failed: %v", err)
+	}
+	defer conn.Close()
+
+	// NOTE: Linux doubles the sizes for the bookkeeping overhead.
+	if size := socketBufferSize(t, conn, syscall.SO_RCVBUF); size < readBufferSize {
+		t.Errorf("want read buffer size at least %d, got %d", readBufferSize, size)
+	}
+	if size := socketBufferSize(t, conn, syscall.SO_SNDBUF); size < writeBufferSize {
+		t.Errorf("want write buffer size at least %d, got %d", writeBufferSize, size)
+	}
+}
+
+func TestSocketBufferSizesDefault(t *testing.T) {
+	s := &apiServer{}
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer inner.Close()
+
+	if ln := s.wrapListener(inner); ln != inner {
+		t.Errorf("want the listener unwrapped without buffer sizes")
+	}
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	iriscontext "github.com/kataras/iris/context"
+)
+
+// userAgentExemptRoutes are the liveness checks, which are probed by
+// monitoring tools and load balancers with their own User-Agent.
+// Only HEAD is exempt, since GET of the same paths are the listings.
+var userAgentExemptRoutes = map[string]struct{}{
+	routeKey(http.MethodHead, indexPath):    {},
+	routeKey(http.MethodHead, listAPIsPath): {},
+}
+
+// setAllowedUserAgentPrefixes sets the allowlist of User-Agent prefixes,
+// the empty one means all User-Agents are allowed.
+func (s *apiServer) setAllowedUserAgentPrefixes(prefixes []string) {
+	s.userAgentPrefixes.Store(append([]string(nil), prefixes...))
+}
+
+func (s *apiServer) newUserAgentChecker() func(iriscontext.Context) {
+	return func(ctx iriscontext.Context) {
+		prefixes, _ := s.userAgentPrefixes.Load().([]string)
+		if len(prefixes) == 0 {
+			ctx.Next()
+			return
+		}
+
+		if _, exempt := userAgentExemptRoutes[routeKey(ctx.Method(), ctx.Path())]; exempt {
+			ctx.Next()
+			return
+		}
+
+		userAgent := ctx.GetHeader("User-Agent")
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(userAgent, prefix) {
+				ctx.Next()
+				return
+			}
+		}
+
+		handleAPIError(ctx, http.StatusForbidden,
+			fmt.Errorf("user agent %q is not allowed", userAgent))
+	}
+}
@@ -68,6 +68,11 @@ type (
 		egressEvent chan string
 		done        chan struct{}
 	}
+
+	// Status is the status of worker.
+	Status struct {
+		APIServer *APIServerStatus `yaml:"apiServer"`
+	}
 )
 
 const (
@@ -121,12 +126,24 @@ func New(superSpec *supervisor.Spec, super *supervisor.Supervisor) *Worker {
 	_service := service.New(superSpec, store)
 	registryCenterServer := registrycenter.NewRegistryCenterServer(spec.RegistryType,
 		serviceName, applicationIP, applicationPort, instanceID, serviceLabels, _service)
-	ingressServer := NewIngressServer(super, serviceName)
+	propagations := newPropagationStore()
+	ingressServer := NewIngressServer(super, serviceName, propagations)
 	egressEvent := make(chan string, egressEventChanSize)
-	egressServer := NewEgressServer(superSpec, super, serviceName, _service, egressEvent)
+	egressServer := NewEgressServer(superSpec, super, serviceName, _service, egressEvent, propagations)
 	observabilityManager := NewObservabilityServer(serviceName)
 	inf := informer.NewInformer(store)
 	apiServer := NewAPIServer(spec.APIPort)
+	apiServer.setMaxBufferedBodyBytes(spec.MaxBufferedBodyBytes)
+	apiServer.setAllowedUserAgentPrefixes(spec.AllowedUserAgentPrefixes)
+	apiServer.setAllowedHosts(spec.AllowedHosts)
+	apiServer.setDebugToken(spec.DebugToken)
+	// NOTE: MeshController.Inherit builds a new worker for every spec
+	// change, so the schemas are reloaded here, and the invalid ones
+	// have been rejected by Admin.Validate.
+	err = apiServer.reloadSchemas(spec.APISchemas)
+	if err != nil {
+		logger.Errorf("BUG: load api schemas failed: %v", err)
+	}
 
 	w := &Worker{
 		super:     super,
@@ -213,6 +230,11 @@ func (w *Worker) run() {
 			logger.Errorf("init traffic gate failed: %v", err)
 		}
 
+		err = w.watchIngressIPFilter()
+		if err != nil {
+			logger.Errorf("watch ingress ip filter failed: %v", err)
+		}
+
 		w.registryServer.Register(serviceSpec, w.ingressServer.Ready, w.egressServer.Ready)
 
 		err = w.observabilityManager.UpdateService(serviceSpec, info.Version)
@@ -424,6 +446,28 @@ func (w *Worker) addEgressWatching(serviceName string) {
 	}
 }
 
+func (w *Worker) watchIngressIPFilter() error {
+	handleServiceSpec := func(event informer.Event, service *spec.Service) bool {
+		switch event.EventType {
+		case informer.EventDelete:
+			return false
+		case informer.EventUpdate:
+			if err := w.ingressServer.UpdateHTTPServer(service); err != nil {
+				logger.Errorf("update ingress ip filter of service %s failed: %v", service.Name, err)
+			}
+		}
+
+		return true
+	}
+
+	err := w.informer.OnPartOfServiceSpec(w.serviceName, informer.ServiceIPFilter, handleServiceSpec)
+	if err != nil && err != informer.ErrAlreadyWatched {
+		return fmt.Errorf("on informer for ingress ip filter failed: %v", err)
+	}
+
+	return nil
+}
+
 func (w *Worker) informJavaAgent() error {
 	handleServiceSpec := func(event informer.Event, service *spec.Service) bool {
 		switch event.EventType {
@@ -461,7 +505,9 @@ func (w *Worker) watchEvent() {
 // Status returns the status of worker.
 func (w *Worker) Status() *supervisor.Status {
 	return &supervisor.Status{
-		ObjectStatus: nil,
+		ObjectStatus: &Status{
+			APIServer: w.apiServer.status(),
+		},
 	}
 }
 
@@ -0,0 +1,145 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package multiregionsync
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/pkg/api"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+type adminClient struct {
+	// objectsURL is the url of the object APIs.
+	objectsURL string
+	client     *http.Client
+}
+
+func newAdminClient(adminURL string, timeout time.Duration) *adminClient {
+	return &adminClient{
+		objectsURL: strings.TrimSuffix(adminURL, "/") + api.APIPrefix + api.ObjectPrefix,
+		client:     &http.Client{Timeout: timeout},
+	}
+}
+
+// listObjects returns the objects of the kinds keyed by name.
+func (c *adminClient) listObjects(ctx context.Context, kinds map[string]struct{}) (map[string]*object, error) {
+	body, err := c.do(ctx, http.MethodGet, c.objectsURL, nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+
+	specs := []map[string]interface{}{}
+	err = yaml.Unmarshal(body, &specs)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal %s to yaml failed: %v", body, err)
+	}
+
+	objects := make(map[string]*object)
+	for _, spec := range specs {
+		obj, err := newObject(spec)
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := kinds[obj.kind]; exists {
+			objects[obj.name] = obj
+		}
+	}
+
+	return objects, nil
+}
+
+func newObject(spec map[string]interface{}) (*object, error) {
+	obj := &object{}
+	obj.kind, _ = spec["kind"].(string)
+	obj.name, _ = spec["name"].(string)
+	obj.region, _ = spec[RegionLabel].(string)
+	if obj.kind == "" || obj.name == "" {
+		return nil, fmt.Errorf("invalid object without kind or name: %v", spec)
+	}
+
+	// NOTE: The keys are sorted by marshalling,
+	// so the same specs are always in the same yaml.
+	buff, err := yaml.Marshal(spec)
+	if err != nil {
+		return nil, fmt.Errorf("marshal %#v to yaml failed: %v", spec, err)
+	}
+	obj.spec = string(buff)
+
+	return obj, nil
+}
+
+func (c *adminClient) createObject(ctx context.Context, obj *object) error {
+	_, err := c.do(ctx, http.MethodPost, c.objectsURL,
+		strings.NewReader(obj.spec), http.StatusCreated)
+	return err
+}
+
+func (c *adminClient) updateObject(ctx context.Context, obj *object) error {
+	_, err := c.do(ctx, http.MethodPut, c.objectURL(obj.name),
+		strings.NewReader(obj.spec), http.StatusOK)
+	return err
+}
+
+func (c *adminClient) deleteObject(ctx context.Context, obj *object) error {
+	_, err := c.do(ctx, http.MethodDelete, c.objectURL(obj.name), nil, http.StatusOK)
+	return err
+}
+
+func (c *adminClient) objectURL(name string) string {
+	return c.objectsURL + "/" + url.PathEscape(name)
+}
+
+func (c *adminClient) do(ctx context.Context, method, target string,
+	body io.Reader, expectedCode int) ([]byte, error) {
+
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "text/vnd.yaml")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	buff, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: read body failed: %v", method, target, err)
+	}
+
+	if resp.StatusCode != expectedCode {
+		return nil, fmt.Errorf("%s %s: status code %d: %s",
+			method, target, resp.StatusCode, bytes.TrimSpace(buff))
+	}
+
+	return buff, nil
+}
@@ -0,0 +1,155 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package multiregionsync
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	operationPut    = "PUT"
+	operationDelete = "DELETE"
+)
+
+type (
+	// object is the object listed from the admin API.
+	object struct {
+		kind   string
+		name   string
+		region string
+		// spec is the normalized yaml of the object.
+		spec string
+	}
+
+	// event is one change of the objects in the primary region.
+	event struct {
+		seq       uint64
+		time      time.Time
+		operation string
+		// object is the deleted one for DELETE.
+		object *object
+	}
+
+	// eventLog sources the changes of the primary region as events,
+	// the secondary regions apply them in order from their own cursors.
+	eventLog struct {
+		maxEvents int
+		lastSeq   uint64
+		// events are sorted by seq in ascending order.
+		events []*event
+		// snapshot is the objects of the primary region after lastSeq.
+		snapshot map[string]*object
+	}
+)
+
+func newEventLog(maxEvents int) *eventLog {
+	return &eventLog{
+		maxEvents: maxEvents,
+		snapshot:  make(map[string]*object),
+	}
+}
+
+// record appends the differences between the snapshot and objects.
+func (l *eventLog) record(objects map[string]*object, now time.Time) {
+	names := make([]string, 0, len(objects)+len(l.snapshot))
+	for name := range objects {
+		names = append(names, name)
+	}
+	for name := range l.snapshot {
+		if _, exists := objects[name]; !exists {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		prev, curr := l.snapshot[name], objects[name]
+		switch {
+		case curr == nil:
+			l.append(operationDelete, prev, now)
+		case prev == nil || prev.spec != curr.spec:
+			l.append(operationPut, curr, now)
+		}
+	}
+
+	l.snapshot = objects
+}
+
+func (l *eventLog) append(operation string, obj *object, now time.Time) {
+	l.lastSeq++
+	l.events = append(l.events, &event{
+		seq:       l.lastSeq,
+		time:      now,
+		operation: operation,
+		object:    obj,
+	})
+}
+
+// since returns the events after seq, ok is false if some of them
+// have been compacted, then the snapshot is the only source to catch up.
+func (l *eventLog) since(seq uint64) (events []*event, ok bool) {
+	if seq >= l.lastSeq {
+		return nil, true
+	}
+
+	if len(l.events) == 0 || l.events[0].seq > seq+1 {
+		return nil, false
+	}
+
+	i := sort.Search(len(l.events), func(i int) bool {
+		return l.events[i].seq > seq
+	})
+
+	return l.events[i:], true
+}
+
+// snapshotEvents returns the PUT events of all objects in the snapshot,
+// they all carry the lastSeq.
+func (l *eventLog) snapshotEvents(now time.Time) []*event {
+	names := make([]string, 0, len(l.snapshot))
+	for name := range l.snapshot {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	events := make([]*event, 0, len(names))
+	for _, name := range names {
+		events = append(events, &event{
+			seq:       l.lastSeq,
+			time:      now,
+			operation: operationPut,
+			object:    l.snapshot[name],
+		})
+	}
+
+	return events
+}
+
+// compact drops the events applied by all secondary regions,
+// and the oldest ones exceeding maxEvents.
+func (l *eventLog) compact(appliedSeq uint64) {
+	i := sort.Search(len(l.events), func(i int) bool {
+		return l.events[i].seq > appliedSeq
+	})
+	if len(l.events)-i > l.maxEvents {
+		i = len(l.events) - l.maxEvents
+	}
+
+	l.events = append([]*event(nil), l.events[i:]...)
+}
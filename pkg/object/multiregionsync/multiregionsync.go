@@ -0,0 +1,283 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package multiregionsync replicates objects across the clusters in regions.
+package multiregionsync
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/object/httpserver"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	// Category is the category of MultiRegionSync.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of MultiRegionSync.
+	Kind = "MultiRegionSync"
+
+	// RegionLabel is the top-level field of the object spec, the object
+	// with it is specific to the region, and is only replicated to there.
+	RegionLabel = "region"
+
+	resolverLastWriterWins = "lastWriterWins"
+	resolverPrimaryWins    = "primaryWins"
+	resolverSecondaryWins  = "secondaryWins"
+)
+
+func init() {
+	supervisor.Register(&MultiRegionSync{})
+}
+
+type (
+	// MultiRegionSync replicates the objects of the primary region
+	// to the secondary regions through their admin APIs.
+	MultiRegionSync struct {
+		super     *supervisor.Supervisor
+		superSpec *supervisor.Spec
+		spec      *Spec
+
+		primary     *adminClient
+		secondaries []*secondary
+		log         *eventLog
+		kinds       map[string]struct{}
+
+		statusMutex sync.Mutex
+		status      *Status
+
+		ctx    context.Context
+		cancel context.CancelFunc
+		done   chan struct{}
+	}
+
+	// Spec describes the MultiRegionSync.
+	Spec struct {
+		Primary      *RegionSpec   `yaml:"primary" jsonschema:"required"`
+		Secondaries  []*RegionSpec `yaml:"secondaries" jsonschema:"required,minItems=1"`
+		Kinds        []string      `yaml:"kinds" jsonschema:"omitempty,minItems=1,uniqueItems=true"`
+		SyncInterval string        `yaml:"syncInterval" jsonschema:"omitempty,format=duration"`
+		Timeout      string        `yaml:"timeout" jsonschema:"omitempty,format=duration"`
+		MaxEvents    int           `yaml:"maxEvents" jsonschema:"omitempty,minimum=1"`
+
+		// ConflictResolver decides whether the change of the primary
+		// overrides the one made in the secondary region directly.
+		ConflictResolver string `yaml:"conflictResolver" jsonschema:"omitempty,enum=lastWriterWins,enum=primaryWins,enum=secondaryWins"`
+		// DryRun only reports the changes to the secondary regions.
+		DryRun bool `yaml:"dryRun" jsonschema:"omitempty"`
+	}
+
+	// RegionSpec describes the cluster of one region.
+	RegionSpec struct {
+		Region   string `yaml:"region" jsonschema:"required"`
+		AdminURL string `yaml:"adminURL" jsonschema:"required,format=uri"`
+	}
+
+	// Status is the status of MultiRegionSync.
+	Status struct {
+		Health       string             `yaml:"health"`
+		LastSyncTime string             `yaml:"lastSyncTime,omitempty"`
+		LastSeq      uint64             `yaml:"lastSeq"`
+		Events       int                `yaml:"events"`
+		Secondaries  []*SecondaryStatus `yaml:"secondaries"`
+	}
+
+	// SecondaryStatus is the status of the secondary region.
+	SecondaryStatus struct {
+		Region     string `yaml:"region"`
+		AppliedSeq uint64 `yaml:"appliedSeq"`
+		Applied    uint64 `yaml:"applied"`
+		Conflicts  uint64 `yaml:"conflicts"`
+		LastError  string `yaml:"lastError,omitempty"`
+
+		// DryRunActions are the recent changes skipped in dry-run mode.
+		DryRunActions []string `yaml:"dryRunActions,omitempty"`
+	}
+)
+
+// Validate validates Spec.
+func (s Spec) Validate() error {
+	regions := map[string]struct{}{s.Primary.Region: {}}
+	for _, secondary := range s.Secondaries {
+		if _, exists := regions[secondary.Region]; exists {
+			return fmt.Errorf("conflict region: %s", secondary.Region)
+		}
+		regions[secondary.Region] = struct{}{}
+	}
+
+	return nil
+}
+
+// Category returns the category of MultiRegionSync.
+func (mrs *MultiRegionSync) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of MultiRegionSync.
+func (mrs *MultiRegionSync) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of MultiRegionSync.
+func (mrs *MultiRegionSync) DefaultSpec() interface{} {
+	return &Spec{
+		Kinds:            []string{httppipeline.Kind, httpserver.Kind},
+		SyncInterval:     "10s",
+		Timeout:          "5s",
+		MaxEvents:        10000,
+		ConflictResolver: resolverLastWriterWins,
+	}
+}
+
+// Init initilizes MultiRegionSync.
+func (mrs *MultiRegionSync) Init(superSpec *supervisor.Spec, super *supervisor.Supervisor) {
+	mrs.superSpec, mrs.spec, mrs.super = superSpec, superSpec.ObjectSpec().(*Spec), super
+	mrs.reload()
+}
+
+// Inherit inherits previous generation of MultiRegionSync.
+func (mrs *MultiRegionSync) Inherit(superSpec *supervisor.Spec,
+	previousGeneration supervisor.Object, super *supervisor.Supervisor) {
+
+	previousGeneration.Close()
+	mrs.Init(superSpec, super)
+}
+
+func (mrs *MultiRegionSync) reload() {
+	mrs.status = &Status{Health: "initializing"}
+	mrs.ctx, mrs.cancel = context.WithCancel(context.Background())
+	mrs.done = make(chan struct{})
+
+	timeout, err := time.ParseDuration(mrs.spec.Timeout)
+	if err != nil {
+		logger.Errorf("BUG: parse duration %s failed: %v", mrs.spec.Timeout, err)
+		close(mrs.done)
+		return
+	}
+
+	mrs.kinds = make(map[string]struct{})
+	for _, kind := range mrs.spec.Kinds {
+		mrs.kinds[kind] = struct{}{}
+	}
+
+	mrs.primary = newAdminClient(mrs.spec.Primary.AdminURL, timeout)
+	mrs.secondaries = nil
+	for _, spec := range mrs.spec.Secondaries {
+		mrs.secondaries = append(mrs.secondaries, newSecondary(spec, timeout))
+	}
+	mrs.log = newEventLog(mrs.spec.MaxEvents)
+
+	go mrs.run()
+}
+
+func (mrs *MultiRegionSync) run() {
+	defer close(mrs.done)
+
+	syncInterval, err := time.ParseDuration(mrs.spec.SyncInterval)
+	if err != nil {
+		logger.Errorf("BUG: parse duration %s failed: %v",
+			mrs.spec.SyncInterval, err)
+		return
+	}
+
+	ticker := time.NewTicker(syncInterval)
+	defer ticker.Stop()
+
+	for {
+		mrs.sync()
+
+		select {
+		case <-mrs.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (mrs *MultiRegionSync) sync() {
+	objects, err := mrs.primary.listObjects(mrs.ctx, mrs.kinds)
+	if mrs.ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		logger.Errorf("%s list objects of primary region %s failed: %v",
+			mrs.superSpec.Name(), mrs.spec.Primary.Region, err)
+		mrs.setHealth(err.Error())
+		return
+	}
+
+	now := time.Now()
+	mrs.log.record(objects, now)
+
+	minSeq := mrs.log.lastSeq
+	for _, s := range mrs.secondaries {
+		mrs.syncSecondary(s, now)
+		if mrs.ctx.Err() != nil {
+			return
+		}
+		if s.appliedSeq < minSeq {
+			minSeq = s.appliedSeq
+		}
+	}
+	mrs.log.compact(minSeq)
+
+	status := &Status{
+		Health:       "ready",
+		LastSyncTime: now.Format(time.RFC3339),
+		LastSeq:      mrs.log.lastSeq,
+		Events:       len(mrs.log.events),
+	}
+	for _, s := range mrs.secondaries {
+		status.Secondaries = append(status.Secondaries, s.status())
+	}
+
+	mrs.statusMutex.Lock()
+	mrs.status = status
+	mrs.statusMutex.Unlock()
+}
+
+func (mrs *MultiRegionSync) setHealth(health string) {
+	mrs.statusMutex.Lock()
+	defer mrs.statusMutex.Unlock()
+
+	status := *mrs.status
+	status.Health = health
+	mrs.status = &status
+}
+
+// Status returns the status of MultiRegionSync.
+func (mrs *MultiRegionSync) Status() *supervisor.Status {
+	mrs.statusMutex.Lock()
+	status := mrs.status
+	mrs.statusMutex.Unlock()
+
+	return &supervisor.Status{
+		ObjectStatus: status,
+	}
+}
+
+// Close closes MultiRegionSync.
+func (mrs *MultiRegionSync) Close() {
+	mrs.cancel()
+	<-mrs.done
+}
@@ -0,0 +1,344 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package multiregionsync
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
+	"github.com/megaease/easegress/pkg/supervisor"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestMain(m *testing.M) {
+	tempDir, err := ioutil.TempDir("", "eg-multiregionsync-test")
+	if err != nil {
+		panic(err)
+	}
+	absLogDir := filepath.Join(tempDir, "log")
+	os.MkdirAll(absLogDir, 0755)
+	logger.Init(&option.Options{
+		Name:      "multiregionsync-for-log",
+		AbsLogDir: absLogDir,
+	})
+
+	code := m.Run()
+
+	logger.Sync()
+	os.RemoveAll(tempDir)
+
+	os.Exit(code)
+}
+
+// fakeAdmin serves the object APIs of a region.
+type fakeAdmin struct {
+	mutex   sync.Mutex
+	objects map[string]map[string]interface{}
+}
+
+func newFakeAdmin(t *testing.T, specs ...string) (*fakeAdmin, *httptest.Server) {
+	fa := &fakeAdmin{objects: make(map[string]map[string]interface{})}
+	for _, spec := range specs {
+		fa.put(t, spec)
+	}
+	return fa, httptest.NewServer(fa)
+}
+
+func (fa *fakeAdmin) put(t *testing.T, spec string) {
+	m := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(spec), &m); err != nil {
+		t.Fatalf("unmarshal %s failed: %v", spec, err)
+	}
+
+	fa.mutex.Lock()
+	defer fa.mutex.Unlock()
+	fa.objects[m["name"].(string)] = m
+}
+
+func (fa *fakeAdmin) names() []string {
+	fa.mutex.Lock()
+	defer fa.mutex.Unlock()
+
+	names := []string{}
+	for name := range fa.objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (fa *fakeAdmin) get(name string) map[string]interface{} {
+	fa.mutex.Lock()
+	defer fa.mutex.Unlock()
+	return fa.objects[name]
+}
+
+func (fa *fakeAdmin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fa.mutex.Lock()
+	defer fa.mutex.Unlock()
+
+	name := strings.TrimPrefix(r.URL.Path, "/apis/v1/objects")
+	name = strings.TrimPrefix(name, "/")
+
+	switch r.Method {
+	case http.MethodGet:
+		names := []string{}
+		for name := range fa.objects {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		specs := []map[string]interface{}{}
+		for _, name := range names {
+			specs = append(specs, fa.objects[name])
+		}
+		buff, _ := yaml.Marshal(specs)
+		w.Write(buff)
+	case http.MethodPost, http.MethodPut:
+		body, _ := ioutil.ReadAll(r.Body)
+		m := map[string]interface{}{}
+		yaml.Unmarshal(body, &m)
+		_, exists := fa.objects[m["name"].(string)]
+		if r.Method == http.MethodPost && exists {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		if r.Method == http.MethodPut && !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fa.objects[m["name"].(string)] = m
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusCreated)
+		}
+	case http.MethodDelete:
+		if _, exists := fa.objects[name]; !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(fa.objects, name)
+	}
+}
+
+func newTestMultiRegionSync(t *testing.T, primaryURL, secondaryURL string, extra string) *MultiRegionSync {
+	superSpec, err := supervisor.NewSpec(`
+name: multi-region-sync
+kind: MultiRegionSync
+primary:
+  region: us
+  adminURL: ` + primaryURL + `
+secondaries:
+- region: eu
+  adminURL: ` + secondaryURL + `
+` + extra)
+	if err != nil {
+		t.Fatalf("new spec failed: %v", err)
+	}
+
+	mrs := &MultiRegionSync{superSpec: superSpec, spec: superSpec.ObjectSpec().(*Spec)}
+	mrs.status = &Status{}
+	mrs.ctx, mrs.cancel = context.WithCancel(context.Background())
+	mrs.kinds = map[string]struct{}{}
+	for _, kind := range mrs.spec.Kinds {
+		mrs.kinds[kind] = struct{}{}
+	}
+	mrs.primary = newAdminClient(primaryURL, time.Second)
+	mrs.secondaries = []*secondary{newSecondary(mrs.spec.Secondaries[0], time.Second)}
+	mrs.log = newEventLog(mrs.spec.MaxEvents)
+
+	return mrs
+}
+
+func TestEventLog(t *testing.T) {
+	l := newEventLog(2)
+	now := time.Now()
+
+	a := &object{kind: "HTTPServer", name: "a", spec: "a1"}
+	b := &object{kind: "HTTPServer", name: "b", spec: "b1"}
+	l.record(map[string]*object{"a": a, "b": b}, now)
+	if l.lastSeq != 2 {
+		t.Fatalf("want last seq 2, got %d", l.lastSeq)
+	}
+
+	a2 := &object{kind: "HTTPServer", name: "a", spec: "a2"}
+	l.record(map[string]*object{"a": a2}, now)
+	events, ok := l.since(2)
+	if !ok || len(events) != 2 {
+		t.Fatalf("want 2 events, got %d, ok: %v", len(events), ok)
+	}
+	if events[0].operation != operationPut || events[0].object.spec != "a2" {
+		t.Fatalf("want PUT a2, got %s %s", events[0].operation, events[0].object.spec)
+	}
+	if events[1].operation != operationDelete || events[1].object.name != "b" {
+		t.Fatalf("want DELETE b, got %s %s", events[1].operation, events[1].object.name)
+	}
+
+	// NOTE: Exceeding maxEvents drops the oldest ones.
+	l.compact(0)
+	if _, ok := l.since(0); ok {
+		t.Fatalf("want compacted events missing")
+	}
+	if events := l.snapshotEvents(now); len(events) != 1 || events[0].object.spec != "a2" {
+		t.Fatalf("want snapshot events of a2, got %v", events)
+	}
+
+	l.compact(4)
+	if len(l.events) != 0 {
+		t.Fatalf("want all events compacted, got %d", len(l.events))
+	}
+}
+
+const (
+	pipelineSpec = `
+name: pipeline
+kind: HTTPPipeline
+flow: [{filter: mock}]
+`
+	euPipelineSpec = `
+name: eu-pipeline
+kind: HTTPPipeline
+region: eu
+flow: [{filter: mock}]
+`
+	usPipelineSpec = `
+name: us-pipeline
+kind: HTTPPipeline
+region: us
+flow: [{filter: mock}]
+`
+	serverSpec = `
+name: server
+kind: HTTPServer
+port: 10080
+`
+	registrySpec = `
+name: registry
+kind: EtcdServiceRegistry
+`
+)
+
+func TestSync(t *testing.T) {
+	primaryAdmin, ps := newFakeAdmin(t, pipelineSpec, euPipelineSpec, usPipelineSpec, serverSpec, registrySpec)
+	defer ps.Close()
+	secondaryAdmin, ss := newFakeAdmin(t)
+	defer ss.Close()
+
+	mrs := newTestMultiRegionSync(t, ps.URL, ss.URL, "")
+	mrs.sync()
+
+	want := []string{"eu-pipeline", "pipeline", "server"}
+	if got := secondaryAdmin.names(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+
+	primaryAdmin.put(t, strings.Replace(serverSpec, "10080", "10081", 1))
+	primaryAdmin.mutex.Lock()
+	delete(primaryAdmin.objects, "pipeline")
+	primaryAdmin.mutex.Unlock()
+	mrs.sync()
+
+	if port := secondaryAdmin.get("server")["port"]; port != 10081 {
+		t.Fatalf("want port 10081, got %v", port)
+	}
+	if secondaryAdmin.get("pipeline") != nil {
+		t.Fatalf("want pipeline deleted")
+	}
+
+	status := mrs.Status().ObjectStatus.(*Status)
+	if status.Secondaries[0].AppliedSeq != status.LastSeq || status.Secondaries[0].Applied != 5 {
+		t.Fatalf("unexpected status: %+v", status.Secondaries[0])
+	}
+}
+
+func TestSyncConflict(t *testing.T) {
+	primaryAdmin, ps := newFakeAdmin(t, serverSpec)
+	defer ps.Close()
+	secondaryAdmin, ss := newFakeAdmin(t)
+	defer ss.Close()
+
+	mrs := newTestMultiRegionSync(t, ps.URL, ss.URL, "conflictResolver: secondaryWins\n")
+	mrs.sync()
+
+	secondaryAdmin.put(t, strings.Replace(serverSpec, "10080", "20080", 1))
+	mrs.sync()
+	primaryAdmin.put(t, strings.Replace(serverSpec, "10080", "10081", 1))
+	mrs.sync()
+
+	if port := secondaryAdmin.get("server")["port"]; port != 20080 {
+		t.Fatalf("want port 20080 kept, got %v", port)
+	}
+	if conflicts := mrs.secondaries[0].conflicts; conflicts != 1 {
+		t.Fatalf("want 1 conflict, got %d", conflicts)
+	}
+
+	// NOTE: The later changes of the primary region apply after adopting.
+	primaryAdmin.put(t, strings.Replace(serverSpec, "10080", "10082", 1))
+	mrs.sync()
+	if port := secondaryAdmin.get("server")["port"]; port != 10082 {
+		t.Fatalf("want port 10082, got %v", port)
+	}
+}
+
+func TestSyncLastWriterWins(t *testing.T) {
+	primaryAdmin, ps := newFakeAdmin(t, serverSpec)
+	defer ps.Close()
+	secondaryAdmin, ss := newFakeAdmin(t)
+	defer ss.Close()
+
+	mrs := newTestMultiRegionSync(t, ps.URL, ss.URL, "")
+	mrs.sync()
+
+	secondaryAdmin.put(t, strings.Replace(serverSpec, "10080", "20080", 1))
+	mrs.sync()
+	time.Sleep(10 * time.Millisecond)
+	primaryAdmin.put(t, strings.Replace(serverSpec, "10080", "10081", 1))
+	mrs.sync()
+
+	if port := secondaryAdmin.get("server")["port"]; port != 10081 {
+		t.Fatalf("want port 10081 by the later writer, got %v", port)
+	}
+}
+
+func TestSyncDryRun(t *testing.T) {
+	_, ps := newFakeAdmin(t, serverSpec)
+	defer ps.Close()
+	secondaryAdmin, ss := newFakeAdmin(t)
+	defer ss.Close()
+
+	mrs := newTestMultiRegionSync(t, ps.URL, ss.URL, "dryRun: true\n")
+	mrs.sync()
+
+	if names := secondaryAdmin.names(); len(names) != 0 {
+		t.Fatalf("want nothing created in dry-run mode, got %v", names)
+	}
+	actions := mrs.secondaries[0].dryRunActions
+	if len(actions) != 1 || actions[0] != "create HTTPServer server (seq 1)" {
+		t.Fatalf("unexpected dry-run actions: %v", actions)
+	}
+}
@@ -0,0 +1,228 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package multiregionsync
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const maxDryRunActions = 100
+
+type (
+	secondary struct {
+		spec   *RegionSpec
+		client *adminClient
+
+		appliedSeq uint64
+		// synced is the specs applied by the sync keyed by the object name,
+		// localChanges is the time that the diverged ones are found.
+		synced       map[string]string
+		localChanges map[string]time.Time
+
+		applied       uint64
+		conflicts     uint64
+		lastError     string
+		dryRunActions []string
+	}
+)
+
+func newSecondary(spec *RegionSpec, timeout time.Duration) *secondary {
+	return &secondary{
+		spec:         spec,
+		client:       newAdminClient(spec.AdminURL, timeout),
+		synced:       make(map[string]string),
+		localChanges: make(map[string]time.Time),
+	}
+}
+
+func (s *secondary) status() *SecondaryStatus {
+	return &SecondaryStatus{
+		Region:        s.spec.Region,
+		AppliedSeq:    s.appliedSeq,
+		Applied:       s.applied,
+		Conflicts:     s.conflicts,
+		LastError:     s.lastError,
+		DryRunActions: append([]string(nil), s.dryRunActions...),
+	}
+}
+
+// findLocalChanges finds the objects changed in the secondary region
+// directly since they were synced.
+func (s *secondary) findLocalChanges(objects map[string]*object, now time.Time) {
+	for name, spec := range s.synced {
+		current := ""
+		if obj := objects[name]; obj != nil {
+			current = obj.spec
+		}
+
+		if current == spec {
+			delete(s.localChanges, name)
+			continue
+		}
+		if _, exists := s.localChanges[name]; !exists {
+			s.localChanges[name] = now
+		}
+	}
+}
+
+func (mrs *MultiRegionSync) syncSecondary(s *secondary, now time.Time) {
+	objects, err := s.client.listObjects(mrs.ctx, mrs.kinds)
+	if err != nil {
+		logger.Errorf("%s list objects of secondary region %s failed: %v",
+			mrs.superSpec.Name(), s.spec.Region, err)
+		s.lastError = err.Error()
+		return
+	}
+	s.findLocalChanges(objects, now)
+
+	events, ok := mrs.log.since(s.appliedSeq)
+	if !ok {
+		logger.Warnf("%s: events for secondary region %s have been compacted, "+
+			"catch up from the snapshot, deleted objects are left",
+			mrs.superSpec.Name(), s.spec.Region)
+		events = mrs.log.snapshotEvents(now)
+	}
+
+	for _, e := range events {
+		err := mrs.applyEvent(s, e, objects)
+		if err != nil {
+			logger.Errorf("%s apply event %d to secondary region %s failed: %v",
+				mrs.superSpec.Name(), e.seq, s.spec.Region, err)
+			s.lastError = err.Error()
+			return
+		}
+		s.appliedSeq = e.seq
+	}
+
+	s.lastError = ""
+}
+
+// primaryWins resolves the conflict between the event of the primary region
+// and the change made in the secondary region directly at localTime.
+func (mrs *MultiRegionSync) primaryWins(e *event, localTime time.Time) bool {
+	switch mrs.spec.ConflictResolver {
+	case resolverPrimaryWins:
+		return true
+	case resolverSecondaryWins:
+		return false
+	default:
+		return !localTime.After(e.time)
+	}
+}
+
+func (mrs *MultiRegionSync) applyEvent(s *secondary, e *event, objects map[string]*object) error {
+	obj, current := e.object, objects[e.object.name]
+
+	// NOTE: The object specific to other regions is not replicated,
+	// and the one specific to this region is not overridden.
+	if obj.region != "" && obj.region != s.spec.Region {
+		return nil
+	}
+	if current != nil && current.region == s.spec.Region && obj.region != s.spec.Region {
+		return nil
+	}
+
+	if localTime, exists := s.localChanges[obj.name]; exists {
+		if !mrs.primaryWins(e, localTime) {
+			s.conflicts++
+			logger.Warnf("%s: %s was changed in secondary region %s at %s, "+
+				"keep it against the %s at %s by %s",
+				mrs.superSpec.Name(), obj.name, s.spec.Region, localTime.Format(time.RFC3339),
+				e.operation, e.time.Format(time.RFC3339), mrs.spec.ConflictResolver)
+
+			// NOTE: Adopt the local one, so the later changes
+			// of the primary region are applied over it.
+			if current == nil {
+				delete(s.synced, obj.name)
+			} else {
+				s.synced[obj.name] = current.spec
+			}
+			delete(s.localChanges, obj.name)
+			return nil
+		}
+		s.conflicts++
+	}
+
+	var action string
+	switch {
+	case e.operation == operationDelete && current == nil:
+	case e.operation == operationDelete:
+		action = "delete"
+	case current == nil:
+		action = "create"
+	case current.spec != obj.spec:
+		if current.kind != obj.kind {
+			return fmt.Errorf("%s: different kinds: %s, %s", obj.name, current.kind, obj.kind)
+		}
+		action = "update"
+	}
+
+	if action == "" {
+		mrs.markSynced(s, e, objects)
+		return nil
+	}
+
+	if mrs.spec.DryRun {
+		s.dryRunActions = append(s.dryRunActions, fmt.Sprintf("%s %s %s (seq %d)",
+			action, obj.kind, obj.name, e.seq))
+		if len(s.dryRunActions) > maxDryRunActions {
+			s.dryRunActions = s.dryRunActions[len(s.dryRunActions)-maxDryRunActions:]
+		}
+		logger.Infof("%s: dry run: %s %s in secondary region %s",
+			mrs.superSpec.Name(), action, obj.name, s.spec.Region)
+		return nil
+	}
+
+	var err error
+	switch action {
+	case "create":
+		err = s.client.createObject(mrs.ctx, obj)
+	case "update":
+		err = s.client.updateObject(mrs.ctx, obj)
+	case "delete":
+		err = s.client.deleteObject(mrs.ctx, obj)
+	}
+	if err != nil {
+		return err
+	}
+
+	s.applied++
+	logger.Infof("%s: %s %s in secondary region %s",
+		mrs.superSpec.Name(), action, obj.name, s.spec.Region)
+	mrs.markSynced(s, e, objects)
+
+	return nil
+}
+
+// markSynced records the secondary region is consistent with the event.
+func (mrs *MultiRegionSync) markSynced(s *secondary, e *event, objects map[string]*object) {
+	name := e.object.name
+	delete(s.localChanges, name)
+
+	if e.operation == operationDelete {
+		delete(s.synced, name)
+		delete(objects, name)
+		return
+	}
+
+	s.synced[name] = e.object.spec
+	objects[name] = e.object
+}
@@ -0,0 +1,102 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tcpproxy
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+type (
+	// SNIRouter routes TLS connections to backends by the SNI in
+	// the ClientHello, without terminating TLS.
+	SNIRouter struct {
+		Rules []*SNIRule `yaml:"rules" jsonschema:"required,minItems=1"`
+		// PeekTimeout is the timeout of receiving the ClientHello.
+		PeekTimeout string `yaml:"peekTimeout" jsonschema:"omitempty,format=duration"`
+	}
+
+	// SNIRule routes the connections with matching SNI to the backend,
+	// the SNI `*.example.com` matches all subdomains of example.com.
+	SNIRule struct {
+		SNI     string `yaml:"sni" jsonschema:"required"`
+		Backend string `yaml:"backend" jsonschema:"required"`
+	}
+
+	// readOnlyConn feeds crypto/tls with the peeked bytes only,
+	// it fails all writes so that the handshake never proceeds.
+	readOnlyConn struct {
+		r io.Reader
+		net.Conn
+	}
+)
+
+var errClientHelloPeeked = fmt.Errorf("client hello peeked")
+
+func (c readOnlyConn) Read(p []byte) (int, error)         { return c.r.Read(p) }
+func (c readOnlyConn) Write(p []byte) (int, error)        { return 0, io.ErrClosedPipe }
+func (c readOnlyConn) Close() error                       { return nil }
+func (c readOnlyConn) SetDeadline(t time.Time) error      { return nil }
+func (c readOnlyConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c readOnlyConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// peekServerName reads the ClientHello from the conn and returns the SNI,
+// along with the bytes read which must be replayed to the backend.
+func peekServerName(conn net.Conn) (string, []byte, error) {
+	peeked := bytes.NewBuffer(nil)
+	serverName, helloPeeked := "", false
+
+	err := tls.Server(readOnlyConn{r: io.TeeReader(conn, peeked)}, &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			serverName, helloPeeked = hello.ServerName, true
+			return nil, errClientHelloPeeked
+		},
+	}).Handshake()
+
+	if !helloPeeked {
+		return "", peeked.Bytes(), fmt.Errorf("read client hello failed: %v", err)
+	}
+
+	return serverName, peeked.Bytes(), nil
+}
+
+func (r *SNIRule) match(serverName string) bool {
+	sni, serverName := strings.ToLower(r.SNI), strings.ToLower(serverName)
+
+	if strings.HasPrefix(sni, "*.") {
+		return strings.HasSuffix(serverName, sni[1:]) && len(serverName) > len(sni)-1
+	}
+
+	return sni == serverName
+}
+
+// route returns the backend of the first rule matching the SNI.
+func (sr *SNIRouter) route(serverName string) string {
+	for _, rule := range sr.Rules {
+		if rule.match(serverName) {
+			return rule.Backend
+		}
+	}
+
+	return ""
+}
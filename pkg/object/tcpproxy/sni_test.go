@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tcpproxy
+
+import (
+	"bytes"
+	"crypto/tls"
+	"net"
+	"testing"
+)
+
+func TestPeekServerName(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	defer serverConn.Close()
+
+	// NOTE: Capture what the client sent to compare with the peeked.
+	sent := bytes.NewBuffer(nil)
+	go func() {
+		defer clientConn.Close()
+		tls.Client(&recordingConn{Conn: clientConn, buff: sent}, &tls.Config{
+			ServerName:         "api.example.com",
+			InsecureSkipVerify: true,
+		}).Handshake()
+	}()
+
+	serverName, peeked, err := peekServerName(serverConn)
+	if err != nil {
+		t.Fatalf("peek failed: %v", err)
+	}
+	if serverName != "api.example.com" {
+		t.Errorf("want api.example.com, got %s", serverName)
+	}
+	if !bytes.Equal(peeked, sent.Bytes()) {
+		t.Errorf("peeked %d bytes differ from the sent %d bytes", len(peeked), sent.Len())
+	}
+}
+
+type recordingConn struct {
+	net.Conn
+	buff *bytes.Buffer
+}
+
+func (c *recordingConn) Write(p []byte) (int, error) {
+	c.buff.Write(p)
+	return c.Conn.Write(p)
+}
+
+func TestSNIRoute(t *testing.T) {
+	sr := &SNIRouter{
+		Rules: []*SNIRule{
+			{SNI: "api.example.com", Backend: "api"},
+			{SNI: "*.example.com", Backend: "web"},
+		},
+	}
+
+	cases := map[string]string{
+		"api.example.com":    "api",
+		"API.example.com":    "api",
+		"www.example.com":    "web",
+		"a.b.example.com":    "web",
+		"example.com":        "",
+		"evilexample.com":    "",
+		"www.example.com.cn": "",
+		"":                   "",
+	}
+	for serverName, want := range cases {
+		if got := sr.route(serverName); got != want {
+			t.Errorf("route %q: want %q, got %q", serverName, want, got)
+		}
+	}
+}
@@ -0,0 +1,378 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tcpproxy
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	// Category is the category of TCPProxy.
+	Category = supervisor.CategoryTrafficGate
+
+	// Kind is the kind of TCPProxy.
+	Kind = "TCPProxy"
+
+	defaultPeekTimeout    = 5 * time.Second
+	defaultConnectTimeout = 5 * time.Second
+
+	// The backoff of temporary accept errors such as too many open files,
+	// it doubles until the max one, and resets after accepting successfully.
+	minAcceptBackoff = 5 * time.Millisecond
+	maxAcceptBackoff = time.Second
+)
+
+func init() {
+	supervisor.Register(&TCPProxy{})
+}
+
+type (
+	// TCPProxy proxies the raw TCP streams to backends.
+	TCPProxy struct {
+		super     *supervisor.Supervisor
+		superSpec *supervisor.Spec
+		spec      *Spec
+
+		peekTimeout    time.Duration
+		connectTimeout time.Duration
+		backends       map[string]*backend
+
+		listener net.Listener
+		done     chan struct{}
+
+		connsMutex sync.Mutex
+		conns      map[net.Conn]struct{}
+
+		activeConns    int64
+		totalConns     uint64
+		unroutedConns  uint64
+		failedConnects uint64
+	}
+
+	// Spec describes TCPProxy.
+	Spec struct {
+		Port           uint16     `yaml:"port" jsonschema:"required,minimum=1"`
+		Backends       []*Backend `yaml:"backends" jsonschema:"required,minItems=1"`
+		DefaultBackend string     `yaml:"defaultBackend" jsonschema:"omitempty"`
+		ConnectTimeout string     `yaml:"connectTimeout" jsonschema:"omitempty,format=duration"`
+
+		// SNIRouter routes by the SNI, the connections without
+		// matching rule go to the default backend if any.
+		SNIRouter *SNIRouter `yaml:"sniRouter,omitempty" jsonschema:"omitempty"`
+	}
+
+	// Backend is a group of servers, connections are balanced in round robin.
+	Backend struct {
+		Name    string   `yaml:"name" jsonschema:"required"`
+		Servers []string `yaml:"servers" jsonschema:"required,minItems=1,uniqueItems=true"`
+	}
+
+	// Status is the status of TCPProxy.
+	Status struct {
+		ActiveConns    int64  `yaml:"activeConns"`
+		TotalConns     uint64 `yaml:"totalConns"`
+		UnroutedConns  uint64 `yaml:"unroutedConns"`
+		FailedConnects uint64 `yaml:"failedConnects"`
+	}
+
+	backend struct {
+		servers []string
+		count   uint64
+	}
+)
+
+// Validate validates Spec.
+func (spec Spec) Validate() error {
+	backends := map[string]struct{}{}
+	for _, b := range spec.Backends {
+		if _, exists := backends[b.Name]; exists {
+			return fmt.Errorf("conflict backend name: %s", b.Name)
+		}
+		backends[b.Name] = struct{}{}
+	}
+
+	if spec.DefaultBackend != "" {
+		if _, exists := backends[spec.DefaultBackend]; !exists {
+			return fmt.Errorf("default backend %s not found", spec.DefaultBackend)
+		}
+	}
+
+	if spec.SNIRouter == nil {
+		if spec.DefaultBackend == "" {
+			return fmt.Errorf("defaultBackend is required without sniRouter")
+		}
+		return nil
+	}
+
+	for _, rule := range spec.SNIRouter.Rules {
+		if _, exists := backends[rule.Backend]; !exists {
+			return fmt.Errorf("backend %s of sni %s not found", rule.Backend, rule.SNI)
+		}
+	}
+
+	return nil
+}
+
+func (b *backend) next() string {
+	count := atomic.AddUint64(&b.count, 1) - 1
+	return b.servers[count%uint64(len(b.servers))]
+}
+
+// Category returns the category of TCPProxy.
+func (tp *TCPProxy) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of TCPProxy.
+func (tp *TCPProxy) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of TCPProxy.
+func (tp *TCPProxy) DefaultSpec() interface{} {
+	return &Spec{}
+}
+
+// Init initializes TCPProxy.
+func (tp *TCPProxy) Init(superSpec *supervisor.Spec, super *supervisor.Supervisor) {
+	tp.superSpec, tp.spec, tp.super = superSpec, superSpec.ObjectSpec().(*Spec), super
+	tp.reload()
+}
+
+// Inherit inherits previous generation of TCPProxy.
+func (tp *TCPProxy) Inherit(superSpec *supervisor.Spec,
+	previousGeneration supervisor.Object, super *supervisor.Supervisor) {
+
+	// NOTE: Only stop accepting, the established connections
+	// of the previous generation keep going until finished.
+	previousGeneration.(*TCPProxy).closeListener()
+
+	tp.superSpec, tp.spec, tp.super = superSpec, superSpec.ObjectSpec().(*Spec), super
+	tp.reload()
+}
+
+func (tp *TCPProxy) reload() {
+	tp.peekTimeout, tp.connectTimeout = defaultPeekTimeout, defaultConnectTimeout
+	if tp.spec.SNIRouter != nil && tp.spec.SNIRouter.PeekTimeout != "" {
+		tp.peekTimeout = parseDuration(tp.spec.SNIRouter.PeekTimeout, defaultPeekTimeout)
+	}
+	if tp.spec.ConnectTimeout != "" {
+		tp.connectTimeout = parseDuration(tp.spec.ConnectTimeout, defaultConnectTimeout)
+	}
+
+	tp.backends = make(map[string]*backend)
+	for _, b := range tp.spec.Backends {
+		tp.backends[b.Name] = &backend{servers: b.Servers}
+	}
+
+	tp.conns = make(map[net.Conn]struct{})
+	tp.done = make(chan struct{})
+
+	addr := fmt.Sprintf(":%d", tp.spec.Port)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		logger.Errorf("%s: listen %s failed: %v", tp.superSpec.Name(), addr, err)
+		return
+	}
+	tp.listener = listener
+
+	go tp.serve()
+}
+
+func parseDuration(s string, defaultValue time.Duration) time.Duration {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		logger.Errorf("BUG: parse duration %s failed: %v", s, err)
+		return defaultValue
+	}
+	return d
+}
+
+func nextAcceptBackoff(backoff time.Duration) time.Duration {
+	if backoff == 0 {
+		return minAcceptBackoff
+	}
+
+	backoff *= 2
+	if backoff > maxAcceptBackoff {
+		backoff = maxAcceptBackoff
+	}
+	return backoff
+}
+
+func (tp *TCPProxy) serve() {
+	var backoff time.Duration
+	for {
+		conn, err := tp.listener.Accept()
+		if err != nil {
+			select {
+			case <-tp.done:
+				return
+			default:
+			}
+
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				backoff = nextAcceptBackoff(backoff)
+				logger.Warnf("%s: accept failed: %v, retry in %v",
+					tp.superSpec.Name(), err, backoff)
+				select {
+				case <-tp.done:
+					return
+				case <-time.After(backoff):
+				}
+				continue
+			}
+
+			// NOTE: Retrying the permanent error only spins,
+			// such as the listener closed by others.
+			logger.Errorf("%s: accept failed permanently: %v, stop serving",
+				tp.superSpec.Name(), err)
+			tp.listener.Close()
+			return
+		}
+		backoff = 0
+
+		atomic.AddUint64(&tp.totalConns, 1)
+		go tp.handle(conn)
+	}
+}
+
+func (tp *TCPProxy) trackConn(conn net.Conn, add bool) {
+	tp.connsMutex.Lock()
+	defer tp.connsMutex.Unlock()
+
+	if add {
+		tp.conns[conn] = struct{}{}
+	} else {
+		delete(tp.conns, conn)
+	}
+}
+
+func (tp *TCPProxy) handle(conn net.Conn) {
+	atomic.AddInt64(&tp.activeConns, 1)
+	defer atomic.AddInt64(&tp.activeConns, -1)
+
+	tp.trackConn(conn, true)
+	defer tp.trackConn(conn, false)
+	defer conn.Close()
+
+	backendName, peeked := tp.spec.DefaultBackend, []byte(nil)
+	if tp.spec.SNIRouter != nil {
+		conn.SetReadDeadline(time.Now().Add(tp.peekTimeout))
+		serverName, buff, err := peekServerName(conn)
+		conn.SetReadDeadline(time.Time{})
+		if err != nil {
+			atomic.AddUint64(&tp.unroutedConns, 1)
+			logger.Warnf("%s: %s: %v", tp.superSpec.Name(), conn.RemoteAddr(), err)
+			return
+		}
+		peeked = buff
+
+		if name := tp.spec.SNIRouter.route(serverName); name != "" {
+			backendName = name
+		}
+		if backendName == "" {
+			atomic.AddUint64(&tp.unroutedConns, 1)
+			logger.Warnf("%s: %s: no backend for sni %s",
+				tp.superSpec.Name(), conn.RemoteAddr(), serverName)
+			return
+		}
+	}
+
+	server := tp.backends[backendName].next()
+	upstream, err := net.DialTimeout("tcp", server, tp.connectTimeout)
+	if err != nil {
+		atomic.AddUint64(&tp.failedConnects, 1)
+		logger.Warnf("%s: connect %s failed: %v", tp.superSpec.Name(), server, err)
+		return
+	}
+	tp.trackConn(upstream, true)
+	defer tp.trackConn(upstream, false)
+	defer upstream.Close()
+
+	// NOTE: Replay the ClientHello consumed by peeking.
+	if len(peeked) > 0 {
+		_, err = upstream.Write(peeked)
+		if err != nil {
+			logger.Warnf("%s: write to %s failed: %v", tp.superSpec.Name(), server, err)
+			return
+		}
+	}
+
+	pipe(conn, upstream)
+}
+
+// pipe copies the streams in both directions until both finished.
+func pipe(client, upstream net.Conn) {
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+
+	copyStream := func(dst, src net.Conn) {
+		defer wg.Done()
+		io.Copy(dst, src)
+		// NOTE: Pass the half close, so the other direction still works.
+		if tcpConn, ok := dst.(*net.TCPConn); ok {
+			tcpConn.CloseWrite()
+		} else {
+			dst.Close()
+		}
+	}
+
+	go copyStream(upstream, client)
+	go copyStream(client, upstream)
+
+	wg.Wait()
+}
+
+// Status returns the status of TCPProxy.
+func (tp *TCPProxy) Status() *supervisor.Status {
+	return &supervisor.Status{
+		ObjectStatus: &Status{
+			ActiveConns:    atomic.LoadInt64(&tp.activeConns),
+			TotalConns:     atomic.LoadUint64(&tp.totalConns),
+			UnroutedConns:  atomic.LoadUint64(&tp.unroutedConns),
+			FailedConnects: atomic.LoadUint64(&tp.failedConnects),
+		},
+	}
+}
+
+func (tp *TCPProxy) closeListener() {
+	close(tp.done)
+	if tp.listener != nil {
+		tp.listener.Close()
+	}
+}
+
+// Close closes TCPProxy along with all connections.
+func (tp *TCPProxy) Close() {
+	tp.closeListener()
+
+	tp.connsMutex.Lock()
+	defer tp.connsMutex.Unlock()
+	for conn := range tp.conns {
+		conn.Close()
+	}
+}
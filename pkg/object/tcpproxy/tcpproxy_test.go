@@ -0,0 +1,184 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tcpproxy
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+type temporaryError struct{}
+
+func TestMain(m *testing.M) {
+	tempDir, err := ioutil.TempDir("", "eg-tcpproxy-test")
+	if err != nil {
+		panic(err)
+	}
+	absLogDir := filepath.Join(tempDir, "log")
+	os.MkdirAll(absLogDir, 0755)
+	logger.Init(&option.Options{
+		Name:      "tcpproxy-for-log",
+		AbsLogDir: absLogDir,
+	})
+
+	code := m.Run()
+
+	logger.Sync()
+	os.RemoveAll(tempDir)
+
+	os.Exit(code)
+}
+
+func (temporaryError) Error() string   { return "too many open files" }
+func (temporaryError) Timeout() bool   { return false }
+func (temporaryError) Temporary() bool { return true }
+
+// faultyListener fails the first accepts with the given errors.
+type faultyListener struct {
+	net.Listener
+	errs   chan error
+	closed int32
+}
+
+func (l *faultyListener) Accept() (net.Conn, error) {
+	select {
+	case err := <-l.errs:
+		return nil, err
+	default:
+		return l.Listener.Accept()
+	}
+}
+
+func (l *faultyListener) Close() error {
+	atomic.StoreInt32(&l.closed, 1)
+	return l.Listener.Close()
+}
+
+func newTestTCPProxy(t *testing.T, errs ...error) (*TCPProxy, *faultyListener) {
+	superSpec, err := supervisor.NewSpec(`
+name: tcp-proxy-test
+kind: TCPProxy
+port: 10080
+defaultBackend: backend
+backends:
+- name: backend
+  servers: [127.0.0.1:1]
+`)
+	if err != nil {
+		t.Fatalf("new spec failed: %v", err)
+	}
+
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	listener := &faultyListener{
+		Listener: inner,
+		errs:     make(chan error, len(errs)),
+	}
+	for _, err := range errs {
+		listener.errs <- err
+	}
+
+	tp := &TCPProxy{
+		superSpec:      superSpec,
+		spec:           superSpec.ObjectSpec().(*Spec),
+		connectTimeout: 100 * time.Millisecond,
+		backends: map[string]*backend{
+			"backend": {servers: []string{"127.0.0.1:1"}},
+		},
+		listener: listener,
+		done:     make(chan struct{}),
+		conns:    map[net.Conn]struct{}{},
+	}
+
+	return tp, listener
+}
+
+func TestNextAcceptBackoff(t *testing.T) {
+	backoff := nextAcceptBackoff(0)
+	if backoff != minAcceptBackoff {
+		t.Fatalf("want %v, got %v", minAcceptBackoff, backoff)
+	}
+
+	for i := 0; i < 20; i++ {
+		backoff = nextAcceptBackoff(backoff)
+	}
+	if backoff != maxAcceptBackoff {
+		t.Fatalf("want %v, got %v", maxAcceptBackoff, backoff)
+	}
+}
+
+func TestServeTemporaryAcceptError(t *testing.T) {
+	tp, listener := newTestTCPProxy(t, temporaryError{}, temporaryError{}, temporaryError{})
+	defer tp.closeListener()
+
+	start := time.Now()
+	go tp.serve()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadUint64(&tp.totalConns) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("connection not accepted after temporary errors")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// NOTE: Backoff 5ms, 10ms, 20ms in turn.
+	if elapsed := time.Since(start); elapsed < 35*time.Millisecond {
+		t.Fatalf("accepted after %v, want backoff at least 35ms", elapsed)
+	}
+	if atomic.LoadInt32(&listener.closed) != 0 {
+		t.Fatalf("listener closed by temporary errors")
+	}
+}
+
+func TestServePermanentAcceptError(t *testing.T) {
+	tp, listener := newTestTCPProxy(t, errors.New("permanent failure"))
+
+	served := make(chan struct{})
+	go func() {
+		tp.serve()
+		close(served)
+	}()
+
+	select {
+	case <-served:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("serve still running after permanent error")
+	}
+	if atomic.LoadInt32(&listener.closed) == 0 {
+		t.Fatalf("listener not closed after permanent error")
+	}
+}
@@ -62,6 +62,13 @@ type Options struct {
 	ClusterJoinURLs                 []string          `yaml:"cluster-join-urls"`
 	APIAddr                         string            `yaml:"api-addr"`
 	Debug                           bool              `yaml:"debug"`
+	APIDebugToken                   string            `yaml:"api-debug-token"`
+	APISigningSecret                string            `yaml:"api-signing-secret"`
+	APISigningTolerance             string            `yaml:"api-signing-tolerance"`
+	APIMaxStreams                   int               `yaml:"api-max-streams"`
+
+	// Security.
+	HealthCheckAllowedCommands []string `yaml:"health-check-allowed-commands"`
 
 	// Path.
 	HomeDir   string `yaml:"home-dir"`
@@ -105,6 +112,11 @@ func New() *Options {
 	opt.flags.StringSliceVar(&opt.ClusterJoinURLs, "cluster-join-urls", nil, "List of URLs to join, when the first url is the same with any one of cluster-initial-advertise-peer-urls, it means to join itself, and this config will be treated empty.")
 	opt.flags.StringVar(&opt.APIAddr, "api-addr", "localhost:2381", "Address([host]:port) to listen on for administration traffic.")
 	opt.flags.BoolVar(&opt.Debug, "debug", false, "Flag to set lowest log level from INFO downgrade DEBUG.")
+	opt.flags.StringVar(&opt.APIDebugToken, "api-debug-token", "", "Bearer token to access debug APIs of administration, which are disabled if empty.")
+	opt.flags.StringVar(&opt.APISigningSecret, "api-signing-secret", "", "Shared secret to verify the HMAC signatures of the signed administration APIs, which are not verified if empty.")
+	opt.flags.StringVar(&opt.APISigningTolerance, "api-signing-tolerance", "5m", "Max difference between the signed timestamp and the server time of the signed administration APIs.")
+	opt.flags.IntVar(&opt.APIMaxStreams, "api-max-streams", 64, "Max number of concurrent streaming connections of administration such as log tails, which are unlimited if 0.")
+	opt.flags.StringArrayVar(&opt.HealthCheckAllowedCommands, "health-check-allowed-commands", nil, "Shell commands allowed to run by upstream health checks, which are disabled if empty.")
 
 	opt.flags.StringVar(&opt.HomeDir, "home-dir", "./", "Path to the home directory.")
 	opt.flags.StringVar(&opt.DataDir, "data-dir", "data", "Path to the data directory.")
@@ -307,6 +319,17 @@ func (opt *Options) validate() error {
 		return fmt.Errorf("invalid api-url: %v", err)
 	}
 
+	if opt.APISigningSecret != "" {
+		tolerance, err := time.ParseDuration(opt.APISigningTolerance)
+		if err != nil || tolerance <= 0 {
+			return fmt.Errorf("invalid api-signing-tolerance: %s", opt.APISigningTolerance)
+		}
+	}
+
+	if opt.APIMaxStreams < 0 {
+		return fmt.Errorf("invalid api-max-streams: %d", opt.APIMaxStreams)
+	}
+
 	// dirs
 	if opt.HomeDir == "" {
 		return fmt.Errorf("empty home-dir")
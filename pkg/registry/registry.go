@@ -19,29 +19,50 @@ package registry
 
 import (
 	// Objects
+	_ "github.com/megaease/easegress/pkg/object/alertmanagertrigger"
+	_ "github.com/megaease/easegress/pkg/object/auditlog"
+	_ "github.com/megaease/easegress/pkg/object/autoscalehint"
 	_ "github.com/megaease/easegress/pkg/object/easemonitormetrics"
 	_ "github.com/megaease/easegress/pkg/object/function"
 	_ "github.com/megaease/easegress/pkg/object/httppipeline"
 	_ "github.com/megaease/easegress/pkg/object/httpserver"
+	_ "github.com/megaease/easegress/pkg/object/k8spodlifecycle"
+	_ "github.com/megaease/easegress/pkg/object/kafkaauditsink"
 	_ "github.com/megaease/easegress/pkg/object/meshcontroller"
+	_ "github.com/megaease/easegress/pkg/object/meshcontroller/consul"
+	_ "github.com/megaease/easegress/pkg/object/multiregionsync"
 	_ "github.com/megaease/easegress/pkg/object/serviceregistry/consulserviceregistry"
 	_ "github.com/megaease/easegress/pkg/object/serviceregistry/etcdserviceregistry"
 	_ "github.com/megaease/easegress/pkg/object/serviceregistry/eurekaserviceregistry"
 	_ "github.com/megaease/easegress/pkg/object/serviceregistry/zookeeperserviceregistry"
+	_ "github.com/megaease/easegress/pkg/object/tcpproxy"
 
 	// Filters
+	_ "github.com/megaease/easegress/pkg/filter/abtest"
 	_ "github.com/megaease/easegress/pkg/filter/apiaggregator"
+	_ "github.com/megaease/easegress/pkg/filter/batcher"
 	_ "github.com/megaease/easegress/pkg/filter/bridge"
 	_ "github.com/megaease/easegress/pkg/filter/circuitbreaker"
+	_ "github.com/megaease/easegress/pkg/filter/compression"
+	_ "github.com/megaease/easegress/pkg/filter/cors"
 	_ "github.com/megaease/easegress/pkg/filter/corsadaptor"
+	_ "github.com/megaease/easegress/pkg/filter/deduplication"
+	_ "github.com/megaease/easegress/pkg/filter/devmodeoverride"
+	_ "github.com/megaease/easegress/pkg/filter/dualwrite"
 	_ "github.com/megaease/easegress/pkg/filter/fallback"
+	_ "github.com/megaease/easegress/pkg/filter/fieldencryption"
+	_ "github.com/megaease/easegress/pkg/filter/jsontransform"
 	_ "github.com/megaease/easegress/pkg/filter/mock"
+	_ "github.com/megaease/easegress/pkg/filter/oauth2exchange"
 	_ "github.com/megaease/easegress/pkg/filter/proxy"
 	_ "github.com/megaease/easegress/pkg/filter/ratelimiter"
 	_ "github.com/megaease/easegress/pkg/filter/remotefilter"
 	_ "github.com/megaease/easegress/pkg/filter/requestadaptor"
 	_ "github.com/megaease/easegress/pkg/filter/responseadaptor"
 	_ "github.com/megaease/easegress/pkg/filter/retryer"
+	_ "github.com/megaease/easegress/pkg/filter/saml"
 	_ "github.com/megaease/easegress/pkg/filter/timelimiter"
 	_ "github.com/megaease/easegress/pkg/filter/validator"
+	_ "github.com/megaease/easegress/pkg/filter/webhookverify"
+	_ "github.com/megaease/easegress/pkg/filter/websocket"
 )
@@ -78,6 +78,15 @@ type (
 		Object
 	}
 
+	// Drainer is the object draining the traffic before Easegress
+	// is closed by a signal.
+	Drainer interface {
+		Object
+
+		// Drain blocks until the traffic is drained.
+		Drain()
+	}
+
 	// ObjectCategory is the type to classify all objects.
 	ObjectCategory string
 )
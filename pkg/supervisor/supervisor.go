@@ -126,6 +126,16 @@ func (ro *RunningObject) inheritWithRecovery(previousGeneration Object, super *S
 	ro.Instance().Inherit(ro.Spec(), previousGeneration, super)
 }
 
+func (ro *RunningObject) drainWithRecovery() {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Errorf("%s: recover from drain, err: %v, stack trace:\n%s\n",
+				ro.spec.Name(), err, debug.Stack())
+		}
+	}()
+	ro.Instance().(Drainer).Drain()
+}
+
 func (ro *RunningObject) closeWithRecovery() {
 	defer func() {
 		if err := recover(); err != nil {
@@ -350,6 +360,23 @@ func (s *Supervisor) FirstHandleDone() chan struct{} {
 	return s.firstHandleDone
 }
 
+// Drain drains the running objects implementing Drainer concurrently,
+// and waits for all of them.
+func (s *Supervisor) Drain() {
+	wg := &sync.WaitGroup{}
+	s.WalkRunningObjects(func(ro *RunningObject) bool {
+		if _, ok := ro.Instance().(Drainer); ok {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ro.drainWithRecovery()
+			}()
+		}
+		return true
+	}, CategoryAll)
+	wg.Wait()
+}
+
 // Close closes Supervisor.
 func (s *Supervisor) Close(wg *sync.WaitGroup) {
 	defer wg.Done()
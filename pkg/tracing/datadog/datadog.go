@@ -0,0 +1,188 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package datadog
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/megaease/easegress/pkg/tracing/base"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	opentracingext "github.com/opentracing/opentracing-go/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/opentracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+const (
+	// The environment variables of the unified service tagging.
+	envService = "DD_SERVICE"
+	envEnv     = "DD_ENV"
+	envVersion = "DD_VERSION"
+
+	// socketAgentAddr is the placeholder address of the agent
+	// listening on the Unix socket, it's never resolved.
+	socketAgentAddr = "localhost:8126"
+)
+
+type (
+	// Spec describes Datadog.
+	Spec struct {
+		// AgentAddr is the host:port of the agent, it's localhost:8126 by default.
+		AgentAddr string `yaml:"agentAddr" jsonschema:"omitempty"`
+		// AgentSocket is the path of the Unix socket of the agent,
+		// it's preferred to AgentAddr.
+		AgentSocket string `yaml:"agentSocket" jsonschema:"omitempty"`
+		// Env and Version are DD_ENV and DD_VERSION by default.
+		Env        string  `yaml:"env" jsonschema:"omitempty"`
+		Version    string  `yaml:"version" jsonschema:"omitempty"`
+		SampleRate float64 `yaml:"sampleRate" jsonschema:"required,minimum=0,maximum=1"`
+	}
+
+	// ddTracer sets the resource names and error tags
+	// of the spans in the Datadog way.
+	ddTracer struct {
+		opentracing.Tracer
+	}
+
+	ddSpan struct {
+		opentracing.Span
+		method string
+		url    string
+	}
+
+	closerFunc func() error
+)
+
+func (f closerFunc) Close() error { return f() }
+
+// Validate validates Spec.
+func (spec Spec) Validate() error {
+	if spec.AgentAddr != "" {
+		_, _, err := net.SplitHostPort(spec.AgentAddr)
+		if err != nil {
+			return fmt.Errorf("invalid agentAddr: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// New creates Datadog tracer, the service name is overridden by DD_SERVICE.
+// NOTE: The tracer of Datadog is global, so the last one created wins.
+func New(serviceName string, spec *Spec) (opentracing.Tracer, io.Closer, error) {
+	if service := os.Getenv(envService); service != "" {
+		serviceName = service
+	}
+
+	opts := []tracer.StartOption{
+		tracer.WithServiceName(serviceName),
+		tracer.WithSampler(tracer.NewRateSampler(spec.SampleRate)),
+	}
+
+	env, version := spec.Env, spec.Version
+	if env == "" {
+		env = os.Getenv(envEnv)
+	}
+	if version == "" {
+		version = os.Getenv(envVersion)
+	}
+	if env != "" {
+		opts = append(opts, tracer.WithGlobalTag(ext.Environment, env))
+	}
+	if version != "" {
+		opts = append(opts, tracer.WithGlobalTag("version", version))
+	}
+
+	switch {
+	case spec.AgentSocket != "":
+		opts = append(opts,
+			tracer.WithAgentAddr(socketAgentAddr),
+			tracer.WithHTTPRoundTripper(unixRoundTripper(spec.AgentSocket)))
+	case spec.AgentAddr != "":
+		opts = append(opts, tracer.WithAgentAddr(spec.AgentAddr))
+	}
+
+	t := &ddTracer{Tracer: opentracer.New(opts...)}
+
+	return t, closerFunc(func() error {
+		tracer.Stop()
+		return nil
+	}), nil
+}
+
+func unixRoundTripper(socket string) http.RoundTripper {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+
+	return &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", socket)
+		},
+		MaxIdleConns:    100,
+		IdleConnTimeout: 90 * time.Second,
+	}
+}
+
+func (t *ddTracer) StartSpan(operationName string, opts ...opentracing.StartSpanOption) opentracing.Span {
+	opts = append(opts, opentracer.SpanType(ext.SpanTypeWeb))
+	return &ddSpan{Span: t.Tracer.StartSpan(operationName, opts...)}
+}
+
+// SetTag translates the tags of Easegress and OpenTracing into Datadog.
+func (s *ddSpan) SetTag(key string, value interface{}) opentracing.Span {
+	switch key {
+	case base.CancelTagKey:
+		// NOTE: Datadog drops the whole trace rather than the span.
+		s.Span.SetTag(ext.ManualDrop, true)
+		return s
+	case string(opentracingext.HTTPMethod):
+		s.method, _ = value.(string)
+	case string(opentracingext.HTTPUrl):
+		s.url, _ = value.(string)
+	}
+
+	s.Span.SetTag(key, value)
+	return s
+}
+
+// Finish names the resource by the method and path like other
+// integrations of Datadog, the operation name is kept.
+func (s *ddSpan) Finish() {
+	s.setResourceName()
+	s.Span.Finish()
+}
+
+func (s *ddSpan) FinishWithOptions(opts opentracing.FinishOptions) {
+	s.setResourceName()
+	s.Span.FinishWithOptions(opts)
+}
+
+func (s *ddSpan) setResourceName() {
+	if s.method != "" && s.url != "" {
+		s.Span.SetTag(ext.ResourceName, s.method+" "+s.url)
+	}
+}
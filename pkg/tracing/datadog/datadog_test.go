@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package datadog
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	opentracingext "github.com/opentracing/opentracing-go/ext"
+)
+
+func TestUnixSocketAgent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eg-datadog-test")
+	if err != nil {
+		t.Fatalf("create temp dir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "apm.socket")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("listen %s failed: %v", socket, err)
+	}
+
+	traces := make(chan []byte, 10)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.URL.Path == "/v0.4/traces" && len(body) > 1 {
+			traces <- body
+		}
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	os.Setenv(envEnv, "staging")
+	defer os.Unsetenv(envEnv)
+
+	tracer, closer, err := New("easegress", &Spec{AgentSocket: socket, Version: "1.0.0", SampleRate: 1})
+	if err != nil {
+		t.Fatalf("new tracer failed: %v", err)
+	}
+
+	span := tracer.StartSpan("http-server")
+	span.SetTag(string(opentracingext.HTTPMethod), "GET")
+	span.SetTag(string(opentracingext.HTTPUrl), "/users")
+	span.SetTag(string(opentracingext.Error), true)
+	span.Finish()
+
+	// NOTE: Stopping flushes the spans queued.
+	time.Sleep(100 * time.Millisecond)
+	closer.Close()
+
+	select {
+	case body := <-traces:
+		for _, want := range []string{"easegress", "http-server", "GET /users", "staging", "1.0.0"} {
+			if !bytes.Contains(body, []byte(want)) {
+				t.Errorf("want %q in the traces, got %q", want, body)
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("want traces sent to the agent, got none")
+	}
+}
@@ -48,6 +48,10 @@ type (
 		// SetName changes the span name.
 		SetName(name string)
 
+		// SetTag sets the tag of the span, the keys of
+		// github.com/opentracing/opentracing-go/ext are preferred.
+		SetTag(key string, value interface{})
+
 		// LogKV logs key:value for the span.
 		//
 		// The keys must all be strings. The values may be strings, numeric types,
@@ -129,6 +133,10 @@ func (s span) SetName(name string) {
 	s.span.SetOperationName(name)
 }
 
+func (s span) SetTag(key string, value interface{}) {
+	s.span.SetTag(key, value)
+}
+
 func (s span) LogKV(kv ...interface{}) {
 	s.span.LogKV(kv...)
 }
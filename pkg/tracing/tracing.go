@@ -18,8 +18,10 @@
 package tracing
 
 import (
+	"fmt"
 	"io"
 
+	"github.com/megaease/easegress/pkg/tracing/datadog"
 	"github.com/megaease/easegress/pkg/tracing/zipkin"
 
 	opentracing "github.com/opentracing/opentracing-go"
@@ -30,7 +32,8 @@ type (
 	Spec struct {
 		ServiceName string `yaml:"serviceName" jsonschema:"required"`
 
-		Zipkin *zipkin.Spec `yaml:"zipkin" jsonschema:"omitempty"`
+		Zipkin  *zipkin.Spec  `yaml:"zipkin" jsonschema:"omitempty"`
+		Datadog *datadog.Spec `yaml:"datadog" jsonschema:"omitempty"`
 	}
 
 	// Tracing is the tracing.
@@ -51,13 +54,29 @@ var (
 	}
 )
 
+// Validate validates Spec.
+func (spec Spec) Validate() error {
+	if (spec.Zipkin == nil) == (spec.Datadog == nil) {
+		return fmt.Errorf("one of zipkin and datadog is required")
+	}
+
+	return nil
+}
+
 // New creates a Tracing.
 func New(spec *Spec) (*Tracing, error) {
 	if spec == nil {
 		return NoopTracing, nil
 	}
 
-	tracer, closer, err := zipkin.New(spec.ServiceName, spec.Zipkin)
+	var tracer opentracing.Tracer
+	var closer io.Closer
+	var err error
+	if spec.Datadog != nil {
+		tracer, closer, err = datadog.New(spec.ServiceName, spec.Datadog)
+	} else {
+		tracer, closer, err = zipkin.New(spec.ServiceName, spec.Zipkin)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,129 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package auditevent publishes the audit events of pipelines
+// to the subscribers in process, such as the KafkaAuditSink.
+package auditevent
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// TypeRequestCompleted is the event of a request completed by a pipeline.
+	TypeRequestCompleted = "requestCompleted"
+	// TypeCircuitBreakerTransited is the event of a circuit breaker
+	// transiting its state.
+	TypeCircuitBreakerTransited = "circuitBreakerTransited"
+)
+
+type (
+	// Event is an audit event of a pipeline.
+	Event struct {
+		Time time.Time
+		Type string
+		// Object is the name of the pipeline.
+		Object string
+		// Filter is the filter returning the result, the last
+		// filter handling the request if all results are empty.
+		Filter string
+		// Result is the result of the filter, or the new state
+		// of the circuit breaker.
+		Result     string
+		StatusCode int
+		Latency    time.Duration
+		RequestID  string
+		SourceIP   string
+	}
+
+	// Subscription receives the events published after it's created.
+	// If the receiver falls behind, the new events are dropped
+	// instead of blocking the publishers.
+	Subscription struct {
+		events chan *Event
+		// dropped is accessed atomically.
+		dropped   uint64
+		closeOnce sync.Once
+	}
+
+	bus struct {
+		mutex         sync.RWMutex
+		subscriptions map[*Subscription]struct{}
+		// count is accessed atomically, to check subscriptions
+		// without locking on the hot path.
+		count int32
+	}
+)
+
+var defaultBus = &bus{subscriptions: map[*Subscription]struct{}{}}
+
+// Enabled reports whether there is any subscription, publishers
+// should check it before building the events.
+func Enabled() bool {
+	return atomic.LoadInt32(&defaultBus.count) > 0
+}
+
+// Publish publishes the event to all subscriptions.
+func Publish(e *Event) {
+	defaultBus.mutex.RLock()
+	defer defaultBus.mutex.RUnlock()
+
+	for s := range defaultBus.subscriptions {
+		select {
+		case s.events <- e:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+	}
+}
+
+// Subscribe creates a subscription buffering at most size events.
+func Subscribe(size int) *Subscription {
+	s := &Subscription{events: make(chan *Event, size)}
+
+	defaultBus.mutex.Lock()
+	defer defaultBus.mutex.Unlock()
+
+	defaultBus.subscriptions[s] = struct{}{}
+	atomic.AddInt32(&defaultBus.count, 1)
+
+	return s
+}
+
+// Events returns the channel of events, it's closed after Close.
+func (s *Subscription) Events() <-chan *Event {
+	return s.events
+}
+
+// Dropped returns the number of events dropped as the receiver fell behind.
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Close closes the subscription.
+func (s *Subscription) Close() {
+	s.closeOnce.Do(func() {
+		defaultBus.mutex.Lock()
+		defer defaultBus.mutex.Unlock()
+
+		delete(defaultBus.subscriptions, s)
+		atomic.AddInt32(&defaultBus.count, -1)
+		close(s.events)
+	})
+}
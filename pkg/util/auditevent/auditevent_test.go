@@ -0,0 +1,64 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auditevent
+
+import (
+	"testing"
+)
+
+func TestPublish(t *testing.T) {
+	if Enabled() {
+		t.Fatalf("want disabled without subscriptions")
+	}
+	Publish(&Event{Type: TypeRequestCompleted})
+
+	s1, s2 := Subscribe(1), Subscribe(2)
+	if !Enabled() {
+		t.Fatalf("want enabled with subscriptions")
+	}
+
+	Publish(&Event{Object: "pipeline-1"})
+	Publish(&Event{Object: "pipeline-2"})
+
+	if e := <-s1.Events(); e.Object != "pipeline-1" {
+		t.Errorf("want pipeline-1, got %s", e.Object)
+	}
+	if s1.Dropped() != 1 {
+		t.Errorf("want 1 dropped event, got %d", s1.Dropped())
+	}
+	for _, want := range []string{"pipeline-1", "pipeline-2"} {
+		if e := <-s2.Events(); e.Object != want {
+			t.Errorf("want %s, got %s", want, e.Object)
+		}
+	}
+
+	s1.Close()
+	s1.Close()
+	if _, ok := <-s1.Events(); ok {
+		t.Errorf("want closed events")
+	}
+	Publish(&Event{Object: "pipeline-3"})
+	if e := <-s2.Events(); e.Object != "pipeline-3" {
+		t.Errorf("want pipeline-3, got %s", e.Object)
+	}
+
+	s2.Close()
+	if Enabled() {
+		t.Errorf("want disabled after closing subscriptions")
+	}
+}
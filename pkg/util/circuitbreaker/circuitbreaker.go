@@ -437,6 +437,21 @@ func (cb *CircuitBreaker) AcquirePermission() (bool, uint32) {
 	return false, cb.stateID
 }
 
+// ReleasePermission releases a permission acquired by AcquirePermission
+// without recording a result, it is used when the result of the call is
+// neither a success nor a failure.
+func (cb *CircuitBreaker) ReleasePermission(stateID uint32) {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+
+	if stateID != cb.stateID || cb.state != StateHalfOpen {
+		return
+	}
+	if cb.numberOfCallsInHalfOpen > 0 {
+		cb.numberOfCallsInHalfOpen--
+	}
+}
+
 // RecordResult records the result in window
 func (cb *CircuitBreaker) RecordResult(stateID uint32, hasErr bool, d time.Duration) {
 	// calculate call result
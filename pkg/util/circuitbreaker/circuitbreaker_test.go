@@ -236,3 +236,43 @@ func TestTimeBased(t *testing.T) {
 		t.Errorf("circuit breaker state should be Open")
 	}
 }
+
+func TestReleasePermission(t *testing.T) {
+	policy := Policy{
+		FailureRateThreshold:             50,
+		SlowCallRateThreshold:            100,
+		SlidingWindowType:                CountBased,
+		SlidingWindowSize:                10,
+		PermittedNumberOfCallsInHalfOpen: 2,
+		MinimumNumberOfCalls:             10,
+		SlowCallDurationThreshold:        time.Minute,
+		WaitDurationInOpen:               5 * time.Second,
+	}
+
+	cb := New(&policy)
+	cb.SetState(StateOpen)
+	now = now.Add(5 * time.Second)
+
+	// released permissions don't count against the calls in half open
+	for i := 0; i < 5; i++ {
+		if permitted, stateID := cb.AcquirePermission(); !permitted {
+			t.Fatalf("acquire permission should succeeded, i = %d", i)
+		} else {
+			cb.ReleasePermission(stateID)
+		}
+	}
+	if cb.State() != StateHalfOpen {
+		t.Errorf("circuit breaker state should be HalfOpen")
+	}
+
+	for i := 0; i < 2; i++ {
+		if permitted, stateID := cb.AcquirePermission(); !permitted {
+			t.Fatalf("acquire permission should succeeded, i = %d", i)
+		} else {
+			cb.RecordResult(stateID, false, time.Millisecond)
+		}
+	}
+	if cb.State() != StateClosed {
+		t.Errorf("circuit breaker state should be Closed")
+	}
+}
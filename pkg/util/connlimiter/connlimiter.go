@@ -0,0 +1,112 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connlimiter
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/util/sampler"
+)
+
+// ErrQueueFull is the error returned when the waiting queue is full.
+var ErrQueueFull = fmt.Errorf("connection queue is full")
+
+type (
+	// ConnLimiter limits the number of simultaneous connections,
+	// the callers exceeding the limit wait in a bounded queue.
+	ConnLimiter struct {
+		slots         chan struct{}
+		maxQueueDepth int32
+		// queueDepth is accessed atomically.
+		queueDepth  int32
+		waitSampler *sampler.DurationSampler
+	}
+
+	// Status contains the queue depth gauge and
+	// the percentiles of queue wait time in millisecond.
+	Status struct {
+		MaxConns      int   `yaml:"maxConns"`
+		Conns         int   `yaml:"conns"`
+		MaxQueueDepth int32 `yaml:"maxQueueDepth"`
+		QueueDepth    int32 `yaml:"queueDepth"`
+
+		WaitP50  float64 `yaml:"waitP50"`
+		WaitP95  float64 `yaml:"waitP95"`
+		WaitP99  float64 `yaml:"waitP99"`
+		WaitP999 float64 `yaml:"waitP999"`
+	}
+)
+
+// New creates a ConnLimiter.
+func New(maxConns int, maxQueueDepth int) *ConnLimiter {
+	return &ConnLimiter{
+		slots:         make(chan struct{}, maxConns),
+		maxQueueDepth: int32(maxQueueDepth),
+		waitSampler:   sampler.NewDurationSampler(),
+	}
+}
+
+// Acquire acquires one connection, it returns ErrQueueFull without waiting
+// if the queue is full, or the error of ctx if ctx is done while waiting.
+// The caller must call Release after using the connection if it returns nil.
+func (cl *ConnLimiter) Acquire(ctx context.Context) error {
+	select {
+	case cl.slots <- struct{}{}:
+		cl.waitSampler.Update(0)
+		return nil
+	default:
+	}
+
+	if atomic.AddInt32(&cl.queueDepth, 1) > cl.maxQueueDepth {
+		atomic.AddInt32(&cl.queueDepth, -1)
+		return ErrQueueFull
+	}
+	defer atomic.AddInt32(&cl.queueDepth, -1)
+
+	startTime := time.Now()
+	select {
+	case cl.slots <- struct{}{}:
+		cl.waitSampler.Update(time.Since(startTime))
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Release releases one connection.
+func (cl *ConnLimiter) Release() {
+	<-cl.slots
+}
+
+// Status returns the status of ConnLimiter.
+func (cl *ConnLimiter) Status() *Status {
+	return &Status{
+		MaxConns:      cap(cl.slots),
+		Conns:         len(cl.slots),
+		MaxQueueDepth: cl.maxQueueDepth,
+		QueueDepth:    atomic.LoadInt32(&cl.queueDepth),
+
+		WaitP50:  cl.waitSampler.P50(),
+		WaitP95:  cl.waitSampler.P95(),
+		WaitP99:  cl.waitSampler.P99(),
+		WaitP999: cl.waitSampler.P999(),
+	}
+}
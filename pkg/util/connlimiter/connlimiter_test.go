@@ -0,0 +1,106 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connlimiter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestConnLimiterUnderLoad(t *testing.T) {
+	var conns, maxConns int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&conns, 1)
+		defer atomic.AddInt32(&conns, -1)
+		for {
+			max := atomic.LoadInt32(&maxConns)
+			if n <= max || atomic.CompareAndSwapInt32(&maxConns, max, n) {
+				break
+			}
+		}
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer upstream.Close()
+
+	cl := New(2, 3)
+
+	var succeeded, queueFull int32
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := cl.Acquire(context.Background())
+			if err == ErrQueueFull {
+				atomic.AddInt32(&queueFull, 1)
+				return
+			}
+			if err != nil {
+				t.Errorf("acquire failed: %v", err)
+				return
+			}
+			defer cl.Release()
+
+			resp, err := http.Get(upstream.URL)
+			if err != nil {
+				t.Errorf("request failed: %v", err)
+				return
+			}
+			resp.Body.Close()
+			atomic.AddInt32(&succeeded, 1)
+		}()
+	}
+	wg.Wait()
+
+	if maxConns > 2 {
+		t.Errorf("max simultaneous connections: want <= 2, got %d", maxConns)
+	}
+	if succeeded != 5 || queueFull != 5 {
+		t.Errorf("want 5 succeeded and 5 rejected, got %d and %d", succeeded, queueFull)
+	}
+
+	status := cl.Status()
+	if status.QueueDepth != 0 || status.Conns != 0 {
+		t.Errorf("want empty queue and no connections, got %d and %d",
+			status.QueueDepth, status.Conns)
+	}
+	if status.WaitP999 < 100 {
+		t.Errorf("want queued requests waiting for at least 100ms, got %fms", status.WaitP999)
+	}
+}
+
+func TestConnLimiterCancel(t *testing.T) {
+	cl := New(1, 1)
+	if err := cl.Acquire(context.Background()); err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := cl.Acquire(ctx); err != context.DeadlineExceeded {
+		t.Errorf("want %v, got %v", context.DeadlineExceeded, err)
+	}
+	if depth := cl.Status().QueueDepth; depth != 0 {
+		t.Errorf("want queue depth 0, got %d", depth)
+	}
+}
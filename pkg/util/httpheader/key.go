@@ -26,6 +26,10 @@ const (
 	KeyContentEncoding = "Content-Encoding"
 	// KeyContentLength is the key of Content-Length.
 	KeyContentLength = "Content-Length"
+	// KeyContentType is the key of Content-Type.
+	KeyContentType = "Content-Type"
+	// KeyTransferEncoding is the key of Transfer-Encoding.
+	KeyTransferEncoding = "Transfer-Encoding"
 	// KeyVary is the key of Vary.
 	KeyVary = "Vary"
 
@@ -0,0 +1,37 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package iotool
+
+import (
+	"io"
+	"io/ioutil"
+)
+
+// ReadLimited reads at most max bytes, complete reports whether
+// the reader has been read to the end.
+func ReadLimited(r io.Reader, max int64) (buff []byte, complete bool) {
+	if r == nil {
+		return nil, true
+	}
+
+	buff, err := ioutil.ReadAll(io.LimitReader(r, max+1))
+	if err != nil {
+		return buff, false
+	}
+	return buff, int64(len(buff)) <= max
+}
@@ -0,0 +1,46 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package iotool
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestReadLimited(t *testing.T) {
+	body, complete := ReadLimited(strings.NewReader("12345"), 5)
+	if !complete || string(body) != "12345" {
+		t.Fatalf("want complete 12345, got %v %s", complete, body)
+	}
+
+	r := strings.NewReader("123456789")
+	body, complete = ReadLimited(r, 5)
+	if complete {
+		t.Fatalf("want incomplete for the body exceeding the limit")
+	}
+	rest, _ := ioutil.ReadAll(r)
+	if got := string(body) + string(rest); got != "123456789" {
+		t.Fatalf("want the body kept intact, got %s", got)
+	}
+
+	body, complete = ReadLimited(nil, 5)
+	if !complete || body != nil {
+		t.Fatalf("want complete empty body for nil reader")
+	}
+}
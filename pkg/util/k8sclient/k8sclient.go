@@ -0,0 +1,113 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package k8sclient is a minimal client of the Kubernetes API server,
+// it verifies the server by the CA file and authenticates by the
+// bearer token file, such as the ones of the service account.
+package k8sclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type (
+	// Spec describes the Kubernetes API server.
+	Spec struct {
+		APIServer string `yaml:"apiServer" jsonschema:"required,format=uri"`
+		// TokenFile is the bearer token, it's read on every request
+		// since the service account tokens are rotated.
+		TokenFile string `yaml:"tokenFile" jsonschema:"omitempty"`
+		// CAFile verifies the API server, the system ones are used if empty.
+		CAFile string `yaml:"caFile" jsonschema:"omitempty"`
+	}
+
+	// Client calls the Kubernetes API server.
+	Client struct {
+		spec   *Spec
+		client *http.Client
+	}
+)
+
+// New creates a Client, the timeout bounds every request.
+func New(spec *Spec, timeout time.Duration) (*Client, error) {
+	tlsConfig := &tls.Config{}
+	if spec.CAFile != "" {
+		ca, err := ioutil.ReadFile(spec.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca file %s failed: %v", spec.CAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate in ca file %s", spec.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return &Client{
+		spec: spec,
+		client: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: tlsConfig,
+			},
+		},
+	}, nil
+}
+
+// Do sends the request to the path of the API server, it returns the
+// response body, or an error if the status code is not 200.
+func (c *Client) Do(ctx context.Context, method, path, contentType string, body []byte) ([]byte, error) {
+	url := strings.TrimSuffix(c.spec.APIServer, "/") + path
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	if c.spec.TokenFile != "" {
+		token, err := ioutil.ReadFile(c.spec.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("read token file %s failed: %v", c.spec.TokenFile, err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%s %s failed: %d %s", method, path, resp.StatusCode, msg)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
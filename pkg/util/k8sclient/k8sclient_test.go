@@ -0,0 +1,74 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package k8sclient
+
+import (
+	"context"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClient(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "Bearer rotated-token" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("forbidden"))
+			return
+		}
+		w.Write([]byte(r.Method + " " + r.URL.Path + " " + r.Header.Get("Authorization")))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.crt")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	ioutil.WriteFile(caFile, ca, 0600)
+	tokenFile := filepath.Join(dir, "token")
+	ioutil.WriteFile(tokenFile, []byte("test-token\n"), 0600)
+
+	client, err := New(&Spec{
+		APIServer: server.URL + "/",
+		TokenFile: tokenFile,
+		CAFile:    caFile,
+	}, time.Second)
+	if err != nil {
+		t.Fatalf("new client failed: %v", err)
+	}
+
+	body, err := client.Do(context.Background(), http.MethodGet, "/api/v1/pods", "", nil)
+	if want := "GET /api/v1/pods Bearer test-token"; err != nil || string(body) != want {
+		t.Errorf("want %q, got %q: %v", want, body, err)
+	}
+
+	// NOTE: The rotated token is used by the next request.
+	ioutil.WriteFile(tokenFile, []byte("rotated-token"), 0600)
+	_, err = client.Do(context.Background(), http.MethodGet, "/api/v1/pods", "", nil)
+	if err == nil || !strings.Contains(err.Error(), "403 forbidden") {
+		t.Errorf("want 403 error, got %v", err)
+	}
+
+	if _, err := New(&Spec{CAFile: tokenFile}, time.Second); err == nil {
+		t.Errorf("want error of ca file without certificate")
+	}
+}
@@ -15,25 +15,26 @@
  * limitations under the License.
  */
 
-package proxy
+// Package masterslavereader provides a reader synchronizing the bytes
+// read by its master to its slave, it's used to mirror request bodies.
+package masterslavereader
 
 import (
 	"bytes"
 	"io"
+	"sync"
 )
 
 type (
-	// masterSlaveReader reads bytes to master,
-	// and synchronize them to slave.
+	// masterReader reads bytes from the source,
+	// and synchronize them to the slave.
 	// Currently only support one slave.
-	masterSlaveReader struct {
-		masterReader io.Reader
-		slaveReader  io.Reader
-	}
-
 	masterReader struct {
 		r        io.Reader
 		buffChan chan []byte
+
+		mutex  sync.Mutex
+		closed bool
 	}
 
 	slaveReader struct {
@@ -42,7 +43,10 @@ type (
 	}
 )
 
-func newMasterSlaveReader(r io.Reader) (io.ReadCloser, io.Reader) {
+// New creates a master reader and its slave reader, the slave must be
+// read concurrently, otherwise the master blocks once the buffer is full.
+// The slave gets io.EOF after the master reaches the end or is closed.
+func New(r io.Reader) (io.ReadCloser, io.Reader) {
 	buffChan := make(chan []byte, 10)
 	mr := &masterReader{
 		r:        r,
@@ -61,18 +65,35 @@ func (mr *masterReader) Read(p []byte) (n int, err error) {
 	tee := io.TeeReader(mr.r, buff)
 	n, err = tee.Read(p)
 
+	mr.mutex.Lock()
+	defer mr.mutex.Unlock()
+
+	if mr.closed {
+		return n, err
+	}
+
 	if n != 0 {
 		mr.buffChan <- buff.Bytes()
 	}
 
 	if err == io.EOF {
+		mr.closed = true
 		close(mr.buffChan)
 	}
 
 	return n, err
 }
 
+// Close closes the source, and ends the slave even if the source
+// hasn't been read to the end, so the slave never waits forever.
 func (mr *masterReader) Close() error {
+	mr.mutex.Lock()
+	if !mr.closed {
+		mr.closed = true
+		close(mr.buffChan)
+	}
+	mr.mutex.Unlock()
+
 	if closer, ok := mr.r.(io.ReadCloser); ok {
 		return closer.Close()
 	}
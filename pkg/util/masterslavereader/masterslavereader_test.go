@@ -0,0 +1,61 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package masterslavereader
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestMasterSlaveReader(t *testing.T) {
+	master, slave := New(strings.NewReader("hello world"))
+
+	slaveBody := make(chan string)
+	go func() {
+		body, _ := ioutil.ReadAll(slave)
+		slaveBody <- string(body)
+	}()
+
+	body, err := ioutil.ReadAll(master)
+	if err != nil || string(body) != "hello world" {
+		t.Errorf("master: want hello world, got %q, %v", body, err)
+	}
+	if body := <-slaveBody; body != "hello world" {
+		t.Errorf("slave: want hello world, got %q", body)
+	}
+}
+
+func TestSlaveEndsOnClose(t *testing.T) {
+	master, slave := New(strings.NewReader("hello world"))
+
+	p := make([]byte, 5)
+	n, err := master.Read(p)
+	if err != nil || n != 5 {
+		t.Fatalf("master: want 5 bytes, got %d, %v", n, err)
+	}
+	master.Close()
+
+	// NOTE: Reading after closed must not send to the closed channel.
+	master.Read(p)
+
+	body, err := ioutil.ReadAll(slave)
+	if err != nil || string(body) != "hello" {
+		t.Errorf("slave: want hello, got %q, %v", body, err)
+	}
+}
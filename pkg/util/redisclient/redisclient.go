@@ -0,0 +1,235 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package redisclient is a minimal Redis client speaking RESP,
+// it only supports the commands with simple replies.
+package redisclient
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	dialTimeout = 3 * time.Second
+	ioTimeout   = 3 * time.Second
+)
+
+type (
+	// Client is a Redis client with a pool of connections.
+	Client struct {
+		spec *Spec
+		pool chan *conn
+	}
+
+	// Spec describes Client.
+	Spec struct {
+		Address  string `yaml:"address" jsonschema:"required"`
+		Password string `yaml:"password" jsonschema:"omitempty"`
+		DB       int    `yaml:"db" jsonschema:"omitempty,minimum=0"`
+		PoolSize int    `yaml:"poolSize" jsonschema:"omitempty,minimum=1"`
+	}
+
+	// Error is the error replied by Redis server.
+	Error string
+
+	conn struct {
+		nc net.Conn
+		rw *bufio.ReadWriter
+	}
+)
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// New creates a Client.
+func New(spec *Spec) *Client {
+	poolSize := spec.PoolSize
+	if poolSize <= 0 {
+		poolSize = 10
+	}
+
+	return &Client{
+		spec: spec,
+		pool: make(chan *conn, poolSize),
+	}
+}
+
+// Do sends the command and returns the reply, the type of reply
+// is one of nil, string, int64, []interface{}, or Error.
+func (c *Client) Do(args ...string) (interface{}, error) {
+	cn, err := c.get()
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := cn.do(args...)
+	if err != nil {
+		cn.nc.Close()
+		return nil, err
+	}
+	c.put(cn)
+
+	if e, ok := reply.(Error); ok {
+		return nil, e
+	}
+
+	return reply, nil
+}
+
+// Close closes all idle connections.
+func (c *Client) Close() {
+	for {
+		select {
+		case cn := <-c.pool:
+			cn.nc.Close()
+		default:
+			return
+		}
+	}
+}
+
+func (c *Client) get() (*conn, error) {
+	select {
+	case cn := <-c.pool:
+		return cn, nil
+	default:
+	}
+
+	nc, err := net.DialTimeout("tcp", c.spec.Address, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	cn := &conn{
+		nc: nc,
+		rw: bufio.NewReadWriter(bufio.NewReader(nc), bufio.NewWriter(nc)),
+	}
+
+	init := func(args ...string) error {
+		reply, err := cn.do(args...)
+		if err != nil {
+			return err
+		}
+		if e, ok := reply.(Error); ok {
+			return e
+		}
+		return nil
+	}
+
+	if c.spec.Password != "" {
+		if err := init("AUTH", c.spec.Password); err != nil {
+			nc.Close()
+			return nil, fmt.Errorf("auth failed: %v", err)
+		}
+	}
+	if c.spec.DB != 0 {
+		if err := init("SELECT", strconv.Itoa(c.spec.DB)); err != nil {
+			nc.Close()
+			return nil, fmt.Errorf("select db %d failed: %v", c.spec.DB, err)
+		}
+	}
+
+	return cn, nil
+}
+
+func (c *Client) put(cn *conn) {
+	select {
+	case c.pool <- cn:
+	default:
+		cn.nc.Close()
+	}
+}
+
+func (cn *conn) do(args ...string) (interface{}, error) {
+	cn.nc.SetDeadline(time.Now().Add(ioTimeout))
+
+	fmt.Fprintf(cn.rw, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(cn.rw, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	err := cn.rw.Flush()
+	if err != nil {
+		return nil, err
+	}
+
+	return cn.readReply()
+}
+
+func (cn *conn) readLine() (string, error) {
+	line, err := cn.rw.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("invalid reply line: %q", line)
+	}
+
+	return line[:len(line)-2], nil
+}
+
+func (cn *conn) readReply() (interface{}, error) {
+	line, err := cn.readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return Error(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buff := make([]byte, n+2)
+		_, err = io.ReadFull(cn.rw, buff)
+		if err != nil {
+			return nil, err
+		}
+		return string(buff[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		replies := make([]interface{}, n)
+		for i := range replies {
+			replies[i], err = cn.readReply()
+			if err != nil {
+				return nil, err
+			}
+		}
+		return replies, nil
+	default:
+		return nil, fmt.Errorf("invalid reply type: %q", line)
+	}
+}
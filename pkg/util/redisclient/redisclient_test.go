@@ -0,0 +1,103 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package redisclient
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+// serveFake serves a fake Redis supporting SET and GET only.
+func serveFake(t *testing.T) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+
+	store := make(map[string]string)
+	go func() {
+		nc, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		r := bufio.NewReader(nc)
+		for {
+			var n int
+			_, err := fmt.Fscanf(r, "*%d\r\n", &n)
+			if err != nil {
+				return
+			}
+			args := make([]string, n)
+			for i := range args {
+				var size int
+				fmt.Fscanf(r, "$%d\r\n", &size)
+				buff := make([]byte, size+2)
+				r.Read(buff)
+				args[i] = string(buff[:size])
+			}
+
+			switch strings.ToUpper(args[0]) {
+			case "SET":
+				store[args[1]] = args[2]
+				fmt.Fprint(nc, "+OK\r\n")
+			case "GET":
+				v, ok := store[args[1]]
+				if !ok {
+					fmt.Fprint(nc, "$-1\r\n")
+				} else {
+					fmt.Fprintf(nc, "$%d\r\n%s\r\n", len(v), v)
+				}
+			default:
+				fmt.Fprintf(nc, "-ERR unknown command '%s'\r\n", args[0])
+			}
+		}
+	}()
+
+	return ln
+}
+
+func TestDo(t *testing.T) {
+	ln := serveFake(t)
+	defer ln.Close()
+
+	c := New(&Spec{Address: ln.Addr().String(), PoolSize: 1})
+	defer c.Close()
+
+	reply, err := c.Do("GET", "key")
+	if err != nil || reply != nil {
+		t.Fatalf("want nil reply, got %v, %v", reply, err)
+	}
+
+	reply, err = c.Do("SET", "key", "hello\r\nworld")
+	if err != nil || reply != "OK" {
+		t.Fatalf("want OK, got %v, %v", reply, err)
+	}
+
+	reply, err = c.Do("GET", "key")
+	if err != nil || reply != "hello\r\nworld" {
+		t.Fatalf("want stored value, got %q, %v", reply, err)
+	}
+
+	_, err = c.Do("INCR", "key")
+	if _, ok := err.(Error); !ok {
+		t.Fatalf("want Error, got %v", err)
+	}
+}